@@ -0,0 +1,310 @@
+// migrate - утилита версионированных миграций схемы БД сервиса отчетов.
+// Миграции встроены в бинарный файл из internal/database/migrations, примененная
+// версия хранится в таблице schema_migrations основной БД из конфигурации сервиса.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/database"
+	"report_srv/internal/database/migrations"
+	"report_srv/internal/logging"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// envConfigDir переменная окружения с каталогом config.yaml сервиса
+	envConfigDir = "MIGRATE_CONFIG"
+
+	// defaultMigrationsDir каталог файлов миграций для команды create
+	defaultMigrationsDir = "internal/database/migrations"
+
+	// Коды завершения
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage неверные аргументы команды, справка уже выведена
+var errUsage = errors.New("неверные аргументы")
+
+// command команда утилиты
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, app *cli, args []string) error
+}
+
+// commands команды утилиты в порядке вывода справки
+var commands = []command{
+	{"up", "[N]", "применить все новые миграции или N следующих", runUp},
+	{"down", "N | -all", "откатить N последних миграций или все", runDown},
+	{"goto", "<version>", "применить или откатить миграции до версии", runGoto},
+	{"version", "", "показать текущую версию схемы", runVersion},
+	{"force", "<version>", "записать версию без выполнения миграций после ручного исправления", runForce},
+	{"create", "<name>", "создать файлы новой миграции в -dir", runCreate},
+}
+
+// cli общие настройки команд
+type cli struct {
+	configDir string
+	sourceDir string
+	dir       string
+	out       io.Writer
+	errOut    io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run разбирает общие флаги, выполняет команду и возвращает код завершения
+func run(ctx context.Context, args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	configDir := flags.String("config", os.Getenv(envConfigDir), "каталог config.yaml сервиса")
+	sourceDir := flags.String("source", "", "каталог файлов миграций вместо встроенных")
+	dir := flags.String("dir", defaultMigrationsDir, "каталог, в котором create создает файлы миграции")
+	timeout := flags.Duration("timeout", 0, "ограничение времени выполнения команды, 0 - без ограничения")
+	flags.Usage = func() { printUsage(flags) }
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		printUsage(flags)
+		return exitUsage
+	}
+
+	cmd, ok := findCommand(flags.Arg(0))
+	if !ok {
+		fmt.Fprintf(errOut, "неизвестная команда: %s\n\n", flags.Arg(0))
+		printUsage(flags)
+		return exitUsage
+	}
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	app := &cli{
+		configDir: *configDir,
+		sourceDir: *sourceDir,
+		dir:       *dir,
+		out:       out,
+		errOut:    errOut,
+	}
+
+	if err := cmd.run(ctx, app, flags.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(errOut, "Использование: migrate %s %s\n", cmd.name, cmd.args)
+			return exitUsage
+		}
+		fmt.Fprintf(errOut, "migrate %s: %v\n", cmd.name, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(flags *flag.FlagSet) {
+	w := flags.Output()
+	fmt.Fprintln(w, "Использование: migrate [flags] <command> [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Команды:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %-12s %s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Флаги:")
+	flags.PrintDefaults()
+}
+
+// withMigrator подключается к основной БД из конфигурации сервиса и выполняет fn
+func (a *cli) withMigrator(ctx context.Context, fn func(migrator *database.VersionedMigrator, db *gorm.DB) error) error {
+	var loader config.ConfigLoader
+	if a.configDir != "" {
+		loader = config.NewConfigLoader(a.configDir)
+	} else {
+		loader = config.NewConfigLoader()
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки конфигурации сервиса: %w", err)
+	}
+
+	base := logrus.New()
+	base.SetOutput(a.errOut)
+	logger := logging.NewLogrus(base)
+
+	conn, err := database.NewDatabaseBuilder(cfg, logger).Build(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var source fs.FS = migrations.FS
+	if a.sourceDir != "" {
+		source = os.DirFS(a.sourceDir)
+	}
+	return fn(database.NewVersionedMigrator(source, logger), conn.DB())
+}
+
+func runUp(ctx context.Context, app *cli, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	return app.withMigrator(ctx, func(migrator *database.VersionedMigrator, db *gorm.DB) error {
+		if len(args) == 0 {
+			return migrator.Up(ctx, db)
+		}
+		steps, err := positiveInt(args[0])
+		if err != nil {
+			return err
+		}
+		return migrator.Steps(ctx, db, steps)
+	})
+}
+
+func runDown(ctx context.Context, app *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return app.withMigrator(ctx, func(migrator *database.VersionedMigrator, db *gorm.DB) error {
+		if args[0] == "-all" {
+			return migrator.Down(ctx, db)
+		}
+		steps, err := positiveInt(args[0])
+		if err != nil {
+			return err
+		}
+		return migrator.Steps(ctx, db, -steps)
+	})
+}
+
+func runGoto(ctx context.Context, app *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	version, err := strconv.ParseUint(args[0], 10, 0)
+	if err != nil {
+		return fmt.Errorf("неверная версия: %s", args[0])
+	}
+	return app.withMigrator(ctx, func(migrator *database.VersionedMigrator, db *gorm.DB) error {
+		return migrator.Goto(ctx, db, uint(version))
+	})
+}
+
+func runVersion(ctx context.Context, app *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return app.withMigrator(ctx, func(migrator *database.VersionedMigrator, db *gorm.DB) error {
+		version, err := migrator.Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		switch {
+		case version.Version == 0:
+			fmt.Fprintln(app.out, "миграции не применялись")
+		case version.Dirty:
+			fmt.Fprintf(app.out, "%d (dirty)\n", version.Version)
+		default:
+			fmt.Fprintln(app.out, version.Version)
+		}
+		return nil
+	})
+}
+
+func runForce(ctx context.Context, app *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	version, err := strconv.Atoi(args[0])
+	if err != nil || version < -1 {
+		return fmt.Errorf("неверная версия: %s", args[0])
+	}
+	return app.withMigrator(ctx, func(migrator *database.VersionedMigrator, db *gorm.DB) error {
+		return migrator.Force(ctx, db, version)
+	})
+}
+
+// migrationFile имя файла миграции: версия и название
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.(up|down)\.sql$`)
+
+// migrationName допустимое название новой миграции
+var migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func runCreate(_ context.Context, app *cli, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if !migrationName.MatchString(args[0]) {
+		return fmt.Errorf("название миграции должно состоять из строчных латинских букв, цифр и _: %s", args[0])
+	}
+
+	entries, err := os.ReadDir(app.dir)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения каталога миграций: %w", err)
+	}
+	var last uint64
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		if version, err := strconv.ParseUint(match[1], 10, 64); err == nil && version > last {
+			last = version
+		}
+	}
+
+	base := fmt.Sprintf("%06d_%s", last+1, args[0])
+	header := fmt.Sprintf("-- %s, создана %s\n", base, time.Now().UTC().Format(time.DateOnly))
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(app.dir, base+"."+direction+".sql")
+		if err := os.WriteFile(path, []byte(header), 0o644); err != nil {
+			return fmt.Errorf("ошибка создания файла миграции: %w", err)
+		}
+		fmt.Fprintln(app.out, path)
+	}
+	return nil
+}
+
+// positiveInt разбирает положительное число миграций
+func positiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("ожидается положительное число миграций: %s", value)
+	}
+	return n, nil
+}
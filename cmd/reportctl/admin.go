@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/database"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+	"report_srv/internal/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultTemplatePrefix каталог шаблонов в хранилище по умолчанию
+const defaultTemplatePrefix = "templates/"
+
+// runTemplates управляет DOCX и XLSX шаблонами определений отчетов в хранилище файлов.
+// Ключ шаблона указывается в поле template_key определения.
+func runTemplates(ctx context.Context, app *cli, args []string) error {
+	usage := func() error {
+		fmt.Fprintln(app.errOut, "Использование:")
+		fmt.Fprintln(app.errOut, "  reportctl templates list [prefix]")
+		fmt.Fprintln(app.errOut, "  reportctl templates upload <file> [key]")
+		fmt.Fprintln(app.errOut, "  reportctl templates download <key> [file]")
+		fmt.Fprintln(app.errOut, "  reportctl templates delete <key>")
+		return errUsage
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	action, args := args[0], args[1:]
+	switch {
+	case action == "list" && len(args) <= 1:
+	case action == "upload" && (len(args) == 1 || len(args) == 2):
+	case action == "download" && (len(args) == 1 || len(args) == 2):
+	case action == "delete" && len(args) == 1:
+	default:
+		return usage()
+	}
+
+	cfg, logger, err := app.loadConfig()
+	if err != nil {
+		return err
+	}
+	fileStorage, err := storage.NewStorageFromConfig(cfg, nil, logger)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к хранилищу: %w", err)
+	}
+
+	switch action {
+	case "list":
+		prefix := defaultTemplatePrefix
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		return app.listTemplates(ctx, fileStorage, prefix)
+
+	case "upload":
+		key := defaultTemplatePrefix + filepath.Base(args[0])
+		if len(args) == 2 {
+			key = args[1]
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("ошибка открытия шаблона: %w", err)
+		}
+		defer file.Close()
+
+		if err := fileStorage.Save(ctx, key, file); err != nil {
+			return fmt.Errorf("ошибка сохранения шаблона: %w", err)
+		}
+		fmt.Fprintf(app.out, "Шаблон загружен: %s\n", key)
+		return nil
+
+	case "download":
+		output := path.Base(args[0])
+		if len(args) == 2 {
+			output = args[1]
+		}
+		reader, err := fileStorage.Get(ctx, args[0])
+		if err != nil {
+			return fmt.Errorf("ошибка получения шаблона: %w", err)
+		}
+		defer reader.Close()
+
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("ошибка создания файла: %w", err)
+		}
+		_, err = io.Copy(file, reader)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(output)
+			return fmt.Errorf("ошибка сохранения шаблона: %w", err)
+		}
+		fmt.Fprintf(app.out, "Шаблон сохранен: %s\n", output)
+		return nil
+
+	default:
+		if err := fileStorage.Delete(ctx, args[0]); err != nil {
+			return fmt.Errorf("ошибка удаления шаблона: %w", err)
+		}
+		fmt.Fprintf(app.out, "Шаблон удален: %s\n", args[0])
+		return nil
+	}
+}
+
+// listTemplates выводит шаблоны с заданным префиксом ключа
+func (a *cli) listTemplates(ctx context.Context, fileStorage storage.Storage, prefix string) error {
+	files, err := fileStorage.List(ctx, prefix)
+	if err != nil {
+		return fmt.Errorf("ошибка получения списка шаблонов: %w", err)
+	}
+
+	if a.json {
+		return a.printJSON(files)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSIZE\tMODIFIED")
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", file.Key, file.Size, formatTime(&file.LastModified))
+	}
+	return w.Flush()
+}
+
+// runCleanup однократно очищает отчеты с истекшим сроком хранения
+// по настройкам retention сервиса, не дожидаясь очередного прохода очистки
+func runCleanup(ctx context.Context, app *cli, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintln(app.errOut, "Использование: reportctl cleanup")
+		return errUsage
+	}
+
+	cfg, logger, err := app.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewDatabase(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к БД: %w", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	fileStorage, err := storage.NewStorageFromConfig(cfg, nil, logger)
+	if err != nil {
+		return fmt.Errorf("ошибка подключения к хранилищу: %w", err)
+	}
+
+	janitor := service.NewRetentionJanitor(
+		cfg.Retention,
+		service.NewGormReportRepository(db, logger),
+		service.NewReportFileStorage(fileStorage, logger),
+		events.NopPublisher{},
+		logger,
+	)
+
+	// Очистка обрабатывает отчеты пачками, повторяем до первой пустой пачки
+	total := 0
+	for ctx.Err() == nil {
+		cleaned := janitor.Cleanup(ctx, time.Now().UTC())
+		if cleaned == 0 {
+			break
+		}
+		total += cleaned
+	}
+
+	if app.json {
+		return app.printJSON(map[string]int{"cleaned": total})
+	}
+	fmt.Fprintf(app.out, "Очищено отчетов: %d\n", total)
+	return ctx.Err()
+}
+
+// loadConfig загружает конфигурацию сервиса для команд, работающих с БД и хранилищем напрямую.
+// Логи сервисных компонентов выводятся в поток ошибок только начиная с предупреждений.
+func (a *cli) loadConfig() (config.Config, logging.Logger, error) {
+	var loader config.ConfigLoader
+	if a.configDir != "" {
+		loader = config.NewConfigLoader(a.configDir)
+	} else {
+		loader = config.NewConfigLoader()
+	}
+
+	cfg, err := loader.Load()
+	if err != nil {
+		return config.Config{}, nil, fmt.Errorf("ошибка загрузки конфигурации сервиса: %w", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(a.errOut)
+	logger.SetLevel(logrus.WarnLevel)
+	return cfg, logging.NewLogrus(logger), nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// serviceEnv настраивает конфигурацию сервиса для команд, работающих напрямую:
+// БД SQLite и локальное хранилище во временном каталоге. Возвращает каталог config.yaml
+// (пустой), путь к БД и каталог хранилища.
+func serviceEnv(t *testing.T) (configDir, dbPath, basePath string) {
+	dir := t.TempDir()
+	configDir = filepath.Join(dir, "config")
+	dbPath = filepath.Join(dir, "reports.db")
+	basePath = filepath.Join(dir, "files")
+	require.NoError(t, os.MkdirAll(configDir, 0o755))
+	require.NoError(t, os.MkdirAll(basePath, 0o755))
+
+	t.Setenv("APP_DATABASE_DRIVER", "sqlite")
+	t.Setenv("APP_DATABASE_DSN", dbPath)
+	t.Setenv("APP_STORAGE_TYPE", "local")
+	t.Setenv("APP_STORAGE_BASEPATH", basePath)
+	return configDir, dbPath, basePath
+}
+
+func TestTemplatesCommand(t *testing.T) {
+	configDir, _, basePath := serviceEnv(t)
+	// Команды templates не обращаются к API сервиса
+	api := newFakeAPI(t)
+	templates := func(args ...string) cliResult {
+		return runCLI(api.url, append([]string{"-config", configDir, "templates"}, args...)...)
+	}
+
+	source := filepath.Join(t.TempDir(), "invoice.docx")
+	require.NoError(t, os.WriteFile(source, []byte("docx template"), 0o600))
+
+	// По умолчанию шаблон загружается в каталог шаблонов под своим именем
+	result := templates("upload", source)
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Equal(t, "Шаблон загружен: templates/invoice.docx\n", result.out)
+	result = templates("upload", source, "custom/act.docx")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.FileExists(t, filepath.Join(basePath, "custom", "act.docx"))
+
+	result = templates("list")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Contains(t, result.out, "KEY")
+	assert.Contains(t, result.out, "templates/invoice.docx")
+	assert.NotContains(t, result.out, "custom/act.docx")
+
+	result = templates("list", "custom/")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Contains(t, result.out, "custom/act.docx")
+
+	output := filepath.Join(t.TempDir(), "downloaded.docx")
+	result = templates("download", "templates/invoice.docx", output)
+	require.Equal(t, exitOK, result.code, result.errOut)
+	content, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "docx template", string(content))
+
+	result = templates("delete", "templates/invoice.docx")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Equal(t, "Шаблон удален: templates/invoice.docx\n", result.out)
+	assert.NoFileExists(t, filepath.Join(basePath, "templates", "invoice.docx"))
+
+	result = templates("download", "templates/invoice.docx", output+".missing")
+	assert.Equal(t, exitError, result.code)
+	assert.Contains(t, result.errOut, "reportctl templates: ошибка получения шаблона")
+	assert.NoFileExists(t, output+".missing")
+
+	result = templates("upload", filepath.Join(t.TempDir(), "missing.docx"))
+	assert.Equal(t, exitError, result.code)
+	assert.Contains(t, result.errOut, "ошибка открытия шаблона")
+
+	assert.Empty(t, api.called())
+}
+
+func TestCleanupCommand(t *testing.T) {
+	configDir, dbPath, basePath := serviceEnv(t)
+	api := newFakeAPI(t)
+
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Report{}, &models.ReportLink{}))
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	past := time.Now().UTC().Add(-time.Hour)
+	future := time.Now().UTC().Add(time.Hour)
+	expired := &models.Report{Title: "Старый", Status: models.StatusCompleted, Format: models.FormatCSV,
+		FileKey: "reports/expired.csv", ExpiresAt: &past, CreatedBy: "alice", UpdatedBy: "alice"}
+	kept := &models.Report{Title: "Свежий", Status: models.StatusCompleted, Format: models.FormatCSV,
+		FileKey: "reports/kept.csv", ExpiresAt: &future, CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, db.Create(expired).Error)
+	require.NoError(t, db.Create(kept).Error)
+	require.NoError(t, os.MkdirAll(filepath.Join(basePath, "reports"), 0o755))
+	for _, report := range []*models.Report{expired, kept} {
+		require.NoError(t, os.WriteFile(filepath.Join(basePath, report.FileKey), []byte("data"), 0o600))
+	}
+
+	result := runCLI(api.url, "-config", configDir, "cleanup")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Equal(t, "Очищено отчетов: 1\n", result.out)
+
+	// Файл отчета с истекшим сроком удален, отчет помечен, остальные не тронуты
+	assert.NoFileExists(t, filepath.Join(basePath, expired.FileKey))
+	assert.FileExists(t, filepath.Join(basePath, kept.FileKey))
+	for _, report := range []*models.Report{expired, kept} {
+		var stored models.Report
+		require.NoError(t, db.First(&stored, report.ID).Error)
+		report.Status = stored.Status
+	}
+	assert.Equal(t, models.StatusExpired, expired.Status)
+	assert.Equal(t, models.StatusCompleted, kept.Status)
+
+	// Повторная очистка ничего не находит
+	result = runCLI(api.url, "-config", configDir, "-json", "cleanup")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	var body map[string]int
+	require.NoError(t, json.Unmarshal([]byte(result.out), &body))
+	assert.Equal(t, map[string]int{"cleaned": 0}, body)
+
+	assert.Empty(t, api.called())
+}
+
+func TestDirectCommandsConfigError(t *testing.T) {
+	configDir, _, _ := serviceEnv(t)
+	t.Setenv("APP_STORAGE_TYPE", "ftp")
+	api := newFakeAPI(t)
+
+	for _, args := range [][]string{{"templates", "list"}, {"cleanup"}} {
+		result := runCLI(api.url, append([]string{"-config", configDir}, args...)...)
+		assert.Equal(t, exitError, result.code, args)
+		assert.Contains(t, result.errOut, "ошибка загрузки конфигурации сервиса", args)
+		assert.Contains(t, result.errOut, "тип хранилища должен быть 'local' или 's3', получено: ftp", args)
+	}
+}
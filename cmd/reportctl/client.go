@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/server"
+	"report_srv/internal/service"
+)
+
+// apiResponse ответ REST API сервиса отчетов
+type apiResponse struct {
+	Success bool             `json:"success"`
+	Data    json.RawMessage  `json:"data"`
+	Error   *server.APIError `json:"error"`
+	Meta    *server.APIMeta  `json:"meta"`
+}
+
+// apiError ошибка, возвращенная REST API
+type apiError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    map[string]string
+}
+
+func (e *apiError) Error() string {
+	message := fmt.Sprintf("%s (HTTP %d, %s)", e.Message, e.StatusCode, e.Code)
+	for field, detail := range e.Details {
+		message += fmt.Sprintf("\n  %s: %s", field, detail)
+	}
+	return message
+}
+
+// apiClient клиент REST API сервиса отчетов
+type apiClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+// newAPIClient создает клиент для сервиса по адресу baseURL
+func newAPIClient(baseURL string) *apiClient {
+	return &apiClient{
+		baseURL: strings.TrimRight(baseURL, "/") + server.APIPrefix,
+		http:    &http.Client{},
+	}
+}
+
+// CreateReport создает отчет
+func (c *apiClient) CreateReport(ctx context.Context, req server.CreateReportRequest) (*models.Report, error) {
+	var report models.Report
+	if _, err := c.do(ctx, http.MethodPost, "/reports", req, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// GetReport возвращает отчет по ID
+func (c *apiClient) GetReport(ctx context.Context, id uint) (*models.Report, error) {
+	var report models.Report
+	if _, err := c.do(ctx, http.MethodGet, "/reports/"+formatID(id), nil, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// ListReports возвращает страницу списка отчетов
+func (c *apiClient) ListReports(ctx context.Context, query url.Values) ([]models.Report, *server.APIMeta, error) {
+	var reports []models.Report
+	meta, err := c.do(ctx, http.MethodGet, "/reports?"+query.Encode(), nil, &reports)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reports, meta, nil
+}
+
+// DeleteReport удаляет отчет
+func (c *apiClient) DeleteReport(ctx context.Context, id uint) error {
+	_, err := c.do(ctx, http.MethodDelete, "/reports/"+formatID(id), nil, nil)
+	return err
+}
+
+// CancelReport отменяет генерацию отчета через административное API очереди задач
+func (c *apiClient) CancelReport(ctx context.Context, id uint) error {
+	_, err := c.do(ctx, http.MethodDelete, "/admin/tasks/report_"+formatID(id), nil, nil)
+	return err
+}
+
+// ListTasks возвращает задачи фонового процессора
+func (c *apiClient) ListTasks(ctx context.Context, status string, limit int) ([]service.TaskInfo, error) {
+	query := url.Values{}
+	if status != "" {
+		query.Set("status", status)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var tasks []service.TaskInfo
+	if _, err := c.do(ctx, http.MethodGet, "/admin/tasks?"+query.Encode(), nil, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// DownloadReport открывает файл готового отчета. Reader должен быть закрыт вызывающей стороной.
+func (c *apiClient) DownloadReport(ctx context.Context, id uint) (io.ReadCloser, string, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/reports/"+formatID(id)+"/file", nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	filename := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		filename = params["filename"]
+	}
+	return resp.Body, filename, nil
+}
+
+// WatchReport вызывает handle для каждого события смены статуса отчета,
+// пока сервер не закроет поток после финального статуса
+func (c *apiClient) WatchReport(ctx context.Context, id uint, handle func(events.Event)) error {
+	resp, err := c.send(ctx, http.MethodGet, "/reports/"+formatID(id)+"/events", nil, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Поток SSE: строки "event: status" и "data: {...}", события разделены пустой строкой
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event events.Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("неверное событие статуса отчета: %w", err)
+		}
+		handle(event)
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("ошибка чтения потока событий: %w", err)
+	}
+	return nil
+}
+
+// do выполняет запрос и декодирует поле data ответа в result
+func (c *apiClient) do(ctx context.Context, method, path string, body, result interface{}) (*server.APIMeta, error) {
+	resp, err := c.send(ctx, method, path, body, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("неверный ответ сервера: %w", err)
+	}
+
+	if result != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, result); err != nil {
+			return nil, fmt.Errorf("неверные данные в ответе сервера: %w", err)
+		}
+	}
+	return response.Meta, nil
+}
+
+// send отправляет запрос и возвращает ответ с успешным статусом.
+// Ошибка API декодируется из тела ответа.
+func (c *apiClient) send(ctx context.Context, method, path string, body interface{}, accept string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка сериализации запроса: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	if body != nil {
+		req.Header.Set(server.HeaderContentType, "application/json")
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к сервису отчетов: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeAPIError(resp)
+	}
+	return resp, nil
+}
+
+// decodeAPIError читает ошибку API из ответа с неуспешным статусом
+func decodeAPIError(resp *http.Response) error {
+	apiErr := &apiError{StatusCode: resp.StatusCode, Code: "HTTP_" + strconv.Itoa(resp.StatusCode), Message: resp.Status}
+
+	var response apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err == nil && response.Error != nil {
+		apiErr.Code = response.Error.Code
+		apiErr.Message = response.Error.Message
+		apiErr.Details = response.Error.Details
+	}
+	return apiErr
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,221 @@
+// reportctl - утилита командной строки для эксплуатации сервиса отчетов и CI.
+// Работа с отчетами выполняется через REST API сервиса, управление шаблонами
+// и очистка по сроку хранения - напрямую с хранилищем и БД по конфигурации сервиса.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultServerURL адрес сервиса отчетов по умолчанию
+	defaultServerURL = "http://localhost:8080"
+
+	// Переменные окружения с настройками по умолчанию
+	envServerURL = "REPORTCTL_SERVER"
+	envConfigDir = "REPORTCTL_CONFIG"
+
+	// Коды завершения
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage неверные аргументы команды, справка уже выведена
+var errUsage = errors.New("неверные аргументы")
+
+// command команда утилиты
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, app *cli, args []string) error
+}
+
+// commands команды утилиты в порядке вывода справки
+var commands = []command{
+	{"create", "[flags]", "создать отчет, при -wait дождаться генерации", runCreate},
+	{"get", "<id>", "показать отчет", runGet},
+	{"list", "[flags]", "список отчетов с фильтрами", runList},
+	{"watch", "<id>", "следить за статусом отчета до окончания генерации", runWatch},
+	{"download", "<id> [-o file]", "скачать файл готового отчета", runDownload},
+	{"cancel", "<id>...", "отменить генерацию отчетов", runCancel},
+	{"delete", "<id>...", "удалить отчеты", runDelete},
+	{"stuck", "[flags]", "найти отчеты, зависшие в очереди или генерации", runStuck},
+	{"templates", "list|upload|download|delete", "управление шаблонами в хранилище (напрямую)", runTemplates},
+	{"cleanup", "", "очистить отчеты с истекшим сроком хранения (напрямую)", runCleanup},
+}
+
+// cli общие настройки команд
+type cli struct {
+	client    *apiClient
+	configDir string
+	json      bool
+	out       io.Writer
+	errOut    io.Writer
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run разбирает общие флаги, выполняет команду и возвращает код завершения
+func run(ctx context.Context, args []string, out, errOut io.Writer) int {
+	flags := flag.NewFlagSet("reportctl", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	serverURL := flags.String("server", envOrDefault(envServerURL, defaultServerURL), "адрес сервиса отчетов")
+	configDir := flags.String("config", os.Getenv(envConfigDir), "каталог config.yaml сервиса для команд templates и cleanup")
+	jsonOutput := flags.Bool("json", false, "выводить результат в JSON")
+	timeout := flags.Duration("timeout", 0, "ограничение времени выполнения команды, 0 - без ограничения")
+	flags.Usage = func() { printUsage(flags) }
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		printUsage(flags)
+		return exitUsage
+	}
+
+	cmd, ok := findCommand(flags.Arg(0))
+	if !ok {
+		fmt.Fprintf(errOut, "неизвестная команда: %s\n\n", flags.Arg(0))
+		printUsage(flags)
+		return exitUsage
+	}
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	app := &cli{
+		client:    newAPIClient(*serverURL),
+		configDir: *configDir,
+		json:      *jsonOutput,
+		out:       out,
+		errOut:    errOut,
+	}
+
+	if err := cmd.run(ctx, app, flags.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			return exitUsage
+		}
+		fmt.Fprintf(errOut, "reportctl %s: %v\n", cmd.name, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(flags *flag.FlagSet) {
+	w := flags.Output()
+	fmt.Fprintln(w, "Использование: reportctl [flags] <command> [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Команды:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %-30s %s\n", cmd.name, cmd.args, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Флаги:")
+	flags.PrintDefaults()
+}
+
+// newFlagSet создает набор флагов команды с выводом справки в поток ошибок
+func (a *cli) newFlagSet(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(a.errOut)
+	flags.Usage = func() {
+		fmt.Fprintf(a.errOut, "Использование: reportctl %s %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags разбирает флаги команды, допуская их после позиционных аргументов
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// printJSON выводит значение в JSON
+func (a *cli) printJSON(value interface{}) error {
+	encoder := json.NewEncoder(a.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// keyValueFlag флаг key=value, который можно указать несколько раз
+type keyValueFlag map[string]interface{}
+
+func (f keyValueFlag) String() string {
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// Set добавляет параметр. Значение, записанное как JSON (число, true, массив), сохраняет тип
+func (f keyValueFlag) Set(value string) error {
+	key, raw, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("ожидается key=value, получено: %s", value)
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		parsed = raw
+	}
+	f[key] = parsed
+	return nil
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// formatTime выводит время в локальной зоне или "-" для пустого значения
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
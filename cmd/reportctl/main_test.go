@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"report_srv/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPI тестовый сервис отчетов: отвечает заданными обработчиками и запоминает запросы
+type fakeAPI struct {
+	mu       sync.Mutex
+	mux      *http.ServeMux
+	requests []string
+	url      string
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	api := &fakeAPI{mux: http.NewServeMux()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		api.requests = append(api.requests, r.Method+" "+r.URL.RequestURI())
+		api.mu.Unlock()
+		api.mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	api.url = srv.URL
+	return api
+}
+
+// handle регистрирует обработчик для шаблона "METHOD /path" относительно префикса API
+func (a *fakeAPI) handle(method, path string, handler http.HandlerFunc) {
+	a.mux.HandleFunc(method+" "+server.APIPrefix+path, handler)
+}
+
+// called возвращает запросы к сервису в порядке поступления
+func (a *fakeAPI) called() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.requests...)
+}
+
+// writeData отвечает успешным ответом API
+func writeData(w http.ResponseWriter, data interface{}, meta *server.APIMeta) {
+	w.Header().Set(server.HeaderContentType, "application/json")
+	json.NewEncoder(w).Encode(server.APIResponse{Success: true, Data: data, Meta: meta})
+}
+
+// writeError отвечает ошибкой API
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set(server.HeaderContentType, "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(server.APIResponse{Error: &server.APIError{Code: code, Message: message}})
+}
+
+// cliResult результат запуска утилиты
+type cliResult struct {
+	code   int
+	out    string
+	errOut string
+}
+
+// runCLI запускает утилиту с сервисом по адресу serverURL
+func runCLI(serverURL string, args ...string) cliResult {
+	var out, errOut bytes.Buffer
+	code := run(context.Background(), append([]string{"-server", serverURL}, args...), &out, &errOut)
+	return cliResult{code: code, out: out.String(), errOut: errOut.String()}
+}
+
+func TestRunArguments(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		errOut string
+	}{
+		{name: "без команды", args: nil, errOut: "Использование: reportctl [flags] <command> [args]"},
+		{name: "неизвестная команда", args: []string{"publish"}, errOut: "неизвестная команда: publish"},
+		{name: "неизвестный общий флаг", args: []string{"-verbose", "list"}, errOut: "flag provided but not defined: -verbose"},
+		{name: "create без названия", args: []string{"create", "-format", "csv"}, errOut: "Использование: reportctl create -title <title> [flags]"},
+		{name: "create с неверным параметром", args: []string{"create", "-title", "x", "-param", "region"}, errOut: "ожидается key=value"},
+		{name: "get без ID", args: []string{"get"}, errOut: "Использование: reportctl get <id>"},
+		{name: "get с двумя ID", args: []string{"get", "1", "2"}, errOut: "Использование: reportctl get <id>"},
+		{name: "get с нулевым ID", args: []string{"get", "0"}, errOut: "Использование: reportctl get <id>"},
+		{name: "get с нечисловым ID", args: []string{"get", "abc"}, errOut: "Использование: reportctl get <id>"},
+		{name: "list с неизвестным флагом", args: []string{"list", "-owner", "bob"}, errOut: "flag provided but not defined: -owner"},
+		{name: "list с неверной страницей", args: []string{"list", "-page", "first"}, errOut: "invalid value"},
+		{name: "watch без ID", args: []string{"watch"}, errOut: "Использование: reportctl watch <id>"},
+		{name: "download с двумя ID", args: []string{"download", "1", "2"}, errOut: "Использование: reportctl download <id> [-o file]"},
+		{name: "cancel без ID", args: []string{"cancel"}, errOut: "Использование: reportctl cancel <id>..."},
+		{name: "cancel с неверным ID", args: []string{"cancel", "1", "x"}, errOut: "Использование: reportctl cancel <id>..."},
+		{name: "delete без ID", args: []string{"delete"}, errOut: "Использование: reportctl delete <id>..."},
+		{name: "stuck с неверным порогом", args: []string{"stuck", "-older-than", "час"}, errOut: "invalid value"},
+		{name: "templates без действия", args: []string{"templates"}, errOut: "reportctl templates list [prefix]"},
+		{name: "templates с неизвестным действием", args: []string{"templates", "rename", "a", "b"}, errOut: "reportctl templates delete <key>"},
+		{name: "templates delete без ключа", args: []string{"templates", "delete"}, errOut: "reportctl templates delete <key>"},
+		{name: "cleanup с аргументом", args: []string{"cleanup", "now"}, errOut: "Использование: reportctl cleanup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+
+			result := runCLI(api.url, tt.args...)
+			assert.Equal(t, exitUsage, result.code)
+			assert.Contains(t, result.errOut, tt.errOut)
+			assert.Empty(t, result.out)
+			// При неверных аргументах сервис не вызывается
+			assert.Empty(t, api.called())
+		})
+	}
+}
+
+func TestRunCommandError(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle(http.MethodGet, "/reports/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Отчет не найден")
+	})
+
+	result := runCLI(api.url, "get", "42")
+	assert.Equal(t, exitError, result.code)
+	assert.Equal(t, "reportctl get: Отчет не найден (HTTP 404, NOT_FOUND)\n", result.errOut)
+	assert.Empty(t, result.out)
+
+	// Ответ без тела API описывается HTTP статусом
+	api.handle(http.MethodGet, "/reports", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+	result = runCLI(api.url, "list")
+	assert.Equal(t, exitError, result.code)
+	assert.Contains(t, result.errOut, "502 Bad Gateway (HTTP 502, HTTP_502)")
+}
+
+func TestRunTimeout(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle(http.MethodGet, "/reports/{id}", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	result := runCLI(api.url, "-timeout", "50ms", "get", "1")
+	assert.Equal(t, exitError, result.code)
+	assert.Contains(t, result.errOut, context.DeadlineExceeded.Error())
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		positional []string
+		output     string
+		wantErr    bool
+	}{
+		{name: "флаги перед аргументами", args: []string{"-o", "out.csv", "7"}, positional: []string{"7"}, output: "out.csv"},
+		{name: "флаги после аргументов", args: []string{"7", "-o", "out.csv"}, positional: []string{"7"}, output: "out.csv"},
+		{name: "флаги между аргументами", args: []string{"7", "-o", "out.csv", "8"}, positional: []string{"7", "8"}, output: "out.csv"},
+		{name: "без флагов", args: []string{"7"}, positional: []string{"7"}},
+		{name: "без аргументов", args: nil, positional: nil},
+		{name: "неизвестный флаг", args: []string{"7", "-x"}, wantErr: true},
+		{name: "флаг без значения", args: []string{"7", "-o"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &cli{out: &bytes.Buffer{}, errOut: &bytes.Buffer{}}
+			flags := app.newFlagSet("download", "<id> [-o file]")
+			output := flags.String("o", "", "")
+
+			positional, err := parseFlags(flags, tt.args)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errUsage)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.positional, positional)
+			assert.Equal(t, tt.output, *output)
+		})
+	}
+}
+
+func TestKeyValueFlag(t *testing.T) {
+	tests := []struct {
+		value   string
+		key     string
+		want    interface{}
+		wantErr bool
+	}{
+		{value: "region=north", key: "region", want: "north"},
+		{value: "limit=100", key: "limit", want: float64(100)},
+		{value: "draft=true", key: "draft", want: true},
+		{value: `ids=[1,2]`, key: "ids", want: []interface{}{float64(1), float64(2)}},
+		{value: `quoted="42"`, key: "quoted", want: "42"},
+		{value: "filter=a=b", key: "filter", want: "a=b"},
+		{value: "empty=", key: "empty", want: ""},
+		{value: "region", wantErr: true},
+		{value: "=north", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			flag := keyValueFlag{}
+			err := flag.Set(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, flag)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, flag[tt.key])
+		})
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []uint
+		wantErr bool
+	}{
+		{args: nil, want: []uint{}},
+		{args: []string{"1"}, want: []uint{1}},
+		{args: []string{"3", "1", "2"}, want: []uint{3, 1, 2}},
+		{args: []string{"0"}, wantErr: true},
+		{args: []string{"-1"}, wantErr: true},
+		{args: []string{"1", "abc"}, wantErr: true},
+		{args: []string{"4294967296"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		ids, err := parseIDs(tt.args)
+		if tt.wantErr {
+			assert.Error(t, err, tt.args)
+			continue
+		}
+		require.NoError(t, err, tt.args)
+		assert.Equal(t, tt.want, ids, tt.args)
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/server"
+)
+
+const (
+	// defaultStuckAfter время без движения, после которого отчет считается зависшим
+	defaultStuckAfter = 30 * time.Minute
+	// stuckPageSize размер страницы при поиске зависших отчетов
+	stuckPageSize = 100
+)
+
+// runCreate создает отчет
+func runCreate(ctx context.Context, app *cli, args []string) error {
+	params := keyValueFlag{}
+	flags := app.newFlagSet("create", "-title <title> [flags]")
+	title := flags.String("title", "", "название отчета (обязательно)")
+	description := flags.String("description", "", "описание отчета")
+	reportType := flags.String("type", "", "тип отчета")
+	format := flags.String("format", "", "формат файла: xlsx, csv, docx, html, json или ndjson")
+	createdBy := flags.String("created-by", envOrDefault("USER", "reportctl"), "автор отчета")
+	paramsFile := flags.String("params-file", "", "JSON файл с параметрами отчета")
+	flags.Var(params, "param", "параметр отчета key=value, можно указать несколько раз")
+	wait := flags.Bool("wait", false, "дождаться окончания генерации")
+	output := flags.String("o", "", "после генерации сохранить файл отчета по этому пути (включает -wait)")
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *title == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	parameters := map[string]interface{}{}
+	if *paramsFile != "" {
+		content, err := os.ReadFile(*paramsFile)
+		if err != nil {
+			return fmt.Errorf("ошибка чтения файла параметров: %w", err)
+		}
+		if err := json.Unmarshal(content, &parameters); err != nil {
+			return fmt.Errorf("неверный JSON в файле параметров: %w", err)
+		}
+	}
+	for key, value := range params {
+		parameters[key] = value
+	}
+
+	report, err := app.client.CreateReport(ctx, server.CreateReportRequest{
+		Title:       *title,
+		Description: *description,
+		Type:        *reportType,
+		Parameters:  parameters,
+		Format:      *format,
+		CreatedBy:   *createdBy,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !*wait && *output == "" {
+		return app.printReport(report)
+	}
+
+	fmt.Fprintf(app.errOut, "Отчет %d создан\n", report.ID)
+	if err := app.watch(ctx, report.ID); err != nil {
+		return err
+	}
+	if *output != "" {
+		return app.download(ctx, report.ID, *output)
+	}
+	return nil
+}
+
+// runGet выводит отчет
+func runGet(ctx context.Context, app *cli, args []string) error {
+	id, err := parseSingleID(app, "get", args)
+	if err != nil {
+		return err
+	}
+
+	report, err := app.client.GetReport(ctx, id)
+	if err != nil {
+		return err
+	}
+	return app.printReport(report)
+}
+
+// runList выводит страницу списка отчетов
+func runList(ctx context.Context, app *cli, args []string) error {
+	flags := app.newFlagSet("list", "[flags]")
+	status := flags.String("status", "", "статус отчетов")
+	format := flags.String("format", "", "формат файла")
+	createdBy := flags.String("created-by", "", "автор отчетов")
+	search := flags.String("search", "", "поиск по названию и описанию")
+	sortBy := flags.String("sort", "", "поле сортировки: created_at, updated_at, generated_at, title, status, format")
+	desc := flags.Bool("desc", false, "сортировать по убыванию")
+	page := flags.Int("page", 1, "номер страницы")
+	pageSize := flags.Int("page-size", server.DefaultPageSize, "размер страницы")
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	setQuery(query, "status", *status)
+	setQuery(query, "format", *format)
+	setQuery(query, "created_by", *createdBy)
+	setQuery(query, "search", *search)
+	setQuery(query, "sort_by", *sortBy)
+	if *desc {
+		query.Set("sort_desc", "true")
+	}
+	query.Set("page", strconv.Itoa(*page))
+	query.Set("page_size", strconv.Itoa(*pageSize))
+
+	reports, meta, err := app.client.ListReports(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if app.json {
+		return app.printJSON(map[string]interface{}{"reports": reports, "meta": meta})
+	}
+	app.printReports(reports)
+	if meta != nil {
+		fmt.Fprintf(app.out, "\nСтраница %d из %d, всего отчетов: %d\n", meta.Page, meta.TotalPages, meta.Total)
+	}
+	return nil
+}
+
+// runWatch следит за статусом отчета
+func runWatch(ctx context.Context, app *cli, args []string) error {
+	id, err := parseSingleID(app, "watch", args)
+	if err != nil {
+		return err
+	}
+	return app.watch(ctx, id)
+}
+
+// runDownload скачивает файл отчета
+func runDownload(ctx context.Context, app *cli, args []string) error {
+	flags := app.newFlagSet("download", "<id> [-o file]")
+	output := flags.String("o", "", "путь для сохранения, \"-\" - стандартный вывод; по умолчанию имя файла отчета")
+
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	ids, err := parseIDs(positional)
+	if err != nil || len(ids) != 1 {
+		flags.Usage()
+		return errUsage
+	}
+
+	return app.download(ctx, ids[0], *output)
+}
+
+// runCancel отменяет генерацию отчетов
+func runCancel(ctx context.Context, app *cli, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil || len(ids) == 0 {
+		fmt.Fprintln(app.errOut, "Использование: reportctl cancel <id>...")
+		return errUsage
+	}
+
+	for _, id := range ids {
+		if err := app.client.CancelReport(ctx, id); err != nil {
+			return fmt.Errorf("отчет %d: %w", id, err)
+		}
+		fmt.Fprintf(app.out, "Генерация отчета %d отменена\n", id)
+	}
+	return nil
+}
+
+// runDelete удаляет отчеты
+func runDelete(ctx context.Context, app *cli, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil || len(ids) == 0 {
+		fmt.Fprintln(app.errOut, "Использование: reportctl delete <id>...")
+		return errUsage
+	}
+
+	for _, id := range ids {
+		if err := app.client.DeleteReport(ctx, id); err != nil {
+			return fmt.Errorf("отчет %d: %w", id, err)
+		}
+		fmt.Fprintf(app.out, "Отчет %d удален\n", id)
+	}
+	return nil
+}
+
+// runStuck выводит отчеты в статусе pending или processing, которые не менялись
+// дольше порога, и при -cancel отменяет их генерацию
+func runStuck(ctx context.Context, app *cli, args []string) error {
+	flags := app.newFlagSet("stuck", "[flags]")
+	olderThan := flags.Duration("older-than", defaultStuckAfter, "время без изменений, после которого отчет считается зависшим")
+	cancel := flags.Bool("cancel", false, "отменить генерацию найденных отчетов")
+
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	threshold := time.Now().Add(-*olderThan)
+	var stuck []models.Report
+	for _, status := range []models.ReportStatus{models.StatusPending, models.StatusProcessing} {
+		reports, err := app.listAll(ctx, url.Values{"status": {string(status)}, "sort_by": {"updated_at"}})
+		if err != nil {
+			return err
+		}
+		for _, report := range reports {
+			if lastActivity(&report).Before(threshold) {
+				stuck = append(stuck, report)
+			}
+		}
+	}
+
+	if app.json {
+		if err := app.printJSON(stuck); err != nil {
+			return err
+		}
+	} else if len(stuck) == 0 {
+		fmt.Fprintln(app.out, "Зависших отчетов нет")
+	} else {
+		app.printReports(stuck)
+	}
+
+	if !*cancel {
+		return nil
+	}
+
+	failed := 0
+	for _, report := range stuck {
+		if err := app.client.CancelReport(ctx, report.ID); err != nil {
+			fmt.Fprintf(app.errOut, "Ошибка отмены отчета %d: %v\n", report.ID, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(app.errOut, "Генерация отчета %d отменена\n", report.ID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("не удалось отменить отчетов: %d", failed)
+	}
+	return nil
+}
+
+// listAll читает все страницы списка отчетов
+func (a *cli) listAll(ctx context.Context, query url.Values) ([]models.Report, error) {
+	var all []models.Report
+	query.Set("page_size", strconv.Itoa(stuckPageSize))
+
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		reports, meta, err := a.client.ListReports(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, reports...)
+		if meta == nil || page >= meta.TotalPages {
+			return all, nil
+		}
+	}
+}
+
+// lastActivity время последнего признака движения отчета: heartbeat генерации или изменения записи
+func lastActivity(report *models.Report) time.Time {
+	if report.HeartbeatAt != nil && report.HeartbeatAt.After(report.UpdatedAt) {
+		return *report.HeartbeatAt
+	}
+	return report.UpdatedAt
+}
+
+// watch выводит смены статуса отчета и возвращает ошибку, если отчет не сгенерирован
+func (a *cli) watch(ctx context.Context, id uint) error {
+	var last events.Event
+	err := a.client.WatchReport(ctx, id, func(event events.Event) {
+		last = event
+		if a.json {
+			a.printJSON(event)
+			return
+		}
+		line := fmt.Sprintf("%s  отчет %d: %s", event.Timestamp.Local().Format("15:04:05"), event.ReportID, event.Status)
+		if event.ErrorCode != "" {
+			line += " (" + string(event.ErrorCode) + ")"
+		}
+		fmt.Fprintln(a.out, line)
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case last.Type == events.ReportDeleted:
+		return fmt.Errorf("отчет %d удален", id)
+	case last.Status == models.StatusCompleted:
+		return nil
+	case last.Status == models.StatusFailed:
+		if report, err := a.client.GetReport(ctx, id); err == nil && report.ErrorMessage != "" {
+			return fmt.Errorf("генерация отчета %d завершилась ошибкой %s: %s", id, report.ErrorCode, report.ErrorMessage)
+		}
+		return fmt.Errorf("генерация отчета %d завершилась ошибкой %s", id, last.ErrorCode)
+	case last.Status.IsFinal():
+		return fmt.Errorf("отчет %d в статусе %s", id, last.Status)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		return fmt.Errorf("поток событий отчета %d закрыт до окончания генерации", id)
+	}
+}
+
+// download сохраняет файл отчета. Пустой путь - имя файла отчета в текущем каталоге
+func (a *cli) download(ctx context.Context, id uint, output string) error {
+	reader, filename, err := a.client.DownloadReport(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if output == "-" {
+		_, err := io.Copy(a.out, reader)
+		return err
+	}
+	if output == "" {
+		output = filepath.Base(filename)
+		if filename == "" {
+			output = fmt.Sprintf("report_%d", id)
+		}
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла: %w", err)
+	}
+	size, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("ошибка сохранения файла отчета: %w", err)
+	}
+
+	fmt.Fprintf(a.errOut, "Файл отчета %d сохранен: %s (%d байт)\n", id, output, size)
+	return nil
+}
+
+// printReport выводит отчет
+func (a *cli) printReport(report *models.Report) error {
+	if a.json {
+		return a.printJSON(report)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%d\n", report.ID)
+	fmt.Fprintf(w, "Название:\t%s\n", report.Title)
+	if report.Description != "" {
+		fmt.Fprintf(w, "Описание:\t%s\n", report.Description)
+	}
+	if report.Type != "" {
+		fmt.Fprintf(w, "Тип:\t%s\n", report.Type)
+	}
+	fmt.Fprintf(w, "Статус:\t%s\n", report.Status)
+	fmt.Fprintf(w, "Формат:\t%s\n", report.Format)
+	fmt.Fprintf(w, "Прогресс:\t%d%% (%d строк)\n", report.Progress, report.RowsProcessed)
+	if report.ErrorCode != "" {
+		fmt.Fprintf(w, "Ошибка:\t%s: %s\n", report.ErrorCode, report.ErrorMessage)
+	}
+	fmt.Fprintf(w, "Автор:\t%s\n", report.CreatedBy)
+	fmt.Fprintf(w, "Создан:\t%s\n", formatTime(&report.CreatedAt))
+	fmt.Fprintf(w, "Изменен:\t%s\n", formatTime(&report.UpdatedAt))
+	fmt.Fprintf(w, "Сгенерирован:\t%s\n", formatTime(report.GeneratedAt))
+	fmt.Fprintf(w, "Хранится до:\t%s\n", formatTime(report.ExpiresAt))
+	return w.Flush()
+}
+
+// printReports выводит отчеты таблицей
+func (a *cli) printReports(reports []models.Report) {
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tFORMAT\tPROGRESS\tCREATED BY\tUPDATED\tTITLE")
+	for _, report := range reports {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d%%\t%s\t%s\t%s\n", report.ID, report.Status, report.Format,
+			report.Progress, report.CreatedBy, formatTime(&report.UpdatedAt), report.Title)
+	}
+	w.Flush()
+}
+
+// parseSingleID разбирает единственный аргумент команды - ID отчета
+func parseSingleID(app *cli, name string, args []string) (uint, error) {
+	ids, err := parseIDs(args)
+	if err != nil || len(ids) != 1 {
+		fmt.Fprintf(app.errOut, "Использование: reportctl %s <id>\n", name)
+		return 0, errUsage
+	}
+	return ids[0], nil
+}
+
+// parseIDs разбирает ID отчетов
+func parseIDs(args []string) ([]uint, error) {
+	ids := make([]uint, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("неверный ID отчета: %s", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+func setQuery(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReport отчет, который возвращает тестовый сервис
+func testReport(id uint, status models.ReportStatus) models.Report {
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	return models.Report{
+		ID:        id,
+		Title:     "Продажи",
+		Status:    status,
+		Format:    models.FormatCSV,
+		CreatedBy: "alice",
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+}
+
+// writeEvents отвечает потоком SSE со сменами статуса отчета
+func writeEvents(w http.ResponseWriter, list ...events.Event) {
+	w.Header().Set(server.HeaderContentType, "text/event-stream")
+	for _, event := range list {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+	}
+}
+
+func statusEvent(eventType events.EventType, id uint, status models.ReportStatus) events.Event {
+	return events.Event{Type: eventType, ReportID: id, Status: status, Timestamp: time.Now()}
+}
+
+func TestCreateCommand(t *testing.T) {
+	api := newFakeAPI(t)
+	var received server.CreateReportRequest
+	api.handle(http.MethodPost, "/reports", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		report := testReport(7, models.StatusPending)
+		report.Title = received.Title
+		writeData(w, report, nil)
+	})
+
+	paramsFile := filepath.Join(t.TempDir(), "params.json")
+	require.NoError(t, os.WriteFile(paramsFile, []byte(`{"region":"south","year":2023}`), 0o600))
+
+	result := runCLI(api.url, "create", "-title", "Продажи", "-description", "Итоги квартала", "-type", "sales",
+		"-format", "xlsx", "-created-by", "bob", "-params-file", paramsFile, "-param", "region=north", "-param", "top=10")
+	require.Equal(t, exitOK, result.code, result.errOut)
+
+	assert.Equal(t, server.CreateReportRequest{
+		Title:       "Продажи",
+		Description: "Итоги квартала",
+		Type:        "sales",
+		Format:      "xlsx",
+		CreatedBy:   "bob",
+		// Параметры командной строки переопределяют файл параметров
+		Parameters: map[string]interface{}{"region": "north", "year": float64(2023), "top": float64(10)},
+	}, received)
+	assert.Regexp(t, `ID:\s+7\n`, result.out)
+	assert.Regexp(t, `Статус:\s+pending\n`, result.out)
+	assert.Equal(t, []string{"POST /api/v1/reports"}, api.called())
+
+	// Неверный файл параметров не отправляет запрос
+	require.NoError(t, os.WriteFile(paramsFile, []byte(`{"region":`), 0o600))
+	result = runCLI(api.url, "create", "-title", "Продажи", "-params-file", paramsFile)
+	assert.Equal(t, exitError, result.code)
+	assert.Contains(t, result.errOut, "неверный JSON в файле параметров")
+	assert.Len(t, api.called(), 1)
+}
+
+func TestCreateCommandWait(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle(http.MethodPost, "/reports", func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, testReport(7, models.StatusPending), nil)
+	})
+	api.handle(http.MethodGet, "/reports/7/events", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+		writeEvents(w,
+			statusEvent(events.ReportStarted, 7, models.StatusProcessing),
+			statusEvent(events.ReportCompleted, 7, models.StatusCompleted))
+	})
+	api.handle(http.MethodGet, "/reports/7/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="sales.csv"`)
+		w.Write([]byte("region,total\nnorth,10\n"))
+	})
+
+	output := filepath.Join(t.TempDir(), "report.csv")
+	result := runCLI(api.url, "create", "-title", "Продажи", "-o", output)
+	require.Equal(t, exitOK, result.code, result.errOut)
+
+	assert.Contains(t, result.errOut, "Отчет 7 создан")
+	assert.Contains(t, result.out, "отчет 7: processing")
+	assert.Contains(t, result.out, "отчет 7: completed")
+	content, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "region,total\nnorth,10\n", string(content))
+	assert.Equal(t, []string{"POST /api/v1/reports", "GET /api/v1/reports/7/events", "GET /api/v1/reports/7/file"}, api.called())
+}
+
+func TestGetCommand(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle(http.MethodGet, "/reports/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.PathValue("id"))
+		report := testReport(uint(id), models.StatusFailed)
+		report.ErrorCode = models.ErrorCodeGeneration
+		report.ErrorMessage = "нет данных"
+		writeData(w, report, nil)
+	})
+
+	result := runCLI(api.url, "get", "12")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Regexp(t, `Название:\s+Продажи\n`, result.out)
+	assert.Regexp(t, `Статус:\s+failed\n`, result.out)
+	assert.Regexp(t, `Ошибка:\s+`+string(models.ErrorCodeGeneration)+`: нет данных\n`, result.out)
+	assert.Regexp(t, `Сгенерирован:\s+-\n`, result.out)
+
+	result = runCLI(api.url, "-json", "get", "12")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	var report models.Report
+	require.NoError(t, json.Unmarshal([]byte(result.out), &report))
+	assert.Equal(t, uint(12), report.ID)
+	assert.Equal(t, models.StatusFailed, report.Status)
+}
+
+func TestListCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		query string
+	}{
+		{name: "по умолчанию", args: nil, query: "page=1&page_size=" + strconv.Itoa(server.DefaultPageSize)},
+		{
+			name:  "с фильтрами",
+			args:  []string{"-status", "failed", "-format", "csv", "-created-by", "alice", "-search", "продажи", "-sort", "title", "-desc", "-page", "2", "-page-size", "5"},
+			query: "created_by=alice&format=csv&page=2&page_size=5&search=%D0%BF%D1%80%D0%BE%D0%B4%D0%B0%D0%B6%D0%B8&sort_by=title&sort_desc=true&status=failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			api.handle(http.MethodGet, "/reports", func(w http.ResponseWriter, r *http.Request) {
+				writeData(w, []models.Report{testReport(1, models.StatusCompleted), testReport(2, models.StatusFailed)},
+					&server.APIMeta{Page: 2, PageSize: 5, Total: 7, TotalPages: 2})
+			})
+
+			result := runCLI(api.url, append([]string{"list"}, tt.args...)...)
+			require.Equal(t, exitOK, result.code, result.errOut)
+			assert.Equal(t, []string{"GET /api/v1/reports?" + tt.query}, api.called())
+			assert.Contains(t, result.out, "ID  STATUS     FORMAT")
+			assert.Contains(t, result.out, "1   completed  csv")
+			assert.Contains(t, result.out, "2   failed     csv")
+			assert.Contains(t, result.out, "Страница 2 из 2, всего отчетов: 7")
+		})
+	}
+}
+
+func TestListCommandJSON(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle(http.MethodGet, "/reports", func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, []models.Report{testReport(1, models.StatusCompleted)}, &server.APIMeta{Page: 1, PageSize: 20, Total: 1, TotalPages: 1})
+	})
+
+	result := runCLI(api.url, "-json", "list")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	var body struct {
+		Reports []models.Report `json:"reports"`
+		Meta    server.APIMeta  `json:"meta"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(result.out), &body))
+	require.Len(t, body.Reports, 1)
+	assert.Equal(t, uint(1), body.Reports[0].ID)
+	assert.Equal(t, 1, body.Meta.Total)
+}
+
+func TestWatchCommand(t *testing.T) {
+	failed := statusEvent(events.ReportFailed, 3, models.StatusFailed)
+	failed.ErrorCode = models.ErrorCodeGeneration
+
+	tests := []struct {
+		name   string
+		events []events.Event
+		code   int
+		errOut string
+	}{
+		{
+			name:   "отчет сгенерирован",
+			events: []events.Event{statusEvent(events.ReportStarted, 3, models.StatusProcessing), statusEvent(events.ReportCompleted, 3, models.StatusCompleted)},
+			code:   exitOK,
+		},
+		{
+			name:   "генерация завершилась ошибкой",
+			events: []events.Event{statusEvent(events.ReportStarted, 3, models.StatusProcessing), failed},
+			code:   exitError,
+			errOut: "генерация отчета 3 завершилась ошибкой " + string(models.ErrorCodeGeneration) + ": нет данных",
+		},
+		{
+			name:   "отчет отменен",
+			events: []events.Event{statusEvent(events.ReportCanceled, 3, models.StatusCanceled)},
+			code:   exitError,
+			errOut: "отчет 3 в статусе canceled",
+		},
+		{
+			name:   "отчет удален",
+			events: []events.Event{statusEvent(events.ReportStarted, 3, models.StatusProcessing), statusEvent(events.ReportDeleted, 3, "")},
+			code:   exitError,
+			errOut: "отчет 3 удален",
+		},
+		{
+			name:   "поток закрыт до окончания генерации",
+			events: []events.Event{statusEvent(events.ReportStarted, 3, models.StatusProcessing)},
+			code:   exitError,
+			errOut: "поток событий отчета 3 закрыт до окончания генерации",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			api.handle(http.MethodGet, "/reports/3/events", func(w http.ResponseWriter, r *http.Request) {
+				writeEvents(w, tt.events...)
+			})
+			api.handle(http.MethodGet, "/reports/3", func(w http.ResponseWriter, r *http.Request) {
+				report := testReport(3, models.StatusFailed)
+				report.ErrorCode = models.ErrorCodeGeneration
+				report.ErrorMessage = "нет данных"
+				writeData(w, report, nil)
+			})
+
+			result := runCLI(api.url, "watch", "3")
+			assert.Equal(t, tt.code, result.code, result.errOut)
+			for _, event := range tt.events {
+				if event.Status != "" {
+					assert.Contains(t, result.out, "отчет 3: "+string(event.Status))
+				}
+			}
+			if tt.errOut != "" {
+				assert.Contains(t, result.errOut, "reportctl watch: "+tt.errOut)
+			}
+		})
+	}
+}
+
+func TestWatchCommandJSON(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle(http.MethodGet, "/reports/3/events", func(w http.ResponseWriter, r *http.Request) {
+		writeEvents(w, statusEvent(events.ReportCompleted, 3, models.StatusCompleted))
+	})
+
+	result := runCLI(api.url, "-json", "watch", "3")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	var event events.Event
+	require.NoError(t, json.Unmarshal([]byte(result.out), &event))
+	assert.Equal(t, events.ReportCompleted, event.Type)
+	assert.Equal(t, models.StatusCompleted, event.Status)
+}
+
+func TestDownloadCommand(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle(http.MethodGet, "/reports/5/file", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="../sales.csv"`)
+		w.Write([]byte("region,total\n"))
+	})
+	api.handle(http.MethodGet, "/reports/6/file", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusConflict, "CONFLICT", "Отчет еще не готов")
+	})
+
+	// Файл сохраняется по пути -o, флаг допускается после ID
+	output := filepath.Join(t.TempDir(), "out.csv")
+	result := runCLI(api.url, "download", "5", "-o", output)
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Contains(t, result.errOut, "Файл отчета 5 сохранен: "+output+" (13 байт)")
+	content, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "region,total\n", string(content))
+
+	// "-" выводит файл в стандартный вывод
+	result = runCLI(api.url, "download", "-o", "-", "5")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Equal(t, "region,total\n", result.out)
+
+	// Ошибка API не создает файл
+	output = filepath.Join(t.TempDir(), "missing.csv")
+	result = runCLI(api.url, "download", "6", "-o", output)
+	assert.Equal(t, exitError, result.code)
+	assert.Contains(t, result.errOut, "Отчет еще не готов (HTTP 409, CONFLICT)")
+	assert.NoFileExists(t, output)
+}
+
+func TestCancelAndDeleteCommands(t *testing.T) {
+	tests := []struct {
+		command string
+		method  string
+		path    string
+		prefix  string
+		done    string
+	}{
+		{command: "cancel", method: http.MethodDelete, path: "/admin/tasks/", prefix: "report_", done: "Генерация отчета %d отменена"},
+		{command: "delete", method: http.MethodDelete, path: "/reports/", done: "Отчет %d удален"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			api := newFakeAPI(t)
+			api.handle(tt.method, tt.path+"{id}", func(w http.ResponseWriter, r *http.Request) {
+				if r.PathValue("id") == tt.prefix+"9" {
+					writeError(w, http.StatusNotFound, "NOT_FOUND", "Отчет не найден")
+					return
+				}
+				writeData(w, nil, nil)
+			})
+
+			result := runCLI(api.url, tt.command, "1", "2")
+			require.Equal(t, exitOK, result.code, result.errOut)
+			assert.Equal(t, fmt.Sprintf(tt.done+"\n"+tt.done+"\n", 1, 2), result.out)
+			prefix := tt.method + " " + server.APIPrefix + tt.path + tt.prefix
+			assert.Equal(t, []string{prefix + "1", prefix + "2"}, api.called())
+
+			// Первая ошибка останавливает обработку остальных отчетов
+			result = runCLI(api.url, tt.command, "3", "9", "4")
+			assert.Equal(t, exitError, result.code)
+			assert.Equal(t, fmt.Sprintf(tt.done+"\n", 3), result.out)
+			assert.Contains(t, result.errOut, "reportctl "+tt.command+": отчет 9: Отчет не найден (HTTP 404, NOT_FOUND)")
+			assert.Len(t, api.called(), 4)
+		})
+	}
+}
+
+func TestStuckCommand(t *testing.T) {
+	now := time.Now().UTC()
+	report := func(id uint, status models.ReportStatus, updated time.Duration, heartbeat *time.Duration) models.Report {
+		r := testReport(id, status)
+		r.UpdatedAt = now.Add(-updated)
+		if heartbeat != nil {
+			at := now.Add(-*heartbeat)
+			r.HeartbeatAt = &at
+		}
+		return r
+	}
+	recent := time.Minute
+
+	api := newFakeAPI(t)
+	api.handle(http.MethodGet, "/reports", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal(t, "updated_at", query.Get("sort_by"))
+		assert.Equal(t, strconv.Itoa(stuckPageSize), query.Get("page_size"))
+		switch query.Get("status") + "/" + query.Get("page") {
+		case "pending/1":
+			writeData(w, []models.Report{report(1, models.StatusPending, 2*time.Hour, nil)}, &server.APIMeta{Page: 1, TotalPages: 2, Total: 2})
+		case "pending/2":
+			writeData(w, []models.Report{report(2, models.StatusPending, time.Minute, nil)}, &server.APIMeta{Page: 2, TotalPages: 2, Total: 2})
+		case "processing/1":
+			// Отчет 4 давно не менялся, но генерация продолжается и обновляет heartbeat
+			writeData(w, []models.Report{
+				report(3, models.StatusProcessing, time.Hour, nil),
+				report(4, models.StatusProcessing, time.Hour, &recent),
+			}, &server.APIMeta{Page: 1, TotalPages: 1, Total: 2})
+		default:
+			t.Errorf("неожиданный запрос списка: %s", r.URL.RawQuery)
+		}
+	})
+	api.handle(http.MethodDelete, "/admin/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "report_3" {
+			writeError(w, http.StatusConflict, "CONFLICT", "Задача уже завершена")
+			return
+		}
+		writeData(w, nil, nil)
+	})
+
+	result := runCLI(api.url, "stuck", "-older-than", "30m")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Contains(t, result.out, "1   pending")
+	assert.Contains(t, result.out, "3   processing")
+	assert.NotContains(t, result.out, "2   pending")
+	assert.NotContains(t, result.out, "4   processing")
+	assert.Len(t, api.called(), 3)
+
+	result = runCLI(api.url, "-json", "stuck", "-older-than", "3h")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Equal(t, "null\n", result.out)
+
+	result = runCLI(api.url, "stuck", "-older-than", "3h")
+	require.Equal(t, exitOK, result.code, result.errOut)
+	assert.Equal(t, "Зависших отчетов нет\n", result.out)
+
+	// Ошибка отмены одного отчета не останавливает отмену остальных
+	result = runCLI(api.url, "stuck", "-cancel")
+	assert.Equal(t, exitError, result.code)
+	assert.Contains(t, result.errOut, "Генерация отчета 1 отменена")
+	assert.Contains(t, result.errOut, "Ошибка отмены отчета 3: Задача уже завершена (HTTP 409, CONFLICT)")
+	assert.Contains(t, result.errOut, "reportctl stuck: не удалось отменить отчетов: 1")
+	calls := api.called()
+	assert.Equal(t, []string{"DELETE /api/v1/admin/tasks/report_1", "DELETE /api/v1/admin/tasks/report_3"}, calls[len(calls)-2:])
+}
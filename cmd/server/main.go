@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
@@ -9,23 +12,70 @@ import (
 
 	"report_srv/internal/config"
 	"report_srv/internal/database"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
 	"report_srv/internal/server"
 	"report_srv/internal/service"
 	"report_srv/internal/storage"
+	"report_srv/internal/telemetry"
 
 	"github.com/sirupsen/logrus"
 	"go.uber.org/fx"
+	"gorm.io/gorm"
 )
 
 func main() {
+	validate := flag.Bool("validate-config", false, "проверить конфигурацию, DSN и доступность хранилища и завершить работу")
+	output := flag.String("output", "text", "формат отчета -validate-config: text или json")
+	schema := flag.Bool("config-schema", false, "вывести JSON Schema файла конфигурации и завершить работу")
+	flag.Parse()
+
+	switch {
+	case *schema:
+		os.Exit(printConfigSchema(os.Stdout))
+	case *validate:
+		os.Exit(validateConfig(os.Stdout, *output))
+	}
+
 	app := fx.New(
 		// Поставщики зависимостей
 		fx.Provide(
 			provideConfig,
 			provideLogger,
+			telemetry.NewProvider,
+			events.NewBusFromConfig,
 			database.NewDatabase,
+			provideReadReplica,
+			storage.NewURLSignerFromConfig,
 			storage.NewStorageFromConfig,
-			service.NewReportServiceFromDB,
+			provideDataSources,
+			service.NewQueryValidatorFromConfig,
+			service.NewGormDefinitionRepository,
+			service.NewDefinitionService,
+			service.NewLocalizationFromConfig,
+			service.NewFormatGeneratorsFromConfig,
+			service.NewPreviewServiceFromConfig,
+			service.NewQuotaServiceFromConfig,
+			service.NewStatsServiceFromDB,
+			service.NewSLAServiceFromDB,
+			service.NewNotificationServiceFromDB,
+			service.NewUserSettingsServiceFromDB,
+			service.NewAPIKeyServiceFromDB,
+			service.NewLinkServiceFromDB,
+			service.NewAttachmentServiceFromConfig,
+			service.NewDatasetServiceFromConfig,
+			service.NewDiffService,
+			providePipelineHooks,
+			service.NewReportServiceFromConfig,
+			service.NewAdminServiceFromConfig,
+			service.NewGormScheduleRepository,
+			service.NewScheduleService,
+			provideScheduler,
+			service.NewRetentionJanitorFromConfig,
+			service.NewDigestJobFromConfig,
+			service.NewReportRecoveryFromConfig,
+			service.NewSLAMonitorFromConfig,
+			service.NewTransitionJobFromConfig,
 			server.NewServer,
 		),
 
@@ -46,42 +96,136 @@ func provideConfig() (config.Config, error) {
 	return cfg, nil
 }
 
-// provideLogger создает и настраивает логгер на основе конфигурации
-func provideLogger(cfg config.Config) *logrus.Logger {
-	logger := logrus.New()
-
-	// Устанавливаем уровень логирования
-	level, err := logrus.ParseLevel(cfg.Logging.Level)
+// provideLogger создает логгер, выбранный в конфигурации
+func provideLogger(cfg config.Config) (logging.Logger, error) {
+	logger, err := logging.New(cfg.Logging)
 	if err != nil {
-		level = logrus.InfoLevel
-		logger.WithError(err).Warn("Неверный уровень логирования, используется info")
+		return nil, fmt.Errorf("ошибка создания логгера: %w", err)
 	}
-	logger.SetLevel(level)
 
-	// Устанавливаем формат вывода
-	switch cfg.Logging.Format {
-	case "json":
-		logger.SetFormatter(&logrus.JSONFormatter{
-			TimestampFormat: time.RFC3339,
-		})
-	default:
-		logger.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp:   true,
-			TimestampFormat: time.RFC3339,
-		})
+	logger.WithField("config", cfg.String()).Info("Запуск сервиса отчетов")
+	return logger, nil
+}
+
+// provideScheduler создает планировщик генерации отчетов по расписанию. Расписания
+// определений с итерационным запросом создают по отчету на строку запроса
+func provideScheduler(
+	cfg config.Config,
+	repository service.ScheduleRepository,
+	reportService service.ReportService,
+	definitions service.DefinitionRepository,
+	queries service.QueryValidator,
+	sources service.DataSources,
+	db *gorm.DB,
+	logger logging.Logger,
+) *service.Scheduler {
+	fanOut := service.NewDefinitionFanOut(definitions, queries, sources, cfg.Scheduler.MaxFanOut, logger)
+	guard := service.NewDefinitionRunGuard(definitions, service.NewGormReportRepository(db, logger), logger)
+	return service.NewScheduler(repository, reportService, cfg.Scheduler.Interval, logger).
+		WithFanOut(fanOut).
+		WithRunGuard(guard)
+}
+
+// provideReadReplica подключается к реплике БД для запросов на чтение, если она настроена
+func provideReadReplica(cfg config.Config, db *gorm.DB, logger logging.Logger) (service.ReadReplica, error) {
+	replica, err := database.NewReadReplica(cfg, db, logger)
+	if err != nil {
+		return nil, err
 	}
+	return replica, nil
+}
 
-	logger.WithField("config", cfg.String()).Info("Запуск сервиса отчетов")
-	return logger
+// provideDataSources создает менеджер источников данных для запросов определений отчетов.
+// Запросы к основной базе данных выполняются на реплике, если она настроена.
+func provideDataSources(cfg config.Config, replica service.ReadReplica, logger logging.Logger) service.DataSources {
+	return database.NewDataSourceManager(cfg, replica.DB(), logger)
+}
+
+// pipelineHookParams хуки генерации отчетов, зарегистрированные в группах fx.
+// Реализацию подключают через fx.Annotate с fx.As и fx.ResultTags, например
+// `group:"before_store_hooks"` для BeforeStoreHook.
+type pipelineHookParams struct {
+	fx.In
+
+	BeforeQuery []service.BeforeQueryHook `group:"before_query_hooks"`
+	AfterFill   []service.AfterFillHook   `group:"after_fill_hooks"`
+	BeforeStore []service.BeforeStoreHook `group:"before_store_hooks"`
+}
+
+// providePipelineHooks собирает хуки генерации отчетов из групп fx
+func providePipelineHooks(params pipelineHookParams) *service.PipelineHooks {
+	return service.NewPipelineHooks(params.BeforeQuery, params.AfterFill, params.BeforeStore)
 }
 
 // registerLifecycleHooks настраивает хуки жизненного цикла приложения
 func registerLifecycleHooks(
 	srv server.HTTPServer,
+	tracing *telemetry.Provider,
+	bus events.Bus,
+	processor service.BackgroundProcessor,
+	scheduler *service.Scheduler,
+	janitor *service.RetentionJanitor,
+	digest *service.DigestJob,
+	recovery *service.ReportRecovery,
+	slaMonitor *service.SLAMonitor,
+	transition *service.TransitionJob,
+	sources service.DataSources,
+	replica service.ReadReplica,
 	cfg config.Config,
-	logger *logrus.Logger,
+	logger logging.Logger,
 	lc fx.Lifecycle,
 ) {
+	// Провайдер трассировки останавливается последним, чтобы выгрузить все спаны
+	lc.Append(fx.Hook{
+		OnStop: tracing.Shutdown,
+	})
+
+	// Подключения к источникам данных закрываются после остановки генерации отчетов
+	if closer, ok := sources.(io.Closer); ok {
+		lc.Append(fx.Hook{
+			OnStop: func(ctx context.Context) error {
+				return closer.Close()
+			},
+		})
+	}
+	if closer, ok := replica.(io.Closer); ok {
+		lc.Append(fx.Hook{
+			OnStop: func(ctx context.Context) error {
+				return closer.Close()
+			},
+		})
+	}
+
+	// Внешние публикаторы событий останавливаются после процессора,
+	// чтобы отправить события о последних завершенных отчетах
+	if managed, ok := bus.(events.ManagedPublisher); ok {
+		lc.Append(fx.Hook{
+			OnStart: managed.Start,
+			OnStop:  managed.Stop,
+		})
+	}
+
+	// Процессор с внешней очередью запускается до HTTP сервера и останавливается после него
+	if managed, ok := processor.(service.ManagedProcessor); ok {
+		lc.Append(fx.Hook{
+			OnStart: managed.Start,
+			OnStop:  managed.Stop,
+		})
+	}
+
+	// Прерванные отчеты возвращаются в очередь после запуска процессора
+	if cfg.Recovery.Enabled {
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				recovery.Start()
+				return nil
+			},
+			OnStop: recovery.Stop,
+		})
+	} else {
+		logger.Info("Восстановление прерванных отчетов отключено")
+	}
+
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			logger.Info("Запуск HTTP сервера")
@@ -97,6 +241,63 @@ func registerLifecycleHooks(
 			return srv.Shutdown(ctx)
 		},
 	})
+
+	if cfg.Retention.Enabled {
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				janitor.Start()
+				return nil
+			},
+			OnStop: janitor.Stop,
+		})
+	} else {
+		logger.Info("Очистка отчетов по сроку хранения отключена")
+	}
+
+	if cfg.SLA.Enabled {
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				slaMonitor.Start()
+				return nil
+			},
+			OnStop: slaMonitor.Stop,
+		})
+	}
+
+	if cfg.Digest.Enabled {
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				digest.Start()
+				return nil
+			},
+			OnStop: digest.Stop,
+		})
+	}
+
+	if cfg.Storage.Transition.Enabled {
+		lc.Append(fx.Hook{
+			OnStart: func(ctx context.Context) error {
+				transition.Start()
+				return nil
+			},
+			OnStop: transition.Stop,
+		})
+	}
+
+	if !cfg.Scheduler.Enabled {
+		logger.Info("Планировщик отчетов отключен")
+		return
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			scheduler.Start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return scheduler.Stop(ctx)
+		},
+	})
 }
 
 // runWithGracefulShutdown обрабатывает жизненный цикл приложения с обработкой сигналов
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/database"
+	"report_srv/internal/storage"
+)
+
+// validateTimeout время на проверки внешних зависимостей конфигурации
+const validateTimeout = 30 * time.Second
+
+// validateConfig проверяет конфигурацию и внешние зависимости без запуска сервиса и печатает
+// отчет в формате output (text или json). Возвращает код завершения: 0 - конфигурация корректна.
+func validateConfig(w io.Writer, output string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+
+	report := config.Verify(ctx,
+		config.Probe{Name: "database.dsn", Check: database.CheckDSN},
+		config.Probe{Name: "storage.reachable", Check: storage.CheckReachable},
+	)
+
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return 2
+		}
+	default:
+		printReport(w, report)
+	}
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+// printReport печатает отчет о проверке конфигурации построчно
+func printReport(w io.Writer, report *config.Report) {
+	if report.ConfigFile != "" {
+		fmt.Fprintf(w, "Файл конфигурации: %s\n", report.ConfigFile)
+	} else {
+		fmt.Fprintln(w, "Файл конфигурации не найден: используются окружение и значения по умолчанию")
+	}
+	for _, check := range report.Checks {
+		if check.Error != "" {
+			fmt.Fprintf(w, "%-8s %s: %s\n", check.Status, check.Name, check.Error)
+			continue
+		}
+		fmt.Fprintf(w, "%-8s %s\n", check.Status, check.Name)
+	}
+	if report.Valid {
+		fmt.Fprintln(w, "Конфигурация корректна")
+	} else {
+		fmt.Fprintln(w, "Конфигурация содержит ошибки")
+	}
+}
+
+// printConfigSchema печатает JSON Schema файла конфигурации
+func printConfigSchema(w io.Writer) int {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config.Schema()); err != nil {
+		return 1
+	}
+	return 0
+}
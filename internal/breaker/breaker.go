@@ -0,0 +1,176 @@
+// Package breaker реализует автоматический выключатель (circuit breaker) для
+// внешних зависимостей сервиса: после серии ошибок обращения к зависимости
+// отклоняются сразу, пока она не восстановится.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+)
+
+// State состояние выключателя
+type State string
+
+const (
+	// StateClosed обращения выполняются, ошибки подсчитываются
+	StateClosed State = "closed"
+	// StateOpen обращения отклоняются с ErrOpen до истечения OpenTimeout
+	StateOpen State = "open"
+	// StateHalfOpen выполняется одно пробное обращение: успех закрывает
+	// выключатель, ошибка снова размыкает его
+	StateHalfOpen State = "half_open"
+)
+
+// ErrOpen зависимость недоступна, обращение отклонено без выполнения
+var ErrOpen = errors.New("зависимость временно недоступна")
+
+// OpenError ошибка разомкнутого выключателя. errors.Is(err, ErrOpen) возвращает true.
+type OpenError struct {
+	// Name имя зависимости
+	Name string
+	// RetryAfter через сколько выключатель пропустит пробное обращение
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Name, ErrOpen.Error())
+}
+
+// Is сопоставляет ошибку с ErrOpen
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Breaker автоматический выключатель зависимости. Выключатель размыкается после
+// FailureThreshold ошибок подряд, через OpenTimeout пропускает одно пробное обращение
+// и закрывается, если оно выполнено успешно.
+type Breaker struct {
+	name      string
+	threshold int
+	timeout   time.Duration
+	isFailure func(error) bool
+	logger    logging.Logger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// New создает выключатель зависимости name. isFailure определяет, какие ошибки говорят
+// о недоступности зависимости: остальные ошибки (например, отсутствие записи) не
+// размыкают выключатель. nil - любая ошибка.
+func New(name string, cfg config.CircuitBreaker, isFailure func(error) bool, logger logging.Logger) *Breaker {
+	if isFailure == nil {
+		isFailure = func(err error) bool { return err != nil }
+	}
+	if logger == nil {
+		logger = logging.Nop()
+	}
+	return &Breaker{
+		name:      name,
+		threshold: max(cfg.FailureThreshold, 1),
+		timeout:   cfg.OpenTimeout,
+		isFailure: isFailure,
+		logger:    logger,
+		now:       time.Now,
+		state:     StateClosed,
+	}
+}
+
+// Name возвращает имя зависимости
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State возвращает текущее состояние выключателя
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && !b.now().Before(b.openedAt.Add(b.timeout)) {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Do выполняет fn, если выключатель пропускает обращение, и учитывает ее результат
+func (b *Breaker) Do(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Done(err)
+	return err
+}
+
+// Allow сообщает, можно ли выполнить обращение. Если Allow вернула nil, результат
+// обращения нужно передать в Done.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if retryAfter := b.openedAt.Add(b.timeout).Sub(b.now()); retryAfter > 0 {
+			return &OpenError{Name: b.name, RetryAfter: retryAfter}
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return &OpenError{Name: b.name, RetryAfter: b.timeout}
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Done учитывает результат обращения, разрешенного Allow
+func (b *Breaker) Done(err error) {
+	failed := b.isFailure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.state == StateHalfOpen && failed:
+		b.probing = false
+		b.open(err)
+	case b.state == StateHalfOpen:
+		b.probing = false
+		b.state = StateClosed
+		b.failures = 0
+		b.logger.WithField("dependency", b.name).Info("Зависимость снова доступна, выключатель замкнут")
+	case failed:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.open(err)
+		}
+	case err == nil:
+		b.failures = 0
+	}
+}
+
+// open размыкает выключатель. Вызывается под блокировкой.
+func (b *Breaker) open(err error) {
+	if b.state != StateOpen {
+		b.logger.WithFields(logging.Fields{
+			"dependency":   b.name,
+			"failures":     b.failures,
+			"open_timeout": b.timeout,
+		}).WithError(err).Error("Зависимость недоступна, выключатель разомкнут")
+	}
+	b.state = StateOpen
+	b.openedAt = b.now()
+	b.failures = 0
+}
@@ -0,0 +1,76 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	errDown     = errors.New("connection refused")
+	errNotFound = errors.New("not found")
+)
+
+func newTestBreaker(now *time.Time) *Breaker {
+	b := New("database", config.CircuitBreaker{Enabled: true, FailureThreshold: 3, OpenTimeout: 10 * time.Second},
+		func(err error) bool { return errors.Is(err, errDown) }, logging.Nop())
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	now := time.Now()
+	b := newTestBreaker(&now)
+	fail := func() error { return errDown }
+
+	// Успешное обращение сбрасывает счетчик, ошибки запросов не учитываются
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.NoError(t, b.Do(func() error { return nil }))
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.ErrorIs(t, b.Do(func() error { return errNotFound }), errNotFound)
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.Equal(t, StateClosed, b.State())
+
+	assert.ErrorIs(t, b.Do(fail), errDown)
+	assert.Equal(t, StateOpen, b.State())
+
+	called := false
+	err := b.Do(func() error { called = true; return nil })
+	assert.False(t, called)
+	var openErr *OpenError
+	require.ErrorAs(t, err, &openErr)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Equal(t, "database", openErr.Name)
+	assert.Equal(t, 10*time.Second, openErr.RetryAfter)
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	now := time.Now()
+	b := newTestBreaker(&now)
+	for range 3 {
+		b.Do(func() error { return errDown })
+	}
+	require.Equal(t, StateOpen, b.State())
+
+	// После open_timeout пропускается одно пробное обращение, ошибка снова размыкает выключатель
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	require.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+	b.Done(errDown)
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+
+	// Успешная проба замыкает выключатель
+	now = now.Add(10 * time.Second)
+	assert.NoError(t, b.Do(func() error { return nil }))
+	assert.Equal(t, StateClosed, b.State())
+	assert.NoError(t, b.Allow())
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+)
+
+// CheckStatus результат отдельной проверки конфигурации
+type CheckStatus string
+
+const (
+	CheckOK      CheckStatus = "ok"
+	CheckFailed  CheckStatus = "failed"
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// Check результат проверки раздела конфигурации или внешней зависимости
+type Check struct {
+	Name   string      `json:"name"`
+	Status CheckStatus `json:"status"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Report результат проверки конфигурации
+type Report struct {
+	// Valid конфигурация прочитана и все проверки пройдены
+	Valid bool `json:"valid"`
+	// ConfigFile прочитанный файл конфигурации, пустой - только окружение и значения по умолчанию
+	ConfigFile string  `json:"config_file,omitempty"`
+	Checks     []Check `json:"checks"`
+}
+
+// add добавляет результат проверки
+func (r *Report) add(name string, err error) {
+	check := Check{Name: name, Status: CheckOK}
+	if err != nil {
+		check.Status, check.Error = CheckFailed, err.Error()
+		r.Valid = false
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+// Probe проверка внешней зависимости по конфигурации без запуска сервиса,
+// например разбор DSN или доступность bucket
+type Probe struct {
+	Name  string
+	Check func(ctx context.Context, cfg Config) error
+}
+
+// Verify читает конфигурацию из файла и окружения, как при запуске сервиса, и проверяет
+// все разделы, не останавливаясь на первой ошибке. Проверки probes выполняются,
+// только если разделы корректны: иначе они отмечаются пропущенными.
+func Verify(ctx context.Context, probes ...Probe) *Report {
+	return newViperConfigLoader().Verify(ctx, probes...)
+}
+
+// Verify проверяет конфигурацию загрузчика
+func (l *ViperConfigLoader) Verify(ctx context.Context, probes ...Probe) *Report {
+	report := &Report{Valid: true}
+
+	cfg, err := l.read()
+	report.ConfigFile = viper.ConfigFileUsed()
+	report.add("load", err)
+	if err != nil {
+		return report
+	}
+
+	for _, section := range sectionValidators(cfg) {
+		report.add(section.section, section.validator.Validate())
+	}
+
+	valid := report.Valid
+	for _, probe := range probes {
+		if !valid {
+			report.Checks = append(report.Checks, Check{Name: probe.Name, Status: CheckSkipped})
+			continue
+		}
+		report.add(probe.Name, probe.Check(ctx, cfg))
+	}
+	return report
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// durationType тип длительностей: в файле задаются строкой вида 30s или 1h30m
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Schema возвращает JSON Schema файла конфигурации, построенную по структуре Config,
+// со значениями по умолчанию. Неизвестные ключи разделов считаются ошибкой,
+// поэтому опечатки находятся редактором или проверкой в CI до развертывания.
+func Schema() map[string]interface{} {
+	loader := newViperConfigLoader()
+	loader.setDefaults()
+
+	schema := typeSchema(reflect.TypeOf(Config{}), "")
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "Report service configuration"
+	return schema
+}
+
+// typeSchema возвращает схему значения типа t по ключу key конфигурации
+func typeSchema(t reflect.Type, key string) map[string]interface{} {
+	schema := map[string]interface{}{}
+	switch {
+	case t == durationType:
+		schema["type"] = []string{"string", "integer"}
+		schema["pattern"] = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+	case t.Kind() == reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := field.Tag.Get("mapstructure")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			properties[name] = typeSchema(field.Type, joinKey(key, name))
+		}
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+		return schema
+	case t.Kind() == reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = typeSchema(t.Elem(), "")
+		return schema
+	case t.Kind() == reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem(), "")
+	case t.Kind() == reflect.String:
+		schema["type"] = "string"
+	case t.Kind() == reflect.Bool:
+		schema["type"] = "boolean"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		schema["type"] = "integer"
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		schema["type"] = "integer"
+		schema["minimum"] = 0
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema["type"] = "number"
+	}
+
+	if key != "" {
+		if value := viper.Get(key); value != nil {
+			if duration, ok := value.(time.Duration); ok {
+				value = duration.String()
+			}
+			schema["default"] = value
+		}
+	}
+	return schema
+}
+
+// joinKey возвращает вложенный ключ конфигурации
+func joinKey(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
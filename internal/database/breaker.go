@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"report_srv/internal/breaker"
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+const (
+	// breakerPluginName имя плагина выключателя в настройках GORM
+	breakerPluginName = "circuit_breaker"
+
+	// breakerAllowedKey отметка запроса, пропущенного выключателем
+	breakerAllowedKey = "circuit_breaker:allowed"
+)
+
+// BreakerPlugin плагин GORM, пропускающий запросы к БД через выключатель: после серии
+// ошибок подключения запросы сразу завершаются ошибкой breaker.ErrOpen
+type BreakerPlugin struct {
+	breaker *breaker.Breaker
+}
+
+// NewBreakerPlugin создает плагин выключателя БД name из конфигурации
+func NewBreakerPlugin(name string, cfg config.CircuitBreaker, logger logging.Logger) *BreakerPlugin {
+	return &BreakerPlugin{breaker: breaker.New(name, cfg, IsConnectionError, logger)}
+}
+
+// Name возвращает имя плагина
+func (p *BreakerPlugin) Name() string {
+	return breakerPluginName
+}
+
+// Initialize регистрирует callbacks для всех типов операций. Проверка выключателя
+// выполняется первой, учет результата - после всех остальных callbacks.
+func (p *BreakerPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+
+	type registration struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}
+
+	registrations := []registration{
+		{"create", callbacks.Create().Before("*").Register, callbacks.Create().After("*").Register},
+		{"query", callbacks.Query().Before("*").Register, callbacks.Query().After("*").Register},
+		{"update", callbacks.Update().Before("*").Register, callbacks.Update().After("*").Register},
+		{"delete", callbacks.Delete().Before("*").Register, callbacks.Delete().After("*").Register},
+		{"row", callbacks.Row().Before("*").Register, callbacks.Row().After("*").Register},
+		{"raw", callbacks.Raw().Before("*").Register, callbacks.Raw().After("*").Register},
+	}
+
+	for _, r := range registrations {
+		if err := r.before("circuit_breaker:before_"+r.operation, p.before); err != nil {
+			return err
+		}
+		if err := r.after("circuit_breaker:after_"+r.operation, p.after); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// before отклоняет запрос, если выключатель разомкнут. Callbacks GORM не выполняют
+// запрос, если в db уже есть ошибка.
+func (p *BreakerPlugin) before(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	if err := p.breaker.Allow(); err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(breakerAllowedKey, true)
+}
+
+// after учитывает результат пропущенного запроса
+func (p *BreakerPlugin) after(db *gorm.DB) {
+	if allowed, _ := db.InstanceGet(breakerAllowedKey); allowed != true {
+		return
+	}
+	db.InstanceSet(breakerAllowedKey, false)
+	p.breaker.Done(db.Error)
+}
+
+// CircuitBreaker возвращает выключатель, подключенный к db, или nil
+func CircuitBreaker(db *gorm.DB) *breaker.Breaker {
+	if plugin, ok := db.Config.Plugins[breakerPluginName].(*BreakerPlugin); ok {
+		return plugin.breaker
+	}
+	return nil
+}
+
+// Ping проверяет соединение с БД через выключатель, если он подключен. При разомкнутом
+// выключателе Ping пробует подключиться не чаще open_timeout и замыкает его после
+// успешной проверки, поэтому readiness probe восстанавливает сервис без входящих запросов.
+func Ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if cb := CircuitBreaker(db); cb != nil {
+		return cb.Do(func() error { return sqlDB.PingContext(ctx) })
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// IsConnectionError сообщает, говорит ли ошибка запроса о недоступности БД: ошибки сети
+// и соединения, отказ PostgreSQL в подключении. Ошибки самих запросов, отсутствие записи
+// и отмена контекста не учитываются.
+func IsConnectionError(err error) bool {
+	if err == nil || errors.Is(err, gorm.ErrRecordNotFound) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, breaker.ErrOpen) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 - ошибки соединения, 57P01-57P03 - остановка или запуск сервера, 53300 - нет свободных подключений
+		switch pgErr.Code {
+		case "57P01", "57P02", "57P03", "53300":
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// IsTransientError сообщает, может ли повтор запроса к источнику данных завершиться успешно:
+// недоступность БД, открытый выключатель, истекшее время ожидания, отмена запроса по таймауту
+// сервера, конфликт сериализации или блокировки, ответ API 5xx или 429. Ошибки SQL и
+// отмена контекста вызывающей стороной временными не считаются.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if IsConnectionError(err) || errors.Is(err, breaker.ErrOpen) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 57014 - отмена по statement_timeout, 40001 и 40P01 - конфликт сериализации и
+		// взаимная блокировка, 55P03 - блокировка не получена
+		switch pgErr.Code {
+		case "57014", "40001", "40P01", "55P03":
+			return true
+		}
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == 429
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"report_srv/internal/breaker"
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestBreakerPluginRejectsQueriesWhileDatabaseIsDown(t *testing.T) {
+	db := setupMigrationDB(t)
+	require.NoError(t, db.Use(NewBreakerPlugin("database", config.CircuitBreaker{
+		Enabled:          true,
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+	}, logging.Nop())))
+	require.NoError(t, db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)").Error)
+
+	// Обрыв соединения имитируется ошибкой перед выполнением запроса
+	down := false
+	require.NoError(t, db.Callback().Query().Before("gorm:query").Register("test:down", func(db *gorm.DB) {
+		if down {
+			db.AddError(driver.ErrBadConn)
+		}
+	}))
+
+	var count int64
+	require.NoError(t, db.Table("items").Count(&count).Error)
+
+	// Ошибки запросов не размыкают выключатель
+	var name string
+	for range 3 {
+		assert.Error(t, db.Raw("SELECT name FROM missing").Scan(&name).Error)
+	}
+
+	down = true
+	for range 2 {
+		assert.ErrorIs(t, db.Table("items").Count(&count).Error, driver.ErrBadConn)
+	}
+	down = false
+	err := db.Table("items").Count(&count).Error
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.ErrorIs(t, db.Exec("INSERT INTO items (name) VALUES ('first')").Error, breaker.ErrOpen)
+	assert.ErrorIs(t, Ping(context.Background(), db), breaker.ErrOpen)
+	assert.Equal(t, breaker.StateOpen, CircuitBreaker(db).State())
+
+	// После open_timeout проверка соединения замыкает выключатель
+	time.Sleep(25 * time.Millisecond)
+	require.NoError(t, Ping(context.Background(), db))
+	assert.Equal(t, breaker.StateClosed, CircuitBreaker(db).State())
+	require.NoError(t, db.Table("items").Count(&count).Error)
+}
+
+func TestIsConnectionError(t *testing.T) {
+	assert.True(t, IsConnectionError(driver.ErrBadConn))
+	assert.True(t, IsConnectionError(fmt.Errorf("query: %w", syscall.ECONNREFUSED)))
+	assert.True(t, IsConnectionError(&pgconn.PgError{Code: "57P01"}))
+	assert.True(t, IsConnectionError(&pgconn.PgError{Code: "08006"}))
+
+	assert.False(t, IsConnectionError(nil))
+	assert.False(t, IsConnectionError(gorm.ErrRecordNotFound))
+	assert.False(t, IsConnectionError(context.Canceled))
+	assert.False(t, IsConnectionError(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, IsConnectionError(&breaker.OpenError{Name: "database"}))
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, IsTransientError(fmt.Errorf("query: %w", syscall.ECONNRESET)))
+	assert.True(t, IsTransientError(&breaker.OpenError{Name: "database"}))
+	assert.True(t, IsTransientError(context.DeadlineExceeded))
+	assert.True(t, IsTransientError(&pgconn.PgError{Code: "57014"}))
+	assert.True(t, IsTransientError(&pgconn.PgError{Code: "40P01"}))
+	assert.True(t, IsTransientError(&StatusError{DataSource: "api", StatusCode: 503}))
+	assert.True(t, IsTransientError(&StatusError{DataSource: "api", StatusCode: 429}))
+
+	assert.False(t, IsTransientError(nil))
+	assert.False(t, IsTransientError(context.Canceled))
+	assert.False(t, IsTransientError(&pgconn.PgError{Code: "42P01"}))
+	assert.False(t, IsTransientError(&StatusError{DataSource: "api", StatusCode: 404}))
+	assert.False(t, IsTransientError(gorm.ErrRecordNotFound))
+}
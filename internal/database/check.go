@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"report_srv/internal/config"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CheckDSN разбирает DSN основной базы данных и источников данных без подключения,
+// чтобы ошибка в строке подключения находилась до развертывания
+func CheckDSN(ctx context.Context, cfg config.Config) error {
+	if err := parseDSN(cfg.DB.Driver, cfg.DB.DSN); err != nil {
+		return fmt.Errorf("database: %w", err)
+	}
+	if cfg.DB.ReplicaDSN != "" {
+		if err := parseDSN(cfg.DB.Driver, cfg.DB.ReplicaDSN); err != nil {
+			return fmt.Errorf("database.replica_dsn: %w", err)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.DataSources))
+	for name := range cfg.DataSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		source := cfg.DataSources[name]
+		if err := parseDSN(source.Driver, source.DSN); err != nil {
+			return fmt.Errorf("datasources.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseDSN разбирает DSN драйвером базы данных. DSN SQLite - путь к файлу, он не разбирается
+func parseDSN(driver, dsn string) error {
+	switch driver {
+	case "postgres":
+		if _, err := pgconn.ParseConfig(dsn); err != nil {
+			return fmt.Errorf("неверный DSN PostgreSQL: %w", err)
+		}
+	case "mysql":
+		if _, err := mysql.ParseDSN(dsn); err != nil {
+			return fmt.Errorf("неверный DSN MySQL: %w", err)
+		}
+	case clickhouseDriverName:
+		parsed, err := url.Parse(dsn)
+		if err != nil {
+			return fmt.Errorf("неверный DSN ClickHouse: %w", err)
+		}
+		if parsed.Scheme != "tcp" || parsed.Host == "" {
+			return fmt.Errorf("неверный DSN ClickHouse: ожидается tcp://host:port")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"report_srv/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDSN(t *testing.T) {
+	cfg := config.Config{
+		DB: config.DB{Driver: "postgres", DSN: "host=localhost user=reports dbname=reports sslmode=disable"},
+		DataSources: map[string]config.DataSource{
+			"dwh":   {Driver: "clickhouse", DSN: "tcp://localhost:9000?database=dwh"},
+			"crm":   {Driver: "mysql", DSN: "reader:secret@tcp(localhost:3306)/crm"},
+			"local": {Driver: "sqlite", DSN: "file::memory:"},
+		},
+	}
+	require.NoError(t, CheckDSN(context.Background(), cfg))
+
+	cfg.DataSources["dwh"] = config.DataSource{Driver: "clickhouse", DSN: "localhost:9000"}
+	err := CheckDSN(context.Background(), cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "datasources.dwh")
+
+	cfg.DB.DSN = "postgres://reports@localhost:port/reports"
+	err = CheckDSN(context.Background(), cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database")
+}
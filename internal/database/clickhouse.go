@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+
+	// Драйвер ClickHouse для database/sql
+	_ "github.com/ClickHouse/clickhouse-go"
+)
+
+// clickhouseDriverName имя драйвера ClickHouse в database/sql
+const clickhouseDriverName = "clickhouse"
+
+// ClickHouseDriverFactory фабрика для ClickHouse.
+// Подключение предназначено для запросов на чтение из аналитического хранилища:
+// модели сервиса и миграции в ClickHouse не размещаются.
+type ClickHouseDriverFactory struct{}
+
+func (f *ClickHouseDriverFactory) CreateDialector(dsn string) gorm.Dialector {
+	return &clickhouseDialector{dsn: dsn}
+}
+
+func (f *ClickHouseDriverFactory) SupportsDriver(driver string) bool {
+	return driver == "clickhouse"
+}
+
+// clickhouseDialector минимальный диалект GORM для выполнения запросов к ClickHouse.
+// DSN в формате драйвера: tcp://host:9000?database=dwh&username=reader&password=secret
+type clickhouseDialector struct {
+	dsn string
+}
+
+func (d *clickhouseDialector) Name() string {
+	return "clickhouse"
+}
+
+func (d *clickhouseDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+
+	conn, err := sql.Open(clickhouseDriverName, d.dsn)
+	if err != nil {
+		return err
+	}
+	db.ConnPool = conn
+	return nil
+}
+
+func (d *clickhouseDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator.Migrator{Config: migrator.Config{DB: db, Dialector: d}}
+}
+
+func (d *clickhouseDialector) DataTypeOf(field *schema.Field) string {
+	return string(field.DataType)
+}
+
+func (d *clickhouseDialector) DefaultValueOf(field *schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (d *clickhouseDialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v interface{}) {
+	writer.WriteByte('?')
+}
+
+func (d *clickhouseDialector) QuoteTo(writer clause.Writer, str string) {
+	writer.WriteByte('`')
+	writer.WriteString(strings.ReplaceAll(str, "`", "``"))
+	writer.WriteByte('`')
+}
+
+func (d *clickhouseDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `'`, vars...)
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestClickHouseDialectorBuildsQueries(t *testing.T) {
+	factory := &ClickHouseDriverFactory{}
+	assert.True(t, factory.SupportsDriver("clickhouse"))
+	assert.False(t, factory.SupportsDriver("postgres"))
+
+	// Соединение открывается лениво, сервер ClickHouse для построения запросов не нужен
+	db, err := gorm.Open(factory.CreateDialector("tcp://localhost:9000?database=dwh"), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	defer func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	}()
+
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var rows []map[string]interface{}
+		return tx.Raw("SELECT region, sum(amount) FROM sales WHERE region = @region AND year = @year GROUP BY region",
+			map[string]interface{}{"region": "north", "year": 2024}).Scan(&rows)
+	})
+	assert.Equal(t, "SELECT region, sum(amount) FROM sales WHERE region = 'north' AND year = 2024 GROUP BY region", sql)
+
+	stmt := db.Session(&gorm.Session{DryRun: true}).Table("sales").Where("region = ?", "north").Find(&[]map[string]interface{}{}).Statement
+	assert.Equal(t, "SELECT * FROM `sales` WHERE region = ?", stmt.SQL.String())
+}
@@ -6,9 +6,11 @@ import (
 	"time"
 
 	"report_srv/internal/config"
+	"report_srv/internal/logging"
 	"report_srv/internal/models"
+	"report_srv/internal/telemetry"
 
-	"github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -44,7 +46,7 @@ type ConnectionConfig struct {
 // DatabaseManager управляет подключением к базе данных
 type DatabaseManager struct {
 	db     *gorm.DB
-	logger *logrus.Logger
+	logger logging.Logger
 	config config.Config
 }
 
@@ -65,6 +67,17 @@ func (f *PostgresDriverFactory) SupportsDriver(driver string) bool {
 	return driver == "postgres"
 }
 
+// MySQLDriverFactory фабрика для MySQL
+type MySQLDriverFactory struct{}
+
+func (f *MySQLDriverFactory) CreateDialector(dsn string) gorm.Dialector {
+	return mysql.Open(dsn)
+}
+
+func (f *MySQLDriverFactory) SupportsDriver(driver string) bool {
+	return driver == "mysql"
+}
+
 // SQLiteDriverFactory фабрика для SQLite
 type SQLiteDriverFactory struct{}
 
@@ -83,17 +96,26 @@ type Migrator interface {
 
 // AutoMigrator выполняет автоматические миграции GORM
 type AutoMigrator struct {
-	logger *logrus.Logger
+	logger logging.Logger
 	models []interface{}
 }
 
 // NewAutoMigrator создает новый AutoMigrator
-func NewAutoMigrator(logger *logrus.Logger) *AutoMigrator {
+func NewAutoMigrator(logger logging.Logger) *AutoMigrator {
 	return &AutoMigrator{
 		logger: logger,
 		models: []interface{}{
 			&models.Report{},
-			// Здесь можно добавить другие модели
+			&models.Schedule{},
+			&models.ReportDefinition{},
+			&models.Quota{},
+			&models.APIKey{},
+			&models.ReportLink{},
+			&models.UploadedDataset{},
+			&models.ReportRendition{},
+			&models.Notification{},
+			&models.UserSettings{},
+			&models.DeadLetter{},
 		},
 	}
 }
@@ -115,14 +137,15 @@ func (m *AutoMigrator) Migrate(ctx context.Context, db *gorm.DB) error {
 // DatabaseBuilder строитель для конфигурации базы данных
 type DatabaseBuilder struct {
 	config           config.Config
-	logger           *logrus.Logger
+	logger           logging.Logger
 	connectionConfig ConnectionConfig
 	driverFactories  []DriverFactory
 	migrator         Migrator
+	breakerName      string
 }
 
 // NewDatabaseBuilder создает новый DatabaseBuilder
-func NewDatabaseBuilder(cfg config.Config, logger *logrus.Logger) *DatabaseBuilder {
+func NewDatabaseBuilder(cfg config.Config, logger logging.Logger) *DatabaseBuilder {
 	return &DatabaseBuilder{
 		config: cfg,
 		logger: logger,
@@ -133,9 +156,12 @@ func NewDatabaseBuilder(cfg config.Config, logger *logrus.Logger) *DatabaseBuild
 		},
 		driverFactories: []DriverFactory{
 			&PostgresDriverFactory{},
+			&MySQLDriverFactory{},
 			&SQLiteDriverFactory{},
+			&ClickHouseDriverFactory{},
 		},
-		migrator: NewAutoMigrator(logger),
+		migrator:    defaultMigrator(cfg.DB.Driver, logger),
+		breakerName: "database",
 	}
 }
 
@@ -151,6 +177,12 @@ func (b *DatabaseBuilder) WithMigrator(migrator Migrator) *DatabaseBuilder {
 	return b
 }
 
+// WithBreakerName задает имя зависимости в логах и ошибках выключателя
+func (b *DatabaseBuilder) WithBreakerName(name string) *DatabaseBuilder {
+	b.breakerName = name
+	return b
+}
+
 // WithDriverFactory добавляет фабрику драйверов
 func (b *DatabaseBuilder) WithDriverFactory(factory DriverFactory) *DatabaseBuilder {
 	b.driverFactories = append(b.driverFactories, factory)
@@ -171,6 +203,16 @@ func (b *DatabaseBuilder) Build(ctx context.Context) (Database, error) {
 		return nil, fmt.Errorf("ошибка подключения к базе данных: %w", err)
 	}
 
+	if err := db.Use(telemetry.NewGormPlugin()); err != nil {
+		return nil, fmt.Errorf("ошибка подключения трассировки: %w", err)
+	}
+
+	if b.config.DB.CircuitBreaker.Enabled {
+		if err := db.Use(NewBreakerPlugin(b.breakerName, b.config.DB.CircuitBreaker, b.logger)); err != nil {
+			return nil, fmt.Errorf("ошибка подключения выключателя: %w", err)
+		}
+	}
+
 	manager := &DatabaseManager{
 		db:     db,
 		logger: b.logger,
@@ -199,7 +241,7 @@ func (b *DatabaseBuilder) createGormConfig() *gorm.Config {
 	}
 
 	return &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+		Logger: newGormLogger(b.logger, logLevel),
 		NowFunc: func() time.Time {
 			return time.Now().UTC()
 		},
@@ -271,7 +313,7 @@ func (dm *DatabaseManager) configureConnectionPool(config ConnectionConfig) erro
 	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
 
-	dm.logger.WithFields(logrus.Fields{
+	dm.logger.WithFields(logging.Fields{
 		"max_idle_conns":    config.MaxIdleConns,
 		"max_open_conns":    config.MaxOpenConns,
 		"conn_max_lifetime": config.ConnMaxLifetime,
@@ -281,7 +323,7 @@ func (dm *DatabaseManager) configureConnectionPool(config ConnectionConfig) erro
 }
 
 // NewDatabase создает новое подключение к базе данных (обратная совместимость)
-func NewDatabase(cfg config.Config, log *logrus.Logger) (*gorm.DB, error) {
+func NewDatabase(cfg config.Config, log logging.Logger) (*gorm.DB, error) {
 	ctx := context.Background()
 
 	database, err := NewDatabaseBuilder(cfg, log).Build(ctx)
@@ -293,7 +335,7 @@ func NewDatabase(cfg config.Config, log *logrus.Logger) (*gorm.DB, error) {
 }
 
 // NewDatabaseWithMigrations создает подключение и выполняет миграции
-func NewDatabaseWithMigrations(cfg config.Config, log *logrus.Logger) (Database, error) {
+func NewDatabaseWithMigrations(cfg config.Config, log logging.Logger) (Database, error) {
 	ctx := context.Background()
 
 	database, err := NewDatabaseBuilder(cfg, log).Build(ctx)
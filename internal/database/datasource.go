@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownDataSource источник данных не объявлен в конфигурации
+var ErrUnknownDataSource = errors.New("неизвестный источник данных")
+
+// DataSourceManager выдает подключения к именованным источникам данных.
+// Основная база данных сервиса (или ее реплика для чтения) доступна под именем default и пустым именем,
+// остальные источники подключаются при первом обращении и переиспользуют пул соединений.
+type DataSourceManager struct {
+	config    config.Config
+	primary   *gorm.DB
+	factories []DriverFactory
+	logger    logging.Logger
+
+	mu          sync.Mutex
+	connections map[string]Database
+	clients     map[string]*http.Client
+}
+
+// NewDataSourceManager создает менеджер источников данных из конфигурации
+func NewDataSourceManager(cfg config.Config, primary *gorm.DB, logger logging.Logger) *DataSourceManager {
+	return &DataSourceManager{
+		config:      cfg,
+		primary:     primary,
+		logger:      logger,
+		connections: make(map[string]Database),
+		clients:     make(map[string]*http.Client),
+	}
+}
+
+// WithDriverFactory добавляет фабрику драйверов для источников данных
+func (m *DataSourceManager) WithDriverFactory(factory DriverFactory) *DataSourceManager {
+	m.factories = append(m.factories, factory)
+	return m
+}
+
+// Has проверяет, объявлен ли источник данных
+func (m *DataSourceManager) Has(name string) bool {
+	if name == "" || name == config.DefaultDataSource {
+		return true
+	}
+	_, exists := m.config.DataSources[name]
+	return exists
+}
+
+// Names возвращает имена всех источников данных, включая основной
+func (m *DataSourceManager) Names() []string {
+	names := []string{config.DefaultDataSource}
+	for name := range m.config.DataSources {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// DB возвращает подключение к источнику данных, открывая его при первом обращении
+func (m *DataSourceManager) DB(ctx context.Context, name string) (*gorm.DB, error) {
+	if name == "" || name == config.DefaultDataSource {
+		return m.primary, nil
+	}
+
+	source, exists := m.config.DataSources[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDataSource, name)
+	}
+	if source.IsHTTP() {
+		return nil, fmt.Errorf("%w: %s", ErrNotDatabase, name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if database, exists := m.connections[name]; exists {
+		return database.DB(), nil
+	}
+
+	database, err := m.open(ctx, name, source)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к источнику данных %s: %w", name, err)
+	}
+	m.connections[name] = database
+
+	return database.DB(), nil
+}
+
+// open подключается к источнику данных с настройками пула из конфигурации
+func (m *DataSourceManager) open(ctx context.Context, name string, source config.DataSource) (Database, error) {
+	cfg := m.config
+	cfg.DB = config.DB{Driver: source.Driver, DSN: source.DSN}
+
+	connectionConfig := ConnectionConfig{
+		MaxIdleConns:    defaultMaxIdleConns,
+		MaxOpenConns:    defaultMaxOpenConns,
+		ConnMaxLifetime: defaultConnMaxLifetime,
+	}
+	if source.MaxIdleConns > 0 {
+		connectionConfig.MaxIdleConns = source.MaxIdleConns
+	}
+	if source.MaxOpenConns > 0 {
+		connectionConfig.MaxOpenConns = source.MaxOpenConns
+	}
+	if source.ConnMaxLifetime > 0 {
+		connectionConfig.ConnMaxLifetime = source.ConnMaxLifetime
+	}
+
+	builder := NewDatabaseBuilder(cfg, m.logger).WithConnectionConfig(connectionConfig)
+	for _, factory := range m.factories {
+		builder.WithDriverFactory(factory)
+	}
+
+	logging.FromContext(ctx, m.logger).WithFields(logging.Fields{
+		"datasource": name,
+		"driver":     source.Driver,
+	}).Info("Подключение к источнику данных")
+
+	return builder.Build(ctx)
+}
+
+// Close закрывает подключения к дополнительным источникам данных и соединения
+// HTTP клиентов. Основная база данных не закрывается.
+func (m *DataSourceManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for name, database := range m.connections {
+		if err := database.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("источник данных %s: %w", name, err))
+		}
+		delete(m.connections, name)
+	}
+	for name, client := range m.clients {
+		client.CloseIdleConnections()
+		delete(m.clients, name)
+	}
+	return errors.Join(errs...)
+}
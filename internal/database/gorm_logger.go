@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"report_srv/internal/logging"
+
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+// defaultSlowQueryThreshold длительность запроса, после которой он логируется как медленный
+const defaultSlowQueryThreshold = 200 * time.Millisecond
+
+// gormLogger пишет логи GORM в логгер сервиса с полями корреляции из контекста запроса
+type gormLogger struct {
+	logger        logging.Logger
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+}
+
+// newGormLogger создает логгер GORM с уровнем level
+func newGormLogger(logger logging.Logger, level gormlogger.LogLevel) gormlogger.Interface {
+	return &gormLogger{logger: logger, level: level, slowThreshold: defaultSlowQueryThreshold}
+}
+
+// LogMode возвращает копию логгера с новым уровнем
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		logging.FromContext(ctx, l.logger).Info(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		logging.FromContext(ctx, l.logger).Warn(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		logging.FromContext(ctx, l.logger).Error(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace логирует выполненный SQL запрос: ошибки, медленные запросы и, на уровне Info, все запросы
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= gormlogger.Error:
+		l.queryLogger(ctx, elapsed, fc).WithError(err).Error("Ошибка SQL запроса")
+	case l.slowThreshold != 0 && elapsed > l.slowThreshold && l.level >= gormlogger.Warn:
+		l.queryLogger(ctx, elapsed, fc).WithField("threshold", l.slowThreshold.String()).Warn("Медленный SQL запрос")
+	case l.level >= gormlogger.Info:
+		l.queryLogger(ctx, elapsed, fc).Info("SQL запрос")
+	}
+}
+
+// queryLogger возвращает логгер с текстом запроса, числом строк и длительностью
+func (l *gormLogger) queryLogger(ctx context.Context, elapsed time.Duration, fc func() (string, int64)) logging.Logger {
+	sql, rows := fc()
+	return logging.FromContext(ctx, l.logger).WithFields(logging.Fields{
+		"sql":        sql,
+		"rows":       rows,
+		"elapsed_ms": float64(elapsed.Nanoseconds()) / 1e6,
+		"source":     utils.FileWithLineNum(),
+	})
+}
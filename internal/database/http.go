@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+)
+
+const (
+	// Ограничения запросов к источникам данных http по умолчанию
+	defaultHTTPTimeout         = 30 * time.Second
+	defaultHTTPMaxResponseSize = 10 << 20
+
+	// httpErrorBodySize сколько байт ответа с ошибкой попадает в текст ошибки
+	httpErrorBodySize = 512
+)
+
+var (
+	// ErrNotDatabase источник данных - JSON API, SQL запросы к нему не выполняются
+	ErrNotDatabase = errors.New("источник данных не является базой данных")
+	// ErrNotHTTP источник данных - база данных, HTTP запросы к нему не выполняются
+	ErrNotHTTP = errors.New("источник данных не является HTTP API")
+	// ErrResponseTooLarge ответ API больше max_response_size источника данных
+	ErrResponseTooLarge = errors.New("ответ API слишком большой")
+)
+
+// StatusError источник данных http ответил статусом не из диапазона 2xx
+type StatusError struct {
+	DataSource string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("источник данных %s ответил %d: %s", e.DataSource, e.StatusCode, e.Body)
+}
+
+// HTTPStatusCode возвращает статус ответа источника данных
+func (e *StatusError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
+// Request выполняет GET запрос к JSON API источника данных name. Путь path добавляется к url
+// источника, запрос передает заголовок auth_header. Тело ответа должно быть закрыто
+// вызывающей стороной; при чтении больше max_response_size байт возвращается ErrResponseTooLarge.
+func (m *DataSourceManager) Request(ctx context.Context, name, path string) (io.ReadCloser, error) {
+	source, exists := m.config.DataSources[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDataSource, name)
+	}
+	if !source.IsHTTP() {
+		return nil, fmt.Errorf("%w: %s", ErrNotHTTP, name)
+	}
+
+	target := strings.TrimSuffix(source.URL, "/")
+	if path != "" {
+		target += "/" + strings.TrimPrefix(path, "/")
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("источник данных %s: неверный адрес запроса: %w", name, err)
+	}
+	request.Header.Set("Accept", "application/json")
+	if source.AuthValue != "" {
+		header := source.AuthHeader
+		if header == "" {
+			header = "Authorization"
+		}
+		request.Header.Set(header, source.AuthValue)
+	}
+
+	logging.FromContext(ctx, m.logger).WithFields(logging.Fields{
+		"datasource": name,
+		"path":       request.URL.Path,
+	}).Debug("Запрос к источнику данных http")
+
+	response, err := m.httpClient(name, source).Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к источнику данных %s: %w", name, err)
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		defer response.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(response.Body, httpErrorBodySize))
+		return nil, &StatusError{DataSource: name, StatusCode: response.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	maxSize := source.MaxResponseSize
+	if maxSize <= 0 {
+		maxSize = defaultHTTPMaxResponseSize
+	}
+	return &limitedBody{ReadCloser: response.Body, remaining: maxSize}, nil
+}
+
+// httpClient возвращает HTTP клиент источника данных с его временем ожидания
+func (m *DataSourceManager) httpClient(name string, source config.DataSource) *http.Client {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if client, exists := m.clients[name]; exists {
+		return client
+	}
+	timeout := source.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	m.clients[name] = client
+	return client
+}
+
+// limitedBody возвращает ErrResponseTooLarge, если прочитано больше remaining байт
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrResponseTooLarge
+	}
+	return n, err
+}
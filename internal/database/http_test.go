@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataSourceManagerRequest(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/orders":
+			w.Write([]byte(`[{"id":1,"region":"` + r.URL.Query().Get("region") + `"}]`))
+		case "/api/large":
+			w.Write([]byte(strings.Repeat("x", 64)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	manager := NewDataSourceManager(config.Config{DataSources: map[string]config.DataSource{
+		"crm":     {Driver: config.DataSourceDriverHTTP, URL: api.URL + "/api/", AuthHeader: "X-Token", AuthValue: "secret", MaxResponseSize: 32},
+		"anon":    {Driver: config.DataSourceDriverHTTP, URL: api.URL},
+		"archive": {Driver: "sqlite", DSN: "file::memory:"},
+	}}, nil, logging.Nop())
+	defer manager.Close()
+	ctx := context.Background()
+
+	body, err := manager.Request(ctx, "crm", "/orders?region=north")
+	require.NoError(t, err)
+	content, err := io.ReadAll(body)
+	require.NoError(t, err)
+	body.Close()
+	assert.Equal(t, `[{"id":1,"region":"north"}]`, string(content))
+
+	body, err = manager.Request(ctx, "crm", "large")
+	require.NoError(t, err)
+	_, err = io.ReadAll(body)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+	body.Close()
+
+	_, err = manager.Request(ctx, "crm", "missing")
+	assert.ErrorContains(t, err, "404")
+	_, err = manager.Request(ctx, "anon", "api/orders")
+	assert.ErrorContains(t, err, "403")
+
+	_, err = manager.Request(ctx, "archive", "orders")
+	assert.ErrorIs(t, err, ErrNotHTTP)
+	_, err = manager.Request(ctx, "unknown", "orders")
+	assert.ErrorIs(t, err, ErrUnknownDataSource)
+	_, err = manager.DB(ctx, "crm")
+	assert.ErrorIs(t, err, ErrNotDatabase)
+	assert.True(t, manager.Has("crm"))
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"report_srv/internal/database/migrations"
+	"report_srv/internal/logging"
+
+	"github.com/golang-migrate/migrate/v4"
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	migratemysql "github.com/golang-migrate/migrate/v4/database/mysql"
+	migratepostgres "github.com/golang-migrate/migrate/v4/database/postgres"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"gorm.io/gorm"
+)
+
+// MigrationsTable таблица с версией схемы, совместимая с утилитой golang-migrate
+const MigrationsTable = "schema_migrations"
+
+// ErrDirtyMigration предыдущая миграция завершилась с ошибкой, схему нужно исправить
+// вручную и отметить версию командой force
+var ErrDirtyMigration = errors.New("схема БД в незавершенном состоянии после ошибки миграции")
+
+// MigrationVersion текущая версия схемы. Version 0 - миграции не применялись
+type MigrationVersion struct {
+	Version uint `json:"version"`
+	Dirty   bool `json:"dirty"`
+}
+
+// VersionedMigrator применяет версионированные SQL миграции и хранит
+// примененную версию в таблице schema_migrations
+type VersionedMigrator struct {
+	source fs.FS
+	logger logging.Logger
+}
+
+// NewVersionedMigrator создает мигратор с файлами миграций из source
+func NewVersionedMigrator(source fs.FS, logger logging.Logger) *VersionedMigrator {
+	return &VersionedMigrator{source: source, logger: logger}
+}
+
+// Migrate применяет все новые миграции
+func (m *VersionedMigrator) Migrate(ctx context.Context, db *gorm.DB) error {
+	m.logger.Info("Запуск миграций базы данных")
+	if err := m.Up(ctx, db); err != nil {
+		return err
+	}
+
+	version, err := m.Version(ctx, db)
+	if err != nil {
+		return err
+	}
+	m.logger.WithField("version", version.Version).Info("Миграции базы данных выполнены успешно")
+	return nil
+}
+
+// Up применяет все миграции новее текущей версии
+func (m *VersionedMigrator) Up(ctx context.Context, db *gorm.DB) error {
+	return m.run(ctx, db, (*migrate.Migrate).Up)
+}
+
+// Down откатывает все примененные миграции
+func (m *VersionedMigrator) Down(ctx context.Context, db *gorm.DB) error {
+	return m.run(ctx, db, (*migrate.Migrate).Down)
+}
+
+// Steps применяет n следующих миграций, при отрицательном n откатывает -n последних
+func (m *VersionedMigrator) Steps(ctx context.Context, db *gorm.DB, n int) error {
+	return m.run(ctx, db, func(instance *migrate.Migrate) error {
+		return instance.Steps(n)
+	})
+}
+
+// Goto применяет или откатывает миграции до версии version
+func (m *VersionedMigrator) Goto(ctx context.Context, db *gorm.DB, version uint) error {
+	return m.run(ctx, db, func(instance *migrate.Migrate) error {
+		return instance.Migrate(version)
+	})
+}
+
+// Force записывает версию схемы без выполнения миграций и снимает признак ошибки.
+// Версия -1 означает, что миграции не применялись.
+func (m *VersionedMigrator) Force(ctx context.Context, db *gorm.DB, version int) error {
+	return m.run(ctx, db, func(instance *migrate.Migrate) error {
+		return instance.Force(version)
+	})
+}
+
+// Version возвращает текущую версию схемы
+func (m *VersionedMigrator) Version(ctx context.Context, db *gorm.DB) (MigrationVersion, error) {
+	var current MigrationVersion
+	err := m.run(ctx, db, func(instance *migrate.Migrate) error {
+		version, dirty, err := instance.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+		current = MigrationVersion{Version: version, Dirty: dirty}
+		return err
+	})
+	return current, err
+}
+
+// run выполняет действие с миграциями на отдельном соединении пула db.
+// Отмена ctx останавливает выполнение после текущей миграции.
+func (m *VersionedMigrator) run(ctx context.Context, db *gorm.DB, action func(*migrate.Migrate) error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("ошибка получения SQL DB: %w", err)
+	}
+
+	source, err := iofs.New(m.source, ".")
+	if err != nil {
+		return fmt.Errorf("ошибка чтения файлов миграций: %w", err)
+	}
+
+	driverName := db.Dialector.Name()
+	driver, release, err := migrationDriver(ctx, driverName, sqlDB)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	instance, err := migrate.NewWithInstance("iofs", source, driverName, driver)
+	if err != nil {
+		return fmt.Errorf("ошибка инициализации миграций: %w", err)
+	}
+	instance.Log = migrateLogger{logger: m.logger}
+
+	stop := context.AfterFunc(ctx, func() { instance.GracefulStop <- true })
+	defer stop()
+
+	err = action(instance)
+	var dirty migrate.ErrDirty
+	switch {
+	case err == nil, errors.Is(err, migrate.ErrNoChange):
+		return ctx.Err()
+	case errors.As(err, &dirty):
+		return fmt.Errorf("%w: версия %d", ErrDirtyMigration, dirty.Version)
+	default:
+		return fmt.Errorf("ошибка миграции: %w", err)
+	}
+}
+
+// migrationDriver создает драйвер миграций для БД. Для PostgreSQL и MySQL драйвер
+// работает на выделенном соединении, release возвращает его в пул без закрытия пула.
+func migrationDriver(ctx context.Context, driverName string, sqlDB *sql.DB) (migratedb.Driver, func(), error) {
+	switch driverName {
+	case "postgres", "mysql":
+		conn, err := sqlDB.Conn(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка получения соединения для миграций: %w", err)
+		}
+		release := func() { conn.Close() }
+
+		var driver migratedb.Driver
+		if driverName == "postgres" {
+			driver, err = migratepostgres.WithConnection(ctx, conn, &migratepostgres.Config{MigrationsTable: MigrationsTable})
+		} else {
+			driver, err = migratemysql.WithConnection(ctx, conn, &migratemysql.Config{MigrationsTable: MigrationsTable})
+		}
+		if err != nil {
+			release()
+			return nil, nil, fmt.Errorf("ошибка инициализации драйвера миграций: %w", err)
+		}
+		return driver, release, nil
+	case "sqlite":
+		driver, err := migratesqlite.WithInstance(sqlDB, &migratesqlite.Config{MigrationsTable: MigrationsTable})
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка инициализации драйвера миграций: %w", err)
+		}
+		return driver, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("версионированные миграции не поддерживаются для драйвера %s", driverName)
+	}
+}
+
+// defaultMigrator выбирает мигратор для основной БД: встроенные SQL миграции
+// написаны для PostgreSQL, для остальных драйверов используется AutoMigrate
+func defaultMigrator(driver string, logger logging.Logger) Migrator {
+	if driver == "postgres" {
+		return NewVersionedMigrator(migrations.FS, logger)
+	}
+	return NewAutoMigrator(logger)
+}
+
+// migrateLogger передает сообщения golang-migrate в логгер сервиса
+type migrateLogger struct {
+	logger logging.Logger
+}
+
+func (l migrateLogger) Printf(format string, args ...interface{}) {
+	l.logger.Info(strings.TrimSpace(fmt.Sprintf(format, args...)))
+}
+
+func (l migrateLogger) Verbose() bool {
+	return false
+}
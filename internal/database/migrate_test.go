@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"000001_create_items.up.sql":    {Data: []byte("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL);")},
+		"000001_create_items.down.sql":  {Data: []byte("DROP TABLE items;")},
+		"000002_seed_items.up.sql":      {Data: []byte("INSERT INTO items (name) VALUES ('first'), ('second');")},
+		"000002_seed_items.down.sql":    {Data: []byte("DELETE FROM items;")},
+		"000003_add_item_code.up.sql":   {Data: []byte("ALTER TABLE items ADD COLUMN code TEXT;")},
+		"000003_add_item_code.down.sql": {Data: []byte("ALTER TABLE items DROP COLUMN code;")},
+	}
+}
+
+func setupMigrationDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "migrations.db")), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+	return db
+}
+
+func TestVersionedMigratorUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := setupMigrationDB(t)
+	migrator := NewVersionedMigrator(testMigrations(), logging.Nop())
+
+	version, err := migrator.Version(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, MigrationVersion{}, version)
+
+	require.NoError(t, migrator.Migrate(ctx, db))
+	version, err = migrator.Version(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, MigrationVersion{Version: 3}, version)
+
+	// Миграция данных выполнена вместе со схемой
+	var count int64
+	require.NoError(t, db.Table("items").Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	// Повторный запуск без новых миграций не меняет схему
+	require.NoError(t, migrator.Up(ctx, db))
+
+	require.NoError(t, migrator.Steps(ctx, db, -2))
+	version, err = migrator.Version(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, MigrationVersion{Version: 1}, version)
+	require.NoError(t, db.Table("items").Count(&count).Error)
+	assert.Zero(t, count)
+
+	require.NoError(t, migrator.Goto(ctx, db, 2))
+	require.NoError(t, migrator.Down(ctx, db))
+	assert.False(t, db.Migrator().HasTable("items"))
+	assert.True(t, db.Migrator().HasTable(MigrationsTable))
+}
+
+func TestVersionedMigratorDirtyVersion(t *testing.T) {
+	ctx := context.Background()
+	db := setupMigrationDB(t)
+
+	source := testMigrations()
+	source["000002_seed_items.up.sql"] = &fstest.MapFile{Data: []byte("INSERT INTO missing (name) VALUES ('first');")}
+	migrator := NewVersionedMigrator(source, logging.Nop())
+
+	require.Error(t, migrator.Up(ctx, db))
+	version, err := migrator.Version(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, MigrationVersion{Version: 2, Dirty: true}, version)
+
+	// До исправления схемы и force новые миграции не применяются
+	assert.ErrorIs(t, migrator.Up(ctx, db), ErrDirtyMigration)
+
+	require.NoError(t, migrator.Force(ctx, db, 1))
+	require.NoError(t, NewVersionedMigrator(testMigrations(), logging.Nop()).Up(ctx, db))
+	version, err = migrator.Version(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, MigrationVersion{Version: 3}, version)
+}
+
+func TestEmbeddedMigrationsArePaired(t *testing.T) {
+	migrator := defaultMigrator("postgres", logging.Nop())
+	versioned, ok := migrator.(*VersionedMigrator)
+	require.True(t, ok)
+
+	ups, err := fs.Glob(versioned.source, "*.up.sql")
+	require.NoError(t, err)
+	require.NotEmpty(t, ups)
+	for _, up := range ups {
+		down := strings.TrimSuffix(up, ".up.sql") + ".down.sql"
+		_, err := fs.Stat(versioned.source, down)
+		assert.NoError(t, err, "нет файла отката для %s", up)
+	}
+
+	assert.IsType(t, &AutoMigrator{}, defaultMigrator("sqlite", logging.Nop()))
+}
@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN format VARCHAR(20) NOT NULL DEFAULT 'xlsx';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_reports_schedule_id;
+ALTER TABLE reports DROP COLUMN IF EXISTS schedule_id;
+
+DROP TABLE IF EXISTS schedules;
@@ -0,0 +1,24 @@
+CREATE TABLE schedules (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    name VARCHAR(255) NOT NULL,
+    cron_expr VARCHAR(255) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    report_title VARCHAR(255) NOT NULL,
+    report_description VARCHAR(1000),
+    format VARCHAR(20) NOT NULL DEFAULT 'xlsx',
+    parameters JSONB,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_report_id INTEGER,
+    created_by VARCHAR(255) NOT NULL,
+    updated_by VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX idx_schedules_next_run_at ON schedules(next_run_at);
+CREATE INDEX idx_schedules_deleted_at ON schedules(deleted_at);
+
+ALTER TABLE reports ADD COLUMN schedule_id INTEGER;
+CREATE INDEX idx_reports_schedule_id ON reports(schedule_id);
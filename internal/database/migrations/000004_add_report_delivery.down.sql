@@ -0,0 +1,3 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS delivered_at;
+ALTER TABLE reports DROP COLUMN IF EXISTS delivery_error;
+ALTER TABLE reports DROP COLUMN IF EXISTS delivery_status;
@@ -0,0 +1,3 @@
+ALTER TABLE reports ADD COLUMN delivery_status VARCHAR(20);
+ALTER TABLE reports ADD COLUMN delivery_error VARCHAR(1000);
+ALTER TABLE reports ADD COLUMN delivered_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reports_expires_at;
+ALTER TABLE reports DROP COLUMN IF EXISTS expires_at;
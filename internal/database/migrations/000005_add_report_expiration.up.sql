@@ -0,0 +1,2 @@
+ALTER TABLE reports ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX idx_reports_expires_at ON reports(expires_at);
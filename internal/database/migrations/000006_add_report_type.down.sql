@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reports_type;
+ALTER TABLE reports DROP COLUMN IF EXISTS type;
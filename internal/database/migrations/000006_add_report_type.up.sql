@@ -0,0 +1,2 @@
+ALTER TABLE reports ADD COLUMN type VARCHAR(100);
+CREATE INDEX idx_reports_type ON reports(type);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_reports_definition_id;
+ALTER TABLE reports DROP COLUMN IF EXISTS definition_id;
+
+DROP TABLE IF EXISTS report_definitions;
@@ -0,0 +1,20 @@
+CREATE TABLE report_definitions (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(1000),
+    queries JSONB NOT NULL,
+    template_key VARCHAR(255),
+    parameter_schema JSONB,
+    format VARCHAR(20) NOT NULL DEFAULT 'xlsx',
+    created_by VARCHAR(255) NOT NULL,
+    updated_by VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_report_definitions_name ON report_definitions(name) WHERE deleted_at IS NULL;
+CREATE INDEX idx_report_definitions_deleted_at ON report_definitions(deleted_at);
+
+ALTER TABLE reports ADD COLUMN definition_id INTEGER;
+CREATE INDEX idx_reports_definition_id ON reports(definition_id);
@@ -0,0 +1 @@
+CREATE INDEX idx_reports_search ON reports USING GIN (to_tsvector('russian', coalesce(title, '') || ' ' || coalesce(description, '')));
@@ -0,0 +1,2 @@
+ALTER TABLE reports ADD COLUMN error_code VARCHAR(50);
+ALTER TABLE reports ADD COLUMN error_message VARCHAR(1000);
@@ -0,0 +1,2 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS rows_processed;
+ALTER TABLE reports DROP COLUMN IF EXISTS progress;
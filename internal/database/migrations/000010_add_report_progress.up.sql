@@ -0,0 +1,2 @@
+ALTER TABLE reports ADD COLUMN progress INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reports ADD COLUMN rows_processed BIGINT NOT NULL DEFAULT 0;
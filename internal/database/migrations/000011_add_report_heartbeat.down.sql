@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_reports_processing;
+ALTER TABLE reports DROP COLUMN IF EXISTS recoveries;
+ALTER TABLE reports DROP COLUMN IF EXISTS heartbeat_at;
@@ -0,0 +1,3 @@
+ALTER TABLE reports ADD COLUMN heartbeat_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE reports ADD COLUMN recoveries INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_reports_processing ON reports(heartbeat_at) WHERE status = 'processing';
@@ -0,0 +1 @@
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS excel_layout;
@@ -0,0 +1 @@
+ALTER TABLE report_definitions ADD COLUMN excel_layout JSONB;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_reports_created_by;
+ALTER TABLE reports DROP COLUMN IF EXISTS file_size;
+DROP TABLE IF EXISTS quotas;
@@ -0,0 +1,15 @@
+CREATE TABLE quotas (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    subject VARCHAR(255) NOT NULL,
+    max_concurrent INTEGER,
+    max_reports_per_day INTEGER,
+    max_stored_bytes BIGINT,
+    updated_by VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_quotas_subject ON quotas(subject);
+
+ALTER TABLE reports ADD COLUMN file_size BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX idx_reports_created_by ON reports(created_by, created_at);
@@ -0,0 +1,16 @@
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    scopes JSONB,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_by VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_api_keys_hash ON api_keys(hash);
+CREATE INDEX idx_api_keys_deleted_at ON api_keys(deleted_at);
@@ -0,0 +1,18 @@
+CREATE TABLE report_links (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    report_id INTEGER NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    max_downloads INTEGER,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    last_downloaded_at TIMESTAMP WITH TIME ZONE,
+    created_by VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_report_links_token_hash ON report_links(token_hash);
+CREATE INDEX idx_report_links_report_id ON report_links(report_id);
+CREATE INDEX idx_report_links_deleted_at ON report_links(deleted_at);
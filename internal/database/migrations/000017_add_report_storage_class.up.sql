@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN storage_class VARCHAR(32);
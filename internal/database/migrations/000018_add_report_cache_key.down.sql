@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_reports_cache_key;
+ALTER TABLE reports DROP COLUMN IF EXISTS cached_from_id;
+ALTER TABLE reports DROP COLUMN IF EXISTS cache_key;
@@ -0,0 +1,3 @@
+ALTER TABLE reports ADD COLUMN cache_key VARCHAR(64);
+ALTER TABLE reports ADD COLUMN cached_from_id INTEGER;
+CREATE INDEX idx_reports_cache_key ON reports(cache_key);
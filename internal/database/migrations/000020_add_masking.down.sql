@@ -0,0 +1,2 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS unmasked;
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS masking;
@@ -0,0 +1,2 @@
+ALTER TABLE report_definitions ADD COLUMN masking JSONB;
+ALTER TABLE reports ADD COLUMN unmasked BOOLEAN NOT NULL DEFAULT FALSE;
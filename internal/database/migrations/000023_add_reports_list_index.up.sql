@@ -0,0 +1,4 @@
+-- Список отчетов без фильтров: GORM добавляет deleted_at IS NULL к каждому запросу,
+-- поэтому индекс частичный. CONCURRENTLY не блокирует запись, но не выполняется в
+-- транзакции, поэтому каждый такой индекс создается отдельной миграцией.
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_reports_list ON reports(created_at DESC, id DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1 @@
+DROP INDEX CONCURRENTLY IF EXISTS idx_reports_status_list;
@@ -0,0 +1,2 @@
+-- Список отчетов с фильтром по статусу в порядке создания
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_reports_status_list ON reports(status, created_at DESC, id DESC) WHERE deleted_at IS NULL;
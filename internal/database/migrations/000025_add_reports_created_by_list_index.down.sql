@@ -0,0 +1 @@
+DROP INDEX CONCURRENTLY IF EXISTS idx_reports_created_by_list;
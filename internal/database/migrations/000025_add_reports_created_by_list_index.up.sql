@@ -0,0 +1,3 @@
+-- Список отчетов пользователя в порядке создания. idx_reports_created_by по всем строкам
+-- остается для квоты, которая считает и удаленные отчеты
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_reports_created_by_list ON reports(created_by, created_at DESC, id DESC) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+-- Удаленные отчеты составляют малую часть таблицы: частичный индекс вместо индекса по всем строкам
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_reports_deleted ON reports(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Индексы заменены частичными индексами списка отчетов
+DROP INDEX IF EXISTS idx_reports_status;
+DROP INDEX IF EXISTS idx_reports_created_at;
+DROP INDEX IF EXISTS idx_reports_deleted_at;
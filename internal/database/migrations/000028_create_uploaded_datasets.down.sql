@@ -0,0 +1 @@
+DROP TABLE IF EXISTS uploaded_datasets;
@@ -0,0 +1,14 @@
+CREATE TABLE uploaded_datasets (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    filename VARCHAR(255) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum VARCHAR(64),
+    columns JSONB,
+    row_count BIGINT NOT NULL DEFAULT 0,
+    file_key VARCHAR(512) NOT NULL,
+    created_by VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX idx_uploaded_datasets_created_by ON uploaded_datasets(created_by);
@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN snapshot_key VARCHAR(255);
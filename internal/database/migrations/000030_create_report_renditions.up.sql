@@ -0,0 +1,12 @@
+CREATE TABLE report_renditions (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    report_id INTEGER NOT NULL,
+    format VARCHAR(20) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum VARCHAR(64),
+    file_key VARCHAR(512) NOT NULL,
+    created_by VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_report_renditions_format ON report_renditions(report_id, format);
@@ -0,0 +1,2 @@
+ALTER TABLE schedules DROP COLUMN IF EXISTS report_type;
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS iterator;
@@ -0,0 +1,2 @@
+ALTER TABLE report_definitions ADD COLUMN iterator JSONB;
+ALTER TABLE schedules ADD COLUMN report_type VARCHAR(100);
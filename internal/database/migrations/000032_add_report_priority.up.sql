@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN priority VARCHAR(20) NOT NULL DEFAULT 'normal';
@@ -0,0 +1,2 @@
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS dedupe_window;
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS max_concurrent_runs;
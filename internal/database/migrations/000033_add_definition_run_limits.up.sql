@@ -0,0 +1,2 @@
+ALTER TABLE report_definitions ADD COLUMN max_concurrent_runs INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE report_definitions ADD COLUMN dedupe_window VARCHAR(50);
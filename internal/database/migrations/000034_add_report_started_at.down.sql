@@ -0,0 +1 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS started_at;
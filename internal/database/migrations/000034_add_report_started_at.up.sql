@@ -0,0 +1 @@
+ALTER TABLE reports ADD COLUMN started_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_reports_sla_breach;
+
+ALTER TABLE reports DROP COLUMN IF EXISTS sla_breached_at;
+ALTER TABLE reports DROP COLUMN IF EXISTS sla_breach;
+
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS sla;
@@ -0,0 +1,6 @@
+ALTER TABLE report_definitions ADD COLUMN sla JSONB;
+
+ALTER TABLE reports ADD COLUMN sla_breach VARCHAR(20);
+ALTER TABLE reports ADD COLUMN sla_breached_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_reports_sla_breach ON reports(sla_breached_at) WHERE sla_breached_at IS NOT NULL AND status IN ('pending', 'processing');
@@ -0,0 +1,13 @@
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    recipient VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    report_id INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    message VARCHAR(1000),
+    read_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_notifications_recipient ON notifications(recipient, created_at DESC);
+CREATE INDEX idx_notifications_unread ON notifications(recipient) WHERE read_at IS NULL;
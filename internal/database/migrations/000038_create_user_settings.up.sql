@@ -0,0 +1,11 @@
+CREATE TABLE user_settings (
+    subject VARCHAR(255) PRIMARY KEY,
+    default_format VARCHAR(20),
+    locale VARCHAR(35),
+    timezone VARCHAR(64),
+    notify_completed BOOLEAN NOT NULL DEFAULT TRUE,
+    notify_failed BOOLEAN NOT NULL DEFAULT TRUE,
+    page_size INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
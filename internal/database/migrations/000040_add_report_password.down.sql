@@ -0,0 +1,3 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS file_password;
+ALTER TABLE reports DROP COLUMN IF EXISTS password_generated;
+ALTER TABLE reports DROP COLUMN IF EXISTS password_protected;
@@ -0,0 +1,3 @@
+ALTER TABLE reports ADD COLUMN password_protected BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE reports ADD COLUMN password_generated BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE reports ADD COLUMN file_password VARCHAR(128);
@@ -0,0 +1,3 @@
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS schedules_paused_by;
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS schedules_paused_at;
+ALTER TABLE report_definitions DROP COLUMN IF EXISTS schedules_paused;
@@ -0,0 +1,3 @@
+ALTER TABLE report_definitions ADD COLUMN schedules_paused BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE report_definitions ADD COLUMN schedules_paused_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE report_definitions ADD COLUMN schedules_paused_by VARCHAR(255);
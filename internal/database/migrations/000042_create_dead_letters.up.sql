@@ -0,0 +1,17 @@
+CREATE TABLE dead_letters (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    report_id INTEGER NOT NULL,
+    task_id VARCHAR(100) NOT NULL,
+    task_type VARCHAR(50) NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL,
+    error_code VARCHAR(50),
+    error_message TEXT,
+    request_id VARCHAR(100),
+    requeued_at TIMESTAMP WITH TIME ZONE,
+    requeued_by VARCHAR(255)
+);
+
+CREATE INDEX idx_dead_letters_report_id ON dead_letters(report_id);
+CREATE INDEX idx_dead_letters_open ON dead_letters(created_at DESC) WHERE requeued_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE reports DROP COLUMN IF EXISTS max_attempts;
+ALTER TABLE reports DROP COLUMN IF EXISTS attempts;
@@ -0,0 +1,2 @@
+ALTER TABLE reports ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE reports ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+-- Удаленные пароли файлов не восстанавливаются
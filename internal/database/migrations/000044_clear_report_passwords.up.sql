@@ -0,0 +1 @@
+UPDATE reports SET file_password = NULL WHERE status NOT IN ('pending', 'processing');
@@ -0,0 +1,11 @@
+// Package migrations содержит версионированные SQL миграции схемы БД сервиса для PostgreSQL.
+// Файлы именуются <version>_<name>.up.sql и <version>_<name>.down.sql и применяются по
+// возрастанию версии; миграции данных (UPDATE, INSERT) оформляются такими же файлами.
+package migrations
+
+import "embed"
+
+// FS файлы миграций, встроенные в бинарный файл
+//
+//go:embed *.sql
+var FS embed.FS
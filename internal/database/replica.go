@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"gorm.io/gorm"
+)
+
+// ReadReplica подключение для запросов только на чтение. Если реплика не настроена,
+// запросы выполняются в основной базе данных.
+type ReadReplica struct {
+	db       *gorm.DB
+	database Database
+}
+
+// NewReadReplica подключается к реплике из database.replica_dsn. Реплика использует драйвер
+// основной базы данных, миграции на ней не выполняются.
+func NewReadReplica(cfg config.Config, primary *gorm.DB, logger logging.Logger) (*ReadReplica, error) {
+	if cfg.DB.ReplicaDSN == "" {
+		return &ReadReplica{db: primary}, nil
+	}
+
+	replicaConfig := cfg
+	replicaConfig.DB.DSN = cfg.DB.ReplicaDSN
+
+	database, err := NewDatabaseBuilder(replicaConfig, logger).WithBreakerName("database_replica").Build(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к реплике: %w", err)
+	}
+
+	logger.WithField("driver", cfg.DB.Driver).Info("Запросы на чтение выполняются на реплике базы данных")
+	return &ReadReplica{db: database.DB(), database: database}, nil
+}
+
+// DB возвращает подключение к реплике или к основной базе данных
+func (r *ReadReplica) DB() *gorm.DB {
+	return r.db
+}
+
+// Close закрывает подключение к реплике. Основная база данных не закрывается.
+func (r *ReadReplica) Close() error {
+	if r.database == nil {
+		return nil
+	}
+	return r.database.Close()
+}
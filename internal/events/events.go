@@ -0,0 +1,278 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// EventType тип события жизненного цикла отчета
+type EventType string
+
+const (
+	// ReportCreated отчет создан и поставлен в очередь на генерацию
+	ReportCreated EventType = "report.created"
+	// ReportStarted началась генерация отчета
+	ReportStarted EventType = "report.started"
+	// ReportCompleted отчет успешно сгенерирован
+	ReportCompleted EventType = "report.completed"
+	// ReportFailed генерация отчета завершилась ошибкой
+	ReportFailed EventType = "report.failed"
+	// ReportCanceled генерация отчета отменена
+	ReportCanceled EventType = "report.canceled"
+	// ReportDeleted отчет удален
+	ReportDeleted EventType = "report.deleted"
+	// ReportExpired срок хранения отчета истек, файл удален
+	ReportExpired EventType = "report.expired"
+	// ReportSLABreached отчет ждет в очереди или генерируется дольше срока SLA определения
+	ReportSLABreached EventType = "report.sla_breached"
+)
+
+// String возвращает строковое представление типа события
+func (t EventType) String() string {
+	return string(t)
+}
+
+// TypeForStatus возвращает тип события перехода отчета в статус
+func TypeForStatus(status models.ReportStatus) (EventType, bool) {
+	switch status {
+	case models.StatusProcessing:
+		return ReportStarted, true
+	case models.StatusCompleted:
+		return ReportCompleted, true
+	case models.StatusFailed:
+		return ReportFailed, true
+	case models.StatusCanceled:
+		return ReportCanceled, true
+	case models.StatusExpired:
+		return ReportExpired, true
+	default:
+		return "", false
+	}
+}
+
+// Event событие жизненного цикла отчета
+type Event struct {
+	ID        string                 `json:"id,omitempty"`
+	Type      EventType              `json:"type"`
+	ReportID  uint                   `json:"report_id"`
+	Status    models.ReportStatus    `json:"status,omitempty"`
+	FileKey   string                 `json:"file_key,omitempty"`
+	ErrorCode models.ReportErrorCode `json:"error_code,omitempty"`
+	SLABreach models.SLABreach       `json:"sla_breach,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// NewEvent создает событие отчета с уникальным ID и текущим временем
+func NewEvent(eventType EventType, reportID uint, status models.ReportStatus) Event {
+	return Event{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		ReportID:  reportID,
+		Status:    status,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// WithFileKey добавляет к событию ключ файла отчета
+func (e Event) WithFileKey(fileKey string) Event {
+	e.FileKey = fileKey
+	return e
+}
+
+// WithErrorCode добавляет к событию причину ошибки генерации
+func (e Event) WithErrorCode(code models.ReportErrorCode) Event {
+	e.ErrorCode = code
+	return e
+}
+
+// WithSLABreach добавляет к событию вид нарушения SLA
+func (e Event) WithSLABreach(breach models.SLABreach) Event {
+	e.SLABreach = breach
+	return e
+}
+
+// Publisher публикует события отчетов
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Handler обработчик события. Вызывается синхронно в горутине публикующего,
+// поэтому долгие операции обработчик должен выполнять в своей горутине.
+type Handler func(ctx context.Context, event Event)
+
+// Subscriber позволяет подписываться на события отчетов
+type Subscriber interface {
+	// Subscribe регистрирует обработчик событий указанных типов (всех, если типы
+	// не заданы) и возвращает функцию отписки
+	Subscribe(handler Handler, types ...EventType) (unsubscribe func())
+}
+
+// Bus шина событий: публикация и подписка
+type Bus interface {
+	Publisher
+	Subscriber
+}
+
+// subscription подписка на шине событий
+type subscription struct {
+	handler Handler
+	types   map[EventType]bool
+}
+
+// matches проверяет, интересует ли подписку событие
+func (s subscription) matches(eventType EventType) bool {
+	return len(s.types) == 0 || s.types[eventType]
+}
+
+// InProcessBus шина событий внутри процесса
+type InProcessBus struct {
+	mu            sync.RWMutex
+	subscriptions map[uint64]subscription
+	nextID        uint64
+	logger        logging.Logger
+}
+
+// NewInProcessBus создает шину событий внутри процесса
+func NewInProcessBus(logger logging.Logger) *InProcessBus {
+	return &InProcessBus{
+		subscriptions: make(map[uint64]subscription),
+		logger:        logger,
+	}
+}
+
+// Subscribe регистрирует обработчик событий
+func (b *InProcessBus) Subscribe(handler Handler, types ...EventType) func() {
+	filter := make(map[EventType]bool, len(types))
+	for _, eventType := range types {
+		filter[eventType] = true
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscriptions[id] = subscription{handler: handler, types: filter}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscriptions, id)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish передает событие всем подходящим обработчикам.
+// Паника в обработчике не прерывает доставку остальным.
+func (b *InProcessBus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.subscriptions))
+	for _, sub := range b.subscriptions {
+		if sub.matches(event.Type) {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		b.dispatch(ctx, handler, event)
+	}
+	return nil
+}
+
+// dispatch вызывает обработчик, перехватывая панику
+func (b *InProcessBus) dispatch(ctx context.Context, handler Handler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.WithFields(logging.Fields{
+				"event_type": event.Type,
+				"report_id":  event.ReportID,
+				"panic":      fmt.Sprint(r),
+			}).Error("Паника в обработчике события")
+		}
+	}()
+
+	handler(ctx, event)
+}
+
+// CompositeBus шина событий, которая кроме локальных подписчиков
+// передает события во внешние публикаторы
+type CompositeBus struct {
+	local      Bus
+	publishers []Publisher
+}
+
+// NewCompositeBus создает шину с внешними публикаторами
+func NewCompositeBus(local Bus, publishers ...Publisher) *CompositeBus {
+	return &CompositeBus{
+		local:      local,
+		publishers: publishers,
+	}
+}
+
+// Subscribe регистрирует обработчик на локальной шине
+func (b *CompositeBus) Subscribe(handler Handler, types ...EventType) func() {
+	return b.local.Subscribe(handler, types...)
+}
+
+// Publish передает событие локальным подписчикам и внешним публикаторам
+func (b *CompositeBus) Publish(ctx context.Context, event Event) error {
+	errs := []error{b.local.Publish(ctx, event)}
+	for _, publisher := range b.publishers {
+		errs = append(errs, publisher.Publish(ctx, event))
+	}
+	return errors.Join(errs...)
+}
+
+// Start запускает внешние публикаторы
+func (b *CompositeBus) Start(ctx context.Context) error {
+	for _, publisher := range b.publishers {
+		if managed, ok := publisher.(ManagedPublisher); ok {
+			if err := managed.Start(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stop останавливает внешние публикаторы
+func (b *CompositeBus) Stop(ctx context.Context) error {
+	var errs []error
+	for _, publisher := range b.publishers {
+		if managed, ok := publisher.(ManagedPublisher); ok {
+			errs = append(errs, managed.Stop(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewBusFromConfig создает шину событий на основе конфигурации.
+// Если включена публикация в Kafka, события дополнительно отправляются в топик.
+func NewBusFromConfig(cfg config.Config, logger logging.Logger) Bus {
+	bus := NewInProcessBus(logger)
+	if !cfg.Kafka.Enabled {
+		return bus
+	}
+
+	client := NewKafkaClient(cfg.Kafka, logger)
+	return NewCompositeBus(bus, NewKafkaPublisher(cfg.Kafka, client, logger))
+}
+
+// NopPublisher публикатор, который отбрасывает события
+type NopPublisher struct{}
+
+// Publish ничего не делает
+func (NopPublisher) Publish(ctx context.Context, event Event) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInProcessBusFiltersByType(t *testing.T) {
+	bus := NewInProcessBus(logging.NewLogrus(logrus.New()))
+
+	var all, completed []EventType
+	bus.Subscribe(func(ctx context.Context, event Event) { all = append(all, event.Type) })
+	unsubscribe := bus.Subscribe(func(ctx context.Context, event Event) {
+		completed = append(completed, event.Type)
+	}, ReportCompleted)
+
+	require.NoError(t, bus.Publish(context.Background(), NewEvent(ReportStarted, 1, models.StatusProcessing)))
+	require.NoError(t, bus.Publish(context.Background(), NewEvent(ReportCompleted, 1, models.StatusCompleted)))
+
+	unsubscribe()
+	unsubscribe()
+	require.NoError(t, bus.Publish(context.Background(), NewEvent(ReportCompleted, 2, models.StatusCompleted)))
+
+	assert.Equal(t, []EventType{ReportStarted, ReportCompleted, ReportCompleted}, all)
+	assert.Equal(t, []EventType{ReportCompleted}, completed)
+}
+
+func TestInProcessBusRecoversFromPanic(t *testing.T) {
+	bus := NewInProcessBus(logging.NewLogrus(logrus.New()))
+
+	delivered := false
+	bus.Subscribe(func(ctx context.Context, event Event) { panic("boom") })
+	bus.Subscribe(func(ctx context.Context, event Event) { delivered = true })
+
+	assert.NotPanics(t, func() {
+		require.NoError(t, bus.Publish(context.Background(), NewEvent(ReportDeleted, 1, "")))
+	})
+	assert.True(t, delivered)
+}
+
+func TestTypeForStatus(t *testing.T) {
+	eventType, ok := TypeForStatus(models.StatusFailed)
+	assert.True(t, ok)
+	assert.Equal(t, ReportFailed, eventType)
+
+	_, ok = TypeForStatus(models.StatusPending)
+	assert.False(t, ok)
+}
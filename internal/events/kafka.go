@@ -0,0 +1,305 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/telemetry"
+)
+
+// Заголовки сообщений Kafka с событиями отчетов
+const (
+	KafkaHeaderEventID   = "event_id"
+	KafkaHeaderEventType = "event_type"
+	KafkaHeaderError     = "error"
+)
+
+// ErrPublisherClosed публикатор остановлен и не принимает события
+var ErrPublisherClosed = errors.New("публикатор событий остановлен")
+
+// KafkaHeader заголовок сообщения Kafka
+type KafkaHeader struct {
+	Key   string
+	Value []byte
+}
+
+// KafkaMessage сообщение Kafka
+type KafkaMessage struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers []KafkaHeader
+	Time    time.Time
+}
+
+// KafkaWriter записывает сообщения в Kafka. Запись считается успешной
+// только после подтверждения брокером.
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...KafkaMessage) error
+	Close() error
+}
+
+// ManagedPublisher публикатор, требующий явного запуска и остановки
+type ManagedPublisher interface {
+	Publisher
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// KafkaPublisher публикует события отчетов в топик Kafka.
+// События ставятся в ограниченную очередь в памяти и отправляются фоновой горутиной
+// с повторами до подтверждения брокером. Доставка best-effort: события из очереди
+// теряются при падении процесса и при остановке дольше ее таймаута, а при заполненной
+// очереди Publish возвращает ошибку после отмены контекста. Повтор записи может
+// продублировать событие, поэтому потребители должны быть идемпотентны по event_id.
+// Событие, которое не удалось сериализовать, отправляется в топик
+// недоставленных сообщений, чтобы не блокировать очередь.
+type KafkaPublisher struct {
+	writer          KafkaWriter
+	topic           string
+	deadLetterTopic string
+	writeTimeout    time.Duration
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	marshal         func(Event) ([]byte, error)
+	logger          logging.Logger
+
+	queue    chan kafkaEnvelope
+	stop     chan struct{}
+	stopOnce sync.Once
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// kafkaEnvelope событие в очереди вместе с контекстом трассировки
+type kafkaEnvelope struct {
+	event Event
+	trace map[string]string
+}
+
+// kafkaDeadLetter содержимое сообщения в топике недоставленных сообщений
+type kafkaDeadLetter struct {
+	EventID   string    `json:"event_id"`
+	Type      EventType `json:"type"`
+	ReportID  uint      `json:"report_id"`
+	Error     string    `json:"error"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// NewKafkaPublisher создает публикатор событий в Kafka
+func NewKafkaPublisher(cfg config.Kafka, writer KafkaWriter, logger logging.Logger) *KafkaPublisher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &KafkaPublisher{
+		writer:          writer,
+		topic:           cfg.Topic,
+		deadLetterTopic: cfg.DeadLetterTopic,
+		writeTimeout:    cfg.WriteTimeout,
+		retryBackoff:    cfg.RetryBackoff,
+		maxRetryBackoff: cfg.MaxRetryBackoff,
+		marshal:         func(event Event) ([]byte, error) { return json.Marshal(event) },
+		logger:          logger,
+		queue:           make(chan kafkaEnvelope, cfg.BufferSize),
+		stop:            make(chan struct{}),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+}
+
+// WithMarshal задает функцию сериализации событий
+func (p *KafkaPublisher) WithMarshal(marshal func(Event) ([]byte, error)) *KafkaPublisher {
+	p.marshal = marshal
+	return p
+}
+
+// Publish ставит событие в очередь на отправку. Если очередь заполнена,
+// ожидает освобождения места до отмены контекста.
+func (p *KafkaPublisher) Publish(ctx context.Context, event Event) error {
+	select {
+	case <-p.stop:
+		return ErrPublisherClosed
+	default:
+	}
+
+	envelope := kafkaEnvelope{event: event, trace: telemetry.Inject(ctx)}
+
+	select {
+	case p.queue <- envelope:
+		return nil
+	case <-p.stop:
+		return ErrPublisherClosed
+	case <-ctx.Done():
+		return fmt.Errorf("очередь событий Kafka заполнена: %w", ctx.Err())
+	}
+}
+
+// Start запускает отправку событий
+func (p *KafkaPublisher) Start(ctx context.Context) error {
+	p.wg.Add(1)
+	go p.run()
+
+	p.logger.WithFields(logging.Fields{
+		"topic":             p.topic,
+		"dead_letter_topic": p.deadLetterTopic,
+	}).Info("Публикация событий в Kafka запущена")
+
+	return nil
+}
+
+// Stop отправляет события, оставшиеся в очереди, и закрывает соединения.
+// Если контекст завершится раньше, неотправленные события теряются.
+func (p *KafkaPublisher) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.logger.WithField("pending", len(p.queue)).Error("Не все события отправлены в Kafka до остановки")
+		p.cancel()
+		<-done
+	}
+	p.cancel()
+
+	if err := p.writer.Close(); err != nil {
+		return fmt.Errorf("ошибка закрытия соединения с Kafka: %w", err)
+	}
+
+	p.logger.Info("Публикация событий в Kafka остановлена")
+	return nil
+}
+
+// run цикл отправки событий из очереди
+func (p *KafkaPublisher) run() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case envelope := <-p.queue:
+			p.deliver(envelope)
+		case <-p.stop:
+			for {
+				select {
+				case envelope := <-p.queue:
+					p.deliver(envelope)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver сериализует событие и отправляет его в основной топик
+// или, при ошибке сериализации, в топик недоставленных сообщений
+func (p *KafkaPublisher) deliver(envelope kafkaEnvelope) {
+	event := envelope.event
+	logger := p.logger.WithFields(logging.Fields{
+		"event_id":   event.ID,
+		"event_type": event.Type,
+		"report_id":  event.ReportID,
+	})
+
+	value, err := p.marshal(event)
+	if err != nil {
+		p.deadLetter(event, err, logger)
+		return
+	}
+
+	headers := []KafkaHeader{
+		{Key: KafkaHeaderEventID, Value: []byte(event.ID)},
+		{Key: KafkaHeaderEventType, Value: []byte(event.Type)},
+	}
+	for key, value := range envelope.trace {
+		headers = append(headers, KafkaHeader{Key: key, Value: []byte(value)})
+	}
+
+	p.write(KafkaMessage{
+		Topic:   p.topic,
+		Key:     kafkaEventKey(event),
+		Value:   value,
+		Headers: headers,
+		Time:    event.Timestamp,
+	}, logger)
+}
+
+// deadLetter отправляет в топик недоставленных сообщений описание события,
+// которое не удалось сериализовать
+func (p *KafkaPublisher) deadLetter(event Event, cause error, logger logging.Logger) {
+	logger = logger.WithError(cause)
+	if p.deadLetterTopic == "" {
+		logger.Error("Ошибка сериализации события, топик недоставленных сообщений не задан")
+		return
+	}
+	logger.Error("Ошибка сериализации события, событие отправлено в топик недоставленных сообщений")
+
+	value, err := json.Marshal(kafkaDeadLetter{
+		EventID:   event.ID,
+		Type:      event.Type,
+		ReportID:  event.ReportID,
+		Error:     cause.Error(),
+		Timestamp: event.Timestamp,
+	})
+	if err != nil {
+		logger.WithField("dead_letter_error", err.Error()).Error("Ошибка сериализации недоставленного события")
+		return
+	}
+
+	p.write(KafkaMessage{
+		Topic: p.deadLetterTopic,
+		Key:   kafkaEventKey(event),
+		Value: value,
+		Headers: []KafkaHeader{
+			{Key: KafkaHeaderEventID, Value: []byte(event.ID)},
+			{Key: KafkaHeaderEventType, Value: []byte(event.Type)},
+			{Key: KafkaHeaderError, Value: []byte(cause.Error())},
+		},
+		Time: time.Now().UTC(),
+	}, logger)
+}
+
+// write записывает сообщение, повторяя попытки с экспоненциальной задержкой
+// до подтверждения брокером или остановки публикатора
+func (p *KafkaPublisher) write(message KafkaMessage, logger logging.Logger) {
+	backoff := p.retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(p.ctx, p.writeTimeout)
+		err := p.writer.WriteMessages(ctx, message)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		logger.WithError(err).WithFields(logging.Fields{
+			"topic":   message.Topic,
+			"attempt": attempt,
+		}).Warn("Ошибка отправки события в Kafka, повтор")
+
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			logger.WithField("topic", message.Topic).Error("Событие не отправлено в Kafka: публикатор остановлен")
+			return
+		}
+		backoff = min(backoff*2, p.maxRetryBackoff)
+	}
+}
+
+// kafkaEventKey ключ сообщения. События одного отчета попадают в один раздел
+// и читаются потребителями в порядке публикации.
+func kafkaEventKey(event Event) []byte {
+	return []byte(strconv.FormatUint(uint64(event.ReportID), 10))
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+const (
+	// KafkaSASLPlain механизм SASL PLAIN
+	KafkaSASLPlain = "PLAIN"
+
+	// kafkaBatchTimeout сколько writer ждет следующих сообщений пакета. Публикатор пишет
+	// события по одному, поэтому ожидание сокращено, чтобы не задерживать каждую запись
+	kafkaBatchTimeout = 10 * time.Millisecond
+)
+
+// KafkaClient пишет сообщения в Kafka через клиент segmentio/kafka-go.
+// Сообщение попадает в раздел по хэшу ключа (murmur2, как в Java клиенте),
+// поэтому события одного отчета сохраняют порядок. Повторы записи выполняет
+// KafkaPublisher, клиент делает одну попытку.
+type KafkaClient struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaClient создает клиент Kafka. Соединения устанавливаются при первой записи.
+func NewKafkaClient(cfg config.Kafka, logger logging.Logger) *KafkaClient {
+	transport := &kafka.Transport{ClientID: cfg.ClientID}
+	if cfg.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.SASL.Mechanism == KafkaSASLPlain {
+		transport.SASL = plain.Mechanism{Username: cfg.SASL.Username, Password: cfg.SASL.Password}
+	}
+
+	logger = logger.WithField("component", "kafka")
+	return &KafkaClient{writer: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Balancer:     &kafka.Murmur2Balancer{},
+		RequiredAcks: kafka.RequireAll,
+		MaxAttempts:  1,
+		BatchTimeout: kafkaBatchTimeout,
+		Transport:    transport,
+		ErrorLogger: kafka.LoggerFunc(func(format string, args ...interface{}) {
+			logger.Debug(fmt.Sprintf(format, args...))
+		}),
+	}}
+}
+
+// WriteMessages записывает сообщения и ожидает подтверждения всех синхронных реплик
+func (c *KafkaClient) WriteMessages(ctx context.Context, messages ...KafkaMessage) error {
+	return c.writer.WriteMessages(ctx, kafkaMessages(messages)...)
+}
+
+// Close закрывает соединения с брокерами
+func (c *KafkaClient) Close() error {
+	return c.writer.Close()
+}
+
+// kafkaMessages переводит сообщения в формат клиента kafka-go
+func kafkaMessages(messages []KafkaMessage) []kafka.Message {
+	converted := make([]kafka.Message, 0, len(messages))
+	for _, message := range messages {
+		headers := make([]kafka.Header, 0, len(message.Headers))
+		for _, header := range message.Headers {
+			headers = append(headers, kafka.Header{Key: header.Key, Value: header.Value})
+		}
+		converted = append(converted, kafka.Message{
+			Topic:   message.Topic,
+			Key:     message.Key,
+			Value:   message.Value,
+			Headers: headers,
+			Time:    message.Time,
+		})
+	}
+	return converted
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKafkaWriter запоминает записанные сообщения и возвращает ошибки из очереди
+type fakeKafkaWriter struct {
+	mu       sync.Mutex
+	failures []error
+	attempts int
+	messages []KafkaMessage
+	closed   bool
+}
+
+func (w *fakeKafkaWriter) WriteMessages(ctx context.Context, messages ...KafkaMessage) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.attempts++
+	if len(w.failures) > 0 {
+		err := w.failures[0]
+		w.failures = w.failures[1:]
+		return err
+	}
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *fakeKafkaWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func testKafkaConfig() config.Kafka {
+	return config.Kafka{
+		Enabled:         true,
+		Topic:           "report-events",
+		DeadLetterTopic: "report-events-dlq",
+		BufferSize:      10,
+		WriteTimeout:    time.Second,
+		RetryBackoff:    time.Millisecond,
+		MaxRetryBackoff: 5 * time.Millisecond,
+	}
+}
+
+func headerValue(message KafkaMessage, key string) string {
+	for _, header := range message.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func TestKafkaPublisherRetriesUntilAcknowledged(t *testing.T) {
+	writer := &fakeKafkaWriter{failures: []error{errors.New("broker down"), errors.New("broker down")}}
+	publisher := NewKafkaPublisher(testKafkaConfig(), writer, logging.NewLogrus(logrus.New()))
+	require.NoError(t, publisher.Start(context.Background()))
+
+	event := NewEvent(ReportCompleted, 42, models.StatusCompleted).WithFileKey("reports/42.xlsx")
+	require.NoError(t, publisher.Publish(context.Background(), event))
+	require.NoError(t, publisher.Stop(context.Background()))
+
+	assert.Equal(t, 3, writer.attempts)
+	assert.True(t, writer.closed)
+	require.Len(t, writer.messages, 1)
+
+	message := writer.messages[0]
+	assert.Equal(t, "report-events", message.Topic)
+	assert.Equal(t, "42", string(message.Key))
+	assert.Equal(t, string(ReportCompleted), headerValue(message, KafkaHeaderEventType))
+	assert.Equal(t, event.ID, headerValue(message, KafkaHeaderEventID))
+
+	var decoded Event
+	require.NoError(t, json.Unmarshal(message.Value, &decoded))
+	assert.Equal(t, event.ID, decoded.ID)
+	assert.Equal(t, "reports/42.xlsx", decoded.FileKey)
+
+	assert.ErrorIs(t, publisher.Publish(context.Background(), event), ErrPublisherClosed)
+}
+
+func TestKafkaPublisherSendsUnserializableEventsToDeadLetterTopic(t *testing.T) {
+	writer := &fakeKafkaWriter{}
+	publisher := NewKafkaPublisher(testKafkaConfig(), writer, logging.NewLogrus(logrus.New())).
+		WithMarshal(func(event Event) ([]byte, error) {
+			if event.ReportID == 1 {
+				return nil, errors.New("unsupported value")
+			}
+			return json.Marshal(event)
+		})
+	require.NoError(t, publisher.Start(context.Background()))
+
+	require.NoError(t, publisher.Publish(context.Background(), NewEvent(ReportFailed, 1, models.StatusFailed)))
+	require.NoError(t, publisher.Publish(context.Background(), NewEvent(ReportFailed, 2, models.StatusFailed)))
+	require.NoError(t, publisher.Stop(context.Background()))
+
+	require.Len(t, writer.messages, 2)
+
+	deadLetter := writer.messages[0]
+	assert.Equal(t, "report-events-dlq", deadLetter.Topic)
+	assert.Equal(t, "unsupported value", headerValue(deadLetter, KafkaHeaderError))
+
+	var record kafkaDeadLetter
+	require.NoError(t, json.Unmarshal(deadLetter.Value, &record))
+	assert.Equal(t, uint(1), record.ReportID)
+	assert.Equal(t, "unsupported value", record.Error)
+
+	assert.Equal(t, "report-events", writer.messages[1].Topic)
+}
+
+func TestKafkaClientWriter(t *testing.T) {
+	client := NewKafkaClient(config.Kafka{
+		Brokers:  []string{"kafka-1:9092", "kafka-2:9092"},
+		ClientID: "report-srv-test",
+		TLS:      true,
+		SASL:     config.KafkaSASL{Mechanism: KafkaSASLPlain, Username: "reports", Password: "secret"},
+	}, logging.NewLogrus(logrus.New()))
+	defer client.Close()
+
+	assert.Equal(t, "kafka-1:9092,kafka-2:9092", client.writer.Addr.String())
+	assert.Equal(t, kafka.RequireAll, client.writer.RequiredAcks)
+	transport := client.writer.Transport.(*kafka.Transport)
+	assert.Equal(t, "report-srv-test", transport.ClientID)
+	assert.NotNil(t, transport.TLS)
+	assert.Equal(t, plain.Mechanism{Username: "reports", Password: "secret"}, transport.SASL)
+
+	// Раздел выбирается murmur2 как в Java клиенте: murmur2("21") = -973932308,
+	// (-973932308 & 0x7fffffff) % 2 = 0
+	timestamp := time.Now().Truncate(time.Millisecond)
+	messages := kafkaMessages([]KafkaMessage{{
+		Topic:   "report-events",
+		Key:     []byte("21"),
+		Value:   []byte(`{"report_id":21}`),
+		Headers: []KafkaHeader{{Key: KafkaHeaderEventType, Value: []byte("report.completed")}},
+		Time:    timestamp,
+	}})
+	require.Len(t, messages, 1)
+	assert.Equal(t, 0, client.writer.Balancer.Balance(messages[0], 0, 1))
+	assert.Equal(t, "report-events", messages[0].Topic)
+	assert.Equal(t, []kafka.Header{{Key: KafkaHeaderEventType, Value: []byte("report.completed")}}, messages[0].Headers)
+	assert.True(t, timestamp.Equal(messages[0].Time))
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDKey имя поля ID HTTP запроса
+	RequestIDKey = "request_id"
+	// TraceIDKey имя поля ID трассы
+	TraceIDKey = "trace_id"
+	// SpanIDKey имя поля ID спана
+	SpanIDKey = "span_id"
+)
+
+// requestIDKey ключ ID запроса в контексте
+type requestIDKey struct{}
+
+// ContextWithRequestID возвращает контекст с ID запроса, который FromContext добавит в записи лога
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext возвращает ID запроса из контекста или пустую строку
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext возвращает logger с полями корреляции из контекста: ID запроса,
+// ID трассы и спана. Без полей корреляции возвращается сам logger.
+func FromContext(ctx context.Context, logger Logger) Logger {
+	fields := Fields{}
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		fields[RequestIDKey] = requestID
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields[TraceIDKey] = spanContext.TraceID().String()
+		fields[SpanIDKey] = spanContext.SpanID().String()
+	}
+
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.WithFields(fields)
+}
@@ -0,0 +1,64 @@
+// Package logging определяет интерфейс логгера сервиса и адаптеры для logrus и zap.
+// Пакеты сервиса зависят только от Logger, реализация выбирается в конфигурации.
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"report_srv/internal/config"
+)
+
+const (
+	// BackendLogrus логгер logrus
+	BackendLogrus = "logrus"
+	// BackendZap логгер zap
+	BackendZap = "zap"
+)
+
+// Fields поля записи лога
+type Fields map[string]interface{}
+
+// Logger структурированный логгер. With* возвращают новый логгер с полями,
+// исходный логгер не меняется.
+type Logger interface {
+	WithField(key string, value interface{}) Logger
+	WithFields(fields Fields) Logger
+	WithError(err error) Logger
+
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+}
+
+// ErrorKey имя поля ошибки, которое добавляет WithError
+const ErrorKey = "error"
+
+// New создает логгер по настройкам логирования
+func New(cfg config.Logging) (Logger, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case BackendLogrus, "":
+		return newLogrusFromConfig(cfg)
+	case BackendZap:
+		return newZapFromConfig(cfg)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый логгер: %s", cfg.Backend)
+	}
+}
+
+// Nop возвращает логгер, который ничего не записывает
+func Nop() Logger {
+	return nopLogger{}
+}
+
+// nopLogger логгер без вывода
+type nopLogger struct{}
+
+func (l nopLogger) WithField(string, interface{}) Logger { return l }
+func (l nopLogger) WithFields(Fields) Logger             { return l }
+func (l nopLogger) WithError(error) Logger               { return l }
+func (nopLogger) Debug(...interface{})                   {}
+func (nopLogger) Info(...interface{})                    {}
+func (nopLogger) Warn(...interface{})                    {}
+func (nopLogger) Error(...interface{})                   {}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"report_srv/internal/config"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogrusAdapterWritesFields(t *testing.T) {
+	var buffer bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&buffer)
+	base.SetFormatter(&logrus.JSONFormatter{})
+
+	logger := NewLogrus(base)
+	logger.WithFields(Fields{"report_id": 7}).WithField("format", "csv").WithError(errors.New("boom")).Warn("Ошибка")
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &entry))
+	assert.Equal(t, "Ошибка", entry["msg"])
+	assert.Equal(t, "warning", entry["level"])
+	assert.Equal(t, float64(7), entry["report_id"])
+	assert.Equal(t, "csv", entry["format"])
+	assert.Equal(t, "boom", entry[ErrorKey])
+}
+
+func TestZapAdapterWritesFields(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := NewZap(zap.New(core))
+
+	// Поля дочернего логгера не попадают в исходный
+	child := logger.WithFields(Fields{"report_id": 7, "format": "csv"}).WithError(errors.New("boom"))
+	child.Error("Ошибка")
+	logger.Debug("Отладка")
+	logger.Info("Готово")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Ошибка", entries[0].Message)
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	assert.Equal(t, map[string]interface{}{"report_id": int64(7), "format": "csv", ErrorKey: "boom"}, entries[0].ContextMap())
+	assert.Equal(t, "Готово", entries[1].Message)
+	assert.Empty(t, entries[1].ContextMap())
+}
+
+func TestNewSelectsBackend(t *testing.T) {
+	logger, err := New(config.Logging{Level: "info", Format: "json", Backend: BackendZap})
+	require.NoError(t, err)
+	assert.IsType(t, &zapLogger{}, logger)
+
+	logger, err = New(config.Logging{Level: "debug", Format: "text"})
+	require.NoError(t, err)
+	assert.IsType(t, &logrusLogger{}, logger)
+
+	_, err = New(config.Logging{Level: "info", Backend: "slog"})
+	assert.Error(t, err)
+
+	_, err = New(config.Logging{Level: "verbose", Backend: BackendZap})
+	assert.Error(t, err)
+}
+
+func TestFromContextAddsCorrelationFields(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := NewZap(zap.New(core))
+
+	// Без полей корреляции возвращается исходный логгер
+	assert.Same(t, logger, FromContext(context.Background(), logger))
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	ctx = ContextWithRequestID(ctx, "req-1")
+	assert.Equal(t, "req-1", RequestIDFromContext(ctx))
+
+	FromContext(ctx, logger).Info("Отчет создан")
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{
+		RequestIDKey: "req-1",
+		TraceIDKey:   "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanIDKey:    "00f067aa0ba902b7",
+	}, entries[0].ContextMap())
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"time"
+
+	"report_srv/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logrusLogger адаптер logrus
+type logrusLogger struct {
+	entry *logrus.Entry
+}
+
+// NewLogrus возвращает Logger, который пишет в logger
+func NewLogrus(logger *logrus.Logger) Logger {
+	return &logrusLogger{entry: logrus.NewEntry(logger)}
+}
+
+// newLogrusFromConfig создает logrus логгер с уровнем и форматом из конфигурации
+func newLogrusFromConfig(cfg config.Logging) (Logger, error) {
+	logger := logrus.New()
+
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	logger.SetLevel(level)
+
+	switch cfg.Format {
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339,
+		})
+	default:
+		logger.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+		})
+	}
+	return NewLogrus(logger), nil
+}
+
+func (l *logrusLogger) WithField(key string, value interface{}) Logger {
+	return &logrusLogger{entry: l.entry.WithField(key, value)}
+}
+
+func (l *logrusLogger) WithFields(fields Fields) Logger {
+	return &logrusLogger{entry: l.entry.WithFields(logrus.Fields(fields))}
+}
+
+func (l *logrusLogger) WithError(err error) Logger {
+	return &logrusLogger{entry: l.entry.WithField(ErrorKey, err)}
+}
+
+func (l *logrusLogger) Debug(args ...interface{}) { l.entry.Debug(args...) }
+func (l *logrusLogger) Info(args ...interface{})  { l.entry.Info(args...) }
+func (l *logrusLogger) Warn(args ...interface{})  { l.entry.Warn(args...) }
+func (l *logrusLogger) Error(args ...interface{}) { l.entry.Error(args...) }
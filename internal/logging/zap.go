@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"sort"
+
+	"report_srv/internal/config"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// zapLogger адаптер zap
+type zapLogger struct {
+	logger *zap.SugaredLogger
+}
+
+// NewZap возвращает Logger, который пишет в logger
+func NewZap(logger *zap.Logger) Logger {
+	return &zapLogger{logger: logger.Sugar()}
+}
+
+// newZapFromConfig создает zap логгер с уровнем и форматом из конфигурации.
+// Формат json - кодировщик JSON, остальные - консольный вывод.
+func newZapFromConfig(cfg config.Logging) (Logger, error) {
+	level, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(level)
+	zapConfig.Sampling = nil
+	zapConfig.EncoderConfig.TimeKey = "time"
+	zapConfig.EncoderConfig.EncodeTime = zapcore.RFC3339TimeEncoder
+	if cfg.Format != "json" {
+		zapConfig.Encoding = "console"
+		zapConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+
+	logger, err := zapConfig.Build()
+	if err != nil {
+		return nil, err
+	}
+	return NewZap(logger), nil
+}
+
+func (l *zapLogger) WithField(key string, value interface{}) Logger {
+	return &zapLogger{logger: l.logger.With(key, value)}
+}
+
+// WithFields добавляет поля в порядке имен, чтобы записи с одинаковыми полями совпадали
+func (l *zapLogger) WithFields(fields Fields) Logger {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := make([]interface{}, 0, len(fields)*2)
+	for _, key := range keys {
+		args = append(args, key, fields[key])
+	}
+	return &zapLogger{logger: l.logger.With(args...)}
+}
+
+func (l *zapLogger) WithError(err error) Logger {
+	return &zapLogger{logger: l.logger.With(zap.NamedError(ErrorKey, err))}
+}
+
+func (l *zapLogger) Debug(args ...interface{}) { l.logger.Debug(args...) }
+func (l *zapLogger) Info(args ...interface{})  { l.logger.Info(args...) }
+func (l *zapLogger) Warn(args ...interface{})  { l.logger.Warn(args...) }
+func (l *zapLogger) Error(args ...interface{}) { l.logger.Error(args...) }
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Области доступа API ключей
+const (
+	ScopeReportsRead      = "reports:read"
+	ScopeReportsWrite     = "reports:write"
+	ScopeDefinitionsRead  = "definitions:read"
+	ScopeDefinitionsWrite = "definitions:write"
+	ScopeSchedulesRead    = "schedules:read"
+	ScopeSchedulesWrite   = "schedules:write"
+	// ScopeUnmasked отчеты без маскирования персональных данных
+	ScopeUnmasked = "pii:unmasked"
+	// ScopeAdmin доступ к административному API и ко всем остальным областям
+	ScopeAdmin = "admin"
+)
+
+// APIKeyScopes все области доступа API ключей
+var APIKeyScopes = []string{
+	ScopeReportsRead, ScopeReportsWrite,
+	ScopeDefinitionsRead, ScopeDefinitionsWrite,
+	ScopeSchedulesRead, ScopeSchedulesWrite,
+	ScopeUnmasked, ScopeAdmin,
+}
+
+// Scopes список областей доступа, хранится в JSON
+type Scopes []string
+
+// Value реализует интерфейс driver.Valuer для Scopes
+func (s Scopes) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации областей доступа: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для Scopes
+func (s *Scopes) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в Scopes", value)
+	}
+
+	var result Scopes
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации областей доступа: %w", err)
+	}
+
+	*s = result
+	return nil
+}
+
+// Allows проверяет, разрешена ли область доступа. Область admin разрешает все.
+func (s Scopes) Allows(scope string) bool {
+	return slices.Contains(s, ScopeAdmin) || slices.Contains(s, scope)
+}
+
+// APIKey ключ доступа к API для вызовов от других сервисов. Хранится только SHA-256 ключа,
+// сам ключ возвращается один раз при создании. Отозванный ключ удаляется мягко.
+type APIKey struct {
+	ID         uint           `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt  gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	Name       string         `json:"name" gorm:"size:255;not null"`
+	Prefix     string         `json:"prefix" gorm:"size:16;not null"`
+	Hash       string         `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Scopes     Scopes         `json:"scopes" gorm:"type:jsonb"`
+	ExpiresAt  *time.Time     `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time     `json:"last_used_at,omitempty"`
+	CreatedBy  string         `json:"created_by" gorm:"size:255;not null"`
+}
+
+// TableName указывает имя таблицы для модели APIKey
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsExpired возвращает true, если срок действия ключа истек
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(now)
+}
+
+// Validate валидирует API ключ
+func (k *APIKey) Validate() error {
+	var errors []string
+
+	if strings.TrimSpace(k.Name) == "" {
+		errors = append(errors, "название ключа не может быть пустым")
+	}
+	if len(k.Name) > 255 {
+		errors = append(errors, "название ключа не может быть длиннее 255 символов")
+	}
+
+	if len(k.Scopes) == 0 {
+		errors = append(errors, "ключу должна быть выдана хотя бы одна область доступа")
+	}
+	for _, scope := range k.Scopes {
+		if !slices.Contains(APIKeyScopes, scope) {
+			errors = append(errors, fmt.Sprintf("неизвестная область доступа: %s", scope))
+		}
+	}
+
+	if strings.TrimSpace(k.CreatedBy) == "" {
+		errors = append(errors, "поле created_by не может быть пустым")
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReportAttachment дополнительный файл, приложенный к отчету, например методика
+// расчета или исходная выгрузка. Хранится рядом с файлом отчета и попадает в ZIP архив.
+type ReportAttachment struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ReportID  uint      `json:"report_id" gorm:"not null;index"`
+	// Filename имя файла для скачивания, уникально в пределах отчета
+	Filename    string `json:"filename" gorm:"size:255;not null"`
+	ContentType string `json:"content_type" gorm:"size:255;not null"`
+	Size        int64  `json:"size" gorm:"not null;default:0"`
+	// Checksum SHA-256 файла в hex, проверяется при скачивании
+	Checksum  string `json:"checksum" gorm:"size:64"`
+	FileKey   string `json:"-" gorm:"size:512;not null"`
+	CreatedBy string `json:"created_by" gorm:"size:255;not null"`
+}
+
+// TableName указывает имя таблицы для модели ReportAttachment
+func (ReportAttachment) TableName() string {
+	return "report_attachments"
+}
+
+// Validate валидирует приложенный файл
+func (a *ReportAttachment) Validate() error {
+	var errors []string
+
+	if a.ReportID == 0 {
+		errors = append(errors, "не указан отчет")
+	}
+	if strings.TrimSpace(a.Filename) == "" {
+		errors = append(errors, "не указано имя файла")
+	}
+	if len(a.Filename) > 255 {
+		errors = append(errors, "имя файла не может быть длиннее 255 символов")
+	}
+	if strings.ContainsAny(a.Filename, `/\`) || a.Filename == "." || a.Filename == ".." {
+		errors = append(errors, "имя файла не может содержать путь")
+	}
+	if strings.TrimSpace(a.CreatedBy) == "" {
+		errors = append(errors, "поле created_by не может быть пустым")
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// BundleArtifact файл отчета в ZIP архиве формата zip
+type BundleArtifact struct {
+	// Format формат файла, пустой у приложенных к отчету файлов
+	Format ReportFormat `json:"format,omitempty"`
+	// Filename имя файла внутри архива
+	Filename string `json:"filename"`
+	// Size размер файла в байтах до сжатия в архиве
+	Size int64 `json:"size"`
+	// Checksum SHA-256 файла в hex
+	Checksum string `json:"checksum"`
+}
+
+// BundleManifest список файлов ZIP архива отчета в порядке параметра bundle
+type BundleManifest []BundleArtifact
+
+// Find возвращает файл архива нужного формата
+func (m BundleManifest) Find(format ReportFormat) (BundleArtifact, bool) {
+	for _, artifact := range m {
+		if artifact.Format == format {
+			return artifact, true
+		}
+	}
+	return BundleArtifact{}, false
+}
+
+// Value реализует интерфейс driver.Valuer для BundleManifest
+func (m BundleManifest) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal([]BundleArtifact(m))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации состава архива: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для BundleManifest
+func (m *BundleManifest) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в BundleManifest", value)
+	}
+
+	var result []BundleArtifact
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации состава архива: %w", err)
+	}
+
+	*m = result
+	return nil
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ChannelType мессенджер канала для сообщений об отчетах
+type ChannelType string
+
+const (
+	// ChannelSlack входящий вебхук Slack
+	ChannelSlack ChannelType = "slack"
+	// ChannelTeams входящий вебхук или workflow Microsoft Teams
+	ChannelTeams ChannelType = "teams"
+)
+
+// IsValid проверяет, поддерживается ли мессенджер
+func (t ChannelType) IsValid() bool {
+	return t == ChannelSlack || t == ChannelTeams
+}
+
+// ChannelEvent событие отчета, о котором сообщается в канал
+type ChannelEvent string
+
+const (
+	// ChannelEventCompleted отчет готов, сообщение содержит ссылку на файл
+	ChannelEventCompleted ChannelEvent = "completed"
+	// ChannelEventFailed генерация отчета завершилась ошибкой
+	ChannelEventFailed ChannelEvent = "failed"
+)
+
+// NotificationChannel канал, в который публикуются сообщения о готовых и упавших отчетах
+type NotificationChannel struct {
+	Type ChannelType `json:"type"`
+	// WebhookURL адрес входящего вебхука канала
+	WebhookURL string `json:"webhook_url"`
+	// Events события, о которых сообщается в канал. Пустой список - о готовых и упавших отчетах
+	Events []ChannelEvent `json:"events,omitempty"`
+}
+
+// Accepts проверяет, сообщается ли в канал о событии
+func (c NotificationChannel) Accepts(event ChannelEvent) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, accepted := range c.Events {
+		if accepted == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationChannels каналы определения или отчета
+type NotificationChannels []NotificationChannel
+
+// Value реализует интерфейс driver.Valuer для NotificationChannels
+func (c NotificationChannels) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации каналов: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для NotificationChannels
+func (c *NotificationChannels) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в NotificationChannels", value)
+	}
+
+	var result NotificationChannels
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации каналов: %w", err)
+	}
+
+	*c = result
+	return nil
+}
+
+// Validate проверяет мессенджеры, адреса вебхуков и события каналов
+func (c NotificationChannels) Validate() []string {
+	var errors []string
+	for i, channel := range c {
+		if !channel.Type.IsValid() {
+			errors = append(errors, fmt.Sprintf("канал %d: неподдерживаемый тип %q, допустимы slack, teams", i+1, channel.Type))
+		}
+		parsed, err := url.Parse(strings.TrimSpace(channel.WebhookURL))
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			errors = append(errors, fmt.Sprintf("канал %d: адрес вебхука должен быть https ссылкой", i+1))
+		}
+		for _, event := range channel.Events {
+			if event != ChannelEventCompleted && event != ChannelEventFailed {
+				errors = append(errors, fmt.Sprintf("канал %d: неизвестное событие %q, допустимы completed, failed", i+1, event))
+			}
+		}
+	}
+	return errors
+}
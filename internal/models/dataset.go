@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// DatasetFormat формат загруженного файла с данными
+type DatasetFormat string
+
+const (
+	// DatasetCSV таблица CSV, разделитель определяется по строке заголовков
+	DatasetCSV DatasetFormat = "csv"
+	// DatasetXLSX книга Excel, данные берутся с первого листа
+	DatasetXLSX DatasetFormat = "xlsx"
+)
+
+// DatasetFormatByName возвращает формат файла с данными по расширению имени
+func DatasetFormatByName(filename string) (DatasetFormat, bool) {
+	switch format := DatasetFormat(strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))); format {
+	case DatasetCSV, DatasetXLSX:
+		return format, true
+	default:
+		return "", false
+	}
+}
+
+// UploadedDataset загруженный пользователем файл CSV или XLSX, который используется
+// вместо SQL запроса как источник данных отчета. Первая строка файла - заголовки колонок.
+type UploadedDataset struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	// Filename имя загруженного файла
+	Filename string        `json:"filename" gorm:"size:255;not null"`
+	Format   DatasetFormat `json:"format" gorm:"size:10;not null"`
+	Size     int64         `json:"size" gorm:"not null;default:0"`
+	// Checksum SHA-256 файла в hex
+	Checksum string `json:"checksum" gorm:"size:64"`
+	// Columns колонки из строки заголовков файла
+	Columns DatasetColumns `json:"columns" gorm:"type:jsonb"`
+	// RowCount число строк данных без строки заголовков
+	RowCount  int64  `json:"row_count" gorm:"not null;default:0"`
+	FileKey   string `json:"-" gorm:"size:512;not null"`
+	CreatedBy string `json:"created_by" gorm:"size:255;not null;index"`
+}
+
+// DatasetColumns список колонок набора данных, хранится в JSON
+type DatasetColumns []string
+
+// Value реализует интерфейс driver.Valuer для DatasetColumns
+func (c DatasetColumns) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации колонок: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для DatasetColumns
+func (c *DatasetColumns) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в DatasetColumns", value)
+	}
+
+	var result DatasetColumns
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации колонок: %w", err)
+	}
+
+	*c = result
+	return nil
+}
+
+// TableName указывает имя таблицы для модели UploadedDataset
+func (UploadedDataset) TableName() string {
+	return "uploaded_datasets"
+}
+
+// Validate валидирует загруженный набор данных
+func (d *UploadedDataset) Validate() error {
+	var errors []string
+
+	if strings.TrimSpace(d.Filename) == "" {
+		errors = append(errors, "не указано имя файла")
+	}
+	if len(d.Filename) > 255 {
+		errors = append(errors, "имя файла не может быть длиннее 255 символов")
+	}
+	if strings.ContainsAny(d.Filename, `/\`) {
+		errors = append(errors, "имя файла не может содержать путь")
+	}
+	if d.Format != DatasetCSV && d.Format != DatasetXLSX {
+		errors = append(errors, "поддерживаются файлы .csv и .xlsx")
+	}
+	if strings.TrimSpace(d.CreatedBy) == "" {
+		errors = append(errors, "поле created_by не может быть пустым")
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
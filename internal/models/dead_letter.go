@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// DeadLetter задача генерации отчета, исчерпавшая попытки, с контекстом последней ошибки.
+// Записи хранятся в БД и не теряются при перезапуске процессора задач
+type DeadLetter struct {
+	ID uint `json:"id" gorm:"primarykey"`
+	// CreatedAt когда задача исчерпала попытки
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ReportID  uint      `json:"report_id" gorm:"not null;index"`
+	TaskID    string    `json:"task_id" gorm:"size:100;not null"`
+	TaskType  string    `json:"task_type" gorm:"size:50;not null"`
+	Priority  int       `json:"priority" gorm:"not null;default:0"`
+	// Attempts число выполненных попыток
+	Attempts  int             `json:"attempts" gorm:"not null"`
+	ErrorCode ReportErrorCode `json:"error_code" gorm:"size:50"`
+	// ErrorMessage текст последней ошибки, в отчете он обрезается до 1000 символов
+	ErrorMessage string `json:"error_message" gorm:"type:text"`
+	// RequestID ID HTTP запроса, создавшего задачу, для поиска в логах
+	RequestID string `json:"request_id,omitempty" gorm:"size:100"`
+	// RequeuedAt когда отчет поставлен в очередь повторно, nil - еще не поставлен
+	RequeuedAt *time.Time `json:"requeued_at,omitempty"`
+	RequeuedBy string     `json:"requeued_by,omitempty" gorm:"size:255"`
+}
+
+// TableName указывает имя таблицы для модели DeadLetter
+func (DeadLetter) TableName() string {
+	return "dead_letters"
+}
+
+// IsRequeued возвращает true, если отчет задачи поставлен в очередь повторно
+func (d *DeadLetter) IsRequeued() bool {
+	return d.RequeuedAt != nil
+}
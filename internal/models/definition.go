@@ -0,0 +1,309 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// definitionNamePattern допустимое имя определения отчета
+var definitionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// ReportDefinition именованное определение отчета: запросы к данным, шаблон,
+// схема параметров и формат. Отчет ссылается на определение по имени (Report.Type).
+type ReportDefinition struct {
+	ID          uint           `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	Name        string         `json:"name" gorm:"size:100;not null;uniqueIndex:idx_report_definitions_name,where:deleted_at IS NULL"`
+	Description string         `json:"description" gorm:"size:1000"`
+	Queries     Queries        `json:"queries" gorm:"type:jsonb;not null"`
+	// TemplateKey ключ файла шаблона в хранилище. Пустой - отчет без шаблона
+	TemplateKey string `json:"template_key,omitempty" gorm:"size:255"`
+	// ParameterSchema JSON Schema параметров отчета. Пустая - параметры не проверяются
+	ParameterSchema JSON         `json:"parameter_schema,omitempty" gorm:"type:jsonb"`
+	Format          ReportFormat `json:"format" gorm:"size:20;not null;default:'xlsx'"`
+	// ExcelLayout оформление Excel отчета. Пустое - данные выводятся без форматирования
+	ExcelLayout *ExcelLayout `json:"excel_layout,omitempty" gorm:"type:jsonb"`
+	// ColumnMapping преобразование колонок результатов запросов. Пустое - данные выводятся как есть
+	ColumnMapping *ColumnMapping `json:"column_mapping,omitempty" gorm:"type:jsonb"`
+	// Masking правила маскирования персональных данных определения, дополняют правила из конфигурации
+	Masking MaskingRules `json:"masking,omitempty" gorm:"type:jsonb"`
+	// Iterator итерационный запрос: расписание создает по отчету на каждую его строку.
+	// Пустой - расписание создает один отчет
+	Iterator *Iterator `json:"iterator,omitempty" gorm:"type:jsonb"`
+	// MaxConcurrentRuns наибольшее число отчетов определения в очереди и в генерации, при котором
+	// расписание еще создает новый отчет. 0 - без ограничения
+	MaxConcurrentRuns int `json:"max_concurrent_runs,omitempty" gorm:"not null;default:0"`
+	// DedupeWindow срок, например 30m, в течение которого запуск расписания с теми же форматом,
+	// названием и параметрами объединяется с уже созданным отчетом. Пустой - запуски не объединяются
+	DedupeWindow string `json:"dedupe_window,omitempty" gorm:"size:50"`
+	// SLA сроки ожидания в очереди и генерации отчетов определения. Пустое - сроки не отслеживаются
+	SLA *SLA `json:"sla,omitempty" gorm:"type:jsonb"`
+	// NotificationChannels каналы Slack и Microsoft Teams, в которые сообщается о готовых и упавших отчетах определения
+	NotificationChannels NotificationChannels `json:"notification_channels,omitempty" gorm:"type:jsonb"`
+	// Document свойства документа и водяной знак файлов определения. Незаданные поля берутся из настроек documents
+	Document *DocumentOptions `json:"document,omitempty" gorm:"type:jsonb"`
+	// SchedulesPaused запуски расписаний определения приостановлены, например на время миграции
+	// базы данных источника. Отчеты, созданные вручную, генерируются как обычно
+	SchedulesPaused   bool       `json:"schedules_paused" gorm:"not null;default:false"`
+	SchedulesPausedAt *time.Time `json:"schedules_paused_at,omitempty"`
+	SchedulesPausedBy string     `json:"schedules_paused_by,omitempty" gorm:"size:255"`
+	CreatedBy         string     `json:"created_by" gorm:"size:255;not null"`
+	UpdatedBy         string     `json:"updated_by" gorm:"size:255;not null"`
+}
+
+// Query именованный SQL запрос определения отчета.
+// Параметры отчета подставляются в запрос по имени: @region.
+type Query struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+	// Source имя источника данных из конфигурации. Пустое - основная база данных
+	Source string `json:"source,omitempty"`
+	// Dataset имя параметра отчета с ID загруженного файла с данными (UploadedDataset).
+	// Строки запроса берутся из файла, SQL и источник данных не задаются
+	Dataset string `json:"dataset,omitempty"`
+	// Path путь запроса к JSON API источника данных с драйвером http вместо SQL.
+	// Параметры отчета подставляются по имени: /orders?region={region}
+	Path string `json:"path,omitempty"`
+	// Rows путь JSONPath к массиву строк в ответе API, например $.data.items. Пустой - весь ответ
+	Rows string `json:"rows,omitempty"`
+	// Derived производный набор над результатами предыдущих запросов вместо SQL
+	Derived *Derived `json:"derived,omitempty"`
+	// Hidden результат запроса не выводится в отчет, а используется только производными наборами
+	Hidden bool `json:"hidden,omitempty"`
+	// Sheet лист Excel отчета для результатов запроса. Пустой - общий лист Report.
+	// Запросы с одинаковым листом выводятся на него подряд
+	Sheet string `json:"sheet,omitempty"`
+}
+
+// SheetName возвращает лист Excel отчета для результатов запроса
+func (q Query) SheetName() string {
+	if q.Sheet == "" {
+		return ExcelReportSheet
+	}
+	return q.Sheet
+}
+
+// IsUploaded проверяет, берутся ли строки запроса из загруженного файла
+func (q Query) IsUploaded() bool {
+	return q.Dataset != ""
+}
+
+// IsHTTP проверяет, берутся ли строки запроса из JSON API
+func (q Query) IsHTTP() bool {
+	return q.Path != ""
+}
+
+// IsDerived проверяет, вычисляются ли строки запроса по результатам других запросов
+func (q Query) IsDerived() bool {
+	return q.Derived != nil
+}
+
+// Queries список запросов определения отчета
+type Queries []Query
+
+// Value реализует интерфейс driver.Valuer для Queries
+func (q Queries) Value() (driver.Value, error) {
+	if q == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации запросов: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для Queries
+func (q *Queries) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*q = nil
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в Queries", value)
+	}
+
+	var result Queries
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации запросов: %w", err)
+	}
+
+	*q = result
+	return nil
+}
+
+// TableName указывает имя таблицы для модели ReportDefinition
+func (ReportDefinition) TableName() string {
+	return "report_definitions"
+}
+
+// HasTemplate проверяет, генерируется ли отчет по шаблону
+func (d *ReportDefinition) HasTemplate() bool {
+	return d.TemplateKey != ""
+}
+
+// DedupeDuration возвращает срок объединения запусков расписаний, 0 - запуски не объединяются
+func (d *ReportDefinition) DedupeDuration() time.Duration {
+	if d.DedupeWindow == "" {
+		return 0
+	}
+	window, err := time.ParseDuration(d.DedupeWindow)
+	if err != nil || window < 0 {
+		return 0
+	}
+	return window
+}
+
+// Validate валидирует определение отчета
+func (d *ReportDefinition) Validate() error {
+	if errors := d.Problems(); len(errors) > 0 {
+		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
+	}
+	return nil
+}
+
+// Problems возвращает список ошибок валидации определения отчета
+func (d *ReportDefinition) Problems() []string {
+	var errors []string
+
+	if !definitionNamePattern.MatchString(d.Name) {
+		errors = append(errors, "имя определения может содержать только строчные латинские буквы, цифры, '_' и '-'")
+	}
+	if len(d.Name) > 100 {
+		errors = append(errors, "имя определения не может быть длиннее 100 символов")
+	}
+	if len(d.Description) > 1000 {
+		errors = append(errors, "описание не может быть длиннее 1000 символов")
+	}
+	if len(d.TemplateKey) > 255 {
+		errors = append(errors, "ключ шаблона не может быть длиннее 255 символов")
+	}
+
+	if len(d.Queries) == 0 {
+		errors = append(errors, "определение должно содержать хотя бы один запрос")
+	}
+	names := make(map[string]bool, len(d.Queries))
+	hidden := 0
+	for i, query := range d.Queries {
+		if strings.TrimSpace(query.Name) == "" {
+			errors = append(errors, fmt.Sprintf("запрос %d: имя не может быть пустым", i+1))
+		} else if names[query.Name] {
+			errors = append(errors, fmt.Sprintf("запрос %s: имя повторяется", query.Name))
+		}
+		if query.Hidden {
+			hidden++
+		}
+		// Входные наборы проверяются до добавления имени: запрос не может ссылаться на себя
+		if query.IsDerived() {
+			for _, problem := range query.Derived.Validate(names) {
+				errors = append(errors, fmt.Sprintf("запрос %d: %s", i+1, problem))
+			}
+		}
+		names[query.Name] = true
+		if query.IsDerived() {
+			if strings.TrimSpace(query.SQL) != "" || query.Source != "" || query.Path != "" || query.Dataset != "" {
+				errors = append(errors, fmt.Sprintf("запрос %d: для производного набора не задаются SQL, путь API, файл и источник данных", i+1))
+			}
+		} else if query.IsUploaded() {
+			if strings.TrimSpace(query.SQL) != "" || query.Source != "" || query.Path != "" {
+				errors = append(errors, fmt.Sprintf("запрос %d: для загруженного файла не задаются SQL, путь API и источник данных", i+1))
+			}
+			if len(query.Dataset) > 100 {
+				errors = append(errors, fmt.Sprintf("запрос %d: имя параметра набора данных не может быть длиннее 100 символов", i+1))
+			}
+		} else if query.IsHTTP() {
+			if strings.TrimSpace(query.SQL) != "" {
+				errors = append(errors, fmt.Sprintf("запрос %d: для запроса к API не задается SQL", i+1))
+			}
+			if query.Source == "" {
+				errors = append(errors, fmt.Sprintf("запрос %d: для запроса к API требуется источник данных", i+1))
+			}
+			if len(query.Path) > 2000 || len(query.Rows) > 255 {
+				errors = append(errors, fmt.Sprintf("запрос %d: путь запроса не может быть длиннее 2000 символов, путь к строкам - 255", i+1))
+			}
+		} else if strings.TrimSpace(query.SQL) == "" {
+			errors = append(errors, fmt.Sprintf("запрос %d: SQL не может быть пустым", i+1))
+		}
+		if len(query.Source) > 100 {
+			errors = append(errors, fmt.Sprintf("запрос %d: имя источника данных не может быть длиннее 100 символов", i+1))
+		}
+		if query.Sheet != "" && !isValidSheetName(query.Sheet) {
+			errors = append(errors, fmt.Sprintf("запрос %d: %s", i+1, sheetNameRule))
+		}
+	}
+
+	if len(d.Queries) > 0 && hidden == len(d.Queries) {
+		errors = append(errors, "хотя бы один запрос должен выводиться в отчет")
+	}
+
+	if d.Format != "" && !d.Format.IsValid() {
+		errors = append(errors, fmt.Sprintf("неподдерживаемый формат: %s", d.Format))
+	}
+	if d.Format == FormatZIP {
+		errors = append(errors, fmt.Sprintf("формат %s задается отчету вместе с параметром %s", FormatZIP, ParamBundle))
+	}
+	if d.Format.IsTemplated() && !d.HasTemplate() {
+		errors = append(errors, fmt.Sprintf("для формата %s требуется шаблон", d.Format))
+	}
+	if d.HasTemplate() && d.Format != "" && !d.Format.SupportsTemplate() {
+		errors = append(errors, fmt.Sprintf("формат %s не поддерживает шаблоны", d.Format))
+	}
+	if !d.ExcelLayout.IsEmpty() {
+		if d.Format != "" && d.Format != FormatXLSX {
+			errors = append(errors, fmt.Sprintf("оформление Excel не применяется к формату %s", d.Format))
+		}
+		if d.HasTemplate() {
+			errors = append(errors, "оформление Excel не применяется к отчетам по шаблону")
+		}
+		errors = append(errors, d.ExcelLayout.Validate(d.Queries)...)
+	}
+	errors = append(errors, d.ColumnMapping.Validate(d.Queries)...)
+	errors = append(errors, d.Masking.Validate(d.Queries)...)
+	errors = append(errors, d.Iterator.Validate()...)
+	if d.MaxConcurrentRuns < 0 {
+		errors = append(errors, "число одновременных запусков не может быть отрицательным")
+	}
+	if d.DedupeWindow != "" {
+		if window, err := time.ParseDuration(d.DedupeWindow); err != nil || window <= 0 {
+			errors = append(errors, fmt.Sprintf("некорректный срок объединения запусков: %s", d.DedupeWindow))
+		}
+	}
+	errors = append(errors, d.SLA.Validate()...)
+	errors = append(errors, d.NotificationChannels.Validate()...)
+	errors = append(errors, d.Document.Validate()...)
+
+	if strings.TrimSpace(d.CreatedBy) == "" {
+		errors = append(errors, "поле created_by не может быть пустым")
+	}
+	if strings.TrimSpace(d.UpdatedBy) == "" {
+		errors = append(errors, "поле updated_by не может быть пустым")
+	}
+
+	return errors
+}
+
+// BeforeCreate GORM hook, вызывается перед созданием записи
+func (d *ReportDefinition) BeforeCreate(tx *gorm.DB) error {
+	if d.Format == "" {
+		d.Format = DefaultFormat
+		if d.HasTemplate() {
+			d.Format = FormatDOCX
+		}
+	}
+
+	return d.Validate()
+}
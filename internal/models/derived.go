@@ -0,0 +1,148 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DerivedOperation операция производного набора над результатами запросов
+type DerivedOperation string
+
+const (
+	// DerivedJoin соединение двух наборов по колонкам on
+	DerivedJoin DerivedOperation = "join"
+	// DerivedUnion объединение строк наборов, колонки сопоставляются по именам
+	DerivedUnion DerivedOperation = "union"
+	// DerivedGroup группировка строк набора с агрегатами
+	DerivedGroup DerivedOperation = "group"
+)
+
+const (
+	// JoinInner в результат попадают только строки с парой в обоих наборах
+	JoinInner = "inner"
+	// JoinLeft строки первого набора без пары выводятся с пустыми колонками второго
+	JoinLeft = "left"
+)
+
+// aggregateFunctions поддерживаемые агрегатные функции группировки
+var aggregateFunctions = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// Derived производный набор определения: соединение, объединение или группировка результатов
+// предыдущих запросов. Вычисляется в сервисе после выполнения запросов, поэтому может
+// объединять данные из разных источников.
+type Derived struct {
+	Operation DerivedOperation `json:"operation"`
+	// Inputs имена предыдущих запросов: два для join, один для group, два и больше для union
+	Inputs []string `json:"inputs"`
+	// On колонки соединения для join: "customer_id" или "customer_id=id" (колонка первого
+	// набора = колонка второго)
+	On []string `json:"on,omitempty"`
+	// Join тип соединения: inner (по умолчанию) или left
+	Join string `json:"join,omitempty"`
+	// GroupBy колонки группировки для group. Пустой - одна строка с агрегатами по всему набору
+	GroupBy []string `json:"group_by,omitempty"`
+	// Aggregates агрегаты для group
+	Aggregates []Aggregate `json:"aggregates,omitempty"`
+}
+
+// Aggregate агрегат колонки при группировке
+type Aggregate struct {
+	// Function count, sum, avg, min или max
+	Function string `json:"function"`
+	// Column колонка входного набора. Для count может быть пустой - число строк
+	Column string `json:"column,omitempty"`
+	// As имя колонки результата. Пустое - <function>_<column> или count
+	As string `json:"as,omitempty"`
+}
+
+// OutputName возвращает имя колонки результата агрегата
+func (a Aggregate) OutputName() string {
+	if a.As != "" {
+		return a.As
+	}
+	if a.Column == "" {
+		return a.Function
+	}
+	return a.Function + "_" + a.Column
+}
+
+// JoinColumns возвращает пары колонок соединения: колонка первого и второго набора
+func (d *Derived) JoinColumns() [][2]string {
+	pairs := make([][2]string, 0, len(d.On))
+	for _, column := range d.On {
+		left, right, found := strings.Cut(column, "=")
+		left = strings.TrimSpace(left)
+		right = strings.TrimSpace(right)
+		if !found {
+			right = left
+		}
+		pairs = append(pairs, [2]string{left, right})
+	}
+	return pairs
+}
+
+// Validate проверяет производный набор. previous - имена запросов, объявленных раньше
+func (d *Derived) Validate(previous map[string]bool) []string {
+	var errors []string
+
+	for _, input := range d.Inputs {
+		if !previous[input] {
+			errors = append(errors, fmt.Sprintf("входной набор %s должен быть объявлен раньше производного", input))
+		}
+	}
+
+	switch d.Operation {
+	case DerivedJoin:
+		if len(d.Inputs) != 2 {
+			errors = append(errors, "для join задаются два входных набора")
+		}
+		if len(d.On) == 0 {
+			errors = append(errors, "для join не заданы колонки соединения on")
+		}
+		for _, pair := range d.JoinColumns() {
+			if pair[0] == "" || pair[1] == "" {
+				errors = append(errors, "колонка соединения не может быть пустой")
+				break
+			}
+		}
+		if d.Join != "" && d.Join != JoinInner && d.Join != JoinLeft {
+			errors = append(errors, fmt.Sprintf("неподдерживаемый тип соединения %q", d.Join))
+		}
+	case DerivedUnion:
+		if len(d.Inputs) < 2 {
+			errors = append(errors, "для union задаются хотя бы два входных набора")
+		}
+	case DerivedGroup:
+		if len(d.Inputs) != 1 {
+			errors = append(errors, "для group задается один входной набор")
+		}
+		if len(d.GroupBy) == 0 && len(d.Aggregates) == 0 {
+			errors = append(errors, "для group не заданы колонки группировки и агрегаты")
+		}
+		outputs := make(map[string]bool, len(d.GroupBy)+len(d.Aggregates))
+		for _, column := range d.GroupBy {
+			outputs[column] = true
+		}
+		for i, aggregate := range d.Aggregates {
+			if !aggregateFunctions[aggregate.Function] {
+				errors = append(errors, fmt.Sprintf("агрегат %d: неподдерживаемая функция %q", i+1, aggregate.Function))
+			}
+			if aggregate.Column == "" && aggregate.Function != "count" {
+				errors = append(errors, fmt.Sprintf("агрегат %d: не задана колонка", i+1))
+			}
+			if outputs[aggregate.OutputName()] {
+				errors = append(errors, fmt.Sprintf("агрегат %d: колонка %s повторяется", i+1, aggregate.OutputName()))
+			}
+			outputs[aggregate.OutputName()] = true
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("неподдерживаемая операция производного набора %q", d.Operation))
+	}
+	if d.Operation != DerivedJoin && (len(d.On) > 0 || d.Join != "") {
+		errors = append(errors, "колонки соединения задаются только для join")
+	}
+	if d.Operation != DerivedGroup && (len(d.GroupBy) > 0 || len(d.Aggregates) > 0) {
+		errors = append(errors, "группировка и агрегаты задаются только для group")
+	}
+	return errors
+}
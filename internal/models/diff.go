@@ -0,0 +1,43 @@
+package models
+
+// DiffRow строка таблицы отчета: значения по именам колонок. Пустая ячейка - пустая строка
+type DiffRow map[string]string
+
+// DiffField значение колонки, изменившееся между запусками отчета
+type DiffField struct {
+	Column string `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// DiffChange строка, которая есть в обоих запусках, но отличается значениями колонок
+type DiffChange struct {
+	// Key значения ключевых колонок строки
+	Key    DiffRow     `json:"key"`
+	Fields []DiffField `json:"fields"`
+}
+
+// ReportDiff различия таблиц двух готовых отчетов одного определения. Строки сопоставляются
+// по ключевым колонкам: Added - строки, которых нет в базовом отчете OtherID, Removed - строки
+// базового отчета, которых нет в ReportID, Changed - строки с тем же ключом и другими значениями.
+type ReportDiff struct {
+	ReportID   uint     `json:"report_id"`
+	OtherID    uint     `json:"other_id"`
+	KeyColumns []string `json:"key_columns"`
+	// Columns общие колонки обоих отчетов, значения сравниваются только по ним
+	Columns []string `json:"columns"`
+	// AddedColumns и RemovedColumns колонки, которые есть только в одном из отчетов
+	AddedColumns   []string     `json:"added_columns,omitempty"`
+	RemovedColumns []string     `json:"removed_columns,omitempty"`
+	Added          []DiffRow    `json:"added"`
+	Removed        []DiffRow    `json:"removed"`
+	Changed        []DiffChange `json:"changed"`
+	// Unchanged число совпавших строк
+	Unchanged int `json:"unchanged"`
+}
+
+// HasChanges возвращает true, если отчеты различаются строками или колонками
+func (d *ReportDiff) HasChanges() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Changed) > 0 ||
+		len(d.AddedColumns) > 0 || len(d.RemovedColumns) > 0
+}
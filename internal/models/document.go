@@ -0,0 +1,141 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Подстановки в тексте водяного знака
+const (
+	// WatermarkUser автор отчета
+	WatermarkUser = "{user}"
+	// WatermarkDate дата генерации в часовом поясе отчета
+	WatermarkDate = "{date}"
+	// WatermarkTitle название отчета
+	WatermarkTitle = "{title}"
+	// WatermarkClassification гриф документа
+	WatermarkClassification = "{classification}"
+)
+
+// MaxWatermarkLength наибольшая длина текста водяного знака: колонтитул Excel вмещает 255 символов
+const MaxWatermarkLength = 200
+
+// DocumentOptions свойства документа и водяной знак файлов XLSX и DOCX
+type DocumentOptions struct {
+	// Author автор в свойствах документа
+	Author string `json:"author,omitempty"`
+	// Company организация в свойствах документа
+	Company string `json:"company,omitempty"`
+	// Classification гриф документа, например CONFIDENTIAL, записывается в категорию документа
+	Classification string `json:"classification,omitempty"`
+	// Watermark текст водяного знака с подстановками {user}, {date}, {title} и {classification}.
+	// Пустой - водяной знак не ставится
+	Watermark string `json:"watermark,omitempty"`
+}
+
+// IsEmpty проверяет, заданы ли свойства или водяной знак
+func (o *DocumentOptions) IsEmpty() bool {
+	return o == nil || (o.Author == "" && o.Company == "" && o.Classification == "" && o.Watermark == "")
+}
+
+// Merge возвращает параметры, в которых заданные поля overrides заменяют поля o
+func (o *DocumentOptions) Merge(overrides *DocumentOptions) *DocumentOptions {
+	var merged DocumentOptions
+	if o != nil {
+		merged = *o
+	}
+	if overrides != nil {
+		for _, field := range []struct {
+			target *string
+			value  string
+		}{
+			{&merged.Author, overrides.Author},
+			{&merged.Company, overrides.Company},
+			{&merged.Classification, overrides.Classification},
+			{&merged.Watermark, overrides.Watermark},
+		} {
+			if field.value != "" {
+				*field.target = field.value
+			}
+		}
+	}
+	if merged.IsEmpty() {
+		return nil
+	}
+	return &merged
+}
+
+// WatermarkText возвращает текст водяного знака с подставленными автором, датой и названием отчета
+func (o *DocumentOptions) WatermarkText(user, date, title string) string {
+	if o == nil || o.Watermark == "" {
+		return ""
+	}
+	return strings.NewReplacer(
+		WatermarkUser, user,
+		WatermarkDate, date,
+		WatermarkTitle, title,
+		WatermarkClassification, o.Classification,
+	).Replace(o.Watermark)
+}
+
+// Value реализует интерфейс driver.Valuer для DocumentOptions
+func (o DocumentOptions) Value() (driver.Value, error) {
+	if o.IsEmpty() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации свойств документа: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для DocumentOptions
+func (o *DocumentOptions) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*o = DocumentOptions{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в DocumentOptions", value)
+	}
+
+	var result DocumentOptions
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации свойств документа: %w", err)
+	}
+
+	*o = result
+	return nil
+}
+
+// Validate проверяет длину свойств и текста водяного знака
+func (o *DocumentOptions) Validate() []string {
+	if o.IsEmpty() {
+		return nil
+	}
+
+	var errors []string
+	for _, field := range []struct{ name, value string }{
+		{"author", o.Author},
+		{"company", o.Company},
+		{"classification", o.Classification},
+	} {
+		if utf8.RuneCountInString(field.value) > 255 {
+			errors = append(errors, fmt.Sprintf("свойство документа %s длиннее 255 символов", field.name))
+		}
+	}
+	if utf8.RuneCountInString(o.Watermark) > MaxWatermarkLength {
+		errors = append(errors, fmt.Sprintf("текст водяного знака длиннее %d символов", MaxWatermarkLength))
+	}
+	return errors
+}
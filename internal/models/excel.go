@@ -0,0 +1,251 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ExcelReportSheet лист с данными Excel отчета
+const ExcelReportSheet = "Report"
+
+// Типы правил условного форматирования
+const (
+	ExcelConditionCell       = "cell"
+	ExcelConditionColorScale = "color_scale"
+	ExcelConditionDataBar    = "data_bar"
+)
+
+var (
+	// excelColorPattern цвет в формате #RRGGBB
+	excelColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+	// excelCellOperators операторы сравнения правила типа cell
+	excelCellOperators = map[string]bool{
+		">": true, ">=": true, "<": true, "<=": true, "==": true, "!=": true,
+		"between": true, "not between": true,
+	}
+
+	// excelPivotFunctions функции агрегации значений сводной таблицы и итогов колонок
+	excelPivotFunctions = map[string]bool{
+		"sum": true, "count": true, "average": true, "max": true, "min": true,
+	}
+)
+
+// ExcelLayout оформление Excel отчета по определению: форматы колонок,
+// условное форматирование, закрепление заголовка, строки итогов и сводные таблицы.
+// Колонки указываются по именам из результатов запросов.
+type ExcelLayout struct {
+	// FreezeHeader закрепляет строку заголовков при прокрутке
+	FreezeHeader       bool                     `json:"freeze_header,omitempty"`
+	Columns            []ExcelColumn            `json:"columns,omitempty"`
+	ConditionalFormats []ExcelConditionalFormat `json:"conditional_formats,omitempty"`
+	PivotTables        []ExcelPivotTable        `json:"pivot_tables,omitempty"`
+	// Totals итоги колонок в строке "Итого" после данных каждого набора с этими колонками
+	Totals []ExcelTotal `json:"totals,omitempty"`
+}
+
+// ExcelColumn формат колонки
+type ExcelColumn struct {
+	Name string `json:"name"`
+	// NumberFormat формат чисел и дат Excel, например "#,##0.00" или "dd.mm.yyyy"
+	NumberFormat string  `json:"number_format,omitempty"`
+	Width        float64 `json:"width,omitempty"`
+}
+
+// ExcelConditionalFormat правило условного форматирования колонки.
+// Правило cell выделяет ячейки по сравнению со значением, color_scale
+// закрашивает ячейки градиентом от минимума к максимуму, data_bar выводит гистограмму в ячейках.
+type ExcelConditionalFormat struct {
+	Column string `json:"column"`
+	Type   string `json:"type,omitempty"`
+	// Operator, Value и MaxValue условие правила cell. Value - число или формула Excel,
+	// MaxValue - верхняя граница для between и not between
+	Operator  string `json:"operator,omitempty"`
+	Value     string `json:"value,omitempty"`
+	MaxValue  string `json:"max_value,omitempty"`
+	Fill      string `json:"fill,omitempty"`
+	FontColor string `json:"font_color,omitempty"`
+	Bold      bool   `json:"bold,omitempty"`
+	// MinColor и MaxColor цвета color_scale, BarColor цвет data_bar
+	MinColor string `json:"min_color,omitempty"`
+	MaxColor string `json:"max_color,omitempty"`
+	BarColor string `json:"bar_color,omitempty"`
+}
+
+// ExcelPivotTable сводная таблица на отдельном листе по данным одного запроса
+type ExcelPivotTable struct {
+	// Name имя листа сводной таблицы
+	Name string `json:"name"`
+	// Dataset имя запроса определения. Пустое - первый запрос
+	Dataset string            `json:"dataset,omitempty"`
+	Rows    []string          `json:"rows"`
+	Columns []string          `json:"columns,omitempty"`
+	Values  []ExcelPivotValue `json:"values"`
+}
+
+// ExcelPivotValue агрегируемая колонка сводной таблицы
+type ExcelPivotValue struct {
+	Column string `json:"column"`
+	// Function sum (по умолчанию), count, average, max или min
+	Function string `json:"function,omitempty"`
+}
+
+// ExcelTotal итог колонки. В ячейку записывается формула Excel по строкам данных набора,
+// включая его продолжение на других листах.
+type ExcelTotal struct {
+	Column string `json:"column"`
+	// Function sum (по умолчанию), count, average, max или min
+	Function string `json:"function,omitempty"`
+}
+
+// IsEmpty проверяет, задано ли оформление
+func (l *ExcelLayout) IsEmpty() bool {
+	return l == nil || (!l.FreezeHeader && len(l.Columns) == 0 &&
+		len(l.ConditionalFormats) == 0 && len(l.PivotTables) == 0 && len(l.Totals) == 0)
+}
+
+// Value реализует интерфейс driver.Valuer для ExcelLayout
+func (l ExcelLayout) Value() (driver.Value, error) {
+	if l.IsEmpty() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации оформления Excel: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для ExcelLayout
+func (l *ExcelLayout) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*l = ExcelLayout{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в ExcelLayout", value)
+	}
+
+	var result ExcelLayout
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации оформления Excel: %w", err)
+	}
+
+	*l = result
+	return nil
+}
+
+// Validate проверяет оформление по запросам определения
+func (l *ExcelLayout) Validate(queries Queries) []string {
+	if l.IsEmpty() {
+		return nil
+	}
+
+	var errors []string
+	for i, column := range l.Columns {
+		if strings.TrimSpace(column.Name) == "" {
+			errors = append(errors, fmt.Sprintf("колонка %d: имя не может быть пустым", i+1))
+		}
+		if len(column.NumberFormat) > 255 {
+			errors = append(errors, fmt.Sprintf("колонка %s: формат не может быть длиннее 255 символов", column.Name))
+		}
+		if column.Width < 0 || column.Width > 255 {
+			errors = append(errors, fmt.Sprintf("колонка %s: ширина должна быть от 0 до 255", column.Name))
+		}
+	}
+
+	for i, rule := range l.ConditionalFormats {
+		prefix := fmt.Sprintf("условное форматирование %d", i+1)
+		if strings.TrimSpace(rule.Column) == "" {
+			errors = append(errors, prefix+": не задана колонка")
+		}
+		switch rule.Type {
+		case "", ExcelConditionCell:
+			if !excelCellOperators[rule.Operator] {
+				errors = append(errors, fmt.Sprintf("%s: неподдерживаемый оператор %q", prefix, rule.Operator))
+			}
+			if rule.Value == "" {
+				errors = append(errors, prefix+": не задано значение")
+			}
+			if strings.HasSuffix(rule.Operator, "between") && rule.MaxValue == "" {
+				errors = append(errors, prefix+": для between требуется max_value")
+			}
+			if rule.Fill == "" && rule.FontColor == "" && !rule.Bold {
+				errors = append(errors, prefix+": не задано оформление ячеек")
+			}
+		case ExcelConditionColorScale, ExcelConditionDataBar:
+		default:
+			errors = append(errors, fmt.Sprintf("%s: неподдерживаемый тип %q", prefix, rule.Type))
+		}
+		for _, color := range []string{rule.Fill, rule.FontColor, rule.MinColor, rule.MaxColor, rule.BarColor} {
+			if color != "" && !excelColorPattern.MatchString(color) {
+				errors = append(errors, fmt.Sprintf("%s: цвет %q должен быть в формате #RRGGBB", prefix, color))
+			}
+		}
+	}
+
+	for i, total := range l.Totals {
+		prefix := fmt.Sprintf("итог %d", i+1)
+		if strings.TrimSpace(total.Column) == "" {
+			errors = append(errors, prefix+": не задана колонка")
+		}
+		if total.Function != "" && !excelPivotFunctions[total.Function] {
+			errors = append(errors, fmt.Sprintf("%s: неподдерживаемая функция %q", prefix, total.Function))
+		}
+	}
+
+	// Листы сводных таблиц не должны совпадать с листами данных, имена листов Excel не зависят от регистра
+	sheets := map[string]bool{strings.ToLower(ExcelReportSheet): true}
+	datasets := make(map[string]bool, len(queries))
+	for _, query := range queries {
+		sheets[strings.ToLower(query.SheetName())] = true
+		datasets[query.Name] = true
+	}
+	for i, pivot := range l.PivotTables {
+		prefix := fmt.Sprintf("сводная таблица %d", i+1)
+		switch {
+		case !isValidSheetName(pivot.Name):
+			errors = append(errors, prefix+": "+sheetNameRule)
+		case sheets[strings.ToLower(pivot.Name)]:
+			errors = append(errors, fmt.Sprintf("%s: лист %s уже существует", prefix, pivot.Name))
+		}
+		sheets[strings.ToLower(pivot.Name)] = true
+
+		if pivot.Dataset != "" && !datasets[pivot.Dataset] {
+			errors = append(errors, fmt.Sprintf("%s: неизвестный запрос %s", prefix, pivot.Dataset))
+		}
+		if len(pivot.Rows) == 0 {
+			errors = append(errors, prefix+": не заданы колонки строк")
+		}
+		if len(pivot.Values) == 0 {
+			errors = append(errors, prefix+": не заданы значения")
+		}
+		for _, value := range pivot.Values {
+			if strings.TrimSpace(value.Column) == "" {
+				errors = append(errors, prefix+": не задана колонка значения")
+			}
+			if value.Function != "" && !excelPivotFunctions[value.Function] {
+				errors = append(errors, fmt.Sprintf("%s: неподдерживаемая функция %q", prefix, value.Function))
+			}
+		}
+	}
+
+	return errors
+}
+
+// sheetNameRule требования к имени листа Excel
+const sheetNameRule = `имя листа должно содержать от 1 до 31 символа без []:*?/\!'`
+
+// isValidSheetName проверяет имя листа Excel
+func isValidSheetName(name string) bool {
+	return strings.TrimSpace(name) != "" && len([]rune(name)) <= 31 && !strings.ContainsAny(name, `[]:*?/\!'`)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Iterator итерационный запрос определения отчета, например SELECT id AS branch_id FROM branches.
+// Расписание с таким определением при каждом запуске создает по отчету на строку результата:
+// значения колонок строки подставляются в параметры отчета по именам колонок, значение
+// первой колонки добавляется к заголовку отчета.
+type Iterator struct {
+	SQL string `json:"sql"`
+	// Source имя источника данных из конфигурации. Пустое - основная база данных
+	Source string `json:"source,omitempty"`
+}
+
+// IsEmpty проверяет, задан ли итерационный запрос
+func (i *Iterator) IsEmpty() bool {
+	return i == nil || (strings.TrimSpace(i.SQL) == "" && i.Source == "")
+}
+
+// Value реализует интерфейс driver.Valuer для Iterator
+func (i Iterator) Value() (driver.Value, error) {
+	if i.IsEmpty() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(i)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации итерационного запроса: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для Iterator
+func (i *Iterator) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*i = Iterator{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в Iterator", value)
+	}
+
+	var result Iterator
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации итерационного запроса: %w", err)
+	}
+
+	*i = result
+	return nil
+}
+
+// Validate проверяет поля итерационного запроса
+func (i *Iterator) Validate() []string {
+	if i.IsEmpty() {
+		return nil
+	}
+
+	var errors []string
+	if strings.TrimSpace(i.SQL) == "" {
+		errors = append(errors, "итерационный запрос: SQL не может быть пустым")
+	}
+	if len(i.Source) > 100 {
+		errors = append(errors, "итерационный запрос: имя источника данных не может быть длиннее 100 символов")
+	}
+	return errors
+}
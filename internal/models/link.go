@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReportLink публичная ссылка на скачивание файла отчета без аутентификации.
+// Хранится только SHA-256 токена ссылки, сам токен возвращается один раз при создании.
+type ReportLink struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ReportID  uint           `json:"report_id" gorm:"not null;index"`
+	Prefix    string         `json:"prefix" gorm:"size:16;not null"`
+	TokenHash string         `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time      `json:"expires_at" gorm:"not null"`
+	// MaxDownloads число скачиваний по ссылке, nil - без ограничения
+	MaxDownloads     *int       `json:"max_downloads,omitempty"`
+	Downloads        int        `json:"downloads" gorm:"not null;default:0"`
+	LastDownloadedAt *time.Time `json:"last_downloaded_at,omitempty"`
+	CreatedBy        string     `json:"created_by" gorm:"size:255;not null"`
+}
+
+// TableName указывает имя таблицы для модели ReportLink
+func (ReportLink) TableName() string {
+	return "report_links"
+}
+
+// IsExpired возвращает true, если срок действия ссылки истек
+func (l *ReportLink) IsExpired(now time.Time) bool {
+	return !l.ExpiresAt.After(now)
+}
+
+// IsExhausted возвращает true, если скачивания по ссылке закончились
+func (l *ReportLink) IsExhausted() bool {
+	return l.MaxDownloads != nil && l.Downloads >= *l.MaxDownloads
+}
+
+// Validate валидирует ссылку
+func (l *ReportLink) Validate() error {
+	var errors []string
+
+	if l.ReportID == 0 {
+		errors = append(errors, "не указан отчет")
+	}
+	if l.ExpiresAt.IsZero() {
+		errors = append(errors, "не указан срок действия ссылки")
+	}
+	if l.MaxDownloads != nil && *l.MaxDownloads <= 0 {
+		errors = append(errors, "число скачиваний должно быть положительным")
+	}
+	if strings.TrimSpace(l.CreatedBy) == "" {
+		errors = append(errors, "поле created_by не может быть пустым")
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
+	}
+
+	return nil
+}
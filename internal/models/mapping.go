@@ -0,0 +1,157 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"report_srv/internal/query"
+
+	"golang.org/x/text/language"
+)
+
+// Форматы значений колонок
+const (
+	ColumnFormatNumber   = "number"
+	ColumnFormatInteger  = "integer"
+	ColumnFormatPercent  = "percent"
+	ColumnFormatDate     = "date"
+	ColumnFormatDateTime = "datetime"
+)
+
+// columnFormats поддерживаемые форматы значений колонок
+var columnFormats = map[string]bool{
+	ColumnFormatNumber: true, ColumnFormatInteger: true, ColumnFormatPercent: true,
+	ColumnFormatDate: true, ColumnFormatDateTime: true,
+}
+
+// maxColumnDecimals наибольшее число знаков после запятой
+const maxColumnDecimals = 10
+
+// ColumnMapping преобразование результатов запросов перед выводом в файл: переименование
+// колонок, форматирование чисел и дат по локали, маскирование и вычисляемые колонки.
+// Применяется ко всем форматам и шаблонам.
+type ColumnMapping struct {
+	// Locale локаль форматирования чисел и дат, например ru или en-US. Пустая - без разделителей
+	// разрядов, даты в ISO 8601
+	Locale  string            `json:"locale,omitempty"`
+	Columns []ColumnTransform `json:"columns,omitempty"`
+}
+
+// ColumnTransform преобразование колонки результата запроса
+type ColumnTransform struct {
+	// Query имя запроса определения. Пустое - колонка всех запросов
+	Query string `json:"query,omitempty"`
+	// Column колонка результата запроса или имя вычисляемой колонки
+	Column string `json:"column"`
+	// Rename заголовок колонки в файле и имя колонки в шаблоне
+	Rename string `json:"rename,omitempty"`
+	// Format number, integer, percent, date или datetime. Отформатированное значение выводится строкой
+	Format string `json:"format,omitempty"`
+	// Decimals знаков после запятой для number и percent, по умолчанию 2
+	Decimals *int `json:"decimals,omitempty"`
+	// Mask заменяет значение звездочками, оставляя последние 4 символа
+	Mask bool `json:"mask,omitempty"`
+	// Expression выражение вычисляемой колонки над колонками строки, например amount * price.
+	// Колонка с именем существующей заменяет ее значение, иначе добавляется в конец.
+	Expression string `json:"expression,omitempty"`
+}
+
+// OutputName возвращает заголовок колонки после преобразования
+func (t ColumnTransform) OutputName() string {
+	if t.Rename != "" {
+		return t.Rename
+	}
+	return t.Column
+}
+
+// AppliesTo проверяет, относится ли преобразование к запросу
+func (t ColumnTransform) AppliesTo(queryName string) bool {
+	return t.Query == "" || t.Query == queryName
+}
+
+// IsEmpty проверяет, заданы ли преобразования
+func (m *ColumnMapping) IsEmpty() bool {
+	return m == nil || (m.Locale == "" && len(m.Columns) == 0)
+}
+
+// Value реализует интерфейс driver.Valuer для ColumnMapping
+func (m ColumnMapping) Value() (driver.Value, error) {
+	if m.IsEmpty() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации преобразования колонок: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для ColumnMapping
+func (m *ColumnMapping) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*m = ColumnMapping{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в ColumnMapping", value)
+	}
+
+	var result ColumnMapping
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации преобразования колонок: %w", err)
+	}
+
+	*m = result
+	return nil
+}
+
+// Validate проверяет преобразование колонок по запросам определения
+func (m *ColumnMapping) Validate(queries Queries) []string {
+	if m.IsEmpty() {
+		return nil
+	}
+
+	var errors []string
+	if m.Locale != "" {
+		if _, err := language.Parse(m.Locale); err != nil {
+			errors = append(errors, fmt.Sprintf("неизвестная локаль %q", m.Locale))
+		}
+	}
+
+	names := make(map[string]bool, len(queries))
+	for _, definitionQuery := range queries {
+		names[definitionQuery.Name] = true
+	}
+	for i, transform := range m.Columns {
+		prefix := fmt.Sprintf("преобразование колонки %d", i+1)
+		if strings.TrimSpace(transform.Column) == "" {
+			errors = append(errors, prefix+": не задана колонка")
+		}
+		if transform.Query != "" && !names[transform.Query] {
+			errors = append(errors, fmt.Sprintf("%s: неизвестный запрос %s", prefix, transform.Query))
+		}
+		if transform.Format != "" && !columnFormats[transform.Format] {
+			errors = append(errors, fmt.Sprintf("%s: неподдерживаемый формат %q", prefix, transform.Format))
+		}
+		if transform.Decimals != nil && (*transform.Decimals < 0 || *transform.Decimals > maxColumnDecimals) {
+			errors = append(errors, fmt.Sprintf("%s: число знаков после запятой должно быть от 0 до %d", prefix, maxColumnDecimals))
+		}
+		if len(transform.OutputName()) > 255 {
+			errors = append(errors, prefix+": имя колонки не может быть длиннее 255 символов")
+		}
+		if transform.Expression != "" {
+			if _, err := query.ParseExpression(transform.Expression); err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %v", prefix, err))
+			}
+		}
+	}
+	return errors
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Способы маскирования чувствительных колонок
+const (
+	// MaskingMethodMask заменяет значение звездочками, оставляя последние 4 символа
+	MaskingMethodMask = "mask"
+	// MaskingMethodHash заменяет значение хешем: одинаковые значения остаются одинаковыми
+	MaskingMethodHash = "hash"
+)
+
+// MaskingRule правило маскирования персональных данных: колонки с подходящим именем
+// маскируются в файлах отчетов, если у автора отчета нет области pii:unmasked
+type MaskingRule struct {
+	// Query имя запроса определения. Пустое - колонки всех запросов
+	Query string `json:"query,omitempty"`
+	// Column имя колонки без учета регистра
+	Column string `json:"column,omitempty"`
+	// Pattern регулярное выражение для имени колонки без учета регистра, например ^(email|phone)$
+	Pattern string `json:"pattern,omitempty"`
+	// Method mask (по умолчанию) или hash
+	Method string `json:"method,omitempty"`
+}
+
+// MaskingMethod возвращает способ маскирования с учетом значения по умолчанию
+func (r MaskingRule) MaskingMethod() string {
+	if r.Method == "" {
+		return MaskingMethodMask
+	}
+	return r.Method
+}
+
+// Matches проверяет, относится ли правило к колонке запроса. Колонка сравнивается
+// по исходному имени и по заголовку после переименования.
+func (r MaskingRule) Matches(queryName string, names ...string) bool {
+	if r.Query != "" && r.Query != queryName {
+		return false
+	}
+	var pattern *regexp.Regexp
+	if r.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile("(?i)" + r.Pattern); err != nil {
+			return false
+		}
+	}
+	for _, name := range names {
+		if r.Column != "" && strings.EqualFold(r.Column, name) || pattern != nil && pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Problem возвращает описание ошибки правила или пустую строку
+func (r MaskingRule) Problem() string {
+	if (r.Column == "") == (r.Pattern == "") {
+		return "нужно задать одно из полей column или pattern"
+	}
+	if r.Pattern != "" {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Sprintf("неверное регулярное выражение %q: %v", r.Pattern, err)
+		}
+	}
+	if method := r.MaskingMethod(); method != MaskingMethodMask && method != MaskingMethodHash {
+		return fmt.Sprintf("неподдерживаемый способ маскирования %q", r.Method)
+	}
+	return ""
+}
+
+// MaskingRules правила маскирования определения отчета, хранятся в JSON
+type MaskingRules []MaskingRule
+
+// Value реализует интерфейс driver.Valuer для MaskingRules
+func (r MaskingRules) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации правил маскирования: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для MaskingRules
+func (r *MaskingRules) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в MaskingRules", value)
+	}
+
+	var result MaskingRules
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации правил маскирования: %w", err)
+	}
+
+	*r = result
+	return nil
+}
+
+// Validate проверяет правила маскирования по запросам определения
+func (r MaskingRules) Validate(queries Queries) []string {
+	names := make(map[string]bool, len(queries))
+	for _, definitionQuery := range queries {
+		names[definitionQuery.Name] = true
+	}
+
+	var errors []string
+	for i, rule := range r {
+		prefix := fmt.Sprintf("правило маскирования %d", i+1)
+		if problem := rule.Problem(); problem != "" {
+			errors = append(errors, prefix+": "+problem)
+		}
+		if rule.Query != "" && !names[rule.Query] {
+			errors = append(errors, fmt.Sprintf("%s: неизвестный запрос %s", prefix, rule.Query))
+		}
+	}
+	return errors
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Notification уведомление пользователя о событии его отчета для ленты в интерфейсе:
+// отчет готов, генерация завершилась ошибкой
+type Notification struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	// Recipient пользователь, которому адресовано уведомление, - автор отчета
+	Recipient string `json:"-" gorm:"size:255;not null;index"`
+	// Type тип события отчета, например report.completed
+	Type     string `json:"type" gorm:"size:50;not null"`
+	ReportID uint   `json:"report_id" gorm:"not null"`
+	Title    string `json:"title" gorm:"size:255;not null"`
+	Message  string `json:"message" gorm:"size:1000"`
+	// ReadAt когда пользователь прочитал уведомление, nil - не прочитано
+	ReadAt *time.Time `json:"read_at,omitempty"`
+}
+
+// TableName указывает имя таблицы для модели Notification
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+// IsRead возвращает true, если уведомление прочитано
+func (n *Notification) IsRead() bool {
+	return n.ReadAt != nil
+}
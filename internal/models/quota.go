@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Quota лимиты отдельного пользователя. Незаданный лимит берется из общих настроек,
+// 0 - без ограничения.
+type Quota struct {
+	ID               uint      `json:"id" gorm:"primarykey"`
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt        time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	Subject          string    `json:"subject" gorm:"size:255;not null;uniqueIndex"`
+	MaxConcurrent    *int      `json:"max_concurrent,omitempty"`
+	MaxReportsPerDay *int      `json:"max_reports_per_day,omitempty"`
+	MaxStoredBytes   *int64    `json:"max_stored_bytes,omitempty"`
+	UpdatedBy        string    `json:"updated_by" gorm:"size:255;not null"`
+}
+
+// TableName указывает имя таблицы для модели Quota
+func (Quota) TableName() string {
+	return "quotas"
+}
+
+// Validate валидирует лимиты пользователя
+func (q *Quota) Validate() error {
+	var errors []string
+
+	if strings.TrimSpace(q.Subject) == "" {
+		errors = append(errors, "пользователь не может быть пустым")
+	}
+	if len(q.Subject) > 255 {
+		errors = append(errors, "пользователь не может быть длиннее 255 символов")
+	}
+	if q.MaxConcurrent != nil && *q.MaxConcurrent < 0 {
+		errors = append(errors, "лимит одновременных отчетов не может быть отрицательным")
+	}
+	if q.MaxReportsPerDay != nil && *q.MaxReportsPerDay < 0 {
+		errors = append(errors, "лимит отчетов в сутки не может быть отрицательным")
+	}
+	if q.MaxStoredBytes != nil && *q.MaxStoredBytes < 0 {
+		errors = append(errors, "лимит размера файлов не может быть отрицательным")
+	}
+	if strings.TrimSpace(q.UpdatedBy) == "" {
+		errors = append(errors, "поле updated_by не может быть пустым")
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ReportRendition файл готового отчета в другом формате, построенный по снимку данных
+// без повторного выполнения запросов. У отчета не больше одного файла каждого формата.
+type ReportRendition struct {
+	ID        uint         `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time    `json:"created_at" gorm:"autoCreateTime"`
+	ReportID  uint         `json:"report_id" gorm:"not null;uniqueIndex:idx_report_renditions_format"`
+	Format    ReportFormat `json:"format" gorm:"size:20;not null;uniqueIndex:idx_report_renditions_format"`
+	Size      int64        `json:"size" gorm:"not null;default:0"`
+	// Checksum SHA-256 файла в hex, проверяется при скачивании
+	Checksum  string `json:"checksum" gorm:"size:64"`
+	FileKey   string `json:"-" gorm:"size:512;not null"`
+	CreatedBy string `json:"created_by" gorm:"size:255;not null"`
+}
+
+// TableName указывает имя таблицы для модели ReportRendition
+func (ReportRendition) TableName() string {
+	return "report_renditions"
+}
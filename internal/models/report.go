@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"golang.org/x/text/language"
 	"gorm.io/gorm"
 )
 
@@ -24,6 +27,8 @@ const (
 	StatusFailed ReportStatus = "failed"
 	// StatusCanceled отчет отменен
 	StatusCanceled ReportStatus = "canceled"
+	// StatusExpired срок хранения отчета истек, файл удален
+	StatusExpired ReportStatus = "expired"
 )
 
 // String возвращает строковое представление статуса
@@ -34,7 +39,7 @@ func (s ReportStatus) String() string {
 // IsValid проверяет валидность статуса
 func (s ReportStatus) IsValid() bool {
 	switch s {
-	case StatusPending, StatusProcessing, StatusCompleted, StatusFailed, StatusCanceled:
+	case StatusPending, StatusProcessing, StatusCompleted, StatusFailed, StatusCanceled, StatusExpired:
 		return true
 	default:
 		return false
@@ -43,7 +48,7 @@ func (s ReportStatus) IsValid() bool {
 
 // IsFinal возвращает true для финальных статусов
 func (s ReportStatus) IsFinal() bool {
-	return s == StatusCompleted || s == StatusFailed || s == StatusCanceled
+	return s == StatusCompleted || s == StatusFailed || s == StatusCanceled || s == StatusExpired
 }
 
 // CanTransitionTo проверяет возможность перехода к новому статусу
@@ -54,6 +59,7 @@ func (s ReportStatus) CanTransitionTo(newStatus ReportStatus) bool {
 		StatusCompleted:  {},              // финальный статус
 		StatusFailed:     {StatusPending}, // можно попробовать снова
 		StatusCanceled:   {StatusPending}, // можно возобновить
+		StatusExpired:    {},              // выставляется только очисткой по сроку хранения
 	}
 
 	allowedTransitions, exists := transitions[s]
@@ -69,6 +75,220 @@ func (s ReportStatus) CanTransitionTo(newStatus ReportStatus) bool {
 	return false
 }
 
+// ReportFormat формат выходного файла отчета
+type ReportFormat string
+
+const (
+	// FormatXLSX отчет в формате Excel
+	FormatXLSX ReportFormat = "xlsx"
+	// FormatCSV отчет в формате CSV
+	FormatCSV ReportFormat = "csv"
+	// FormatDOCX документ Word, заполненный по шаблону определения отчета
+	FormatDOCX ReportFormat = "docx"
+	// FormatHTML самостоятельная HTML страница для просмотра в браузере
+	FormatHTML ReportFormat = "html"
+	// FormatJSON строки результата запросов массивом JSON объектов
+	FormatJSON ReportFormat = "json"
+	// FormatNDJSON строки результата запросов по JSON объекту в строке
+	FormatNDJSON ReportFormat = "ndjson"
+	// FormatZIP ZIP архив с файлами нескольких форматов из параметра bundle
+	FormatZIP ReportFormat = "zip"
+
+	// DefaultFormat формат отчета по умолчанию
+	DefaultFormat = FormatXLSX
+)
+
+// String возвращает строковое представление формата
+func (f ReportFormat) String() string {
+	return string(f)
+}
+
+// registeredFormats форматы, добавленные генераторами вне встроенного списка
+var registeredFormats sync.Map
+
+// RegisterFormat добавляет формат в список поддерживаемых. Вызывается при регистрации генератора формата
+func RegisterFormat(format ReportFormat) {
+	registeredFormats.Store(format, true)
+}
+
+// IsValid проверяет, поддерживается ли формат
+func (f ReportFormat) IsValid() bool {
+	switch f {
+	case FormatXLSX, FormatCSV, FormatDOCX, FormatHTML, FormatJSON, FormatNDJSON, FormatZIP:
+		return true
+	default:
+		_, registered := registeredFormats.Load(f)
+		return registered
+	}
+}
+
+// IsTemplated возвращает true для форматов, которые генерируются только по шаблону
+func (f ReportFormat) IsTemplated() bool {
+	return f == FormatDOCX
+}
+
+// SupportsTemplate возвращает true для форматов, которые можно генерировать по шаблону
+func (f ReportFormat) SupportsTemplate() bool {
+	return f == FormatDOCX || f == FormatXLSX
+}
+
+// IsCompressed возвращает true для форматов, файлы которых уже сжаты (ZIP контейнеры)
+func (f ReportFormat) IsCompressed() bool {
+	return f == FormatDOCX || f == FormatXLSX || f == FormatZIP
+}
+
+// SupportsPassword проверяет, можно ли зашифровать файл формата паролем
+func (f ReportFormat) SupportsPassword() bool {
+	return f == FormatDOCX || f == FormatXLSX || f == FormatZIP
+}
+
+// Compression сжатие файла отчета перед сохранением в хранилище
+type Compression string
+
+const (
+	// CompressionNone файл сохраняется без сжатия
+	CompressionNone Compression = "none"
+	// CompressionGzip файл сжимается gzip и отдается с Content-Encoding: gzip
+	CompressionGzip Compression = "gzip"
+	// CompressionZip файл упаковывается в ZIP архив
+	CompressionZip Compression = "zip"
+)
+
+// String возвращает строковое представление сжатия
+func (c Compression) String() string {
+	return string(c)
+}
+
+// IsValid проверяет, поддерживается ли сжатие
+func (c Compression) IsValid() bool {
+	switch c {
+	case CompressionNone, CompressionGzip, CompressionZip:
+		return true
+	default:
+		return false
+	}
+}
+
+// Extension возвращает расширение сжатого файла с исходным расширением extension
+func (c Compression) Extension(extension string) string {
+	switch c {
+	case CompressionGzip:
+		return extension + ".gz"
+	case CompressionZip:
+		return "zip"
+	default:
+		return extension
+	}
+}
+
+// DeliveryStatus статус доставки готового отчета получателям
+type DeliveryStatus string
+
+const (
+	// DeliverySent отчет отправлен получателям
+	DeliverySent DeliveryStatus = "sent"
+	// DeliveryFailed ошибка отправки отчета
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// String возвращает строковое представление статуса доставки
+func (s DeliveryStatus) String() string {
+	return string(s)
+}
+
+// ReportQueue положение отчета в очереди и оценка времени его готовности
+type ReportQueue struct {
+	// Position номер отчета в очереди начиная с 1, 0 - отчет генерируется
+	Position int64 `json:"position"`
+	// EstimatedDuration ожидаемая длительность генерации отчета в секундах по недавним
+	// отчетам того же определения. 0 - истории генерации нет
+	EstimatedDuration float64 `json:"estimated_duration_seconds,omitempty"`
+	// EstimatedCompletionAt ожидаемое время готовности отчета. Пустое - истории генерации нет
+	EstimatedCompletionAt *time.Time `json:"estimated_completion_at,omitempty"`
+}
+
+// ReportPriority приоритет генерации отчета в очереди фонового процессора
+type ReportPriority string
+
+const (
+	// PriorityLow отчет генерируется, когда нет задач выше по приоритету
+	PriorityLow ReportPriority = "low"
+	// PriorityNormal приоритет по умолчанию
+	PriorityNormal ReportPriority = "normal"
+	// PriorityHigh отчет может выполняться обработчиками, зарезервированными для срочных задач
+	PriorityHigh ReportPriority = "high"
+	// PriorityCritical отчет выполняется раньше всех остальных
+	PriorityCritical ReportPriority = "critical"
+)
+
+// IsValid проверяет, является ли приоритет допустимым
+func (p ReportPriority) IsValid() bool {
+	switch p {
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityCritical:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReportErrorCode причина ошибки генерации отчета
+type ReportErrorCode string
+
+const (
+	// ErrorCodeQuery ошибка SQL запроса или подключения к источнику данных
+	ErrorCodeQuery ReportErrorCode = "query_error"
+	// ErrorCodeTemplate шаблон отчета не найден или не заполняется
+	ErrorCodeTemplate ReportErrorCode = "template_error"
+	// ErrorCodeGeneration ошибка формирования файла отчета
+	ErrorCodeGeneration ReportErrorCode = "generation_error"
+	// ErrorCodeStorage ошибка сохранения файла в хранилище
+	ErrorCodeStorage ReportErrorCode = "storage_error"
+	// ErrorCodeTimeout генерация не уложилась в отведенное время
+	ErrorCodeTimeout ReportErrorCode = "timeout"
+	// ErrorCodeInternal внутренняя ошибка сервиса
+	ErrorCodeInternal ReportErrorCode = "internal_error"
+)
+
+// String возвращает строковое представление кода ошибки
+func (c ReportErrorCode) String() string {
+	return string(c)
+}
+
+const (
+	// ParamEmailRecipients параметр отчета со списком адресов для рассылки
+	ParamEmailRecipients = "email_recipients"
+	// ParamRetentionTTL параметр отчета со сроком хранения готового файла
+	// в формате длительности Go (например, "72h"). "0" - хранить бессрочно
+	ParamRetentionTTL = "retention_ttl"
+	// ParamHTMLChart параметр отчета с настройками диаграммы HTML отчета
+	ParamHTMLChart = "html_chart"
+	// ParamCompression параметр отчета со сжатием файла: none, gzip или zip
+	ParamCompression = "compression"
+	// ParamLocale параметр отчета с локалью файла, например ru или ar-EG
+	ParamLocale = "locale"
+	// ParamBundle параметр отчета со списком форматов файлов ZIP архива, например ["xlsx", "csv"]
+	ParamBundle = "bundle"
+	// ParamDataset параметр отчета без определения с ID загруженного файла с данными
+	ParamDataset = "dataset_id"
+	// ParamSnapshot параметр отчета: true - сохранить снимок данных рядом с файлом, false - не сохранять
+	ParamSnapshot = "snapshot"
+	// ParamNotificationChannels параметр отчета со списком каналов Slack и Microsoft Teams,
+	// в которые сообщается о готовности или ошибке отчета, в дополнение к каналам определения
+	ParamNotificationChannels = "notification_channels"
+	// ParamTimezone параметр отчета с часовым поясом IANA, например Europe/Moscow, в котором
+	// выводятся даты создания и генерации в файле
+	ParamTimezone = "timezone"
+	// ParamPassword параметр отчета с паролем файла: строка - пароль, true - сгенерировать пароль.
+	// При создании отчета переносится из параметров в FilePassword
+	ParamPassword = "password"
+)
+
+// Ограничения длины пароля файла отчета
+const (
+	MinFilePasswordLength = 8
+	MaxFilePasswordLength = 128
+)
+
 // ReportEntity интерфейс для работы с отчетами
 type ReportEntity interface {
 	GetID() uint
@@ -101,12 +321,78 @@ type Report struct {
 	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 	Title       string         `json:"title" gorm:"size:255;not null" validate:"required,min=1,max=255"`
 	Description string         `json:"description" gorm:"size:1000" validate:"max=1000"`
+	Type        string         `json:"type,omitempty" gorm:"size:100;index"`
 	Status      ReportStatus   `json:"status" gorm:"size:50;not null;default:'pending'" validate:"required"`
+	Format      ReportFormat   `json:"format" gorm:"size:20;not null;default:'xlsx'"`
 	FileKey     string         `json:"file_key,omitempty" gorm:"size:255" validate:"max=255"`
-	GeneratedAt *time.Time     `json:"generated_at,omitempty"`
-	Parameters  JSON           `json:"parameters,omitempty" gorm:"type:jsonb"`
-	CreatedBy   string         `json:"created_by" gorm:"size:255;not null" validate:"required,min=1,max=255"`
-	UpdatedBy   string         `json:"updated_by" gorm:"size:255;not null" validate:"required,min=1,max=255"`
+	// Priority приоритет генерации в очереди процессора
+	Priority ReportPriority `json:"priority" gorm:"size:20;not null;default:'normal'"`
+	// Checksum SHA-256 сохраненного файла отчета в hex, проверяется при скачивании
+	Checksum string `json:"checksum,omitempty" gorm:"size:64"`
+	// FileSize размер сохраненного файла отчета в байтах, учитывается в лимите пользователя
+	FileSize int64 `json:"file_size,omitempty" gorm:"not null;default:0"`
+	// SnapshotKey ключ снимка данных отчета: строки наборов в NDJSON, сжатом gzip.
+	// По снимку отчет перестраивается и сравнивается без повторного выполнения запросов
+	SnapshotKey string `json:"snapshot_key,omitempty" gorm:"size:255"`
+	// StorageClass класс хранения S3, в который переведен файл отчета. Пусто - стандартный
+	StorageClass string `json:"storage_class,omitempty" gorm:"size:32"`
+	// StartedAt начало последней попытки генерации
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// SLABreach вид нарушения сроков SLA определения, SLABreachedAt - когда оно замечено.
+	// Отметка остается на отчете и после завершения генерации
+	SLABreach     SLABreach  `json:"sla_breach,omitempty" gorm:"column:sla_breach;size:20"`
+	SLABreachedAt *time.Time `json:"sla_breached_at,omitempty" gorm:"column:sla_breached_at"`
+	GeneratedAt   *time.Time `json:"generated_at,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty" gorm:"index"`
+	Parameters    JSON       `json:"parameters,omitempty" gorm:"type:jsonb"`
+	ScheduleID    *uint      `json:"schedule_id,omitempty" gorm:"index"`
+	// DefinitionID определение, по которому генерируется отчет
+	DefinitionID *uint `json:"definition_id,omitempty" gorm:"index"`
+	// CacheKey хеш определения, формата и параметров отчета: отчеты с одинаковым ключом
+	// строятся по одним данным, и файл одного можно использовать для другого
+	CacheKey string `json:"cache_key,omitempty" gorm:"size:64;index"`
+	// CachedFromID отчет, файл которого скопирован вместо генерации
+	CachedFromID *uint `json:"cached_from_id,omitempty"`
+	// Bundle файлы ZIP архива отчета формата zip
+	Bundle BundleManifest `json:"bundle,omitempty" gorm:"type:jsonb"`
+	// Attachments приложенные к отчету файлы, заполняются при получении отчета
+	Attachments []ReportAttachment `json:"attachments,omitempty" gorm:"-"`
+	// Renditions файлы отчета в других форматах, построенные по снимку данных. Заполняются при получении отчета
+	Renditions []ReportRendition `json:"renditions,omitempty" gorm:"-"`
+	// Queue положение в очереди и оценка времени готовности отчета в статусах pending и processing.
+	// Заполняется при получении отчета
+	Queue *ReportQueue `json:"queue,omitempty" gorm:"-"`
+	// Unmasked автор отчета имеет область pii:unmasked: персональные данные выводятся без маскирования
+	Unmasked bool `json:"unmasked,omitempty" gorm:"not null;default:false"`
+	// PasswordProtected файл отчета зашифрован паролем
+	PasswordProtected bool `json:"password_protected,omitempty" gorm:"not null;default:false"`
+	// PasswordGenerated пароль сгенерирован сервисом и отправляется получателям отдельным письмом
+	PasswordGenerated bool `json:"password_generated,omitempty" gorm:"not null;default:false"`
+	// FilePassword пароль шифрования файла, в API не возвращается. Хранится до генерации
+	// файла, сгенерированный пароль - до отправки письмом получателям
+	FilePassword string `json:"-" gorm:"size:128"`
+	// GeneratedPassword сгенерированный пароль, возвращается один раз в ответе на создание отчета
+	GeneratedPassword string `json:"generated_password,omitempty" gorm:"-"`
+	// Ход генерации: процент выполнения и число прочитанных строк
+	Progress      int   `json:"progress" gorm:"not null;default:0"`
+	RowsProcessed int64 `json:"rows_processed" gorm:"not null;default:0"`
+	// HeartbeatAt время последнего подтверждения, что генерация выполняется
+	HeartbeatAt *time.Time `json:"heartbeat_at,omitempty"`
+	// Attempts число начатых попыток генерации, MaxAttempts - их предел с учетом повторов
+	// после временных ошибок. Повторный запуск упавшего отчета сбрасывает счетчик
+	Attempts    int `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts int `json:"max_attempts,omitempty" gorm:"not null;default:0"`
+	// Recoveries число перезапусков генерации, прерванной падением сервиса
+	Recoveries int `json:"recoveries,omitempty" gorm:"not null;default:0"`
+	// Причина ошибки генерации, заполняется для отчетов в статусе failed
+	ErrorCode    ReportErrorCode `json:"error_code,omitempty" gorm:"size:50"`
+	ErrorMessage string          `json:"error_message,omitempty" gorm:"size:1000"`
+	// Доставка готового отчета получателям
+	DeliveryStatus DeliveryStatus `json:"delivery_status,omitempty" gorm:"size:20"`
+	DeliveryError  string         `json:"delivery_error,omitempty" gorm:"size:1000"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+	CreatedBy      string         `json:"created_by" gorm:"size:255;not null" validate:"required,min=1,max=255"`
+	UpdatedBy      string         `json:"updated_by" gorm:"size:255;not null" validate:"required,min=1,max=255"`
 }
 
 // JSON кастомный тип для работы с JSONB данными
@@ -151,6 +437,41 @@ func (j JSON) GetInt(key string) (int, bool) {
 	return 0, false
 }
 
+// GetStringSlice получает список строк по ключу. Строковое значение
+// разбивается по запятым
+func (j JSON) GetStringSlice(key string) ([]string, bool) {
+	value, exists := j[key]
+	if !exists {
+		return nil, false
+	}
+
+	var items []string
+	switch v := value.(type) {
+	case []string:
+		items = v
+	case []interface{}:
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, str)
+		}
+	case string:
+		items = strings.Split(v, ",")
+	default:
+		return nil, false
+	}
+
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result, true
+}
+
 // Has проверяет наличие ключа
 func (j JSON) Has(key string) bool {
 	_, exists := j[key]
@@ -234,6 +555,7 @@ func NewReportBuilder() *ReportBuilder {
 	return &ReportBuilder{
 		report: &Report{
 			Status:     StatusPending,
+			Priority:   PriorityNormal,
 			Parameters: NewJSON(),
 		},
 	}
@@ -251,6 +573,34 @@ func (b *ReportBuilder) WithDescription(description string) *ReportBuilder {
 	return b
 }
 
+// WithType устанавливает тип отчета, определяющий схему параметров
+func (b *ReportBuilder) WithType(reportType string) *ReportBuilder {
+	b.report.Type = strings.TrimSpace(reportType)
+	return b
+}
+
+// WithFormat устанавливает формат выходного файла
+func (b *ReportBuilder) WithFormat(format ReportFormat) *ReportBuilder {
+	if format != "" {
+		b.report.Format = format
+	}
+	return b
+}
+
+// WithPriority устанавливает приоритет генерации отчета
+func (b *ReportBuilder) WithPriority(priority ReportPriority) *ReportBuilder {
+	if priority != "" {
+		b.report.Priority = priority
+	}
+	return b
+}
+
+// WithSchedule связывает отчет с расписанием, по которому он создан
+func (b *ReportBuilder) WithSchedule(scheduleID uint) *ReportBuilder {
+	b.report.ScheduleID = &scheduleID
+	return b
+}
+
 // WithCreatedBy устанавливает создателя отчета
 func (b *ReportBuilder) WithCreatedBy(user string) *ReportBuilder {
 	b.report.CreatedBy = strings.TrimSpace(user)
@@ -397,6 +747,202 @@ func (r *Report) HasFile() bool {
 	return r.FileKey != ""
 }
 
+// EmailRecipients возвращает адреса для рассылки готового отчета
+func (r *Report) EmailRecipients() []string {
+	recipients, _ := r.Parameters.GetStringSlice(ParamEmailRecipients)
+	return recipients
+}
+
+// NotificationChannels возвращает каналы для сообщений об отчете из параметров отчета
+func (r *Report) NotificationChannels() (NotificationChannels, error) {
+	value, exists := r.Parameters.Get(ParamNotificationChannels)
+	if !exists || value == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("параметр %s: %w", ParamNotificationChannels, err)
+	}
+	var channels NotificationChannels
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, fmt.Errorf("параметр %s должен быть списком каналов", ParamNotificationChannels)
+	}
+	return channels, nil
+}
+
+// RetentionTTL возвращает срок хранения, заданный в параметрах отчета
+func (r *Report) RetentionTTL() (time.Duration, bool, error) {
+	value, exists := r.Parameters.GetString(ParamRetentionTTL)
+	if !exists {
+		if r.Parameters.Has(ParamRetentionTTL) {
+			return 0, false, fmt.Errorf("параметр %s должен быть строкой", ParamRetentionTTL)
+		}
+		return 0, false, nil
+	}
+
+	ttl, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, false, fmt.Errorf("неверный срок хранения %q: %w", value, err)
+	}
+	if ttl < 0 {
+		return 0, false, fmt.Errorf("срок хранения не может быть отрицательным: %s", value)
+	}
+	return ttl, true, nil
+}
+
+// Compression возвращает сжатие файла, заданное в параметрах отчета
+func (r *Report) Compression() (Compression, bool, error) {
+	value, exists := r.Parameters.GetString(ParamCompression)
+	if !exists {
+		if r.Parameters.Has(ParamCompression) {
+			return "", false, fmt.Errorf("параметр %s должен быть строкой", ParamCompression)
+		}
+		return "", false, nil
+	}
+
+	compression := Compression(strings.ToLower(strings.TrimSpace(value)))
+	if !compression.IsValid() {
+		return "", false, fmt.Errorf("неподдерживаемое сжатие %q: допустимы none, gzip, zip", value)
+	}
+
+	format := r.Format
+	if format == "" {
+		format = DefaultFormat
+	}
+	if compression != CompressionNone && format.IsCompressed() {
+		return "", false, fmt.Errorf("файлы формата %s уже сжаты, параметр %s не применяется", format, ParamCompression)
+	}
+	return compression, true, nil
+}
+
+// Snapshot возвращает, задано ли в параметрах отчета сохранение снимка данных
+func (r *Report) Snapshot() (bool, bool, error) {
+	value, exists := r.Parameters.Get(ParamSnapshot)
+	if !exists {
+		return false, false, nil
+	}
+	enabled, ok := value.(bool)
+	if !ok {
+		return false, false, fmt.Errorf("параметр %s должен быть логическим значением", ParamSnapshot)
+	}
+	return enabled, true, nil
+}
+
+// Locale возвращает локаль отчета из параметров в каноническом виде BCP 47
+func (r *Report) Locale() (string, bool, error) {
+	value, exists := r.Parameters.GetString(ParamLocale)
+	if !exists {
+		if r.Parameters.Has(ParamLocale) {
+			return "", false, fmt.Errorf("параметр %s должен быть строкой", ParamLocale)
+		}
+		return "", false, nil
+	}
+
+	tag, err := language.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return "", false, fmt.Errorf("неизвестная локаль %q", value)
+	}
+	return tag.String(), true, nil
+}
+
+// RequestedPassword возвращает пароль файла из параметров: заданный пароль или признак,
+// что пароль нужно сгенерировать
+func (r *Report) RequestedPassword() (string, bool, error) {
+	value, exists := r.Parameters.Get(ParamPassword)
+	if !exists {
+		return "", false, nil
+	}
+	switch password := value.(type) {
+	case bool:
+		return "", password, nil
+	case string:
+		if length := utf8.RuneCountInString(password); length < MinFilePasswordLength || length > MaxFilePasswordLength {
+			return "", false, fmt.Errorf("пароль файла должен быть от %d до %d символов", MinFilePasswordLength, MaxFilePasswordLength)
+		}
+		return password, false, nil
+	}
+	return "", false, fmt.Errorf("параметр %s должен быть строкой или true", ParamPassword)
+}
+
+// Location возвращает часовой пояс отчета из параметров
+func (r *Report) Location() (*time.Location, bool, error) {
+	value, exists := r.Parameters.GetString(ParamTimezone)
+	if !exists {
+		if r.Parameters.Has(ParamTimezone) {
+			return nil, false, fmt.Errorf("параметр %s должен быть строкой", ParamTimezone)
+		}
+		return nil, false, nil
+	}
+
+	location, err := LoadTimezone(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return location, true, nil
+}
+
+// LocalTime переводит время в часовой пояс отчета. Без часового пояса время выводится в UTC
+func (r *Report) LocalTime(t time.Time) time.Time {
+	if location, ok, err := r.Location(); err == nil && ok {
+		return t.In(location)
+	}
+	return t.UTC()
+}
+
+// InLocation переводит время отчета в часовой пояс location для ответа API. Указатели
+// на время заменяются копиями, поэтому копию отчета можно переводить, не меняя исходный
+func (r *Report) InLocation(location *time.Location) {
+	r.CreatedAt = r.CreatedAt.In(location)
+	r.UpdatedAt = r.UpdatedAt.In(location)
+	if r.DeletedAt.Valid {
+		r.DeletedAt.Time = r.DeletedAt.Time.In(location)
+	}
+	times := []**time.Time{&r.StartedAt, &r.HeartbeatAt, &r.SLABreachedAt, &r.GeneratedAt, &r.ExpiresAt, &r.DeliveredAt}
+	if r.Queue != nil {
+		queue := *r.Queue
+		r.Queue = &queue
+		times = append(times, &r.Queue.EstimatedCompletionAt)
+	}
+	for _, t := range times {
+		if *t != nil {
+			local := (*t).In(location)
+			*t = &local
+		}
+	}
+}
+
+// BundleFormats возвращает форматы файлов ZIP архива из параметра bundle.
+// Повторы убираются, порядок форматов сохраняется.
+func (r *Report) BundleFormats() ([]ReportFormat, bool, error) {
+	if !r.Parameters.Has(ParamBundle) {
+		return nil, false, nil
+	}
+	values, ok := r.Parameters.GetStringSlice(ParamBundle)
+	if !ok || len(values) == 0 {
+		return nil, false, fmt.Errorf("параметр %s должен быть непустым списком форматов", ParamBundle)
+	}
+
+	formats := make([]ReportFormat, 0, len(values))
+	seen := make(map[ReportFormat]bool, len(values))
+	for _, value := range values {
+		format := ReportFormat(strings.ToLower(value))
+		if format == FormatZIP || !format.IsValid() {
+			return nil, false, fmt.Errorf("неподдерживаемый формат файла архива: %s", value)
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	return formats, true, nil
+}
+
+// IsExpired возвращает true, если срок хранения отчета истек
+func (r *Report) IsExpired() bool {
+	return r.Status == StatusExpired
+}
+
 // Validate валидирует отчет
 func (r *Report) Validate() error {
 	var errors []string
@@ -414,11 +960,26 @@ func (r *Report) Validate() error {
 		errors = append(errors, "описание не может быть длиннее 1000 символов")
 	}
 
+	// Проверка типа
+	if len(r.Type) > 100 {
+		errors = append(errors, "тип не может быть длиннее 100 символов")
+	}
+
 	// Проверка статуса
 	if !r.Status.IsValid() {
 		errors = append(errors, fmt.Sprintf("неверный статус: %s", r.Status))
 	}
 
+	// Проверка формата
+	if r.Format != "" && !r.Format.IsValid() {
+		errors = append(errors, fmt.Sprintf("неподдерживаемый формат: %s", r.Format))
+	}
+
+	// Проверка приоритета
+	if r.Priority != "" && !r.Priority.IsValid() {
+		errors = append(errors, fmt.Sprintf("неверный приоритет: %s", r.Priority))
+	}
+
 	// Проверка создателя
 	if strings.TrimSpace(r.CreatedBy) == "" {
 		errors = append(errors, "поле created_by не может быть пустым")
@@ -440,6 +1001,43 @@ func (r *Report) Validate() error {
 		errors = append(errors, "ключ файла не может быть длиннее 255 символов")
 	}
 
+	// Проверка срока хранения
+	if _, _, err := r.RetentionTTL(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	// Проверка сжатия файла
+	if _, _, err := r.Compression(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	// Проверка снимка данных
+	if _, _, err := r.Snapshot(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	// Проверка каналов для сообщений
+	if channels, err := r.NotificationChannels(); err != nil {
+		errors = append(errors, err.Error())
+	} else {
+		errors = append(errors, channels.Validate()...)
+	}
+
+	// Проверка локали и часового пояса
+	if _, _, err := r.Locale(); err != nil {
+		errors = append(errors, err.Error())
+	}
+	if _, _, err := r.Location(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	// Проверка форматов архива
+	if _, bundled, err := r.BundleFormats(); err != nil {
+		errors = append(errors, err.Error())
+	} else if bundled != (r.Format == FormatZIP) {
+		errors = append(errors, fmt.Sprintf("параметр %s задается только для формата %s и обязателен для него", ParamBundle, FormatZIP))
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
 	}
@@ -456,6 +1054,10 @@ func (r *Report) BeforeCreate(tx *gorm.DB) error {
 		r.Status = StatusPending
 	}
 
+	if r.Format == "" {
+		r.Format = DefaultFormat
+	}
+
 	if r.Parameters == nil {
 		r.Parameters = NewJSON()
 	}
@@ -466,5 +1068,11 @@ func (r *Report) BeforeCreate(tx *gorm.DB) error {
 // BeforeUpdate GORM hook, вызывается перед обновлением записи
 func (r *Report) BeforeUpdate(tx *gorm.DB) error {
 	r.UpdatedAt = time.Now().UTC()
+
+	// При частичном обновлении через map модель не заполнена, валидировать нечего
+	if _, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		return nil
+	}
+
 	return r.Validate()
 }
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schedule расписание периодической генерации отчета
+type Schedule struct {
+	ID                uint           `json:"id" gorm:"primarykey"`
+	CreatedAt         time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt         gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	Name              string         `json:"name" gorm:"size:255;not null"`
+	CronExpr          string         `json:"cron_expr" gorm:"size:255;not null"`
+	Enabled           bool           `json:"enabled" gorm:"not null"`
+	ReportTitle       string         `json:"report_title" gorm:"size:255;not null"`
+	ReportDescription string         `json:"report_description" gorm:"size:1000"`
+	Format            ReportFormat   `json:"format" gorm:"size:20;not null;default:'xlsx'"`
+	// ReportType имя определения отчета. Определение с итерационным запросом
+	// создает по отчету на каждую строку запроса
+	ReportType   string     `json:"report_type,omitempty" gorm:"size:100"`
+	Parameters   JSON       `json:"parameters,omitempty" gorm:"type:jsonb"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty" gorm:"index"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastReportID *uint      `json:"last_report_id,omitempty"`
+	CreatedBy    string     `json:"created_by" gorm:"size:255;not null"`
+	UpdatedBy    string     `json:"updated_by" gorm:"size:255;not null"`
+}
+
+// TableName указывает имя таблицы для модели Schedule
+func (Schedule) TableName() string {
+	return "schedules"
+}
+
+// IsDue возвращает true, если расписание пора выполнить
+func (s *Schedule) IsDue(now time.Time) bool {
+	return s.Enabled && s.NextRunAt != nil && !s.NextRunAt.After(now)
+}
+
+// Validate валидирует расписание
+func (s *Schedule) Validate() error {
+	var errors []string
+
+	if strings.TrimSpace(s.Name) == "" {
+		errors = append(errors, "название расписания не может быть пустым")
+	}
+	if len(s.Name) > 255 {
+		errors = append(errors, "название расписания не может быть длиннее 255 символов")
+	}
+
+	if strings.TrimSpace(s.CronExpr) == "" {
+		errors = append(errors, "cron выражение не может быть пустым")
+	}
+
+	if strings.TrimSpace(s.ReportTitle) == "" {
+		errors = append(errors, "заголовок отчета не может быть пустым")
+	}
+	if len(s.ReportTitle) > 255 {
+		errors = append(errors, "заголовок отчета не может быть длиннее 255 символов")
+	}
+	if len(s.ReportDescription) > 1000 {
+		errors = append(errors, "описание отчета не может быть длиннее 1000 символов")
+	}
+
+	if len(s.ReportType) > 100 {
+		errors = append(errors, "тип отчета не может быть длиннее 100 символов")
+	}
+
+	if s.Format != "" && !s.Format.IsValid() {
+		errors = append(errors, fmt.Sprintf("неподдерживаемый формат: %s", s.Format))
+	}
+
+	if strings.TrimSpace(s.CreatedBy) == "" {
+		errors = append(errors, "поле created_by не может быть пустым")
+	}
+	if strings.TrimSpace(s.UpdatedBy) == "" {
+		errors = append(errors, "поле updated_by не может быть пустым")
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("ошибки валидации: %s", strings.Join(errors, "; "))
+	}
+
+	return nil
+}
+
+// BeforeCreate GORM hook, вызывается перед созданием записи
+func (s *Schedule) BeforeCreate(tx *gorm.DB) error {
+	if s.Format == "" {
+		s.Format = DefaultFormat
+	}
+
+	if s.Parameters == nil {
+		s.Parameters = NewJSON()
+	}
+
+	return s.Validate()
+}
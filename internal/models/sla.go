@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"time"
+)
+
+// SLABreach вид нарушения сроков генерации отчета
+type SLABreach string
+
+const (
+	// SLABreachQueueWait отчет ждет в очереди дольше SLA.MaxQueueWait
+	SLABreachQueueWait SLABreach = "queue_wait"
+	// SLABreachDuration отчет генерируется дольше SLA.MaxDuration
+	SLABreachDuration SLABreach = "duration"
+)
+
+// SLA сроки генерации отчетов определения. Отчет, который ждет в очереди или генерируется
+// дольше срока, отмечается нарушением SLA, о котором отправляется оповещение
+type SLA struct {
+	// MaxDuration наибольшая длительность генерации от ее начала, например 30m. Пустая - не проверяется
+	MaxDuration string `json:"max_duration,omitempty"`
+	// MaxQueueWait наибольшее ожидание в очереди от создания отчета, например 10m. Пустое - не проверяется
+	MaxQueueWait string `json:"max_queue_wait,omitempty"`
+	// AlertEmails адреса, которым кроме адресов из конфигурации отправляются оповещения о нарушениях
+	AlertEmails []string `json:"alert_emails,omitempty"`
+}
+
+// IsEmpty проверяет, заданы ли сроки
+func (s *SLA) IsEmpty() bool {
+	return s == nil || (s.MaxDuration == "" && s.MaxQueueWait == "" && len(s.AlertEmails) == 0)
+}
+
+// Limit возвращает срок для вида нарушения, 0 - срок не задан
+func (s *SLA) Limit(breach SLABreach) time.Duration {
+	if s == nil {
+		return 0
+	}
+	value := s.MaxQueueWait
+	if breach == SLABreachDuration {
+		value = s.MaxDuration
+	}
+	if value == "" {
+		return 0
+	}
+	limit, err := time.ParseDuration(value)
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// Value реализует интерфейс driver.Valuer для SLA
+func (s SLA) Value() (driver.Value, error) {
+	if s.IsEmpty() {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации SLA: %w", err)
+	}
+	return data, nil
+}
+
+// Scan реализует интерфейс sql.Scanner для SLA
+func (s *SLA) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*s = SLA{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return fmt.Errorf("невозможно сканировать %T в SLA", value)
+	}
+
+	var result SLA
+	if err := json.Unmarshal(bytes, &result); err != nil {
+		return fmt.Errorf("ошибка десериализации SLA: %w", err)
+	}
+
+	*s = result
+	return nil
+}
+
+// Validate проверяет сроки и адреса оповещений
+func (s *SLA) Validate() []string {
+	if s.IsEmpty() {
+		return nil
+	}
+
+	var errors []string
+	for _, limit := range []struct{ name, value string }{
+		{"max_duration", s.MaxDuration},
+		{"max_queue_wait", s.MaxQueueWait},
+	} {
+		if limit.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(limit.value); err != nil || d <= 0 {
+			errors = append(errors, fmt.Sprintf("SLA: некорректный срок %s: %s", limit.name, limit.value))
+		}
+	}
+	if s.MaxDuration == "" && s.MaxQueueWait == "" {
+		errors = append(errors, "SLA: нужно задать max_duration или max_queue_wait")
+	}
+	for _, email := range s.AlertEmails {
+		if _, err := mail.ParseAddress(email); err != nil {
+			errors = append(errors, fmt.Sprintf("SLA: неверный адрес оповещения %q", email))
+		}
+	}
+	return errors
+}
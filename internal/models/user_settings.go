@@ -0,0 +1,79 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// UserSettings настройки пользователя по умолчанию. Применяются при создании его отчетов,
+// в ленте уведомлений и в списках с пагинацией
+type UserSettings struct {
+	// Subject пользователь, как в created_by отчетов
+	Subject string `json:"subject" gorm:"primarykey;size:255"`
+	// DefaultFormat формат отчетов без определения, если формат не указан при создании
+	DefaultFormat ReportFormat `json:"default_format,omitempty" gorm:"size:20"`
+	// Locale локаль отчетов, если параметр locale не указан
+	Locale string `json:"locale,omitempty" gorm:"size:35"`
+	// Timezone часовой пояс IANA отчетов, если параметр timezone не указан
+	Timezone string `json:"timezone,omitempty" gorm:"size:64"`
+	// NotifyCompleted записывать в ленту уведомления о готовых отчетах
+	NotifyCompleted bool `json:"notify_completed" gorm:"not null"`
+	// NotifyFailed записывать в ленту уведомления об упавших отчетах
+	NotifyFailed bool `json:"notify_failed" gorm:"not null"`
+	// PageSize размер страницы списков, если page_size не указан. 0 - размер по умолчанию
+	PageSize  int       `json:"page_size,omitempty" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName указывает имя таблицы для модели UserSettings
+func (UserSettings) TableName() string {
+	return "user_settings"
+}
+
+// DefaultUserSettings возвращает настройки пользователя, который их не менял
+func DefaultUserSettings(subject string) *UserSettings {
+	return &UserSettings{Subject: subject, NotifyCompleted: true, NotifyFailed: true}
+}
+
+// Validate проверяет формат, локаль, часовой пояс и размер страницы
+func (s *UserSettings) Validate() []string {
+	var errors []string
+	if s.DefaultFormat != "" && !s.DefaultFormat.IsValid() {
+		errors = append(errors, fmt.Sprintf("неподдерживаемый формат %q", s.DefaultFormat))
+	}
+	if s.DefaultFormat.IsTemplated() {
+		errors = append(errors, fmt.Sprintf("формат %s требует шаблона определения и не может быть форматом по умолчанию", s.DefaultFormat))
+	}
+	if s.Locale != "" {
+		if _, err := language.Parse(s.Locale); err != nil {
+			errors = append(errors, fmt.Sprintf("неизвестная локаль %q", s.Locale))
+		}
+	}
+	if s.Timezone != "" {
+		if _, err := LoadTimezone(s.Timezone); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+	if s.PageSize < 0 || s.PageSize > 100 {
+		errors = append(errors, "размер страницы должен быть от 1 до 100")
+	}
+	return errors
+}
+
+// LoadTimezone загружает часовой пояс IANA по имени, например Europe/Moscow
+func LoadTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	// Пустое имя и Local time.LoadLocation понимает как UTC и пояс сервера
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("неизвестный часовой пояс %q", name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("неизвестный часовой пояс %q", name)
+	}
+	return location, nil
+}
@@ -0,0 +1,323 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// ErrUnsupportedExpression выражение использует конструкцию, которую нельзя вычислить над строкой
+var ErrUnsupportedExpression = errors.New("неподдерживаемое выражение")
+
+// Expression выражение вычисляемой колонки в синтаксисе SQL над колонками одной строки результата:
+// арифметика (+ - * / %), строки и числа, скобки и функции concat, coalesce, round, abs, upper, lower.
+// NULL в арифметике дает NULL, как в SQL.
+type Expression struct {
+	text    string
+	expr    sqlparser.Expr
+	columns []string
+}
+
+// expressionFunctions поддерживаемые функции и допустимое число аргументов: минимум и максимум, -1 - без ограничения
+var expressionFunctions = map[string][2]int{
+	"concat":   {1, -1},
+	"coalesce": {1, -1},
+	"round":    {1, 2},
+	"abs":      {1, 1},
+	"upper":    {1, 1},
+	"lower":    {1, 1},
+}
+
+// ParseExpression разбирает выражение и проверяет, что все его конструкции поддерживаются
+func ParseExpression(text string) (*Expression, error) {
+	statement, err := sqlparser.Parse("SELECT " + text)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора выражения: %w", err)
+	}
+	sel, ok := statement.(*sqlparser.Select)
+	if !ok || len(sel.SelectExprs) != 1 || sel.From != nil && sqlparser.String(sel.From) != "dual" ||
+		sel.Where != nil || sel.GroupBy != nil || sel.OrderBy != nil || sel.Limit != nil {
+		return nil, fmt.Errorf("%w: ожидается одно выражение", ErrUnsupportedExpression)
+	}
+	aliased, ok := sel.SelectExprs[0].(*sqlparser.AliasedExpr)
+	if !ok || !aliased.As.IsEmpty() {
+		return nil, fmt.Errorf("%w: ожидается одно выражение без псевдонима", ErrUnsupportedExpression)
+	}
+
+	e := &Expression{text: text, expr: aliased.Expr}
+	seen := make(map[string]bool)
+	if err := e.check(aliased.Expr, seen); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// String возвращает исходный текст выражения
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Columns возвращает колонки, на которые ссылается выражение, в порядке появления
+func (e *Expression) Columns() []string {
+	return e.columns
+}
+
+// check проверяет узлы выражения и собирает колонки
+func (e *Expression) check(expr sqlparser.Expr, seen map[string]bool) error {
+	switch node := expr.(type) {
+	case *sqlparser.ColName:
+		name := node.Name.String()
+		if strings.HasPrefix(name, "@") {
+			return fmt.Errorf("%w: параметры отчета недоступны в выражении", ErrUnsupportedExpression)
+		}
+		if !seen[name] {
+			seen[name] = true
+			e.columns = append(e.columns, name)
+		}
+		return nil
+	case *sqlparser.SQLVal:
+		switch node.Type {
+		case sqlparser.StrVal, sqlparser.IntVal, sqlparser.FloatVal:
+			return nil
+		}
+	case *sqlparser.NullVal:
+		return nil
+	case *sqlparser.ParenExpr:
+		return e.check(node.Expr, seen)
+	case *sqlparser.UnaryExpr:
+		if node.Operator == sqlparser.UMinusStr || node.Operator == sqlparser.UPlusStr {
+			return e.check(node.Expr, seen)
+		}
+	case *sqlparser.BinaryExpr:
+		switch node.Operator {
+		case sqlparser.PlusStr, sqlparser.MinusStr, sqlparser.MultStr, sqlparser.DivStr, sqlparser.ModStr:
+			if err := e.check(node.Left, seen); err != nil {
+				return err
+			}
+			return e.check(node.Right, seen)
+		}
+	case *sqlparser.FuncExpr:
+		name := node.Name.Lowered()
+		arity, ok := expressionFunctions[name]
+		if !ok || node.Distinct || !node.Qualifier.IsEmpty() {
+			return fmt.Errorf("%w: функция %s", ErrUnsupportedExpression, node.Name.String())
+		}
+		if len(node.Exprs) < arity[0] || arity[1] >= 0 && len(node.Exprs) > arity[1] {
+			return fmt.Errorf("%w: неверное число аргументов функции %s", ErrUnsupportedExpression, name)
+		}
+		for _, argument := range node.Exprs {
+			aliased, ok := argument.(*sqlparser.AliasedExpr)
+			if !ok {
+				return fmt.Errorf("%w: аргумент функции %s", ErrUnsupportedExpression, name)
+			}
+			if err := e.check(aliased.Expr, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedExpression, sqlparser.String(expr))
+}
+
+// Eval вычисляет выражение над значениями колонок строки. Отсутствующая колонка - NULL.
+func (e *Expression) Eval(row map[string]interface{}) (interface{}, error) {
+	return eval(e.expr, row)
+}
+
+// eval вычисляет узел выражения
+func eval(expr sqlparser.Expr, row map[string]interface{}) (interface{}, error) {
+	switch node := expr.(type) {
+	case *sqlparser.ColName:
+		return row[node.Name.String()], nil
+	case *sqlparser.SQLVal:
+		switch node.Type {
+		case sqlparser.IntVal:
+			return strconv.ParseInt(string(node.Val), 10, 64)
+		case sqlparser.FloatVal:
+			return strconv.ParseFloat(string(node.Val), 64)
+		default:
+			return string(node.Val), nil
+		}
+	case *sqlparser.NullVal:
+		return nil, nil
+	case *sqlparser.ParenExpr:
+		return eval(node.Expr, row)
+	case *sqlparser.UnaryExpr:
+		value, err := eval(node.Expr, row)
+		if err != nil || value == nil || node.Operator == sqlparser.UPlusStr {
+			return value, err
+		}
+		return arithmetic(sqlparser.MinusStr, int64(0), value)
+	case *sqlparser.BinaryExpr:
+		left, err := eval(node.Left, row)
+		if err != nil {
+			return nil, err
+		}
+		right, err := eval(node.Right, row)
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic(node.Operator, left, right)
+	case *sqlparser.FuncExpr:
+		arguments := make([]interface{}, len(node.Exprs))
+		for i, argument := range node.Exprs {
+			value, err := eval(argument.(*sqlparser.AliasedExpr).Expr, row)
+			if err != nil {
+				return nil, err
+			}
+			arguments[i] = value
+		}
+		return call(node.Name.Lowered(), arguments)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedExpression, sqlparser.String(expr))
+}
+
+// arithmetic выполняет арифметическую операцию. Целые остаются целыми, кроме деления.
+func arithmetic(operator string, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	leftInt, leftIsInt := left.(int64)
+	rightInt, rightIsInt := right.(int64)
+	if leftIsInt && rightIsInt && operator != sqlparser.DivStr {
+		switch operator {
+		case sqlparser.PlusStr:
+			return leftInt + rightInt, nil
+		case sqlparser.MinusStr:
+			return leftInt - rightInt, nil
+		case sqlparser.MultStr:
+			return leftInt * rightInt, nil
+		case sqlparser.ModStr:
+			if rightInt == 0 {
+				return nil, nil
+			}
+			return leftInt % rightInt, nil
+		}
+	}
+
+	a, ok := Number(left)
+	if !ok {
+		return nil, fmt.Errorf("значение %v не число", left)
+	}
+	b, ok := Number(right)
+	if !ok {
+		return nil, fmt.Errorf("значение %v не число", right)
+	}
+	switch operator {
+	case sqlparser.PlusStr:
+		return a + b, nil
+	case sqlparser.MinusStr:
+		return a - b, nil
+	case sqlparser.MultStr:
+		return a * b, nil
+	case sqlparser.DivStr:
+		// Деление на ноль дает NULL, как в MySQL
+		if b == 0 {
+			return nil, nil
+		}
+		return a / b, nil
+	case sqlparser.ModStr:
+		if b == 0 {
+			return nil, nil
+		}
+		return math.Mod(a, b), nil
+	}
+	return nil, fmt.Errorf("%w: оператор %s", ErrUnsupportedExpression, operator)
+}
+
+// call вычисляет функцию выражения
+func call(name string, arguments []interface{}) (interface{}, error) {
+	switch name {
+	case "concat":
+		// NULL пропускается, как в PostgreSQL
+		var b strings.Builder
+		for _, argument := range arguments {
+			if argument != nil {
+				b.WriteString(text(argument))
+			}
+		}
+		return b.String(), nil
+	case "coalesce":
+		for _, argument := range arguments {
+			if argument != nil {
+				return argument, nil
+			}
+		}
+		return nil, nil
+	case "upper", "lower":
+		if arguments[0] == nil {
+			return nil, nil
+		}
+		if name == "upper" {
+			return strings.ToUpper(text(arguments[0])), nil
+		}
+		return strings.ToLower(text(arguments[0])), nil
+	case "abs", "round":
+		if arguments[0] == nil {
+			return nil, nil
+		}
+		if value, ok := arguments[0].(int64); ok && (name == "abs" || len(arguments) == 1) {
+			if value < 0 && name == "abs" {
+				return -value, nil
+			}
+			return value, nil
+		}
+		value, ok := Number(arguments[0])
+		if !ok {
+			return nil, fmt.Errorf("значение %v не число", arguments[0])
+		}
+		if name == "abs" {
+			return math.Abs(value), nil
+		}
+		digits := 0.0
+		if len(arguments) == 2 {
+			if digits, ok = Number(arguments[1]); !ok {
+				return nil, fmt.Errorf("число знаков %v не число", arguments[1])
+			}
+		}
+		scale := math.Pow(10, digits)
+		return math.Round(value*scale) / scale, nil
+	}
+	return nil, fmt.Errorf("%w: функция %s", ErrUnsupportedExpression, name)
+}
+
+// Number приводит значение колонки к числу. Числа NUMERIC драйверы возвращают строкой.
+func Number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	case []byte:
+		number, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// text приводит значение к строке для строковых функций
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,214 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xwb1989/sqlparser"
+)
+
+// defaultSchema схема, в которой ищутся таблицы без явного указания схемы
+const defaultSchema = "public"
+
+// dualTable виртуальная таблица, которую парсер подставляет в запросы без FROM
+const dualTable = "dual"
+
+var (
+	// ErrNotReadOnly запрос не является запросом на чтение
+	ErrNotReadOnly = errors.New("допускаются только запросы SELECT")
+	// ErrTableNotAllowed запрос обращается к таблицам вне списка разрешенных
+	ErrTableNotAllowed = errors.New("обращение к неразрешенным таблицам")
+)
+
+// allowlistEntryPattern элемент списка разрешенных таблиц: table, schema.table или schema.*
+var allowlistEntryPattern = regexp.MustCompile(`^([a-z_][a-z0-9_$]*\.)?([a-z_][a-z0-9_$]*|\*)$`)
+
+// Validator проверяет SQL запросы определений отчетов по синтаксическому дереву:
+// допускается один запрос SELECT (в том числе UNION и подзапросы) без блокировок,
+// обращающийся только к разрешенным таблицам.
+type Validator struct {
+	tables  map[string]bool
+	schemas map[string]bool
+}
+
+// NewValidator создает валидатор со списком разрешенных таблиц. Элементы списка:
+// table (в схеме public), schema.table или schema.* (все таблицы схемы).
+// Пустой список снимает ограничение на таблицы.
+func NewValidator(allowedTables []string) (*Validator, error) {
+	v := &Validator{}
+	for _, entry := range allowedTables {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if !allowlistEntryPattern.MatchString(entry) {
+			return nil, fmt.Errorf("неверный элемент списка разрешенных таблиц: %q", entry)
+		}
+
+		schema, table := splitTableName(entry)
+		if table == "*" {
+			if v.schemas == nil {
+				v.schemas = make(map[string]bool)
+			}
+			v.schemas[schema] = true
+			continue
+		}
+		if v.tables == nil {
+			v.tables = make(map[string]bool)
+		}
+		v.tables[schema+"."+table] = true
+	}
+	return v, nil
+}
+
+// Restricted возвращает true, если задан список разрешенных таблиц
+func (v *Validator) Restricted() bool {
+	return len(v.tables) > 0 || len(v.schemas) > 0
+}
+
+// Validate разбирает запрос и проверяет, что он только читает разрешенные таблицы
+func (v *Validator) Validate(sql string) error {
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		return fmt.Errorf("ошибка разбора SQL: %w", err)
+	}
+
+	switch statement.(type) {
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect:
+	default:
+		return ErrNotReadOnly
+	}
+
+	denied := make(map[string]bool)
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.Select:
+			if node.Lock != "" {
+				return false, fmt.Errorf("%w: блокировки строк не допускаются", ErrNotReadOnly)
+			}
+		case *sqlparser.AliasedTableExpr:
+			if name, ok := node.Expr.(sqlparser.TableName); ok && !v.allowed(name) {
+				denied[sqlparser.String(name)] = true
+			}
+		}
+		return true, nil
+	}, statement)
+	if err != nil {
+		return err
+	}
+
+	if len(denied) > 0 {
+		tables := make([]string, 0, len(denied))
+		for table := range denied {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		return fmt.Errorf("%w: %s", ErrTableNotAllowed, strings.Join(tables, ", "))
+	}
+
+	return nil
+}
+
+// allowed проверяет таблицу по списку разрешенных
+func (v *Validator) allowed(name sqlparser.TableName) bool {
+	schema := strings.ToLower(name.Qualifier.String())
+	table := strings.ToLower(name.Name.String())
+
+	if schema == "" && table == dualTable {
+		return true
+	}
+	if !v.Restricted() {
+		return true
+	}
+	if schema == "" {
+		schema = defaultSchema
+	}
+	return v.schemas[schema] || v.tables[schema+"."+table]
+}
+
+// splitTableName разделяет имя на схему и таблицу, подставляя схему по умолчанию
+func splitTableName(name string) (string, string) {
+	if schema, table, found := strings.Cut(name, "."); found {
+		return schema, table
+	}
+	return defaultSchema, name
+}
+
+// Columns возвращает имена колонок результата запроса по списку SELECT первой части запроса.
+// complete равно false, если имена части колонок задает база данных: для * и выражений без псевдонима.
+func Columns(sql string) (columns []string, complete bool, err error) {
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, false, fmt.Errorf("ошибка разбора SQL: %w", err)
+	}
+
+	selectStatement, ok := statement.(sqlparser.SelectStatement)
+	if !ok {
+		return nil, false, ErrNotReadOnly
+	}
+	// Колонки UNION называются по первому запросу
+	for {
+		switch node := selectStatement.(type) {
+		case *sqlparser.Union:
+			selectStatement = node.Left
+			continue
+		case *sqlparser.ParenSelect:
+			selectStatement = node.Select
+			continue
+		}
+		break
+	}
+	sel, ok := selectStatement.(*sqlparser.Select)
+	if !ok {
+		return nil, false, nil
+	}
+
+	complete = true
+	for _, expr := range sel.SelectExprs {
+		aliased, ok := expr.(*sqlparser.AliasedExpr)
+		if !ok {
+			complete = false
+			continue
+		}
+		switch {
+		case !aliased.As.IsEmpty():
+			columns = append(columns, aliased.As.String())
+		case isColumn(aliased.Expr):
+			columns = append(columns, aliased.Expr.(*sqlparser.ColName).Name.String())
+		default:
+			complete = false
+		}
+	}
+	return columns, complete, nil
+}
+
+// Parameters возвращает имена параметров запроса (@name) без @ в порядке первого появления
+func Parameters(sql string) ([]string, error) {
+	statement, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора SQL: %w", err)
+	}
+
+	var parameters []string
+	seen := make(map[string]bool)
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		// Парсер разбирает @name как колонку
+		if column, ok := node.(*sqlparser.ColName); ok && column.Qualifier.IsEmpty() {
+			if name, found := strings.CutPrefix(column.Name.String(), "@"); found && name != "" && !seen[name] {
+				seen[name] = true
+				parameters = append(parameters, name)
+			}
+		}
+		return true, nil
+	}, statement)
+	return parameters, nil
+}
+
+// isColumn проверяет, что выражение - ссылка на колонку, а не параметр
+func isColumn(expr sqlparser.Expr) bool {
+	column, ok := expr.(*sqlparser.ColName)
+	return ok && !strings.HasPrefix(column.Name.String(), "@")
+}
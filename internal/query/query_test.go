@@ -0,0 +1,129 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatorAllowsReadOnlyQueries(t *testing.T) {
+	validator, err := NewValidator(nil)
+	require.NoError(t, err)
+
+	for _, sql := range []string{
+		"SELECT id, created_at, updated_at, deleted_at FROM reports WHERE created_by = @user",
+		"SELECT region, SUM(amount) AS amount FROM sales GROUP BY region ORDER BY amount DESC;",
+		"SELECT a FROM t UNION ALL SELECT b FROM u",
+		"SELECT COUNT(*) FROM (SELECT DISTINCT region FROM sales) regions",
+		"SELECT 1",
+	} {
+		assert.NoError(t, validator.Validate(sql), sql)
+	}
+}
+
+func TestValidatorRejectsWrites(t *testing.T) {
+	validator, err := NewValidator(nil)
+	require.NoError(t, err)
+
+	for _, sql := range []string{
+		"DELETE FROM sales",
+		"UPDATE sales SET amount = 0",
+		"INSERT INTO sales (region) VALUES ('north')",
+		"DROP TABLE sales",
+		"SELECT * FROM sales FOR UPDATE",
+	} {
+		assert.ErrorIs(t, validator.Validate(sql), ErrNotReadOnly, sql)
+	}
+
+	// Несколько запросов не разбираются как один
+	assert.Error(t, validator.Validate("SELECT 1; DELETE FROM sales"))
+}
+
+func TestValidatorAllowlist(t *testing.T) {
+	validator, err := NewValidator([]string{"sales", "Analytics.*", "crm.customers"})
+	require.NoError(t, err)
+	assert.True(t, validator.Restricted())
+
+	for _, sql := range []string{
+		"SELECT * FROM sales",
+		"SELECT * FROM public.sales s JOIN analytics.daily d ON d.day = s.day",
+		"SELECT name FROM crm.customers WHERE id IN (SELECT customer_id FROM sales)",
+	} {
+		assert.NoError(t, validator.Validate(sql), sql)
+	}
+
+	err = validator.Validate("SELECT * FROM sales WHERE customer_id IN (SELECT id FROM crm.passwords) UNION SELECT * FROM users")
+	assert.ErrorIs(t, err, ErrTableNotAllowed)
+	assert.ErrorContains(t, err, "crm.passwords, users")
+
+	_, err = NewValidator([]string{"public.sales; DROP"})
+	assert.Error(t, err)
+}
+
+func TestColumns(t *testing.T) {
+	columns, complete, err := Columns("SELECT region, SUM(amount) AS amount, s.closed_at FROM sales s WHERE period = @period GROUP BY region")
+	require.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, []string{"region", "amount", "closed_at"}, columns)
+
+	// Колонки UNION называются по первому запросу
+	columns, complete, err = Columns("SELECT a AS name FROM t UNION ALL SELECT b FROM u")
+	require.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, []string{"name"}, columns)
+
+	// Имена * и выражений без псевдонима задает база данных
+	for _, sql := range []string{"SELECT * FROM sales", "SELECT region, COUNT(*) FROM sales GROUP BY region", "SELECT @period"} {
+		_, complete, err = Columns(sql)
+		require.NoError(t, err)
+		assert.False(t, complete, sql)
+	}
+
+	_, _, err = Columns("DELETE FROM sales")
+	assert.ErrorIs(t, err, ErrNotReadOnly)
+}
+
+func TestParameters(t *testing.T) {
+	parameters, err := Parameters("SELECT region FROM sales WHERE period = @period AND region IN (SELECT name FROM regions WHERE owner = @user) OR period = @period")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"period", "user"}, parameters)
+}
+
+func TestExpression(t *testing.T) {
+	row := map[string]interface{}{"amount": int64(7), "price": "2.5", "name": "north", "discount": nil}
+
+	for text, expected := range map[string]interface{}{
+		"amount * 2 + 1":                    int64(15),
+		"amount * price":                    17.5,
+		"amount / 2":                        3.5,
+		"-amount % 4":                       int64(-3),
+		"round(amount / 3, 2)":              2.33,
+		"amount - discount":                 nil,
+		"coalesce(discount, 0)":             int64(0),
+		"concat(upper(name), ': ', amount)": "NORTH: 7",
+		"amount / 0":                        nil,
+	} {
+		expression, err := ParseExpression(text)
+		require.NoError(t, err, text)
+		value, err := expression.Eval(row)
+		require.NoError(t, err, text)
+		assert.Equal(t, expected, value, text)
+	}
+
+	expression, err := ParseExpression("concat(name, amount + price, name)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "amount", "price"}, expression.Columns())
+
+	_, err = ParseExpression("name = 'x'")
+	assert.ErrorIs(t, err, ErrUnsupportedExpression)
+	for _, text := range []string{"amount, price", "(SELECT 1)", "sleep(10)", "amount * @rate", "amount AS total", "1 FROM users"} {
+		_, err = ParseExpression(text)
+		assert.Error(t, err, text)
+	}
+
+	expression, err = ParseExpression("name * 2")
+	require.NoError(t, err)
+	_, err = expression.Eval(row)
+	assert.Error(t, err)
+}
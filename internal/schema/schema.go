@@ -0,0 +1,221 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// schemaFileExtension расширение файлов схем в каталоге
+const schemaFileExtension = ".json"
+
+// printer форматирует сообщения об ошибках валидации
+var printer = message.NewPrinter(language.English)
+
+// FieldError ошибка валидации отдельного параметра.
+// Field - путь к параметру через точку (например, "filters.0.value"),
+// пустая строка означает объект параметров целиком.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError параметры отчета не соответствуют схеме
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error возвращает описание всех ошибок валидации
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		if field.Field == "" {
+			messages = append(messages, field.Message)
+			continue
+		}
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return "параметры не соответствуют схеме: " + strings.Join(messages, "; ")
+}
+
+// Schema скомпилированная JSON Schema параметров отчета
+type Schema struct {
+	compiled *jsonschema.Schema
+}
+
+// Compile компилирует JSON Schema. name используется как идентификатор схемы в сообщениях об ошибках
+func Compile(name string, raw []byte) (*Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора схемы %s: %w", name, err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	if err := compiler.AddResource(name, doc); err != nil {
+		return nil, fmt.Errorf("ошибка загрузки схемы %s: %w", name, err)
+	}
+
+	compiled, err := compiler.Compile(name)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка компиляции схемы %s: %w", name, err)
+	}
+
+	return &Schema{compiled: compiled}, nil
+}
+
+// Validate проверяет параметры отчета. Возвращает *ValidationError со списком
+// ошибок по полям, если параметры не соответствуют схеме.
+func (s *Schema) Validate(params map[string]interface{}) error {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	// Приводим значения к представлению encoding/json, с которым работает валидатор
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации параметров: %w", err)
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("ошибка разбора параметров: %w", err)
+	}
+
+	err = s.compiled.Validate(instance)
+	if err == nil {
+		return nil
+	}
+
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return fmt.Errorf("ошибка валидации параметров: %w", err)
+	}
+
+	fields := collectFieldErrors(validationErr, nil)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return &ValidationError{Fields: fields}
+}
+
+// collectFieldErrors собирает ошибки из листьев дерева ошибок валидатора
+func collectFieldErrors(err *jsonschema.ValidationError, fields []FieldError) []FieldError {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			fields = collectFieldErrors(cause, fields)
+		}
+		return fields
+	}
+
+	// Для отсутствующих и лишних свойств ошибка относится к самим свойствам, а не к объекту
+	switch errorKind := err.ErrorKind.(type) {
+	case *kind.Required:
+		for _, property := range errorKind.Missing {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(err.InstanceLocation, property),
+				Message: "обязательный параметр",
+			})
+		}
+		return fields
+	case *kind.AdditionalProperties:
+		for _, property := range errorKind.Properties {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(err.InstanceLocation, property),
+				Message: "неизвестный параметр",
+			})
+		}
+		return fields
+	}
+
+	return append(fields, FieldError{
+		Field:   fieldPath(err.InstanceLocation),
+		Message: err.ErrorKind.LocalizedString(printer),
+	})
+}
+
+// fieldPath преобразует расположение значения в путь через точку
+func fieldPath(location []string, property ...string) string {
+	path := make([]string, 0, len(location)+len(property))
+	path = append(path, location...)
+	path = append(path, property...)
+	return strings.Join(path, ".")
+}
+
+// Registry набор схем параметров по типам отчетов
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]*Schema
+}
+
+// NewRegistry создает пустой набор схем
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]*Schema)}
+}
+
+// LoadDir загружает схемы из каталога. Тип отчета - имя файла без расширения .json
+// (например, sales.json задает схему параметров отчетов типа sales).
+func LoadDir(dir string) (*Registry, error) {
+	registry := NewRegistry()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога схем %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != schemaFileExtension {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения схемы %s: %w", path, err)
+		}
+
+		reportType := strings.TrimSuffix(entry.Name(), schemaFileExtension)
+		compiled, err := Compile(reportType+schemaFileExtension, raw)
+		if err != nil {
+			return nil, err
+		}
+		registry.Register(reportType, compiled)
+	}
+
+	return registry, nil
+}
+
+// Register добавляет или заменяет схему для типа отчета
+func (r *Registry) Register(reportType string, schema *Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[reportType] = schema
+}
+
+// Get возвращает схему для типа отчета
+func (r *Registry) Get(reportType string) (*Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schema, exists := r.schemas[reportType]
+	return schema, exists
+}
+
+// Types возвращает отсортированный список типов отчетов со схемами
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.schemas))
+	for reportType := range r.schemas {
+		types = append(types, reportType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const salesSchema = `{
+	"type": "object",
+	"properties": {
+		"region": {"type": "string", "enum": ["north", "south"]},
+		"date_from": {"type": "string", "format": "date"},
+		"limit": {"type": "integer", "minimum": 1},
+		"filters": {
+			"type": "array",
+			"items": {"type": "object", "properties": {"value": {"type": "string"}}}
+		}
+	},
+	"required": ["region", "date_from"],
+	"additionalProperties": false
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := Compile("sales.json", []byte(salesSchema))
+	require.NoError(t, err)
+
+	assert.NoError(t, schema.Validate(map[string]interface{}{
+		"region":    "north",
+		"date_from": "2024-01-01",
+		"limit":     10,
+		"filters":   []interface{}{map[string]interface{}{"value": "a"}},
+	}))
+
+	err = schema.Validate(map[string]interface{}{
+		"region":  "west",
+		"limit":   0,
+		"filters": []interface{}{map[string]interface{}{"value": 1}},
+		"extra":   true,
+	})
+	require.Error(t, err)
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	fields := make(map[string]string)
+	for _, field := range validationErr.Fields {
+		fields[field.Field] = field.Message
+	}
+	assert.Len(t, fields, 5)
+	assert.Equal(t, "обязательный параметр", fields["date_from"])
+	assert.Equal(t, "неизвестный параметр", fields["extra"])
+	assert.Contains(t, fields, "region")
+	assert.Contains(t, fields, "limit")
+	assert.Contains(t, fields, "filters.0.value")
+}
+
+func TestCompileRejectsInvalidSchema(t *testing.T) {
+	_, err := Compile("broken.json", []byte(`{"type": "unknown"}`))
+	assert.Error(t, err)
+
+	_, err = Compile("broken.json", []byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sales.json"), []byte(salesSchema), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("не схема"), 0o644))
+
+	registry, err := LoadDir(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sales"}, registry.Types())
+
+	_, exists := registry.Get("sales")
+	assert.True(t, exists)
+	_, exists = registry.Get("unknown")
+	assert.False(t, exists)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"type": 1}`), 0o644))
+	_, err = LoadDir(dir)
+	assert.Error(t, err)
+}
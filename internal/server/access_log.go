@@ -0,0 +1,119 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AccessLogMiddleware записывает в лог каждый HTTP запрос: метод, шаблон маршрута, статус,
+// длительность, размер запроса и ответа, клиента и арендатора
+type AccessLogMiddleware struct {
+	config    config.AccessLog
+	logger    logging.Logger
+	skipPaths map[string]bool
+}
+
+// NewAccessLogMiddleware создает middleware журнала HTTP запросов
+func NewAccessLogMiddleware(cfg config.AccessLog, logger logging.Logger) Middleware {
+	skipPaths := make(map[string]bool, len(cfg.SkipPaths))
+	for _, path := range cfg.SkipPaths {
+		skipPaths[path] = true
+	}
+	return &AccessLogMiddleware{config: cfg, logger: logger, skipPaths: skipPaths}
+}
+
+// Apply подключает middleware к Echo
+func (m *AccessLogMiddleware) Apply(e *echo.Echo) {
+	e.Use(m.handle)
+}
+
+// handle выполняет запрос и записывает его результат. Ошибка обработчика сразу
+// передается обработчику ошибок Echo, чтобы в записи был итоговый статус ответа.
+func (m *AccessLogMiddleware) handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if m.skipPaths[c.Path()] {
+			return next(c)
+		}
+
+		request := c.Request()
+		body := &countingReader{reader: request.Body}
+		if request.Body != nil && request.Body != http.NoBody {
+			request.Body = body
+		}
+
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err)
+		}
+		latency := time.Since(start)
+
+		m.write(c, latency, body.count, err)
+		return err
+	}
+}
+
+// write записывает запрос в лог: ответы 5xx с уровнем error, остальные - info
+func (m *AccessLogMiddleware) write(c echo.Context, latency time.Duration, read int64, err error) {
+	request := c.Request()
+	response := c.Response()
+
+	route := c.Path()
+	if route == "" {
+		route = request.URL.Path
+	}
+	bytesIn := request.ContentLength
+	if bytesIn < 0 {
+		bytesIn = read
+	}
+
+	fields := logging.Fields{
+		"method":     request.Method,
+		"route":      route,
+		"status":     response.Status,
+		"latency_ms": float64(latency.Nanoseconds()) / 1e6,
+		"bytes_in":   bytesIn,
+		"bytes_out":  response.Size,
+		"remote_ip":  c.RealIP(),
+	}
+	if principal := PrincipalFromContext(c); principal != nil {
+		fields["user"] = principal.Subject
+	}
+	if m.config.TenantHeader != "" {
+		if tenant := request.Header.Get(m.config.TenantHeader); tenant != "" {
+			fields["tenant"] = tenant
+		}
+	}
+
+	logger := requestLogger(c, m.logger).WithFields(fields)
+	if response.Status >= http.StatusInternalServerError {
+		if err != nil {
+			logger = logger.WithError(err)
+		}
+		logger.Error("HTTP запрос")
+		return
+	}
+	logger.Info("HTTP запрос")
+}
+
+// countingReader считает байты тела запроса, прочитанные обработчиком
+type countingReader struct {
+	reader io.ReadCloser
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.reader.Close()
+}
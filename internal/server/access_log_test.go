@@ -0,0 +1,210 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// accessLogSecrets учетные данные и токены запросов, которые не должны попасть в журнал
+var accessLogSecrets = []string{"bearer-secret", "key-secret", "session-secret", "query-secret", "signature-secret", "valid"}
+
+// newAccessLogTestServer создает сервер с журналом запросов и аутентификацией tokenAuthenticator
+// в порядке setupMiddleware и возвращает записанные журналом события
+func newAccessLogTestServer() (*echo.Echo, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := logging.NewZap(zap.New(core))
+
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(requestIDContext)
+	NewAccessLogMiddleware(config.AccessLog{
+		Enabled:      true,
+		TenantHeader: "X-Tenant-ID",
+		SkipPaths:    []string{"/health"},
+	}, logger).Apply(e)
+	NewAuthMiddleware(logging.Nop(), tokenAuthenticator{}).Apply(e)
+
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET(APIPrefix+"/reports/:id", func(c echo.Context) error {
+		time.Sleep(5 * time.Millisecond)
+		return c.String(http.StatusOK, "report")
+	})
+	e.POST(APIPrefix+"/reports", func(c echo.Context) error {
+		var body map[string]interface{}
+		if err := c.Bind(&body); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusCreated)
+	})
+	e.GET(APIPrefix+"/reports/:id/file", func(c echo.Context) error {
+		return errors.New("ошибка хранилища")
+	})
+	return e, logs
+}
+
+// accessLogEntry выполняет запрос и возвращает единственную запись журнала о нем
+func accessLogEntry(t *testing.T, e *echo.Echo, logs *observer.ObservedLogs, request *http.Request) (observer.LoggedEntry, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 1)
+	assert.Equal(t, "HTTP запрос", entries[0].Message)
+	return entries[0], recorder
+}
+
+// withCredentials добавляет в запрос учетные данные во всех заголовках, которые читает сервис
+func withCredentials(request *http.Request) *http.Request {
+	request.Header.Set(HeaderAuthorization, "Bearer bearer-secret")
+	request.Header.Set(HeaderAPIKey, "key-secret")
+	request.Header.Set("X-Test-Token", "valid")
+	request.AddCookie(&http.Cookie{Name: "session", Value: "session-secret"})
+	return request
+}
+
+func TestAccessLogFields(t *testing.T) {
+	e, logs := newAccessLogTestServer()
+
+	request := withCredentials(httptest.NewRequest(http.MethodGet, APIPrefix+"/reports/7?token=query-secret&signature=signature-secret", nil))
+	request.Header.Set("X-Tenant-ID", "acme")
+	request.Header.Set(echo.HeaderXRealIP, "203.0.113.7")
+	entry, response := accessLogEntry(t, e, logs, request)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	fields := entry.ContextMap()
+	assert.Equal(t, zapcore.InfoLevel, entry.Level)
+	assert.Equal(t, http.MethodGet, fields["method"])
+	// Маршрут записывается шаблоном, без ID и параметров запроса
+	assert.Equal(t, APIPrefix+"/reports/:id", fields["route"])
+	assert.Equal(t, int64(http.StatusOK), fields["status"])
+	assert.GreaterOrEqual(t, fields["latency_ms"], float64(5))
+	assert.Equal(t, int64(0), fields["bytes_in"])
+	assert.Equal(t, int64(len("report")), fields["bytes_out"])
+	assert.Equal(t, "203.0.113.7", fields["remote_ip"])
+	assert.Equal(t, "john.doe", fields["user"])
+	assert.Equal(t, "acme", fields["tenant"])
+	requestID := response.Header().Get(echo.HeaderXRequestID)
+	require.NotEmpty(t, requestID)
+	assert.Equal(t, requestID, fields[logging.RequestIDKey])
+
+	assertNoSecrets(t, entry)
+}
+
+func TestAccessLogRequestBody(t *testing.T) {
+	e, logs := newAccessLogTestServer()
+
+	// Размер тела без Content-Length считается по прочитанным байтам, само тело не пишется
+	body := `{"title":"Продажи","password":"body-secret"}`
+	request := httptest.NewRequest(http.MethodPost, APIPrefix+"/reports", strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.Header.Set("X-Test-Token", "valid")
+	request.ContentLength = -1
+	entry, response := accessLogEntry(t, e, logs, request)
+	require.Equal(t, http.StatusCreated, response.Code)
+
+	fields := entry.ContextMap()
+	assert.Equal(t, int64(len(body)), fields["bytes_in"])
+	assert.NotContains(t, fields, "tenant")
+	assert.NotContains(t, fmt.Sprint(fields), "body-secret")
+}
+
+func TestAccessLogErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		request *http.Request
+		token   string
+		route   string
+		status  int
+		level   zapcore.Level
+		user    string
+	}{
+		{
+			name:    "неверные учетные данные",
+			request: withCredentials(httptest.NewRequest(http.MethodGet, APIPrefix+"/reports/7?api_key=query-secret", nil)),
+			token:   "forged",
+			route:   APIPrefix + "/reports/:id",
+			status:  http.StatusUnauthorized,
+			level:   zapcore.InfoLevel,
+		},
+		{
+			name:    "неизвестный маршрут",
+			request: withCredentials(httptest.NewRequest(http.MethodGet, "/unknown?token=query-secret", nil)),
+			token:   "valid",
+			route:   "/unknown",
+			status:  http.StatusNotFound,
+			level:   zapcore.InfoLevel,
+			user:    "john.doe",
+		},
+		{
+			name:    "ошибка обработчика",
+			request: withCredentials(httptest.NewRequest(http.MethodGet, APIPrefix+"/reports/7/file?signature=signature-secret", nil)),
+			token:   "valid",
+			route:   APIPrefix + "/reports/:id/file",
+			status:  http.StatusInternalServerError,
+			level:   zapcore.ErrorLevel,
+			user:    "john.doe",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, logs := newAccessLogTestServer()
+			tt.request.Header.Set("X-Test-Token", tt.token)
+
+			entry, response := accessLogEntry(t, e, logs, tt.request)
+			require.Equal(t, tt.status, response.Code)
+
+			// Журнал содержит итоговый статус ответа, а не статус до обработки ошибки
+			fields := entry.ContextMap()
+			assert.Equal(t, tt.level, entry.Level)
+			assert.Equal(t, tt.route, fields["route"])
+			assert.Equal(t, int64(tt.status), fields["status"])
+			if tt.user != "" {
+				assert.Equal(t, tt.user, fields["user"])
+			} else {
+				assert.NotContains(t, fields, "user")
+			}
+			assert.NotEmpty(t, fields[logging.RequestIDKey])
+			if tt.level == zapcore.ErrorLevel {
+				assert.Equal(t, "ошибка хранилища", fields[logging.ErrorKey])
+			}
+			assertNoSecrets(t, entry)
+		})
+	}
+}
+
+func TestAccessLogSkipPaths(t *testing.T) {
+	e, logs := newAccessLogTestServer()
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Zero(t, logs.Len())
+}
+
+// assertNoSecrets проверяет, что запись журнала не содержит учетных данных и токенов запроса
+func assertNoSecrets(t *testing.T, entry observer.LoggedEntry) {
+	t.Helper()
+	logged := entry.Message + " " + fmt.Sprint(entry.ContextMap())
+	for _, secret := range accessLogSecrets {
+		assert.NotContains(t, logged, secret)
+	}
+	for _, field := range []string{"query", "headers", "authorization", "cookie", "uri", "url"} {
+		assert.NotContains(t, entry.ContextMap(), field)
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// UserActivityParams параметры списка активности пользователей
+type UserActivityParams struct {
+	Period string `query:"period" validate:"omitempty,oneof=1h 24h 7d"`
+	Limit  int    `query:"limit" validate:"min=0,max=500"`
+}
+
+// RequeueFailedRequest запрос на повторный запуск упавших отчетов
+type RequeueFailedRequest struct {
+	// Since отчеты, упавшие не раньше, пусто - за все время
+	Since     *time.Time `json:"since"`
+	CreatedBy string     `json:"created_by" validate:"max=255"`
+	Limit     int        `json:"limit" validate:"min=0,max=1000"`
+}
+
+// AdminHandler обработчик административного дашборда: обзор сервиса, активность пользователей
+// и обслуживание очереди задач
+type AdminHandler struct {
+	service        service.AdminService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewAdminHandler создает новый обработчик административного дашборда
+func NewAdminHandler(service service.AdminService, logger logging.Logger) Handler {
+	return &AdminHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршруты административного дашборда
+func (h *AdminHandler) Register(group *echo.Group) {
+	admin := group.Group("/admin")
+	{
+		admin.GET("/overview", h.getOverview)
+		admin.GET("/users", h.listUserActivity)
+		admin.GET("/users/:user", h.getUserActivity)
+		admin.POST("/queue/pause", h.pauseQueue)
+		admin.POST("/queue/resume", h.resumeQueue)
+		admin.POST("/queue/drain", h.drainQueue)
+		admin.POST("/reports/requeue-failed", h.requeueFailed)
+		admin.GET("/dead-letters", h.listDeadLetters)
+		admin.POST("/dead-letters/:id/requeue", h.requeueDeadLetter)
+	}
+}
+
+// getOverview возвращает состояние очереди, отчеты по статусам, занятое место и последние ошибки
+func (h *AdminHandler) getOverview(c echo.Context) error {
+	overview, err := h.service.Overview(c.Request().Context())
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, overview)
+}
+
+// listUserActivity возвращает активность пользователей за период
+func (h *AdminHandler) listUserActivity(c echo.Context) error {
+	var params UserActivityParams
+
+	if err := c.Bind(&params); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&params); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	activity, err := h.service.ListUserActivity(c.Request().Context(), params.Period, params.Limit)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, activity)
+}
+
+// getUserActivity возвращает активность пользователя и его последние отчеты
+func (h *AdminHandler) getUserActivity(c echo.Context) error {
+	details, err := h.service.GetUserActivity(c.Request().Context(), c.Param("user"), c.QueryParam("period"))
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, details)
+}
+
+// pauseQueue приостанавливает запуск задач из очереди
+func (h *AdminHandler) pauseQueue(c echo.Context) error {
+	state, err := h.service.PauseQueue(c.Request().Context())
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	requestLogger(c, h.logger).Warn("Очередь задач приостановлена через административный API")
+	return h.responseWriter.Success(c, state)
+}
+
+// resumeQueue возобновляет запуск задач из очереди
+func (h *AdminHandler) resumeQueue(c echo.Context) error {
+	state, err := h.service.ResumeQueue(c.Request().Context())
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	requestLogger(c, h.logger).Info("Очередь задач возобновлена через административный API")
+	return h.responseWriter.Success(c, state)
+}
+
+// drainQueue приостанавливает очередь и ожидает завершения выполняющихся задач
+func (h *AdminHandler) drainQueue(c echo.Context) error {
+	timeout := service.DefaultDrainTimeout
+	if value := c.QueryParam("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > service.MaxDrainTimeout {
+			return h.responseWriter.ValidationError(c,
+				fmt.Errorf("параметр timeout должен быть числом секунд от 1 до %d", int(service.MaxDrainTimeout.Seconds())))
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	result, err := h.service.DrainQueue(c.Request().Context(), timeout)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	requestLogger(c, h.logger).WithFields(logging.Fields{
+		"drained": result.Drained,
+		"running": result.Queue.Running,
+	}).Warn("Очередь задач остановлена через административный API")
+	return h.responseWriter.Success(c, result)
+}
+
+// requeueFailed ставит упавшие отчеты в очередь повторно
+func (h *AdminHandler) requeueFailed(c echo.Context) error {
+	var req RequeueFailedRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	result, err := h.service.RequeueFailed(c.Request().Context(), service.RequeueFailedParams{
+		Since:     req.Since,
+		CreatedBy: req.CreatedBy,
+		Limit:     req.Limit,
+	})
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, result)
+}
+
+// listDeadLetters возвращает задачи, исчерпавшие попытки, с пагинацией
+func (h *AdminHandler) listDeadLetters(c echo.Context) error {
+	var pagination PaginationParams
+	pagination.Page = 1
+	pagination.PageSize = DefaultPageSize
+
+	if err := c.Bind(&pagination); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&pagination); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	params := service.DeadLetterListParams{
+		Page:     pagination.Page,
+		PageSize: pagination.PageSize,
+	}
+
+	if value := c.QueryParam("requeued"); value != "" {
+		requeued, err := strconv.ParseBool(value)
+		if err != nil {
+			return h.responseWriter.ValidationError(c, fmt.Errorf("неверное значение requeued"))
+		}
+		params.Requeued = requeued
+	}
+
+	list, err := h.service.ListDeadLetters(c.Request().Context(), params)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &APIResponse{
+		Success: true,
+		Data:    list.DeadLetters,
+		Meta: &APIMeta{
+			Page:       list.Page,
+			PageSize:   list.PageSize,
+			Total:      int(list.Total),
+			TotalPages: list.TotalPages,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// requeueDeadLetter ставит отчет задачи, исчерпавшей попытки, в очередь повторно
+func (h *AdminHandler) requeueDeadLetter(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID задачи"))
+	}
+
+	letter, err := h.service.RequeueDeadLetter(c.Request().Context(), id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	requestLogger(c, h.logger).WithFields(logging.Fields{
+		"dead_letter_id": letter.ID,
+		"report_id":      letter.ReportID,
+	}).Info("Задача, исчерпавшая попытки, поставлена в очередь повторно")
+	return h.responseWriter.Success(c, letter)
+}
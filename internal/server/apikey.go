@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// CreateAPIKeyRequest запрос на создание API ключа
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,min=1,max=255"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// CreatedBy создатель ключа, при аутентификации - клиент запроса
+	CreatedBy string `json:"created_by" validate:"max=255"`
+}
+
+// CreateAPIKeyResponse созданный API ключ. Значение ключа возвращается только один раз.
+type CreateAPIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey *models.APIKey `json:"api_key"`
+}
+
+// APIKeyHandler обработчик административного API ключей доступа
+type APIKeyHandler struct {
+	service        service.APIKeyService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewAPIKeyHandler создает новый обработчик API ключей
+func NewAPIKeyHandler(service service.APIKeyService, logger logging.Logger) Handler {
+	return &APIKeyHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршруты API ключей
+func (h *APIKeyHandler) Register(group *echo.Group) {
+	keys := group.Group("/admin/api-keys")
+	{
+		keys.GET("", h.listAPIKeys)
+		keys.POST("", h.createAPIKey)
+		keys.DELETE("/:id", h.revokeAPIKey)
+	}
+}
+
+// listAPIKeys возвращает неотозванные API ключи без их значений
+func (h *APIKeyHandler) listAPIKeys(c echo.Context) error {
+	keys, err := h.service.ListAPIKeys(c.Request().Context())
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, keys)
+}
+
+// createAPIKey создает API ключ
+func (h *APIKeyHandler) createAPIKey(c echo.Context) error {
+	var req CreateAPIKeyRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.CreatedBy = requestActor(c, req.CreatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	key := &models.APIKey{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		CreatedBy: req.CreatedBy,
+	}
+	value, err := h.service.CreateAPIKey(c.Request().Context(), key)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKeyRequest) {
+			return h.responseWriter.ValidationError(c, err)
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, &APIResponse{
+		Success:   true,
+		Data:      &CreateAPIKeyResponse{Key: value, APIKey: key},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// revokeAPIKey отзывает API ключ
+func (h *APIKeyHandler) revokeAPIKey(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID ключа"))
+	}
+
+	if err := h.service.RevokeAPIKey(c.Request().Context(), id); err != nil {
+		if errors.Is(err, service.ErrAPIKeyNotFound) {
+			return h.responseWriter.NotFound(c, "API ключ не найден")
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "API ключ отозван",
+	})
+}
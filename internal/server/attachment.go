@@ -0,0 +1,152 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AttachmentHandler обработчик приложенных к отчетам файлов
+type AttachmentHandler struct {
+	service        service.AttachmentService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+}
+
+// NewAttachmentHandler создает новый обработчик приложенных файлов
+func NewAttachmentHandler(service service.AttachmentService, logger logging.Logger) Handler {
+	return &AttachmentHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршруты приложенных файлов
+func (h *AttachmentHandler) Register(group *echo.Group) {
+	attachments := group.Group("/reports/:id/attachments")
+	{
+		attachments.POST("", h.addAttachment)
+		attachments.GET("", h.listAttachments)
+		attachments.GET("/:attachment_id", h.downloadAttachment)
+		attachments.DELETE("/:attachment_id", h.deleteAttachment)
+	}
+}
+
+// addAttachment прикладывает к отчету файл из тела запроса. Имя файла передается
+// параметром filename, тип содержимого - заголовком Content-Type.
+func (h *AttachmentHandler) addAttachment(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	request := c.Request()
+	contentType := request.Header.Get(echo.HeaderContentType)
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return h.responseWriter.ValidationError(c, fmt.Errorf("неверный заголовок Content-Type"))
+		}
+	}
+
+	attachment, err := h.service.AddAttachment(request.Context(), id, service.AttachmentUpload{
+		Filename:    c.QueryParam("filename"),
+		ContentType: contentType,
+		Size:        request.ContentLength,
+		Reader:      request.Body,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrValidation) {
+			return h.responseWriter.ValidationError(c, err)
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, &APIResponse{
+		Success:   true,
+		Data:      attachment,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// listAttachments возвращает приложенные к отчету файлы
+func (h *AttachmentHandler) listAttachments(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	attachments, err := h.service.ListAttachments(c.Request().Context(), id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, attachments)
+}
+
+// downloadAttachment отдает приложенный файл потоком
+func (h *AttachmentHandler) downloadAttachment(c echo.Context) error {
+	id, attachmentID, err := h.attachmentParams(c)
+	if err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	file, err := h.service.OpenAttachment(c.Request().Context(), id, attachmentID)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	defer file.Reader.Close()
+
+	// Приложенный файл всегда скачивается: его содержимое не проверялось
+	header := c.Response().Header()
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": file.Filename,
+	}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	if file.Checksum != "" {
+		header.Set(HeaderChecksumSHA256, file.Checksum)
+	}
+
+	reader, err := encodeResponse(c, file.Reader, file.ContentEncoding, file.Size)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	return c.Stream(http.StatusOK, file.ContentType, reader)
+}
+
+// deleteAttachment удаляет приложенный файл
+func (h *AttachmentHandler) deleteAttachment(c echo.Context) error {
+	id, attachmentID, err := h.attachmentParams(c)
+	if err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.service.DeleteAttachment(c.Request().Context(), id, attachmentID); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "Приложенный файл удален",
+	})
+}
+
+// attachmentParams разбирает ID отчета и приложенного файла из пути
+func (h *AttachmentHandler) attachmentParams(c echo.Context) (uint, uint, error) {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return 0, 0, fmt.Errorf("неверный ID отчета")
+	}
+	attachmentID, err := parseUintParam(c, "attachment_id")
+	if err != nil {
+		return 0, 0, fmt.Errorf("неверный ID приложенного файла")
+	}
+	return id, attachmentID, nil
+}
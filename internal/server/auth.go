@@ -0,0 +1,227 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrInvalidCredentials учетные данные запроса не прошли проверку
+var ErrInvalidCredentials = errors.New("недействительные учетные данные")
+
+const (
+	// HeaderAPIKey заголовок с API ключом
+	HeaderAPIKey = "X-API-Key"
+
+	// principalContextKey ключ аутентифицированного клиента в контексте запроса
+	principalContextKey = "principal"
+	// headerAuthContextKey ключ отметки об успешной аутентификации по заголовкам запроса
+	headerAuthContextKey = "header_auth"
+)
+
+// Principal аутентифицированный клиент API
+type Principal struct {
+	// Subject имя клиента, для API ключа - apikey:<название ключа>
+	Subject string
+	Scopes  models.Scopes
+	// Roles роли пользователя из токена OIDC
+	Roles []string
+	// Method способ аутентификации: api_key, admin_key или oidc
+	Method string
+}
+
+// PrincipalFromContext возвращает аутентифицированного клиента запроса
+// или nil, если аутентификация выключена
+func PrincipalFromContext(c echo.Context) *Principal {
+	principal, _ := c.Get(principalContextKey).(*Principal)
+	return principal
+}
+
+// HeaderAuthenticated сообщает, прошел ли запрос аутентификацию по ключу или токену
+// из заголовков. Все способы аутентификации читают учетные данные из заголовков.
+func HeaderAuthenticated(c echo.Context) bool {
+	authenticated, _ := c.Get(headerAuthContextKey).(bool)
+	return authenticated
+}
+
+// requestActor возвращает автора изменения: аутентифицированного клиента запроса,
+// а без аутентификации - значение claimed из тела запроса
+func requestActor(c echo.Context, claimed string) string {
+	if principal := PrincipalFromContext(c); principal != nil {
+		return principal.Subject
+	}
+	return claimed
+}
+
+// Authenticator проверяет учетные данные запроса одного вида
+type Authenticator interface {
+	// Authenticate возвращает клиента запроса или nil, nil, если учетных данных этого вида в запросе нет
+	Authenticate(c echo.Context) (*Principal, error)
+}
+
+// APIKeyAuthenticator проверяет API ключ из заголовка X-API-Key или Authorization: Bearer
+type APIKeyAuthenticator struct {
+	keys     service.APIKeyService
+	adminKey string
+}
+
+// NewAPIKeyAuthenticator создает проверку API ключей. Ключ adminKey, если задан,
+// дает область admin и нужен для создания первых ключей.
+func NewAPIKeyAuthenticator(keys service.APIKeyService, adminKey string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{keys: keys, adminKey: adminKey}
+}
+
+// Authenticate проверяет API ключ запроса. В Authorization: Bearer API ключ
+// распознается по префиксу, остальные токены остаются другим способам аутентификации.
+func (a *APIKeyAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	value := c.Request().Header.Get(HeaderAPIKey)
+	if value == "" {
+		token, found := strings.CutPrefix(c.Request().Header.Get(HeaderAuthorization), "Bearer ")
+		if !found || !strings.HasPrefix(token, service.APIKeyPrefix) {
+			return nil, nil
+		}
+		value = token
+	}
+
+	if a.adminKey != "" && subtle.ConstantTimeCompare([]byte(value), []byte(a.adminKey)) == 1 {
+		return &Principal{Subject: "admin", Scopes: models.Scopes{models.ScopeAdmin}, Method: "admin_key"}, nil
+	}
+
+	key, err := a.keys.Authenticate(c.Request().Context(), value)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: "apikey:" + key.Name, Scopes: key.Scopes, Method: "api_key"}, nil
+}
+
+// AuthMiddleware требует аутентификации для маршрутов API и проверяет область доступа
+// клиента. Клиент передается сервисам в контексте запроса как автор изменений, вместе с разрешением
+// на персональные данные без маскирования. Health check, файлы по подписанным и публичным ссылкам и вход через OIDC
+// доступны без аутентификации.
+type AuthMiddleware struct {
+	authenticators []Authenticator
+	logger         logging.Logger
+}
+
+// NewAuthMiddleware создает middleware аутентификации. Способы проверяются по порядку,
+// используется первый, нашедший в запросе свои учетные данные.
+func NewAuthMiddleware(logger logging.Logger, authenticators ...Authenticator) *AuthMiddleware {
+	return &AuthMiddleware{authenticators: authenticators, logger: logger}
+}
+
+// Apply подключает middleware к серверу
+func (m *AuthMiddleware) Apply(e *echo.Echo) {
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isPublicRoute(c) {
+				return next(c)
+			}
+
+			principal, err := m.authenticate(c)
+			if err != nil {
+				if errors.Is(err, service.ErrInvalidAPIKey) || errors.Is(err, ErrInvalidCredentials) {
+					return authError(c, http.StatusUnauthorized, "UNAUTHORIZED", "Недействительные учетные данные")
+				}
+				requestLogger(c, m.logger).WithError(err).Error("Ошибка аутентификации запроса")
+				return authError(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Внутренняя ошибка сервера")
+			}
+			if principal == nil {
+				return authError(c, http.StatusUnauthorized, "UNAUTHORIZED", "Требуется аутентификация")
+			}
+
+			if scope := requiredScope(c); scope != "" && !principal.Scopes.Allows(scope) {
+				requestLogger(c, m.logger).WithFields(logging.Fields{
+					"subject": principal.Subject,
+					"scope":   scope,
+					"path":    c.Path(),
+				}).Warn("Недостаточно прав для запроса")
+				return authError(c, http.StatusForbidden, "FORBIDDEN", "Недостаточно прав: требуется область "+scope)
+			}
+
+			c.Set(principalContextKey, principal)
+			c.Set(headerAuthContextKey, true)
+			ctx := service.WithActor(c.Request().Context(), principal.Subject)
+			if principal.Scopes.Allows(models.ScopeUnmasked) {
+				ctx = service.WithUnmasked(ctx)
+			}
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	})
+}
+
+// authenticate проверяет учетные данные запроса способами аутентификации по порядку
+func (m *AuthMiddleware) authenticate(c echo.Context) (*Principal, error) {
+	for _, authenticator := range m.authenticators {
+		principal, err := authenticator.Authenticate(c)
+		if err != nil || principal != nil {
+			return principal, err
+		}
+	}
+	return nil, nil
+}
+
+// isPublicRoute проверяет, доступен ли маршрут без аутентификации
+func isPublicRoute(c echo.Context) bool {
+	path := c.Path()
+	return c.Request().Method == http.MethodOptions ||
+		path == "/health" || strings.HasPrefix(path, "/health/") ||
+		path == APIPrefix+FilesRoute || path == APIPrefix+SharedRoute ||
+		path == APIPrefix+OIDCLoginRoute
+}
+
+// requiredScope возвращает область доступа маршрута: admin для административного API,
+// иначе <ресурс>:read для чтения и <ресурс>:write для изменений. GraphQL, статистика, нарушения SLA
+// и файлы с данными относятся к отчетам, запросы к GraphQL отправляются методом POST и требуют reports:write.
+func requiredScope(c echo.Context) string {
+	path, found := strings.CutPrefix(c.Path(), APIPrefix+"/")
+	if !found {
+		return ""
+	}
+
+	resource, _, _ := strings.Cut(path, "/")
+	switch resource {
+	case "admin":
+		return models.ScopeAdmin
+	case "graphql", "stats", "sla", "datasets":
+		resource = "reports"
+	case "reports", "definitions", "schedules":
+	default:
+		return ""
+	}
+
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead:
+		return resource + ":read"
+	default:
+		return resource + ":write"
+	}
+}
+
+// authError отправляет ответ с ошибкой аутентификации или доступа
+func authError(c echo.Context, status int, code, message string) error {
+	if status == http.StatusUnauthorized {
+		// Перебор учетных данных с адреса, исчерпавшего лимит, отклоняется как превышение лимита
+		if limited, err := rejectLimitedAddress(c); limited {
+			return err
+		}
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+	}
+	return c.JSON(status, &APIResponse{
+		Success: false,
+		Error: &APIError{
+			Code:    code,
+			Message: message,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
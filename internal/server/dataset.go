@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DatasetHandler обработчик загруженных файлов с данными для отчетов
+type DatasetHandler struct {
+	service        service.DatasetService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+}
+
+// NewDatasetHandler создает новый обработчик файлов с данными
+func NewDatasetHandler(service service.DatasetService, logger logging.Logger) Handler {
+	return &DatasetHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршруты файлов с данными
+func (h *DatasetHandler) Register(group *echo.Group) {
+	datasets := group.Group("/datasets")
+	{
+		datasets.POST("", h.uploadDataset)
+		datasets.GET("", h.listDatasets)
+		datasets.GET("/:id", h.getDataset)
+		datasets.DELETE("/:id", h.deleteDataset)
+	}
+}
+
+// uploadDataset загружает файл CSV или XLSX из тела запроса. Имя файла передается
+// параметром filename, формат определяется по его расширению.
+func (h *DatasetHandler) uploadDataset(c echo.Context) error {
+	request := c.Request()
+	dataset, err := h.service.UploadDataset(request.Context(), service.DatasetUpload{
+		Filename: c.QueryParam("filename"),
+		Size:     request.ContentLength,
+		Reader:   request.Body,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrValidation) {
+			return h.responseWriter.ValidationError(c, err)
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, &APIResponse{
+		Success:   true,
+		Data:      dataset,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// listDatasets возвращает файлы, загруженные текущим пользователем
+func (h *DatasetHandler) listDatasets(c echo.Context) error {
+	datasets, err := h.service.ListDatasets(c.Request().Context())
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, datasets)
+}
+
+// getDataset возвращает сведения о файле: колонки и число строк
+func (h *DatasetHandler) getDataset(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID файла с данными"))
+	}
+
+	dataset, err := h.service.GetDataset(c.Request().Context(), id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, dataset)
+}
+
+// deleteDataset удаляет файл с данными
+func (h *DatasetHandler) deleteDataset(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID файла с данными"))
+	}
+
+	if err := h.service.DeleteDataset(c.Request().Context(), id); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "Файл с данными удален",
+	})
+}
@@ -0,0 +1,408 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// DefinitionQueryRequest запрос определения отчета: SQL, загруженный файл, запрос к API
+// или производный набор. Сочетание полей проверяется при валидации определения
+type DefinitionQueryRequest struct {
+	Name    string          `json:"name" validate:"required,max=100"`
+	SQL     string          `json:"sql"`
+	Source  string          `json:"source" validate:"max=100"`
+	Dataset string          `json:"dataset" validate:"max=100"`
+	Path    string          `json:"path" validate:"max=2000"`
+	Rows    string          `json:"rows" validate:"max=255"`
+	Derived *models.Derived `json:"derived"`
+	Hidden  bool            `json:"hidden"`
+	Sheet   string          `json:"sheet" validate:"max=31"`
+}
+
+// CreateDefinitionRequest запрос на создание определения отчета
+type CreateDefinitionRequest struct {
+	Name                 string                      `json:"name" validate:"required,min=1,max=100"`
+	Description          string                      `json:"description" validate:"max=1000"`
+	Queries              []DefinitionQueryRequest    `json:"queries" validate:"required,min=1,dive"`
+	TemplateKey          string                      `json:"template_key" validate:"max=255"`
+	ParameterSchema      map[string]interface{}      `json:"parameter_schema"`
+	Format               string                      `json:"format" validate:"omitempty,report_format"`
+	ExcelLayout          *models.ExcelLayout         `json:"excel_layout"`
+	ColumnMapping        *models.ColumnMapping       `json:"column_mapping"`
+	Masking              models.MaskingRules         `json:"masking"`
+	Iterator             *models.Iterator            `json:"iterator"`
+	MaxConcurrentRuns    int                         `json:"max_concurrent_runs" validate:"min=0"`
+	DedupeWindow         string                      `json:"dedupe_window" validate:"max=50"`
+	SLA                  *models.SLA                 `json:"sla"`
+	NotificationChannels models.NotificationChannels `json:"notification_channels"`
+	Document             *models.DocumentOptions     `json:"document"`
+	CreatedBy            string                      `json:"created_by" validate:"required,min=1,max=255"`
+}
+
+// UpdateDefinitionRequest запрос на обновление определения отчета
+type UpdateDefinitionRequest struct {
+	Description          *string                      `json:"description" validate:"omitempty,max=1000"`
+	Queries              []DefinitionQueryRequest     `json:"queries" validate:"omitempty,min=1,dive"`
+	TemplateKey          *string                      `json:"template_key" validate:"omitempty,max=255"`
+	ParameterSchema      map[string]interface{}       `json:"parameter_schema"`
+	Format               *string                      `json:"format" validate:"omitempty,report_format"`
+	ExcelLayout          *models.ExcelLayout          `json:"excel_layout"`
+	ColumnMapping        *models.ColumnMapping        `json:"column_mapping"`
+	Masking              *models.MaskingRules         `json:"masking"`
+	Iterator             *models.Iterator             `json:"iterator"`
+	MaxConcurrentRuns    *int                         `json:"max_concurrent_runs" validate:"omitempty,min=0"`
+	DedupeWindow         *string                      `json:"dedupe_window" validate:"omitempty,max=50"`
+	SLA                  *models.SLA                  `json:"sla"`
+	NotificationChannels *models.NotificationChannels `json:"notification_channels"`
+	Document             *models.DocumentOptions      `json:"document"`
+	UpdatedBy            string                       `json:"updated_by" validate:"required,min=1,max=255"`
+}
+
+// ValidateDefinitionRequest определение отчета для проверки перед сохранением. Поля те же, что
+// при создании, ошибки в них возвращаются списком проблем, а не ошибкой валидации запроса.
+type ValidateDefinitionRequest struct {
+	Name                 string                      `json:"name"`
+	Description          string                      `json:"description"`
+	Queries              []DefinitionQueryRequest    `json:"queries"`
+	TemplateKey          string                      `json:"template_key"`
+	ParameterSchema      map[string]interface{}      `json:"parameter_schema"`
+	Format               string                      `json:"format"`
+	ExcelLayout          *models.ExcelLayout         `json:"excel_layout"`
+	ColumnMapping        *models.ColumnMapping       `json:"column_mapping"`
+	Masking              models.MaskingRules         `json:"masking"`
+	Iterator             *models.Iterator            `json:"iterator"`
+	MaxConcurrentRuns    int                         `json:"max_concurrent_runs"`
+	DedupeWindow         string                      `json:"dedupe_window"`
+	SLA                  *models.SLA                 `json:"sla"`
+	NotificationChannels models.NotificationChannels `json:"notification_channels"`
+	Document             *models.DocumentOptions     `json:"document"`
+}
+
+// DefinitionPauseRequest запрос на приостановку или возобновление расписаний определения
+type DefinitionPauseRequest struct {
+	UpdatedBy string `json:"updated_by" validate:"required,min=1,max=255"`
+}
+
+// DefinitionHandler обработчик для определений отчетов
+type DefinitionHandler struct {
+	service        service.DefinitionService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewDefinitionHandler создает новый обработчик определений отчетов
+func NewDefinitionHandler(service service.DefinitionService, logger logging.Logger) Handler {
+	return &DefinitionHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршруты для определений отчетов
+func (h *DefinitionHandler) Register(group *echo.Group) {
+	definitions := group.Group("/definitions")
+	{
+		definitions.POST("", h.createDefinition)
+		definitions.POST("/validate", h.validateDefinition)
+		definitions.GET("", h.listDefinitions)
+		definitions.GET("/:id", h.getDefinition)
+		definitions.PUT("/:id", h.updateDefinition)
+		definitions.DELETE("/:id", h.deleteDefinition)
+		definitions.POST("/:id/pause", h.pauseSchedules)
+		definitions.POST("/:id/resume", h.resumeSchedules)
+	}
+}
+
+// createDefinition создает новое определение отчета
+func (h *DefinitionHandler) createDefinition(c echo.Context) error {
+	var req CreateDefinitionRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.CreatedBy = requestActor(c, req.CreatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	definition := &models.ReportDefinition{
+		Name:                 req.Name,
+		Description:          req.Description,
+		Queries:              toQueries(req.Queries),
+		TemplateKey:          req.TemplateKey,
+		ParameterSchema:      req.ParameterSchema,
+		Format:               models.ReportFormat(req.Format),
+		ExcelLayout:          req.ExcelLayout,
+		ColumnMapping:        req.ColumnMapping,
+		Masking:              req.Masking,
+		Iterator:             req.Iterator,
+		MaxConcurrentRuns:    req.MaxConcurrentRuns,
+		DedupeWindow:         req.DedupeWindow,
+		SLA:                  req.SLA,
+		NotificationChannels: req.NotificationChannels,
+		Document:             req.Document,
+		CreatedBy:            req.CreatedBy,
+		UpdatedBy:            req.CreatedBy,
+	}
+
+	if err := h.service.CreateDefinition(c.Request().Context(), definition); err != nil {
+		if isDefinitionValidationError(err) {
+			return h.responseWriter.ValidationError(c, err)
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, &APIResponse{
+		Success:   true,
+		Data:      definition,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// validateDefinition проверяет определение отчета без сохранения и возвращает список найденных ошибок
+func (h *DefinitionHandler) validateDefinition(c echo.Context) error {
+	var req ValidateDefinitionRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	// Автор определения берется сервисом из аутентификации запроса
+	definition := &models.ReportDefinition{
+		Name:                 req.Name,
+		Description:          req.Description,
+		Queries:              toQueries(req.Queries),
+		TemplateKey:          req.TemplateKey,
+		ParameterSchema:      req.ParameterSchema,
+		Format:               models.ReportFormat(req.Format),
+		ExcelLayout:          req.ExcelLayout,
+		ColumnMapping:        req.ColumnMapping,
+		Masking:              req.Masking,
+		Iterator:             req.Iterator,
+		MaxConcurrentRuns:    req.MaxConcurrentRuns,
+		DedupeWindow:         req.DedupeWindow,
+		SLA:                  req.SLA,
+		NotificationChannels: req.NotificationChannels,
+		Document:             req.Document,
+	}
+
+	validation, err := h.service.ValidateDefinition(c.Request().Context(), definition)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, validation)
+}
+
+// listDefinitions возвращает список определений отчетов с пагинацией
+func (h *DefinitionHandler) listDefinitions(c echo.Context) error {
+	var pagination PaginationParams
+	pagination.Page = 1
+	pagination.PageSize = DefaultPageSize
+
+	if err := c.Bind(&pagination); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&pagination); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	definitionList, err := h.service.ListDefinitions(c.Request().Context(), service.ListDefinitionParams{
+		Page:     pagination.Page,
+		PageSize: pagination.PageSize,
+	})
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &APIResponse{
+		Success: true,
+		Data:    definitionList.Definitions,
+		Meta: &APIMeta{
+			Page:       definitionList.Page,
+			PageSize:   definitionList.PageSize,
+			Total:      int(definitionList.Total),
+			TotalPages: definitionList.TotalPages,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// getDefinition возвращает определение отчета по ID
+func (h *DefinitionHandler) getDefinition(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID определения"))
+	}
+
+	definition, err := h.service.GetDefinition(c.Request().Context(), id)
+	if err != nil {
+		return h.responseWriter.NotFound(c, "Определение отчета не найдено")
+	}
+
+	return h.responseWriter.Success(c, definition)
+}
+
+// updateDefinition обновляет определение отчета
+func (h *DefinitionHandler) updateDefinition(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID определения"))
+	}
+
+	var req UpdateDefinitionRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.UpdatedBy = requestActor(c, req.UpdatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if _, err := h.service.GetDefinition(c.Request().Context(), id); err != nil {
+		return h.responseWriter.NotFound(c, "Определение отчета не найдено")
+	}
+
+	params := service.DefinitionUpdateParams{
+		Description:          req.Description,
+		TemplateKey:          req.TemplateKey,
+		ExcelLayout:          req.ExcelLayout,
+		ColumnMapping:        req.ColumnMapping,
+		Masking:              req.Masking,
+		Iterator:             req.Iterator,
+		MaxConcurrentRuns:    req.MaxConcurrentRuns,
+		DedupeWindow:         req.DedupeWindow,
+		SLA:                  req.SLA,
+		NotificationChannels: req.NotificationChannels,
+		Document:             req.Document,
+		UpdatedBy:            req.UpdatedBy,
+	}
+	if req.Queries != nil {
+		queries := toQueries(req.Queries)
+		params.Queries = &queries
+	}
+	if req.ParameterSchema != nil {
+		parameterSchema := models.JSON(req.ParameterSchema)
+		params.ParameterSchema = &parameterSchema
+	}
+	if req.Format != nil {
+		format := models.ReportFormat(*req.Format)
+		params.Format = &format
+	}
+
+	definition, err := h.service.UpdateDefinition(c.Request().Context(), id, params)
+	if err != nil {
+		if isDefinitionValidationError(err) {
+			return h.responseWriter.ValidationError(c, err)
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, definition)
+}
+
+// deleteDefinition удаляет определение отчета
+func (h *DefinitionHandler) deleteDefinition(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID определения"))
+	}
+
+	if _, err := h.service.GetDefinition(c.Request().Context(), id); err != nil {
+		return h.responseWriter.NotFound(c, "Определение отчета не найдено")
+	}
+
+	if err := h.service.DeleteDefinition(c.Request().Context(), id); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "Определение отчета успешно удалено",
+	})
+}
+
+// pauseSchedules приостанавливает запуски расписаний определения
+func (h *DefinitionHandler) pauseSchedules(c echo.Context) error {
+	return h.setSchedulesPaused(c, true)
+}
+
+// resumeSchedules возобновляет запуски расписаний определения
+func (h *DefinitionHandler) resumeSchedules(c echo.Context) error {
+	return h.setSchedulesPaused(c, false)
+}
+
+// setSchedulesPaused приостанавливает или возобновляет запуски расписаний определения
+func (h *DefinitionHandler) setSchedulesPaused(c echo.Context, paused bool) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID определения"))
+	}
+
+	var req DefinitionPauseRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.UpdatedBy = requestActor(c, req.UpdatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	var definition *models.ReportDefinition
+	if paused {
+		definition, err = h.service.PauseSchedules(c.Request().Context(), id, req.UpdatedBy)
+	} else {
+		definition, err = h.service.ResumeSchedules(c.Request().Context(), id, req.UpdatedBy)
+	}
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, definition)
+}
+
+// toQueries преобразует запросы из тела запроса в модель
+func toQueries(requests []DefinitionQueryRequest) models.Queries {
+	queries := make(models.Queries, 0, len(requests))
+	for _, request := range requests {
+		queries = append(queries, models.Query{
+			Name:    request.Name,
+			SQL:     request.SQL,
+			Source:  request.Source,
+			Dataset: request.Dataset,
+			Path:    request.Path,
+			Rows:    request.Rows,
+			Derived: request.Derived,
+			Hidden:  request.Hidden,
+			Sheet:   request.Sheet,
+		})
+	}
+	return queries
+}
+
+// isDefinitionValidationError проверяет, отклонено ли определение отчета при проверке
+func isDefinitionValidationError(err error) bool {
+	return errors.Is(err, service.ErrInvalidDefinition)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DiffHandler обработчик сравнения двух запусков отчета
+type DiffHandler struct {
+	service        service.DiffService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+}
+
+// NewDiffHandler создает новый обработчик сравнения отчетов
+func NewDiffHandler(service service.DiffService, logger logging.Logger) Handler {
+	return &DiffHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршрут сравнения отчетов
+func (h *DiffHandler) Register(group *echo.Group) {
+	group.GET("/reports/:id/diff/:other_id", h.diffReports)
+}
+
+// diffReports сравнивает отчет с базовым отчетом other_id. Ключевые колонки передаются
+// параметром keys через запятую, format=xlsx возвращает различия книгой Excel.
+func (h *DiffHandler) diffReports(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+	otherID, err := parseUintParam(c, "other_id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID сравниваемого отчета"))
+	}
+
+	var keys []string
+	for _, key := range strings.Split(c.QueryParam("keys"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	ctx := c.Request().Context()
+	switch format := c.QueryParam("format"); format {
+	case "", "json":
+		diff, err := h.service.DiffReports(ctx, id, otherID, keys)
+		if err != nil {
+			return h.responseWriter.Error(c, err)
+		}
+		return h.responseWriter.Success(c, diff)
+	case "xlsx":
+		file, err := h.service.DiffWorkbook(ctx, id, otherID, keys)
+		if err != nil {
+			return h.responseWriter.Error(c, err)
+		}
+		defer file.Reader.Close()
+
+		c.Response().Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": file.Filename,
+		}))
+		return c.Stream(http.StatusOK, file.ContentType, file.Reader)
+	default:
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неподдерживаемый формат сравнения: %s", format))
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"report_srv/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Заголовки условных запросов
+const (
+	HeaderETag        = "ETag"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// jsonETag возвращает слабый ETag JSON представления value. ETag слабый, так как
+// ответ может быть сжат gzip, а поля timestamp и request_id ответа в нем не учитываются.
+func jsonETag(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("ошибка вычисления ETag: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// reportFileETag возвращает сильный ETag файла отчета по его SHA-256 или пустую строку,
+// если сумма неизвестна. Сжатый gzip файл, который распаковывается для клиента, - другое
+// представление, поэтому его ETag отличается.
+func reportFileETag(c echo.Context, report *models.Report) string {
+	if report.Checksum == "" {
+		return ""
+	}
+	if strings.HasSuffix(report.FileKey, ".gz") {
+		addVary(c.Response().Header(), echo.HeaderAcceptEncoding)
+	}
+	if decodedForClient(c, report) {
+		return `"` + report.Checksum + `-gunzip"`
+	}
+	return `"` + report.Checksum + `"`
+}
+
+// decodedForClient сообщает, распаковывается ли сжатый gzip файл отчета для клиента,
+// который не принимает gzip
+func decodedForClient(c echo.Context, report *models.Report) bool {
+	return strings.HasSuffix(report.FileKey, ".gz") && !acceptsEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding), "gzip")
+}
+
+// reportArtifactETag возвращает сильный ETag файла формата из архива отчета или перестроенного
+// по снимку данных по его SHA-256
+func reportArtifactETag(report *models.Report, format models.ReportFormat) string {
+	checksum := ""
+	if artifact, found := report.Bundle.Find(format); found {
+		checksum = artifact.Checksum
+	}
+	for _, rendition := range report.Renditions {
+		if rendition.Format == format {
+			checksum = rendition.Checksum
+		}
+	}
+	if checksum == "" {
+		return ""
+	}
+	return `"` + checksum + `"`
+}
+
+// notModified задает заголовок ETag и сообщает, есть ли он в If-None-Match запроса.
+// Если есть, клиент уже получил это представление и ему отвечают 304 без тела.
+func notModified(c echo.Context, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	c.Response().Header().Set(HeaderETag, etag)
+	return etagMatches(c.Request().Header.Get(HeaderIfNoneMatch), etag)
+}
+
+// etagMatches сравнивает ETag со списком If-None-Match слабым сравнением (RFC 9110, 13.1.2)
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary добавляет заголовок запроса в Vary, если его там еще нет
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values(echo.HeaderVary) {
+		for _, existing := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(existing), name) {
+				return
+			}
+		}
+	}
+	header.Add(echo.HeaderVary, name)
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+	"report_srv/internal/storage"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reportFileContent содержимое файла отчета, достаточное для сжатия
+var reportFileContent = "region,total\n" + strings.Repeat("north,10\nsouth,20\n", 200)
+
+// compressedReportTest обработчик отчетов с локальным хранилищем файлов и сжатием ответов,
+// как в setupMiddleware
+type compressedReportTest struct {
+	*reportHandlerTest
+	files service.ReportFileStorage
+}
+
+func newCompressedReportTest(t *testing.T) *compressedReportTest {
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logging.Nop())
+	require.NoError(t, err)
+	files := service.NewReportFileStorage(local, logging.Nop())
+
+	h := newReportHandlerTestWithFiles(t, files)
+	h.e.Use(middleware.GzipWithConfig(middleware.GzipConfig{Level: gzip.DefaultCompression, Skipper: skipCompression}))
+	return &compressedReportTest{reportHandlerTest: h, files: files}
+}
+
+// completedReport создает готовый отчет с файлом content по ключу fileKey
+func (h *compressedReportTest) completedReport(t *testing.T, fileKey string, content []byte) *models.Report {
+	require.NoError(t, h.files.Save(context.Background(), fileKey, bytes.NewReader(content)))
+	sum := sha256.Sum256(content)
+	report := &models.Report{
+		Title:     "Продажи",
+		Format:    models.FormatCSV,
+		Status:    models.StatusCompleted,
+		FileKey:   fileKey,
+		FileSize:  int64(len(content)),
+		Checksum:  hex.EncodeToString(sum[:]),
+		CreatedBy: "alice",
+		UpdatedBy: "alice",
+	}
+	require.NoError(t, h.db.Create(report).Error)
+	return report
+}
+
+// get выполняет GET запрос с заголовками headers
+func (h *compressedReportTest) get(path string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	h.e.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func gunzip(t *testing.T, body []byte) []byte {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return decoded
+}
+
+func TestGetReportETag(t *testing.T) {
+	h := newCompressedReportTest(t)
+	report := h.createReport(t, models.StatusPending)
+	path := reportPath(report.ID)
+	gzipped := map[string]string{echo.HeaderAcceptEncoding: "gzip"}
+
+	// Карточка отчета сжимается, ETag не зависит от сжатия
+	compressed := h.get(path, gzipped)
+	require.Equal(t, http.StatusOK, compressed.Code)
+	assert.Equal(t, "gzip", compressed.Header().Get(echo.HeaderContentEncoding))
+	etag := compressed.Header().Get(HeaderETag)
+	assert.True(t, strings.HasPrefix(etag, `W/"`), etag)
+	assert.Contains(t, string(gunzip(t, compressed.Body.Bytes())), `"title":"Продажи"`)
+
+	plain := h.get(path, nil)
+	require.Equal(t, http.StatusOK, plain.Code)
+	assert.Empty(t, plain.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, etag, plain.Header().Get(HeaderETag))
+
+	// ETag не учитывает timestamp и request_id ответа
+	assert.Equal(t, etag, h.get(path, gzipped).Header().Get(HeaderETag))
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		code        int
+	}{
+		{name: "совпадающий ETag", ifNoneMatch: etag, code: http.StatusNotModified},
+		{name: "сильная форма ETag", ifNoneMatch: strings.TrimPrefix(etag, "W/"), code: http.StatusNotModified},
+		{name: "ETag в списке", ifNoneMatch: `W/"other", ` + etag, code: http.StatusNotModified},
+		{name: "любой ETag", ifNoneMatch: "*", code: http.StatusNotModified},
+		{name: "другой ETag", ifNoneMatch: `W/"other"`, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := h.get(path, map[string]string{echo.HeaderAcceptEncoding: "gzip", HeaderIfNoneMatch: tt.ifNoneMatch})
+			assert.Equal(t, tt.code, response.Code)
+			assert.Equal(t, etag, response.Header().Get(HeaderETag))
+			if tt.code == http.StatusNotModified {
+				assert.Empty(t, response.Body.Bytes())
+			}
+		})
+	}
+
+	// Изменение отчета меняет ETag, и клиент со старым ETag получает новое представление
+	require.Equal(t, http.StatusOK, h.do(http.MethodPatch, path, `{"title":"Продажи за март","updated_by":"bob"}`).Code)
+	changed := h.get(path, map[string]string{echo.HeaderAcceptEncoding: "gzip", HeaderIfNoneMatch: etag})
+	require.Equal(t, http.StatusOK, changed.Code)
+	assert.NotEqual(t, etag, changed.Header().Get(HeaderETag))
+}
+
+func TestReportFileExcludedFromCompression(t *testing.T) {
+	h := newCompressedReportTest(t)
+	report := h.completedReport(t, "reports/sales.csv", []byte(reportFileContent))
+	path := reportPath(report.ID) + "/file"
+	etag := `"` + report.Checksum + `"`
+
+	// Файл отдается как есть даже клиенту, принимающему gzip
+	response := h.get(path, map[string]string{echo.HeaderAcceptEncoding: "gzip"})
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Empty(t, response.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, reportFileContent, response.Body.String())
+	assert.Equal(t, etag, response.Header().Get(HeaderETag))
+	assert.Equal(t, "bytes", response.Header().Get(HeaderAcceptRanges))
+	assert.Equal(t, report.Checksum, response.Header().Get(HeaderChecksumSHA256))
+
+	response = h.get(path, map[string]string{echo.HeaderAcceptEncoding: "gzip", HeaderIfNoneMatch: etag})
+	assert.Equal(t, http.StatusNotModified, response.Code)
+	assert.Empty(t, response.Body.Bytes())
+	assert.Empty(t, response.Header().Get(echo.HeaderContentEncoding))
+}
+
+func TestReportFileRangeExcludedFromCompression(t *testing.T) {
+	h := newCompressedReportTest(t)
+	report := h.completedReport(t, "reports/sales.csv", []byte(reportFileContent))
+	path := reportPath(report.ID) + "/file"
+	etag := `"` + report.Checksum + `"`
+	size := len(reportFileContent)
+
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		code         int
+		body         string
+		contentRange string
+	}{
+		{
+			name:         "начало файла",
+			headers:      map[string]string{HeaderRange: "bytes=0-12"},
+			code:         http.StatusPartialContent,
+			body:         reportFileContent[:13],
+			contentRange: "bytes 0-12/" + strconv.Itoa(size),
+		},
+		{
+			name:         "последние байты",
+			headers:      map[string]string{HeaderRange: "bytes=-9"},
+			code:         http.StatusPartialContent,
+			body:         reportFileContent[size-9:],
+			contentRange: "bytes " + strconv.Itoa(size-9) + "-" + strconv.Itoa(size-1) + "/" + strconv.Itoa(size),
+		},
+		{
+			name:         "If-Range с текущим ETag",
+			headers:      map[string]string{HeaderRange: "bytes=13-", HeaderIfRange: etag},
+			code:         http.StatusPartialContent,
+			body:         reportFileContent[13:],
+			contentRange: "bytes 13-" + strconv.Itoa(size-1) + "/" + strconv.Itoa(size),
+		},
+		{
+			name:    "If-Range с устаревшим ETag",
+			headers: map[string]string{HeaderRange: "bytes=13-", HeaderIfRange: `"stale"`},
+			code:    http.StatusOK,
+			body:    reportFileContent,
+		},
+		{
+			name:         "диапазон за концом файла",
+			headers:      map[string]string{HeaderRange: "bytes=" + strconv.Itoa(size) + "-"},
+			code:         http.StatusRequestedRangeNotSatisfiable,
+			contentRange: "bytes */" + strconv.Itoa(size),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.headers[echo.HeaderAcceptEncoding] = "gzip"
+			response := h.get(path, tt.headers)
+			require.Equal(t, tt.code, response.Code)
+			// Части файла не сжимаются: Content-Range относится к байтам файла
+			assert.Empty(t, response.Header().Get(echo.HeaderContentEncoding))
+			assert.Equal(t, tt.contentRange, response.Header().Get(HeaderContentRange))
+			if tt.body != "" {
+				assert.Equal(t, tt.body, response.Body.String())
+			}
+		})
+	}
+}
+
+func TestGzipReportFileETag(t *testing.T) {
+	h := newCompressedReportTest(t)
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err := writer.Write([]byte(reportFileContent))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	report := h.completedReport(t, "reports/sales.csv.gz", compressed.Bytes())
+	path := reportPath(report.ID) + "/file"
+
+	// Сжатый файл отдается клиенту с gzip без повторного сжатия, ETag - сумма файла
+	response := h.get(path, map[string]string{echo.HeaderAcceptEncoding: "gzip"})
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "gzip", response.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, compressed.Bytes(), response.Body.Bytes())
+	assert.Equal(t, `"`+report.Checksum+`"`, response.Header().Get(HeaderETag))
+	assert.Contains(t, response.Header().Values(echo.HeaderVary), echo.HeaderAcceptEncoding)
+
+	// Клиенту без gzip файл распаковывается, это другое представление со своим ETag
+	response = h.get(path, nil)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Empty(t, response.Header().Get(echo.HeaderContentEncoding))
+	assert.Equal(t, reportFileContent, response.Body.String())
+	assert.Equal(t, `"`+report.Checksum+`-gunzip"`, response.Header().Get(HeaderETag))
+	// Распакованный файл не отдается частями
+	assert.Empty(t, response.Header().Get(HeaderAcceptRanges))
+
+	// ETag одного представления не подходит для другого
+	response = h.get(path, map[string]string{HeaderIfNoneMatch: `"` + report.Checksum + `"`})
+	assert.Equal(t, http.StatusOK, response.Code)
+	response = h.get(path, map[string]string{HeaderIfNoneMatch: `"` + report.Checksum + `-gunzip"`})
+	assert.Equal(t, http.StatusNotModified, response.Code)
+}
+
+func TestSkipCompression(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		skip   bool
+	}{
+		{method: http.MethodGet, path: APIPrefix + "/reports", skip: false},
+		{method: http.MethodGet, path: APIPrefix + "/reports/:id", skip: false},
+		{method: http.MethodPost, path: APIPrefix + "/reports", skip: true},
+		{method: http.MethodGet, path: APIPrefix + "/reports/:id/file", skip: true},
+		{method: http.MethodGet, path: APIPrefix + "/reports/:id/file/:format", skip: true},
+		{method: http.MethodGet, path: APIPrefix + "/reports/:id/events", skip: true},
+		{method: http.MethodGet, path: APIPrefix + FilesRoute, skip: true},
+		{method: http.MethodGet, path: APIPrefix + SharedRoute, skip: true},
+		{method: http.MethodGet, path: "/health", skip: true},
+		{method: http.MethodGet, path: "/health/ready", skip: true},
+	}
+	e := echo.New()
+	for _, tt := range tests {
+		c := e.NewContext(httptest.NewRequest(tt.method, "/", nil), httptest.NewRecorder())
+		c.SetPath(tt.path)
+		assert.Equal(t, tt.skip, skipCompression(c), "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		etag        string
+		want        bool
+	}{
+		{ifNoneMatch: "", etag: `"abc"`, want: false},
+		{ifNoneMatch: `"abc"`, etag: `"abc"`, want: true},
+		{ifNoneMatch: `W/"abc"`, etag: `"abc"`, want: true},
+		{ifNoneMatch: `"abc"`, etag: `W/"abc"`, want: true},
+		{ifNoneMatch: `"x", "abc"`, etag: `"abc"`, want: true},
+		{ifNoneMatch: `"x","y"`, etag: `"abc"`, want: false},
+		{ifNoneMatch: `*`, etag: `"abc"`, want: true},
+		{ifNoneMatch: `"abc-gunzip"`, etag: `"abc"`, want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, etagMatches(tt.ifNoneMatch, tt.etag), "%s / %s", tt.ifNoneMatch, tt.etag)
+	}
+}
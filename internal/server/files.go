@@ -0,0 +1,114 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/storage"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FilesRoute маршрут отдачи файлов хранилища по подписанным ссылкам
+const FilesRoute = "/files/*"
+
+// FileHandler отдает файлы хранилища по ссылкам, подписанным storage.URLSigner
+type FileHandler struct {
+	storage        storage.Storage
+	signer         *storage.URLSigner
+	logger         logging.Logger
+	responseWriter ResponseWriter
+}
+
+// NewFileHandler создает обработчик подписанных ссылок на файлы
+func NewFileHandler(fileStorage storage.Storage, signer *storage.URLSigner, logger logging.Logger) Handler {
+	return &FileHandler{
+		storage:        fileStorage,
+		signer:         signer,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршрут отдачи файлов
+func (h *FileHandler) Register(group *echo.Group) {
+	group.GET(FilesRoute, h.serveFile)
+}
+
+// serveFile проверяет подпись ссылки и отдает файл потоком
+func (h *FileHandler) serveFile(c echo.Context) error {
+	key := c.Param("*")
+	// Echo матчит маршрут по RawPath, если он задан, и тогда параметр остается экранированным
+	if c.Request().URL.RawPath != "" {
+		unescaped, err := url.PathUnescape(key)
+		if err != nil {
+			return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ключ файла"))
+		}
+		key = unescaped
+	}
+
+	err := h.signer.Verify(key,
+		c.QueryParam(storage.SignedURLExpiresParam),
+		c.QueryParam(storage.SignedURLSignatureParam),
+	)
+	if err != nil {
+		code := "INVALID_SIGNATURE"
+		if errors.Is(err, storage.ErrSignedURLExpired) {
+			code = "URL_EXPIRED"
+		}
+		return c.JSON(http.StatusForbidden, &APIResponse{
+			Success: false,
+			Error: &APIError{
+				Code:    code,
+				Message: err.Error(),
+			},
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			RequestID: getRequestID(c),
+		})
+	}
+
+	ctx := c.Request().Context()
+
+	exists, err := h.storage.Exists(ctx, key)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	if !exists {
+		return h.responseWriter.NotFound(c, "Файл не найден")
+	}
+
+	reader, err := h.storage.Get(ctx, key)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	defer reader.Close()
+
+	// Сжатый gzip файл отдается с типом и именем исходного файла
+	contentType, encoding := storage.ContentHeaders(key)
+	filename := path.Base(key)
+	if encoding != "" {
+		filename = strings.TrimSuffix(filename, ".gz")
+	}
+
+	header := c.Response().Header()
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": filename,
+	}))
+	size, err := h.storage.GetSize(ctx, key)
+	if err != nil {
+		size = -1
+	}
+
+	body, err := encodeResponse(c, reader, encoding, size)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	return c.Stream(http.StatusOK, contentType, body)
+}
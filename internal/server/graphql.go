@@ -0,0 +1,156 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/graph-gophers/graphql-go"
+	graphqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// GraphQLRoute маршрут GraphQL API
+	GraphQLRoute = "/graphql"
+
+	// Ограничения сложности GraphQL запросов
+	graphQLMaxDepth       = 10
+	graphQLMaxParallelism = 10
+)
+
+//go:embed schema.graphql
+var graphQLSchema string
+
+// GraphQLRequest запрос к GraphQL API
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQLHandler обработчик GraphQL API отчетов. Запросы и мутации выполняются
+// через POST с JSON ответом, подписки - через POST с заголовком
+// Accept: text/event-stream, результаты отправляются событиями SSE
+// (протокол graphql-sse, режим отдельных соединений).
+type GraphQLHandler struct {
+	schema *graphql.Schema
+	logger logging.Logger
+}
+
+// NewGraphQLHandler создает новый обработчик GraphQL API
+func NewGraphQLHandler(reports service.ReportService, logger logging.Logger) Handler {
+	resolver := &graphQLResolver{
+		service:   reports,
+		logger:    logger,
+		validator: newValidator(),
+	}
+
+	return &GraphQLHandler{
+		schema: graphql.MustParseSchema(graphQLSchema, resolver,
+			graphql.UseStringDescriptions(),
+			graphql.MaxDepth(graphQLMaxDepth),
+			graphql.MaxParallelism(graphQLMaxParallelism),
+		),
+		logger: logger,
+	}
+}
+
+// Register регистрирует маршрут GraphQL API
+func (h *GraphQLHandler) Register(group *echo.Group) {
+	group.POST(GraphQLRoute, h.serveGraphQL)
+}
+
+// serveGraphQL выполняет GraphQL запрос
+func (h *GraphQLHandler) serveGraphQL(c echo.Context) error {
+	var req GraphQLRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, &graphql.Response{
+			Errors: graphQLErrors(fmt.Errorf("неверное тело GraphQL запроса: %v", err)),
+		})
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return c.JSON(http.StatusBadRequest, &graphql.Response{
+			Errors: graphQLErrors(fmt.Errorf("не задан GraphQL запрос")),
+		})
+	}
+
+	if acceptsEventStream(c.Request()) {
+		return h.subscribe(c, req)
+	}
+
+	response := h.schema.Exec(c.Request().Context(), req.Query, req.OperationName, req.Variables)
+	return c.JSON(http.StatusOK, response)
+}
+
+// subscribe выполняет подписку и отправляет ее результаты событиями SSE
+// до завершения подписки или отключения клиента
+func (h *GraphQLHandler) subscribe(c echo.Context, req GraphQLRequest) error {
+	ctx := c.Request().Context()
+
+	responses, err := h.schema.Subscribe(ctx, req.Query, req.OperationName, req.Variables)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &graphql.Response{Errors: graphQLErrors(err)})
+	}
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	ticker := time.NewTicker(DefaultEventsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case result, ok := <-responses:
+			if !ok {
+				_, err := fmt.Fprint(response, "event: complete\ndata:\n\n")
+				response.Flush()
+				return err
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(response, "event: next\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+			response.Flush()
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(response, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		}
+	}
+}
+
+// isGraphQLSubscription проверяет, является ли запрос подпиской GraphQL,
+// отдающей ответ потоком
+func isGraphQLSubscription(c echo.Context) bool {
+	return c.Path() == APIPrefix+GraphQLRoute && acceptsEventStream(c.Request())
+}
+
+// acceptsEventStream проверяет, ожидает ли клиент ответ в формате SSE
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get(echo.HeaderAccept), "text/event-stream")
+}
+
+// graphQLErrors формирует список ошибок GraphQL ответа
+func graphQLErrors(err error) []*graphqlerrors.QueryError {
+	return []*graphqlerrors.QueryError{graphqlerrors.Errorf("%s", err)}
+}
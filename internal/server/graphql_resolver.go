@@ -0,0 +1,587 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/graph-gophers/graphql-go"
+)
+
+// errGraphQLInternal ошибка, которую видит клиент вместо внутренних ошибок сервиса
+var errGraphQLInternal = errors.New("внутренняя ошибка сервера")
+
+// graphQLJSON скаляр JSON схемы GraphQL
+type graphQLJSON map[string]interface{}
+
+// ImplementsGraphQLType связывает тип со скаляром JSON
+func (graphQLJSON) ImplementsGraphQLType(name string) bool {
+	return name == "JSON"
+}
+
+// UnmarshalGraphQL читает JSON объект из аргументов запроса
+func (j *graphQLJSON) UnmarshalGraphQL(input interface{}) error {
+	value, ok := input.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("ожидается JSON объект, получено: %T", input)
+	}
+	*j = value
+	return nil
+}
+
+// graphQLResolver корневой резолвер GraphQL API отчетов
+type graphQLResolver struct {
+	service   service.ReportService
+	logger    logging.Logger
+	validator *validator.Validate
+}
+
+// serviceError возвращает клиенту ошибку сервиса с категорией или исчерпанного лимита.
+// Остальные ошибки записываются в лог, их подробности от клиента скрываются.
+func (r *graphQLResolver) serviceError(err error) error {
+	if isParameterValidationError(err) || errors.Is(err, service.ErrNotFound) ||
+		errors.Is(err, service.ErrConflict) || errors.Is(err, service.ErrNotReady) ||
+		errors.Is(err, service.ErrQuotaExceeded) {
+		return err
+	}
+
+	r.logger.WithError(err).Error("GraphQL API error occurred")
+	return errGraphQLInternal
+}
+
+// Запросы
+
+type reportArgs struct {
+	ID graphql.ID
+}
+
+// Report возвращает отчет по ID или null, если отчет не найден
+func (r *graphQLResolver) Report(ctx context.Context, args reportArgs) (*reportResolver, error) {
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := r.service.GetReport(ctx, id)
+	if err != nil {
+		return nil, nil
+	}
+	return &reportResolver{report: report, root: r}, nil
+}
+
+type reportFilterInput struct {
+	Status          *string
+	Format          *string
+	CreatedBy       *string
+	Search          *string
+	SearchMode      *string
+	CreatedAfter    *graphql.Time
+	CreatedBefore   *graphql.Time
+	GeneratedAfter  *graphql.Time
+	GeneratedBefore *graphql.Time
+}
+
+type reportSortInput struct {
+	Field string
+	Desc  *bool
+}
+
+type reportsArgs struct {
+	Filter   *reportFilterInput
+	Sort     *reportSortInput
+	Page     int32
+	PageSize int32
+}
+
+// Reports возвращает страницу списка отчетов с фильтрацией и сортировкой
+func (r *graphQLResolver) Reports(ctx context.Context, args reportsArgs) (*reportPageResolver, error) {
+	if args.Page < 1 {
+		return nil, fmt.Errorf("номер страницы должен быть не меньше 1")
+	}
+	if args.PageSize < 1 || args.PageSize > MaxPageSize {
+		return nil, fmt.Errorf("размер страницы должен быть от 1 до %d", MaxPageSize)
+	}
+
+	params := service.ListReportParams{
+		Page:     int(args.Page),
+		PageSize: int(args.PageSize),
+	}
+	if filter := args.Filter; filter != nil {
+		if filter.Status != nil {
+			status := models.ReportStatus(strings.ToLower(*filter.Status))
+			params.Status = &status
+		}
+		if filter.Format != nil {
+			format := models.ReportFormat(strings.ToLower(*filter.Format))
+			params.Format = &format
+		}
+		if filter.CreatedBy != nil {
+			params.CreatedBy = *filter.CreatedBy
+		}
+		if filter.Search != nil {
+			params.Search = strings.TrimSpace(*filter.Search)
+		}
+		if filter.SearchMode != nil {
+			params.SearchMode = service.SearchMode(strings.ToLower(*filter.SearchMode))
+		}
+		params.CreatedAfter = graphQLTimePtr(filter.CreatedAfter)
+		params.CreatedBefore = graphQLTimePtr(filter.CreatedBefore)
+		params.GeneratedAfter = graphQLTimePtr(filter.GeneratedAfter)
+		params.GeneratedBefore = graphQLTimePtr(filter.GeneratedBefore)
+	}
+	if sort := args.Sort; sort != nil {
+		params.SortBy = strings.ToLower(sort.Field)
+		params.SortDesc = sort.Desc != nil && *sort.Desc
+	}
+
+	list, err := r.service.ListReports(ctx, params)
+	if err != nil {
+		return nil, r.serviceError(err)
+	}
+	return &reportPageResolver{list: list, root: r}, nil
+}
+
+// Мутации
+
+type createReportInput struct {
+	Title       string
+	Description *string
+	Type        *string
+	Parameters  *graphQLJSON
+	Format      *string
+	Priority    *string
+	CreatedBy   *string
+	Force       *bool
+}
+
+// CreateReport создает отчет и ставит его в очередь на генерацию
+func (r *graphQLResolver) CreateReport(ctx context.Context, args struct{ Input createReportInput }) (*reportResolver, error) {
+	// Проверяем ввод по тем же правилам, что и REST API
+	req := CreateReportRequest{
+		Title:     args.Input.Title,
+		CreatedBy: service.ActorFromContext(ctx),
+	}
+	if args.Input.CreatedBy != nil && req.CreatedBy == "" {
+		req.CreatedBy = *args.Input.CreatedBy
+	}
+	if args.Input.Description != nil {
+		req.Description = *args.Input.Description
+	}
+	if args.Input.Type != nil {
+		req.Type = *args.Input.Type
+	}
+	if args.Input.Parameters != nil {
+		req.Parameters = *args.Input.Parameters
+	}
+	if args.Input.Format != nil {
+		req.Format = strings.ToLower(*args.Input.Format)
+	}
+	if args.Input.Priority != nil {
+		req.Priority = strings.ToLower(*args.Input.Priority)
+	}
+	if err := r.validator.Struct(&req); err != nil {
+		return nil, graphQLValidationError(err)
+	}
+
+	report, err := models.NewReportBuilder().
+		WithTitle(req.Title).
+		WithDescription(req.Description).
+		WithType(req.Type).
+		WithCreatedBy(req.CreatedBy).
+		WithParameters(req.Parameters).
+		WithFormat(models.ReportFormat(req.Format)).
+		WithPriority(models.ReportPriority(req.Priority)).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	if args.Input.Force != nil && *args.Input.Force {
+		ctx = service.WithForceGeneration(ctx)
+	}
+	if err := r.service.CreateReport(ctx, report); err != nil {
+		return nil, r.serviceError(err)
+	}
+	return &reportResolver{report: report, root: r}, nil
+}
+
+// CancelReport отменяет генерацию отчета
+func (r *graphQLResolver) CancelReport(ctx context.Context, args reportArgs) (*reportResolver, error) {
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := r.service.GetReport(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("отчет не найден")
+	}
+	if report.Status.IsFinal() {
+		return nil, fmt.Errorf("отчет в статусе %s нельзя отменить", report.Status)
+	}
+
+	if err := r.service.CancelReportGeneration(ctx, id); err != nil {
+		return nil, r.serviceError(err)
+	}
+
+	report, err = r.service.GetReport(ctx, id)
+	if err != nil {
+		return nil, r.serviceError(err)
+	}
+	return &reportResolver{report: report, root: r}, nil
+}
+
+// DeleteReport удаляет отчет
+func (r *graphQLResolver) DeleteReport(ctx context.Context, args reportArgs) (bool, error) {
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := r.service.GetReport(ctx, id); err != nil {
+		return false, fmt.Errorf("отчет не найден")
+	}
+	if err := r.service.DeleteReport(ctx, id); err != nil {
+		return false, r.serviceError(err)
+	}
+	return true, nil
+}
+
+// Подписки
+
+// ReportStatus отправляет текущий статус отчета и его смены до перехода в финальный статус.
+// Как и поток событий REST API, периодически перечитывает отчет: его может генерировать
+// другой экземпляр сервиса.
+func (r *graphQLResolver) ReportStatus(ctx context.Context, args reportArgs) (<-chan *reportEventResolver, error) {
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Подписываемся до чтения отчета, чтобы не пропустить смену статуса между ними
+	updates, err := r.service.SubscribeStatus(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("отчет не найден")
+	}
+
+	report, err := r.service.GetReport(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("отчет не найден")
+	}
+
+	result := make(chan *reportEventResolver)
+	go func() {
+		defer close(result)
+
+		send := func(event events.Event) bool {
+			select {
+			case result <- &reportEventResolver{event: event}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		last := snapshotEvent(report)
+		if !send(last) || last.Status.IsFinal() {
+			return
+		}
+
+		ticker := time.NewTicker(DefaultEventsPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case event, ok := <-updates:
+				if !ok {
+					return
+				}
+				if event.Type == events.ReportDeleted {
+					send(event)
+					return
+				}
+				if event.Status == last.Status {
+					continue
+				}
+				last = event
+
+			case <-ticker.C:
+				report, err := r.service.GetReport(ctx, id)
+				if err != nil {
+					return
+				}
+				if report.Status == last.Status {
+					continue
+				}
+				last = snapshotEvent(report)
+			}
+
+			if !send(last) || last.Status.IsFinal() {
+				return
+			}
+		}
+	}()
+
+	return result, nil
+}
+
+// reportResolver резолвер полей отчета
+type reportResolver struct {
+	report *models.Report
+	root   *graphQLResolver
+}
+
+func (r *reportResolver) ID() graphql.ID {
+	return formatGraphQLID(r.report.ID)
+}
+
+func (r *reportResolver) Title() string {
+	return r.report.Title
+}
+
+func (r *reportResolver) Description() string {
+	return r.report.Description
+}
+
+func (r *reportResolver) Type() string {
+	return r.report.Type
+}
+
+func (r *reportResolver) Status() string {
+	return strings.ToUpper(string(r.report.Status))
+}
+
+func (r *reportResolver) Format() string {
+	return strings.ToUpper(string(r.report.Format))
+}
+
+func (r *reportResolver) Priority() string {
+	return strings.ToUpper(string(r.report.Priority))
+}
+
+func (r *reportResolver) Parameters() *graphQLJSON {
+	if len(r.report.Parameters) == 0 {
+		return nil
+	}
+	parameters := graphQLJSON(r.report.Parameters)
+	return &parameters
+}
+
+func (r *reportResolver) DefinitionID() *graphql.ID {
+	return optionalGraphQLID(r.report.DefinitionID)
+}
+
+func (r *reportResolver) ScheduleID() *graphql.ID {
+	return optionalGraphQLID(r.report.ScheduleID)
+}
+
+func (r *reportResolver) CachedFromID() *graphql.ID {
+	return optionalGraphQLID(r.report.CachedFromID)
+}
+
+func (r *reportResolver) Progress() int32 {
+	return int32(r.report.Progress)
+}
+
+func (r *reportResolver) RowsProcessed() float64 {
+	return float64(r.report.RowsProcessed)
+}
+
+func (r *reportResolver) ErrorCode() *string {
+	return optionalString(string(r.report.ErrorCode))
+}
+
+func (r *reportResolver) ErrorMessage() *string {
+	return optionalString(r.report.ErrorMessage)
+}
+
+func (r *reportResolver) CreatedBy() string {
+	return r.report.CreatedBy
+}
+
+func (r *reportResolver) UpdatedBy() string {
+	return r.report.UpdatedBy
+}
+
+func (r *reportResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.report.CreatedAt}
+}
+
+func (r *reportResolver) UpdatedAt() graphql.Time {
+	return graphql.Time{Time: r.report.UpdatedAt}
+}
+
+func (r *reportResolver) GeneratedAt() *graphql.Time {
+	return optionalGraphQLTime(r.report.GeneratedAt)
+}
+
+func (r *reportResolver) ExpiresAt() *graphql.Time {
+	return optionalGraphQLTime(r.report.ExpiresAt)
+}
+
+func (r *reportResolver) Checksum() *string {
+	return optionalString(r.report.Checksum)
+}
+
+func (r *reportResolver) PasswordProtected() bool {
+	return r.report.PasswordProtected
+}
+
+// GeneratedPassword возвращает сгенерированный пароль файла только в ответе на создание отчета
+func (r *reportResolver) GeneratedPassword() *string {
+	return optionalString(r.report.GeneratedPassword)
+}
+
+// DownloadURL возвращает временную ссылку на файл или null, если отчет еще не готов
+func (r *reportResolver) DownloadURL(ctx context.Context, args struct{ ExpiresIn *int32 }) (*string, error) {
+	expiration := DefaultDownloadURLExpiration
+	if args.ExpiresIn != nil {
+		expiration = time.Duration(*args.ExpiresIn) * time.Second
+		if expiration <= 0 || expiration > MaxDownloadURLExpiration {
+			return nil, fmt.Errorf("неверное время жизни ссылки")
+		}
+	}
+
+	if r.report.Status != models.StatusCompleted || r.report.FileKey == "" {
+		return nil, nil
+	}
+
+	downloadURL, err := r.root.service.GetReportDownloadURL(ctx, r.report.ID, expiration)
+	if err != nil {
+		return nil, r.root.serviceError(err)
+	}
+	return &downloadURL.URL, nil
+}
+
+// reportPageResolver резолвер страницы списка отчетов
+type reportPageResolver struct {
+	list *service.ReportList
+	root *graphQLResolver
+}
+
+func (r *reportPageResolver) Reports() []*reportResolver {
+	reports := make([]*reportResolver, len(r.list.Reports))
+	for i := range r.list.Reports {
+		reports[i] = &reportResolver{report: &r.list.Reports[i], root: r.root}
+	}
+	return reports
+}
+
+func (r *reportPageResolver) Total() int32 {
+	return int32(r.list.Total)
+}
+
+func (r *reportPageResolver) Page() int32 {
+	return int32(r.list.Page)
+}
+
+func (r *reportPageResolver) PageSize() int32 {
+	return int32(r.list.PageSize)
+}
+
+func (r *reportPageResolver) TotalPages() int32 {
+	return int32(r.list.TotalPages)
+}
+
+// reportEventResolver резолвер события смены статуса отчета
+type reportEventResolver struct {
+	event events.Event
+}
+
+func (r *reportEventResolver) Type() string {
+	return string(r.event.Type)
+}
+
+func (r *reportEventResolver) ReportID() graphql.ID {
+	return formatGraphQLID(r.event.ReportID)
+}
+
+func (r *reportEventResolver) Status() *string {
+	if r.event.Status == "" {
+		return nil
+	}
+	status := strings.ToUpper(string(r.event.Status))
+	return &status
+}
+
+func (r *reportEventResolver) FileKey() *string {
+	return optionalString(r.event.FileKey)
+}
+
+func (r *reportEventResolver) ErrorCode() *string {
+	return optionalString(string(r.event.ErrorCode))
+}
+
+func (r *reportEventResolver) Timestamp() graphql.Time {
+	return graphql.Time{Time: r.event.Timestamp}
+}
+
+// Вспомогательные функции
+
+// parseGraphQLID преобразует ID GraphQL в ID записи
+func parseGraphQLID(id graphql.ID) (uint, error) {
+	value, err := strconv.ParseUint(string(id), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("неверный ID отчета")
+	}
+	return uint(value), nil
+}
+
+func formatGraphQLID(id uint) graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(id), 10))
+}
+
+func optionalGraphQLID(id *uint) *graphql.ID {
+	if id == nil {
+		return nil
+	}
+	value := formatGraphQLID(*id)
+	return &value
+}
+
+func optionalGraphQLTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+func graphQLTimePtr(t *graphql.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	return &t.Time
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// graphQLValidationError формирует сообщение об ошибке валидации ввода
+func graphQLValidationError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	messages := make([]string, 0, len(validationErrors))
+	for _, fieldError := range validationErrors {
+		messages = append(messages, fmt.Sprintf("%s: %s", fieldError.Field(), getValidationMessage(fieldError)))
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
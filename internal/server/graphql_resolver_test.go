@@ -0,0 +1,374 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReportService сервис отчетов в памяти. Методы, которые GraphQL API не вызывает,
+// остаются нереализованными
+type fakeReportService struct {
+	service.ReportService
+
+	reports    map[uint]*models.Report
+	nextID     uint
+	createErr  error
+	listParams service.ListReportParams
+	updates    chan events.Event
+}
+
+func newFakeReportService(reports ...*models.Report) *fakeReportService {
+	fake := &fakeReportService{reports: make(map[uint]*models.Report), nextID: 100}
+	for _, report := range reports {
+		fake.reports[report.ID] = report
+	}
+	return fake
+}
+
+func (s *fakeReportService) GetReport(ctx context.Context, id uint) (*models.Report, error) {
+	report, ok := s.reports[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", service.ErrReportNotFound, id)
+	}
+	copied := *report
+	return &copied, nil
+}
+
+func (s *fakeReportService) ListReports(ctx context.Context, params service.ListReportParams) (*service.ReportList, error) {
+	s.listParams = params
+	list := &service.ReportList{Page: params.Page, PageSize: params.PageSize}
+	for _, report := range s.reports {
+		list.Reports = append(list.Reports, *report)
+	}
+	list.Total = int64(len(list.Reports))
+	list.TotalPages = 1
+	return list, nil
+}
+
+func (s *fakeReportService) CreateReport(ctx context.Context, report *models.Report) error {
+	if s.createErr != nil {
+		return s.createErr
+	}
+	s.nextID++
+	report.ID = s.nextID
+	report.Status = models.StatusPending
+	s.reports[report.ID] = report
+	return nil
+}
+
+func (s *fakeReportService) CancelReportGeneration(ctx context.Context, id uint) error {
+	s.reports[id].Status = models.StatusCanceled
+	return nil
+}
+
+func (s *fakeReportService) DeleteReport(ctx context.Context, id uint) error {
+	delete(s.reports, id)
+	return nil
+}
+
+func (s *fakeReportService) GetReportDownloadURL(ctx context.Context, id uint, expiration time.Duration) (*service.ReportDownloadURL, error) {
+	return &service.ReportDownloadURL{URL: fmt.Sprintf("https://files.example.com/%d?ttl=%d", id, int(expiration.Seconds()))}, nil
+}
+
+func (s *fakeReportService) SubscribeStatus(ctx context.Context, id uint) (<-chan events.Event, error) {
+	if _, ok := s.reports[id]; !ok {
+		return nil, fmt.Errorf("%w: %d", service.ErrReportNotFound, id)
+	}
+	return s.updates, nil
+}
+
+// graphQLTestResponse ответ GraphQL API
+type graphQLTestResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// execGraphQL выполняет запрос к GraphQL API и разбирает данные ответа в data
+func execGraphQL(t *testing.T, handler Handler, ctx context.Context, query string, variables map[string]interface{}, data interface{}) []string {
+	body, err := json.Marshal(GraphQLRequest{Query: query, Variables: variables})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, APIPrefix+GraphQLRoute, bytes.NewReader(body)).WithContext(ctx)
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	e := echo.New()
+	handler.Register(e.Group(APIPrefix))
+	e.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	var response graphQLTestResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	messages := make([]string, 0, len(response.Errors))
+	for _, queryError := range response.Errors {
+		messages = append(messages, queryError.Message)
+	}
+	if data != nil && len(messages) == 0 {
+		require.NoError(t, json.Unmarshal(response.Data, data))
+	}
+	return messages
+}
+
+func testGraphQLReport(id uint, status models.ReportStatus) *models.Report {
+	return &models.Report{
+		ID:         id,
+		Title:      "Продажи за квартал",
+		Type:       "sales",
+		Status:     status,
+		Format:     models.FormatXLSX,
+		Priority:   models.PriorityNormal,
+		Parameters: map[string]interface{}{"region": "north"},
+		FileKey:    fmt.Sprintf("reports/%d.xlsx", id),
+		CreatedBy:  "john.doe",
+		CreatedAt:  time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2026, 10, 1, 9, 5, 0, 0, time.UTC),
+	}
+}
+
+func TestGraphQLReportQuery(t *testing.T) {
+	handler := NewGraphQLHandler(newFakeReportService(
+		testGraphQLReport(1, models.StatusCompleted),
+		testGraphQLReport(2, models.StatusProcessing),
+	), logging.Nop())
+
+	query := `query($id: ID!) { report(id: $id) { id title status format priority parameters createdBy createdAt downloadUrl(expiresIn: 60) } }`
+	var data struct {
+		Report *struct {
+			ID          string                 `json:"id"`
+			Title       string                 `json:"title"`
+			Status      string                 `json:"status"`
+			Format      string                 `json:"format"`
+			Priority    string                 `json:"priority"`
+			Parameters  map[string]interface{} `json:"parameters"`
+			CreatedBy   string                 `json:"createdBy"`
+			CreatedAt   time.Time              `json:"createdAt"`
+			DownloadURL *string                `json:"downloadUrl"`
+		} `json:"report"`
+	}
+	require.Empty(t, execGraphQL(t, handler, context.Background(), query, map[string]interface{}{"id": "1"}, &data))
+	require.NotNil(t, data.Report)
+	assert.Equal(t, "1", data.Report.ID)
+	assert.Equal(t, "COMPLETED", data.Report.Status)
+	assert.Equal(t, "XLSX", data.Report.Format)
+	assert.Equal(t, "NORMAL", data.Report.Priority)
+	assert.Equal(t, map[string]interface{}{"region": "north"}, data.Report.Parameters)
+	assert.Equal(t, "john.doe", data.Report.CreatedBy)
+	assert.True(t, data.Report.CreatedAt.Equal(time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)))
+	require.NotNil(t, data.Report.DownloadURL)
+	assert.Equal(t, "https://files.example.com/1?ttl=60", *data.Report.DownloadURL)
+
+	// Ссылка на файл есть только у готового отчета
+	require.Empty(t, execGraphQL(t, handler, context.Background(), query, map[string]interface{}{"id": "2"}, &data))
+	assert.Equal(t, "PROCESSING", data.Report.Status)
+	assert.Nil(t, data.Report.DownloadURL)
+
+	// Несуществующий отчет возвращается как null
+	require.Empty(t, execGraphQL(t, handler, context.Background(), query, map[string]interface{}{"id": "404"}, &data))
+	assert.Nil(t, data.Report)
+
+	errs := execGraphQL(t, handler, context.Background(), query, map[string]interface{}{"id": "abc"}, nil)
+	assert.Equal(t, []string{"неверный ID отчета"}, errs)
+
+	errs = execGraphQL(t, handler, context.Background(), `{ report(id: "1") { downloadUrl(expiresIn: 0) } }`, nil, nil)
+	assert.Equal(t, []string{"неверное время жизни ссылки"}, errs)
+}
+
+func TestGraphQLReportsFilterAndSort(t *testing.T) {
+	reports := newFakeReportService(testGraphQLReport(1, models.StatusCompleted))
+	handler := NewGraphQLHandler(reports, logging.Nop())
+
+	query := `{
+		reports(
+			filter: {status: COMPLETED, format: XLSX, createdBy: "john.doe", search: "  продажи ", searchMode: FULLTEXT, createdAfter: "2026-10-01T00:00:00Z"}
+			sort: {field: GENERATED_AT, desc: true}
+			page: 2
+			pageSize: 5
+		) { total page pageSize totalPages reports { id status } }
+	}`
+	var data struct {
+		Reports struct {
+			Total    int `json:"total"`
+			Page     int `json:"page"`
+			PageSize int `json:"pageSize"`
+			Reports  []struct {
+				ID     string `json:"id"`
+				Status string `json:"status"`
+			} `json:"reports"`
+		} `json:"reports"`
+	}
+	require.Empty(t, execGraphQL(t, handler, context.Background(), query, nil, &data))
+	assert.Equal(t, 1, data.Reports.Total)
+	assert.Equal(t, 2, data.Reports.Page)
+	assert.Equal(t, 5, data.Reports.PageSize)
+	require.Len(t, data.Reports.Reports, 1)
+	assert.Equal(t, "COMPLETED", data.Reports.Reports[0].Status)
+
+	params := reports.listParams
+	require.NotNil(t, params.Status)
+	assert.Equal(t, models.StatusCompleted, *params.Status)
+	require.NotNil(t, params.Format)
+	assert.Equal(t, models.FormatXLSX, *params.Format)
+	assert.Equal(t, "john.doe", params.CreatedBy)
+	assert.Equal(t, "продажи", params.Search)
+	assert.Equal(t, service.SearchMode("fulltext"), params.SearchMode)
+	require.NotNil(t, params.CreatedAfter)
+	assert.True(t, params.CreatedAfter.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Nil(t, params.GeneratedAfter)
+	assert.Equal(t, "generated_at", params.SortBy)
+	assert.True(t, params.SortDesc)
+
+	errs := execGraphQL(t, handler, context.Background(), `{ reports(pageSize: 0) { total } }`, nil, nil)
+	assert.Equal(t, []string{fmt.Sprintf("размер страницы должен быть от 1 до %d", MaxPageSize)}, errs)
+	errs = execGraphQL(t, handler, context.Background(), `{ reports(page: 0) { total } }`, nil, nil)
+	assert.Equal(t, []string{"номер страницы должен быть не меньше 1"}, errs)
+}
+
+func TestGraphQLCreateReport(t *testing.T) {
+	reports := newFakeReportService()
+	handler := NewGraphQLHandler(reports, logging.Nop())
+
+	mutation := `mutation($input: CreateReportInput!) { createReport(input: $input) { id status format priority createdBy } }`
+	input := map[string]interface{}{
+		"title":      "Продажи",
+		"type":       "sales",
+		"format":     "CSV",
+		"priority":   "HIGH",
+		"parameters": map[string]interface{}{"region": "north"},
+		"createdBy":  "someone.else",
+	}
+	var data struct {
+		CreateReport struct {
+			ID        string `json:"id"`
+			Status    string `json:"status"`
+			Format    string `json:"format"`
+			Priority  string `json:"priority"`
+			CreatedBy string `json:"createdBy"`
+		} `json:"createReport"`
+	}
+
+	// Автор аутентифицированного запроса берется из контекста, а не из ввода
+	ctx := service.WithActor(context.Background(), "john.doe")
+	require.Empty(t, execGraphQL(t, handler, ctx, mutation, map[string]interface{}{"input": input}, &data))
+	assert.Equal(t, "101", data.CreateReport.ID)
+	assert.Equal(t, "PENDING", data.CreateReport.Status)
+	assert.Equal(t, "CSV", data.CreateReport.Format)
+	assert.Equal(t, "HIGH", data.CreateReport.Priority)
+	assert.Equal(t, "john.doe", data.CreateReport.CreatedBy)
+
+	created := reports.reports[101]
+	require.NotNil(t, created)
+	assert.Equal(t, models.FormatCSV, created.Format)
+	assert.Equal(t, models.PriorityHigh, created.Priority)
+	assert.Equal(t, "north", created.Parameters["region"])
+
+	// Без аутентификации автор берется из ввода
+	require.Empty(t, execGraphQL(t, handler, context.Background(), mutation, map[string]interface{}{"input": input}, &data))
+	assert.Equal(t, "someone.else", data.CreateReport.CreatedBy)
+
+	// Ввод проверяется по правилам REST API
+	errs := execGraphQL(t, handler, context.Background(), mutation,
+		map[string]interface{}{"input": map[string]interface{}{"title": "Продажи"}}, nil)
+	assert.Equal(t, []string{"CreatedBy: Поле обязательно для заполнения"}, errs)
+}
+
+func TestGraphQLServiceErrors(t *testing.T) {
+	reports := newFakeReportService()
+	handler := NewGraphQLHandler(reports, logging.Nop())
+	mutation := `mutation { createReport(input: {title: "Продажи", createdBy: "john.doe"}) { id } }`
+
+	// Ошибки с категорией видны клиенту
+	reports.createErr = fmt.Errorf("%w: не больше 10 отчетов в час", service.ErrQuotaExceeded)
+	errs := execGraphQL(t, handler, context.Background(), mutation, nil, nil)
+	assert.Equal(t, []string{reports.createErr.Error()}, errs)
+
+	// Подробности внутренних ошибок скрыты
+	reports.createErr = errors.New("pq: connection refused")
+	errs = execGraphQL(t, handler, context.Background(), mutation, nil, nil)
+	assert.Equal(t, []string{errGraphQLInternal.Error()}, errs)
+}
+
+func TestGraphQLCancelAndDeleteReport(t *testing.T) {
+	reports := newFakeReportService(
+		testGraphQLReport(1, models.StatusCompleted),
+		testGraphQLReport(2, models.StatusProcessing),
+	)
+	handler := NewGraphQLHandler(reports, logging.Nop())
+
+	errs := execGraphQL(t, handler, context.Background(), `mutation { cancelReport(id: "1") { status } }`, nil, nil)
+	assert.Equal(t, []string{"отчет в статусе completed нельзя отменить"}, errs)
+
+	var canceled struct {
+		CancelReport struct {
+			Status string `json:"status"`
+		} `json:"cancelReport"`
+	}
+	require.Empty(t, execGraphQL(t, handler, context.Background(), `mutation { cancelReport(id: "2") { status } }`, nil, &canceled))
+	assert.Equal(t, "CANCELED", canceled.CancelReport.Status)
+
+	var deleted struct {
+		DeleteReport bool `json:"deleteReport"`
+	}
+	require.Empty(t, execGraphQL(t, handler, context.Background(), `mutation { deleteReport(id: "1") }`, nil, &deleted))
+	assert.True(t, deleted.DeleteReport)
+	assert.NotContains(t, reports.reports, uint(1))
+
+	errs = execGraphQL(t, handler, context.Background(), `mutation { deleteReport(id: "1") }`, nil, nil)
+	assert.Equal(t, []string{"отчет не найден"}, errs)
+}
+
+func TestGraphQLReportStatusSubscription(t *testing.T) {
+	reports := newFakeReportService(testGraphQLReport(1, models.StatusPending))
+	reports.updates = make(chan events.Event, 3)
+	reports.updates <- events.Event{Type: events.ReportStarted, ReportID: 1, Status: models.StatusProcessing}
+	// Повтор текущего статуса клиенту не отправляется
+	reports.updates <- events.Event{Type: events.ReportStarted, ReportID: 1, Status: models.StatusProcessing}
+	reports.updates <- events.Event{Type: events.ReportCompleted, ReportID: 1, Status: models.StatusCompleted, FileKey: "reports/1.xlsx"}
+	handler := NewGraphQLHandler(reports, logging.Nop())
+
+	body, err := json.Marshal(GraphQLRequest{Query: `subscription { reportStatus(id: "1") { reportId status fileKey } }`})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, APIPrefix+GraphQLRoute, bytes.NewReader(body))
+	request.Header.Set(echo.HeaderAccept, "text/event-stream")
+	recorder := httptest.NewRecorder()
+
+	e := echo.New()
+	handler.Register(e.Group(APIPrefix))
+	e.ServeHTTP(recorder, request)
+
+	// Поток завершается после финального статуса
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get(echo.HeaderContentType))
+	chunks := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n\n")
+	require.Len(t, chunks, 4)
+	assert.Equal(t, `event: next`+"\n"+`data: {"data":{"reportStatus":{"reportId":"1","status":"PENDING","fileKey":"reports/1.xlsx"}}}`, chunks[0])
+	assert.Equal(t, `event: next`+"\n"+`data: {"data":{"reportStatus":{"reportId":"1","status":"PROCESSING","fileKey":null}}}`, chunks[1])
+	assert.Equal(t, `event: next`+"\n"+`data: {"data":{"reportStatus":{"reportId":"1","status":"COMPLETED","fileKey":"reports/1.xlsx"}}}`, chunks[2])
+	assert.Equal(t, "event: complete\ndata:", chunks[3])
+
+	// Подписка на несуществующий отчет отклоняется
+	body, err = json.Marshal(GraphQLRequest{Query: `subscription { reportStatus(id: "404") { status } }`})
+	require.NoError(t, err)
+	request = httptest.NewRequest(http.MethodPost, APIPrefix+GraphQLRoute, bytes.NewReader(body))
+	request.Header.Set(echo.HeaderAccept, "text/event-stream")
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	assert.Contains(t, recorder.Body.String(), "отчет не найден")
+}
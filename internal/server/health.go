@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"report_srv/internal/database"
+	"report_srv/internal/service"
+	"report_srv/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// HealthProbeKey ключ, наличие которого проверяется в хранилище. Файла
+	// с таким ключом может не быть, проверяется только доступ к хранилищу.
+	HealthProbeKey = ".health/probe"
+
+	// DefaultHealthCheckTimeout ограничение времени проверки одной зависимости
+	DefaultHealthCheckTimeout = 3 * time.Second
+)
+
+// HealthCheck проверка зависимости сервиса для readiness probe
+type HealthCheck struct {
+	Name string
+	// Critical недоступность зависимости делает сервис неготовым
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+// HealthStatus результат проверки зависимости
+type HealthStatus struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DatabaseHealthCheck проверяет соединение с базой данных. Пока выключатель БД
+// разомкнут, проверка не проходит; она же выполняет пробное подключение после open_timeout.
+func DatabaseHealthCheck(db *gorm.DB) HealthCheck {
+	return databaseHealthCheck("database", db)
+}
+
+// ReplicaHealthCheck проверяет соединение с репликой базы данных
+func ReplicaHealthCheck(db *gorm.DB) HealthCheck {
+	return databaseHealthCheck("database_replica", db)
+}
+
+func databaseHealthCheck(name string, db *gorm.DB) HealthCheck {
+	return HealthCheck{
+		Name:     name,
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			if err := database.Ping(ctx, db); err != nil {
+				return fmt.Errorf("ошибка проверки соединения с БД: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+// StorageHealthCheck проверяет доступ к хранилищу файлов отчетов. Проверка проходит
+// через выключатель хранилища, как и операции с файлами.
+func StorageHealthCheck(fileStorage storage.Storage) HealthCheck {
+	return HealthCheck{
+		Name:     "storage",
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			_, err := fileStorage.Exists(ctx, HealthProbeKey)
+			return err
+		},
+	}
+}
+
+// ProcessorHealthCheck проверяет очередь задач, если процессор умеет проверять себя
+func ProcessorHealthCheck(processor service.BackgroundProcessor) HealthCheck {
+	return HealthCheck{
+		Name:     "processor",
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			if checker, ok := processor.(service.HealthChecker); ok {
+				return checker.HealthCheck(ctx)
+			}
+			return nil
+		},
+	}
+}
+
+// runHealthChecks выполняет проверки параллельно и возвращает их результаты
+// и готовность сервиса
+func runHealthChecks(ctx context.Context, checks []HealthCheck) (map[string]HealthStatus, bool) {
+	results := make(map[string]HealthStatus, len(checks))
+	ready := true
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, DefaultHealthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(checkCtx)
+			status := HealthStatus{
+				Status:    "up",
+				Critical:  check.Critical,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[check.Name] = status
+			if err != nil && check.Critical {
+				ready = false
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return results, ready
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// SharedRoute маршрут скачивания отчета по публичной ссылке
+const SharedRoute = "/shared/:token"
+
+// CreateLinkRequest запрос на создание публичной ссылки на отчет
+type CreateLinkRequest struct {
+	// ExpiresAt срок действия ссылки, по умолчанию - 7 дней
+	ExpiresAt *time.Time `json:"expires_at"`
+	// MaxDownloads число скачиваний по ссылке, по умолчанию - без ограничения
+	MaxDownloads *int `json:"max_downloads" validate:"omitempty,min=1"`
+	// CreatedBy создатель ссылки, при аутентификации - клиент запроса
+	CreatedBy string `json:"created_by" validate:"required,min=1,max=255"`
+}
+
+// CreateLinkResponse созданная ссылка. Токен возвращается только один раз.
+type CreateLinkResponse struct {
+	Token string             `json:"token"`
+	URL   string             `json:"url"`
+	Link  *models.ReportLink `json:"link"`
+}
+
+// LinkHandler обработчик публичных ссылок на отчеты
+type LinkHandler struct {
+	service        service.LinkService
+	reports        service.ReportService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewLinkHandler создает новый обработчик публичных ссылок
+func NewLinkHandler(service service.LinkService, reports service.ReportService, logger logging.Logger) Handler {
+	return &LinkHandler{
+		service:        service,
+		reports:        reports,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршруты публичных ссылок
+func (h *LinkHandler) Register(group *echo.Group) {
+	links := group.Group("/reports/:id/links")
+	{
+		links.POST("", h.createLink)
+		links.GET("", h.listLinks)
+		links.DELETE("/:link_id", h.revokeLink)
+	}
+	group.GET(SharedRoute, h.downloadShared)
+}
+
+// createLink создает публичную ссылку на готовый отчет
+func (h *LinkHandler) createLink(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	var req CreateLinkRequest
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.CreatedBy = requestActor(c, req.CreatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if report, err := readyReport(c, h.reports, h.responseWriter, id); report == nil {
+		return err
+	}
+
+	link := &models.ReportLink{
+		ReportID:     id,
+		MaxDownloads: req.MaxDownloads,
+		CreatedBy:    req.CreatedBy,
+	}
+	if req.ExpiresAt != nil {
+		link.ExpiresAt = *req.ExpiresAt
+	}
+
+	token, err := h.service.CreateLink(c.Request().Context(), link)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLinkRequest) {
+			return h.responseWriter.ValidationError(c, err)
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, &APIResponse{
+		Success: true,
+		Data: &CreateLinkResponse{
+			Token: token,
+			URL:   APIPrefix + "/shared/" + token,
+			Link:  link,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// listLinks возвращает неотозванные ссылки отчета без токенов
+func (h *LinkHandler) listLinks(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	links, err := h.service.ListLinks(c.Request().Context(), id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, links)
+}
+
+// revokeLink отзывает ссылку отчета
+func (h *LinkHandler) revokeLink(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+	linkID, err := parseUintParam(c, "link_id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID ссылки"))
+	}
+
+	if err := h.service.RevokeLink(c.Request().Context(), id, linkID); err != nil {
+		if errors.Is(err, service.ErrLinkNotFound) {
+			return h.responseWriter.NotFound(c, "Ссылка не найдена")
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "Ссылка отозвана",
+	})
+}
+
+// downloadShared отдает файл отчета по публичной ссылке без аутентификации
+func (h *LinkHandler) downloadShared(c echo.Context) error {
+	shared, err := h.service.OpenLink(c.Request().Context(), c.Param("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrLinkNotFound):
+			return h.responseWriter.NotFound(c, "Ссылка не найдена")
+		case errors.Is(err, service.ErrLinkExpired):
+			return c.JSON(http.StatusGone, &APIResponse{
+				Success: false,
+				Error: &APIError{
+					Code:    "LINK_EXPIRED",
+					Message: "Ссылка больше не действует",
+				},
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				RequestID: getRequestID(c),
+			})
+		default:
+			return h.responseWriter.Error(c, err)
+		}
+	}
+	defer shared.File.Reader.Close()
+
+	return sendReportFile(c, h.responseWriter, shared.Report, shared.File, http.StatusOK)
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// NotificationListRequest параметры списка уведомлений
+type NotificationListRequest struct {
+	PaginationParams
+	// UnreadOnly только непрочитанные уведомления
+	UnreadOnly bool `query:"unread"`
+	// User пользователь, если запрос без аутентификации. При аутентификации берется клиент запроса
+	User string `query:"user"`
+}
+
+// NotificationHandler обработчик ленты уведомлений пользователя о его отчетах
+type NotificationHandler struct {
+	service        service.NotificationService
+	logger         logging.Logger
+	validator      *validator.Validate
+	responseWriter ResponseWriter
+}
+
+// NewNotificationHandler создает новый обработчик уведомлений
+func NewNotificationHandler(service service.NotificationService, logger logging.Logger) Handler {
+	return &NotificationHandler{
+		service:        service,
+		logger:         logger,
+		validator:      newValidator(),
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршруты уведомлений
+func (h *NotificationHandler) Register(group *echo.Group) {
+	notifications := group.Group("/notifications")
+	notifications.GET("", h.listNotifications)
+	notifications.POST("/read", h.markAllRead)
+	notifications.POST("/:id/read", h.markRead)
+}
+
+// listNotifications возвращает уведомления пользователя, новые первыми
+func (h *NotificationHandler) listNotifications(c echo.Context) error {
+	req := NotificationListRequest{PaginationParams: PaginationParams{Page: 1, PageSize: DefaultPageSize}}
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+	if err := h.validator.Struct(&req.PaginationParams); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+	// Без page_size размер страницы берется из настроек пользователя
+	if c.QueryParam("page_size") == "" {
+		req.PageSize = 0
+	}
+
+	list, err := h.service.ListNotifications(c.Request().Context(), service.NotificationListParams{
+		Recipient:  requestActor(c, req.User),
+		UnreadOnly: req.UnreadOnly,
+		Page:       req.Page,
+		PageSize:   req.PageSize,
+	})
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &APIResponse{
+		Success: true,
+		Data:    list,
+		Meta: &APIMeta{
+			Page:       list.Page,
+			PageSize:   list.PageSize,
+			Total:      int(list.Total),
+			TotalPages: list.TotalPages,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// markRead отмечает уведомление прочитанным
+func (h *NotificationHandler) markRead(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID уведомления"))
+	}
+
+	notification, err := h.service.MarkRead(c.Request().Context(), requestActor(c, c.QueryParam("user")), id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, notification)
+}
+
+// markAllRead отмечает прочитанными все уведомления пользователя
+func (h *NotificationHandler) markAllRead(c echo.Context) error {
+	updated, err := h.service.MarkAllRead(c.Request().Context(), requestActor(c, c.QueryParam("user")))
+	if err != nil {
+		requestLogger(c, h.logger).WithError(err).Error("Ошибка отметки уведомлений прочитанными")
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]int64{"updated": updated})
+}
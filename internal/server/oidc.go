@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// OIDCLoginRoute маршрут перенаправления дашборда на вход у провайдера
+	OIDCLoginRoute = "/auth/login"
+
+	// oidcRequestTimeout ограничение запросов к провайдеру за настройками и ключами
+	oidcRequestTimeout = 10 * time.Second
+)
+
+// OIDCAuthenticator проверяет токены OpenID Connect провайдера из Authorization: Bearer.
+// Настройки провайдера загружаются при первом запросе, его ключи подписи (JWKS)
+// кешируются и перечитываются, только когда токен подписан неизвестным ключом.
+type OIDCAuthenticator struct {
+	config config.OIDC
+	client *http.Client
+	logger logging.Logger
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCAuthenticator создает проверку токенов OpenID Connect
+func NewOIDCAuthenticator(cfg config.OIDC, logger logging.Logger) *OIDCAuthenticator {
+	if cfg.Audience == "" {
+		cfg.Audience = cfg.ClientID
+	}
+	return &OIDCAuthenticator{
+		config: cfg,
+		client: &http.Client{Timeout: oidcRequestTimeout},
+		logger: logger,
+	}
+}
+
+// Authenticate проверяет подпись, issuer, аудиторию и срок действия токена.
+// API ключи в Authorization: Bearer пропускаются.
+func (a *OIDCAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	token, found := strings.CutPrefix(c.Request().Header.Get(HeaderAuthorization), "Bearer ")
+	if !found || token == "" || strings.HasPrefix(token, service.APIKeyPrefix) {
+		return nil, nil
+	}
+
+	if _, err := a.getProvider(); err != nil {
+		return nil, err
+	}
+
+	ctx := oidc.ClientContext(c.Request().Context(), a.client)
+	idToken, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		requestLogger(c, a.logger).WithError(err).WithField("issuer", a.config.Issuer).Debug("Токен OIDC не прошел проверку")
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	return a.principal(claims)
+}
+
+// principal сопоставляет claims токена пользователю и его областям доступа
+func (a *OIDCAuthenticator) principal(claims map[string]interface{}) (*Principal, error) {
+	subject, _ := lookupClaim(claims, a.config.SubjectClaim).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: в токене нет claim %s", ErrInvalidCredentials, a.config.SubjectClaim)
+	}
+
+	var roles []string
+	if a.config.RolesClaim != "" {
+		roles = claimStrings(lookupClaim(claims, a.config.RolesClaim))
+	}
+
+	scopes := models.Scopes{}
+	for _, role := range roles {
+		granted := a.config.RoleScopes[role]
+		if slices.Contains(models.APIKeyScopes, role) {
+			granted = append(granted, role)
+		}
+		for _, scope := range granted {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	return &Principal{Subject: subject, Scopes: scopes, Roles: roles, Method: "oidc"}, nil
+}
+
+// getProvider загружает настройки провайдера при первом обращении. Неудачная
+// загрузка повторяется при следующем запросе, чтобы сервер запускался без провайдера.
+func (a *OIDCAuthenticator) getProvider() (*oidc.Provider, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.provider != nil {
+		return a.provider, nil
+	}
+
+	// Ключи провайдера загружаются с контекстом discovery без его отмены,
+	// поэтому используется фоновый контекст, а не контекст запроса
+	ctx, cancel := context.WithTimeout(oidc.ClientContext(context.Background(), a.client), oidcRequestTimeout)
+	defer cancel()
+
+	provider, err := oidc.NewProvider(ctx, a.config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки настроек OIDC провайдера %s: %w", a.config.Issuer, err)
+	}
+
+	a.provider = provider
+	a.verifier = provider.Verifier(&oidc.Config{ClientID: a.config.Audience})
+	a.logger.WithField("issuer", a.config.Issuer).Info("Настройки OIDC провайдера загружены")
+	return provider, nil
+}
+
+// lookupClaim возвращает claim по пути через точку, например realm_access.roles
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// claimStrings приводит claim ролей к списку строк: поддерживаются массив
+// и строка с ролями через пробел, как в claim scope
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// OIDCLoginHandler перенаправляет дашборд на страницу входа провайдера. Код авторизации
+// обменивает на токен сам дашборд, поэтому state и PKCE передаются от него как есть.
+type OIDCLoginHandler struct {
+	authenticator  *OIDCAuthenticator
+	logger         logging.Logger
+	responseWriter ResponseWriter
+}
+
+// NewOIDCLoginHandler создает обработчик перенаправления на вход
+func NewOIDCLoginHandler(authenticator *OIDCAuthenticator, logger logging.Logger) Handler {
+	return &OIDCLoginHandler{
+		authenticator:  authenticator,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршрут входа
+func (h *OIDCLoginHandler) Register(group *echo.Group) {
+	group.GET(OIDCLoginRoute, h.login)
+}
+
+// login перенаправляет на адрес авторизации провайдера
+func (h *OIDCLoginHandler) login(c echo.Context) error {
+	state := c.QueryParam("state")
+	if state == "" {
+		return h.responseWriter.ValidationError(c, errors.New("параметр state обязателен"))
+	}
+
+	provider, err := h.authenticator.getProvider()
+	if err != nil {
+		requestLogger(c, h.logger).WithError(err).Error("Провайдер OIDC недоступен")
+		return h.responseWriter.Error(c, err)
+	}
+
+	cfg := h.authenticator.config
+	oauth := oauth2.Config{
+		ClientID:    cfg.ClientID,
+		Endpoint:    provider.Endpoint(),
+		RedirectURL: cfg.RedirectURL,
+		Scopes:      []string{oidc.ScopeOpenID, "profile", "email"},
+	}
+
+	var options []oauth2.AuthCodeOption
+	if challenge := c.QueryParam("code_challenge"); challenge != "" {
+		method := c.QueryParam("code_challenge_method")
+		if method == "" {
+			method = "S256"
+		}
+		options = append(options,
+			oauth2.SetAuthURLParam("code_challenge", challenge),
+			oauth2.SetAuthURLParam("code_challenge_method", method),
+		)
+	}
+
+	return c.Redirect(http.StatusFound, oauth.AuthCodeURL(state, options...))
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOIDCIssuer провайдер OpenID Connect с ключом подписи, созданным для теста
+type testOIDCIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func startTestOIDCIssuer(t *testing.T) *testOIDCIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	issuer := &testOIDCIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.server.URL,
+			"authorization_endpoint":                issuer.server.URL + "/authorize",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"jwks_uri":                              issuer.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test-key", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// token подписывает токен ключом провайдера
+func (i *testOIDCIssuer) token(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test-key"))
+	require.NoError(t, err)
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	require.NoError(t, err)
+	return token
+}
+
+// claims возвращает действующие claims токена для клиента report-srv
+func (i *testOIDCIssuer) claims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":                i.server.URL,
+		"aud":                "report-srv",
+		"sub":                "3f2c",
+		"preferred_username": "john.doe",
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"realm_access":       map[string]interface{}{"roles": []string{"analyst", models.ScopeAdmin}},
+	}
+}
+
+func authenticateBearer(authenticator *OIDCAuthenticator, token string) (*Principal, error) {
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/reports", nil)
+	request.Header.Set(HeaderAuthorization, "Bearer "+token)
+	return authenticator.Authenticate(echo.New().NewContext(request, httptest.NewRecorder()))
+}
+
+func TestOIDCAuthenticatorVerifiesToken(t *testing.T) {
+	issuer := startTestOIDCIssuer(t)
+	authenticator := NewOIDCAuthenticator(config.OIDC{
+		Issuer:       issuer.server.URL,
+		ClientID:     "report-srv",
+		SubjectClaim: "preferred_username",
+		RolesClaim:   "realm_access.roles",
+		RoleScopes:   map[string][]string{"analyst": {models.ScopeReportsRead, models.ScopeReportsWrite}},
+	}, logging.Nop())
+
+	principal, err := authenticateBearer(authenticator, issuer.token(t, issuer.key, issuer.claims()))
+	require.NoError(t, err)
+	assert.Equal(t, "john.doe", principal.Subject)
+	assert.Equal(t, "oidc", principal.Method)
+	assert.Equal(t, []string{"analyst", models.ScopeAdmin}, principal.Roles)
+	assert.Equal(t, models.Scopes{models.ScopeReportsRead, models.ScopeReportsWrite, models.ScopeAdmin}, principal.Scopes)
+
+	// API ключи проверяет другой аутентификатор
+	principal, err = authenticateBearer(authenticator, "rsk_abcdef")
+	require.NoError(t, err)
+	assert.Nil(t, principal)
+}
+
+func TestOIDCAuthenticatorRejectsInvalidTokens(t *testing.T) {
+	issuer := startTestOIDCIssuer(t)
+	authenticator := NewOIDCAuthenticator(config.OIDC{
+		Issuer:       issuer.server.URL,
+		ClientID:     "report-srv",
+		SubjectClaim: "preferred_username",
+	}, logging.Nop())
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	cases := map[string]func(claims map[string]interface{}) string{
+		"чужой issuer": func(claims map[string]interface{}) string {
+			claims["iss"] = "https://evil.example.com"
+			return issuer.token(t, issuer.key, claims)
+		},
+		"другая аудитория": func(claims map[string]interface{}) string {
+			claims["aud"] = "another-client"
+			return issuer.token(t, issuer.key, claims)
+		},
+		"истекший токен": func(claims map[string]interface{}) string {
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			return issuer.token(t, issuer.key, claims)
+		},
+		"чужой ключ подписи": func(claims map[string]interface{}) string {
+			return issuer.token(t, otherKey, claims)
+		},
+		"нет claim пользователя": func(claims map[string]interface{}) string {
+			delete(claims, "preferred_username")
+			return issuer.token(t, issuer.key, claims)
+		},
+	}
+	for name, token := range cases {
+		principal, err := authenticateBearer(authenticator, token(issuer.claims()))
+		assert.ErrorIs(t, err, ErrInvalidCredentials, name)
+		assert.Nil(t, principal, name)
+	}
+}
+
+func TestOIDCClaimStrings(t *testing.T) {
+	assert.Equal(t, []string{"reports:read", "reports:write"}, claimStrings("reports:read reports:write"))
+	assert.Equal(t, []string{"analyst"}, claimStrings([]interface{}{"analyst", "", 42}))
+	assert.Nil(t, claimStrings(map[string]interface{}{}))
+
+	claims := map[string]interface{}{"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}}}
+	assert.Equal(t, []interface{}{"admin"}, lookupClaim(claims, "realm_access.roles"))
+	assert.Nil(t, lookupClaim(claims, "resource_access.roles"))
+}
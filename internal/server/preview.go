@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/http"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// PreviewDefinitionRequest несохраненное определение отчета для предпросмотра
+type PreviewDefinitionRequest struct {
+	Name            string                   `json:"name" validate:"max=100"`
+	Queries         []DefinitionQueryRequest `json:"queries" validate:"required,min=1,dive"`
+	TemplateKey     string                   `json:"template_key" validate:"max=255"`
+	ParameterSchema map[string]interface{}   `json:"parameter_schema"`
+	ExcelLayout     *models.ExcelLayout      `json:"excel_layout"`
+	ColumnMapping   *models.ColumnMapping    `json:"column_mapping"`
+	Masking         models.MaskingRules      `json:"masking"`
+}
+
+// PreviewReportRequest запрос предпросмотра отчета по сохраненному определению (type)
+// или по несохраненному (definition)
+type PreviewReportRequest struct {
+	Type       string                    `json:"type" validate:"required_without=Definition,max=100"`
+	Definition *PreviewDefinitionRequest `json:"definition" validate:"omitempty"`
+	Parameters models.JSON               `json:"parameters"`
+	Format     string                    `json:"format" validate:"omitempty,report_format"`
+	Limit      int                       `json:"limit" validate:"min=0"`
+}
+
+// PreviewHandler обработчик предпросмотра отчетов
+type PreviewHandler struct {
+	service        service.PreviewService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewPreviewHandler создает новый обработчик предпросмотра отчетов
+func NewPreviewHandler(service service.PreviewService, logger logging.Logger) Handler {
+	return &PreviewHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршрут предпросмотра
+func (h *PreviewHandler) Register(group *echo.Group) {
+	group.POST("/reports/preview", h.previewReport)
+}
+
+// previewReport выполняет запросы определения с ограничением строк и возвращает данные
+// в JSON, а если задан формат - файл по этим данным. Отчет не создается.
+func (h *PreviewHandler) previewReport(c echo.Context) error {
+	var req PreviewReportRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	request := service.PreviewRequest{
+		Type:       req.Type,
+		Parameters: req.Parameters,
+		Format:     models.ReportFormat(req.Format),
+		Limit:      req.Limit,
+	}
+	if req.Definition != nil {
+		request.Definition = &models.ReportDefinition{
+			Name:            req.Definition.Name,
+			Queries:         toQueries(req.Definition.Queries),
+			TemplateKey:     req.Definition.TemplateKey,
+			ParameterSchema: req.Definition.ParameterSchema,
+			ExcelLayout:     req.Definition.ExcelLayout,
+			ColumnMapping:   req.Definition.ColumnMapping,
+			Masking:         req.Definition.Masking,
+		}
+	}
+
+	preview, err := h.service.Preview(c.Request().Context(), request)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	if preview.File != nil {
+		defer preview.File.Reader.Close()
+		return sendReportFile(c, h.responseWriter, &models.Report{Format: request.Format}, preview.File, http.StatusOK)
+	}
+	return h.responseWriter.Success(c, preview)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// SetQuotaRequest запрос на изменение лимитов пользователя. Незаданный лимит
+// берется из настроек по умолчанию, 0 - без ограничения.
+type SetQuotaRequest struct {
+	MaxConcurrent    *int   `json:"max_concurrent" validate:"omitempty,min=0"`
+	MaxReportsPerDay *int   `json:"max_reports_per_day" validate:"omitempty,min=0"`
+	MaxStoredBytes   *int64 `json:"max_stored_bytes" validate:"omitempty,min=0"`
+	UpdatedBy        string `json:"updated_by" validate:"required,min=1,max=255"`
+}
+
+// QuotaHandler обработчик административного API лимитов пользователей
+type QuotaHandler struct {
+	service        service.QuotaService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewQuotaHandler создает новый обработчик лимитов пользователей
+func NewQuotaHandler(service service.QuotaService, logger logging.Logger) Handler {
+	return &QuotaHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршруты лимитов пользователей
+func (h *QuotaHandler) Register(group *echo.Group) {
+	quotas := group.Group("/admin/quotas")
+	{
+		quotas.GET("", h.listQuotas)
+		quotas.GET("/:subject", h.getQuota)
+		quotas.PUT("/:subject", h.setQuota)
+		quotas.DELETE("/:subject", h.deleteQuota)
+	}
+}
+
+// listQuotas возвращает лимиты по умолчанию и пользователей с переопределенными лимитами
+func (h *QuotaHandler) listQuotas(c echo.Context) error {
+	quotas, err := h.service.ListQuotas(c.Request().Context())
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, quotas)
+}
+
+// getQuota возвращает действующие лимиты пользователя и их использование
+func (h *QuotaHandler) getQuota(c echo.Context) error {
+	status, err := h.service.GetQuota(c.Request().Context(), c.Param("subject"))
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, status)
+}
+
+// setQuota задает лимиты пользователя
+func (h *QuotaHandler) setQuota(c echo.Context) error {
+	var req SetQuotaRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.UpdatedBy = requestActor(c, req.UpdatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	status, err := h.service.SetQuota(c.Request().Context(), &models.Quota{
+		Subject:          c.Param("subject"),
+		MaxConcurrent:    req.MaxConcurrent,
+		MaxReportsPerDay: req.MaxReportsPerDay,
+		MaxStoredBytes:   req.MaxStoredBytes,
+		UpdatedBy:        req.UpdatedBy,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidQuota) {
+			return h.responseWriter.ValidationError(c, err)
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, status)
+}
+
+// deleteQuota сбрасывает лимиты пользователя к настройкам по умолчанию
+func (h *QuotaHandler) deleteQuota(c echo.Context) error {
+	if err := h.service.DeleteQuota(c.Request().Context(), c.Param("subject")); err != nil {
+		if errors.Is(err, service.ErrQuotaNotFound) {
+			return h.responseWriter.NotFound(c, "Лимиты пользователя не заданы")
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "Лимиты пользователя сброшены",
+	})
+}
+
+// quotaExceeded отвечает на превышение лимита пользователя: 429 для лимитов, которые
+// освободятся со временем, и 403 для лимита размера хранимых файлов
+func quotaExceeded(c echo.Context, err *service.QuotaExceededError) error {
+	status := http.StatusForbidden
+	if err.Temporary() {
+		status = http.StatusTooManyRequests
+	}
+	if err.Limit == service.QuotaReportsPerDay {
+		now := time.Now().UTC()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+	}
+
+	return c.JSON(status, &APIResponse{
+		Success: false,
+		Error: &APIError{
+			Code:    "QUOTA_EXCEEDED",
+			Message: "Лимит пользователя исчерпан",
+			Details: map[string]string{
+				"limit":   string(err.Limit),
+				"max":     strconv.FormatInt(err.Max, 10),
+				"current": strconv.FormatInt(err.Current, 10),
+			},
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"report_srv/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Заголовки запросов части файла
+const (
+	HeaderRange        = "Range"
+	HeaderIfRange      = "If-Range"
+	HeaderAcceptRanges = "Accept-Ranges"
+	HeaderContentRange = "Content-Range"
+)
+
+// errRangeNotSatisfiable запрошенный диапазон начинается за концом файла
+var errRangeNotSatisfiable = errors.New("запрошенный диапазон за пределами файла")
+
+// byteRange диапазон байт файла
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// contentRange возвращает значение заголовка Content-Range диапазона файла размером size
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.offset, r.offset+r.length-1, size)
+}
+
+// parseRange разбирает заголовок Range с одним диапазоном байт файла размером size.
+// Заголовок с другими единицами, несколькими диапазонами или ошибкой синтаксиса
+// игнорируется (ok = false), и файл отдается целиком.
+func parseRange(header string, size int64) (r byteRange, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return byteRange{}, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return byteRange{}, false, nil
+	}
+
+	// Суффикс bytes=-N - последние N байт файла
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return byteRange{}, false, nil
+		}
+		if suffix == 0 {
+			return byteRange{}, true, errRangeNotSatisfiable
+		}
+		suffix = min(suffix, size)
+		return byteRange{offset: size - suffix, length: suffix}, true, nil
+	}
+
+	offset, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || offset < 0 {
+		return byteRange{}, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < offset {
+			return byteRange{}, false, nil
+		}
+		end = min(end, size-1)
+	}
+	if offset >= size {
+		return byteRange{}, true, errRangeNotSatisfiable
+	}
+	return byteRange{offset: offset, length: end - offset + 1}, true, nil
+}
+
+// reportFileRange возвращает запрошенную клиентом часть файла отчета или nil, если файл
+// отдается целиком. Части поддерживаются для файла в том виде, в котором он сохранен,
+// и известного размера; If-Range сравнивается с сильным ETag файла.
+func reportFileRange(c echo.Context, report *models.Report, etag string) (*byteRange, error) {
+	if report.FileSize <= 0 || decodedForClient(c, report) {
+		return nil, nil
+	}
+	c.Response().Header().Set(HeaderAcceptRanges, "bytes")
+
+	header := c.Request().Header.Get(HeaderRange)
+	if header == "" {
+		return nil, nil
+	}
+	if ifRange := c.Request().Header.Get(HeaderIfRange); ifRange != "" &&
+		(etag == "" || strings.HasPrefix(ifRange, "W/") || ifRange != etag) {
+		return nil, nil
+	}
+
+	r, ok, err := parseRange(header, report.FileSize)
+	if !ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// rangeNotSatisfiable отвечает 416 с размером файла в Content-Range
+func rangeNotSatisfiable(c echo.Context, size int64) error {
+	c.Response().Header().Set(HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+	return errorResponse(c, http.StatusRequestedRangeNotSatisfiable, "RANGE_NOT_SATISFIABLE", errRangeNotSatisfiable.Error())
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+)
+
+// Заголовки ограничения частоты запросов (IETF draft-ietf-httpapi-ratelimit-headers)
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// rateLimitIdleTTL время, после которого корзина без запросов удаляется из памяти
+const rateLimitIdleTTL = 10 * time.Minute
+
+// RateLimitBucket лимит корзины токенов: Burst запросов подряд, дальше Rate запросов в секунду
+type RateLimitBucket struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitResult результат списания токена из корзины
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining сколько запросов клиент может сделать без ожидания
+	Remaining int
+	// Reset через сколько корзина заполнится полностью
+	Reset time.Duration
+	// RetryAfter через сколько появится токен для отклоненного запроса
+	RetryAfter time.Duration
+}
+
+// RateLimitStore хранит корзины токенов клиентов
+type RateLimitStore interface {
+	// Take списывает токен из корзины key с лимитом bucket
+	Take(ctx context.Context, key string, bucket RateLimitBucket) (RateLimitResult, error)
+}
+
+// NewRateLimitStore создает хранилище корзин, выбранное в конфигурации
+func NewRateLimitStore(cfg config.Config) RateLimitStore {
+	if cfg.Server.RateLimit.Store == "redis" {
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Address,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return NewRedisRateLimitStore(client, cfg.Processor.QueuePrefix)
+	}
+	return NewMemoryRateLimitStore()
+}
+
+// tokenBucket состояние корзины: число токенов на момент updated
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take пополняет корзину на время с последнего запроса и списывает токен, если он есть
+func (b *tokenBucket) take(now time.Time, limit RateLimitBucket) RateLimitResult {
+	burst := float64(limit.Burst)
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*limit.Rate)
+	}
+	b.updated = now
+	return takeToken(&b.tokens, limit)
+}
+
+// takeToken списывает токен из корзины с tokens токенами и возвращает результат
+func takeToken(tokens *float64, limit RateLimitBucket) RateLimitResult {
+	result := RateLimitResult{}
+	if *tokens >= 1 {
+		*tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = rateDuration(1-*tokens, limit.Rate)
+	}
+	result.Remaining = int(*tokens)
+	result.Reset = rateDuration(float64(limit.Burst)-*tokens, limit.Rate)
+	return result
+}
+
+// rateDuration время, за которое в корзину поступит tokens токенов
+func rateDuration(tokens, rate float64) time.Duration {
+	return time.Duration(tokens / rate * float64(time.Second))
+}
+
+// MemoryRateLimitStore хранит корзины в памяти экземпляра сервиса. При нескольких
+// экземплярах лимит действует на каждый из них отдельно.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRateLimitStore создает хранилище корзин в памяти
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Take списывает токен из корзины key
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimitBucket) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) > rateLimitIdleTTL {
+		for bucketKey, bucket := range s.buckets {
+			if now.Sub(bucket.updated) > rateLimitIdleTTL {
+				delete(s.buckets, bucketKey)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	bucket, exists := s.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = bucket
+	}
+	return bucket.take(now, limit), nil
+}
+
+// rateLimitScript пополняет корзину и списывает токен атомарно.
+// KEYS[1] - ключ корзины, ARGV[1] - пополнение в секунду, ARGV[2] - емкость,
+// ARGV[3] - текущее время в мс. Возвращает 1, если токен списан, и остаток токенов
+// в тысячных долях.
+var rateLimitScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+	updated = now
+end
+if now > updated then
+	tokens = math.min(burst, tokens + (now - updated) / 1000 * rate)
+	updated = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(updated))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, math.floor(tokens * 1000)}
+`)
+
+// RedisRateLimitStore хранит корзины в Redis, лимит общий для всех экземпляров сервиса.
+// Время берется с экземпляра, поэтому часы экземпляров должны быть синхронизированы.
+type RedisRateLimitStore struct {
+	client redis.UniversalClient
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisRateLimitStore создает хранилище корзин в Redis с ключами <prefix>:ratelimit:<клиент>
+func NewRedisRateLimitStore(client redis.UniversalClient, prefix string) *RedisRateLimitStore {
+	if prefix == "" {
+		prefix = "report_srv"
+	}
+	return &RedisRateLimitStore{client: client, prefix: prefix, now: time.Now}
+}
+
+// Take списывает токен из корзины key
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimitBucket) (RateLimitResult, error) {
+	values, err := rateLimitScript.Run(ctx, s.client, []string{s.prefix + ":ratelimit:" + key},
+		limit.Rate, limit.Burst, s.now().UnixMilli()).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("ошибка списания токена в Redis: %w", err)
+	}
+	if len(values) != 2 {
+		return RateLimitResult{}, fmt.Errorf("неожиданный ответ Redis: %v", values)
+	}
+
+	tokens := float64(values[1]) / 1000
+	result := RateLimitResult{
+		Allowed:   values[0] == 1,
+		Remaining: int(tokens),
+		Reset:     rateDuration(float64(limit.Burst)-tokens, limit.Rate),
+	}
+	if !result.Allowed {
+		result.RetryAfter = rateDuration(1-tokens, limit.Rate)
+	}
+	return result, nil
+}
+
+// RateLimitMiddleware ограничивает частоту запросов каждого клиента корзиной токенов.
+// Клиентом считается аутентифицированный пользователь или API ключ, без аутентификации -
+// IP адрес. Корзина адреса списывается до аутентификации, поэтому перебор учетных данных
+// тоже ограничивается, корзина клиента - после нее.
+type RateLimitMiddleware struct {
+	store      RateLimitStore
+	limit      RateLimitBucket
+	identities map[string]RateLimitBucket
+	logger     logging.Logger
+}
+
+// rateLimitAddressKey ключ контекста Echo с результатом списания токена из корзины IP адреса
+const rateLimitAddressKey = "rate_limit_address"
+
+// rateLimitDecision результат списания токена из корзины с ее лимитом
+type rateLimitDecision struct {
+	limit  RateLimitBucket
+	result RateLimitResult
+}
+
+// NewRateLimitMiddleware создает middleware ограничения частоты запросов
+func NewRateLimitMiddleware(cfg config.RateLimit, store RateLimitStore, logger logging.Logger) *RateLimitMiddleware {
+	identities := make(map[string]RateLimitBucket, len(cfg.Identities))
+	for _, identity := range cfg.Identities {
+		identities[strings.ToLower(identity.Identity)] = RateLimitBucket{Rate: identity.Rate, Burst: identity.Burst}
+	}
+	return &RateLimitMiddleware{
+		store:      store,
+		limit:      RateLimitBucket{Rate: cfg.Rate, Burst: cfg.Burst},
+		identities: identities,
+		logger:     logger,
+	}
+}
+
+// Apply подключает middleware к Echo
+func (m *RateLimitMiddleware) Apply(e *echo.Echo) {
+	m.ApplyAround(e)
+}
+
+// ApplyAround подключает ограничение вокруг middlewares, среди которых аутентификация:
+// корзина IP адреса списывается до них, корзина аутентифицированного клиента - после
+func (m *RateLimitMiddleware) ApplyAround(e *echo.Echo, middlewares ...Middleware) {
+	e.Use(m.limitAddress)
+	for _, mw := range middlewares {
+		mw.Apply(e)
+	}
+	e.Use(m.limitClient)
+}
+
+// limitAddress списывает токен из корзины IP адреса. Запрос с пустой корзиной здесь не отклоняется:
+// аутентифицированный клиент ограничивается своей корзиной, а запрос без действительных учетных
+// данных отклоняется с 429 аутентификацией или limitClient. При недоступности хранилища корзин
+// запрос пропускается.
+func (m *RateLimitMiddleware) limitAddress(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if isHealthRoute(c) {
+			return next(c)
+		}
+
+		result, err := m.store.Take(c.Request().Context(), "ip:"+c.RealIP(), m.limit)
+		if err != nil {
+			requestLogger(c, m.logger).WithError(err).Warn("Ограничение частоты запросов недоступно, запрос пропущен")
+			c.Set(rateLimitAddressKey, (*rateLimitDecision)(nil))
+			return next(c)
+		}
+		c.Set(rateLimitAddressKey, &rateLimitDecision{limit: m.limit, result: result})
+		return next(c)
+	}
+}
+
+// limitClient списывает токен аутентифицированного клиента, запрос без аутентификации
+// ограничивается корзиной IP адреса. Пустая корзина отклоняет запрос с 429.
+func (m *RateLimitMiddleware) limitClient(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if isHealthRoute(c) {
+			return next(c)
+		}
+
+		if decision, ok := c.Get(rateLimitAddressKey).(*rateLimitDecision); ok && PrincipalFromContext(c) == nil {
+			if decision == nil {
+				return next(c)
+			}
+			return respondRateLimit(c, next, decision)
+		}
+
+		key, limit := m.bucket(c)
+		result, err := m.store.Take(c.Request().Context(), key, limit)
+		if err != nil {
+			requestLogger(c, m.logger).WithError(err).Warn("Ограничение частоты запросов недоступно, запрос пропущен")
+			return next(c)
+		}
+		return respondRateLimit(c, next, &rateLimitDecision{limit: limit, result: result})
+	}
+}
+
+// bucket возвращает ключ корзины клиента и его лимит
+func (m *RateLimitMiddleware) bucket(c echo.Context) (string, RateLimitBucket) {
+	principal := PrincipalFromContext(c)
+	if principal == nil {
+		return "ip:" + c.RealIP(), m.limit
+	}
+	identity := strings.ToLower(principal.Subject)
+	if limit, exists := m.identities[identity]; exists {
+		return "id:" + identity, limit
+	}
+	return "id:" + identity, m.limit
+}
+
+// respondRateLimit выставляет заголовки лимита и пропускает запрос или отклоняет его с 429
+func respondRateLimit(c echo.Context, next echo.HandlerFunc, decision *rateLimitDecision) error {
+	setRateLimitHeaders(c, decision)
+	if decision.result.Allowed {
+		return next(c)
+	}
+	return rateLimitError(c, decision)
+}
+
+// rejectLimitedAddress отклоняет с 429 запрос без действительных учетных данных, если корзина
+// его IP адреса пуста. Возвращает false, если адрес не ограничен.
+func rejectLimitedAddress(c echo.Context) (bool, error) {
+	decision, ok := c.Get(rateLimitAddressKey).(*rateLimitDecision)
+	if !ok || decision == nil || decision.result.Allowed {
+		return false, nil
+	}
+	setRateLimitHeaders(c, decision)
+	return true, rateLimitError(c, decision)
+}
+
+func setRateLimitHeaders(c echo.Context, decision *rateLimitDecision) {
+	header := c.Response().Header()
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(decision.limit.Burst))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(decision.result.Remaining))
+	header.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(decision.result.Reset)))
+}
+
+func rateLimitError(c echo.Context, decision *rateLimitDecision) error {
+	c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(max(ceilSeconds(decision.result.RetryAfter), 1)))
+	return errorResponse(c, http.StatusTooManyRequests, "RATE_LIMITED", "Слишком много запросов, повторите позже")
+}
+
+// isHealthRoute проверяет, относится ли запрос к проверкам здоровья: они не ограничиваются
+func isHealthRoute(c echo.Context) bool {
+	path := c.Path()
+	return path == "/health" || strings.HasPrefix(path, "/health/")
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
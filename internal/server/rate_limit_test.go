@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClock часы, которые тест переводит вручную
+type testClock struct {
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// testRateLimitStore проверяет пополнение корзины и раздельные корзины клиентов
+func testRateLimitStore(t *testing.T, store RateLimitStore, clock *testClock) {
+	ctx := context.Background()
+	limit := RateLimitBucket{Rate: 2, Burst: 2}
+
+	result, err := store.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 1, Reset: 500 * time.Millisecond}, result)
+	result, err = store.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 0, Reset: time.Second}, result)
+
+	// Пустая корзина отклоняет запрос до поступления токена
+	result, err = store.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.Equal(t, RateLimitResult{Allowed: false, Remaining: 0, Reset: time.Second, RetryAfter: 500 * time.Millisecond}, result)
+
+	// У другого клиента своя корзина
+	result, err = store.Take(ctx, "ip:10.0.0.2", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	// Токены поступают со скоростью Rate
+	clock.Advance(250 * time.Millisecond)
+	result, err = store.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 250*time.Millisecond, result.RetryAfter)
+
+	clock.Advance(250 * time.Millisecond)
+	result, err = store.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	// Корзина не пополняется сверх Burst
+	clock.Advance(time.Minute)
+	for i := 0; i < limit.Burst; i++ {
+		result, err = store.Take(ctx, "ip:10.0.0.1", limit)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+	result, err = store.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	clock := newTestClock()
+	store := NewMemoryRateLimitStore()
+	store.now = clock.Now
+	store.lastSweep = clock.Now()
+
+	testRateLimitStore(t, store, clock)
+
+	// Корзины без запросов удаляются из памяти
+	clock.Advance(rateLimitIdleTTL + time.Second)
+	_, err := store.Take(context.Background(), "ip:10.0.0.3", RateLimitBucket{Rate: 1, Burst: 1})
+	require.NoError(t, err)
+	assert.Len(t, store.buckets, 1)
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	clock := newTestClock()
+	store := NewRedisRateLimitStore(client, "")
+	store.now = clock.Now
+
+	testRateLimitStore(t, store, clock)
+
+	// Корзина хранится до полного пополнения с запасом в секунду
+	assert.True(t, server.Exists("report_srv:ratelimit:ip:10.0.0.1"))
+	assert.Equal(t, 2*time.Second, server.TTL("report_srv:ratelimit:ip:10.0.0.1"))
+
+	// Корзина общая для экземпляров сервиса с тем же Redis
+	other := NewRedisRateLimitStore(client, "")
+	other.now = clock.Now
+	result, err := other.Take(context.Background(), "ip:10.0.0.1", RateLimitBucket{Rate: 2, Burst: 2})
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+
+	// Недоступность Redis возвращается как ошибка
+	server.Close()
+	_, err = store.Take(context.Background(), "ip:10.0.0.1", RateLimitBucket{Rate: 2, Burst: 2})
+	assert.Error(t, err)
+}
+
+// failingRateLimitStore хранилище корзин, которое всегда недоступно
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, RateLimitBucket) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("connection refused")
+}
+
+// newRateLimitTestServer создает сервер с ограничением частоты запросов. Клиент из
+// заголовка X-Test-Subject считается аутентифицированным.
+func newRateLimitTestServer(cfg config.RateLimit, store RateLimitStore) *echo.Echo {
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if subject := c.Request().Header.Get("X-Test-Subject"); subject != "" {
+				c.Set(principalContextKey, &Principal{Subject: subject, Method: "api_key"})
+			}
+			return next(c)
+		}
+	})
+	NewRateLimitMiddleware(cfg, store, logging.Nop()).Apply(e)
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/api/v1/reports", ok)
+	e.GET("/health", ok)
+	return e
+}
+
+func rateLimitRequest(e *echo.Echo, path, remoteAddr, subject string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.RemoteAddr = remoteAddr
+	if subject != "" {
+		request.Header.Set("X-Test-Subject", subject)
+	}
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	clock := newTestClock()
+	store := NewMemoryRateLimitStore()
+	store.now = clock.Now
+	e := newRateLimitTestServer(config.RateLimit{
+		Rate:       1,
+		Burst:      2,
+		Identities: []config.RateLimitIdentity{{Identity: "APIKEY:billing", Rate: 10, Burst: 5}},
+	}, store)
+
+	response := rateLimitRequest(e, "/api/v1/reports", "10.0.0.1:51000", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "2", response.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", response.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "1", response.Header().Get(HeaderRateLimitReset))
+	assert.Empty(t, response.Header().Get(HeaderRetryAfter))
+
+	response = rateLimitRequest(e, "/api/v1/reports", "10.0.0.1:51001", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "0", response.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "2", response.Header().Get(HeaderRateLimitReset))
+
+	// Исчерпанная корзина отклоняет запрос с 429 и временем до следующей попытки
+	response = rateLimitRequest(e, "/api/v1/reports", "10.0.0.1:51002", "")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "2", response.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "0", response.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "2", response.Header().Get(HeaderRateLimitReset))
+	assert.Equal(t, "1", response.Header().Get(HeaderRetryAfter))
+	var body APIResponse
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	require.NotNil(t, body.Error)
+	assert.Equal(t, "RATE_LIMITED", body.Error.Code)
+
+	// Другой IP и аутентифицированный клиент с того же IP ограничиваются отдельно
+	assert.Equal(t, http.StatusOK, rateLimitRequest(e, "/api/v1/reports", "10.0.0.2:51000", "").Code)
+	response = rateLimitRequest(e, "/api/v1/reports", "10.0.0.1:51003", "john.doe")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "2", response.Header().Get(HeaderRateLimitLimit))
+
+	// Клиент со своим лимитом в конфигурации, имя сравнивается без учета регистра
+	response = rateLimitRequest(e, "/api/v1/reports", "10.0.0.1:51004", "apikey:billing")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "5", response.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "4", response.Header().Get(HeaderRateLimitRemaining))
+
+	// Проверки здоровья не ограничиваются
+	response = rateLimitRequest(e, "/health", "10.0.0.1:51005", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Empty(t, response.Header().Get(HeaderRateLimitLimit))
+
+	// После поступления токена запрос снова проходит
+	clock.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, rateLimitRequest(e, "/api/v1/reports", "10.0.0.1:51006", "").Code)
+}
+
+func TestRateLimitMiddlewareStoreUnavailable(t *testing.T) {
+	e := newRateLimitTestServer(config.RateLimit{Rate: 1, Burst: 1}, failingRateLimitStore{})
+
+	// Без хранилища корзин запросы пропускаются без заголовков лимита
+	for i := 0; i < 3; i++ {
+		response := rateLimitRequest(e, "/api/v1/reports", "10.0.0.1:51000", "")
+		assert.Equal(t, http.StatusOK, response.Code)
+		assert.Empty(t, response.Header().Get(HeaderRateLimitLimit))
+	}
+}
+
+// tokenAuthenticator принимает токен valid из заголовка X-Test-Token с доступом к отчетам,
+// остальные токены недействительны
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	switch c.Request().Header.Get("X-Test-Token") {
+	case "":
+		return nil, nil
+	case "valid":
+		return &Principal{Subject: "john.doe", Scopes: models.Scopes{models.ScopeReportsRead, models.ScopeReportsWrite}, Method: "api_key"}, nil
+	default:
+		return nil, ErrInvalidCredentials
+	}
+}
+
+func TestRateLimitMiddlewareLimitsFailedAuthentication(t *testing.T) {
+	clock := newTestClock()
+	store := NewMemoryRateLimitStore()
+	store.now = clock.Now
+
+	e := echo.New()
+	NewRateLimitMiddleware(config.RateLimit{Rate: 1, Burst: 3}, store, logging.Nop()).
+		ApplyAround(e, NewAuthMiddleware(logging.Nop(), tokenAuthenticator{}))
+	e.GET("/api/v1/reports", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	request := func(token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/reports", nil)
+		request.RemoteAddr = "10.0.0.1:51000"
+		if token != "" {
+			request.Header.Set("X-Test-Token", token)
+		}
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// Неудачные попытки списывают токены корзины адреса до аутентификации
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, request("guess").Code)
+	}
+	response := request("guess")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "1", response.Header().Get(HeaderRetryAfter))
+	assert.Equal(t, "3", response.Header().Get(HeaderRateLimitLimit))
+	assert.Empty(t, response.Header().Get(echo.HeaderWWWAuthenticate))
+	assert.Equal(t, http.StatusTooManyRequests, request("").Code)
+
+	// Аутентифицированный клиент с того же адреса ограничивается своей корзиной
+	response = request("valid")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "2", response.Header().Get(HeaderRateLimitRemaining))
+
+	// После поступления токена неудачная попытка снова получает 401
+	clock.Advance(time.Second)
+	assert.Equal(t, http.StatusUnauthorized, request("guess").Code)
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// recordingProcessor процессор, который запоминает поставленные и отмененные задачи, но не выполняет их
+type recordingProcessor struct {
+	submitted []string
+	canceled  []string
+}
+
+func (p *recordingProcessor) SubmitTask(ctx context.Context, task service.Task) error {
+	p.submitted = append(p.submitted, task.ID)
+	return nil
+}
+
+func (p *recordingProcessor) CancelTask(taskID string) error {
+	p.canceled = append(p.canceled, taskID)
+	return nil
+}
+
+func (p *recordingProcessor) GetTaskStatus(taskID string) service.TaskStatus {
+	return service.TaskStatusUnknown
+}
+
+// reportHandlerTest обработчик отчетов с сервисом на БД в памяти
+type reportHandlerTest struct {
+	e         *echo.Echo
+	db        *gorm.DB
+	processor *recordingProcessor
+}
+
+func newReportHandlerTest(t *testing.T) *reportHandlerTest {
+	return newReportHandlerTestWithFiles(t, nil)
+}
+
+// newReportHandlerTestWithFiles создает обработчик отчетов с хранилищем файлов fileStorage
+func newReportHandlerTestWithFiles(t *testing.T, fileStorage service.ReportFileStorage) *reportHandlerTest {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Report{}, &models.ReportLink{}, &models.DeadLetter{}))
+
+	logger := logging.Nop()
+	processor := &recordingProcessor{}
+	repository := service.NewGormReportRepository(db, logger)
+	reports := service.NewReportService(repository, service.NewFormatGenerators(logger), fileStorage, processor,
+		events.NewInProcessBus(logger), logger).
+		WithDeadLetters(service.NewGormDeadLetterRepository(db, logger))
+
+	e := echo.New()
+	NewReportHandler(reports, logger).Register(e.Group("/api/v1"))
+	return &reportHandlerTest{e: e, db: db, processor: processor}
+}
+
+func (h *reportHandlerTest) createReport(t *testing.T, status models.ReportStatus) *models.Report {
+	report := &models.Report{
+		Title:     "Продажи",
+		Format:    models.FormatCSV,
+		Status:    status,
+		Attempts:  2,
+		ErrorCode: models.ErrorCodeGeneration,
+		CreatedBy: "alice",
+		UpdatedBy: "alice",
+	}
+	require.NoError(t, h.db.Create(report).Error)
+	return report
+}
+
+func (h *reportHandlerTest) report(t *testing.T, id uint) *models.Report {
+	var report models.Report
+	require.NoError(t, h.db.First(&report, id).Error)
+	return &report
+}
+
+func (h *reportHandlerTest) do(method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	h.e.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func reportPath(id uint) string {
+	return "/api/v1/reports/" + strconv.FormatUint(uint64(id), 10)
+}
+
+func decodeReportResponse(t *testing.T, response *httptest.ResponseRecorder) (*models.Report, *APIError) {
+	var body struct {
+		Data  *models.Report `json:"data"`
+		Error *APIError      `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+	return body.Data, body.Error
+}
+
+func TestUpdateReportHandler(t *testing.T) {
+	h := newReportHandlerTest(t)
+	report := h.createReport(t, models.StatusPending)
+	path := reportPath(report.ID)
+
+	response := h.do(http.MethodPatch, path, `{"title":"Продажи за январь","description":"Итоги","updated_by":"bob"}`)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	updated, _ := decodeReportResponse(t, response)
+	require.NotNil(t, updated)
+	assert.Equal(t, "Продажи за январь", updated.Title)
+	assert.Equal(t, "Итоги", updated.Description)
+	assert.Equal(t, "bob", updated.UpdatedBy)
+	assert.Equal(t, models.StatusPending, updated.Status)
+
+	// Непереданные поля не меняются
+	response = h.do(http.MethodPatch, path, `{"description":"","updated_by":"bob"}`)
+	require.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "Продажи за январь", h.report(t, report.ID).Title)
+
+	assert.Equal(t, http.StatusNotFound, h.do(http.MethodPatch, "/api/v1/reports/999", `{"title":"x","updated_by":"bob"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, h.do(http.MethodPatch, path, `{"title":"x"}`).Code)
+}
+
+func TestCancelReportHandler(t *testing.T) {
+	h := newReportHandlerTest(t)
+	report := h.createReport(t, models.StatusProcessing)
+	path := reportPath(report.ID) + "/cancel"
+
+	response := h.do(http.MethodPost, path, "")
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+	canceled, _ := decodeReportResponse(t, response)
+	require.NotNil(t, canceled)
+	assert.Equal(t, models.StatusCanceled, canceled.Status)
+	assert.Equal(t, []string{"report_" + strconv.FormatUint(uint64(report.ID), 10)}, h.processor.canceled)
+
+	// Отмененный отчет повторно не отменяется
+	response = h.do(http.MethodPost, path, "")
+	assert.Equal(t, http.StatusConflict, response.Code)
+	_, apiErr := decodeReportResponse(t, response)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, "CONFLICT", apiErr.Code)
+
+	assert.Equal(t, http.StatusNotFound, h.do(http.MethodPost, "/api/v1/reports/999/cancel", "").Code)
+}
+
+func TestUpdateReportStatusHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     models.ReportStatus
+		to       models.ReportStatus
+		code     int
+		want     models.ReportStatus
+		canceled bool
+		requeued bool
+	}{
+		{name: "отмена ожидающего", from: models.StatusPending, to: models.StatusCanceled, code: http.StatusOK, want: models.StatusCanceled, canceled: true},
+		{name: "отмена генерируемого", from: models.StatusProcessing, to: models.StatusCanceled, code: http.StatusOK, want: models.StatusCanceled, canceled: true},
+		{name: "ошибка генерируемого", from: models.StatusProcessing, to: models.StatusFailed, code: http.StatusOK, want: models.StatusFailed},
+		{name: "повтор упавшего", from: models.StatusFailed, to: models.StatusPending, code: http.StatusOK, want: models.StatusPending, requeued: true},
+		{name: "повтор отмененного", from: models.StatusCanceled, to: models.StatusPending, code: http.StatusOK, want: models.StatusPending, requeued: true},
+		{name: "processing от клиента", from: models.StatusPending, to: models.StatusProcessing, code: http.StatusConflict, want: models.StatusPending},
+		{name: "completed от клиента", from: models.StatusProcessing, to: models.StatusCompleted, code: http.StatusConflict, want: models.StatusProcessing},
+		{name: "отмена готового", from: models.StatusCompleted, to: models.StatusCanceled, code: http.StatusConflict, want: models.StatusCompleted},
+		{name: "повтор готового", from: models.StatusCompleted, to: models.StatusPending, code: http.StatusConflict, want: models.StatusCompleted},
+		{name: "ошибка ожидающего", from: models.StatusPending, to: models.StatusFailed, code: http.StatusConflict, want: models.StatusPending},
+		{name: "expired от клиента", from: models.StatusCompleted, to: models.StatusExpired, code: http.StatusConflict, want: models.StatusCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newReportHandlerTest(t)
+			report := h.createReport(t, tt.from)
+
+			response := h.do(http.MethodPut, reportPath(report.ID)+"/status",
+				`{"status":"`+string(tt.to)+`","updated_by":"bob"}`)
+			require.Equal(t, tt.code, response.Code, response.Body.String())
+
+			stored := h.report(t, report.ID)
+			assert.Equal(t, tt.want, stored.Status)
+			taskID := "report_" + strconv.FormatUint(uint64(report.ID), 10)
+			if tt.canceled {
+				assert.Equal(t, []string{taskID}, h.processor.canceled)
+			} else {
+				assert.Empty(t, h.processor.canceled)
+			}
+			if tt.requeued {
+				// Повторный запуск сбрасывает причину ошибки и счетчик попыток
+				assert.Equal(t, []string{taskID}, h.processor.submitted)
+				assert.Zero(t, stored.Attempts)
+				assert.Empty(t, stored.ErrorCode)
+			} else {
+				assert.Empty(t, h.processor.submitted)
+			}
+			if tt.code == http.StatusConflict {
+				_, apiErr := decodeReportResponse(t, response)
+				require.NotNil(t, apiErr)
+				assert.Equal(t, "CONFLICT", apiErr.Code)
+			}
+		})
+	}
+}
+
+func TestUpdateReportStatusHandlerMarksDeadLettersRequeued(t *testing.T) {
+	h := newReportHandlerTest(t)
+	report := h.createReport(t, models.StatusFailed)
+	letter := &models.DeadLetter{ReportID: report.ID, TaskID: "report_" + strconv.FormatUint(uint64(report.ID), 10), TaskType: string(service.TaskTypeReportGeneration), Attempts: 3}
+	require.NoError(t, h.db.Create(letter).Error)
+
+	response := h.do(http.MethodPut, reportPath(report.ID)+"/status", `{"status":"pending","updated_by":"bob"}`)
+	require.Equal(t, http.StatusOK, response.Code, response.Body.String())
+
+	require.NoError(t, h.db.First(letter, letter.ID).Error)
+	assert.True(t, letter.IsRequeued())
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// CreateScheduleRequest запрос на создание расписания
+type CreateScheduleRequest struct {
+	Name              string                 `json:"name" validate:"required,min=1,max=255"`
+	CronExpr          string                 `json:"cron_expr" validate:"required,max=255"`
+	Enabled           *bool                  `json:"enabled"`
+	ReportTitle       string                 `json:"report_title" validate:"required,min=1,max=255"`
+	ReportDescription string                 `json:"report_description" validate:"max=1000"`
+	Parameters        map[string]interface{} `json:"parameters"`
+	Format            string                 `json:"format" validate:"omitempty,report_format,ne=docx"`
+	ReportType        string                 `json:"report_type" validate:"max=100"`
+	CreatedBy         string                 `json:"created_by" validate:"required,min=1,max=255"`
+}
+
+// UpdateScheduleRequest запрос на обновление расписания
+type UpdateScheduleRequest struct {
+	Name              *string                `json:"name" validate:"omitempty,min=1,max=255"`
+	CronExpr          *string                `json:"cron_expr" validate:"omitempty,max=255"`
+	Enabled           *bool                  `json:"enabled"`
+	ReportTitle       *string                `json:"report_title" validate:"omitempty,min=1,max=255"`
+	ReportDescription *string                `json:"report_description" validate:"omitempty,max=1000"`
+	Parameters        map[string]interface{} `json:"parameters"`
+	Format            *string                `json:"format" validate:"omitempty,report_format,ne=docx"`
+	ReportType        *string                `json:"report_type" validate:"omitempty,max=100"`
+	UpdatedBy         string                 `json:"updated_by" validate:"required,min=1,max=255"`
+}
+
+// ScheduleHandler обработчик для расписаний отчетов
+type ScheduleHandler struct {
+	service        service.ScheduleService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewScheduleHandler создает новый обработчик расписаний
+func NewScheduleHandler(service service.ScheduleService, logger logging.Logger) Handler {
+	return &ScheduleHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршруты для расписаний
+func (h *ScheduleHandler) Register(group *echo.Group) {
+	schedules := group.Group("/schedules")
+	{
+		schedules.POST("", h.createSchedule)
+		schedules.GET("", h.listSchedules)
+		schedules.GET("/:id", h.getSchedule)
+		schedules.PUT("/:id", h.updateSchedule)
+		schedules.DELETE("/:id", h.deleteSchedule)
+	}
+}
+
+// createSchedule создает новое расписание
+func (h *ScheduleHandler) createSchedule(c echo.Context) error {
+	var req CreateScheduleRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.CreatedBy = requestActor(c, req.CreatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if _, err := service.ParseCronExpression(req.CronExpr); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	schedule := &models.Schedule{
+		Name:              req.Name,
+		CronExpr:          req.CronExpr,
+		Enabled:           enabled,
+		ReportTitle:       req.ReportTitle,
+		ReportDescription: req.ReportDescription,
+		Format:            models.ReportFormat(req.Format),
+		ReportType:        req.ReportType,
+		Parameters:        req.Parameters,
+		CreatedBy:         req.CreatedBy,
+		UpdatedBy:         req.CreatedBy,
+	}
+
+	if err := h.service.CreateSchedule(c.Request().Context(), schedule); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, &APIResponse{
+		Success:   true,
+		Data:      schedule,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// listSchedules возвращает список расписаний с пагинацией
+func (h *ScheduleHandler) listSchedules(c echo.Context) error {
+	var pagination PaginationParams
+	pagination.Page = 1
+	pagination.PageSize = DefaultPageSize
+
+	if err := c.Bind(&pagination); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&pagination); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	params := service.ListScheduleParams{
+		Page:     pagination.Page,
+		PageSize: pagination.PageSize,
+	}
+
+	if value := c.QueryParam("enabled"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return h.responseWriter.ValidationError(c, fmt.Errorf("неверное значение enabled"))
+		}
+		params.Enabled = &enabled
+	}
+
+	scheduleList, err := h.service.ListSchedules(c.Request().Context(), params)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return c.JSON(http.StatusOK, &APIResponse{
+		Success: true,
+		Data:    scheduleList.Schedules,
+		Meta: &APIMeta{
+			Page:       scheduleList.Page,
+			PageSize:   scheduleList.PageSize,
+			Total:      int(scheduleList.Total),
+			TotalPages: scheduleList.TotalPages,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
+// getSchedule возвращает расписание по ID
+func (h *ScheduleHandler) getSchedule(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID расписания"))
+	}
+
+	schedule, err := h.service.GetSchedule(c.Request().Context(), id)
+	if err != nil {
+		return h.responseWriter.NotFound(c, "Расписание не найдено")
+	}
+
+	return h.responseWriter.Success(c, schedule)
+}
+
+// updateSchedule обновляет расписание
+func (h *ScheduleHandler) updateSchedule(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID расписания"))
+	}
+
+	var req UpdateScheduleRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.UpdatedBy = requestActor(c, req.UpdatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if req.CronExpr != nil {
+		if _, err := service.ParseCronExpression(*req.CronExpr); err != nil {
+			return h.responseWriter.ValidationError(c, err)
+		}
+	}
+
+	if _, err := h.service.GetSchedule(c.Request().Context(), id); err != nil {
+		return h.responseWriter.NotFound(c, "Расписание не найдено")
+	}
+
+	params := service.ScheduleUpdateParams{
+		Name:              req.Name,
+		CronExpr:          req.CronExpr,
+		Enabled:           req.Enabled,
+		ReportTitle:       req.ReportTitle,
+		ReportDescription: req.ReportDescription,
+		ReportType:        req.ReportType,
+		UpdatedBy:         req.UpdatedBy,
+	}
+	if req.Parameters != nil {
+		parameters := models.JSON(req.Parameters)
+		params.Parameters = &parameters
+	}
+	if req.Format != nil {
+		format := models.ReportFormat(*req.Format)
+		params.Format = &format
+	}
+
+	schedule, err := h.service.UpdateSchedule(c.Request().Context(), id, params)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, schedule)
+}
+
+// deleteSchedule удаляет расписание
+func (h *ScheduleHandler) deleteSchedule(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID расписания"))
+	}
+
+	if _, err := h.service.GetSchedule(c.Request().Context(), id); err != nil {
+		return h.responseWriter.NotFound(c, "Расписание не найдено")
+	}
+
+	if err := h.service.DeleteSchedule(c.Request().Context(), id); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "Расписание успешно удалено",
+	})
+}
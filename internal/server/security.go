@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"report_srv/internal/config"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// SecurityHeadersMiddleware добавляет к ответам заголовки безопасности: HSTS,
+// X-Content-Type-Options, X-Frame-Options, Content-Security-Policy и Referrer-Policy
+type SecurityHeadersMiddleware struct {
+	config config.SecurityHeaders
+}
+
+// NewSecurityHeadersMiddleware создает middleware заголовков безопасности
+func NewSecurityHeadersMiddleware(cfg config.SecurityHeaders) Middleware {
+	return &SecurityHeadersMiddleware{config: cfg}
+}
+
+// Apply подключает middleware к Echo. HSTS отдается только для запросов по HTTPS,
+// в том числе пришедших через прокси с X-Forwarded-Proto: https.
+func (m *SecurityHeadersMiddleware) Apply(e *echo.Echo) {
+	e.Use(middleware.SecureWithConfig(middleware.SecureConfig{
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         strings.ToUpper(m.config.FrameOptions),
+		HSTSMaxAge:            int(m.config.HSTSMaxAge.Seconds()),
+		HSTSExcludeSubdomains: !m.config.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: m.config.ContentSecurityPolicy,
+		ReferrerPolicy:        m.config.ReferrerPolicy,
+	}))
+}
+
+// NewCORSMiddleware создает middleware CORS для источников из настроек. Без источников
+// возвращает nil: заголовки CORS не отдаются.
+func NewCORSMiddleware(cfg config.CORS) echo.MiddlewareFunc {
+	if len(cfg.AllowOrigins) == 0 {
+		return nil
+	}
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:     cfg.AllowOrigins,
+		AllowCredentials: cfg.AllowCredentials,
+	})
+}
+
+// CSRFMiddleware защищает браузерные сессии с cookie от подделки межсайтовых запросов
+// по схеме double submit cookie: токен выдается в cookie, и запрос, изменяющий данные,
+// должен передать его в заголовке. Чужой сайт не может прочитать cookie и подставить токен.
+type CSRFMiddleware struct {
+	config config.CSRF
+}
+
+// NewCSRFMiddleware создает middleware защиты от CSRF
+func NewCSRFMiddleware(cfg config.CSRF) Middleware {
+	return &CSRFMiddleware{config: cfg}
+}
+
+// Apply подключает middleware к Echo
+func (m *CSRFMiddleware) Apply(e *echo.Echo) {
+	e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		Skipper:        skipCSRF,
+		TokenLookup:    "header:" + m.config.HeaderName,
+		CookieName:     m.config.CookieName,
+		CookiePath:     "/",
+		CookieSecure:   m.config.CookieSecure,
+		CookieHTTPOnly: false,
+		CookieSameSite: http.SameSiteStrictMode,
+		ErrorHandler: func(err error, c echo.Context) error {
+			return errorResponse(c, http.StatusForbidden, "CSRF_TOKEN_INVALID", "Отсутствует или неверен CSRF токен")
+		},
+	}))
+}
+
+// skipCSRF пропускает запросы без cookie и запросы, прошедшие аутентификацию по заголовкам:
+// браузер не добавляет действительный ключ или токен к межсайтовым запросам сам, поэтому
+// подделать их нельзя. Заголовок с неверными учетными данными проверки не отменяет.
+// Проверки здоровья также не проверяются.
+func skipCSRF(c echo.Context) bool {
+	if HeaderAuthenticated(c) {
+		return true
+	}
+	if len(c.Request().Cookies()) == 0 {
+		return true
+	}
+	path := c.Path()
+	return path == "/health" || strings.HasPrefix(path, "/health/")
+}
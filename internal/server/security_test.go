@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCSRFConfig = config.CSRF{Enabled: true, CookieName: "report_srv_csrf", HeaderName: "X-CSRF-Token"}
+
+// newCSRFTestServer создает сервер с защитой от CSRF. С authenticated запросы проходят
+// аутентификацию tokenAuthenticator, без него сессия браузера аутентифицируется прокси перед сервисом.
+func newCSRFTestServer(authenticated bool) *echo.Echo {
+	e := echo.New()
+	if authenticated {
+		NewAuthMiddleware(logging.Nop(), tokenAuthenticator{}).Apply(e)
+	}
+	NewCSRFMiddleware(testCSRFConfig).Apply(e)
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET(APIPrefix+"/reports", ok)
+	e.POST(APIPrefix+"/reports", ok)
+	return e
+}
+
+func csrfRequest(e *echo.Echo, method string, headers map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, APIPrefix+"/reports", nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func csrfCookie(t *testing.T, response *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == testCSRFConfig.CookieName {
+			return cookie
+		}
+	}
+	t.Fatal("cookie с CSRF токеном не выдана")
+	return nil
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	e := newCSRFTestServer(false)
+	session := &http.Cookie{Name: "session", Value: "browser-session"}
+
+	// Токен выдается в cookie, доступной скриптам дашборда
+	response := csrfRequest(e, http.MethodGet, nil, session)
+	require.Equal(t, http.StatusOK, response.Code)
+	token := csrfCookie(t, response)
+	assert.NotEmpty(t, token.Value)
+	assert.False(t, token.HttpOnly)
+	assert.Equal(t, http.SameSiteStrictMode, token.SameSite)
+	assert.Equal(t, "/", token.Path)
+
+	// Изменяющий запрос сессии повторяет токен из cookie в заголовке
+	response = csrfRequest(e, http.MethodPost, map[string]string{"X-CSRF-Token": token.Value}, session, token)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Без токена и с неверным токеном запрос отклоняется
+	for _, headers := range []map[string]string{nil, {"X-CSRF-Token": "forged"}} {
+		response = csrfRequest(e, http.MethodPost, headers, session, token)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Contains(t, response.Body.String(), "CSRF_TOKEN_INVALID")
+	}
+
+	// Запрос без cookie подделать через браузер нельзя, он не проверяется
+	assert.Equal(t, http.StatusOK, csrfRequest(e, http.MethodPost, nil).Code)
+}
+
+func TestCSRFMiddlewareSkipsHeaderAuthentication(t *testing.T) {
+	e := newCSRFTestServer(true)
+	session := &http.Cookie{Name: "session", Value: "browser-session"}
+
+	// Запрос, прошедший аутентификацию по заголовку, не проверяется даже с cookie
+	response := csrfRequest(e, http.MethodPost, map[string]string{"X-Test-Token": "valid"}, session)
+	assert.Equal(t, http.StatusOK, response.Code)
+
+	// Неверные учетные данные в заголовке отклоняются аутентификацией, а не пропускают проверку
+	response = csrfRequest(e, http.MethodPost, map[string]string{"X-Test-Token": "forged"}, session)
+	assert.Equal(t, http.StatusUnauthorized, response.Code)
+
+	// Заголовок Authorization без аутентификации не отменяет проверку
+	e = newCSRFTestServer(false)
+	response = csrfRequest(e, http.MethodPost, map[string]string{HeaderAuthorization: "Bearer anything", HeaderAPIKey: "anything"}, session)
+	assert.Equal(t, http.StatusForbidden, response.Code)
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	e := echo.New()
+	NewSecurityHeadersMiddleware(config.SecurityHeaders{
+		Enabled:               true,
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		FrameOptions:          "deny",
+		ContentSecurityPolicy: "default-src 'none'",
+		ReferrerPolicy:        "no-referrer",
+	}).Apply(e)
+	e.GET("/health", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	request := httptest.NewRequest(http.MethodGet, "/health", nil)
+	response := httptest.NewRecorder()
+	e.ServeHTTP(response, request)
+	header := response.Header()
+	assert.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", header.Get("X-Frame-Options"))
+	assert.Equal(t, "default-src 'none'", header.Get("Content-Security-Policy"))
+	assert.Equal(t, "no-referrer", header.Get("Referrer-Policy"))
+	// HSTS отдается только по HTTPS
+	assert.Empty(t, header.Get("Strict-Transport-Security"))
+
+	request = httptest.NewRequest(http.MethodGet, "/health", nil)
+	request.Header.Set(echo.HeaderXForwardedProto, "https")
+	response = httptest.NewRecorder()
+	e.ServeHTTP(response, request)
+	assert.Equal(t, "max-age=31536000; includeSubdomains", response.Header().Get("Strict-Transport-Security"))
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	assert.Nil(t, NewCORSMiddleware(config.CORS{}))
+
+	e := echo.New()
+	e.Use(NewCORSMiddleware(config.CORS{AllowOrigins: []string{"https://dashboard.example.com"}, AllowCredentials: true}))
+	e.GET(APIPrefix+"/reports", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	preflight := func(origin string) http.Header {
+		request := httptest.NewRequest(http.MethodOptions, APIPrefix+"/reports", nil)
+		request.Header.Set(echo.HeaderOrigin, origin)
+		request.Header.Set(echo.HeaderAccessControlRequestMethod, http.MethodPost)
+		response := httptest.NewRecorder()
+		e.ServeHTTP(response, request)
+		return response.Header()
+	}
+
+	// Разрешенный источник получает заголовки CORS, чужой - нет
+	header := preflight("https://dashboard.example.com")
+	assert.Equal(t, "https://dashboard.example.com", header.Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "true", header.Get(echo.HeaderAccessControlAllowCredentials))
+
+	header = preflight("https://evil.example.com")
+	assert.Empty(t, header.Get(echo.HeaderAccessControlAllowOrigin))
+}
@@ -1,20 +1,32 @@
 package server
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"report_srv/internal/breaker"
 	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
 	"report_srv/internal/models"
+	"report_srv/internal/schema"
 	"report_srv/internal/service"
+	"report_srv/internal/storage"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 const (
@@ -26,6 +38,8 @@ const (
 	HeaderContentType   = "Content-Type"
 	HeaderAuthorization = "Authorization"
 	HeaderRequestID     = "X-Request-ID"
+	// HeaderChecksumSHA256 SHA-256 сохраненного файла отчета в hex
+	HeaderChecksumSHA256 = "X-Checksum-SHA256"
 
 	// Лимиты
 	DefaultPageSize = 20
@@ -34,6 +48,14 @@ const (
 	// Таймауты
 	DefaultRequestTimeout  = 30 * time.Second
 	DefaultShutdownTimeout = 10 * time.Second
+
+	// Интервал проверки статуса отчета в потоке событий. Проверка нужна,
+	// если отчет генерирует другой экземпляр сервиса, и как keep-alive
+	DefaultEventsPollInterval = 15 * time.Second
+
+	// Время жизни ссылок на скачивание
+	DefaultDownloadURLExpiration = 15 * time.Minute
+	MaxDownloadURLExpiration     = 24 * time.Hour
 )
 
 // HTTPServer интерфейс для HTTP сервера
@@ -92,37 +114,81 @@ type PaginationParams struct {
 	PageSize int `query:"page_size" validate:"min=1,max=100"`
 }
 
+// ReportFilterParams параметры фильтрации, поиска и сортировки списка отчетов.
+// Даты передаются в формате RFC 3339.
+type ReportFilterParams struct {
+	Status          string     `query:"status" validate:"omitempty,oneof=pending processing completed failed canceled expired"`
+	Format          string     `query:"format" validate:"omitempty,report_format"`
+	CreatedBy       string     `query:"created_by" validate:"max=255"`
+	Search          string     `query:"search" validate:"max=255"`
+	SearchMode      string     `query:"search_mode" validate:"omitempty,oneof=substring fulltext"`
+	CreatedAfter    *time.Time `query:"created_after"`
+	CreatedBefore   *time.Time `query:"created_before"`
+	GeneratedAfter  *time.Time `query:"generated_after"`
+	GeneratedBefore *time.Time `query:"generated_before"`
+	SortBy          string     `query:"sort_by" validate:"omitempty,oneof=created_at updated_at generated_at title status format"`
+	SortDesc        bool       `query:"sort_desc"`
+}
+
 // CreateReportRequest запрос на создание отчета
 type CreateReportRequest struct {
 	Title       string                 `json:"title" validate:"required,min=1,max=255"`
 	Description string                 `json:"description" validate:"max=1000"`
+	Type        string                 `json:"type" validate:"max=100"`
 	Parameters  map[string]interface{} `json:"parameters"`
+	Format      string                 `json:"format" validate:"omitempty,report_format"`
+	Priority    string                 `json:"priority" validate:"omitempty,oneof=low normal high critical"`
 	CreatedBy   string                 `json:"created_by" validate:"required,min=1,max=255"`
 }
 
+// UpdateReportRequest запрос на изменение отчета. Незаданные поля не меняются.
+type UpdateReportRequest struct {
+	Title       *string                `json:"title" validate:"omitempty,min=1,max=255"`
+	Description *string                `json:"description" validate:"omitempty,max=1000"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	// UpdatedBy автор изменения, при аутентификации - клиент запроса
+	UpdatedBy string `json:"updated_by" validate:"required,min=1,max=255"`
+}
+
+// UpdateReportStatusRequest запрос на смену статуса отчета
+type UpdateReportStatusRequest struct {
+	Status    string `json:"status" validate:"required,oneof=pending processing completed failed canceled expired"`
+	UpdatedBy string `json:"updated_by" validate:"required,min=1,max=255"`
+}
+
+// UpdateReportPriorityRequest запрос на смену приоритета отчета в очереди
+type UpdateReportPriorityRequest struct {
+	Priority  string `json:"priority" validate:"required,oneof=low normal high critical"`
+	UpdatedBy string `json:"updated_by" validate:"required,min=1,max=255"`
+}
+
 // Server реализация HTTP сервера
 type Server struct {
 	echo           *echo.Echo
 	config         config.Config
-	logger         *logrus.Logger
+	logger         logging.Logger
 	validator      *validator.Validate
 	responseWriter ResponseWriter
 	handlers       []Handler
 	middlewares    []Middleware
+	healthChecks   []HealthCheck
 }
 
 // ServerBuilder строитель для сервера
 type ServerBuilder struct {
 	config          config.Config
-	logger          *logrus.Logger
+	logger          logging.Logger
 	reportService   service.ReportService
 	handlers        []Handler
 	middlewares     []Middleware
+	authenticators  []Authenticator
+	healthChecks    []HealthCheck
+	settings        service.UserSettingsService
 	customValidator *validator.Validate
 }
 
 // NewServerBuilder создает новый строитель сервера
-func NewServerBuilder(cfg config.Config, logger *logrus.Logger) *ServerBuilder {
+func NewServerBuilder(cfg config.Config, logger logging.Logger) *ServerBuilder {
 	return &ServerBuilder{
 		config:      cfg,
 		logger:      logger,
@@ -138,6 +204,144 @@ func (b *ServerBuilder) WithReportService(service service.ReportService) *Server
 	return b
 }
 
+// WithScheduleService добавляет сервис расписаний
+func (b *ServerBuilder) WithScheduleService(service service.ScheduleService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewScheduleHandler(service, b.logger))
+	return b
+}
+
+// WithDefinitionService добавляет сервис определений отчетов
+func (b *ServerBuilder) WithDefinitionService(service service.DefinitionService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewDefinitionHandler(service, b.logger))
+	return b
+}
+
+// WithPreviewService добавляет предпросмотр отчетов
+func (b *ServerBuilder) WithPreviewService(service service.PreviewService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewPreviewHandler(service, b.logger))
+	return b
+}
+
+// WithQuotaService добавляет административное API лимитов пользователей
+func (b *ServerBuilder) WithQuotaService(service service.QuotaService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewQuotaHandler(service, b.logger))
+	return b
+}
+
+// WithStatsService добавляет статистику отчетов
+func (b *ServerBuilder) WithStatsService(service service.StatsService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewStatsHandler(service, b.logger))
+	return b
+}
+
+// WithUserSettingsService добавляет настройки пользователя по умолчанию
+func (b *ServerBuilder) WithUserSettingsService(service service.UserSettingsService) *ServerBuilder {
+	b.settings = service
+	b.handlers = append(b.handlers, NewUserSettingsHandler(service, b.logger))
+	return b
+}
+
+// WithNotificationService добавляет ленту уведомлений пользователя о его отчетах
+func (b *ServerBuilder) WithNotificationService(service service.NotificationService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewNotificationHandler(service, b.logger))
+	return b
+}
+
+// WithSLAService добавляет список текущих нарушений сроков SLA
+func (b *ServerBuilder) WithSLAService(service service.SLAService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewSLAHandler(service, b.logger))
+	return b
+}
+
+// WithLinks добавляет публичные ссылки на скачивание отчетов
+func (b *ServerBuilder) WithLinks(links service.LinkService, reports service.ReportService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewLinkHandler(links, reports, b.logger))
+	return b
+}
+
+// WithAttachments добавляет API приложенных к отчетам файлов
+func (b *ServerBuilder) WithAttachments(attachments service.AttachmentService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewAttachmentHandler(attachments, b.logger))
+	return b
+}
+
+// WithDatasets добавляет API загрузки файлов с данными для отчетов
+func (b *ServerBuilder) WithDatasets(datasets service.DatasetService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewDatasetHandler(datasets, b.logger))
+	return b
+}
+
+// WithDiff добавляет сравнение двух запусков отчета
+func (b *ServerBuilder) WithDiff(diff service.DiffService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewDiffHandler(diff, b.logger))
+	return b
+}
+
+// WithAPIKeys добавляет административное API ключей доступа и их проверку. Если аутентификация
+// включена в конфигурации, маршруты API требуют API ключ.
+func (b *ServerBuilder) WithAPIKeys(keys service.APIKeyService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewAPIKeyHandler(keys, b.logger))
+	b.authenticators = append(b.authenticators, NewAPIKeyAuthenticator(keys, b.config.Auth.AdminKey))
+	return b
+}
+
+// WithOIDC добавляет проверку токенов OpenID Connect, если задан issuer, и перенаправление
+// дашборда на вход у провайдера, если заданы client_id и redirect_url
+func (b *ServerBuilder) WithOIDC() *ServerBuilder {
+	cfg := b.config.Auth.OIDC
+	if cfg.Issuer == "" {
+		return b
+	}
+
+	authenticator := NewOIDCAuthenticator(cfg, b.logger)
+	b.authenticators = append(b.authenticators, authenticator)
+	if cfg.ClientID != "" && cfg.RedirectURL != "" {
+		b.handlers = append(b.handlers, NewOIDCLoginHandler(authenticator, b.logger))
+	}
+	return b
+}
+
+// WithClientCertificates добавляет аутентификацию внутренних сервисов по сертификату
+// клиента, если сервер проверяет сертификаты клиентов и для них заданы области доступа
+func (b *ServerBuilder) WithClientCertificates() *ServerBuilder {
+	cfg := b.config.Server.TLS
+	if !cfg.Enabled || cfg.ClientAuth == "none" || len(cfg.ClientScopes) == 0 {
+		return b
+	}
+	b.authenticators = append(b.authenticators, NewClientCertificateAuthenticator(cfg.ClientScopes))
+	return b
+}
+
+// WithTaskManager добавляет административное API очереди задач
+func (b *ServerBuilder) WithTaskManager(tasks service.TaskManager, reports service.ReportService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewTaskHandler(tasks, reports, b.logger))
+	return b
+}
+
+// WithAdminService добавляет административный дашборд и обслуживание очереди задач
+func (b *ServerBuilder) WithAdminService(admin service.AdminService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewAdminHandler(admin, b.logger))
+	return b
+}
+
+// WithGraphQL добавляет GraphQL API отчетов
+func (b *ServerBuilder) WithGraphQL(reports service.ReportService) *ServerBuilder {
+	b.handlers = append(b.handlers, NewGraphQLHandler(reports, b.logger))
+	return b
+}
+
+// WithFileStorage добавляет отдачу файлов хранилища по подписанным ссылкам
+func (b *ServerBuilder) WithFileStorage(fileStorage storage.Storage, signer *storage.URLSigner) *ServerBuilder {
+	b.handlers = append(b.handlers, NewFileHandler(fileStorage, signer, b.logger))
+	return b
+}
+
+// WithHealthChecks добавляет проверки зависимостей в readiness probe
+func (b *ServerBuilder) WithHealthChecks(checks ...HealthCheck) *ServerBuilder {
+	b.healthChecks = append(b.healthChecks, checks...)
+	return b
+}
+
 // WithHandler добавляет кастомный handler
 func (b *ServerBuilder) WithHandler(handler Handler) *ServerBuilder {
 	b.handlers = append(b.handlers, handler)
@@ -165,12 +369,19 @@ func (b *ServerBuilder) Build() HTTPServer {
 	// Создаем валидатор
 	v := b.customValidator
 	if v == nil {
-		v = validator.New()
+		v = newValidator()
 	}
 
 	// Создаем response writer
 	responseWriter := NewJSONResponseWriter(b.logger)
 
+	middlewares := b.middlewares
+	if b.config.Auth.Enabled && len(b.authenticators) > 0 {
+		middlewares = append(middlewares, NewAuthMiddleware(b.logger, b.authenticators...))
+	}
+	// Часовой пояс из настроек определяется для клиента запроса, поэтому после аутентификации
+	middlewares = append(middlewares, NewTimezoneMiddleware(b.settings))
+
 	server := &Server{
 		echo:           e,
 		config:         b.config,
@@ -178,7 +389,8 @@ func (b *ServerBuilder) Build() HTTPServer {
 		validator:      v,
 		responseWriter: responseWriter,
 		handlers:       b.handlers,
-		middlewares:    b.middlewares,
+		middlewares:    middlewares,
+		healthChecks:   b.healthChecks,
 	}
 
 	server.setupMiddleware()
@@ -190,11 +402,11 @@ func (b *ServerBuilder) Build() HTTPServer {
 
 // JSONResponseWriter реализация ResponseWriter для JSON ответов
 type JSONResponseWriter struct {
-	logger *logrus.Logger
+	logger logging.Logger
 }
 
 // NewJSONResponseWriter создает новый JSONResponseWriter
-func NewJSONResponseWriter(logger *logrus.Logger) ResponseWriter {
+func NewJSONResponseWriter(logger logging.Logger) ResponseWriter {
 	return &JSONResponseWriter{logger: logger}
 }
 
@@ -209,9 +421,37 @@ func (w *JSONResponseWriter) Success(c echo.Context, data interface{}) error {
 	return c.JSON(http.StatusOK, response)
 }
 
-// Error отправляет ответ с ошибкой
+// restoreRetryAfter через сколько клиенту повторить запрос файла, восстанавливаемого из архива
+const restoreRetryAfter = 15 * time.Minute
+
+// Error отправляет ответ с ошибкой. Статус выбирается по категории ошибки сервиса:
+// 400 для ошибок валидации, 404 - не найдено, 409 - конфликт состояния и неготовый
+// объект, 429 или 403 - исчерпанный лимит, 503 - недоступная БД или хранилище.
+// Ошибки без категории возвращаются как 500.
 func (w *JSONResponseWriter) Error(c echo.Context, err error) error {
-	w.logger.WithError(err).Error("API error occurred")
+	var quotaErr *service.QuotaExceededError
+	var openErr *breaker.OpenError
+	switch {
+	case errors.As(err, &quotaErr):
+		return quotaExceeded(c, quotaErr)
+	case errors.As(err, &openErr):
+		retryAfter := max(int(math.Ceil(openErr.RetryAfter.Seconds())), 1)
+		c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		return errorResponse(c, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", openErr.Error())
+	case isParameterValidationError(err):
+		return w.ValidationError(c, err)
+	case errors.Is(err, service.ErrNotFound):
+		return w.NotFound(c, err.Error())
+	case errors.Is(err, service.ErrConflict):
+		return errorResponse(c, http.StatusConflict, "CONFLICT", err.Error())
+	case errors.Is(err, service.ErrReportRestoring):
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(restoreRetryAfter.Seconds())))
+		return errorResponse(c, http.StatusConflict, "RESTORE_IN_PROGRESS", err.Error())
+	case errors.Is(err, service.ErrNotReady):
+		return errorResponse(c, http.StatusConflict, "NOT_READY", err.Error())
+	}
+
+	requestLogger(c, w.logger).WithError(err).Error("API error occurred")
 
 	response := &APIResponse{
 		Success: false,
@@ -236,6 +476,42 @@ func (w *JSONResponseWriter) ValidationError(c echo.Context, err error) error {
 		}
 	}
 
+	// Ошибки параметров по схеме типа отчета
+	var schemaErr *schema.ValidationError
+	if errors.As(err, &schemaErr) {
+		for _, fieldError := range schemaErr.Fields {
+			field := "parameters"
+			if fieldError.Field != "" {
+				field += "." + fieldError.Field
+			}
+			details[field] = fieldError.Message
+		}
+	}
+	if errors.Is(err, service.ErrUnknownReportType) {
+		details["type"] = "Неизвестный тип отчета"
+	}
+	if errors.Is(err, service.ErrTaskFinished) {
+		details["task"] = "Задача уже завершена"
+	}
+	if errors.Is(err, service.ErrInvalidSortField) {
+		details["sort_by"] = "Недопустимое поле сортировки"
+	}
+	if errors.Is(err, service.ErrTemplateRequired) {
+		details["format"] = "Формат доступен только для определений отчетов с шаблоном"
+	}
+	if errors.Is(err, service.ErrInvalidDefinition) {
+		details["definition"] = err.Error()
+	}
+	if errors.Is(err, service.ErrInvalidAPIKeyRequest) {
+		details["api_key"] = err.Error()
+	}
+	if errors.Is(err, service.ErrPreviewFailed) {
+		details["query"] = err.Error()
+	}
+	if errors.Is(err, service.ErrInvalidPreviewLimit) {
+		details["limit"] = err.Error()
+	}
+
 	response := &APIResponse{
 		Success: false,
 		Error: &APIError{
@@ -250,6 +526,19 @@ func (w *JSONResponseWriter) ValidationError(c echo.Context, err error) error {
 	return c.JSON(http.StatusBadRequest, response)
 }
 
+// errorResponse отправляет ответ с ошибкой и заданным статусом
+func errorResponse(c echo.Context, status int, code, message string) error {
+	return c.JSON(status, &APIResponse{
+		Success: false,
+		Error: &APIError{
+			Code:    code,
+			Message: message,
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
+}
+
 // NotFound отправляет ответ о том, что ресурс не найден
 func (w *JSONResponseWriter) NotFound(c echo.Context, message string) error {
 	response := &APIResponse{
@@ -268,18 +557,18 @@ func (w *JSONResponseWriter) NotFound(c echo.Context, message string) error {
 // ReportHandler обработчик для отчетов
 type ReportHandler struct {
 	service        service.ReportService
-	logger         *logrus.Logger
+	logger         logging.Logger
 	responseWriter ResponseWriter
 	validator      *validator.Validate
 }
 
 // NewReportHandler создает новый обработчик отчетов
-func NewReportHandler(service service.ReportService, logger *logrus.Logger) Handler {
+func NewReportHandler(service service.ReportService, logger logging.Logger) Handler {
 	return &ReportHandler{
 		service:        service,
 		logger:         logger,
 		responseWriter: NewJSONResponseWriter(logger),
-		validator:      validator.New(),
+		validator:      newValidator(),
 	}
 }
 
@@ -290,9 +579,17 @@ func (h *ReportHandler) Register(group *echo.Group) {
 		reports.POST("", h.createReport)
 		reports.GET("", h.listReports)
 		reports.GET("/:id", h.getReport)
+		reports.PATCH("/:id", h.updateReport)
 		reports.DELETE("/:id", h.deleteReport)
+		reports.POST("/:id/cancel", h.cancelReport)
+		reports.POST("/:id/render", h.renderReport)
 		reports.GET("/:id/download", h.downloadReport)
+		reports.GET("/:id/file", h.streamReportFile)
+		reports.GET("/:id/file/:format", h.streamReportArtifact)
+		reports.GET("/:id/download-url", h.getDownloadURL)
+		reports.GET("/:id/events", h.streamReportEvents)
 		reports.PUT("/:id/status", h.updateReportStatus)
+		reports.PUT("/:id/priority", h.updateReportPriority)
 	}
 }
 
@@ -300,13 +597,18 @@ func (h *ReportHandler) Register(group *echo.Group) {
 type HealthHandler struct {
 	responseWriter ResponseWriter
 	startTime      time.Time
+	checks         []HealthCheck
+	logger         logging.Logger
 }
 
-// NewHealthHandler создает новый health handler
-func NewHealthHandler() Handler {
+// NewHealthHandler создает новый health handler. Проверки зависимостей
+// выполняются в readiness probe.
+func NewHealthHandler(logger logging.Logger, checks ...HealthCheck) Handler {
 	return &HealthHandler{
-		responseWriter: NewJSONResponseWriter(logrus.New()),
+		responseWriter: NewJSONResponseWriter(logger),
 		startTime:      time.Now(),
+		checks:         checks,
+		logger:         logger,
 	}
 }
 
@@ -322,10 +624,25 @@ func (s *Server) GetEcho() *echo.Echo {
 	return s.echo
 }
 
-// Start запускает HTTP сервер
+// Start запускает HTTP сервер, а если включен server.tls - HTTPS сервер
 func (s *Server) Start(address string) error {
-	s.logger.WithField("address", address).Info("Запуск HTTP сервера")
-	return s.echo.Start(address)
+	tlsConfig, err := NewTLSConfig(s.config.Server.TLS)
+	if err != nil {
+		return fmt.Errorf("ошибка настройки TLS: %w", err)
+	}
+	if tlsConfig == nil {
+		s.logger.WithField("address", address).Info("Запуск HTTP сервера")
+		return s.echo.Start(address)
+	}
+
+	s.logger.WithFields(logging.Fields{
+		"address":     address,
+		"client_auth": s.config.Server.TLS.ClientAuth,
+		"autocert":    len(s.config.Server.TLS.Autocert.Hosts) > 0,
+	}).Info("Запуск HTTPS сервера")
+	s.echo.TLSServer.Addr = address
+	s.echo.TLSServer.TLSConfig = tlsConfig
+	return s.echo.StartServer(s.echo.TLSServer)
 }
 
 // Shutdown корректно останавливает сервер
@@ -336,39 +653,87 @@ func (s *Server) Shutdown(ctx context.Context) error {
 
 // setupMiddleware настраивает middleware
 func (s *Server) setupMiddleware() {
-	// Базовые middleware
+	// Базовые middleware (трассировка и журнал запросов до Recover, чтобы паника попала в спан и журнал)
 	s.echo.Use(middleware.RequestID())
+	s.echo.Use(requestIDContext)
+	NewTracingMiddleware().Apply(s.echo)
+	if s.config.Server.AccessLog.Enabled {
+		NewAccessLogMiddleware(s.config.Server.AccessLog, s.logger).Apply(s.echo)
+	}
 	s.echo.Use(middleware.Recover())
-	s.echo.Use(middleware.CORS())
+	if cors := NewCORSMiddleware(s.config.Server.CORS); cors != nil {
+		s.echo.Use(cors)
+	}
+
+	// Заголовки безопасности до аутентификации: они нужны и ответам с ошибкой
+	if s.config.Server.SecurityHeaders.Enabled {
+		NewSecurityHeadersMiddleware(s.config.Server.SecurityHeaders).Apply(s.echo)
+	}
 
-	// Логирование
-	if s.config.Server.Debug {
-		s.echo.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-			Format: "${time_rfc3339} ${method} ${uri} ${status} ${latency_human} ${error}\n",
+	// Сжатие JSON ответов, прежде всего списков
+	if s.config.Server.Compression.Enabled {
+		s.echo.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+			Level:     s.config.Server.Compression.Level,
+			MinLength: s.config.Server.Compression.MinLength,
+			Skipper:   skipCompression,
 		}))
 	}
 
 	// Таймаут для запросов
 	s.echo.Use(middleware.TimeoutWithConfig(middleware.TimeoutConfig{
 		Timeout: DefaultRequestTimeout,
+		Skipper: isStreamingRoute,
 	}))
 
-	// Rate limiting (базовый)
-	s.echo.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(100)))
+	// Кастомные middleware. Ограничение частоты запросов подключается вокруг них: корзина IP адреса
+	// до аутентификации, чтобы ограничить перебор учетных данных, корзина клиента - после
+	if s.config.Server.RateLimit.Enabled {
+		NewRateLimitMiddleware(s.config.Server.RateLimit, NewRateLimitStore(s.config), s.logger).
+			ApplyAround(s.echo, s.middlewares...)
+	} else {
+		for _, mw := range s.middlewares {
+			mw.Apply(s.echo)
+		}
+	}
 
-	// Кастомные middleware
-	for _, mw := range s.middlewares {
-		mw.Apply(s.echo)
+	// Защита браузерных сессий от CSRF после аутентификации: запросы, прошедшие
+	// аутентификацию по заголовкам, не проверяются
+	if s.config.Server.CSRF.Enabled {
+		NewCSRFMiddleware(s.config.Server.CSRF).Apply(s.echo)
 	}
 }
 
+// streamingRoutes маршруты, отдающие тело потоком. Timeout middleware
+// буферизует ответ целиком, поэтому для них он отключен.
+var streamingRoutes = map[string]bool{
+	APIPrefix + "/reports/:id/file":                       true,
+	APIPrefix + "/reports/:id/file/:format":               true,
+	APIPrefix + "/reports/:id/attachments/:attachment_id": true,
+	APIPrefix + "/reports/:id/events":                     true,
+	APIPrefix + FilesRoute:                                true,
+	APIPrefix + SharedRoute:                               true,
+}
+
+// isStreamingRoute проверяет, относится ли запрос к потоковым маршрутам
+func isStreamingRoute(c echo.Context) bool {
+	return streamingRoutes[c.Path()] || isGraphQLSubscription(c)
+}
+
+// skipCompression пропускает сжатие для запросов, кроме GET, и потоковых маршрутов: файлы
+// отчетов уже отдаются в своей кодировке, а события должны доходить до клиента сразу
+func skipCompression(c echo.Context) bool {
+	path := c.Path()
+	return c.Request().Method != http.MethodGet || isStreamingRoute(c) ||
+		path == "/health" || strings.HasPrefix(path, "/health/")
+}
+
 // setupRoutes настраивает маршруты
 func (s *Server) setupRoutes() {
 	// Группа API
 	api := s.echo.Group(APIPrefix)
 
 	// Health handler по умолчанию
-	healthHandler := NewHealthHandler()
+	healthHandler := NewHealthHandler(s.logger, s.healthChecks...)
 	healthHandler.Register(s.echo.Group(""))
 
 	// Регистрируем все handlers
@@ -384,12 +749,13 @@ func (s *Server) setupErrorHandler() {
 			return
 		}
 
+		// Ошибки сервисов, возвращенные обработчиком, сопоставляются со статусом по категории
 		he, ok := err.(*echo.HTTPError)
 		if !ok {
-			he = &echo.HTTPError{
-				Code:    http.StatusInternalServerError,
-				Message: "Внутренняя ошибка сервера",
+			if err := s.responseWriter.Error(c, err); err != nil {
+				requestLogger(c, s.logger).WithError(err).Error("Ошибка отправки HTTP error response")
 			}
+			return
 		}
 
 		response := &APIResponse{
@@ -403,7 +769,7 @@ func (s *Server) setupErrorHandler() {
 		}
 
 		if err := c.JSON(he.Code, response); err != nil {
-			s.logger.WithError(err).Error("Ошибка отправки HTTP error response")
+			requestLogger(c, s.logger).WithError(err).Error("Ошибка отправки HTTP error response")
 		}
 	}
 }
@@ -416,6 +782,9 @@ func (h *ReportHandler) createReport(c echo.Context) error {
 		return h.responseWriter.ValidationError(c, err)
 	}
 
+	// Клиент с API ключом может не указывать создателя отчета
+	req.CreatedBy = requestActor(c, req.CreatedBy)
+
 	if err := h.validator.Struct(&req); err != nil {
 		return h.responseWriter.ValidationError(c, err)
 	}
@@ -424,21 +793,36 @@ func (h *ReportHandler) createReport(c echo.Context) error {
 	report, err := models.NewReportBuilder().
 		WithTitle(req.Title).
 		WithDescription(req.Description).
+		WithType(req.Type).
 		WithCreatedBy(req.CreatedBy).
 		WithParameters(req.Parameters).
+		WithFormat(models.ReportFormat(req.Format)).
+		WithPriority(models.ReportPriority(req.Priority)).
 		Build()
 
 	if err != nil {
 		return h.responseWriter.ValidationError(c, err)
 	}
 
-	if err := h.service.CreateReport(c.Request().Context(), report); err != nil {
+	// force=true генерирует файл заново, даже если есть готовый отчет с теми же параметрами
+	ctx := c.Request().Context()
+	if value := c.QueryParam("force"); value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			return h.responseWriter.ValidationError(c, fmt.Errorf("неверное значение force"))
+		}
+		if force {
+			ctx = service.WithForceGeneration(ctx)
+		}
+	}
+
+	if err := h.service.CreateReport(ctx, report); err != nil {
 		return h.responseWriter.Error(c, err)
 	}
 
 	return c.JSON(http.StatusCreated, &APIResponse{
 		Success:   true,
-		Data:      report,
+		Data:      localizedReport(c, report),
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 		RequestID: getRequestID(c),
 	})
@@ -457,21 +841,54 @@ func (h *ReportHandler) listReports(c echo.Context) error {
 	if err := h.validator.Struct(&pagination); err != nil {
 		return h.responseWriter.ValidationError(c, err)
 	}
+	// Без page_size размер страницы берется из настроек пользователя
+	if c.QueryParam("page_size") == "" {
+		pagination.PageSize = 0
+	}
+
+	var filter ReportFilterParams
+	if err := c.Bind(&filter); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&filter); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
 
 	// Создаем параметры для ListReports
 	params := service.ListReportParams{
-		Page:     pagination.Page,
-		PageSize: pagination.PageSize,
+		Page:            pagination.Page,
+		PageSize:        pagination.PageSize,
+		CreatedBy:       filter.CreatedBy,
+		Search:          strings.TrimSpace(filter.Search),
+		SearchMode:      service.SearchMode(filter.SearchMode),
+		CreatedAfter:    filter.CreatedAfter,
+		CreatedBefore:   filter.CreatedBefore,
+		GeneratedAfter:  filter.GeneratedAfter,
+		GeneratedBefore: filter.GeneratedBefore,
+		SortBy:          filter.SortBy,
+		SortDesc:        filter.SortDesc,
+	}
+	if filter.Status != "" {
+		status := models.ReportStatus(filter.Status)
+		params.Status = &status
+	}
+	if filter.Format != "" {
+		format := models.ReportFormat(filter.Format)
+		params.Format = &format
 	}
 
 	reportList, err := h.service.ListReports(c.Request().Context(), params)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidSortField) {
+			return h.responseWriter.ValidationError(c, err)
+		}
 		return h.responseWriter.Error(c, err)
 	}
 
 	response := &APIResponse{
 		Success: true,
-		Data:    reportList.Reports,
+		Data:    localizedReportList(c, reportList.Reports),
 		Meta: &APIMeta{
 			Page:       reportList.Page,
 			PageSize:   reportList.PageSize,
@@ -497,7 +914,16 @@ func (h *ReportHandler) getReport(c echo.Context) error {
 		return h.responseWriter.NotFound(c, "Отчет не найден")
 	}
 
-	return h.responseWriter.Success(c, report)
+	// Клиент, опрашивающий статус отчета, получает 304, пока отчет не изменился
+	etag, err := jsonETag(report)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	if notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return h.responseWriter.Success(c, localizedReport(c, report))
 }
 
 // deleteReport удаляет отчет
@@ -523,13 +949,310 @@ func (h *ReportHandler) downloadReport(c echo.Context) error {
 		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
 	}
 
-	report, err := h.service.GetReport(c.Request().Context(), id)
+	report, err := readyReport(c, h.service, h.responseWriter, id)
+	if report == nil {
+		return err
+	}
+
+	downloadInfo := map[string]interface{}{
+		"download_url": fmt.Sprintf("%s/reports/%d/file", APIPrefix, report.ID),
+		"filename":     report.Title + "." + report.Format.String(),
+		"status":       "ready",
+	}
+
+	return h.responseWriter.Success(c, downloadInfo)
+}
+
+// streamReportFile отдает файл отчета потоком, не загружая его целиком в память
+func (h *ReportHandler) streamReportFile(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	report, err := readyReport(c, h.service, h.responseWriter, id)
+	if report == nil {
+		return err
+	}
+
+	// Неизменившийся файл не открывается в хранилище
+	etag := reportFileETag(c, report)
+	if notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	// Прерванное скачивание продолжается запросом с заголовком Range
+	part, err := reportFileRange(c, report, etag)
+	if err != nil {
+		return rangeNotSatisfiable(c, report.FileSize)
+	}
+	if part != nil {
+		file, err := h.service.GetReportFileRange(c.Request().Context(), id, part.offset, part.length)
+		if err != nil {
+			return h.responseWriter.Error(c, err)
+		}
+		defer file.Reader.Close()
+
+		c.Response().Header().Set(HeaderContentRange, part.contentRange(report.FileSize))
+		return sendReportFile(c, h.responseWriter, report, file, http.StatusPartialContent)
+	}
+
+	file, err := h.service.GetReportFile(c.Request().Context(), id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	defer file.Reader.Close()
+
+	return sendReportFile(c, h.responseWriter, report, file, http.StatusOK)
+}
+
+// streamReportArtifact отдает потоком файл одного формата из архива отчета формата zip
+func (h *ReportHandler) streamReportArtifact(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	report, err := readyReport(c, h.service, h.responseWriter, id)
+	if report == nil {
+		return err
+	}
+
+	format := models.ReportFormat(strings.ToLower(c.Param("format")))
+	if notModified(c, reportArtifactETag(report, format)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	file, err := h.service.GetReportArtifact(c.Request().Context(), id, format)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	defer file.Reader.Close()
+
+	return sendReportFile(c, h.responseWriter, report, file, http.StatusOK)
+}
+
+// sendReportFile отдает открытый файл отчета или его часть потоком со статусом status
+func sendReportFile(c echo.Context, responseWriter ResponseWriter, report *models.Report, file *service.ReportFile, status int) error {
+	// HTML отчет открывается в браузере, скрипты и внешние ресурсы в нем запрещены
+	header := c.Response().Header()
+	disposition := "attachment"
+	if report.Format == models.FormatHTML {
+		disposition = "inline"
+		header.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:")
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+		"filename": file.Filename,
+	}))
+	if file.Checksum != "" {
+		header.Set(HeaderChecksumSHA256, file.Checksum)
+	}
+
+	reader, err := encodeResponse(c, file.Reader, file.ContentEncoding, file.Size)
+	if err != nil {
+		return responseWriter.Error(c, err)
+	}
+	return c.Stream(status, file.ContentType, reader)
+}
+
+// encodeResponse задает заголовки размера и кодировки файла. Сжатый gzip файл отдается
+// с Content-Encoding, а клиенту, который не принимает gzip, распаковывается на лету.
+func encodeResponse(c echo.Context, reader io.Reader, encoding string, size int64) (io.Reader, error) {
+	header := c.Response().Header()
+	if encoding != "" {
+		addVary(header, echo.HeaderAcceptEncoding)
+		if !acceptsEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding), encoding) {
+			// Контрольная сумма относится к сжатому файлу
+			header.Del(HeaderChecksumSHA256)
+			// Размер распакованного файла заранее неизвестен
+			decoded, err := gzip.NewReader(reader)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка распаковки файла: %w", err)
+			}
+			return decoded, nil
+		}
+		header.Set(echo.HeaderContentEncoding, encoding)
+	}
+
+	if size >= 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(size, 10))
+	}
+	return reader, nil
+}
+
+// acceptsEncoding проверяет, принимает ли клиент кодировку по заголовку Accept-Encoding
+func acceptsEncoding(accept, encoding string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, encoding) && name != "*" {
+			continue
+		}
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// getDownloadURL возвращает временную ссылку для скачивания отчета напрямую из хранилища
+func (h *ReportHandler) getDownloadURL(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	expiration := DefaultDownloadURLExpiration
+	if value := c.QueryParam("expires_in"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > MaxDownloadURLExpiration {
+			return h.responseWriter.ValidationError(c, fmt.Errorf("неверное время жизни ссылки"))
+		}
+		expiration = time.Duration(seconds) * time.Second
+	}
+
+	if report, err := readyReport(c, h.service, h.responseWriter, id); report == nil {
+		return err
+	}
+
+	downloadURL, err := h.service.GetReportDownloadURL(c.Request().Context(), id, expiration)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, downloadURL)
+}
+
+// streamReportEvents отправляет смены статуса отчета через Server-Sent Events.
+// Поток закрывается после перехода отчета в финальный статус.
+func (h *ReportHandler) streamReportEvents(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	ctx := c.Request().Context()
+
+	// Подписываемся до чтения отчета, чтобы не пропустить смену статуса между ними
+	updates, err := h.service.SubscribeStatus(ctx, id)
+	if err != nil {
+		return h.responseWriter.NotFound(c, "Отчет не найден")
+	}
+
+	report, err := h.service.GetReport(ctx, id)
 	if err != nil {
 		return h.responseWriter.NotFound(c, "Отчет не найден")
 	}
 
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+
+	last := snapshotEvent(report)
+	if err := writeStatusEvent(response, last); err != nil || last.Status.IsFinal() {
+		return err
+	}
+
+	ticker := time.NewTicker(DefaultEventsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if event.Type == events.ReportDeleted {
+				writeStatusEvent(response, event)
+				return nil
+			}
+			if event.Status == last.Status {
+				continue
+			}
+			last = event
+
+		case <-ticker.C:
+			report, err := h.service.GetReport(ctx, id)
+			if err != nil {
+				return nil
+			}
+			if report.Status == last.Status {
+				if _, err := fmt.Fprint(response, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+				response.Flush()
+				continue
+			}
+			last = snapshotEvent(report)
+		}
+
+		if err := writeStatusEvent(response, last); err != nil || last.Status.IsFinal() {
+			return nil
+		}
+	}
+}
+
+// snapshotEvent формирует событие из текущего состояния отчета
+func snapshotEvent(report *models.Report) events.Event {
+	eventType, ok := events.TypeForStatus(report.Status)
+	if !ok {
+		eventType = events.ReportCreated
+	}
+
+	return events.Event{
+		Type:      eventType,
+		ReportID:  report.ID,
+		Status:    report.Status,
+		FileKey:   report.FileKey,
+		ErrorCode: report.ErrorCode,
+		Timestamp: report.UpdatedAt,
+	}
+}
+
+// writeStatusEvent записывает событие отчета в формате SSE
+func writeStatusEvent(response *echo.Response, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(response, "event: status\ndata: %s\n\n", data); err != nil {
+		return err
+	}
+	response.Flush()
+	return nil
+}
+
+// readyReport возвращает отчет, готовый к скачиванию. Если отчет не найден
+// или еще не готов, ответ клиенту уже отправлен и возвращается nil.
+func readyReport(c echo.Context, reports service.ReportService, responseWriter ResponseWriter, id uint) (*models.Report, error) {
+	report, err := reports.GetReport(c.Request().Context(), id)
+	if err != nil {
+		return nil, responseWriter.NotFound(c, "Отчет не найден")
+	}
+
+	if report.IsExpired() {
+		return nil, c.JSON(http.StatusGone, &APIResponse{
+			Success: false,
+			Error: &APIError{
+				Code:    "REPORT_EXPIRED",
+				Message: "Срок хранения отчета истек, файл удален",
+			},
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			RequestID: getRequestID(c),
+		})
+	}
+
 	if !report.IsCompleted() {
-		return c.JSON(http.StatusBadRequest, &APIResponse{
+		return nil, c.JSON(http.StatusBadRequest, &APIResponse{
 			Success: false,
 			Error: &APIError{
 				Code:    "REPORT_NOT_READY",
@@ -541,17 +1264,10 @@ func (h *ReportHandler) downloadReport(c echo.Context) error {
 	}
 
 	if !report.HasFile() {
-		return h.responseWriter.NotFound(c, "Файл отчета не найден")
+		return nil, responseWriter.NotFound(c, "Файл отчета не найден")
 	}
 
-	downloadInfo := map[string]interface{}{
-		"download_url": "/files/" + report.FileKey,
-		"filename":     report.Title + ".xlsx",
-		"status":       "ready",
-		"file_size":    "unknown", // В реальном приложении получили бы размер файла
-	}
-
-	return h.responseWriter.Success(c, downloadInfo)
+	return report, nil
 }
 
 // updateReportStatus обновляет статус отчета
@@ -561,32 +1277,139 @@ func (h *ReportHandler) updateReportStatus(c echo.Context) error {
 		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
 	}
 
-	var req struct {
-		Status    string `json:"status" validate:"required"`
-		UpdatedBy string `json:"updated_by" validate:"required"`
+	var req UpdateReportStatusRequest
+
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	req.UpdatedBy = requestActor(c, req.UpdatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
 	}
 
+	status := models.ReportStatus(req.Status)
+	return h.applyUpdate(c, id, service.ReportUpdateParams{
+		Status:    &status,
+		UpdatedBy: req.UpdatedBy,
+	})
+}
+
+// updateReportPriority меняет приоритет отчета, ожидающего генерации
+func (h *ReportHandler) updateReportPriority(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	var req UpdateReportPriorityRequest
+
 	if err := c.Bind(&req); err != nil {
 		return h.responseWriter.ValidationError(c, err)
 	}
 
+	req.UpdatedBy = requestActor(c, req.UpdatedBy)
+
 	if err := h.validator.Struct(&req); err != nil {
 		return h.responseWriter.ValidationError(c, err)
 	}
 
-	report, err := h.service.GetReport(c.Request().Context(), id)
+	report, err := h.service.SetReportPriority(c.Request().Context(), id, models.ReportPriority(req.Priority), req.UpdatedBy)
 	if err != nil {
-		return h.responseWriter.NotFound(c, "Отчет не найден")
+		return h.responseWriter.Error(c, err)
 	}
 
-	status := models.ReportStatus(req.Status)
-	if err := report.SetStatus(status, req.UpdatedBy); err != nil {
+	return h.responseWriter.Success(c, localizedReport(c, report))
+}
+
+// updateReport изменяет название, описание или параметры отчета
+func (h *ReportHandler) updateReport(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	var req UpdateReportRequest
+
+	if err := c.Bind(&req); err != nil {
 		return h.responseWriter.ValidationError(c, err)
 	}
 
-	// В реальном приложении здесь был бы вызов service.UpdateReport
+	req.UpdatedBy = requestActor(c, req.UpdatedBy)
+
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	params := service.ReportUpdateParams{
+		Title:       req.Title,
+		Description: req.Description,
+		UpdatedBy:   req.UpdatedBy,
+	}
+	if req.Parameters != nil {
+		parameters := models.JSON(req.Parameters)
+		params.Parameters = &parameters
+	}
+	return h.applyUpdate(c, id, params)
+}
+
+// applyUpdate изменяет отчет через сервис и возвращает его новое состояние
+func (h *ReportHandler) applyUpdate(c echo.Context, id uint, params service.ReportUpdateParams) error {
+	ctx := c.Request().Context()
+	if err := h.service.UpdateReport(ctx, id, params); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	report, err := h.service.GetReport(ctx, id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	return h.responseWriter.Success(c, localizedReport(c, report))
+}
+
+// cancelReport отменяет отчет в очереди или в генерации
+func (h *ReportHandler) cancelReport(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+
+	ctx := c.Request().Context()
+	if err := h.service.CancelReportGeneration(ctx, id); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	report, err := h.service.GetReport(ctx, id)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+	return h.responseWriter.Success(c, localizedReport(c, report))
+}
+
+// renderReport перестраивает готовый отчет в формат из параметра format по снимку данных.
+// Файл скачивается через /reports/:id/file/:format.
+func (h *ReportHandler) renderReport(c echo.Context) error {
+	id, err := parseUintParam(c, "id")
+	if err != nil {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("неверный ID отчета"))
+	}
+	format := models.ReportFormat(strings.ToLower(strings.TrimSpace(c.QueryParam("format"))))
+	if format == "" {
+		return h.responseWriter.ValidationError(c, fmt.Errorf("не указан формат"))
+	}
+
+	rendition, err := h.service.RenderReport(c.Request().Context(), id, format)
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
 
-	return h.responseWriter.Success(c, report)
+	return c.JSON(http.StatusCreated, &APIResponse{
+		Success:   true,
+		Data:      rendition,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
+	})
 }
 
 // healthCheck обработчик health check
@@ -602,11 +1425,29 @@ func (h *HealthHandler) healthCheck(c echo.Context) error {
 	return h.responseWriter.Success(c, data)
 }
 
-// readinessCheck проверка готовности сервиса
+// readinessCheck проверка готовности сервиса: 503, если недоступна критичная зависимость
 func (h *HealthHandler) readinessCheck(c echo.Context) error {
-	// Здесь можно добавить проверки готовности (БД, внешние сервисы)
-	return h.responseWriter.Success(c, map[string]string{
-		"status": "ready",
+	checks, ready := runHealthChecks(c.Request().Context(), h.checks)
+	if ready {
+		return h.responseWriter.Success(c, map[string]interface{}{
+			"status": "ready",
+			"checks": checks,
+		})
+	}
+
+	h.logger.WithField("checks", checks).Warn("Сервис не готов: недоступны зависимости")
+	return c.JSON(http.StatusServiceUnavailable, &APIResponse{
+		Success: false,
+		Data: map[string]interface{}{
+			"status": "not_ready",
+			"checks": checks,
+		},
+		Error: &APIError{
+			Code:    "NOT_READY",
+			Message: "Недоступны зависимости сервиса",
+		},
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		RequestID: getRequestID(c),
 	})
 }
 
@@ -624,6 +1465,23 @@ func getRequestID(c echo.Context) string {
 	return c.Response().Header().Get(echo.HeaderXRequestID)
 }
 
+// requestLogger возвращает логгер с ID запроса и трассы из контекста запроса
+func requestLogger(c echo.Context, logger logging.Logger) logging.Logger {
+	return logging.FromContext(c.Request().Context(), logger)
+}
+
+// requestIDContext передает Request ID в контекст запроса, чтобы логи сервисов,
+// репозиториев и хранилища содержали его в поле request_id
+func requestIDContext(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if requestID := getRequestID(c); requestID != "" {
+			request := c.Request()
+			c.SetRequest(request.WithContext(logging.ContextWithRequestID(request.Context(), requestID)))
+		}
+		return next(c)
+	}
+}
+
 // parseUintParam парсит uint параметр из URL
 func parseUintParam(c echo.Context, paramName string) (uint, error) {
 	idStr := c.Param(paramName)
@@ -634,6 +1492,23 @@ func parseUintParam(c echo.Context, paramName string) (uint, error) {
 	return uint(id), nil
 }
 
+// isParameterValidationError проверяет, отклонен ли запрос при проверке: параметры
+// не соответствуют схеме типа отчета или сервис вернул ошибку категории ErrValidation
+func isParameterValidationError(err error) bool {
+	var schemaErr *schema.ValidationError
+	return errors.As(err, &schemaErr) || errors.Is(err, service.ErrValidation)
+}
+
+// newValidator создает валидатор запросов с проверкой формата отчета report_format:
+// допустимы встроенные форматы и форматы зарегистрированных генераторов
+func newValidator() *validator.Validate {
+	v := validator.New()
+	_ = v.RegisterValidation("report_format", func(field validator.FieldLevel) bool {
+		return models.ReportFormat(field.Field().String()).IsValid()
+	})
+	return v
+}
+
 // getValidationMessage возвращает человекочитаемое сообщение об ошибке валидации
 func getValidationMessage(fieldError validator.FieldError) string {
 	switch fieldError.Tag() {
@@ -645,14 +1520,75 @@ func getValidationMessage(fieldError validator.FieldError) string {
 		return fmt.Sprintf("Максимальная длина: %s", fieldError.Param())
 	case "email":
 		return "Неверный формат email"
+	case "oneof":
+		return fmt.Sprintf("Допустимые значения: %s", fieldError.Param())
+	case "report_format":
+		return "Неподдерживаемый формат отчета"
+	case "ne":
+		return fmt.Sprintf("Недопустимое значение: %s", fieldError.Param())
 	default:
 		return "Неверное значение поля"
 	}
 }
 
 // NewServer создает новый HTTP сервер (обратная совместимость)
-func NewServer(cfg config.Config, reportService service.ReportService, logger *logrus.Logger) HTTPServer {
-	return NewServerBuilder(cfg, logger).
+func NewServer(
+	cfg config.Config,
+	reportService service.ReportService,
+	scheduleService service.ScheduleService,
+	definitionService service.DefinitionService,
+	previewService service.PreviewService,
+	quotaService service.QuotaService,
+	statsService service.StatsService,
+	slaService service.SLAService,
+	notifications service.NotificationService,
+	settings service.UserSettingsService,
+	apiKeys service.APIKeyService,
+	links service.LinkService,
+	attachments service.AttachmentService,
+	datasets service.DatasetService,
+	diff service.DiffService,
+	admin service.AdminService,
+	processor service.BackgroundProcessor,
+	fileStorage storage.Storage,
+	signer *storage.URLSigner,
+	db *gorm.DB,
+	replica service.ReadReplica,
+	logger logging.Logger,
+) HTTPServer {
+	builder := NewServerBuilder(cfg, logger).
 		WithReportService(reportService).
-		Build()
+		WithScheduleService(scheduleService).
+		WithDefinitionService(definitionService).
+		WithPreviewService(previewService).
+		WithQuotaService(quotaService).
+		WithStatsService(statsService).
+		WithSLAService(slaService).
+		WithNotificationService(notifications).
+		WithUserSettingsService(settings).
+		WithLinks(links, reportService).
+		WithAttachments(attachments).
+		WithDatasets(datasets).
+		WithDiff(diff).
+		WithAdminService(admin).
+		WithAPIKeys(apiKeys).
+		WithOIDC().
+		WithClientCertificates().
+		WithGraphQL(reportService).
+		WithFileStorage(fileStorage, signer).
+		WithHealthChecks(
+			DatabaseHealthCheck(db),
+			StorageHealthCheck(fileStorage),
+			ProcessorHealthCheck(processor),
+		)
+
+	if replica != nil && replica.DB() != db {
+		builder.WithHealthChecks(ReplicaHealthCheck(replica.DB()))
+	}
+
+	if tasks, ok := processor.(service.TaskManager); ok {
+		builder.WithTaskManager(tasks, reportService)
+	}
+
+	return builder.Build()
 }
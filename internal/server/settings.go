@@ -0,0 +1,98 @@
+package server
+
+import (
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// UpdateUserSettingsRequest запрос на изменение настроек пользователя. Незаданные поля
+// не меняются, пустая строка сбрасывает формат, локаль или часовой пояс
+type UpdateUserSettingsRequest struct {
+	DefaultFormat   *string `json:"default_format" validate:"omitempty,report_format"`
+	Locale          *string `json:"locale" validate:"omitempty,max=35"`
+	Timezone        *string `json:"timezone" validate:"omitempty,max=64"`
+	NotifyCompleted *bool   `json:"notify_completed"`
+	NotifyFailed    *bool   `json:"notify_failed"`
+	PageSize        *int    `json:"page_size" validate:"omitempty,min=0,max=100"`
+}
+
+// UserSettingsHandler обработчик настроек пользователя по умолчанию
+type UserSettingsHandler struct {
+	service        service.UserSettingsService
+	logger         logging.Logger
+	validator      *validator.Validate
+	responseWriter ResponseWriter
+}
+
+// NewUserSettingsHandler создает новый обработчик настроек пользователя
+func NewUserSettingsHandler(service service.UserSettingsService, logger logging.Logger) Handler {
+	return &UserSettingsHandler{
+		service:        service,
+		logger:         logger,
+		validator:      newValidator(),
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршруты настроек пользователя. Пользователь берется из аутентификации,
+// без нее - из параметра user
+func (h *UserSettingsHandler) Register(group *echo.Group) {
+	group.GET("/settings", h.getSettings)
+	group.PUT("/settings", h.updateSettings)
+	group.DELETE("/settings", h.resetSettings)
+}
+
+// getSettings возвращает настройки пользователя
+func (h *UserSettingsHandler) getSettings(c echo.Context) error {
+	settings, err := h.service.GetSettings(c.Request().Context(), requestActor(c, c.QueryParam("user")))
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, settings)
+}
+
+// updateSettings меняет заданные настройки пользователя
+func (h *UserSettingsHandler) updateSettings(c echo.Context) error {
+	var req UpdateUserSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+	if err := h.validator.Struct(&req); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	params := service.UserSettingsUpdateParams{
+		Locale:          req.Locale,
+		Timezone:        req.Timezone,
+		NotifyCompleted: req.NotifyCompleted,
+		NotifyFailed:    req.NotifyFailed,
+		PageSize:        req.PageSize,
+	}
+	if req.DefaultFormat != nil {
+		format := models.ReportFormat(*req.DefaultFormat)
+		params.DefaultFormat = &format
+	}
+
+	settings, err := h.service.UpdateSettings(c.Request().Context(), requestActor(c, c.QueryParam("user")), params)
+	if err != nil {
+		requestLogger(c, h.logger).WithError(err).Warn("Ошибка изменения настроек пользователя")
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, settings)
+}
+
+// resetSettings сбрасывает настройки пользователя к значениям по умолчанию
+func (h *UserSettingsHandler) resetSettings(c echo.Context) error {
+	subject := requestActor(c, c.QueryParam("user"))
+	if err := h.service.ResetSettings(c.Request().Context(), subject); err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, models.DefaultUserSettings(subject))
+}
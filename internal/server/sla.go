@@ -0,0 +1,40 @@
+package server
+
+import (
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SLAHandler обработчик текущих нарушений сроков SLA для мониторинга
+type SLAHandler struct {
+	service        service.SLAService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+}
+
+// NewSLAHandler создает новый обработчик нарушений SLA
+func NewSLAHandler(service service.SLAService, logger logging.Logger) Handler {
+	return &SLAHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршрут нарушений SLA
+func (h *SLAHandler) Register(group *echo.Group) {
+	group.GET("/sla/breaches", h.listBreaches)
+}
+
+// listBreaches возвращает отчеты в очереди и в генерации, нарушившие сроки SLA
+func (h *SLAHandler) listBreaches(c echo.Context) error {
+	breaches, err := h.service.ListBreaches(c.Request().Context())
+	if err != nil {
+		requestLogger(c, h.logger).WithError(err).Error("Ошибка получения нарушений SLA")
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, breaches)
+}
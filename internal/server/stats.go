@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// StatsHandler обработчик статистики отчетов для мониторинга
+type StatsHandler struct {
+	service        service.StatsService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+}
+
+// NewStatsHandler создает новый обработчик статистики
+func NewStatsHandler(service service.StatsService, logger logging.Logger) Handler {
+	return &StatsHandler{
+		service:        service,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+	}
+}
+
+// Register регистрирует маршрут статистики
+func (h *StatsHandler) Register(group *echo.Group) {
+	group.GET("/stats", h.getStats)
+}
+
+// getStats возвращает статистику отчетов
+func (h *StatsHandler) getStats(c echo.Context) error {
+	top := 0
+	if value := c.QueryParam("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > service.MaxStatsTopCreators {
+			return h.responseWriter.ValidationError(c,
+				fmt.Errorf("параметр top должен быть числом от 1 до %d", service.MaxStatsTopCreators))
+		}
+		top = parsed
+	}
+
+	stats, err := h.service.GetStats(c.Request().Context(), top)
+	if err != nil {
+		requestLogger(c, h.logger).WithError(err).Error("Ошибка получения статистики отчетов")
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, stats)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/service"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+)
+
+// TaskListParams параметры списка задач процессора
+type TaskListParams struct {
+	Status string `query:"status" validate:"omitempty,oneof=pending running completed failed canceled"`
+	Limit  int    `query:"limit" validate:"min=0,max=1000"`
+}
+
+// TaskHandler обработчик административного API очереди задач
+type TaskHandler struct {
+	tasks          service.TaskManager
+	reports        service.ReportService
+	logger         logging.Logger
+	responseWriter ResponseWriter
+	validator      *validator.Validate
+}
+
+// NewTaskHandler создает новый обработчик очереди задач
+func NewTaskHandler(tasks service.TaskManager, reports service.ReportService, logger logging.Logger) Handler {
+	return &TaskHandler{
+		tasks:          tasks,
+		reports:        reports,
+		logger:         logger,
+		responseWriter: NewJSONResponseWriter(logger),
+		validator:      newValidator(),
+	}
+}
+
+// Register регистрирует маршруты очереди задач
+func (h *TaskHandler) Register(group *echo.Group) {
+	tasks := group.Group("/admin/tasks")
+	{
+		tasks.GET("", h.listTasks)
+		tasks.GET("/:id", h.getTask)
+		tasks.DELETE("/:id", h.cancelTask)
+	}
+}
+
+// listTasks возвращает задачи процессора от новых к старым
+func (h *TaskHandler) listTasks(c echo.Context) error {
+	var params TaskListParams
+
+	if err := c.Bind(&params); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	if err := h.validator.Struct(&params); err != nil {
+		return h.responseWriter.ValidationError(c, err)
+	}
+
+	tasks, err := h.tasks.ListTasks(c.Request().Context(), service.TaskFilter{
+		Status: service.TaskStatus(params.Status),
+		Limit:  params.Limit,
+	})
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, tasks)
+}
+
+// getTask возвращает сведения о задаче
+func (h *TaskHandler) getTask(c echo.Context) error {
+	task, err := h.tasks.GetTask(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrTaskNotFound) {
+			return h.responseWriter.NotFound(c, "Задача не найдена")
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	return h.responseWriter.Success(c, task)
+}
+
+// cancelTask отменяет задачу. Генерация отчета отменяется через сервис отчетов,
+// чтобы отчет перешел в статус canceled.
+func (h *TaskHandler) cancelTask(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	task, err := h.tasks.GetTask(ctx, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrTaskNotFound) {
+			return h.responseWriter.NotFound(c, "Задача не найдена")
+		}
+		return h.responseWriter.Error(c, err)
+	}
+
+	if task.Status.IsFinished() {
+		return h.responseWriter.Error(c, service.ErrTaskFinished)
+	}
+
+	if task.ReportID != 0 {
+		err = h.reports.CancelReportGeneration(ctx, task.ReportID)
+	} else {
+		err = h.tasks.CancelTask(task.ID)
+	}
+	if err != nil {
+		return h.responseWriter.Error(c, err)
+	}
+
+	requestLogger(c, h.logger).WithField("task_id", task.ID).Info("Задача отменена через административный API")
+
+	return h.responseWriter.Success(c, map[string]string{
+		"message": "Задача отменена",
+	})
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"report_srv/internal/models"
+	"report_srv/internal/service"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderTimezone заголовок с часовым поясом IANA, в котором возвращается время отчетов
+const HeaderTimezone = "X-Timezone"
+
+// timezoneContextKey ключ часового пояса запроса в контексте echo
+const timezoneContextKey = "timezone"
+
+// TimezoneMiddleware определяет часовой пояс, в котором время отчетов возвращается в ответах:
+// заголовок X-Timezone, параметр timezone или часовой пояс из настроек пользователя
+type TimezoneMiddleware struct {
+	settings service.UserSettingsService
+}
+
+// NewTimezoneMiddleware создает middleware часового пояса запроса. settings может быть nil,
+// тогда часовой пояс задается только заголовком или параметром
+func NewTimezoneMiddleware(settings service.UserSettingsService) Middleware {
+	return &TimezoneMiddleware{settings: settings}
+}
+
+// Apply подключает middleware к Echo. Подключается после аутентификации: настройки
+// берутся для клиента запроса
+func (m *TimezoneMiddleware) Apply(e *echo.Echo) {
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			name := c.Request().Header.Get(HeaderTimezone)
+			if name == "" {
+				name = c.QueryParam("timezone")
+			}
+			if name != "" {
+				location, err := models.LoadTimezone(name)
+				if err != nil {
+					return errorResponse(c, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+				}
+				c.Set(timezoneContextKey, location)
+				return next(c)
+			}
+
+			// Настройки читаются, только если ответ содержит время отчетов
+			if principal := PrincipalFromContext(c); principal != nil && m.settings != nil {
+				c.Set(timezoneContextKey, func() *time.Location {
+					settings, err := m.settings.GetSettings(c.Request().Context(), principal.Subject)
+					if err != nil || settings.Timezone == "" {
+						return nil
+					}
+					location, _ := models.LoadTimezone(settings.Timezone)
+					return location
+				})
+			}
+			return next(c)
+		}
+	})
+}
+
+// requestLocation возвращает часовой пояс запроса, nil - время возвращается как хранится, в UTC
+func requestLocation(c echo.Context) *time.Location {
+	switch value := c.Get(timezoneContextKey).(type) {
+	case *time.Location:
+		return value
+	case func() *time.Location:
+		location := value()
+		c.Set(timezoneContextKey, location)
+		return location
+	}
+	return nil
+}
+
+// localizedReport возвращает копию отчета со временем в часовом поясе запроса
+func localizedReport(c echo.Context, report *models.Report) *models.Report {
+	location := requestLocation(c)
+	if location == nil || report == nil {
+		return report
+	}
+	local := *report
+	local.InLocation(location)
+	return &local
+}
+
+// localizedReportList возвращает отчеты списка со временем в часовом поясе запроса
+func localizedReportList(c echo.Context, reports []models.Report) []models.Report {
+	location := requestLocation(c)
+	if location == nil {
+		return reports
+	}
+	local := make([]models.Report, len(reports))
+	for i := range reports {
+		local[i] = reports[i]
+		local[i].InLocation(location)
+	}
+	return local
+}
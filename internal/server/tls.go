@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewTLSConfig создает настройки TLS сервера из server.tls или возвращает nil, если TLS выключен
+func NewTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.MinVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+
+	if len(cfg.Autocert.Hosts) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.Autocert.Hosts...),
+			Cache:      autocert.DirCache(cfg.Autocert.CacheDir),
+			Email:      cfg.Autocert.Email,
+		}
+		tlsConfig.GetCertificate = manager.GetCertificate
+		tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	} else {
+		loader, err := newCertificateLoader(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetCertificate = loader.GetCertificate
+	}
+
+	if cfg.ClientAuth == "none" {
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения сертификатов CA клиентов: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("в %s нет сертификатов CA в формате PEM", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.ClientAuth == "require" {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// certificateCheckInterval как часто проверяется, не заменены ли файлы сертификата
+const certificateCheckInterval = time.Minute
+
+// certificateLoader отдает сертификат сервера из файлов и перечитывает их после замены,
+// поэтому обновленный сертификат (например, от cert-manager) применяется без перезапуска
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTime     time.Time
+	checkedAt   time.Time
+}
+
+// newCertificateLoader загружает сертификат из файлов
+func newCertificateLoader(certFile, keyFile string) (*certificateLoader, error) {
+	loader := &certificateLoader{certFile: certFile, keyFile: keyFile}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// GetCertificate возвращает текущий сертификат. Если файлы не удалось перечитать,
+// используется ранее загруженный сертификат.
+func (l *certificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.checkedAt) > certificateCheckInterval {
+		l.checkedAt = time.Now()
+		if info, err := os.Stat(l.certFile); err == nil && !info.ModTime().Equal(l.modTime) {
+			_ = l.loadLocked()
+		}
+	}
+	return l.certificate, nil
+}
+
+// load загружает сертификат и ключ из файлов
+func (l *certificateLoader) load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.loadLocked()
+}
+
+// loadLocked загружает сертификат под блокировкой
+func (l *certificateLoader) loadLocked() error {
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения сертификата сервера: %w", err)
+	}
+	certificate, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки сертификата сервера: %w", err)
+	}
+	l.certificate = &certificate
+	l.modTime = info.ModTime()
+	l.checkedAt = time.Now()
+	return nil
+}
+
+// ClientCertificateAuthenticator аутентифицирует внутренние сервисы по сертификату
+// клиента, проверенному при установке TLS соединения (mTLS). Клиент получает имя
+// cert:<CN сертификата> и области доступа из server.tls.client_scopes.
+type ClientCertificateAuthenticator struct {
+	scopes models.Scopes
+}
+
+// NewClientCertificateAuthenticator создает проверку сертификатов клиентов
+func NewClientCertificateAuthenticator(scopes []string) *ClientCertificateAuthenticator {
+	return &ClientCertificateAuthenticator{scopes: models.Scopes(scopes)}
+}
+
+// Authenticate возвращает клиента по проверенному сертификату или nil, nil без сертификата
+func (a *ClientCertificateAuthenticator) Authenticate(c echo.Context) (*Principal, error) {
+	state := c.Request().TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	name := state.VerifiedChains[0][0].Subject.CommonName
+	if name == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Subject: "cert:" + name, Scopes: a.scopes, Method: "client_cert"}, nil
+}
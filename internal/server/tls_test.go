@@ -0,0 +1,188 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate сертификат с ключом, выпущенный для теста
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issueTestCertificate выпускает сертификат, подписанный parent. Без parent сертификат
+// самоподписанный и может подписывать другие сертификаты
+func issueTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer := &testCertificate{cert: template, key: key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{cert: cert, key: key}
+}
+
+// writeFiles сохраняет сертификат и ключ в PEM и возвращает пути к файлам
+func (c *testCertificate) writeFiles(t *testing.T, dir, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600))
+	return certFile, keyFile
+}
+
+// tlsCertificate возвращает сертификат для клиента TLS
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+// startMTLSServer запускает сервер, отвечающий именем клиента из сертификата
+func startMTLSServer(t *testing.T, clientAuth string) (*httptest.Server, *testCertificate, *testCertificate) {
+	dir := t.TempDir()
+	ca := issueTestCertificate(t, "report-srv-test-ca", nil)
+	caFile, _ := ca.writeFiles(t, dir, "ca")
+	certFile, keyFile := issueTestCertificate(t, "localhost", ca).writeFiles(t, dir, "server")
+
+	tlsConfig, err := NewTLSConfig(config.TLS{
+		Enabled:      true,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientAuth:   clientAuth,
+		ClientCAFile: caFile,
+	})
+	require.NoError(t, err)
+
+	authenticator := NewClientCertificateAuthenticator([]string{models.ScopeReportsRead})
+	e := echo.New()
+	e.GET("/whoami", func(c echo.Context) error {
+		principal, err := authenticator.Authenticate(c)
+		if err != nil {
+			return c.String(http.StatusUnauthorized, err.Error())
+		}
+		if principal == nil {
+			return c.String(http.StatusOK, "anonymous")
+		}
+		return c.String(http.StatusOK, principal.Subject+" "+principal.Method+" "+principal.Scopes[0])
+	})
+
+	server := httptest.NewUnstartedServer(e)
+	server.TLS = tlsConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, ca, issueTestCertificate(t, "billing-service", ca)
+}
+
+// mtlsGet выполняет запрос с сертификатами клиента
+func mtlsGet(server *httptest.Server, ca *testCertificate, certificates ...tls.Certificate) (string, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if len(certificates) > 0 {
+		// Клиент отдает сертификат даже чужого CA, чтобы его проверил сервер
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &certificates[0], nil
+		}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	// Имя хоста передается в SNI, по нему сервер отдает сертификат из NewTLSConfig,
+	// а не встроенный сертификат httptest
+	response, err := client.Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/whoami")
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	return string(body), err
+}
+
+func TestClientCertificateAuthentication(t *testing.T) {
+	server, ca, client := startMTLSServer(t, "require")
+
+	body, err := mtlsGet(server, ca, client.tlsCertificate())
+	require.NoError(t, err)
+	assert.Equal(t, "cert:billing-service client_cert reports:read", body)
+
+	// Без сертификата и с сертификатом чужого CA соединение не устанавливается
+	_, err = mtlsGet(server, ca)
+	assert.Error(t, err)
+	untrusted := issueTestCertificate(t, "billing-service", issueTestCertificate(t, "other-ca", nil))
+	_, err = mtlsGet(server, ca, untrusted.tlsCertificate())
+	assert.Error(t, err)
+}
+
+func TestClientCertificateVerifyIfGiven(t *testing.T) {
+	server, ca, client := startMTLSServer(t, "verify_if_given")
+
+	body, err := mtlsGet(server, ca)
+	require.NoError(t, err)
+	assert.Equal(t, "anonymous", body)
+
+	body, err = mtlsGet(server, ca, client.tlsCertificate())
+	require.NoError(t, err)
+	assert.Equal(t, "cert:billing-service client_cert reports:read", body)
+
+	// Переданный сертификат проверяется и в этом режиме
+	untrusted := issueTestCertificate(t, "billing-service", issueTestCertificate(t, "other-ca", nil))
+	_, err = mtlsGet(server, ca, untrusted.tlsCertificate())
+	assert.Error(t, err)
+}
+
+func TestNewTLSConfigRejectsInvalidClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := issueTestCertificate(t, "localhost", nil).writeFiles(t, dir, "server")
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+
+	_, err := NewTLSConfig(config.TLS{Enabled: true, CertFile: certFile, KeyFile: keyFile, ClientAuth: "require", ClientCAFile: caFile})
+	assert.Error(t, err)
+
+	tlsConfig, err := NewTLSConfig(config.TLS{Enabled: true, CertFile: certFile, KeyFile: keyFile, ClientAuth: "none"})
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+}
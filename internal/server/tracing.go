@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"report_srv/internal/telemetry"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware создает серверный спан для каждого HTTP запроса
+// и продолжает трассу из заголовков traceparent/baggage
+type TracingMiddleware struct {
+	tracer trace.Tracer
+}
+
+// NewTracingMiddleware создает новый tracing middleware
+func NewTracingMiddleware() Middleware {
+	return &TracingMiddleware{tracer: telemetry.Tracer("http")}
+}
+
+// Apply подключает middleware к Echo
+func (m *TracingMiddleware) Apply(e *echo.Echo) {
+	e.Use(m.handle)
+}
+
+// handle оборачивает обработчик запроса в спан
+func (m *TracingMiddleware) handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := c.Request()
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		route := c.Path()
+		if route == "" {
+			route = request.URL.Path
+		}
+
+		ctx, span := m.tracer.Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		if requestID := c.Response().Header().Get(echo.HeaderXRequestID); requestID != "" {
+			span.SetAttributes(attribute.StringSlice("http.request.header.x-request-id", []string{requestID}))
+		}
+
+		c.SetRequest(request.WithContext(ctx))
+
+		err := next(c)
+
+		status := c.Response().Status
+		if err != nil {
+			status = http.StatusInternalServerError
+			var httpError *echo.HTTPError
+			if errors.As(err, &httpError) {
+				status = httpError.Code
+			}
+			span.RecordError(err)
+		}
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import "context"
+
+// actorContextKey ключ пользователя операции в контексте
+type actorContextKey struct{}
+
+// WithActor возвращает контекст операции, выполняемой от имени пользователя actor.
+// Сервисы записывают его в created_by и updated_by вместо значений от клиента.
+func WithActor(ctx context.Context, actor string) context.Context {
+	if actor == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext возвращает пользователя операции или пустую строку,
+// если операция выполняется без аутентификации или самим сервисом
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+	return actor
+}
+
+// actorOr возвращает пользователя операции из контекста или fallback, если его нет
+func actorOr(ctx context.Context, fallback string) string {
+	if actor := ActorFromContext(ctx); actor != "" {
+		return actor
+	}
+	return fallback
+}
+
+// unmaskedContextKey ключ разрешения на персональные данные без маскирования в контексте
+type unmaskedContextKey struct{}
+
+// WithUnmasked возвращает контекст операции пользователя, которому разрешены
+// персональные данные без маскирования (область pii:unmasked)
+func WithUnmasked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unmaskedContextKey{}, true)
+}
+
+// unmaskedAllowed сообщает, разрешены ли в операции персональные данные без маскирования
+func unmaskedAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(unmaskedContextKey{}).(bool)
+	return allowed
+}
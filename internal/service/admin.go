@@ -0,0 +1,541 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultActivityPeriod окно активности пользователей по умолчанию
+	DefaultActivityPeriod = "24h"
+	// DefaultActivityUsers число пользователей в списке активности по умолчанию
+	DefaultActivityUsers = 50
+	// MaxActivityUsers максимальное число пользователей в списке активности
+	MaxActivityUsers = 500
+
+	// DefaultRequeueLimit число упавших отчетов, перезапускаемых за запрос по умолчанию
+	DefaultRequeueLimit = 100
+	// MaxRequeueLimit максимальное число упавших отчетов, перезапускаемых за запрос
+	MaxRequeueLimit = 1000
+
+	// DefaultDrainTimeout время ожидания выполняющихся задач при остановке очереди по умолчанию
+	DefaultDrainTimeout = 20 * time.Second
+	// MaxDrainTimeout максимальное время ожидания выполняющихся задач, меньше таймаута HTTP запроса
+	MaxDrainTimeout = 25 * time.Second
+
+	// adminRecentFailures число последних упавших отчетов в обзоре
+	adminRecentFailures = 10
+	// adminRecentFailuresWindow за какой период в обзор попадают упавшие отчеты
+	adminRecentFailuresWindow = 24 * time.Hour
+	// adminUserReports число последних отчетов в активности пользователя
+	adminUserReports = 20
+	// drainPollInterval период проверки выполняющихся задач при остановке очереди
+	drainPollInterval = 500 * time.Millisecond
+)
+
+var (
+	// ErrInvalidAdminRequest некорректные параметры административного запроса
+	ErrInvalidAdminRequest = newCategoryError(ErrValidation, "некорректные параметры запроса")
+	// ErrQueueControlUnsupported процессор задач не поддерживает приостановку очереди
+	ErrQueueControlUnsupported = newCategoryError(ErrConflict, "процессор задач не поддерживает управление очередью")
+)
+
+// QueueState состояние очереди задач и обработчиков
+type QueueState struct {
+	// Paused задачи из очереди не запускаются
+	Paused bool `json:"paused"`
+	// Pending задачи в очереди, Retrying - задачи, ожидающие повтора после ошибки
+	Pending  int64 `json:"pending"`
+	Retrying int64 `json:"retrying"`
+	// Running выполняющиеся задачи
+	Running int64 `json:"running"`
+	// Instances экземпляры сервиса с обработчиками, Workers - число их обработчиков
+	// (0 - без ограничения), Busy - занятые обработчики
+	Instances int   `json:"instances"`
+	Workers   int   `json:"workers"`
+	Busy      int64 `json:"busy"`
+	// Utilization доля занятых обработчиков, нет при неограниченном числе обработчиков
+	Utilization *float64 `json:"utilization,omitempty"`
+}
+
+// QueueController фоновый процессор, выдачу задач из очереди которого можно приостановить
+type QueueController interface {
+	// PauseQueue приостанавливает запуск задач из очереди, выполняющиеся задачи не прерываются
+	PauseQueue(ctx context.Context) error
+	// ResumeQueue возобновляет запуск задач из очереди
+	ResumeQueue(ctx context.Context) error
+	QueueState(ctx context.Context) (*QueueState, error)
+}
+
+// AdminOverview обзор состояния сервиса для административного дашборда
+type AdminOverview struct {
+	Queue          QueueState                    `json:"queue"`
+	Reports        map[models.ReportStatus]int64 `json:"reports"`
+	Storage        StorageUsage                  `json:"storage"`
+	RecentFailures []FailedReport                `json:"recent_failures"`
+	// DeadLetters задачи, исчерпавшие попытки, отчеты которых еще не поставлены в очередь повторно
+	DeadLetters int64     `json:"dead_letters"`
+	ComputedAt  time.Time `json:"computed_at"`
+}
+
+// StorageUsage место, занятое файлами отчетов
+type StorageUsage struct {
+	StorageStats
+	// QuotaBytes квота диска локального хранилища, 0 - без ограничения
+	QuotaBytes int64 `json:"quota_bytes,omitempty"`
+}
+
+// FailedReport отчет, генерация которого завершилась ошибкой
+type FailedReport struct {
+	ID           uint                   `json:"id"`
+	Title        string                 `json:"title"`
+	Type         string                 `json:"type,omitempty"`
+	CreatedBy    string                 `json:"created_by"`
+	ErrorCode    models.ReportErrorCode `json:"error_code,omitempty"`
+	ErrorMessage string                 `json:"error_message,omitempty"`
+	FailedAt     time.Time              `json:"failed_at" gorm:"column:updated_at"`
+}
+
+// FailureFilter параметры выборки упавших отчетов
+type FailureFilter struct {
+	// Since отчеты, упавшие не раньше, nil - за все время
+	Since     *time.Time
+	CreatedBy string
+	Limit     int
+}
+
+// UserActivity активность пользователя: отчеты, созданные, готовые и упавшие за период,
+// отчеты в очереди и в генерации и размер хранимых файлов
+type UserActivity struct {
+	User        string `json:"user" gorm:"column:created_by"`
+	Created     int64  `json:"created"`
+	Completed   int64  `json:"completed"`
+	Failed      int64  `json:"failed"`
+	Active      int64  `json:"active"`
+	StoredBytes int64  `json:"stored_bytes"`
+}
+
+// UserActivityDetails активность пользователя и его последние отчеты
+type UserActivityDetails struct {
+	UserActivity
+	Period  string          `json:"period"`
+	Reports []models.Report `json:"reports"`
+}
+
+// RequeueFailedParams параметры повторного запуска упавших отчетов
+type RequeueFailedParams struct {
+	// Since отчеты, упавшие не раньше, nil - за все время
+	Since     *time.Time
+	CreatedBy string
+	Limit     int
+}
+
+// RequeueResult результат повторного запуска упавших отчетов
+type RequeueResult struct {
+	Requeued  int    `json:"requeued"`
+	ReportIDs []uint `json:"report_ids"`
+	// Failed отчеты, которые не удалось поставить в очередь, они снова помечены failed
+	Failed []uint `json:"failed,omitempty"`
+}
+
+// DrainResult результат остановки очереди с ожиданием выполняющихся задач
+type DrainResult struct {
+	// Drained все выполнявшиеся задачи завершились до истечения времени ожидания
+	Drained bool       `json:"drained"`
+	Queue   QueueState `json:"queue"`
+}
+
+// AdminService административный дашборд: обзор сервиса, активность пользователей и обслуживание очереди
+type AdminService interface {
+	Overview(ctx context.Context) (*AdminOverview, error)
+	// ListUserActivity возвращает пользователей, активных за period (1h, 24h или 7d), от самых активных
+	ListUserActivity(ctx context.Context, period string, limit int) ([]UserActivity, error)
+	GetUserActivity(ctx context.Context, user, period string) (*UserActivityDetails, error)
+	PauseQueue(ctx context.Context) (*QueueState, error)
+	ResumeQueue(ctx context.Context) (*QueueState, error)
+	// DrainQueue приостанавливает очередь и ожидает завершения выполняющихся задач не дольше timeout
+	DrainQueue(ctx context.Context, timeout time.Duration) (*DrainResult, error)
+	// RequeueFailed ставит упавшие отчеты в очередь повторно, начиная с упавших последними
+	RequeueFailed(ctx context.Context, params RequeueFailedParams) (*RequeueResult, error)
+	ListDeadLetters(ctx context.Context, params DeadLetterListParams) (*DeadLetterList, error)
+	// RequeueDeadLetter ставит отчет задачи, исчерпавшей попытки, в очередь повторно
+	RequeueDeadLetter(ctx context.Context, id uint) (*models.DeadLetter, error)
+}
+
+// AdminServiceImpl реализация административного сервиса
+type AdminServiceImpl struct {
+	stats       StatsRepository
+	reports     ReportRepository
+	deadLetters DeadLetterRepository
+	processor   BackgroundProcessor
+	queue       QueueController
+	publisher   events.Publisher
+	quotaBytes  int64
+	logger      logging.Logger
+	now         func() time.Time
+}
+
+// NewAdminService создает административный сервис. Приостановка очереди доступна,
+// если процессор реализует QueueController
+func NewAdminService(
+	stats StatsRepository,
+	reports ReportRepository,
+	deadLetters DeadLetterRepository,
+	processor BackgroundProcessor,
+	publisher events.Publisher,
+	logger logging.Logger,
+) *AdminServiceImpl {
+	queue, _ := processor.(QueueController)
+	return &AdminServiceImpl{
+		stats:       stats,
+		reports:     reports,
+		deadLetters: deadLetters,
+		processor:   processor,
+		queue:       queue,
+		publisher:   publisher,
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// NewAdminServiceFromConfig создает административный сервис по настройкам приложения
+func NewAdminServiceFromConfig(
+	cfg config.Config,
+	db *gorm.DB,
+	processor BackgroundProcessor,
+	bus events.Bus,
+	logger logging.Logger,
+) AdminService {
+	return NewAdminService(NewGormStatsRepository(db, logger), NewGormReportRepository(db, logger),
+		NewGormDeadLetterRepository(db, logger), processor, bus, logger).
+		WithStorageQuota(cfg.Storage.Quota.MaxBytes)
+}
+
+// WithStorageQuota задает квоту диска локального хранилища для обзора
+func (s *AdminServiceImpl) WithStorageQuota(quotaBytes int64) *AdminServiceImpl {
+	s.quotaBytes = quotaBytes
+	return s
+}
+
+// Overview собирает обзор очереди, отчетов по статусам, занятого места и последних ошибок
+func (s *AdminServiceImpl) Overview(ctx context.Context) (*AdminOverview, error) {
+	now := s.now().UTC()
+	overview := &AdminOverview{ComputedAt: now}
+
+	queue, err := s.queueState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overview.Queue = *queue
+
+	if overview.Reports, err = s.stats.CountByStatus(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета отчетов по статусам: %w", err)
+	}
+	if overview.Storage.StorageStats, err = s.stats.Storage(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета хранимых файлов: %w", err)
+	}
+	overview.Storage.QuotaBytes = s.quotaBytes
+
+	since := now.Add(-adminRecentFailuresWindow)
+	if overview.RecentFailures, err = s.stats.RecentFailures(ctx, FailureFilter{Since: &since, Limit: adminRecentFailures}); err != nil {
+		return nil, fmt.Errorf("ошибка получения последних ошибок генерации: %w", err)
+	}
+	if overview.DeadLetters, err = s.deadLetters.CountOpen(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета задач, исчерпавших попытки: %w", err)
+	}
+	return overview, nil
+}
+
+// ListUserActivity возвращает активность пользователей за период
+func (s *AdminServiceImpl) ListUserActivity(ctx context.Context, period string, limit int) ([]UserActivity, error) {
+	since, err := s.activitySince(period)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = DefaultActivityUsers
+	}
+
+	activity, err := s.stats.UserActivity(ctx, since, "", min(limit, MaxActivityUsers))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения активности пользователей: %w", err)
+	}
+	return activity, nil
+}
+
+// GetUserActivity возвращает активность пользователя за период и его последние отчеты
+func (s *AdminServiceImpl) GetUserActivity(ctx context.Context, user, period string) (*UserActivityDetails, error) {
+	if period == "" {
+		period = DefaultActivityPeriod
+	}
+	since, err := s.activitySince(period)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &UserActivityDetails{UserActivity: UserActivity{User: user}, Period: period}
+	activity, err := s.stats.UserActivity(ctx, since, user, 1)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения активности пользователя: %w", err)
+	}
+	if len(activity) > 0 {
+		details.UserActivity = activity[0]
+	}
+
+	details.Reports, _, err = s.reports.List(ctx, ListReportParams{Page: 1, PageSize: adminUserReports, CreatedBy: user})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения отчетов пользователя: %w", err)
+	}
+	return details, nil
+}
+
+// PauseQueue приостанавливает запуск задач из очереди
+func (s *AdminServiceImpl) PauseQueue(ctx context.Context) (*QueueState, error) {
+	if s.queue == nil {
+		return nil, ErrQueueControlUnsupported
+	}
+	if err := s.queue.PauseQueue(ctx); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx, s.logger).Warn("Очередь задач приостановлена")
+	return s.queueState(ctx)
+}
+
+// ResumeQueue возобновляет запуск задач из очереди
+func (s *AdminServiceImpl) ResumeQueue(ctx context.Context) (*QueueState, error) {
+	if s.queue == nil {
+		return nil, ErrQueueControlUnsupported
+	}
+	if err := s.queue.ResumeQueue(ctx); err != nil {
+		return nil, err
+	}
+
+	logging.FromContext(ctx, s.logger).Info("Очередь задач возобновлена")
+	return s.queueState(ctx)
+}
+
+// DrainQueue приостанавливает очередь и ожидает, пока выполняющиеся задачи завершатся.
+// Очередь остается приостановленной до ResumeQueue, например на время обслуживания базы данных
+func (s *AdminServiceImpl) DrainQueue(ctx context.Context, timeout time.Duration) (*DrainResult, error) {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	if timeout > MaxDrainTimeout {
+		return nil, fmt.Errorf("%w: время ожидания не больше %s", ErrInvalidAdminRequest, MaxDrainTimeout)
+	}
+
+	state, err := s.PauseQueue(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for state.Running > 0 {
+		select {
+		case <-waitCtx.Done():
+			return &DrainResult{Queue: *state}, nil
+		case <-ticker.C:
+		}
+		if state, err = s.queueState(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	logging.FromContext(ctx, s.logger).Info("Выполняющиеся задачи завершены, очередь приостановлена")
+	return &DrainResult{Drained: true, Queue: *state}, nil
+}
+
+// RequeueFailed переводит упавшие отчеты в статус pending и ставит их генерацию в очередь.
+// Отчет, который не удалось поставить в очередь, снова помечается failed
+func (s *AdminServiceImpl) RequeueFailed(ctx context.Context, params RequeueFailedParams) (*RequeueResult, error) {
+	if params.Limit <= 0 {
+		params.Limit = DefaultRequeueLimit
+	}
+	if params.Limit > MaxRequeueLimit {
+		return nil, fmt.Errorf("%w: limit не больше %d", ErrInvalidAdminRequest, MaxRequeueLimit)
+	}
+
+	failed, err := s.stats.RecentFailures(ctx, FailureFilter{Since: params.Since, CreatedBy: params.CreatedBy, Limit: params.Limit})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения упавших отчетов: %w", err)
+	}
+
+	result := &RequeueResult{ReportIDs: []uint{}}
+	for _, report := range failed {
+		// Отчет мог быть перезапущен одновременно другим запросом
+		claimed, err := s.requeueReport(ctx, report.ID)
+		switch {
+		case errors.Is(err, errRequeueSubmit):
+			result.Failed = append(result.Failed, report.ID)
+		case err != nil:
+			return result, err
+		case claimed:
+			result.Requeued++
+			result.ReportIDs = append(result.ReportIDs, report.ID)
+		}
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"requeued":   result.Requeued,
+		"created_by": params.CreatedBy,
+	}).Info("Упавшие отчеты поставлены в очередь повторно")
+	return result, nil
+}
+
+// ListDeadLetters возвращает страницу задач, исчерпавших попытки, новые первыми
+func (s *AdminServiceImpl) ListDeadLetters(ctx context.Context, params DeadLetterListParams) (*DeadLetterList, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 20
+	}
+	if params.PageSize > 100 {
+		params.PageSize = 100
+	}
+
+	letters, total, err := s.deadLetters.List(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения задач, исчерпавших попытки: %w", err)
+	}
+
+	return &DeadLetterList{
+		DeadLetters: letters,
+		Total:       total,
+		Page:        params.Page,
+		PageSize:    params.PageSize,
+		TotalPages:  int((total + int64(params.PageSize) - 1) / int64(params.PageSize)),
+	}, nil
+}
+
+// RequeueDeadLetter ставит отчет задачи, исчерпавшей попытки, в очередь повторно. Отчет должен
+// оставаться в статусе failed: перезапущенный другим способом отчет не запускается дважды
+func (s *AdminServiceImpl) RequeueDeadLetter(ctx context.Context, id uint) (*models.DeadLetter, error) {
+	letter, err := s.deadLetters.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrDeadLetterNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения задачи, исчерпавшей попытки: %w", err)
+	}
+	if letter.IsRequeued() {
+		return nil, fmt.Errorf("%w: %d", ErrDeadLetterRequeued, id)
+	}
+
+	claimed, err := s.requeueReport(ctx, letter.ReportID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, fmt.Errorf("%w: отчет %d не в статусе failed", ErrDeadLetterRequeued, letter.ReportID)
+	}
+
+	return s.deadLetters.GetByID(ctx, id)
+}
+
+// errRequeueSubmit отчет не удалось поставить в очередь, он снова помечен failed
+var errRequeueSubmit = errors.New("ошибка постановки отчета в очередь")
+
+// requeueReport переводит упавший отчет в статус pending и ставит его генерацию в очередь.
+// Возвращает false, если отчет не в статусе failed
+func (s *AdminServiceImpl) requeueReport(ctx context.Context, reportID uint) (bool, error) {
+	requeuer := reportRequeuer{
+		reports:     s.reports,
+		deadLetters: s.deadLetters,
+		processor:   s.processor,
+		publisher:   s.publisher,
+		logger:      s.logger,
+		now:         s.now,
+	}
+	return requeuer.requeue(ctx, reportID, models.StatusFailed)
+}
+
+// reportRequeuer повторный запуск упавших и отмененных отчетов из административного API
+// и при смене статуса отчета на pending
+type reportRequeuer struct {
+	reports ReportRepository
+	// deadLetters nil - задачи, исчерпавшие попытки, не отмечаются
+	deadLetters DeadLetterRepository
+	processor   BackgroundProcessor
+	publisher   events.Publisher
+	logger      logging.Logger
+	now         func() time.Time
+}
+
+// requeue переводит отчет из статуса from в статус pending, ставит его генерацию в очередь и отмечает
+// его задачи, исчерпавшие попытки, поставленными повторно. Возвращает false, если отчет не в статусе from
+func (r reportRequeuer) requeue(ctx context.Context, reportID uint, from models.ReportStatus) (bool, error) {
+	logger := logging.FromContext(ctx, r.logger).WithField("report_id", reportID)
+
+	claimed, err := r.reports.Requeue(ctx, reportID, from)
+	if err != nil {
+		return false, fmt.Errorf("ошибка перезапуска отчета %d: %w", reportID, err)
+	}
+	if !claimed {
+		return false, nil
+	}
+
+	report, err := r.reports.GetByID(ctx, reportID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка получения отчета %d: %w", reportID, err)
+	}
+	if err := r.processor.SubmitTask(ctx, newReportTask(ctx, report)); err != nil {
+		logger.WithError(err).Error("Ошибка постановки отчета в очередь повторно")
+		if err := failReport(ctx, r.reports, r.publisher, logger, reportID, err); err != nil {
+			return false, err
+		}
+		return false, fmt.Errorf("%w %d: %w", errRequeueSubmit, reportID, err)
+	}
+
+	if r.deadLetters != nil {
+		if _, err := r.deadLetters.MarkRequeued(ctx, reportID, ActorFromContext(ctx), r.now().UTC()); err != nil {
+			logger.WithError(err).Error("Ошибка отметки задач отчета, исчерпавших попытки")
+		}
+	}
+	return true, nil
+}
+
+// queueState возвращает состояние очереди с долей занятых обработчиков
+func (s *AdminServiceImpl) queueState(ctx context.Context) (*QueueState, error) {
+	if s.queue == nil {
+		return &QueueState{}, nil
+	}
+
+	state, err := s.queue.QueueState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if state.Workers > 0 {
+		utilization := roundStat(float64(state.Busy) / float64(state.Workers))
+		state.Utilization = &utilization
+	}
+	return state, nil
+}
+
+// activitySince возвращает начало окна активности по его имени
+func (s *AdminServiceImpl) activitySince(period string) (time.Time, error) {
+	if period == "" {
+		period = DefaultActivityPeriod
+	}
+	for _, window := range StatsWindows {
+		if window.Name == period {
+			return s.now().UTC().Add(-window.Duration), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: период должен быть 1h, 24h или 7d, получено: %s", ErrInvalidAdminRequest, period)
+}
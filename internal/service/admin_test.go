@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestAdminService создает административный сервис над тестовой БД
+func newTestAdminService(t *testing.T, db *gorm.DB, processor BackgroundProcessor) *AdminServiceImpl {
+	require.NoError(t, db.AutoMigrate(&models.DeadLetter{}))
+	logger := setupTestLogger()
+	return NewAdminService(NewGormStatsRepository(db, logger), NewGormReportRepository(db, logger),
+		NewGormDeadLetterRepository(db, logger), processor, events.NopPublisher{}, logger)
+}
+
+func TestAdminOverviewAndUserActivity(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 0)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	old := now.Add(-48 * time.Hour)
+	reports := []models.Report{
+		{Title: "Продажи", Status: models.StatusCompleted, CreatedBy: "alice", FileKey: "reports/1.xlsx", FileSize: 1000, GeneratedAt: &now},
+		{Title: "Склад", Status: models.StatusFailed, CreatedBy: "alice", ErrorCode: models.ErrorCodeQuery, ErrorMessage: "timeout"},
+		{Title: "Архив", Status: models.StatusCompleted, CreatedBy: "bob", FileKey: "reports/3.xlsx", FileSize: 500, GeneratedAt: &old},
+		{Title: "Давний", Status: models.StatusCompleted, CreatedBy: "carol", GeneratedAt: &old},
+	}
+	for i := range reports {
+		reports[i].UpdatedBy = reports[i].CreatedBy
+		require.NoError(t, db.Create(&reports[i]).Error)
+	}
+	for _, report := range reports[2:] {
+		require.NoError(t, db.Model(&report).UpdateColumns(map[string]interface{}{"created_at": old, "updated_at": old}).Error)
+	}
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+	processor.reportWorkers(ctx, now)
+
+	admin := newTestAdminService(t, db, processor).
+		WithStorageQuota(1 << 30)
+
+	overview, err := admin.Overview(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), overview.Queue.Pending)
+	assert.Equal(t, 1, overview.Queue.Instances)
+	assert.Equal(t, maxConcurrentGeneration, overview.Queue.Workers)
+	require.NotNil(t, overview.Queue.Utilization)
+	assert.Zero(t, *overview.Queue.Utilization)
+	assert.Equal(t, int64(3), overview.Reports[models.StatusCompleted])
+	assert.Equal(t, int64(1500), overview.Storage.Bytes)
+	assert.Equal(t, int64(1<<30), overview.Storage.QuotaBytes)
+	require.Len(t, overview.RecentFailures, 1)
+	assert.Equal(t, "Склад", overview.RecentFailures[0].Title)
+	assert.Equal(t, models.ErrorCodeQuery, overview.RecentFailures[0].ErrorCode)
+
+	// За сутки активны alice и test-user с отчетом в очереди, bob и carol - только раньше
+	activity, err := admin.ListUserActivity(ctx, "24h", 0)
+	require.NoError(t, err)
+	require.Len(t, activity, 2)
+	assert.Equal(t, "alice", activity[0].User)
+	assert.Equal(t, int64(2), activity[0].Created)
+	assert.Equal(t, int64(1), activity[0].Completed)
+	assert.Equal(t, int64(1), activity[0].Failed)
+	assert.Equal(t, int64(1000), activity[0].StoredBytes)
+	assert.Equal(t, "test-user", activity[1].User)
+	assert.Equal(t, int64(1), activity[1].Active)
+
+	activity, err = admin.ListUserActivity(ctx, "7d", 0)
+	require.NoError(t, err)
+	assert.Len(t, activity, 4)
+
+	details, err := admin.GetUserActivity(ctx, "bob", "")
+	require.NoError(t, err)
+	assert.Equal(t, "24h", details.Period)
+	assert.Zero(t, details.Created)
+	assert.Equal(t, int64(500), details.StoredBytes)
+	require.Len(t, details.Reports, 1)
+	assert.Equal(t, "Архив", details.Reports[0].Title)
+
+	_, err = admin.ListUserActivity(ctx, "30d", 0)
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestAdminPausesRedisQueue(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 0)
+	ctx := context.Background()
+
+	admin := newTestAdminService(t, db, processor)
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+
+	state, err := admin.PauseQueue(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+
+	// Из приостановленной очереди задачи не забираются, в том числе другими экземплярами
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.False(t, processed)
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(task.ID))
+
+	result, err := admin.DrainQueue(ctx, time.Second)
+	require.NoError(t, err)
+	assert.True(t, result.Drained)
+	assert.Equal(t, int64(1), result.Queue.Pending)
+
+	state, err = admin.ResumeQueue(ctx)
+	require.NoError(t, err)
+	assert.False(t, state.Paused)
+	processed, err = processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusCompleted, processor.GetTaskStatus(task.ID))
+
+	_, err = admin.DrainQueue(ctx, time.Hour)
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestSyncProcessorPausesQueue(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	logger := setupTestLogger()
+	executor := NewReportTaskExecutor(NewGormReportRepository(db, logger), NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+	processor := NewSyncBackgroundProcessorWithExecutor(executor, logger).(*SyncBackgroundProcessor)
+	ctx := context.Background()
+	go processor.Start()
+	t.Cleanup(func() { close(processor.tasks) })
+
+	admin := newTestAdminService(t, db, processor)
+	_, err := admin.PauseQueue(ctx)
+	require.NoError(t, err)
+
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(task.ID))
+
+	state, err := processor.QueueState(ctx)
+	require.NoError(t, err)
+	assert.True(t, state.Paused)
+	assert.Equal(t, int64(1), state.Pending)
+	assert.Zero(t, state.Workers)
+
+	_, err = admin.ResumeQueue(ctx)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return processor.GetTaskStatus(task.ID) == TaskStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Остановка очереди ждет завершения выполняющихся задач
+	processor.running.Add(1)
+	time.AfterFunc(200*time.Millisecond, func() { processor.running.Add(-1) })
+	result, err := admin.DrainQueue(ctx, 5*time.Second)
+	require.NoError(t, err)
+	assert.True(t, result.Drained)
+	assert.True(t, result.Queue.Paused)
+	assert.Zero(t, result.Queue.Running)
+
+	processor.running.Add(1)
+	result, err = admin.DrainQueue(ctx, 100*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, result.Drained)
+	assert.Equal(t, int64(1), result.Queue.Running)
+	processor.running.Add(-1)
+	_, err = admin.ResumeQueue(ctx)
+	require.NoError(t, err)
+}
+
+func TestAdminRequeueFailed(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	executor := NewReportTaskExecutor(NewGormReportRepository(db, logger), NewFormatGenerators(logger), NewReportFileStorage(new(MockStorage), logger), logger)
+	processor := NewSyncBackgroundProcessorWithExecutor(executor, logger).(*SyncBackgroundProcessor)
+	ctx := context.Background()
+
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	reports := []models.Report{
+		{Title: "Склад", Status: models.StatusFailed, CreatedBy: "alice", ErrorCode: models.ErrorCodeQuery, ErrorMessage: "timeout"},
+		{Title: "Продажи", Status: models.StatusFailed, CreatedBy: "bob", ErrorCode: models.ErrorCodeStorage},
+		{Title: "Архив", Status: models.StatusFailed, CreatedBy: "alice"},
+		{Title: "Готов", Status: models.StatusCompleted, CreatedBy: "alice"},
+	}
+	for i := range reports {
+		reports[i].UpdatedBy = reports[i].CreatedBy
+		require.NoError(t, db.Create(&reports[i]).Error)
+	}
+	require.NoError(t, db.Model(&reports[2]).UpdateColumn("updated_at", old).Error)
+
+	admin := newTestAdminService(t, db, processor)
+	since := time.Now().UTC().Add(-time.Hour)
+	result, err := admin.RequeueFailed(ctx, RequeueFailedParams{Since: &since, CreatedBy: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Requeued)
+	assert.Equal(t, []uint{reports[0].ID}, result.ReportIDs)
+
+	var stored models.Report
+	require.NoError(t, db.First(&stored, reports[0].ID).Error)
+	assert.Equal(t, models.StatusPending, stored.Status)
+	assert.Empty(t, stored.ErrorCode)
+	assert.Empty(t, stored.ErrorMessage)
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(reportTaskID(reports[0].ID)))
+
+	// Без фильтров перезапускаются оставшиеся упавшие отчеты
+	result, err = admin.RequeueFailed(ctx, RequeueFailedParams{})
+	require.NoError(t, err)
+	assert.Equal(t, []uint{reports[1].ID, reports[2].ID}, result.ReportIDs)
+
+	_, err = admin.RequeueFailed(ctx, RequeueFailedParams{Limit: MaxRequeueLimit + 1})
+	assert.ErrorIs(t, err, ErrValidation)
+}
+
+func TestAdminRequeuesDeadLetter(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(errStorageUnavailable).Twice()
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 1)
+	admin := newTestAdminService(t, db, processor)
+	processor.executor.WithDeadLetters(NewGormDeadLetterRepository(db, setupTestLogger()))
+	ctx := context.Background()
+
+	task := createTestReportTask(t, db, PriorityHigh)
+	task.RequestID = "req-42"
+	require.NoError(t, processor.SubmitTask(ctx, task))
+
+	// Задача исчерпывает попытки и сохраняется с причиной последней ошибки
+	_, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, processor.Requeue(ctx, time.Now().UTC().Add(maxRedisRetryDelay)))
+	_, err = processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, reportStatus(t, db, task))
+
+	list, err := admin.ListDeadLetters(ctx, DeadLetterListParams{})
+	require.NoError(t, err)
+	require.Len(t, list.DeadLetters, 1)
+	letter := list.DeadLetters[0]
+	assert.Equal(t, task.Data.(uint), letter.ReportID)
+	assert.Equal(t, task.ID, letter.TaskID)
+	assert.Equal(t, int(PriorityHigh), letter.Priority)
+	assert.Equal(t, 2, letter.Attempts)
+	assert.Equal(t, models.ErrorCodeStorage, letter.ErrorCode)
+	assert.Contains(t, letter.ErrorMessage, "storage unavailable")
+	assert.Equal(t, "req-42", letter.RequestID)
+
+	overview, err := admin.Overview(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), overview.DeadLetters)
+
+	requeued, err := admin.RequeueDeadLetter(ctx, letter.ID)
+	require.NoError(t, err)
+	assert.True(t, requeued.IsRequeued())
+	assert.Equal(t, models.StatusPending, reportStatus(t, db, task))
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, models.StatusCompleted, reportStatus(t, db, task))
+
+	_, err = admin.RequeueDeadLetter(ctx, letter.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+	_, err = admin.RequeueDeadLetter(ctx, letter.ID+1)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	list, err = admin.ListDeadLetters(ctx, DeadLetterListParams{})
+	require.NoError(t, err)
+	assert.Empty(t, list.DeadLetters)
+	list, err = admin.ListDeadLetters(ctx, DeadLetterListParams{Requeued: true})
+	require.NoError(t, err)
+	assert.Len(t, list.DeadLetters, 1)
+}
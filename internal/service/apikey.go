@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyPrefix начало API ключа, по нему ключ отличается от других токенов
+	APIKeyPrefix = "rsk_"
+
+	// apiKeyBytes число случайных байт ключа
+	apiKeyBytes = 32
+	// apiKeyDisplayPrefix длина начала ключа, которое хранится для его опознания
+	apiKeyDisplayPrefix = 12
+	// apiKeyUsageInterval как часто обновляется время последнего использования ключа
+	apiKeyUsageInterval = time.Minute
+)
+
+var (
+	// ErrInvalidAPIKey API ключ не найден, отозван или истек
+	ErrInvalidAPIKey = errors.New("недействительный API ключ")
+	// ErrInvalidAPIKeyRequest параметры создаваемого API ключа не прошли проверку
+	ErrInvalidAPIKeyRequest = newCategoryError(ErrValidation, "некорректные параметры API ключа")
+	// ErrAPIKeyNotFound API ключ не найден
+	ErrAPIKeyNotFound = newCategoryError(ErrNotFound, "API ключ не найден")
+)
+
+// APIKeyService интерфейс для управления API ключами и их проверки
+type APIKeyService interface {
+	// CreateAPIKey создает ключ и возвращает его значение, которое больше нигде не хранится
+	CreateAPIKey(ctx context.Context, key *models.APIKey) (string, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uint) error
+	// Authenticate возвращает действующий ключ по его значению
+	Authenticate(ctx context.Context, value string) (*models.APIKey, error)
+}
+
+// APIKeyRepository интерфейс для работы с API ключами в базе данных
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	List(ctx context.Context) ([]models.APIKey, error)
+	Delete(ctx context.Context, id uint) error
+	Touch(ctx context.Context, id uint, usedAt time.Time) error
+}
+
+// GormAPIKeyRepository реализация APIKeyRepository с использованием GORM
+type GormAPIKeyRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormAPIKeyRepository создает новый репозиторий API ключей
+func NewGormAPIKeyRepository(db *gorm.DB, logger logging.Logger) APIKeyRepository {
+	return &GormAPIKeyRepository{db: db, logger: logger}
+}
+
+// Create сохраняет API ключ
+func (r *GormAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return r.db.WithContext(ctx).Create(key).Error
+}
+
+// GetByHash возвращает неотозванный ключ по SHA-256 его значения
+func (r *GormAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.WithContext(ctx).Where("hash = ?", hash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// List возвращает неотозванные ключи от новых к старым
+func (r *GormAPIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.WithContext(ctx).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Delete отзывает ключ
+func (r *GormAPIKeyRepository) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.APIKey{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Touch сохраняет время последнего использования ключа
+func (r *GormAPIKeyRepository) Touch(ctx context.Context, id uint, usedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).
+		UpdateColumn("last_used_at", usedAt).Error
+}
+
+// APIKeyServiceImpl реализация сервиса API ключей
+type APIKeyServiceImpl struct {
+	repository APIKeyRepository
+	logger     logging.Logger
+	now        func() time.Time
+}
+
+// NewAPIKeyService создает новый сервис API ключей
+func NewAPIKeyService(repository APIKeyRepository, logger logging.Logger) *APIKeyServiceImpl {
+	return &APIKeyServiceImpl{
+		repository: repository,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// NewAPIKeyServiceFromDB создает сервис API ключей с хранением в базе данных
+func NewAPIKeyServiceFromDB(db *gorm.DB, logger logging.Logger) APIKeyService {
+	return NewAPIKeyService(NewGormAPIKeyRepository(db, logger), logger)
+}
+
+// CreateAPIKey создает API ключ
+func (s *APIKeyServiceImpl) CreateAPIKey(ctx context.Context, key *models.APIKey) (string, error) {
+	key.Name = strings.TrimSpace(key.Name)
+	key.CreatedBy = actorOr(ctx, key.CreatedBy)
+	if err := key.Validate(); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAPIKeyRequest, err)
+	}
+	if key.IsExpired(s.now()) {
+		return "", fmt.Errorf("%w: срок действия ключа уже истек", ErrInvalidAPIKeyRequest)
+	}
+
+	secret := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("ошибка генерации API ключа: %w", err)
+	}
+	value := APIKeyPrefix + hex.EncodeToString(secret)
+	key.Prefix = value[:apiKeyDisplayPrefix]
+	key.Hash = hashSecret(value)
+
+	if err := s.repository.Create(ctx, key); err != nil {
+		return "", fmt.Errorf("ошибка сохранения API ключа: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"key_id":     key.ID,
+		"name":       key.Name,
+		"scopes":     key.Scopes,
+		"created_by": key.CreatedBy,
+	}).Info("API ключ создан")
+
+	return value, nil
+}
+
+// ListAPIKeys возвращает действующие и истекшие ключи без отозванных
+func (s *APIKeyServiceImpl) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	keys, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения API ключей: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает API ключ
+func (s *APIKeyServiceImpl) RevokeAPIKey(ctx context.Context, id uint) error {
+	if err := s.repository.Delete(ctx, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %d", ErrAPIKeyNotFound, id)
+		}
+		return fmt.Errorf("ошибка отзыва API ключа: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithField("key_id", id).Info("API ключ отозван")
+	return nil
+}
+
+// Authenticate проверяет API ключ. Время последнего использования обновляется
+// не чаще раза в минуту, чтобы не писать в базу на каждый запрос.
+func (s *APIKeyServiceImpl) Authenticate(ctx context.Context, value string) (*models.APIKey, error) {
+	if !strings.HasPrefix(value, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.repository.GetByHash(ctx, hashSecret(value))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("ошибка проверки API ключа: %w", err)
+	}
+
+	now := s.now().UTC()
+	if key.IsExpired(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyUsageInterval {
+		if err := s.repository.Touch(ctx, key.ID, now); err != nil {
+			logging.FromContext(ctx, s.logger).WithError(err).WithField("key_id", key.ID).Warn("Не удалось сохранить время использования API ключа")
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// hashSecret возвращает SHA-256 API ключа или токена ссылки. Они случайные и длинные,
+// поэтому медленное хеширование паролей для них не нужно.
+func hashSecret(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyService(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.APIKey{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+	keys := NewAPIKeyService(NewGormAPIKeyRepository(db, logger), logger)
+
+	expiresAt := time.Now().Add(time.Hour)
+	key := &models.APIKey{Name: "nightly-batch", Scopes: models.Scopes{models.ScopeReportsWrite}, ExpiresAt: &expiresAt, CreatedBy: "admin"}
+	value, err := keys.CreateAPIKey(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(value, APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(value, key.Prefix))
+
+	// Хранится только хеш ключа
+	var stored models.APIKey
+	require.NoError(t, db.First(&stored, key.ID).Error)
+	assert.NotContains(t, stored.Hash, value[len(APIKeyPrefix):])
+	assert.Equal(t, models.Scopes{models.ScopeReportsWrite}, stored.Scopes)
+
+	authenticated, err := keys.Authenticate(ctx, value)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, authenticated.ID)
+	assert.NotNil(t, authenticated.LastUsedAt)
+	assert.True(t, authenticated.Scopes.Allows(models.ScopeReportsWrite))
+	assert.False(t, authenticated.Scopes.Allows(models.ScopeReportsRead))
+
+	_, err = keys.Authenticate(ctx, value+"0")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	// Истекший ключ
+	keys.now = func() time.Time { return expiresAt.Add(time.Second) }
+	_, err = keys.Authenticate(ctx, value)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	keys.now = time.Now
+
+	// Отозванный ключ
+	require.NoError(t, keys.RevokeAPIKey(ctx, key.ID))
+	_, err = keys.Authenticate(ctx, value)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	assert.ErrorIs(t, keys.RevokeAPIKey(ctx, key.ID), ErrAPIKeyNotFound)
+
+	_, err = keys.CreateAPIKey(ctx, &models.APIKey{Name: "bad", Scopes: models.Scopes{"reports:delete"}, CreatedBy: "admin"})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyRequest)
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// bundleAttachmentsDir папка ZIP архива с приложенными к отчету файлами
+const bundleAttachmentsDir = "attachments/"
+
+var (
+	// ErrInvalidAttachment приложенный файл не прошел проверку
+	ErrInvalidAttachment = newCategoryError(ErrValidation, "некорректный приложенный файл")
+	// ErrAttachmentTooLarge приложенный файл больше attachments.max_size
+	ErrAttachmentTooLarge = newCategoryError(ErrValidation, "приложенный файл слишком большой")
+	// ErrAttachmentLimit к отчету приложено attachments.max_count файлов
+	ErrAttachmentLimit = newCategoryError(ErrConflict, "к отчету приложено наибольшее число файлов")
+	// ErrAttachmentNotFound приложенный файл не найден
+	ErrAttachmentNotFound = newCategoryError(ErrNotFound, "приложенный файл не найден")
+
+	// errBundleAttachments в ZIP архив входят приложенные файлы, поэтому архив другого
+	// отчета не копируется
+	errBundleAttachments = errors.New("к архиву приложены файлы")
+)
+
+// AttachmentUpload загружаемый файл. Size -1, если размер заранее неизвестен
+type AttachmentUpload struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	Reader      io.Reader
+}
+
+// AttachmentService интерфейс для работы с приложенными к отчетам файлами
+type AttachmentService interface {
+	AddAttachment(ctx context.Context, reportID uint, upload AttachmentUpload) (*models.ReportAttachment, error)
+	ListAttachments(ctx context.Context, reportID uint) ([]models.ReportAttachment, error)
+	// OpenAttachment открывает файл для скачивания, Reader должен быть закрыт вызывающей стороной
+	OpenAttachment(ctx context.Context, reportID, id uint) (*ReportFile, error)
+	DeleteAttachment(ctx context.Context, reportID, id uint) error
+}
+
+// AttachmentRepository интерфейс для работы с приложенными файлами в базе данных
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *models.ReportAttachment) error
+	GetByID(ctx context.Context, reportID, id uint) (*models.ReportAttachment, error)
+	ListByReport(ctx context.Context, reportID uint) ([]models.ReportAttachment, error)
+	Delete(ctx context.Context, reportID, id uint) error
+}
+
+// GormAttachmentRepository реализация AttachmentRepository с использованием GORM
+type GormAttachmentRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormAttachmentRepository создает новый репозиторий приложенных файлов
+func NewGormAttachmentRepository(db *gorm.DB, logger logging.Logger) AttachmentRepository {
+	return &GormAttachmentRepository{db: db, logger: logger}
+}
+
+// Create сохраняет сведения о приложенном файле
+func (r *GormAttachmentRepository) Create(ctx context.Context, attachment *models.ReportAttachment) error {
+	return r.db.WithContext(ctx).Create(attachment).Error
+}
+
+// GetByID возвращает приложенный файл отчета
+func (r *GormAttachmentRepository) GetByID(ctx context.Context, reportID, id uint) (*models.ReportAttachment, error) {
+	var attachment models.ReportAttachment
+	if err := r.db.WithContext(ctx).Where("report_id = ?", reportID).First(&attachment, id).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// ListByReport возвращает приложенные файлы отчета в порядке добавления
+func (r *GormAttachmentRepository) ListByReport(ctx context.Context, reportID uint) ([]models.ReportAttachment, error) {
+	var attachments []models.ReportAttachment
+	err := r.db.WithContext(ctx).Where("report_id = ?", reportID).Order("id").Find(&attachments).Error
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// Delete удаляет сведения о приложенном файле отчета
+func (r *GormAttachmentRepository) Delete(ctx context.Context, reportID, id uint) error {
+	result := r.db.WithContext(ctx).Where("report_id = ?", reportID).Delete(&models.ReportAttachment{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// AttachmentServiceImpl реализация сервиса приложенных файлов
+type AttachmentServiceImpl struct {
+	repository  AttachmentRepository
+	reports     ReportRepository
+	fileStorage ReportFileStorage
+	limits      config.Attachments
+	logger      logging.Logger
+}
+
+// NewAttachmentService создает новый сервис приложенных файлов
+func NewAttachmentService(
+	repository AttachmentRepository,
+	reports ReportRepository,
+	fileStorage ReportFileStorage,
+	limits config.Attachments,
+	logger logging.Logger,
+) *AttachmentServiceImpl {
+	return &AttachmentServiceImpl{
+		repository:  repository,
+		reports:     reports,
+		fileStorage: fileStorage,
+		limits:      limits,
+		logger:      logger,
+	}
+}
+
+// NewAttachmentServiceFromConfig создает сервис приложенных файлов с хранением
+// сведений в базе данных и файлов рядом с файлами отчетов
+func NewAttachmentServiceFromConfig(cfg config.Config, db *gorm.DB, fileStorage storage.Storage, logger logging.Logger) AttachmentService {
+	return NewAttachmentService(
+		NewGormAttachmentRepository(db, logger),
+		NewGormReportRepository(db, logger),
+		NewReportFileStorage(fileStorage, logger),
+		cfg.Attachments,
+		logger,
+	)
+}
+
+// AddAttachment сохраняет файл и прикладывает его к отчету. Файл больше
+// attachments.max_size отклоняется, даже если его размер заранее неизвестен.
+func (s *AttachmentServiceImpl) AddAttachment(ctx context.Context, reportID uint, upload AttachmentUpload) (*models.ReportAttachment, error) {
+	attachment := &models.ReportAttachment{
+		ReportID:    reportID,
+		Filename:    strings.TrimSpace(upload.Filename),
+		ContentType: upload.ContentType,
+		CreatedBy:   actorOr(ctx, "api"),
+	}
+	if err := attachment.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttachment, err)
+	}
+	if upload.Size > s.limits.MaxSize {
+		return nil, fmt.Errorf("%w: %d байт, допустимо не больше %d", ErrAttachmentTooLarge, upload.Size, s.limits.MaxSize)
+	}
+	if attachment.ContentType == "" {
+		attachment.ContentType = mime.TypeByExtension(path.Ext(attachment.Filename))
+	}
+	if attachment.ContentType == "" {
+		attachment.ContentType = "application/octet-stream"
+	}
+
+	if _, err := s.reports.GetByID(ctx, reportID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrReportNotFound, reportID)
+		}
+		return nil, fmt.Errorf("ошибка получения отчета: %w", err)
+	}
+	existing, err := s.repository.ListByReport(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения приложенных файлов: %w", err)
+	}
+	if len(existing) >= s.limits.MaxCount {
+		return nil, fmt.Errorf("%w: %d", ErrAttachmentLimit, s.limits.MaxCount)
+	}
+	for _, other := range existing {
+		if other.Filename == attachment.Filename {
+			return nil, fmt.Errorf("%w: файл %s уже приложен к отчету", ErrInvalidAttachment, attachment.Filename)
+		}
+	}
+
+	// Размер проверяется по мере чтения: заголовку Content-Length клиента доверять нельзя
+	attachment.FileKey = attachmentKey(reportID, attachment.Filename)
+	limited := &limitedReader{reader: upload.Reader, remaining: s.limits.MaxSize}
+	checksum := newChecksumReader(limited)
+	if err := s.fileStorage.Save(ctx, attachment.FileKey, checksum); err != nil {
+		s.deleteFile(ctx, attachment.FileKey)
+		// Хранилище может обернуть ошибку чтения без %w, поэтому превышение запоминается в reader
+		if limited.exceeded {
+			return nil, fmt.Errorf("%w: допустимо не больше %d байт", ErrAttachmentTooLarge, s.limits.MaxSize)
+		}
+		return nil, fmt.Errorf("ошибка сохранения приложенного файла: %w", err)
+	}
+	attachment.Size = checksum.Size()
+	attachment.Checksum = checksum.Sum()
+
+	if err := s.repository.Create(ctx, attachment); err != nil {
+		s.deleteFile(ctx, attachment.FileKey)
+		return nil, fmt.Errorf("ошибка сохранения приложенного файла: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"report_id":     reportID,
+		"attachment_id": attachment.ID,
+		"filename":      attachment.Filename,
+		"size":          attachment.Size,
+		"created_by":    attachment.CreatedBy,
+	}).Info("Файл приложен к отчету")
+	return attachment, nil
+}
+
+// ListAttachments возвращает приложенные файлы отчета
+func (s *AttachmentServiceImpl) ListAttachments(ctx context.Context, reportID uint) ([]models.ReportAttachment, error) {
+	attachments, err := s.repository.ListByReport(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения приложенных файлов: %w", err)
+	}
+	return attachments, nil
+}
+
+// OpenAttachment открывает приложенный файл с проверкой контрольной суммы
+func (s *AttachmentServiceImpl) OpenAttachment(ctx context.Context, reportID, id uint) (*ReportFile, error) {
+	attachment, err := s.getAttachment(ctx, reportID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.fileStorage.Get(ctx, attachment.FileKey)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения приложенного файла: %w", err)
+	}
+	return &ReportFile{
+		Reader:      verifyChecksum(reader, attachment.Checksum),
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Checksum:    attachment.Checksum,
+	}, nil
+}
+
+// DeleteAttachment удаляет приложенный файл. Файл в хранилище удаляется после записи в БД:
+// при ошибке в хранилище отчет не ссылается на удаленный файл
+func (s *AttachmentServiceImpl) DeleteAttachment(ctx context.Context, reportID, id uint) error {
+	attachment, err := s.getAttachment(ctx, reportID, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.Delete(ctx, reportID, id); err != nil {
+		return fmt.Errorf("ошибка удаления приложенного файла: %w", err)
+	}
+	s.deleteFile(ctx, attachment.FileKey)
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"report_id":     reportID,
+		"attachment_id": id,
+	}).Info("Приложенный файл удален")
+	return nil
+}
+
+// getAttachment возвращает приложенный файл отчета
+func (s *AttachmentServiceImpl) getAttachment(ctx context.Context, reportID, id uint) (*models.ReportAttachment, error) {
+	attachment, err := s.repository.GetByID(ctx, reportID, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %d", ErrAttachmentNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения приложенного файла: %w", err)
+	}
+	return attachment, nil
+}
+
+// deleteFile удаляет файл из хранилища, ошибка только записывается в лог
+func (s *AttachmentServiceImpl) deleteFile(ctx context.Context, key string) {
+	if err := s.fileStorage.Delete(ctx, key); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("file_key", key).Warn("Ошибка удаления приложенного файла из хранилища")
+	}
+}
+
+// attachmentKey возвращает ключ приложенного файла рядом с файлами отчета
+func attachmentKey(reportID uint, filename string) string {
+	name := storage.KeySegment(strings.TrimSuffix(filename, path.Ext(filename)))
+	if name == "" {
+		name = "attachment"
+	}
+	if extension := storage.KeySegment(path.Ext(filename)); extension != "" {
+		name += "." + extension
+	}
+	return fmt.Sprintf("reports/%d/attachments/%d_%s", reportID, time.Now().UnixNano(), name)
+}
+
+// limitedReader возвращает ErrAttachmentTooLarge, если прочитано больше remaining байт
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		r.exceeded = true
+		return n, ErrAttachmentTooLarge
+	}
+	return n, err
+}
+
+// checkBundleAttachments возвращает errBundleAttachments, если к одному из отчетов приложены
+// файлы. Файлы прикладываются после создания отчета, поэтому не входят в ключ повторного
+// использования файла и проверяются перед копированием архива.
+func (e *ReportTaskExecutor) checkBundleAttachments(ctx context.Context, reportIDs ...uint) error {
+	if e.attachments == nil {
+		return nil
+	}
+	for _, id := range reportIDs {
+		attachments, err := e.attachments.ListByReport(ctx, id)
+		if err != nil {
+			return fmt.Errorf("ошибка получения приложенных файлов отчета: %w", err)
+		}
+		if len(attachments) > 0 {
+			return fmt.Errorf("%w: отчет %d", errBundleAttachments, id)
+		}
+	}
+	return nil
+}
+
+// attachmentFiles открывает приложенные к отчету файлы для ZIP архива
+func attachmentFiles(attachments []models.ReportAttachment, fileStorage ReportFileStorage) []AttachmentFile {
+	files := make([]AttachmentFile, len(attachments))
+	for i, attachment := range attachments {
+		key, checksum := attachment.FileKey, attachment.Checksum
+		files[i] = AttachmentFile{
+			Name: attachment.Filename,
+			Open: func(ctx context.Context) (io.ReadCloser, error) {
+				reader, err := fileStorage.Get(ctx, key)
+				if err != nil {
+					return nil, err
+				}
+				return verifyChecksum(reader, checksum), nil
+			},
+		}
+	}
+	return files
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachmentService(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+	fileStorage := NewReportFileStorage(local, logger)
+	repository := NewGormReportRepository(db, logger)
+	attachments := NewGormAttachmentRepository(db, logger)
+	service := NewAttachmentService(attachments, repository, fileStorage, config.Attachments{MaxSize: 16, MaxCount: 2}, logger)
+
+	report := &models.Report{Title: "Продажи", Status: models.StatusPending, Format: models.FormatZIP,
+		Parameters: models.JSON{models.ParamBundle: []interface{}{"csv", "html"}},
+		CreatedBy:  "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+
+	upload := func(name, content string, size int64) (*models.ReportAttachment, error) {
+		return service.AddAttachment(ctx, report.ID, AttachmentUpload{Filename: name, Size: size, Reader: strings.NewReader(content)})
+	}
+
+	attachment, err := upload("methodology.pdf", "%PDF-1.7", -1)
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", attachment.ContentType)
+	assert.Equal(t, int64(8), attachment.Size)
+
+	// Размер проверяется и по заявленному, и по фактически прочитанному
+	_, err = upload("raw.csv", "a", 100)
+	assert.ErrorIs(t, err, ErrAttachmentTooLarge)
+	_, err = upload("raw.csv", strings.Repeat("a", 17), -1)
+	assert.ErrorIs(t, err, ErrAttachmentTooLarge)
+
+	_, err = upload("../raw.csv", "a", -1)
+	assert.ErrorIs(t, err, ErrInvalidAttachment)
+	_, err = upload("methodology.pdf", "a", -1)
+	assert.ErrorIs(t, err, ErrInvalidAttachment)
+	_, err = service.AddAttachment(ctx, 999, AttachmentUpload{Filename: "raw.csv", Reader: strings.NewReader("a")})
+	assert.ErrorIs(t, err, ErrReportNotFound)
+
+	_, err = upload("raw.csv", "region\nnorth\n", -1)
+	require.NoError(t, err)
+	_, err = upload("extra.txt", "a", -1)
+	assert.ErrorIs(t, err, ErrAttachmentLimit)
+
+	file, err := service.OpenAttachment(ctx, report.ID, attachment.ID)
+	require.NoError(t, err)
+	content, err := io.ReadAll(file.Reader)
+	require.NoError(t, err)
+	require.NoError(t, file.Reader.Close())
+	assert.Equal(t, "%PDF-1.7", string(content))
+	assert.Equal(t, "methodology.pdf", file.Filename)
+
+	// Приложенные файлы попадают в архив после файлов отчета
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), fileStorage, logger).WithAttachments(attachments)
+	require.NoError(t, executor.Execute(ctx, Task{ID: "report_1", Type: TaskTypeReportGeneration, Data: report.ID}))
+
+	reports := newTestReportService(t, db, local, logger)
+	completed, err := reports.GetReport(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, completed.Status)
+	require.Len(t, completed.Attachments, 2)
+	require.Len(t, completed.Bundle, 4)
+	assert.Empty(t, completed.Bundle[2].Format)
+	assert.Equal(t, "attachments/methodology.pdf", completed.Bundle[2].Filename)
+
+	stored, err := local.Get(ctx, completed.FileKey)
+	require.NoError(t, err)
+	archived, err := io.ReadAll(stored)
+	require.NoError(t, err)
+	stored.Close()
+	archive, err := zip.NewReader(bytes.NewReader(archived), int64(len(archived)))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 4)
+	assert.Equal(t, "attachments/raw.csv", archive.File[3].Name)
+
+	// Приложенные файлы удаляются вместе с отчетом
+	require.NoError(t, reports.DeleteReport(ctx, report.ID))
+	remaining, err := service.ListAttachments(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+	_, err = service.OpenAttachment(ctx, report.ID, attachment.ID)
+	assert.ErrorIs(t, err, ErrAttachmentNotFound)
+}
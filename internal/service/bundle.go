@@ -0,0 +1,271 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+// BundleReportGenerator собирает ZIP архив из файлов нескольких форматов, перечисленных
+// в параметре bundle. Каждый файл генерируется своим генератором по заново загруженным
+// данным, приложенные к отчету файлы добавляются в папку attachments. Состав архива
+// записывается в ReportData.Bundle.
+type BundleReportGenerator struct {
+	generators FormatGenerators
+	logger     logging.Logger
+}
+
+// NewBundleReportGenerator создает генератор архивов из файлов форматов набора
+func NewBundleReportGenerator(generators FormatGenerators, logger logging.Logger) ReportGenerator {
+	return &BundleReportGenerator{generators: generators, logger: logger}
+}
+
+// withBundle добавляет в набор генератор архивов из файлов остальных его форматов
+func withBundle(generators FormatGenerators, logger logging.Logger) FormatGenerators {
+	generators[models.FormatZIP] = NewBundleReportGenerator(generators, logger)
+	return generators
+}
+
+// Generate запускает потоковую генерацию архива. Файлы генерируются по очереди
+// и пишутся в архив по мере генерации. Закрытие возвращенного reader прерывает генерацию.
+func (g *BundleReportGenerator) Generate(ctx context.Context, report *models.Report, data *ReportData) (io.Reader, string, error) {
+	formats, ok, err := report.BundleFormats()
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("не задан параметр %s со списком форматов архива", models.ParamBundle)
+	}
+	generators := make([]ReportGenerator, len(formats))
+	for i, format := range formats {
+		if generators[i], err = g.generators.ForFormat(format); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(formats) > 1 && data.Reload == nil {
+		return nil, "", fmt.Errorf("данные отчета нельзя загрузить повторно для нескольких файлов архива")
+	}
+
+	logger := logging.FromContext(ctx, g.logger).WithFields(logging.Fields{
+		"report_id": report.ID,
+		"title":     report.Title,
+		"formats":   formats,
+	})
+
+	logger.Info("Генерация архива отчета")
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		manifest, err := g.writeBundle(ctx, pw, report, data, formats, generators)
+		if err != nil {
+			logger.WithError(err).Error("Ошибка записи архива отчета")
+			pw.CloseWithError(fmt.Errorf("ошибка генерации архива отчета: %w", err))
+			return
+		}
+		data.Bundle = manifest
+		logger.WithField("files", len(manifest)).Info("Архив отчета сгенерирован успешно")
+		pw.Close()
+	}()
+
+	filename := fmt.Sprintf("report_%d_%s.zip", report.ID, report.LocalTime(time.Now()).Format("20060102_150405"))
+	return pr, filename, nil
+}
+
+// writeBundle записывает файлы всех форматов в архив и возвращает его состав.
+// Первый файл строится по переданным данным, остальные - по загруженным заново.
+func (g *BundleReportGenerator) writeBundle(ctx context.Context, w io.Writer, report *models.Report, data *ReportData, formats []models.ReportFormat, generators []ReportGenerator) (models.BundleManifest, error) {
+	archive := zip.NewWriter(w)
+	manifest := make(models.BundleManifest, 0, len(generators))
+
+	for i, generator := range generators {
+		current := data
+		if i > 0 {
+			reloaded, err := data.Reload(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("ошибка повторной загрузки данных отчета: %w", err)
+			}
+			current = reloaded
+		}
+
+		artifact, err := writeBundleEntry(ctx, archive, report, current, formats[i], generator)
+		if i > 0 {
+			current.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, artifact)
+	}
+
+	// Приложенные файлы идут в архив после файлов отчета
+	for _, attachment := range data.Attachments {
+		artifact, err := writeBundleAttachment(ctx, archive, attachment)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка добавления файла %s в архив: %w", attachment.Name, err)
+		}
+		manifest = append(manifest, artifact)
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeBundleEntry генерирует файл одного формата и записывает его в архив.
+// Уже сжатые форматы сохраняются в архиве без повторного сжатия.
+func writeBundleEntry(ctx context.Context, archive *zip.Writer, report *models.Report, data *ReportData, format models.ReportFormat, generator ReportGenerator) (models.BundleArtifact, error) {
+	reader, filename, err := generator.Generate(ctx, report, data)
+	if err != nil {
+		return models.BundleArtifact{}, fmt.Errorf("ошибка генерации файла %s: %w", format, err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	method := zip.Deflate
+	if format.IsCompressed() {
+		method = zip.Store
+	}
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: filename, Method: method, Modified: time.Now()})
+	if err != nil {
+		return models.BundleArtifact{}, err
+	}
+
+	checksum := newChecksumReader(reader)
+	if _, err := io.Copy(entry, checksum); err != nil {
+		return models.BundleArtifact{}, fmt.Errorf("ошибка генерации файла %s: %w", format, err)
+	}
+	return models.BundleArtifact{
+		Format:   format,
+		Filename: filename,
+		Size:     checksum.Size(),
+		Checksum: checksum.Sum(),
+	}, nil
+}
+
+// writeBundleAttachment записывает приложенный к отчету файл в папку attachments архива
+func writeBundleAttachment(ctx context.Context, archive *zip.Writer, attachment AttachmentFile) (models.BundleArtifact, error) {
+	reader, err := attachment.Open(ctx)
+	if err != nil {
+		return models.BundleArtifact{}, err
+	}
+	defer reader.Close()
+
+	name := bundleAttachmentsDir + attachment.Name
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return models.BundleArtifact{}, err
+	}
+	checksum := newChecksumReader(reader)
+	if _, err := io.Copy(entry, checksum); err != nil {
+		return models.BundleArtifact{}, err
+	}
+	return models.BundleArtifact{Filename: name, Size: checksum.Size(), Checksum: checksum.Sum()}, nil
+}
+
+// GetMimeType возвращает MIME тип для ZIP архивов
+func (g *BundleReportGenerator) GetMimeType() string {
+	return "application/zip"
+}
+
+// GetFileExtension возвращает расширение файла для ZIP архива
+func (g *BundleReportGenerator) GetFileExtension() string {
+	return string(models.FormatZIP)
+}
+
+// GetReportArtifact возвращает файл одного формата из архива отчета формата zip или файл,
+// перестроенный по снимку данных. Архив скачивается во временный файл: для чтения ZIP
+// нужен произвольный доступ.
+func (s *ReportServiceImpl) GetReportArtifact(ctx context.Context, id uint, format models.ReportFormat) (*ReportFile, error) {
+	report, _, err := s.completedReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	artifact, ok := report.Bundle.Find(format)
+	if !ok {
+		if s.renditions != nil {
+			return s.openRendition(ctx, report, format)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrBundleArtifactNotFound, format)
+	}
+	logger := logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"report_id": id, "format": format})
+	if err := s.archive.ensureReadable(ctx, report, logger); err != nil {
+		return nil, err
+	}
+
+	reader, err := s.fileStorage.Get(ctx, report.FileKey)
+	if err != nil {
+		logger.WithError(err).WithField("file_key", report.FileKey).Error("Ошибка получения файла из хранилища")
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
+	}
+	defer reader.Close()
+
+	temp, err := os.CreateTemp("", "report-bundle-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания временного файла: %w", err)
+	}
+	release := func() {
+		temp.Close()
+		os.Remove(temp.Name())
+	}
+
+	size, err := io.Copy(temp, verifyChecksum(reader, report.Checksum))
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
+	}
+	entry, err := openBundleEntry(temp, size, artifact.Filename)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// Тип и расширение файла отключенного с тех пор формата неизвестны, он отдается как двоичный
+	contentType := "application/octet-stream"
+	filename := fmt.Sprintf("%s.%s", report.Title, format)
+	if generator, err := s.generators.ForFormat(format); err == nil {
+		contentType = generator.GetMimeType()
+		filename = reportFilename(report, generator)
+	}
+	return &ReportFile{
+		Reader:      &bundleEntryReader{ReadCloser: verifyChecksum(entry, artifact.Checksum), release: release},
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        artifact.Size,
+		Checksum:    artifact.Checksum,
+	}, nil
+}
+
+// openBundleEntry открывает файл архива по имени
+func openBundleEntry(archive io.ReaderAt, size int64, name string) (io.ReadCloser, error) {
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения архива отчета: %w", err)
+	}
+	for _, file := range reader.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrBundleArtifactNotFound, name)
+}
+
+// bundleEntryReader файл из архива, при закрытии удаляет временную копию архива
+type bundleEntryReader struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *bundleEntryReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
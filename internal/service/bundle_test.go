@@ -0,0 +1,139 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// bundleTestData данные отчета, которые можно загрузить повторно
+func bundleTestData() *ReportData {
+	load := func() *ReportData {
+		return &ReportData{Datasets: []Dataset{{Name: "sales", Rows: &sliceRows{
+			columns: []string{"region", "amount"},
+			rows:    [][]interface{}{{"north", 1200}, {"south", 800}},
+		}}}}
+	}
+	data := load()
+	data.Reload = func(context.Context) (*ReportData, error) { return load(), nil }
+	return data
+}
+
+func bundleTestReport() *models.Report {
+	return &models.Report{ID: 7, Title: "Продажи", Format: models.FormatZIP,
+		Parameters: models.JSON{models.ParamBundle: []interface{}{"CSV", "json", "csv"}}}
+}
+
+// generateBundle генерирует архив и возвращает его содержимое
+func generateBundle(t *testing.T, report *models.Report, data *ReportData) []byte {
+	reader, filename, err := NewFormatGenerators(setupTestLogger())[models.FormatZIP].Generate(context.Background(), report, data)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(filename, ".zip"))
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return content
+}
+
+func TestBundleReportGenerator(t *testing.T) {
+	data := bundleTestData()
+	content := generateBundle(t, bundleTestReport(), data)
+
+	// Повторы форматов убираются, каждый файл строится по полным данным
+	require.Len(t, data.Bundle, 2)
+	assert.Equal(t, models.FormatCSV, data.Bundle[0].Format)
+	assert.Equal(t, models.FormatJSON, data.Bundle[1].Format)
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 2)
+	for i, file := range archive.File {
+		assert.Equal(t, data.Bundle[i].Filename, file.Name)
+
+		entry, err := file.Open()
+		require.NoError(t, err)
+		body, err := io.ReadAll(entry)
+		require.NoError(t, err)
+		sum := sha256.Sum256(body)
+		assert.Equal(t, data.Bundle[i].Checksum, hex.EncodeToString(sum[:]))
+		assert.Equal(t, data.Bundle[i].Size, int64(len(body)))
+		assert.Contains(t, string(body), "south")
+	}
+}
+
+func TestBundleReportGeneratorRequiresReload(t *testing.T) {
+	data := bundleTestData()
+	data.Reload = nil
+	_, _, err := NewFormatGenerators(setupTestLogger())[models.FormatZIP].Generate(context.Background(), bundleTestReport(), data)
+	assert.Error(t, err)
+}
+
+func TestReportBundleValidation(t *testing.T) {
+	report := bundleTestReport()
+	report.Status, report.CreatedBy, report.UpdatedBy = models.StatusPending, "test-user", "test-user"
+	require.NoError(t, report.Validate())
+
+	// Архив без списка форматов и список форматов без архива отклоняются
+	report.Format = models.FormatCSV
+	assert.Error(t, report.Validate())
+	report.Format, report.Parameters = models.FormatZIP, models.JSON{}
+	assert.Error(t, report.Validate())
+
+	report.Parameters = models.JSON{models.ParamBundle: "csv,zip"}
+	assert.Error(t, report.Validate())
+}
+
+func TestGetReportArtifact(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	service := newTestReportService(t, db, mockStorage, setupTestLogger())
+
+	data := bundleTestData()
+	report := bundleTestReport()
+	content := generateBundle(t, report, data)
+	sum := sha256.Sum256(content)
+
+	stored := &models.Report{
+		Title:      report.Title,
+		Status:     models.StatusCompleted,
+		Format:     models.FormatZIP,
+		Parameters: report.Parameters,
+		FileKey:    "reports/sales.zip",
+		Checksum:   hex.EncodeToString(sum[:]),
+		Bundle:     data.Bundle,
+		CreatedBy:  "test-user",
+		UpdatedBy:  "test-user",
+	}
+	require.NoError(t, db.Create(stored).Error)
+	mockStorage.On("Get", mock.Anything, stored.FileKey).
+		Return(io.NopCloser(bytes.NewReader(content)), nil)
+
+	// Состав архива сохраняется в отчете
+	loaded, err := service.GetReport(context.Background(), stored.ID)
+	require.NoError(t, err)
+	assert.Equal(t, data.Bundle, loaded.Bundle)
+
+	file, err := service.GetReportArtifact(context.Background(), stored.ID, models.FormatJSON)
+	require.NoError(t, err)
+	body, err := io.ReadAll(file.Reader)
+	require.NoError(t, err)
+	require.NoError(t, file.Reader.Close())
+
+	assert.Equal(t, "Продажи.json", file.Filename)
+	assert.Equal(t, "application/json", file.ContentType)
+	assert.Equal(t, data.Bundle[1].Size, int64(len(body)))
+	assert.True(t, strings.HasPrefix(string(body), `[{"region":"north","amount":1200}`))
+
+	_, err = service.GetReportArtifact(context.Background(), stored.ID, models.FormatHTML)
+	assert.ErrorIs(t, err, ErrBundleArtifactNotFound)
+}
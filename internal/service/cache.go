@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ResultCachePolicy определяет повторное использование файлов отчетов по определениям:
+// отчет с тем же определением, форматом, названием и параметрами получает копию файла,
+// сгенерированного не раньше Freshness назад, без выполнения запросов
+type ResultCachePolicy struct {
+	// Freshness срок повторного использования файла, 0 - файлы не используются повторно
+	Freshness time.Duration
+	// Masking отпечаток правил маскирования из конфигурации (см. MaskingPolicy.Fingerprint)
+	Masking string
+	// Documents свойства документа и водяной знак по умолчанию (см. NewDocumentDefaults)
+	Documents *models.DocumentOptions
+}
+
+// NewResultCachePolicy создает политику повторного использования файлов из конфигурации
+func NewResultCachePolicy(cfg config.ResultCache, masking MaskingPolicy, documents *models.DocumentOptions) ResultCachePolicy {
+	if !cfg.Enabled {
+		return ResultCachePolicy{}
+	}
+	return ResultCachePolicy{Freshness: cfg.Freshness, Masking: masking.Fingerprint(), Documents: documents}
+}
+
+// Enabled сообщает, используются ли файлы повторно
+func (p ResultCachePolicy) Enabled() bool {
+	return p.Freshness > 0
+}
+
+// cacheIgnoredParameters параметры доставки и хранения файла, не влияющие на его содержимое
+var cacheIgnoredParameters = map[string]bool{
+	models.ParamEmailRecipients:      true,
+	models.ParamNotificationChannels: true,
+	models.ParamRetentionTTL:         true,
+}
+
+// reportCacheKey возвращает SHA-256 в hex от всего, что определяет содержимое файла отчета.
+// Время изменения определения входит в ключ, чтобы после правки запросов файлы не использовались.
+// Файлы без маскирования используются только для отчетов без маскирования, маскированные - пока
+// не изменились правила маскирования masking из конфигурации. Текст водяного знака watermark
+// с подставленными автором и датой входит в ключ, поэтому файл с водяным знаком другого
+// пользователя или другого дня не используется.
+func reportCacheKey(report *models.Report, definition *models.ReportDefinition, masking, watermark string) (string, error) {
+	parameters := make(map[string]interface{}, len(report.Parameters))
+	for key, value := range report.Parameters {
+		if !cacheIgnoredParameters[key] {
+			parameters[key] = value
+		}
+	}
+
+	if report.Unmasked {
+		masking = ""
+	}
+
+	// Ключи map сериализуются в порядке сортировки, поэтому JSON не зависит от порядка параметров
+	content, err := json.Marshal(struct {
+		Definition uint                   `json:"definition"`
+		Version    time.Time              `json:"version"`
+		Format     models.ReportFormat    `json:"format"`
+		Title      string                 `json:"title"`
+		Parameters map[string]interface{} `json:"parameters"`
+		Unmasked   bool                   `json:"unmasked,omitempty"`
+		Masking    string                 `json:"masking,omitempty"`
+		Watermark  string                 `json:"watermark,omitempty"`
+	}{definition.ID, definition.UpdatedAt.UTC(), report.Format, report.Title, parameters, report.Unmasked, masking, watermark})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// forceGenerationContextKey ключ признака обязательной генерации в контексте
+type forceGenerationContextKey struct{}
+
+// WithForceGeneration возвращает контекст создания отчета, для которого файл
+// генерируется заново, даже если есть подходящий недавний файл
+func WithForceGeneration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceGenerationContextKey{}, true)
+}
+
+// forceGeneration сообщает, запрошена ли обязательная генерация
+func forceGeneration(ctx context.Context) bool {
+	force, _ := ctx.Value(forceGenerationContextKey{}).(bool)
+	return force
+}
+
+// applyResultCache вычисляет ключ отчета по определению и находит готовый отчет с тем же
+// ключом, файл которого будет скопирован при генерации. Ошибки поиска не мешают созданию
+// отчета: он генерируется как обычно.
+func (s *ReportServiceImpl) applyResultCache(ctx context.Context, report *models.Report, definition *models.ReportDefinition, logger logging.Logger) {
+	watermark := reportWatermark(report, s.cache.Documents.Merge(definition.Document), time.Now())
+	key, err := reportCacheKey(report, definition, s.cache.Masking, watermark)
+	if err != nil {
+		logger.WithError(err).Warn("Не удалось вычислить ключ повторного использования файла отчета")
+		return
+	}
+	report.CacheKey = key
+	if forceGeneration(ctx) {
+		return
+	}
+
+	cached, err := s.repository.FindCached(ctx, key, time.Now().UTC().Add(-s.cache.Freshness))
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.WithError(err).Warn("Ошибка поиска отчета для повторного использования файла")
+		}
+		return
+	}
+	report.CachedFromID = &cached.ID
+	logger.WithField("cached_from_id", cached.ID).Info("Файл отчета будет скопирован из готового отчета с теми же параметрами")
+}
+
+// cachedFileExtension возвращает расширение файла вместе с расширением сжатия, например csv.gz
+func cachedFileExtension(fileKey string) string {
+	base := path.Base(fileKey)
+	if i := strings.Index(base, "."); i >= 0 {
+		return base[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportCacheKey(t *testing.T) {
+	definition := &models.ReportDefinition{ID: 1, UpdatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	report := &models.Report{Title: "Sales", Format: models.FormatCSV, Parameters: models.JSON{"region": "north", "limit": 10}}
+
+	key, err := reportCacheKey(report, definition, "", "")
+	require.NoError(t, err)
+	assert.Len(t, key, 64)
+
+	// Параметры доставки и хранения не меняют ключ
+	same := &models.Report{Title: "Sales", Format: models.FormatCSV, Parameters: models.JSON{
+		"limit": 10, "region": "north",
+		models.ParamEmailRecipients: []interface{}{"a@example.com"},
+		models.ParamRetentionTTL:    "1h",
+	}}
+	sameKey, err := reportCacheKey(same, definition, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, key, sameKey)
+
+	for _, changed := range []func(r *models.Report, d *models.ReportDefinition){
+		func(r *models.Report, d *models.ReportDefinition) { r.Parameters["region"] = "south" },
+		func(r *models.Report, d *models.ReportDefinition) { r.Format = models.FormatXLSX },
+		func(r *models.Report, d *models.ReportDefinition) { r.Title = "Other" },
+		func(r *models.Report, d *models.ReportDefinition) { d.UpdatedAt = d.UpdatedAt.Add(time.Second) },
+		func(r *models.Report, d *models.ReportDefinition) { r.Unmasked = true },
+	} {
+		r := &models.Report{Title: report.Title, Format: report.Format, Parameters: models.JSON{"region": "north", "limit": 10}}
+		d := *definition
+		changed(r, &d)
+		changedKey, err := reportCacheKey(r, &d, "", "")
+		require.NoError(t, err)
+		assert.NotEqual(t, key, changedKey)
+	}
+
+	// Правила маскирования из конфигурации меняют ключ только маскированных отчетов
+	maskedKey, err := reportCacheKey(report, definition, "rules", "")
+	require.NoError(t, err)
+	assert.NotEqual(t, key, maskedKey)
+	unmasked := &models.Report{Title: report.Title, Format: report.Format, Parameters: report.Parameters, Unmasked: true}
+	unmaskedKey, err := reportCacheKey(unmasked, definition, "", "")
+	require.NoError(t, err)
+	otherRulesKey, err := reportCacheKey(unmasked, definition, "rules", "")
+	require.NoError(t, err)
+	assert.Equal(t, unmaskedKey, otherRulesKey)
+
+	// Водяной знак с автором и датой меняет ключ
+	watermarkKey, err := reportCacheKey(report, definition, "", "john.doe 2024-01-01")
+	require.NoError(t, err)
+	assert.NotEqual(t, key, watermarkKey)
+
+	assert.Equal(t, "csv.gz", cachedFileExtension("reports/1/sales_20240101000000.csv.gz"))
+}
+
+func TestCreateReportReusesCachedFile(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := newTestDefinition()
+	require.NoError(t, NewDefinitionService(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), new(MockStorage), logger).CreateDefinition(ctx, definition))
+
+	mockStorage := new(MockStorage)
+	repository := NewGormReportRepository(db, logger)
+	service := NewReportService(repository, NewFormatGenerators(logger),
+		NewReportFileStorage(mockStorage, logger), &stubProcessor{}, events.NewInProcessBus(logger), logger).
+		WithDefinitions(definitions).
+		WithResultCache(ResultCachePolicy{Freshness: time.Hour})
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+
+	newReport := func(region string) *models.Report {
+		return &models.Report{Title: "Sales", Type: "sales", Parameters: models.JSON{"region": region}, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	}
+
+	// Первый отчет генерируется, его файл готов
+	first := newReport("north")
+	require.NoError(t, service.CreateReport(ctx, first))
+	assert.NotEmpty(t, first.CacheKey)
+	assert.Nil(t, first.CachedFromID)
+	generatedAt := time.Now().UTC()
+	require.NoError(t, db.Model(first).Updates(map[string]interface{}{
+		"status": models.StatusCompleted, "file_key": "reports/1/sales_20240101000000.xlsx",
+		"checksum": "abc", "file_size": 42, "generated_at": generatedAt,
+	}).Error)
+
+	// Отчет с теми же параметрами получает копию файла
+	second := newReport("north")
+	require.NoError(t, service.CreateReport(ctx, second))
+	require.NotNil(t, second.CachedFromID)
+	assert.Equal(t, first.ID, *second.CachedFromID)
+	assert.Equal(t, first.CacheKey, second.CacheKey)
+
+	mockStorage.On("Copy", mock.Anything, "reports/1/sales_20240101000000.xlsx", mock.MatchedBy(func(key string) bool {
+		return cachedFileExtension(key) == "xlsx"
+	})).Return(nil).Once()
+	require.NoError(t, executor.generateReport(ctx, second.ID))
+	mockStorage.AssertExpectations(t)
+
+	stored, err := repository.GetByID(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+	assert.Equal(t, "abc", stored.Checksum)
+	assert.Equal(t, int64(42), stored.FileSize)
+	assert.NotEqual(t, "reports/1/sales_20240101000000.xlsx", stored.FileKey)
+
+	// Другие параметры, force и устаревший файл не используют копию
+	other := newReport("south")
+	require.NoError(t, service.CreateReport(ctx, other))
+	assert.Nil(t, other.CachedFromID)
+
+	forced := newReport("north")
+	require.NoError(t, service.CreateReport(WithForceGeneration(ctx), forced))
+	assert.Nil(t, forced.CachedFromID)
+
+	require.NoError(t, db.Model(&models.Report{}).Where("cache_key = ?", first.CacheKey).
+		Update("generated_at", generatedAt.Add(-2*time.Hour)).Error)
+	stale := newReport("north")
+	require.NoError(t, service.CreateReport(ctx, stale))
+	assert.Nil(t, stale.CachedFromID)
+}
+
+func TestExecutorGeneratesWhenCachedFileUnavailable(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+	mockStorage := new(MockStorage)
+
+	source := createCompletedReport(t, db, "reports/1/source.csv", nil)
+	report := &models.Report{Title: "Report", Format: models.FormatCSV, CachedFromID: &source.ID, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	repository := NewGormReportRepository(db, logger)
+	require.NoError(t, repository.Create(ctx, report))
+
+	mockStorage.On("Copy", mock.Anything, source.FileKey, mock.Anything).Return(errors.New("storage unavailable")).Once()
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+	require.NoError(t, executor.generateReport(ctx, report.ID))
+	mockStorage.AssertExpectations(t)
+
+	stored, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+	assert.Nil(t, stored.CachedFromID)
+}
+
+func TestExecutorRebuildsBundleWithAttachments(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+	repository := NewGormReportRepository(db, logger)
+	attachments := NewGormAttachmentRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(local, logger), logger).
+		WithAttachments(attachments)
+
+	newBundle := func(cachedFromID *uint) *models.Report {
+		report := &models.Report{Title: "Продажи", Status: models.StatusPending, Format: models.FormatZIP,
+			Parameters:   models.JSON{models.ParamBundle: []interface{}{"csv"}},
+			CachedFromID: cachedFromID, CreatedBy: "test-user", UpdatedBy: "test-user"}
+		require.NoError(t, repository.Create(ctx, report))
+		return report
+	}
+	attach := func(report *models.Report, name string) {
+		key := "attachments/" + name
+		require.NoError(t, local.Save(ctx, key, strings.NewReader("%PDF-1.7")))
+		require.NoError(t, attachments.Create(ctx, &models.ReportAttachment{
+			ReportID: report.ID, Filename: name, ContentType: "application/pdf", Size: 8, FileKey: key, CreatedBy: "test-user",
+		}))
+	}
+	archiveFiles := func(report *models.Report) []string {
+		stored, err := repository.GetByID(ctx, report.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusCompleted, stored.Status)
+		assert.Nil(t, stored.CachedFromID)
+
+		file, err := local.Get(ctx, stored.FileKey)
+		require.NoError(t, err)
+		content, err := io.ReadAll(file)
+		require.NoError(t, err)
+		file.Close()
+		archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		require.NoError(t, err)
+		names := make([]string, 0, len(archive.File))
+		for _, entry := range archive.File {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	// Архив с приложенными файлами исходного отчета не копируется в другой отчет
+	source := newBundle(nil)
+	attach(source, "methodology.pdf")
+	require.NoError(t, executor.generateReport(ctx, source.ID))
+	assert.Contains(t, archiveFiles(source), "attachments/methodology.pdf")
+
+	report := newBundle(&source.ID)
+	require.NoError(t, executor.generateReport(ctx, report.ID))
+	assert.NotContains(t, archiveFiles(report), "attachments/methodology.pdf")
+
+	// Приложенные к новому отчету файлы попадают в собранный заново архив
+	plain := newBundle(nil)
+	require.NoError(t, executor.generateReport(ctx, plain.ID))
+	withAttachment := newBundle(&plain.ID)
+	attach(withAttachment, "appendix.pdf")
+	require.NoError(t, executor.generateReport(ctx, withAttachment.ID))
+	assert.Contains(t, archiveFiles(withAttachment), "attachments/appendix.pdf")
+}
+
+func TestCreateReportCachedFileWithUserWatermark(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := newTestDefinition()
+	definition.Document = &models.DocumentOptions{Watermark: "Выгрузил {user} {date}"}
+	require.NoError(t, NewDefinitionService(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), new(MockStorage), logger).CreateDefinition(ctx, definition))
+
+	service := NewReportService(NewGormReportRepository(db, logger), NewFormatGenerators(logger),
+		NewReportFileStorage(new(MockStorage), logger), &stubProcessor{}, events.NewInProcessBus(logger), logger).
+		WithDefinitions(definitions).
+		WithResultCache(ResultCachePolicy{Freshness: time.Hour})
+
+	create := func(user string) *models.Report {
+		report := &models.Report{Title: "Sales", Type: "sales", Parameters: models.JSON{"region": "north"}, CreatedBy: user, UpdatedBy: user}
+		require.NoError(t, service.CreateReport(ctx, report))
+		return report
+	}
+
+	first := create("alice")
+	require.NoError(t, db.Model(first).Updates(map[string]interface{}{
+		"status": models.StatusCompleted, "file_key": "reports/1/sales_20240101000000.xlsx", "generated_at": time.Now().UTC(),
+	}).Error)
+
+	// Файл с водяным знаком одного пользователя не копируется в отчет другого
+	other := create("bob")
+	assert.Nil(t, other.CachedFromID)
+	assert.NotEqual(t, first.CacheKey, other.CacheKey)
+
+	same := create("alice")
+	require.NotNil(t, same.CachedFromID)
+	assert.Equal(t, first.ID, *same.CachedFromID)
+
+	// Водяной знак из настроек documents учитывается так же
+	definition.Document = nil
+	require.NoError(t, db.Model(definition).Update("document", nil).Error)
+	service.WithResultCache(ResultCachePolicy{Freshness: time.Hour, Documents: &models.DocumentOptions{Watermark: "{user}"}})
+	defaultFirst := create("alice")
+	require.NoError(t, db.Model(defaultFirst).Updates(map[string]interface{}{
+		"status": models.StatusCompleted, "file_key": "reports/2/sales_20240101000000.xlsx", "generated_at": time.Now().UTC(),
+	}).Error)
+	assert.Nil(t, create("bob").CachedFromID)
+	require.NotNil(t, create("alice").CachedFromID)
+}
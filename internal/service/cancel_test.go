@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelingHook отменяет отчет, пока его файл сохраняется: после первого блока
+// содержимого или после последнего
+type cancelingHook struct {
+	cancel  func()
+	atStart bool
+}
+
+func (h *cancelingHook) BeforeStore(ctx context.Context, report *models.Report, file *GeneratedFile) error {
+	source := file.Reader
+	started := false
+	file.Reader = readerFunc(func(p []byte) (int, error) {
+		if h.atStart && started {
+			h.cancel()
+		}
+		started = true
+		// Маленькие блоки, чтобы хранилище проверяло отмену между ними
+		n, err := source.Read(p[:min(len(p), 8)])
+		if err == io.EOF && !h.atStart {
+			h.cancel()
+		}
+		return n, err
+	})
+	return nil
+}
+
+// readerFunc адаптирует функцию к io.Reader
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// storedFiles возвращает файлы в каталоге локального хранилища
+func storedFiles(t *testing.T, basePath string) []string {
+	var files []string
+	err := filepath.WalkDir(basePath, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			files = append(files, strings.TrimPrefix(path, basePath))
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func TestCancelReportDuringGeneration(t *testing.T) {
+	tests := []struct {
+		name string
+		// atStart отмена приходит, пока файл пишется, иначе - после записи файла до смены статуса
+		atStart bool
+		// detached отмена меняет только статус отчета, контекст генерации не отменяется,
+		// как при отмене на другом экземпляре сервиса
+		detached bool
+	}{
+		{name: "во время записи файла", atStart: true},
+		{name: "после записи файла", atStart: false},
+		{name: "на другом экземпляре", atStart: false, detached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			logger := setupTestLogger()
+			ctx := context.Background()
+
+			basePath := t.TempDir()
+			local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: basePath, Permissions: 0o755, CreateDirs: true}, logger)
+			require.NoError(t, err)
+			repository := NewGormReportRepository(db, logger)
+			generators := NewFormatGenerators(logger)
+			fileStorage := NewReportFileStorage(local, logger)
+
+			hook := &cancelingHook{atStart: tt.atStart}
+			executor := NewReportTaskExecutor(repository, generators, fileStorage, logger).
+				WithHooks(NewPipelineHooks(nil, nil, []BeforeStoreHook{hook}))
+			processor := NewSyncBackgroundProcessorWithExecutor(executor, logger).(*SyncBackgroundProcessor)
+			var canceler BackgroundProcessor = processor
+			if tt.detached {
+				canceler = &stubProcessor{}
+			}
+			reports := NewReportService(repository, generators, fileStorage, canceler, events.NewInProcessBus(logger), logger)
+
+			report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV,
+				CreatedBy: "test-user", UpdatedBy: "test-user"}
+			require.NoError(t, db.Create(report).Error)
+			hook.cancel = func() {
+				assert.NoError(t, reports.CancelReportGeneration(ctx, report.ID))
+				hook.cancel = func() {}
+			}
+
+			task := Task{ID: reportTaskID(report.ID), Type: TaskTypeReportGeneration, Data: report.ID, Timeout: time.Minute}
+			require.NoError(t, processor.SubmitTask(ctx, task))
+			processor.processTask(<-processor.tasks)
+
+			// Отчет остается отмененным, задача не повторяется, файл не остается в хранилище
+			canceled, err := repository.GetByID(ctx, report.ID)
+			require.NoError(t, err)
+			assert.Equal(t, models.StatusCanceled, canceled.Status)
+			assert.Empty(t, canceled.FileKey)
+			assert.Equal(t, TaskStatusCanceled, processor.GetTaskStatus(task.ID))
+			assert.Empty(t, storedFiles(t, basePath))
+		})
+	}
+}
+
+func TestStartAttemptSkipsCanceledReport(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+	repository := NewGormReportRepository(db, setupTestLogger())
+
+	// Попытка начинается для ожидающего отчета и для повтора после временной ошибки
+	for _, status := range []models.ReportStatus{models.StatusPending, models.StatusProcessing} {
+		report := &models.Report{Title: "Sales", Status: status, CreatedBy: "test-user", UpdatedBy: "test-user"}
+		require.NoError(t, db.Create(report).Error)
+		started, err := repository.StartAttempt(ctx, report.ID, 3)
+		require.NoError(t, err)
+		assert.True(t, started, status)
+	}
+
+	// Отмененный отчет не переводится обратно в processing
+	report := &models.Report{Title: "Sales", Status: models.StatusCanceled, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+	started, err := repository.StartAttempt(ctx, report.ID, 3)
+	require.NoError(t, err)
+	assert.False(t, started)
+	stored, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCanceled, stored.Status)
+	assert.Zero(t, stored.Attempts)
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+// ErrChannelHostNotAllowed хост вебхука канала не входит в channels.allowed_hosts
+var ErrChannelHostNotAllowed = errors.New("хост вебхука канала не разрешен")
+
+// ChannelMessage сообщение в канал о готовом или упавшем отчете
+type ChannelMessage struct {
+	Event  models.ChannelEvent
+	Report *models.Report
+	// DownloadURL временная ссылка на файл готового отчета. Пустая - ссылку получить не удалось
+	DownloadURL   string
+	LinkExpiresAt time.Time
+}
+
+// Title возвращает заголовок сообщения
+func (m ChannelMessage) Title() string {
+	if m.Event == models.ChannelEventFailed {
+		return fmt.Sprintf("Ошибка генерации отчета «%s»", m.Report.Title)
+	}
+	return fmt.Sprintf("Отчет «%s» готов", m.Report.Title)
+}
+
+// Text возвращает текст сообщения без ссылки на файл
+func (m ChannelMessage) Text() string {
+	if m.Event == models.ChannelEventFailed {
+		reason := m.Report.ErrorMessage
+		if reason == "" {
+			reason = string(m.Report.ErrorCode)
+		}
+		return fmt.Sprintf("Генерация отчета #%d завершилась ошибкой: %s", m.Report.ID, reason)
+	}
+	text := fmt.Sprintf("Отчет #%d сгенерирован в формате %s.", m.Report.ID, m.Report.Format)
+	if m.DownloadURL != "" {
+		text += fmt.Sprintf(" Ссылка на файл действительна до %s.", m.LinkExpiresAt.Format(time.RFC1123))
+	}
+	return text
+}
+
+// ChannelPoster публикует сообщение во входящий вебхук мессенджера
+type ChannelPoster interface {
+	Post(ctx context.Context, webhookURL string, message ChannelMessage) error
+}
+
+// SlackPoster публикует сообщения во входящие вебхуки Slack
+type SlackPoster struct {
+	client *http.Client
+}
+
+// NewSlackPoster создает публикацию сообщений в Slack
+func NewSlackPoster(client *http.Client) *SlackPoster {
+	return &SlackPoster{client: client}
+}
+
+// Post публикует сообщение с разметкой Slack: заголовок жирным и ссылка на файл
+func (p *SlackPoster) Post(ctx context.Context, webhookURL string, message ChannelMessage) error {
+	text := fmt.Sprintf("*%s*\n%s", slackEscape(message.Title()), slackEscape(message.Text()))
+	if message.DownloadURL != "" {
+		text += fmt.Sprintf("\n<%s|Скачать файл>", message.DownloadURL)
+	}
+	return postWebhook(ctx, p.client, webhookURL, map[string]string{"text": text})
+}
+
+// slackEscape экранирует управляющие символы разметки Slack
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// TeamsPoster публикует сообщения во входящие вебхуки и workflow Microsoft Teams
+type TeamsPoster struct {
+	client *http.Client
+}
+
+// NewTeamsPoster создает публикацию сообщений в Microsoft Teams
+func NewTeamsPoster(client *http.Client) *TeamsPoster {
+	return &TeamsPoster{client: client}
+}
+
+// Post публикует сообщение адаптивной карточкой с кнопкой скачивания файла
+func (p *TeamsPoster) Post(ctx context.Context, webhookURL string, message ChannelMessage) error {
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []map[string]interface{}{
+			{"type": "TextBlock", "text": message.Title(), "weight": "Bolder", "size": "Medium", "wrap": true},
+			{"type": "TextBlock", "text": message.Text(), "wrap": true},
+		},
+	}
+	if message.DownloadURL != "" {
+		card["actions"] = []map[string]interface{}{
+			{"type": "Action.OpenUrl", "title": "Скачать файл", "url": message.DownloadURL},
+		}
+	}
+
+	return postWebhook(ctx, p.client, webhookURL, map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	})
+}
+
+// postWebhook отправляет JSON во входящий вебхук. Ответ не 2xx считается ошибкой
+func postWebhook(ctx context.Context, client *http.Client, webhookURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации сообщения: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса к вебхуку: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("ошибка отправки сообщения в вебхук: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("вебхук вернул статус %d", response.StatusCode)
+	}
+	return nil
+}
+
+// ChannelNotifier сообщает о готовых и упавших отчетах в каналы определения отчета
+// и каналы из параметра notification_channels. Ошибка одного канала не мешает остальным
+type ChannelNotifier struct {
+	posters        map[models.ChannelType]ChannelPoster
+	definitions    DefinitionRepository
+	fileStorage    ReportFileStorage
+	allowedHosts   []string
+	linkExpiration time.Duration
+	logger         logging.Logger
+}
+
+// NewChannelNotifier создает сообщения об отчетах в Slack и Microsoft Teams
+func NewChannelNotifier(
+	cfg config.Channels,
+	definitions DefinitionRepository,
+	fileStorage ReportFileStorage,
+	logger logging.Logger,
+) *ChannelNotifier {
+	client := &http.Client{Timeout: cfg.Timeout}
+	return &ChannelNotifier{
+		posters: map[models.ChannelType]ChannelPoster{
+			models.ChannelSlack: NewSlackPoster(client),
+			models.ChannelTeams: NewTeamsPoster(client),
+		},
+		definitions:    definitions,
+		fileStorage:    fileStorage,
+		allowedHosts:   cfg.AllowedHosts,
+		linkExpiration: cfg.LinkExpiration,
+		logger:         logger,
+	}
+}
+
+// WithPoster заменяет публикацию сообщений для мессенджера
+func (n *ChannelNotifier) WithPoster(channelType models.ChannelType, poster ChannelPoster) *ChannelNotifier {
+	n.posters[channelType] = poster
+	return n
+}
+
+// Notify публикует сообщение о готовом или упавшем отчете. Отчеты в других статусах
+// и отчеты без каналов пропускаются
+func (n *ChannelNotifier) Notify(ctx context.Context, report *models.Report) error {
+	var event models.ChannelEvent
+	switch report.Status {
+	case models.StatusCompleted:
+		event = models.ChannelEventCompleted
+	case models.StatusFailed:
+		event = models.ChannelEventFailed
+	default:
+		return nil
+	}
+
+	channels, err := n.channels(ctx, report, event)
+	if err != nil || len(channels) == 0 {
+		return err
+	}
+
+	logger := logging.FromContext(ctx, n.logger).WithFields(logging.Fields{
+		"report_id": report.ID,
+		"event":     event,
+	})
+	message := ChannelMessage{Event: event, Report: report}
+	if event == models.ChannelEventCompleted && report.HasFile() {
+		url, err := n.fileStorage.PresignedURL(ctx, report.FileKey, n.linkExpiration)
+		if err != nil {
+			logger.WithError(err).Warn("Ошибка получения ссылки на файл для сообщения в канал")
+		} else {
+			message.DownloadURL = url
+			message.LinkExpiresAt = time.Now().UTC().Add(n.linkExpiration)
+		}
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		if err := n.post(ctx, channel, message); err != nil {
+			errs = append(errs, fmt.Errorf("канал %s: %w", channel.Type, err))
+			continue
+		}
+		logger.WithField("channel", channel.Type).Info("Сообщение об отчете отправлено в канал")
+	}
+	return errors.Join(errs...)
+}
+
+// channels возвращает каналы определения и отчета, принимающие событие
+func (n *ChannelNotifier) channels(ctx context.Context, report *models.Report, event models.ChannelEvent) (models.NotificationChannels, error) {
+	var all models.NotificationChannels
+	if report.DefinitionID != nil {
+		definition, err := n.definitions.GetByID(ctx, *report.DefinitionID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения определения отчета: %w", err)
+		}
+		all = append(all, definition.NotificationChannels...)
+	}
+	own, err := report.NotificationChannels()
+	if err != nil {
+		return nil, err
+	}
+	all = append(all, own...)
+
+	accepted := all[:0]
+	for _, channel := range all {
+		if channel.Accepts(event) {
+			accepted = append(accepted, channel)
+		}
+	}
+	return accepted, nil
+}
+
+// post публикует сообщение в канал, если мессенджер поддерживается и хост вебхука разрешен
+func (n *ChannelNotifier) post(ctx context.Context, channel models.NotificationChannel, message ChannelMessage) error {
+	poster, ok := n.posters[channel.Type]
+	if !ok {
+		return fmt.Errorf("неподдерживаемый тип канала %q", channel.Type)
+	}
+	parsed, err := url.Parse(channel.WebhookURL)
+	if err != nil || parsed.Scheme != "https" {
+		return fmt.Errorf("неверный адрес вебхука")
+	}
+	if !channelHostAllowed(parsed.Hostname(), n.allowedHosts) {
+		return fmt.Errorf("%w: %s", ErrChannelHostNotAllowed, parsed.Hostname())
+	}
+	return poster.Post(ctx, channel.WebhookURL, message)
+}
+
+// channelHostAllowed проверяет хост по списку: точное совпадение или "*.example.com" для поддоменов
+func channelHostAllowed(host string, allowed []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChannelPoster struct {
+	urls     []string
+	messages []ChannelMessage
+}
+
+func (p *fakeChannelPoster) Post(ctx context.Context, webhookURL string, message ChannelMessage) error {
+	p.urls = append(p.urls, webhookURL)
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func TestNotificationChannelsValidate(t *testing.T) {
+	valid := models.NotificationChannels{
+		{Type: models.ChannelSlack, WebhookURL: "https://hooks.slack.com/services/T/B/X"},
+		{Type: models.ChannelTeams, WebhookURL: "https://contoso.webhook.office.com/x", Events: []models.ChannelEvent{models.ChannelEventFailed}},
+	}
+	assert.Empty(t, valid.Validate())
+
+	invalid := models.NotificationChannels{
+		{Type: "discord", WebhookURL: "http://hooks.example.com", Events: []models.ChannelEvent{"started"}},
+	}
+	assert.Len(t, invalid.Validate(), 3)
+
+	report := &models.Report{Parameters: models.JSON{models.ParamNotificationChannels: "slack"}}
+	_, err := report.NotificationChannels()
+	assert.Error(t, err)
+}
+
+func TestChannelNotifierPostsToDefinitionAndReportChannels(t *testing.T) {
+	_, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := &models.ReportDefinition{
+		Name:    "warehouse",
+		Queries: models.Queries{{Name: "main", SQL: "SELECT 1 AS n"}},
+		Format:  models.FormatXLSX,
+		NotificationChannels: models.NotificationChannels{
+			{Type: models.ChannelSlack, WebhookURL: "https://hooks.slack.com/services/T/B/X"},
+			{Type: models.ChannelTeams, WebhookURL: "https://contoso.webhook.office.com/failures", Events: []models.ChannelEvent{models.ChannelEventFailed}},
+		},
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("GetPresignedURL", mock.Anything, "reports/sales.xlsx", 24*time.Hour).Return("https://files.example.com/sales.xlsx", nil)
+
+	slack, teams := &fakeChannelPoster{}, &fakeChannelPoster{}
+	cfg := config.Channels{AllowedHosts: []string{"hooks.slack.com", "*.webhook.office.com"}, LinkExpiration: 24 * time.Hour}
+	notifier := NewChannelNotifier(cfg, definitions, NewReportFileStorage(mockStorage, logger), logger).
+		WithPoster(models.ChannelSlack, slack).
+		WithPoster(models.ChannelTeams, teams)
+
+	report := &models.Report{
+		ID:           7,
+		Title:        "Sales",
+		Status:       models.StatusCompleted,
+		Format:       models.FormatXLSX,
+		FileKey:      "reports/sales.xlsx",
+		DefinitionID: &definition.ID,
+		Parameters: models.JSON{models.ParamNotificationChannels: []interface{}{
+			map[string]interface{}{"type": "slack", "webhook_url": "https://hooks.slack.com/services/T/B/Y"},
+		}},
+	}
+	require.NoError(t, notifier.Notify(ctx, report))
+	assert.Equal(t, []string{"https://hooks.slack.com/services/T/B/X", "https://hooks.slack.com/services/T/B/Y"}, slack.urls)
+	assert.Empty(t, teams.urls)
+	assert.Equal(t, "https://files.example.com/sales.xlsx", slack.messages[0].DownloadURL)
+
+	// О падении сообщается во все каналы, ссылка на файл не запрашивается
+	report.Status = models.StatusFailed
+	report.ErrorMessage = "timeout"
+	require.NoError(t, notifier.Notify(ctx, report))
+	assert.Len(t, slack.urls, 4)
+	require.Len(t, teams.messages, 1)
+	assert.Empty(t, teams.messages[0].DownloadURL)
+	assert.Contains(t, teams.messages[0].Text(), "timeout")
+	mockStorage.AssertNumberOfCalls(t, "GetPresignedURL", 1)
+
+	// Хосты не из channels.allowed_hosts не вызываются
+	report.Parameters = models.JSON{models.ParamNotificationChannels: []interface{}{
+		map[string]interface{}{"type": "slack", "webhook_url": "https://10.0.0.1/hook"},
+	}}
+	err := notifier.Notify(ctx, report)
+	assert.ErrorIs(t, err, ErrChannelHostNotAllowed)
+	assert.Len(t, slack.urls, 5)
+
+	// Отчеты в других статусах пропускаются
+	report.Status = models.StatusProcessing
+	require.NoError(t, notifier.Notify(ctx, report))
+	assert.Len(t, slack.urls, 5)
+}
+
+func TestChannelPosters(t *testing.T) {
+	var payload map[string]interface{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		payload = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer api.Close()
+
+	message := ChannelMessage{
+		Event:         models.ChannelEventCompleted,
+		Report:        &models.Report{ID: 7, Title: "Sales <Q1>", Format: models.FormatXLSX},
+		DownloadURL:   "https://files.example.com/sales.xlsx",
+		LinkExpiresAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	require.NoError(t, NewSlackPoster(api.Client()).Post(context.Background(), api.URL, message))
+	text := payload["text"].(string)
+	assert.Contains(t, text, "*Отчет «Sales &lt;Q1&gt;» готов*")
+	assert.Contains(t, text, "<https://files.example.com/sales.xlsx|Скачать файл>")
+
+	require.NoError(t, NewTeamsPoster(api.Client()).Post(context.Background(), api.URL, message))
+	assert.Equal(t, "message", payload["type"])
+	attachment := payload["attachments"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", attachment["contentType"])
+	card := attachment["content"].(map[string]interface{})
+	action := card["actions"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "https://files.example.com/sales.xlsx", action["url"])
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	assert.Error(t, NewTeamsPoster(failing.Client()).Post(context.Background(), failing.URL, message))
+}
+
+func TestChannelHostAllowed(t *testing.T) {
+	allowed := []string{"hooks.slack.com", "*.webhook.office.com"}
+	assert.True(t, channelHostAllowed("hooks.slack.com", allowed))
+	assert.True(t, channelHostAllowed("Contoso.Webhook.Office.com", allowed))
+	assert.False(t, channelHostAllowed("webhook.office.com", allowed))
+	assert.False(t, channelHostAllowed("hooks.slack.com.evil.test", allowed))
+	assert.False(t, channelHostAllowed("localhost", nil))
+}
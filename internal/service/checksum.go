@@ -0,0 +1,75 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrChecksumMismatch файл отчета в хранилище поврежден или сохранен не полностью
+var ErrChecksumMismatch = errors.New("контрольная сумма файла отчета не совпадает")
+
+// checksumReader считает SHA-256 и размер файла по мере чтения
+type checksumReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	size   int64
+}
+
+// newChecksumReader создает reader, считающий SHA-256 прочитанного содержимого
+func newChecksumReader(reader io.Reader) *checksumReader {
+	return &checksumReader{reader: reader, hash: sha256.New()}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+	r.size += int64(n)
+	return n, err
+}
+
+// Sum возвращает SHA-256 прочитанного содержимого в hex
+func (r *checksumReader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// Size возвращает число прочитанных байт
+func (r *checksumReader) Size() int64 {
+	return r.size
+}
+
+// verifyingReader сверяет SHA-256 файла с сохраненной при генерации. При несовпадении
+// вместо io.EOF возвращается ErrChecksumMismatch, поэтому поврежденный или обрезанный
+// файл не отдается клиенту как полный.
+type verifyingReader struct {
+	*checksumReader
+	closer   io.Closer
+	expected string
+}
+
+// verifyChecksum оборачивает файл отчета проверкой контрольной суммы.
+// Файлы без сохраненной контрольной суммы отдаются без проверки.
+func verifyChecksum(reader io.ReadCloser, expected string) io.ReadCloser {
+	if expected == "" {
+		return reader
+	}
+	return &verifyingReader{checksumReader: newChecksumReader(reader), closer: reader, expected: expected}
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.checksumReader.Read(p)
+	if errors.Is(err, io.EOF) {
+		if sum := r.Sum(); sum != r.expected {
+			return n, fmt.Errorf("%w: ожидалось %s, получено %s", ErrChecksumMismatch, r.expected, sum)
+		}
+	}
+	return n, err
+}
+
+// Close закрывает файл хранилища
+func (r *verifyingReader) Close() error {
+	return r.closer.Close()
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecutorStoresChecksum(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV,
+		CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+
+	basePath := t.TempDir()
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: basePath, Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+
+	repository := NewGormReportRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(local, logger), logger)
+	require.NoError(t, executor.Execute(ctx, Task{ID: "report_1", Type: TaskTypeReportGeneration, Data: report.ID}))
+
+	completed, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(basePath, completed.FileKey))
+	require.NoError(t, err)
+	sum := sha256.Sum256(content)
+	assert.Equal(t, hex.EncodeToString(sum[:]), completed.Checksum)
+
+	service := newTestReportService(t, db, local, logger)
+	file, err := service.GetReportFile(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, completed.Checksum, file.Checksum)
+	downloaded, err := io.ReadAll(file.Reader)
+	require.NoError(t, file.Reader.Close())
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+
+	// Обрезанный файл не отдается как полный
+	require.NoError(t, os.WriteFile(filepath.Join(basePath, completed.FileKey), content[:len(content)-1], 0o644))
+	file, err = service.GetReportFile(ctx, report.ID)
+	require.NoError(t, err)
+	defer file.Reader.Close()
+	_, err = io.ReadAll(file.Reader)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+)
+
+// CompressionPolicy определяет сжатие файлов отчетов перед сохранением
+type CompressionPolicy struct {
+	// Default сжатие по умолчанию, пустое - без сжатия
+	Default models.Compression
+}
+
+// NewCompressionPolicy создает политику сжатия из конфигурации хранилища
+func NewCompressionPolicy(cfg config.Storage) CompressionPolicy {
+	return CompressionPolicy{Default: models.Compression(cfg.Compression)}
+}
+
+// For возвращает сжатие файла отчета. Сжатие из параметров отчета имеет приоритет над общим,
+// файлы форматов, которые уже сжаты, сохраняются без изменений.
+func (p CompressionPolicy) For(report *models.Report) models.Compression {
+	compression := p.Default
+	if reportCompression, ok, err := report.Compression(); err == nil && ok {
+		compression = reportCompression
+	}
+
+	format := report.Format
+	if format == "" {
+		format = models.DefaultFormat
+	}
+	if !compression.IsValid() || format.IsCompressed() {
+		return models.CompressionNone
+	}
+	return compression
+}
+
+// compressReader сжимает поток файла отчета по мере чтения. В ZIP архив файл
+// записывается под именем filename. Ошибка чтения исходного потока возвращается при чтении.
+func compressReader(reader io.Reader, compression models.Compression, filename string) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		var (
+			writer io.WriteCloser
+			err    error
+		)
+		switch compression {
+		case models.CompressionGzip:
+			gzipWriter := gzip.NewWriter(pw)
+			gzipWriter.Name = filename
+			writer = gzipWriter
+		case models.CompressionZip:
+			writer, err = newZipEntryWriter(pw, filename)
+		default:
+			err = fmt.Errorf("неподдерживаемое сжатие: %s", compression)
+		}
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := io.Copy(writer, reader); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if err := writer.Close(); err != nil {
+			pw.CloseWithError(fmt.Errorf("ошибка сжатия файла: %w", err))
+			return
+		}
+		pw.Close()
+	}()
+
+	return pr
+}
+
+// zipEntryWriter записывает один файл ZIP архива, Close завершает архив
+type zipEntryWriter struct {
+	io.Writer
+	archive *zip.Writer
+}
+
+// newZipEntryWriter создает архив с одним файлом filename
+func newZipEntryWriter(w io.Writer, filename string) (*zipEntryWriter, error) {
+	archive := zip.NewWriter(w)
+	entry, err := archive.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания ZIP архива: %w", err)
+	}
+	return &zipEntryWriter{Writer: entry, archive: archive}, nil
+}
+
+// Close завершает ZIP архив
+func (w *zipEntryWriter) Close() error {
+	return w.archive.Close()
+}
+
+// fileCompression определяет сжатие сохраненного файла отчета по расширению ключа
+func fileCompression(report *models.Report) models.Compression {
+	switch {
+	case strings.HasSuffix(report.FileKey, ".gz"):
+		return models.CompressionGzip
+	case strings.HasSuffix(report.FileKey, ".zip"):
+		return models.CompressionZip
+	default:
+		return models.CompressionNone
+	}
+}
+
+// downloadFile возвращает имя, тип и кодировку содержимого файла отчета для скачивания.
+// Файл, сжатый gzip, отдается с Content-Encoding и распаковывается клиентом,
+// ZIP архив отдается как есть.
+func downloadFile(report *models.Report, generator ReportGenerator) (filename, contentType, encoding string) {
+	switch fileCompression(report) {
+	case models.CompressionGzip:
+		return reportFilename(report, generator), generator.GetMimeType(), "gzip"
+	case models.CompressionZip:
+		filename, contentType = storedFile(report, generator)
+		return filename, contentType, ""
+	default:
+		return reportFilename(report, generator), generator.GetMimeType(), ""
+	}
+}
+
+// storedFile возвращает имя и тип файла отчета в том виде, в котором он сохранен в хранилище
+func storedFile(report *models.Report, generator ReportGenerator) (filename, contentType string) {
+	switch fileCompression(report) {
+	case models.CompressionGzip:
+		return reportFilename(report, generator) + ".gz", "application/gzip"
+	case models.CompressionZip:
+		return report.Title + ".zip", "application/zip"
+	default:
+		return reportFilename(report, generator), generator.GetMimeType()
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionPolicy(t *testing.T) {
+	policy := NewCompressionPolicy(config.Storage{Compression: "gzip"})
+
+	assert.Equal(t, models.CompressionGzip, policy.For(&models.Report{Format: models.FormatCSV}))
+	// XLSX и DOCX уже сжаты
+	assert.Equal(t, models.CompressionNone, policy.For(&models.Report{}))
+	assert.Equal(t, models.CompressionNone, policy.For(&models.Report{Format: models.FormatDOCX}))
+
+	// Параметр отчета имеет приоритет над общим сжатием
+	report := &models.Report{Format: models.FormatHTML, Parameters: models.JSON{models.ParamCompression: "zip"}}
+	assert.Equal(t, models.CompressionZip, policy.For(report))
+	report.Parameters[models.ParamCompression] = "none"
+	assert.Equal(t, models.CompressionNone, policy.For(report))
+
+	invalid := &models.Report{Title: "x", Status: models.StatusPending, Format: models.FormatXLSX, CreatedBy: "u", UpdatedBy: "u",
+		Parameters: models.JSON{models.ParamCompression: "gzip"}}
+	assert.ErrorContains(t, invalid.Validate(), "уже сжаты")
+	invalid.Format, invalid.Parameters[models.ParamCompression] = models.FormatCSV, "bzip2"
+	assert.ErrorContains(t, invalid.Validate(), "bzip2")
+}
+
+func TestExecutorCompressesReport(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV,
+		CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+
+	repository := NewGormReportRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(local, logger), logger).
+		WithCompression(CompressionPolicy{Default: models.CompressionGzip})
+	require.NoError(t, executor.Execute(ctx, Task{ID: "report_1", Type: TaskTypeReportGeneration, Data: report.ID}))
+
+	completed, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(completed.FileKey, ".csv.gz"), completed.FileKey)
+
+	// Файл отдается под исходным именем с кодировкой gzip
+	service := newTestReportService(t, db, local, logger)
+	file, err := service.GetReportFile(ctx, report.ID)
+	require.NoError(t, err)
+	defer file.Reader.Close()
+
+	assert.Equal(t, "Sales.csv", file.Filename)
+	assert.Equal(t, "text/csv; charset=utf-8", file.ContentType)
+	assert.Equal(t, "gzip", file.ContentEncoding)
+
+	decoded, err := gzip.NewReader(file.Reader)
+	require.NoError(t, err)
+	content, err := io.ReadAll(decoded)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), utf8BOM))
+}
+
+func TestCompressReader(t *testing.T) {
+	reader := compressReader(strings.NewReader("a;b\n1;2\n"), models.CompressionZip, "report.csv")
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	require.Len(t, archive.File, 1)
+	assert.Equal(t, "report.csv", archive.File[0].Name)
+
+	// Ошибка исходного потока возвращается при чтении сжатого
+	failure := errors.New("ошибка запроса")
+	reader = compressReader(io.MultiReader(strings.NewReader("a"), iotest.ErrReader(failure)), models.CompressionGzip, "report.csv")
+	_, err = io.ReadAll(reader)
+	assert.ErrorIs(t, err, failure)
+}
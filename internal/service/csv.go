@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+const (
+	// csvFlushInterval количество строк между сбросами буфера CSV writer
+	csvFlushInterval = 1000
+
+	// utf8BOM маркер порядка байтов, чтобы Excel корректно открывал кириллицу
+	utf8BOM = "\ufeff"
+)
+
+// RowIterator последовательно отдает строки данных отчета.
+// Next возвращает io.EOF, когда строки закончились.
+type RowIterator interface {
+	Columns() []string
+	Next() ([]interface{}, error)
+}
+
+// reportInfoColumns заголовки таблицы с информацией об отчете
+var reportInfoColumns = []string{"Параметр", "Значение"}
+
+// reportInfoRows итератор по сведениям об отчете и его параметрам
+type reportInfoRows struct {
+	rows [][]interface{}
+	pos  int
+}
+
+// newReportInfoRows создает итератор по сведениям об отчете
+func newReportInfoRows(report *models.Report) RowIterator {
+	rows := [][]interface{}{
+		{"ID отчета", report.ID},
+		{"Название", report.Title},
+		{"Описание", report.Description},
+		{"Статус", string(report.Status)},
+		{"Создал", report.CreatedBy},
+		{"Дата создания", report.LocalTime(report.CreatedAt).Format("2006-01-02 15:04:05")},
+	}
+
+	// Добавляем параметры в стабильном порядке
+	if report.Parameters != nil && !report.Parameters.IsEmpty() {
+		rows = append(rows, []interface{}{"--- Параметры ---", ""})
+		keys := report.Parameters.Keys()
+		sort.Strings(keys)
+		for _, key := range keys {
+			rows = append(rows, []interface{}{key, fmt.Sprintf("%v", report.Parameters[key])})
+		}
+	}
+
+	return &reportInfoRows{rows: rows}
+}
+
+// Columns возвращает заголовки колонок
+func (r *reportInfoRows) Columns() []string {
+	return reportInfoColumns
+}
+
+// Next возвращает следующую строку
+func (r *reportInfoRows) Next() ([]interface{}, error) {
+	if r.pos >= len(r.rows) {
+		return nil, io.EOF
+	}
+	row := r.rows[r.pos]
+	r.pos++
+	return row, nil
+}
+
+// CSVReportGenerator потоковый генератор CSV отчетов
+type CSVReportGenerator struct {
+	logger logging.Logger
+}
+
+// NewCSVReportGenerator создает новый генератор CSV отчетов
+func NewCSVReportGenerator(logger logging.Logger) ReportGenerator {
+	return &CSVReportGenerator{logger: logger}
+}
+
+func init() {
+	RegisterGenerator(models.FormatCSV, func(_ config.Config, logger logging.Logger) ReportGenerator {
+		return NewCSVReportGenerator(logger)
+	})
+}
+
+// Generate запускает потоковую генерацию CSV отчета.
+// Строки пишутся в pipe по мере чтения, поэтому файл целиком в памяти не хранится.
+// Закрытие возвращенного reader прерывает генерацию.
+func (g *CSVReportGenerator) Generate(ctx context.Context, report *models.Report, data *ReportData) (io.Reader, string, error) {
+	logger := logging.FromContext(ctx, g.logger).WithFields(logging.Fields{
+		"report_id": report.ID,
+		"title":     report.Title,
+	})
+
+	logger.Info("Генерация CSV отчета")
+
+	rows := data.Rows()
+	pr, pw := io.Pipe()
+
+	go func() {
+		count, err := g.writeRows(ctx, pw, rows)
+		if err != nil {
+			logger.WithError(err).Error("Ошибка записи CSV файла")
+			pw.CloseWithError(fmt.Errorf("ошибка генерации CSV файла: %w", err))
+			return
+		}
+		logger.WithField("rows", count).Info("CSV отчет сгенерирован успешно")
+		pw.Close()
+	}()
+
+	filename := fmt.Sprintf("report_%d_%s.csv", report.ID, report.LocalTime(time.Now()).Format("20060102_150405"))
+	return pr, filename, nil
+}
+
+// writeRows построчно записывает данные в writer
+func (g *CSVReportGenerator) writeRows(ctx context.Context, w io.Writer, rows RowIterator) (int, error) {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return 0, err
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(rows.Columns()); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	record := make([]string, 0, len(rows.Columns()))
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		record = record[:0]
+		for _, value := range row {
+			record = append(record, formatCSVValue(value))
+		}
+		if err := writer.Write(record); err != nil {
+			return count, err
+		}
+		count++
+
+		// Периодически сбрасываем буфер и проверяем отмену
+		if count%csvFlushInterval == 0 {
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				return count, err
+			}
+			if err := ctx.Err(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	writer.Flush()
+	return count, writer.Error()
+}
+
+// formatCSVValue преобразует значение ячейки в строку
+func formatCSVValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// GetMimeType возвращает MIME тип для CSV файлов
+func (g *CSVReportGenerator) GetMimeType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// GetFileExtension возвращает расширение файла для CSV
+func (g *CSVReportGenerator) GetFileExtension() string {
+	return "csv"
+}
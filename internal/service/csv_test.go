@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVReportGenerator(t *testing.T) {
+	generator := NewCSVReportGenerator(setupTestLogger())
+
+	report := &models.Report{
+		ID:         42,
+		Title:      "CSV Report",
+		Status:     models.StatusProcessing,
+		Format:     models.FormatCSV,
+		CreatedBy:  "test-user",
+		Parameters: models.JSON{"b": "2", "a": 1},
+	}
+
+	reportData, err := ReportInfoLoader{}.Load(context.Background(), report)
+	require.NoError(t, err)
+
+	reader, filename, err := generator.Generate(context.Background(), report, reportData)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(filename, ".csv"))
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), utf8BOM))
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), utf8BOM))).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, reportInfoColumns, records[0])
+	assert.Equal(t, []string{"ID отчета", "42"}, records[1])
+
+	// Параметры выводятся в отсортированном порядке
+	last := records[len(records)-2:]
+	assert.Equal(t, []string{"a", "1"}, last[0])
+	assert.Equal(t, []string{"b", "2"}, last[1])
+}
+
+func TestCSVReportGeneratorCloseStopsWriter(t *testing.T) {
+	generator := NewCSVReportGenerator(setupTestLogger())
+
+	report := &models.Report{ID: 1, Title: "x"}
+	reportData, err := ReportInfoLoader{}.Load(context.Background(), report)
+	require.NoError(t, err)
+
+	reader, _, err := generator.Generate(context.Background(), report, reportData)
+	require.NoError(t, err)
+
+	// Закрытие reader до чтения не должно блокировать генератор
+	closer, ok := reader.(io.Closer)
+	require.True(t, ok)
+	assert.NoError(t, closer.Close())
+}
+
+func TestFormatGenerators(t *testing.T) {
+	generators := NewFormatGenerators(setupTestLogger())
+
+	generator, err := generators.ForFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, "xlsx", generator.GetFileExtension())
+
+	generator, err = generators.ForFormat(models.FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, "csv", generator.GetFileExtension())
+
+	_, err = generators.ForFormat("pdf")
+	assert.Error(t, err)
+}
@@ -0,0 +1,519 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/template"
+
+	"gorm.io/gorm"
+)
+
+// reportInfoDataset имя набора со сведениями об отчете без определения
+const reportInfoDataset = "report"
+
+// Dataset именованный набор строк отчета, например результат одного запроса определения
+type Dataset struct {
+	Name string
+	Rows RowIterator
+	// Sheet лист Excel отчета для набора. Пустой - общий лист Report
+	Sheet string
+}
+
+// ReportData данные для генерации файла отчета.
+// После генерации должен быть вызван Close.
+type ReportData struct {
+	Datasets []Dataset
+	// Template содержимое шаблона определения, nil если шаблон не задан
+	Template []byte
+	// Layout оформление Excel отчета из определения, nil если не задано
+	Layout *models.ExcelLayout
+	// Locale локаль отчета из параметра locale, пустая - без локализации
+	Locale string
+	// Headers переводы заголовков колонок для локали отчета
+	Headers map[string]string
+	// Reload загружает данные отчета заново. Строки наборов читаются один раз, а архив
+	// формата zip строит по ним несколько файлов. nil - повторная загрузка недоступна
+	Reload func(ctx context.Context) (*ReportData, error)
+	// Bundle состав архива, заполняется генератором формата zip после записи файлов
+	Bundle models.BundleManifest
+	// Attachments приложенные к отчету файлы, которые архив zip включает в папку attachments
+	Attachments []AttachmentFile
+	// Document свойства документа и водяной знак файлов XLSX и DOCX, nil - файл не помечается
+	Document *models.DocumentOptions
+}
+
+// AttachmentFile приложенный к отчету файл для ZIP архива
+type AttachmentFile struct {
+	Name string
+	Open func(ctx context.Context) (io.ReadCloser, error)
+}
+
+// Header возвращает заголовок колонки для вывода в файл: перевод или имя колонки.
+// Оформление и шаблоны ссылаются на колонки по именам, поэтому переводятся только заголовки.
+func (d *ReportData) Header(column string) string {
+	if translation, ok := d.Headers[column]; ok && translation != "" {
+		return translation
+	}
+	return column
+}
+
+// RightToLeft проверяет, выводится ли отчет справа налево
+func (d *ReportData) RightToLeft() bool {
+	return isRightToLeft(d.Locale)
+}
+
+// Rows возвращает строки всех наборов подряд. Колонки берутся из первого набора,
+// перед строками каждого следующего набора выводятся пустая строка и его заголовки.
+// Заголовки переводятся на язык отчета.
+func (d *ReportData) Rows() RowIterator {
+	return &datasetRows{datasets: d.Datasets, header: d.Header}
+}
+
+// Close освобождает ресурсы наборов, например открытые курсоры запросов
+func (d *ReportData) Close() error {
+	var errs []error
+	for _, dataset := range d.Datasets {
+		if closer, ok := dataset.Rows.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// datasetRows последовательно отдает строки нескольких наборов
+type datasetRows struct {
+	datasets []Dataset
+	header   func(column string) string
+	current  int
+	pending  [][]interface{}
+}
+
+// Columns возвращает заголовки колонок первого набора
+func (r *datasetRows) Columns() []string {
+	if len(r.datasets) == 0 {
+		return nil
+	}
+	columns := r.datasets[0].Rows.Columns()
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = r.header(column)
+	}
+	return headers
+}
+
+// Next возвращает следующую строку
+func (r *datasetRows) Next() ([]interface{}, error) {
+	for {
+		if len(r.pending) > 0 {
+			row := r.pending[0]
+			r.pending = r.pending[1:]
+			return row, nil
+		}
+		if r.current >= len(r.datasets) {
+			return nil, io.EOF
+		}
+
+		row, err := r.datasets[r.current].Rows.Next()
+		if err != io.EOF {
+			return row, err
+		}
+
+		r.current++
+		if r.current < len(r.datasets) {
+			columns := r.datasets[r.current].Rows.Columns()
+			header := make([]interface{}, len(columns))
+			for i, column := range columns {
+				header[i] = r.header(column)
+			}
+			r.pending = [][]interface{}{{}, header}
+		}
+	}
+}
+
+// DataSources выдает подключения к именованным источникам данных запросов.
+// Пустое имя соответствует основной базе данных.
+type DataSources interface {
+	DB(ctx context.Context, name string) (*gorm.DB, error)
+	// Request выполняет GET запрос к JSON API источника данных с драйвером http
+	Request(ctx context.Context, name, path string) (io.ReadCloser, error)
+	Has(name string) bool
+}
+
+// ReportDataLoader загружает данные для генерации отчета
+type ReportDataLoader interface {
+	Load(ctx context.Context, report *models.Report) (*ReportData, error)
+}
+
+// ReportInfoLoader отдает сведения об отчете и его параметры.
+// Используется для отчетов без определения.
+type ReportInfoLoader struct{}
+
+// Load возвращает набор со сведениями об отчете
+func (ReportInfoLoader) Load(ctx context.Context, report *models.Report) (*ReportData, error) {
+	return &ReportData{Datasets: []Dataset{{Name: reportInfoDataset, Rows: newReportInfoRows(report)}}}, nil
+}
+
+// DefinitionDataLoader выполняет запросы определения отчета и загружает его шаблон.
+// Отчеты без определения получают сведения об отчете.
+type DefinitionDataLoader struct {
+	definitions  DefinitionRepository
+	queries      QueryValidator
+	sources      DataSources
+	fileStorage  ReportFileStorage
+	datasets     DatasetRepository
+	masking      MaskingPolicy
+	localization *Localization
+	documents    *models.DocumentOptions
+	// templateMaxSize наибольший размер шаблона, 0 - без ограничения
+	templateMaxSize int64
+	logger          logging.Logger
+}
+
+// NewDefinitionDataLoader создает загрузчик данных по определениям отчетов
+func NewDefinitionDataLoader(
+	definitions DefinitionRepository,
+	queries QueryValidator,
+	sources DataSources,
+	fileStorage ReportFileStorage,
+	logger logging.Logger,
+) *DefinitionDataLoader {
+	return &DefinitionDataLoader{
+		definitions: definitions,
+		queries:     queries,
+		sources:     sources,
+		fileStorage: fileStorage,
+		logger:      logger,
+	}
+}
+
+// WithMasking устанавливает правила маскирования персональных данных из конфигурации
+func (l *DefinitionDataLoader) WithMasking(masking MaskingPolicy) *DefinitionDataLoader {
+	l.masking = masking
+	return l
+}
+
+// WithTemplateMaxSize ограничивает размер загружаемого шаблона, чтобы файл шаблона
+// не читался в память целиком сверх ограничения
+func (l *DefinitionDataLoader) WithTemplateMaxSize(maxSize int64) *DefinitionDataLoader {
+	l.templateMaxSize = maxSize
+	return l
+}
+
+// WithDatasets подключает загруженные файлы с данными: запросы определения с полем dataset
+// и отчеты без определения с параметром dataset_id читают строки из файла
+func (l *DefinitionDataLoader) WithDatasets(datasets DatasetRepository) *DefinitionDataLoader {
+	l.datasets = datasets
+	return l
+}
+
+// WithLocalization устанавливает переводы заголовков для отчетов с параметром locale
+func (l *DefinitionDataLoader) WithLocalization(localization *Localization) *DefinitionDataLoader {
+	l.localization = localization
+	return l
+}
+
+// WithDocumentDefaults устанавливает свойства документа и водяной знак по умолчанию.
+// Поля, заданные в определении отчета, заменяют значения по умолчанию
+func (l *DefinitionDataLoader) WithDocumentDefaults(defaults *models.DocumentOptions) *DefinitionDataLoader {
+	l.documents = defaults
+	return l
+}
+
+// Load возвращает наборы строк по запросам определения. Запросы выполняются
+// по очереди при чтении наборов, параметры отчета подставляются по имени (@name).
+// Запросы проверяются повторно: список разрешенных таблиц мог измениться после сохранения определения.
+func (l *DefinitionDataLoader) Load(ctx context.Context, report *models.Report) (*ReportData, error) {
+	if report.DefinitionID == nil {
+		var data *ReportData
+		var err error
+		if _, exists := report.Parameters[models.ParamDataset]; exists {
+			var rows RowIterator
+			if rows, err = l.datasetRows(ctx, report.Parameters, models.ParamDataset, uploadedDatasetName); err == nil {
+				rows = withReportTimezone(rows, report.Parameters)
+				data = &ReportData{Datasets: []Dataset{{Name: uploadedDatasetName, Rows: rows}}}
+			}
+		} else {
+			data, err = ReportInfoLoader{}.Load(ctx, report)
+		}
+		if err == nil {
+			l.localization.localize(data, report.Parameters)
+			data.Document = l.documents
+		}
+		return data, err
+	}
+
+	definition, err := l.definitions.GetByID(ctx, *report.DefinitionID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения определения отчета %d: %w", *report.DefinitionID, err)
+	}
+
+	// Разрешение автора отчета на данные без маскирования сохраняется при создании отчета
+	if report.Unmasked {
+		ctx = WithUnmasked(ctx)
+	}
+	data, err := l.LoadDefinition(ctx, definition, report.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := logging.FromContext(ctx, l.logger).WithFields(logging.Fields{
+		"report_id":  report.ID,
+		"definition": definition.Name,
+		"queries":    len(definition.Queries),
+	})
+	logger.Debug("Данные отчета подготовлены по определению")
+	if report.Unmasked && !l.masking.forDefinition(definition).isEmpty() {
+		logger.WithField("created_by", report.CreatedBy).Info("Отчет генерируется без маскирования персональных данных")
+	}
+
+	return data, nil
+}
+
+// LoadDefinition подготавливает наборы запросов определения с параметрами parameters и загружает
+// шаблон. Определение может быть еще не сохранено, например при предпросмотре.
+func (l *DefinitionDataLoader) LoadDefinition(ctx context.Context, definition *models.ReportDefinition, parameters models.JSON) (*ReportData, error) {
+	var err error
+	data := &ReportData{Document: l.documents.Merge(definition.Document)}
+	if !definition.ExcelLayout.IsEmpty() {
+		data.Layout = definition.ExcelLayout
+	}
+	if definition.HasTemplate() {
+		if data.Template, err = l.loadTemplate(ctx, definition.TemplateKey); err != nil {
+			return nil, err
+		}
+	}
+
+	params := map[string]interface{}(parameters)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	masking := l.masking.forDefinition(definition)
+	if unmaskedAllowed(ctx) {
+		masking = columnMasking{}
+	}
+
+	// Локаль отчета заменяет локаль форматирования колонок определения
+	l.localization.localize(data, parameters)
+	mapping := definition.ColumnMapping
+	if data.Locale != "" && !mapping.IsEmpty() {
+		localized := *mapping
+		localized.Locale = data.Locale
+		mapping = &localized
+	}
+	// Результаты запросов, которые используют производные наборы, читаются в память целиком.
+	// Производный набор получает строки входных наборов после маскирования, но без
+	// преобразований колонок: они применяются к самому производному набору
+	inputs := derivedInputs(definition.Queries)
+	buffers := make(map[string]*bufferedRows, len(inputs))
+	for _, query := range definition.Queries {
+		var rows RowIterator
+		if query.IsDerived() {
+			rows, err = l.derivedRows(query, buffers, masking)
+		} else {
+			rows, err = l.definitionRows(ctx, query, parameters, params)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Даты переводятся в часовой пояс отчета до форматирования колонок и производных наборов
+		if !query.IsDerived() {
+			rows = withReportTimezone(rows, parameters)
+		}
+		if inputs[query.Name] {
+			buffers[query.Name] = &bufferedRows{name: query.Name, rows: rows}
+			rows = buffers[query.Name].reader()
+		}
+		if query.Hidden {
+			continue
+		}
+		if !mapping.IsEmpty() || !masking.isEmpty() {
+			rows = newMappedRows(rows, query.Name, mapping, masking)
+		}
+		data.Datasets = append(data.Datasets, Dataset{
+			Name:  query.Name,
+			Rows:  rows,
+			Sheet: query.Sheet,
+		})
+	}
+	return data, nil
+}
+
+// definitionRows возвращает строки запроса определения: результат SQL запроса или загруженный файл
+func (l *DefinitionDataLoader) definitionRows(ctx context.Context, query models.Query, parameters models.JSON, params map[string]interface{}) (RowIterator, error) {
+	if query.IsUploaded() {
+		return l.datasetRows(ctx, parameters, query.Dataset, query.Name)
+	}
+	if query.IsHTTP() {
+		rowsPath, err := parseRowsPath(query.Rows)
+		if err != nil {
+			return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("запрос %s: %w", query.Name, err))
+		}
+		return &httpRows{ctx: ctx, sources: l.sources, name: query.Name, source: query.Source,
+			path: query.Path, rowsPath: rowsPath, params: params}, nil
+	}
+	if err := l.queries.Validate(query.SQL); err != nil {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("запрос %s: %w", query.Name, err))
+	}
+	db, err := l.sources.DB(ctx, query.Source)
+	if err != nil {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("запрос %s: %w", query.Name, err))
+	}
+	return &queryRows{ctx: ctx, db: db, name: query.Name, sql: query.SQL, params: params}, nil
+}
+
+// derivedRows возвращает производный набор по прочитанным в память результатам предыдущих запросов
+func (l *DefinitionDataLoader) derivedRows(query models.Query, buffers map[string]*bufferedRows, masking columnMasking) (RowIterator, error) {
+	inputs := make([]RowIterator, len(query.Derived.Inputs))
+	for i, name := range query.Derived.Inputs {
+		buffer, exists := buffers[name]
+		if !exists {
+			return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("производный набор %s: входной набор %s должен быть объявлен раньше", query.Name, name))
+		}
+		inputs[i] = buffer.reader()
+		if !masking.isEmpty() {
+			inputs[i] = newMappedRows(inputs[i], name, nil, masking)
+		}
+	}
+	return newDerivedRows(query.Name, query.Derived, inputs), nil
+}
+
+// datasetRows возвращает строки загруженного файла, ID которого задан параметром отчета parameter
+func (l *DefinitionDataLoader) datasetRows(ctx context.Context, parameters models.JSON, parameter, name string) (RowIterator, error) {
+	if l.datasets == nil {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("набор %s: загруженные файлы с данными не подключены", name))
+	}
+	id, err := datasetParameter(parameters, parameter)
+	if err != nil {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("набор %s: %w", name, err))
+	}
+	dataset, err := l.datasets.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("набор %s: %w: %d", name, ErrDatasetNotFound, id))
+	}
+	if err != nil {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("набор %s: ошибка получения файла с данными: %w", name, err))
+	}
+	return newUploadedRows(ctx, l.fileStorage, dataset, name), nil
+}
+
+// loadTemplate читает шаблон определения из хранилища
+func (l *DefinitionDataLoader) loadTemplate(ctx context.Context, key string) ([]byte, error) {
+	return readTemplate(ctx, l.fileStorage, key, l.templateMaxSize)
+}
+
+// readTemplate читает шаблон из хранилища. maxSize 0 - без ограничения размера
+func readTemplate(ctx context.Context, fileStorage ReportFileStorage, key string, maxSize int64) ([]byte, error) {
+	reader, err := fileStorage.Get(ctx, key)
+	if err != nil {
+		return nil, withErrorCode(models.ErrorCodeTemplate, fmt.Errorf("ошибка получения шаблона %s: %w", key, err))
+	}
+	defer reader.Close()
+
+	var source io.Reader = reader
+	if maxSize > 0 {
+		source = io.LimitReader(reader, maxSize+1)
+	}
+	content, err := io.ReadAll(source)
+	if err != nil {
+		return nil, withErrorCode(models.ErrorCodeTemplate, fmt.Errorf("ошибка чтения шаблона %s: %w", key, err))
+	}
+	limits := template.Limits{MaxSize: maxSize}
+	if err := limits.CheckSize(int64(len(content))); err != nil {
+		return nil, withErrorCode(models.ErrorCodeTemplate, fmt.Errorf("шаблон %s: %w", key, err))
+	}
+	return content, nil
+}
+
+// queryRows итератор по результату SQL запроса. Запрос выполняется при первом обращении,
+// поэтому запросы определения не держат соединения одновременно.
+type queryRows struct {
+	ctx    context.Context
+	db     *gorm.DB
+	name   string
+	sql    string
+	params map[string]interface{}
+
+	started bool
+	rows    *sql.Rows
+	columns []string
+	err     error
+}
+
+// start выполняет запрос
+func (r *queryRows) start() {
+	if r.started {
+		return
+	}
+	r.started = true
+
+	// Без именованных параметров GORM передал бы карту драйверу как значение
+	var args []interface{}
+	if strings.Contains(r.sql, "@") {
+		args = append(args, r.params)
+	}
+
+	rows, err := r.db.WithContext(r.ctx).Raw(r.sql, args...).Rows()
+	if err != nil {
+		r.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("ошибка выполнения запроса %s: %w", r.name, err))
+		return
+	}
+	r.rows = rows
+
+	if r.columns, err = rows.Columns(); err != nil {
+		r.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("ошибка чтения колонок запроса %s: %w", r.name, err))
+	}
+}
+
+// Columns возвращает колонки результата запроса
+func (r *queryRows) Columns() []string {
+	r.start()
+	return r.columns
+}
+
+// Next возвращает следующую строку результата
+func (r *queryRows) Next() ([]interface{}, error) {
+	r.start()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("ошибка чтения результата запроса %s: %w", r.name, err))
+		}
+		r.Close()
+		return nil, io.EOF
+	}
+
+	values := make([]interface{}, len(r.columns))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := r.rows.Scan(pointers...); err != nil {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("ошибка чтения строки запроса %s: %w", r.name, err))
+	}
+
+	// Текстовые колонки драйверы возвращают байтами
+	for i, value := range values {
+		if bytes, ok := value.([]byte); ok {
+			values[i] = string(bytes)
+		}
+	}
+	return values, nil
+}
+
+// Close закрывает курсор запроса
+func (r *queryRows) Close() error {
+	if r.rows == nil {
+		return nil
+	}
+	return r.rows.Close()
+}
@@ -0,0 +1,501 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// uploadedDatasetName имя набора отчета без определения, построенного по загруженному файлу
+const uploadedDatasetName = "data"
+
+var (
+	// ErrInvalidDataset загруженный файл с данными не прошел проверку
+	ErrInvalidDataset = newCategoryError(ErrValidation, "некорректный файл с данными")
+	// ErrDatasetTooLarge файл с данными больше datasets.max_size или datasets.max_rows строк
+	ErrDatasetTooLarge = newCategoryError(ErrValidation, "файл с данными слишком большой")
+	// ErrDatasetNotFound загруженный файл с данными не найден
+	ErrDatasetNotFound = newCategoryError(ErrNotFound, "файл с данными не найден")
+)
+
+// DatasetUpload загружаемый файл с данными. Size -1, если размер заранее неизвестен
+type DatasetUpload struct {
+	Filename string
+	Size     int64
+	Reader   io.Reader
+}
+
+// DatasetService интерфейс для работы с загруженными файлами с данными
+type DatasetService interface {
+	UploadDataset(ctx context.Context, upload DatasetUpload) (*models.UploadedDataset, error)
+	GetDataset(ctx context.Context, id uint) (*models.UploadedDataset, error)
+	// ListDatasets возвращает файлы, загруженные текущим пользователем
+	ListDatasets(ctx context.Context) ([]models.UploadedDataset, error)
+	DeleteDataset(ctx context.Context, id uint) error
+}
+
+// DatasetRepository интерфейс для работы с загруженными файлами с данными в базе данных
+type DatasetRepository interface {
+	Create(ctx context.Context, dataset *models.UploadedDataset) error
+	GetByID(ctx context.Context, id uint) (*models.UploadedDataset, error)
+	ListByCreator(ctx context.Context, createdBy string) ([]models.UploadedDataset, error)
+	Delete(ctx context.Context, id uint) error
+}
+
+// GormDatasetRepository реализация DatasetRepository с использованием GORM
+type GormDatasetRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormDatasetRepository создает новый репозиторий загруженных файлов с данными
+func NewGormDatasetRepository(db *gorm.DB, logger logging.Logger) DatasetRepository {
+	return &GormDatasetRepository{db: db, logger: logger}
+}
+
+// Create сохраняет сведения о загруженном файле
+func (r *GormDatasetRepository) Create(ctx context.Context, dataset *models.UploadedDataset) error {
+	return r.db.WithContext(ctx).Create(dataset).Error
+}
+
+// GetByID возвращает загруженный файл по ID
+func (r *GormDatasetRepository) GetByID(ctx context.Context, id uint) (*models.UploadedDataset, error) {
+	var dataset models.UploadedDataset
+	if err := r.db.WithContext(ctx).First(&dataset, id).Error; err != nil {
+		return nil, err
+	}
+	return &dataset, nil
+}
+
+// ListByCreator возвращает файлы пользователя, сначала новые
+func (r *GormDatasetRepository) ListByCreator(ctx context.Context, createdBy string) ([]models.UploadedDataset, error) {
+	var datasets []models.UploadedDataset
+	err := r.db.WithContext(ctx).Where("created_by = ?", createdBy).Order("id DESC").Find(&datasets).Error
+	if err != nil {
+		return nil, err
+	}
+	return datasets, nil
+}
+
+// Delete удаляет сведения о загруженном файле
+func (r *GormDatasetRepository) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.UploadedDataset{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DatasetServiceImpl реализация сервиса загруженных файлов с данными
+type DatasetServiceImpl struct {
+	repository  DatasetRepository
+	fileStorage ReportFileStorage
+	limits      config.Datasets
+	logger      logging.Logger
+}
+
+// NewDatasetService создает новый сервис загруженных файлов с данными
+func NewDatasetService(
+	repository DatasetRepository,
+	fileStorage ReportFileStorage,
+	limits config.Datasets,
+	logger logging.Logger,
+) *DatasetServiceImpl {
+	return &DatasetServiceImpl{
+		repository:  repository,
+		fileStorage: fileStorage,
+		limits:      limits,
+		logger:      logger,
+	}
+}
+
+// NewDatasetServiceFromConfig создает сервис загруженных файлов с хранением сведений
+// в базе данных и файлов в хранилище отчетов
+func NewDatasetServiceFromConfig(cfg config.Config, db *gorm.DB, fileStorage storage.Storage, logger logging.Logger) DatasetService {
+	return NewDatasetService(
+		NewGormDatasetRepository(db, logger),
+		NewReportFileStorage(fileStorage, logger),
+		cfg.Datasets,
+		logger,
+	)
+}
+
+// UploadDataset сохраняет файл в хранилище и проверяет, что он читается: первая строка
+// содержит непустые неповторяющиеся заголовки, а строк данных не больше datasets.max_rows
+func (s *DatasetServiceImpl) UploadDataset(ctx context.Context, upload DatasetUpload) (*models.UploadedDataset, error) {
+	dataset := &models.UploadedDataset{
+		Filename:  strings.TrimSpace(upload.Filename),
+		CreatedBy: actorOr(ctx, "api"),
+	}
+	dataset.Format, _ = models.DatasetFormatByName(dataset.Filename)
+	if err := dataset.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDataset, err)
+	}
+	if upload.Size > s.limits.MaxSize {
+		return nil, fmt.Errorf("%w: %d байт, допустимо не больше %d", ErrDatasetTooLarge, upload.Size, s.limits.MaxSize)
+	}
+
+	dataset.FileKey = datasetKey(dataset.Filename)
+	limited := &limitedReader{reader: upload.Reader, remaining: s.limits.MaxSize}
+	checksum := newChecksumReader(limited)
+	if err := s.fileStorage.Save(ctx, dataset.FileKey, checksum); err != nil {
+		s.deleteFile(ctx, dataset.FileKey)
+		if limited.exceeded {
+			return nil, fmt.Errorf("%w: допустимо не больше %d байт", ErrDatasetTooLarge, s.limits.MaxSize)
+		}
+		return nil, fmt.Errorf("ошибка сохранения файла с данными: %w", err)
+	}
+	dataset.Size = checksum.Size()
+	dataset.Checksum = checksum.Sum()
+
+	if err := s.inspect(ctx, dataset); err != nil {
+		s.deleteFile(ctx, dataset.FileKey)
+		return nil, err
+	}
+	if err := s.repository.Create(ctx, dataset); err != nil {
+		s.deleteFile(ctx, dataset.FileKey)
+		return nil, fmt.Errorf("ошибка сохранения файла с данными: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"dataset_id": dataset.ID,
+		"filename":   dataset.Filename,
+		"size":       dataset.Size,
+		"rows":       dataset.RowCount,
+		"created_by": dataset.CreatedBy,
+	}).Info("Файл с данными загружен")
+	return dataset, nil
+}
+
+// inspect читает сохраненный файл целиком и запоминает его колонки и число строк
+func (s *DatasetServiceImpl) inspect(ctx context.Context, dataset *models.UploadedDataset) error {
+	rows := newUploadedRows(ctx, s.fileStorage, dataset, dataset.Filename)
+	defer rows.Close()
+
+	dataset.Columns = rows.Columns()
+	for {
+		_, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidDataset, err)
+		}
+		dataset.RowCount++
+		if dataset.RowCount > s.limits.MaxRows {
+			return fmt.Errorf("%w: допустимо не больше %d строк", ErrDatasetTooLarge, s.limits.MaxRows)
+		}
+	}
+	return nil
+}
+
+// GetDataset возвращает сведения о загруженном файле
+func (s *DatasetServiceImpl) GetDataset(ctx context.Context, id uint) (*models.UploadedDataset, error) {
+	dataset, err := s.repository.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %d", ErrDatasetNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения файла с данными: %w", err)
+	}
+	return dataset, nil
+}
+
+// ListDatasets возвращает файлы, загруженные текущим пользователем
+func (s *DatasetServiceImpl) ListDatasets(ctx context.Context) ([]models.UploadedDataset, error) {
+	datasets, err := s.repository.ListByCreator(ctx, actorOr(ctx, "api"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения файлов с данными: %w", err)
+	}
+	return datasets, nil
+}
+
+// DeleteDataset удаляет загруженный файл. Отчеты, уже сгенерированные по нему, сохраняются,
+// а отчеты в очереди завершатся ошибкой.
+func (s *DatasetServiceImpl) DeleteDataset(ctx context.Context, id uint) error {
+	dataset, err := s.GetDataset(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.Delete(ctx, id); err != nil {
+		return fmt.Errorf("ошибка удаления файла с данными: %w", err)
+	}
+	s.deleteFile(ctx, dataset.FileKey)
+
+	logging.FromContext(ctx, s.logger).WithField("dataset_id", id).Info("Файл с данными удален")
+	return nil
+}
+
+// deleteFile удаляет файл из хранилища, ошибка только записывается в лог
+func (s *DatasetServiceImpl) deleteFile(ctx context.Context, key string) {
+	if err := s.fileStorage.Delete(ctx, key); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("file_key", key).Warn("Ошибка удаления файла с данными из хранилища")
+	}
+}
+
+// datasetKey возвращает ключ загруженного файла в хранилище
+func datasetKey(filename string) string {
+	name := storage.KeySegment(strings.TrimSuffix(filename, path.Ext(filename)))
+	if name == "" {
+		name = "dataset"
+	}
+	if extension := storage.KeySegment(path.Ext(filename)); extension != "" {
+		name += "." + extension
+	}
+	return fmt.Sprintf("datasets/%d_%s", time.Now().UnixNano(), name)
+}
+
+// datasetParameter возвращает ID загруженного файла из параметра отчета
+func datasetParameter(parameters models.JSON, name string) (uint, error) {
+	value, exists := parameters[name]
+	if !exists || value == nil {
+		return 0, fmt.Errorf("не задан параметр %s с ID файла с данными", name)
+	}
+	var id float64
+	switch v := value.(type) {
+	case float64:
+		id = v
+	case int:
+		id = float64(v)
+	case int64:
+		id = float64(v)
+	case uint:
+		id = float64(v)
+	case string:
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("параметр %s: неверный ID файла с данными %q", name, v)
+		}
+		id = float64(parsed)
+	default:
+		return 0, fmt.Errorf("параметр %s: неверный ID файла с данными %v", name, value)
+	}
+	if id <= 0 || id != float64(uint(id)) {
+		return 0, fmt.Errorf("параметр %s: неверный ID файла с данными %v", name, value)
+	}
+	return uint(id), nil
+}
+
+// uploadedRows итератор по строкам загруженного файла CSV или XLSX. Файл открывается
+// при первом обращении, как и запросы определения. Пустые ячейки отдаются как NULL,
+// полностью пустые строки пропускаются.
+type uploadedRows struct {
+	ctx         context.Context
+	fileStorage ReportFileStorage
+	dataset     *models.UploadedDataset
+	name        string
+
+	started bool
+	reader  io.ReadCloser
+	book    *excelize.File
+	sheet   *excelize.Rows
+	csv     *csv.Reader
+	columns []string
+	err     error
+}
+
+// newUploadedRows создает итератор по строкам загруженного файла для набора name
+func newUploadedRows(ctx context.Context, fileStorage ReportFileStorage, dataset *models.UploadedDataset, name string) *uploadedRows {
+	return &uploadedRows{ctx: ctx, fileStorage: fileStorage, dataset: dataset, name: name}
+}
+
+// start открывает файл и читает строку заголовков
+func (r *uploadedRows) start() {
+	if r.started {
+		return
+	}
+	r.started = true
+
+	reader, err := r.fileStorage.Get(r.ctx, r.dataset.FileKey)
+	if err != nil {
+		r.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("ошибка получения файла с данными %s: %w", r.name, err))
+		return
+	}
+	r.reader = verifyChecksum(reader, r.dataset.Checksum)
+
+	switch r.dataset.Format {
+	case models.DatasetXLSX:
+		err = r.openXLSX()
+	default:
+		err = r.openCSV()
+	}
+	if err != nil {
+		r.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("файл с данными %s: %w", r.name, err))
+		return
+	}
+
+	header, err := r.next()
+	if err == io.EOF {
+		err = errors.New("нет строки заголовков")
+	}
+	if err == nil {
+		r.columns, err = datasetColumns(header)
+	}
+	if err != nil {
+		r.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("файл с данными %s: %w", r.name, err))
+	}
+}
+
+// openCSV начинает чтение CSV. Разделитель - запятая, точка с запятой или табуляция,
+// которая из них чаще встречается в строке заголовков
+func (r *uploadedRows) openCSV() error {
+	buffered := bufio.NewReader(r.reader)
+	if bom, _ := buffered.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		_, _ = buffered.Discard(3)
+	}
+	line, _ := buffered.Peek(buffered.Size())
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+
+	r.csv = csv.NewReader(buffered)
+	for _, delimiter := range []rune{';', '\t'} {
+		if bytes.Count(line, []byte(string(delimiter))) > bytes.Count(line, []byte(string(r.csv.Comma))) {
+			r.csv.Comma = delimiter
+		}
+	}
+	return nil
+}
+
+// openXLSX читает книгу и начинает чтение ее первого листа
+func (r *uploadedRows) openXLSX() error {
+	book, err := excelize.OpenReader(r.reader)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения книги Excel: %w", err)
+	}
+	r.book = book
+	sheets := book.GetSheetList()
+	if len(sheets) == 0 {
+		return errors.New("в книге нет листов")
+	}
+	if r.sheet, err = book.Rows(sheets[0]); err != nil {
+		return fmt.Errorf("ошибка чтения листа %s: %w", sheets[0], err)
+	}
+	return nil
+}
+
+// next возвращает ячейки следующей непустой строки файла
+func (r *uploadedRows) next() ([]string, error) {
+	if r.csv == nil && r.sheet == nil {
+		return nil, io.EOF
+	}
+	for {
+		var record []string
+		if r.csv != nil {
+			var err error
+			if record, err = r.csv.Read(); err != nil {
+				return nil, err
+			}
+		} else {
+			if !r.sheet.Next() {
+				if err := r.sheet.Error(); err != nil {
+					return nil, err
+				}
+				return nil, io.EOF
+			}
+			var err error
+			if record, err = r.sheet.Columns(); err != nil {
+				return nil, err
+			}
+		}
+		for _, cell := range record {
+			if strings.TrimSpace(cell) != "" {
+				return record, nil
+			}
+		}
+	}
+}
+
+// datasetColumns проверяет строку заголовков: имена колонок непустые и не повторяются
+func datasetColumns(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, cell := range header {
+		column := strings.TrimSpace(cell)
+		if column == "" {
+			return nil, fmt.Errorf("пустой заголовок колонки %d", i+1)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("колонка %s повторяется", column)
+		}
+		seen[column] = true
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+// Columns возвращает колонки из строки заголовков файла
+func (r *uploadedRows) Columns() []string {
+	r.start()
+	return r.columns
+}
+
+// Next возвращает следующую строку файла
+func (r *uploadedRows) Next() ([]interface{}, error) {
+	r.start()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	record, err := r.next()
+	if err == io.EOF {
+		r.Close()
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("ошибка чтения файла с данными %s: %w", r.name, err))
+	}
+
+	values := make([]interface{}, len(r.columns))
+	for i, cell := range record {
+		if i >= len(values) {
+			if strings.TrimSpace(cell) != "" {
+				return nil, withErrorCode(models.ErrorCodeQuery,
+					fmt.Errorf("файл с данными %s: в строке больше значений, чем колонок", r.name))
+			}
+			continue
+		}
+		if cell != "" {
+			values[i] = cell
+		}
+	}
+	return values, nil
+}
+
+// Close закрывает файл
+func (r *uploadedRows) Close() error {
+	var errs []error
+	r.csv = nil
+	if r.sheet != nil {
+		errs = append(errs, r.sheet.Close())
+		r.sheet = nil
+	}
+	if r.book != nil {
+		errs = append(errs, r.book.Close())
+		r.book = nil
+	}
+	if r.reader != nil {
+		errs = append(errs, r.reader.Close())
+		r.reader = nil
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestDatasetService(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.UploadedDataset{}))
+	logger := setupTestLogger()
+	ctx := WithActor(context.Background(), "analyst")
+
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+	fileStorage := NewReportFileStorage(local, logger)
+	service := NewDatasetService(NewGormDatasetRepository(db, logger), fileStorage, config.Datasets{MaxSize: 16 << 10, MaxRows: 3}, logger)
+
+	upload := func(name, content string) (*models.UploadedDataset, error) {
+		return service.UploadDataset(ctx, DatasetUpload{Filename: name, Size: -1, Reader: strings.NewReader(content)})
+	}
+
+	// Разделитель определяется по заголовкам, BOM отбрасывается, пустые строки пропускаются
+	dataset, err := upload("sales.csv", "\xef\xbb\xbfregion;total\nnorth;10\n\nsouth;\n")
+	require.NoError(t, err)
+	assert.Equal(t, models.DatasetCSV, dataset.Format)
+	assert.Equal(t, models.DatasetColumns{"region", "total"}, dataset.Columns)
+	assert.Equal(t, int64(2), dataset.RowCount)
+	assert.Len(t, dataset.Checksum, 64)
+	assert.True(t, strings.HasPrefix(dataset.FileKey, "datasets/"))
+
+	rows := newUploadedRows(ctx, fileStorage, dataset, "sales")
+	assert.Equal(t, []string{"region", "total"}, rows.Columns())
+	row, err := rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"north", "10"}, row)
+	row, err = rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"south", nil}, row)
+	_, err = rows.Next()
+	assert.Equal(t, io.EOF, err)
+
+	book := excelize.NewFile()
+	defer book.Close()
+	require.NoError(t, book.SetSheetRow("Sheet1", "A1", &[]interface{}{"name", "amount"}))
+	require.NoError(t, book.SetSheetRow("Sheet1", "A2", &[]interface{}{"Иванов", 1500}))
+	content, err := book.WriteToBuffer()
+	require.NoError(t, err)
+	workbook, err := upload("people.xlsx", content.String())
+	require.NoError(t, err)
+	assert.Equal(t, models.DatasetXLSX, workbook.Format)
+	assert.Equal(t, models.DatasetColumns{"name", "amount"}, workbook.Columns)
+	assert.Equal(t, int64(1), workbook.RowCount)
+
+	for name, content := range map[string]string{
+		"report.pdf":    "region\nnorth\n",
+		"empty.csv":     "",
+		"duplicate.csv": "region,region\nnorth,south\n",
+		"blank.csv":     "region,\nnorth,10\n",
+		"ragged.csv":    "region,total\nnorth\n",
+	} {
+		_, err := upload(name, content)
+		assert.ErrorIs(t, err, ErrInvalidDataset, name)
+		assert.ErrorIs(t, err, ErrValidation, name)
+	}
+	_, err = upload("many.csv", "n\n1\n2\n3\n4\n")
+	assert.ErrorIs(t, err, ErrDatasetTooLarge)
+	_, err = upload("large.csv", "n\n"+strings.Repeat("1\n", 16<<10))
+	assert.ErrorIs(t, err, ErrDatasetTooLarge)
+	_, err = service.UploadDataset(ctx, DatasetUpload{Filename: "large.csv", Size: 32 << 10, Reader: strings.NewReader("n\n")})
+	assert.ErrorIs(t, err, ErrDatasetTooLarge)
+
+	datasets, err := service.ListDatasets(ctx)
+	require.NoError(t, err)
+	require.Len(t, datasets, 2)
+	assert.Equal(t, workbook.ID, datasets[0].ID)
+	others, err := service.ListDatasets(WithActor(context.Background(), "other"))
+	require.NoError(t, err)
+	assert.Empty(t, others)
+
+	require.NoError(t, service.DeleteDataset(ctx, workbook.ID))
+	_, err = service.GetDataset(ctx, workbook.ID)
+	assert.ErrorIs(t, err, ErrDatasetNotFound)
+	_, err = local.Get(ctx, workbook.FileKey)
+	assert.Error(t, err)
+}
+
+func TestDefinitionDataLoaderDatasets(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	require.NoError(t, db.AutoMigrate(&models.UploadedDataset{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+	fileStorage := NewReportFileStorage(local, logger)
+	datasets := NewGormDatasetRepository(db, logger)
+	dataset, err := NewDatasetService(datasets, fileStorage, config.Datasets{MaxSize: 1024, MaxRows: 10}, logger).
+		UploadDataset(ctx, DatasetUpload{Filename: "items.csv", Size: -1, Reader: strings.NewReader("item,qty\nbolt,4\nnut,8\n")})
+	require.NoError(t, err)
+
+	definition := &models.ReportDefinition{
+		Name:      "invoice",
+		Queries:   models.Queries{{Name: "items", Dataset: "items_file"}},
+		Format:    models.FormatCSV,
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	require.NoError(t, definition.Validate())
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), fileStorage, logger).
+		WithDatasets(datasets)
+
+	data, err := loader.LoadDefinition(ctx, definition, models.JSON{"items_file": float64(dataset.ID)})
+	require.NoError(t, err)
+	report := &models.Report{ID: 1, Title: "Счет", Format: models.FormatCSV}
+	reader, _, err := NewCSVReportGenerator(logger).Generate(ctx, report, data)
+	require.NoError(t, err)
+	var output bytes.Buffer
+	_, err = io.Copy(&output, reader)
+	require.NoError(t, err)
+	require.NoError(t, data.Close())
+	assert.Contains(t, output.String(), "item,qty\nbolt,4\nnut,8\n")
+
+	_, err = loader.LoadDefinition(ctx, definition, models.JSON{})
+	assert.ErrorContains(t, err, "items_file")
+	_, err = loader.LoadDefinition(ctx, definition, models.JSON{"items_file": "999"})
+	assert.ErrorIs(t, err, ErrDatasetNotFound)
+
+	// Отчет без определения строится по файлу из параметра dataset_id
+	adhoc := &models.Report{ID: 2, Title: "Выгрузка", Format: models.FormatCSV,
+		Parameters: models.JSON{models.ParamDataset: float64(dataset.ID)}}
+	data, err = loader.Load(ctx, adhoc)
+	require.NoError(t, err)
+	require.Len(t, data.Datasets, 1)
+	assert.Equal(t, []string{"item", "qty"}, data.Datasets[0].Rows.Columns())
+	require.NoError(t, data.Close())
+
+	definition.Queries[0].SQL = "SELECT 1"
+	assert.Error(t, definition.Validate())
+}
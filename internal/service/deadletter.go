@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// maxDeadLetterMessageLength ограничение длины текста ошибки задачи, исчерпавшей попытки
+const maxDeadLetterMessageLength = 10000
+
+var (
+	// ErrDeadLetterNotFound задача, исчерпавшая попытки, не найдена
+	ErrDeadLetterNotFound = newCategoryError(ErrNotFound, "задача, исчерпавшая попытки, не найдена")
+	// ErrDeadLetterRequeued отчет задачи уже поставлен в очередь повторно
+	ErrDeadLetterRequeued = newCategoryError(ErrConflict, "отчет задачи уже поставлен в очередь повторно")
+)
+
+// DeadLetterListParams параметры списка задач, исчерпавших попытки
+type DeadLetterListParams struct {
+	// Requeued true - задачи, отчеты которых уже поставлены в очередь повторно, false - остальные
+	Requeued bool
+	Page     int
+	PageSize int
+}
+
+// DeadLetterList страница задач, исчерпавших попытки
+type DeadLetterList struct {
+	DeadLetters []models.DeadLetter `json:"dead_letters"`
+	Total       int64               `json:"total"`
+	Page        int                 `json:"page"`
+	PageSize    int                 `json:"page_size"`
+	TotalPages  int                 `json:"total_pages"`
+}
+
+// DeadLetterRepository хранилище задач, исчерпавших попытки
+type DeadLetterRepository interface {
+	Create(ctx context.Context, letter *models.DeadLetter) error
+	GetByID(ctx context.Context, id uint) (*models.DeadLetter, error)
+	List(ctx context.Context, params DeadLetterListParams) ([]models.DeadLetter, int64, error)
+	// CountOpen возвращает число задач, отчеты которых еще не поставлены в очередь повторно
+	CountOpen(ctx context.Context) (int64, error)
+	// MarkRequeued отмечает задачи отчета, еще не поставленные в очередь, поставленными повторно
+	MarkRequeued(ctx context.Context, reportID uint, actor string, at time.Time) (int64, error)
+}
+
+// GormDeadLetterRepository реализация DeadLetterRepository с использованием GORM
+type GormDeadLetterRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormDeadLetterRepository создает новый GORM репозиторий задач, исчерпавших попытки
+func NewGormDeadLetterRepository(db *gorm.DB, logger logging.Logger) DeadLetterRepository {
+	return &GormDeadLetterRepository{db: db, logger: logger}
+}
+
+// Create сохраняет задачу, исчерпавшую попытки
+func (r *GormDeadLetterRepository) Create(ctx context.Context, letter *models.DeadLetter) error {
+	return r.db.WithContext(ctx).Create(letter).Error
+}
+
+// GetByID получает задачу, исчерпавшую попытки, по ID
+func (r *GormDeadLetterRepository) GetByID(ctx context.Context, id uint) (*models.DeadLetter, error) {
+	var letter models.DeadLetter
+	err := r.db.WithContext(ctx).First(&letter, id).Error
+	return &letter, err
+}
+
+// List возвращает страницу задач, исчерпавших попытки, новые первыми, и их общее число
+func (r *GormDeadLetterRepository) List(ctx context.Context, params DeadLetterListParams) ([]models.DeadLetter, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.DeadLetter{})
+	if params.Requeued {
+		query = query.Where("requeued_at IS NOT NULL")
+	} else {
+		query = query.Where("requeued_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (params.Page - 1) * params.PageSize
+	var letters []models.DeadLetter
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(params.PageSize).Find(&letters).Error
+
+	return letters, total, err
+}
+
+// CountOpen возвращает число задач, отчеты которых еще не поставлены в очередь повторно
+func (r *GormDeadLetterRepository) CountOpen(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.DeadLetter{}).Where("requeued_at IS NULL").Count(&count).Error
+	return count, err
+}
+
+// MarkRequeued отмечает задачи отчета поставленными в очередь повторно
+func (r *GormDeadLetterRepository) MarkRequeued(ctx context.Context, reportID uint, actor string, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.DeadLetter{}).
+		Where("report_id = ? AND requeued_at IS NULL", reportID).
+		Updates(map[string]interface{}{
+			"requeued_at": at,
+			"requeued_by": actor,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// newDeadLetter создает запись задачи генерации отчета, исчерпавшей attempts попыток
+func newDeadLetter(task Task, reportID uint, attempts int, cause error) *models.DeadLetter {
+	code, _ := classifyError(cause)
+	return &models.DeadLetter{
+		ReportID:     reportID,
+		TaskID:       task.ID,
+		TaskType:     string(task.Type),
+		Priority:     int(task.Priority),
+		Attempts:     attempts,
+		ErrorCode:    code,
+		ErrorMessage: truncateMessage(cause.Error(), maxDeadLetterMessageLength),
+		RequestID:    task.RequestID,
+	}
+}
+
+// saveDeadLetter сохраняет задачу, исчерпавшую попытки. Ошибка сохранения только записывается
+// в лог: отчет уже помечен failed и виден в списке упавших
+func saveDeadLetter(ctx context.Context, repository DeadLetterRepository, logger logging.Logger, letter *models.DeadLetter) {
+	if repository == nil {
+		return
+	}
+	if err := repository.Create(ctx, letter); err != nil {
+		logger.WithError(err).Error("Ошибка сохранения задачи, исчерпавшей попытки")
+		return
+	}
+	logger.WithFields(logging.Fields{
+		"dead_letter_id": letter.ID,
+		"attempts":       letter.Attempts,
+	}).Warn("Задача исчерпала попытки и сохранена для повторного запуска")
+}
@@ -0,0 +1,533 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/query"
+	"report_srv/internal/schema"
+	"report_srv/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDefinitionNotFound определение отчета не найдено
+	ErrDefinitionNotFound = newCategoryError(ErrNotFound, "определение отчета не найдено")
+	// ErrInvalidDefinition определение отчета не прошло проверку
+	ErrInvalidDefinition = newCategoryError(ErrValidation, "некорректное определение отчета")
+	// ErrDefinitionExists определение с таким именем уже существует
+	ErrDefinitionExists = newCategoryError(ErrConflict, "определение отчета с таким именем уже существует")
+	// ErrTemplateRequired формат доступен только для отчетов по определению с шаблоном
+	ErrTemplateRequired = newCategoryError(ErrValidation, "формат доступен только для определений отчетов с шаблоном")
+)
+
+// QueryValidator проверяет SQL запросы определений отчетов
+type QueryValidator interface {
+	Validate(sql string) error
+}
+
+// NewQueryValidatorFromConfig создает валидатор запросов со списком разрешенных таблиц из конфигурации
+func NewQueryValidatorFromConfig(cfg config.Config, logger logging.Logger) (QueryValidator, error) {
+	validator, err := query.NewValidator(cfg.Definitions.AllowedTables)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка настройки проверки запросов определений: %w", err)
+	}
+	if !validator.Restricted() {
+		logger.Warn("Список разрешенных таблиц не задан: запросы определений отчетов могут читать любые таблицы")
+	}
+	return validator, nil
+}
+
+// DefinitionService интерфейс для работы с определениями отчетов
+type DefinitionService interface {
+	CreateDefinition(ctx context.Context, definition *models.ReportDefinition) error
+	GetDefinition(ctx context.Context, id uint) (*models.ReportDefinition, error)
+	ListDefinitions(ctx context.Context, params ListDefinitionParams) (*DefinitionList, error)
+	UpdateDefinition(ctx context.Context, id uint, params DefinitionUpdateParams) (*models.ReportDefinition, error)
+	DeleteDefinition(ctx context.Context, id uint) error
+	ValidateDefinition(ctx context.Context, definition *models.ReportDefinition) (*DefinitionValidation, error)
+	// PauseSchedules приостанавливает запуски расписаний определения
+	PauseSchedules(ctx context.Context, id uint, updatedBy string) (*models.ReportDefinition, error)
+	// ResumeSchedules возобновляет запуски расписаний определения
+	ResumeSchedules(ctx context.Context, id uint, updatedBy string) (*models.ReportDefinition, error)
+}
+
+// DefinitionRepository интерфейс для работы с определениями отчетов в базе данных
+type DefinitionRepository interface {
+	Create(ctx context.Context, definition *models.ReportDefinition) error
+	GetByID(ctx context.Context, id uint) (*models.ReportDefinition, error)
+	GetByName(ctx context.Context, name string) (*models.ReportDefinition, error)
+	List(ctx context.Context, params ListDefinitionParams) ([]models.ReportDefinition, int64, error)
+	// ListWithSLA возвращает определения, для которых заданы сроки SLA
+	ListWithSLA(ctx context.Context) ([]models.ReportDefinition, error)
+	Update(ctx context.Context, id uint, updates map[string]interface{}) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// ListDefinitionParams параметры для получения списка определений
+type ListDefinitionParams struct {
+	Page     int `json:"page"`
+	PageSize int `json:"page_size"`
+}
+
+// DefinitionUpdateParams параметры для обновления определения. Имя определения не меняется:
+// по нему на определение ссылаются клиенты.
+type DefinitionUpdateParams struct {
+	Description     *string              `json:"description,omitempty"`
+	TemplateKey     *string              `json:"template_key,omitempty"`
+	Queries         *models.Queries      `json:"queries,omitempty"`
+	ParameterSchema *models.JSON         `json:"parameter_schema,omitempty"`
+	Format          *models.ReportFormat `json:"format,omitempty"`
+	// ExcelLayout новое оформление Excel отчета, пустое оформление удаляет текущее
+	ExcelLayout *models.ExcelLayout `json:"excel_layout,omitempty"`
+	// ColumnMapping новое преобразование колонок, пустое преобразование удаляет текущее
+	ColumnMapping *models.ColumnMapping `json:"column_mapping,omitempty"`
+	// Masking новые правила маскирования, пустой список удаляет текущие
+	Masking *models.MaskingRules `json:"masking,omitempty"`
+	// Iterator новый итерационный запрос, пустой запрос удаляет текущий
+	Iterator *models.Iterator `json:"iterator,omitempty"`
+	// MaxConcurrentRuns новое ограничение одновременных запусков, 0 снимает ограничение
+	MaxConcurrentRuns *int `json:"max_concurrent_runs,omitempty"`
+	// DedupeWindow новый срок объединения запусков, пустая строка отключает объединение
+	DedupeWindow *string `json:"dedupe_window,omitempty"`
+	// SLA новые сроки генерации, пустые сроки отключают отслеживание
+	SLA *models.SLA `json:"sla,omitempty"`
+	// NotificationChannels новые каналы для сообщений об отчетах, пустой список удаляет текущие
+	NotificationChannels *models.NotificationChannels `json:"notification_channels,omitempty"`
+	// Document новые свойства документа и водяной знак, пустые значения удаляют текущие
+	Document  *models.DocumentOptions `json:"document,omitempty"`
+	UpdatedBy string                  `json:"updated_by"`
+}
+
+// DefinitionList результат получения списка определений с пагинацией
+type DefinitionList struct {
+	Definitions []models.ReportDefinition `json:"definitions"`
+	Total       int64                     `json:"total"`
+	Page        int                       `json:"page"`
+	PageSize    int                       `json:"page_size"`
+	TotalPages  int                       `json:"total_pages"`
+}
+
+// DefinitionServiceImpl реализация сервиса определений отчетов
+type DefinitionServiceImpl struct {
+	repository DefinitionRepository
+	queries    QueryValidator
+	sources    DataSources
+	templates  ReportFileStorage
+	logger     logging.Logger
+}
+
+// NewDefinitionService создает новый сервис определений отчетов. Шаблоны определений
+// читаются из fileStorage при проверке определения.
+func NewDefinitionService(
+	repository DefinitionRepository,
+	queries QueryValidator,
+	sources DataSources,
+	fileStorage storage.Storage,
+	logger logging.Logger,
+) DefinitionService {
+	return &DefinitionServiceImpl{
+		repository: repository,
+		queries:    queries,
+		sources:    sources,
+		templates:  NewReportFileStorage(fileStorage, logger),
+		logger:     logger,
+	}
+}
+
+// CreateDefinition создает новое определение отчета
+func (s *DefinitionServiceImpl) CreateDefinition(ctx context.Context, definition *models.ReportDefinition) error {
+	definition.CreatedBy = actorOr(ctx, definition.CreatedBy)
+	if actor := ActorFromContext(ctx); actor != "" {
+		definition.UpdatedBy = actor
+	}
+
+	logger := logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"name":       definition.Name,
+		"created_by": definition.CreatedBy,
+	})
+
+	definition.Name = strings.TrimSpace(definition.Name)
+	if definition.UpdatedBy == "" {
+		definition.UpdatedBy = definition.CreatedBy
+	}
+	if definition.Format == "" {
+		definition.Format = models.DefaultFormat
+		if definition.HasTemplate() {
+			definition.Format = models.FormatDOCX
+		}
+	}
+
+	if err := s.validateDefinition(definition); err != nil {
+		return err
+	}
+
+	if _, err := s.repository.GetByName(ctx, definition.Name); err == nil {
+		return fmt.Errorf("%w: %s", ErrDefinitionExists, definition.Name)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("ошибка проверки имени определения: %w", err)
+	}
+
+	if err := s.repository.Create(ctx, definition); err != nil {
+		logger.WithError(err).Error("Ошибка сохранения определения отчета в БД")
+		return fmt.Errorf("ошибка создания определения отчета: %w", err)
+	}
+
+	logger.WithField("definition_id", definition.ID).Info("Определение отчета создано")
+	return nil
+}
+
+// GetDefinition получает определение отчета по ID
+func (s *DefinitionServiceImpl) GetDefinition(ctx context.Context, id uint) (*models.ReportDefinition, error) {
+	definition, err := s.repository.GetByID(ctx, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %d", ErrDefinitionNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения определения отчета: %w", err)
+	}
+	return definition, nil
+}
+
+// ListDefinitions получает список определений отчетов с пагинацией
+func (s *DefinitionServiceImpl) ListDefinitions(ctx context.Context, params ListDefinitionParams) (*DefinitionList, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 20
+	}
+	if params.PageSize > 100 {
+		params.PageSize = 100
+	}
+
+	definitions, total, err := s.repository.List(ctx, params)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).Error("Ошибка получения списка определений отчетов")
+		return nil, fmt.Errorf("ошибка получения списка определений отчетов: %w", err)
+	}
+
+	totalPages := int((total + int64(params.PageSize) - 1) / int64(params.PageSize))
+
+	return &DefinitionList{
+		Definitions: definitions,
+		Total:       total,
+		Page:        params.Page,
+		PageSize:    params.PageSize,
+		TotalPages:  totalPages,
+	}, nil
+}
+
+// UpdateDefinition обновляет определение отчета. Изменения применяются к отчетам,
+// которые будут сгенерированы после обновления.
+func (s *DefinitionServiceImpl) UpdateDefinition(ctx context.Context, id uint, params DefinitionUpdateParams) (*models.ReportDefinition, error) {
+	definition, err := s.GetDefinition(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	updates["updated_by"] = actorOr(ctx, params.UpdatedBy)
+	updates["updated_at"] = time.Now().UTC()
+
+	if params.Description != nil {
+		definition.Description = *params.Description
+		updates["description"] = *params.Description
+	}
+	if params.TemplateKey != nil {
+		definition.TemplateKey = *params.TemplateKey
+		updates["template_key"] = *params.TemplateKey
+	}
+	if params.Queries != nil {
+		definition.Queries = *params.Queries
+		updates["queries"] = *params.Queries
+	}
+	if params.ParameterSchema != nil {
+		definition.ParameterSchema = *params.ParameterSchema
+		updates["parameter_schema"] = *params.ParameterSchema
+	}
+	if params.Format != nil {
+		definition.Format = *params.Format
+		updates["format"] = *params.Format
+	}
+	if params.ExcelLayout != nil {
+		definition.ExcelLayout = params.ExcelLayout
+		if params.ExcelLayout.IsEmpty() {
+			definition.ExcelLayout = nil
+		}
+		updates["excel_layout"] = *params.ExcelLayout
+	}
+	if params.ColumnMapping != nil {
+		definition.ColumnMapping = params.ColumnMapping
+		if params.ColumnMapping.IsEmpty() {
+			definition.ColumnMapping = nil
+		}
+		updates["column_mapping"] = *params.ColumnMapping
+	}
+	if params.Masking != nil {
+		definition.Masking = *params.Masking
+		updates["masking"] = *params.Masking
+	}
+	if params.Iterator != nil {
+		definition.Iterator = params.Iterator
+		if params.Iterator.IsEmpty() {
+			definition.Iterator = nil
+		}
+		updates["iterator"] = *params.Iterator
+	}
+	if params.MaxConcurrentRuns != nil {
+		definition.MaxConcurrentRuns = *params.MaxConcurrentRuns
+		updates["max_concurrent_runs"] = *params.MaxConcurrentRuns
+	}
+	if params.DedupeWindow != nil {
+		definition.DedupeWindow = *params.DedupeWindow
+		updates["dedupe_window"] = *params.DedupeWindow
+	}
+	if params.SLA != nil {
+		definition.SLA = params.SLA
+		if params.SLA.IsEmpty() {
+			definition.SLA = nil
+		}
+		updates["sla"] = *params.SLA
+	}
+	if params.NotificationChannels != nil {
+		definition.NotificationChannels = *params.NotificationChannels
+		updates["notification_channels"] = *params.NotificationChannels
+	}
+	if params.Document != nil {
+		definition.Document = params.Document
+		if params.Document.IsEmpty() {
+			definition.Document = nil
+		}
+		updates["document"] = *params.Document
+	}
+
+	definition.UpdatedBy = params.UpdatedBy
+	if err := s.validateDefinition(definition); err != nil {
+		return nil, err
+	}
+
+	if err := s.repository.Update(ctx, id, updates); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("definition_id", id).Error("Ошибка обновления определения отчета")
+		return nil, fmt.Errorf("ошибка обновления определения отчета: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithField("definition_id", id).Info("Определение отчета обновлено")
+	return definition, nil
+}
+
+// DeleteDefinition удаляет определение отчета. Отчеты, созданные по нему, сохраняются
+func (s *DefinitionServiceImpl) DeleteDefinition(ctx context.Context, id uint) error {
+	if _, err := s.GetDefinition(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.repository.Delete(ctx, id); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("definition_id", id).Error("Ошибка удаления определения отчета")
+		return fmt.Errorf("ошибка удаления определения отчета: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithField("definition_id", id).Info("Определение отчета удалено")
+	return nil
+}
+
+// PauseSchedules приостанавливает запуски расписаний определения. Пропущенные запуски
+// не повторяются после возобновления, отчеты в очереди генерируются как обычно
+func (s *DefinitionServiceImpl) PauseSchedules(ctx context.Context, id uint, updatedBy string) (*models.ReportDefinition, error) {
+	definition, err := s.GetDefinition(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if definition.SchedulesPaused {
+		return definition, nil
+	}
+
+	now := time.Now().UTC()
+	actor := actorOr(ctx, updatedBy)
+	updates := map[string]interface{}{
+		"schedules_paused":    true,
+		"schedules_paused_at": now,
+		"schedules_paused_by": actor,
+		"updated_by":          actor,
+		"updated_at":          now,
+	}
+	if err := s.repository.Update(ctx, id, updates); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("definition_id", id).Error("Ошибка приостановки расписаний определения")
+		return nil, fmt.Errorf("ошибка приостановки расписаний определения: %w", err)
+	}
+
+	definition.SchedulesPaused = true
+	definition.SchedulesPausedAt = &now
+	definition.SchedulesPausedBy = actor
+	definition.UpdatedBy = actor
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"definition_id": id,
+		"name":          definition.Name,
+	}).Warn("Расписания определения приостановлены")
+	return definition, nil
+}
+
+// ResumeSchedules возобновляет запуски расписаний определения со следующего времени по расписанию
+func (s *DefinitionServiceImpl) ResumeSchedules(ctx context.Context, id uint, updatedBy string) (*models.ReportDefinition, error) {
+	definition, err := s.GetDefinition(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !definition.SchedulesPaused {
+		return definition, nil
+	}
+
+	actor := actorOr(ctx, updatedBy)
+	updates := map[string]interface{}{
+		"schedules_paused":    false,
+		"schedules_paused_at": nil,
+		"schedules_paused_by": "",
+		"updated_by":          actor,
+		"updated_at":          time.Now().UTC(),
+	}
+	if err := s.repository.Update(ctx, id, updates); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("definition_id", id).Error("Ошибка возобновления расписаний определения")
+		return nil, fmt.Errorf("ошибка возобновления расписаний определения: %w", err)
+	}
+
+	definition.SchedulesPaused = false
+	definition.SchedulesPausedAt = nil
+	definition.SchedulesPausedBy = ""
+	definition.UpdatedBy = actor
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"definition_id": id,
+		"name":          definition.Name,
+	}).Info("Расписания определения возобновлены")
+	return definition, nil
+}
+
+// validateDefinition проверяет поля определения, запросы и схему параметров
+func (s *DefinitionServiceImpl) validateDefinition(definition *models.ReportDefinition) error {
+	return checkDefinition(definition, s.queries, s.sources)
+}
+
+// checkDefinition проверяет поля определения, запросы по разрешенным таблицам и источникам
+// данных и схему параметров
+func checkDefinition(definition *models.ReportDefinition, queries QueryValidator, sources DataSources) error {
+	if err := definition.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+
+	for _, definitionQuery := range definition.Queries {
+		if definitionQuery.IsUploaded() || definitionQuery.IsDerived() {
+			continue
+		}
+		if !definitionQuery.IsHTTP() {
+			if err := queries.Validate(definitionQuery.SQL); err != nil {
+				return fmt.Errorf("%w: запрос %s: %v", ErrInvalidDefinition, definitionQuery.Name, err)
+			}
+		} else if _, err := parseRowsPath(definitionQuery.Rows); err != nil {
+			return fmt.Errorf("%w: запрос %s: %v", ErrInvalidDefinition, definitionQuery.Name, err)
+		}
+		if !sources.Has(definitionQuery.Source) {
+			return fmt.Errorf("%w: запрос %s: неизвестный источник данных %s", ErrInvalidDefinition, definitionQuery.Name, definitionQuery.Source)
+		}
+	}
+
+	if !definition.Iterator.IsEmpty() {
+		if err := queries.Validate(definition.Iterator.SQL); err != nil {
+			return fmt.Errorf("%w: итерационный запрос: %v", ErrInvalidDefinition, err)
+		}
+		if !sources.Has(definition.Iterator.Source) {
+			return fmt.Errorf("%w: итерационный запрос: неизвестный источник данных %s", ErrInvalidDefinition, definition.Iterator.Source)
+		}
+	}
+
+	if _, err := definitionSchema(definition); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+
+	return nil
+}
+
+// definitionSchema компилирует схему параметров определения. nil - схема не задана
+func definitionSchema(definition *models.ReportDefinition) (*schema.Schema, error) {
+	if definition.ParameterSchema.IsEmpty() {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(definition.ParameterSchema)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сериализации схемы параметров: %w", err)
+	}
+	return schema.Compile(definition.Name+".json", raw)
+}
+
+// GormDefinitionRepository реализация репозитория определений отчетов для GORM
+type GormDefinitionRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormDefinitionRepository создает новый GORM репозиторий определений отчетов
+func NewGormDefinitionRepository(db *gorm.DB, logger logging.Logger) DefinitionRepository {
+	return &GormDefinitionRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create создает новое определение в БД
+func (r *GormDefinitionRepository) Create(ctx context.Context, definition *models.ReportDefinition) error {
+	return r.db.WithContext(ctx).Create(definition).Error
+}
+
+// GetByID получает определение по ID
+func (r *GormDefinitionRepository) GetByID(ctx context.Context, id uint) (*models.ReportDefinition, error) {
+	var definition models.ReportDefinition
+	err := r.db.WithContext(ctx).First(&definition, id).Error
+	return &definition, err
+}
+
+// GetByName получает определение по имени
+func (r *GormDefinitionRepository) GetByName(ctx context.Context, name string) (*models.ReportDefinition, error) {
+	var definition models.ReportDefinition
+	err := r.db.WithContext(ctx).Where("name = ?", name).First(&definition).Error
+	return &definition, err
+}
+
+// List получает список определений с пагинацией
+func (r *GormDefinitionRepository) List(ctx context.Context, params ListDefinitionParams) ([]models.ReportDefinition, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.ReportDefinition{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (params.Page - 1) * params.PageSize
+	var definitions []models.ReportDefinition
+	err := query.Order("name").Offset(offset).Limit(params.PageSize).Find(&definitions).Error
+
+	return definitions, total, err
+}
+
+// ListWithSLA возвращает определения, для которых заданы сроки SLA
+func (r *GormDefinitionRepository) ListWithSLA(ctx context.Context) ([]models.ReportDefinition, error) {
+	var definitions []models.ReportDefinition
+	err := r.db.WithContext(ctx).Where("sla IS NOT NULL").Order("name").Find(&definitions).Error
+	return definitions, err
+}
+
+// Update обновляет определение
+func (r *GormDefinitionRepository) Update(ctx context.Context, id uint, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&models.ReportDefinition{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Delete удаляет определение
+func (r *GormDefinitionRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.ReportDefinition{}, id).Error
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/database"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/query"
+	"report_srv/internal/schema"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+func setupDefinitionTest(t *testing.T) (*gorm.DB, DefinitionRepository) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.ReportDefinition{}))
+	return db, NewGormDefinitionRepository(db, setupTestLogger())
+}
+
+func newTestDataSources(t *testing.T, db *gorm.DB, sources map[string]config.DataSource) *database.DataSourceManager {
+	manager := database.NewDataSourceManager(config.Config{DataSources: sources}, db, setupTestLogger())
+	t.Cleanup(func() { manager.Close() })
+	return manager
+}
+
+func newTestQueryValidator(t *testing.T, allowedTables ...string) QueryValidator {
+	validator, err := query.NewValidator(allowedTables)
+	require.NoError(t, err)
+	return validator
+}
+
+func newTestDefinition() *models.ReportDefinition {
+	return &models.ReportDefinition{
+		Name: "sales",
+		Queries: models.Queries{
+			{Name: "totals", SQL: "SELECT region, amount FROM sales WHERE region = @region ORDER BY amount"},
+		},
+		ParameterSchema: models.JSON{
+			"type":       "object",
+			"properties": map[string]interface{}{"region": map[string]interface{}{"type": "string"}},
+			"required":   []interface{}{"region"},
+		},
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+}
+
+func TestDefinitionServiceCRUD(t *testing.T) {
+	db, repository := setupDefinitionTest(t)
+	service := NewDefinitionService(repository, newTestQueryValidator(t, "sales"), newTestDataSources(t, db, nil), new(MockStorage), setupTestLogger())
+	ctx := context.Background()
+
+	definition := newTestDefinition()
+	require.NoError(t, service.CreateDefinition(ctx, definition))
+	assert.NotZero(t, definition.ID)
+	assert.Equal(t, models.FormatXLSX, definition.Format)
+
+	// Имя определения уникально
+	err := service.CreateDefinition(ctx, newTestDefinition())
+	assert.ErrorIs(t, err, ErrDefinitionExists)
+
+	// Допускаются только запросы на чтение
+	invalid := newTestDefinition()
+	invalid.Name = "invalid"
+	invalid.Queries = models.Queries{{Name: "drop", SQL: "DELETE FROM sales"}}
+	assert.ErrorIs(t, service.CreateDefinition(ctx, invalid), ErrInvalidDefinition)
+
+	// Запросы читают только разрешенные таблицы
+	invalid.Queries = models.Queries{{Name: "users", SQL: "SELECT id, updated_at FROM sales WHERE id IN (SELECT id FROM users)"}}
+	err = service.CreateDefinition(ctx, invalid)
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+	assert.ErrorContains(t, err, "users")
+
+	// Источник данных должен быть объявлен в конфигурации
+	invalid.Queries = models.Queries{{Name: "totals", SQL: "SELECT * FROM sales", Source: "warehouse"}}
+	err = service.CreateDefinition(ctx, invalid)
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+	assert.ErrorContains(t, err, "warehouse")
+
+	// Шаблонный формат требует шаблон
+	format := models.FormatDOCX
+	_, err = service.UpdateDefinition(ctx, definition.ID, DefinitionUpdateParams{Format: &format, UpdatedBy: "editor"})
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+
+	description := "Продажи по регионам"
+	updated, err := service.UpdateDefinition(ctx, definition.ID, DefinitionUpdateParams{Description: &description, UpdatedBy: "editor"})
+	require.NoError(t, err)
+	assert.Equal(t, description, updated.Description)
+
+	stored, err := service.GetDefinition(ctx, definition.ID)
+	require.NoError(t, err)
+	assert.Equal(t, description, stored.Description)
+	assert.Equal(t, "editor", stored.UpdatedBy)
+	assert.Equal(t, definition.Queries, stored.Queries)
+
+	list, err := service.ListDefinitions(ctx, ListDefinitionParams{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), list.Total)
+
+	require.NoError(t, service.DeleteDefinition(ctx, definition.ID))
+	_, err = service.GetDefinition(ctx, definition.ID)
+	assert.Error(t, err)
+}
+
+func TestCreateReportByDefinition(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := newTestDefinition()
+	require.NoError(t, NewDefinitionService(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), new(MockStorage), logger).CreateDefinition(ctx, definition))
+
+	service := NewReportService(NewGormReportRepository(db, logger), NewFormatGenerators(logger),
+		NewReportFileStorage(new(MockStorage), logger), &stubProcessor{}, events.NewInProcessBus(logger), logger).
+		WithDefinitions(definitions)
+
+	newReport := func(reportType string, params models.JSON, format models.ReportFormat) *models.Report {
+		return &models.Report{Title: "Report", Type: reportType, Parameters: params, Format: format, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	}
+
+	// Параметры проверяются по схеме определения
+	var validationErr *schema.ValidationError
+	err := service.CreateReport(ctx, newReport("sales", models.JSON{}, ""))
+	assert.ErrorAs(t, err, &validationErr)
+
+	report := newReport("sales", models.JSON{"region": "north"}, "")
+	require.NoError(t, service.CreateReport(ctx, report))
+	require.NotNil(t, report.DefinitionID)
+	assert.Equal(t, definition.ID, *report.DefinitionID)
+	assert.Equal(t, definition.Format, report.Format)
+
+	// Шаблонный формат недоступен без определения с шаблоном
+	err = service.CreateReport(ctx, newReport("", nil, models.FormatDOCX))
+	assert.ErrorIs(t, err, ErrTemplateRequired)
+
+	// Тип без определения и без схемы
+	err = service.CreateReport(ctx, newReport("unknown", nil, ""))
+	assert.ErrorIs(t, err, ErrUnknownReportType)
+}
+
+func TestDefinitionDataLoaderRunsQueries(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("CREATE TABLE sales (region TEXT, amount INTEGER)").Error)
+	require.NoError(t, db.Exec("INSERT INTO sales VALUES ('north', 20), ('north', 10), ('south', 30)").Error)
+
+	// Второй запрос выполняется в отдельном источнике данных
+	sources := newTestDataSources(t, db, map[string]config.DataSource{
+		"warehouse": {Driver: "sqlite", DSN: "file:warehouse?mode=memory&cache=shared"},
+	})
+	warehouse, err := sources.DB(ctx, "warehouse")
+	require.NoError(t, err)
+	require.NoError(t, warehouse.Exec("CREATE TABLE regions (name TEXT)").Error)
+	require.NoError(t, warehouse.Exec("INSERT INTO regions VALUES ('north'), ('south')").Error)
+
+	definition := newTestDefinition()
+	definition.Queries = append(definition.Queries, models.Query{Name: "regions", SQL: "SELECT COUNT(*) AS regions FROM regions", Source: "warehouse", Sheet: "Регионы"})
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t), sources, NewReportFileStorage(new(MockStorage), logger), logger)
+	data, err := loader.Load(ctx, &models.Report{DefinitionID: &definition.ID, Parameters: models.JSON{"region": "north"}})
+	require.NoError(t, err)
+	defer data.Close()
+
+	require.Len(t, data.Datasets, 2)
+	assert.Nil(t, data.Template)
+	assert.Equal(t, "", data.Datasets[0].Sheet)
+	assert.Equal(t, "Регионы", data.Datasets[1].Sheet)
+
+	rows := data.Rows()
+	assert.Equal(t, []string{"region", "amount"}, rows.Columns())
+
+	var result [][]interface{}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		result = append(result, row)
+	}
+
+	assert.Equal(t, [][]interface{}{
+		{"north", int64(10)},
+		{"north", int64(20)},
+		{},
+		{"regions"},
+		{int64(2)},
+	}, result)
+}
+
+func TestExecutorRecordsQueryFailure(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := newTestDefinition()
+	require.NoError(t, definitions.Create(ctx, definition))
+	report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatXLSX, DefinitionID: &definition.ID,
+		Parameters: models.JSON{"region": "north"}, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+
+	// Файл генерируется потоково: ошибка запроса возвращается хранилищу при чтении файла
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+
+	repository := NewGormReportRepository(db, logger)
+	fileStorage := NewReportFileStorage(local, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), fileStorage, logger).
+		WithDataLoader(NewDefinitionDataLoader(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), fileStorage, logger))
+
+	// Таблица sales не создана: запрос завершается ошибкой при генерации файла
+	task := Task{ID: "report_1", Type: TaskTypeReportGeneration, Data: report.ID}
+	err = executor.Execute(ctx, task)
+	require.Error(t, err)
+	executor.Fail(ctx, task, 1, err)
+
+	failed, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, failed.Status)
+	assert.Equal(t, models.ErrorCodeQuery, failed.ErrorCode)
+	assert.Contains(t, failed.ErrorMessage, "no such table: sales")
+
+	// Повторная генерация сбрасывает причину ошибки
+	require.NoError(t, repository.UpdateStatus(ctx, report.ID, models.StatusProcessing, ""))
+	restarted, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Empty(t, restarted.ErrorCode)
+	assert.Empty(t, restarted.ErrorMessage)
+
+	code, _ := classifyError(fmt.Errorf("генерация: %w", context.DeadlineExceeded))
+	assert.Equal(t, models.ErrorCodeTimeout, code)
+}
+
+func TestExecutorRecordsProgress(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("CREATE TABLE sales (region TEXT, amount INTEGER)").Error)
+	require.NoError(t, db.Exec("INSERT INTO sales VALUES ('north', 20), ('north', 10), ('south', 30)").Error)
+
+	definition := newTestDefinition()
+	definition.Queries = append(definition.Queries, models.Query{Name: "count", SQL: "SELECT COUNT(*) AS total FROM sales"})
+	require.NoError(t, definitions.Create(ctx, definition))
+	report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV, DefinitionID: &definition.ID,
+		Parameters: models.JSON{"region": "north"}, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+
+	// Сохранение читает поток, чтобы CSV генератор прочитал наборы
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		io.Copy(io.Discard, args.Get(2).(io.Reader))
+	})
+
+	repository := NewGormReportRepository(db, logger)
+	fileStorage := NewReportFileStorage(mockStorage, logger)
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), fileStorage, logger)
+
+	var progress []GenerationProgress
+	data, err := loader.Load(ctx, report)
+	require.NoError(t, err)
+	data.WithProgress(func(p GenerationProgress) { progress = append(progress, p) })
+	reader, _, err := NewCSVReportGenerator(logger).Generate(ctx, report, data)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+	data.Close()
+
+	assert.Equal(t, []GenerationProgress{
+		{Percent: 0, Rows: 1}, {Percent: 0, Rows: 2}, {Percent: 45, Rows: 2}, {Percent: 45, Rows: 3}, {Percent: 90, Rows: 3},
+	}, progress)
+
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), fileStorage, logger).WithDataLoader(loader)
+	require.NoError(t, executor.Execute(ctx, Task{ID: "report_1", Type: TaskTypeReportGeneration, Data: report.ID}))
+
+	completed, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, completed.Status)
+	assert.Equal(t, 100, completed.Progress)
+	assert.Equal(t, int64(3), completed.RowsProcessed)
+}
+
+func TestDefinitionServiceValidateDefinition(t *testing.T) {
+	db, repository := setupDefinitionTest(t)
+	fileStorage := new(MockStorage)
+	service := NewDefinitionService(repository, newTestQueryValidator(t, "sales"), newTestDataSources(t, db, nil), fileStorage, setupTestLogger())
+	ctx := context.Background()
+
+	validation, err := service.ValidateDefinition(ctx, newTestDefinition())
+	require.NoError(t, err)
+	assert.True(t, validation.Valid)
+	assert.Empty(t, validation.Problems)
+
+	tmpl := excelize.NewFile()
+	defer tmpl.Close()
+	for cell, value := range map[string]string{
+		"A1": "{{report_title}} {{region}} {{year}}",
+		"A2": "{{.region}}", "B2": "{{.total}}",
+	} {
+		require.NoError(t, tmpl.SetCellValue("Sheet1", cell, value))
+	}
+	content, err := tmpl.WriteToBuffer()
+	require.NoError(t, err)
+	fileStorage.On("Get", mock.Anything, "templates/sales.xlsx").Return(io.NopCloser(bytes.NewReader(content.Bytes())), nil).Once()
+	fileStorage.On("Get", mock.Anything, "templates/missing.xlsx").Return(io.NopCloser(bytes.NewReader(nil)), fmt.Errorf("not found"))
+
+	definition := newTestDefinition()
+	definition.TemplateKey = "templates/sales.xlsx"
+	definition.Format = models.FormatXLSX
+	definition.Queries = models.Queries{
+		{Name: "totals", SQL: "SELECT region, amount FROM sales WHERE region = @region AND period = @period"},
+		{Name: "users", SQL: "SELECT * FROM users", Source: "warehouse"},
+	}
+	definition.ParameterSchema = models.JSON{"type": "object", "properties": "invalid"}
+
+	validation, err = service.ValidateDefinition(ctx, definition)
+	require.NoError(t, err)
+	assert.False(t, validation.Valid)
+	fields := make([]string, 0, len(validation.Problems))
+	for _, problem := range validation.Problems {
+		fields = append(fields, problem.Field)
+	}
+	// Без свойств схемы параметры не проверяются, колонки запроса - проверяются
+	assert.Equal(t, []string{"parameter_schema", "queries[1].source", "queries[1].sql", "template"}, fields)
+
+	// Параметры запросов и плейсхолдеры сверяются со схемой и колонками запросов
+	definition = newTestDefinition()
+	definition.TemplateKey = "templates/sales.xlsx"
+	definition.Format = models.FormatXLSX
+	definition.Queries[0].SQL = "SELECT region, amount FROM sales WHERE region = @region AND period = @period"
+	fileStorage.On("Get", mock.Anything, "templates/sales.xlsx").Return(io.NopCloser(bytes.NewReader(content.Bytes())), nil).Once()
+	validation, err = service.ValidateDefinition(ctx, definition)
+	require.NoError(t, err)
+	require.Len(t, validation.Problems, 3)
+	assert.Equal(t, DefinitionProblem{Field: "queries[0].sql", Query: "totals", Message: "параметр @period не описан в схеме параметров"}, validation.Problems[0])
+	assert.Equal(t, DefinitionProblem{Field: "template", Location: "Sheet1!A1", Placeholder: "{{year}}", Message: "неизвестное поле или параметр year"}, validation.Problems[1])
+	assert.Equal(t, "Sheet1!B2", validation.Problems[2].Location)
+	assert.Equal(t, "{{.total}}", validation.Problems[2].Placeholder)
+
+	definition.TemplateKey = "templates/missing.xlsx"
+	validation, err = service.ValidateDefinition(ctx, definition)
+	require.NoError(t, err)
+	require.Len(t, validation.Problems, 2)
+	assert.Equal(t, "template_key", validation.Problems[1].Field)
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"report_srv/internal/models"
+	"report_srv/internal/query"
+	"report_srv/internal/template"
+)
+
+// definitionValidationActor автор проверяемого определения, если запрос без аутентификации
+const definitionValidationActor = "validate"
+
+// templateReportFields поля отчета, доступные в шаблоне наряду с параметрами (см. newTemplateData)
+var templateReportFields = []string{"report_id", "report_title", "report_description", "report_created_by", "generated_at"}
+
+// DefinitionProblem ошибка, найденная при проверке определения отчета
+type DefinitionProblem struct {
+	// Field часть определения: definition, queries[0].sql, queries[0].source, queries[0].dataset,
+	// queries[0].path, queries[0].rows, queries[0].derived, iterator.sql, iterator.source,
+	// parameter_schema, template_key, template
+	Field string `json:"field"`
+	// Query имя запроса для ошибок запросов
+	Query string `json:"query,omitempty"`
+	// Location часть документа или ячейка шаблона
+	Location string `json:"location,omitempty"`
+	// Placeholder плейсхолдер шаблона, который не будет заполнен
+	Placeholder string `json:"placeholder,omitempty"`
+	Message     string `json:"message"`
+}
+
+// DefinitionValidation результат проверки определения отчета без сохранения
+type DefinitionValidation struct {
+	Valid    bool                `json:"valid"`
+	Problems []DefinitionProblem `json:"problems"`
+}
+
+// add добавляет ошибку в результат проверки
+func (v *DefinitionValidation) add(problem DefinitionProblem) {
+	v.Problems = append(v.Problems, problem)
+}
+
+// ValidateDefinition проверяет определение перед сохранением и возвращает все найденные ошибки:
+// поля определения, SQL запросы и их источники, схему параметров, параметры запросов, не описанные
+// в схеме, и плейсхолдеры загруженного шаблона, не совпадающие с колонками запросов.
+// Колонки запросов определяются по списку SELECT без выполнения запросов.
+func (s *DefinitionServiceImpl) ValidateDefinition(ctx context.Context, definition *models.ReportDefinition) (*DefinitionValidation, error) {
+	checked := *definition
+	checked.Name = strings.TrimSpace(checked.Name)
+	if checked.CreatedBy == "" {
+		checked.CreatedBy = actorOr(ctx, definitionValidationActor)
+	}
+	if checked.UpdatedBy == "" {
+		checked.UpdatedBy = checked.CreatedBy
+	}
+
+	result := &DefinitionValidation{Problems: []DefinitionProblem{}}
+	for _, message := range checked.Problems() {
+		result.add(DefinitionProblem{Field: "definition", Message: message})
+	}
+
+	if _, err := definitionSchema(&checked); err != nil {
+		result.add(DefinitionProblem{Field: "parameter_schema", Message: err.Error()})
+	}
+	parameters := schemaProperties(checked.ParameterSchema)
+
+	shape := template.DataShape{Datasets: make([]template.DatasetShape, 0, len(checked.Queries))}
+	if parameters != nil {
+		shape.Fields = append(slices.Clone(templateReportFields), parameters...)
+	}
+	// Колонки результатов запросов до преобразований, по ним проверяются производные наборы
+	resultColumns := make(map[string][]string, len(checked.Queries))
+	for i, definitionQuery := range checked.Queries {
+		shape.Datasets = append(shape.Datasets, template.DatasetShape{Name: definitionQuery.Name})
+		field := fmt.Sprintf("queries[%d]", i)
+
+		if definitionQuery.IsDerived() {
+			inputs := make([][]string, 0, len(definitionQuery.Derived.Inputs))
+			for _, input := range definitionQuery.Derived.Inputs {
+				if columns, known := resultColumns[input]; known {
+					inputs = append(inputs, columns)
+				}
+			}
+			if len(inputs) < len(definitionQuery.Derived.Inputs) {
+				continue
+			}
+			plan, err := planDerived(definitionQuery.Derived, inputs)
+			if err != nil {
+				result.add(DefinitionProblem{Field: field + ".derived", Query: definitionQuery.Name, Message: err.Error()})
+				continue
+			}
+			resultColumns[definitionQuery.Name] = plan.columns
+			shape.Datasets[i].Columns = mappedColumns(checked.ColumnMapping, definitionQuery.Name, plan.columns)
+			continue
+		}
+		if !s.sources.Has(definitionQuery.Source) {
+			result.add(DefinitionProblem{Field: field + ".source", Query: definitionQuery.Name,
+				Message: fmt.Sprintf("неизвестный источник данных %s", definitionQuery.Source)})
+		}
+		if definitionQuery.IsUploaded() {
+			if parameters != nil && !slices.Contains(parameters, definitionQuery.Dataset) {
+				result.add(DefinitionProblem{Field: field + ".dataset", Query: definitionQuery.Name,
+					Message: fmt.Sprintf("параметр %s не описан в схеме параметров", definitionQuery.Dataset)})
+			}
+			continue
+		}
+		if definitionQuery.IsHTTP() {
+			if _, err := parseRowsPath(definitionQuery.Rows); err != nil {
+				result.add(DefinitionProblem{Field: field + ".rows", Query: definitionQuery.Name, Message: err.Error()})
+			}
+			for _, name := range pathParameters(definitionQuery.Path) {
+				if parameters != nil && !slices.Contains(parameters, name) {
+					result.add(DefinitionProblem{Field: field + ".path", Query: definitionQuery.Name,
+						Message: fmt.Sprintf("параметр {%s} не описан в схеме параметров", name)})
+				}
+			}
+			continue
+		}
+		if strings.TrimSpace(definitionQuery.SQL) == "" {
+			continue
+		}
+		if err := s.queries.Validate(definitionQuery.SQL); err != nil {
+			result.add(DefinitionProblem{Field: field + ".sql", Query: definitionQuery.Name, Message: err.Error()})
+			continue
+		}
+
+		if parameters != nil {
+			used, _ := query.Parameters(definitionQuery.SQL)
+			for _, name := range used {
+				if !slices.Contains(parameters, name) {
+					result.add(DefinitionProblem{Field: field + ".sql", Query: definitionQuery.Name,
+						Message: fmt.Sprintf("параметр @%s не описан в схеме параметров", name)})
+				}
+			}
+		}
+		if columns, complete, err := query.Columns(definitionQuery.SQL); err == nil && complete {
+			resultColumns[definitionQuery.Name] = columns
+			shape.Datasets[i].Columns = mappedColumns(checked.ColumnMapping, definitionQuery.Name, columns)
+		}
+	}
+
+	if iterator := checked.Iterator; !iterator.IsEmpty() {
+		if !s.sources.Has(iterator.Source) {
+			result.add(DefinitionProblem{Field: "iterator.source", Message: fmt.Sprintf("неизвестный источник данных %s", iterator.Source)})
+		}
+		if strings.TrimSpace(iterator.SQL) != "" {
+			if err := s.queries.Validate(iterator.SQL); err != nil {
+				result.add(DefinitionProblem{Field: "iterator.sql", Message: err.Error()})
+			}
+		}
+	}
+
+	// Скрытые запросы не выводятся в отчет, поэтому недоступны шаблону
+	visible := shape.Datasets[:0]
+	for i, dataset := range shape.Datasets {
+		if !checked.Queries[i].Hidden {
+			visible = append(visible, dataset)
+		}
+	}
+	shape.Datasets = visible
+
+	if checked.HasTemplate() {
+		s.validateTemplate(ctx, &checked, shape, result)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result, nil
+}
+
+// mappedColumns возвращает колонки набора, которыми заполняется шаблон: после переименования
+// и с вычисляемыми колонками
+func mappedColumns(mapping *models.ColumnMapping, dataset string, columns []string) []string {
+	if mapping.IsEmpty() {
+		return columns
+	}
+	_, mapped, _ := planColumns(mapping, dataset, columns)
+	return mapped
+}
+
+// validateTemplate загружает шаблон определения и сверяет его плейсхолдеры с данными отчета
+func (s *DefinitionServiceImpl) validateTemplate(ctx context.Context, definition *models.ReportDefinition, shape template.DataShape, result *DefinitionValidation) {
+	check := template.CheckDOCX
+	switch definition.Format {
+	case "", models.FormatDOCX:
+	case models.FormatXLSX:
+		check = template.CheckXLSX
+	default:
+		// Формат без шаблонов уже отмечен при проверке полей определения
+		return
+	}
+
+	reader, err := s.templates.Get(ctx, definition.TemplateKey)
+	if err != nil {
+		result.add(DefinitionProblem{Field: "template_key", Message: fmt.Sprintf("ошибка получения шаблона %s: %v", definition.TemplateKey, err)})
+		return
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		result.add(DefinitionProblem{Field: "template_key", Message: fmt.Sprintf("ошибка чтения шаблона %s: %v", definition.TemplateKey, err)})
+		return
+	}
+
+	problems, err := check(content, shape)
+	if err != nil {
+		result.add(DefinitionProblem{Field: "template", Message: err.Error()})
+		return
+	}
+	for _, problem := range problems {
+		result.add(DefinitionProblem{Field: "template", Location: problem.Location, Placeholder: problem.Placeholder, Message: problem.Message})
+	}
+}
+
+// schemaProperties возвращает имена параметров из схемы. nil - схема или ее свойства
+// не заданы, параметры отчета не ограничены
+func schemaProperties(parameterSchema models.JSON) []string {
+	if parameterSchema.IsEmpty() {
+		return nil
+	}
+	properties, ok := parameterSchema["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,562 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/models"
+	"report_srv/internal/query"
+)
+
+// derivedMaxRows наибольшее число строк входного набора или результата производного набора.
+// Производные наборы вычисляются в памяти сервиса
+const derivedMaxRows = 1_000_000
+
+// errDerivedTooLarge превышено число строк, которые производный набор держит в памяти
+var errDerivedTooLarge = fmt.Errorf("больше %d строк, производные наборы вычисляются в памяти", derivedMaxRows)
+
+// derivedInputs возвращает имена запросов, результаты которых используют производные наборы
+func derivedInputs(queries models.Queries) map[string]bool {
+	inputs := make(map[string]bool)
+	for _, definitionQuery := range queries {
+		if definitionQuery.IsDerived() {
+			for _, input := range definitionQuery.Derived.Inputs {
+				inputs[input] = true
+			}
+		}
+	}
+	return inputs
+}
+
+// bufferedRows результат запроса, прочитанный в память при первом обращении. Его строки
+// читают производные наборы и, если запрос выводится в отчет, сам отчет
+type bufferedRows struct {
+	name string
+	rows RowIterator
+
+	loaded  bool
+	columns []string
+	data    [][]interface{}
+	err     error
+}
+
+// load читает строки результата целиком
+func (b *bufferedRows) load() {
+	if b.loaded {
+		return
+	}
+	b.loaded = true
+
+	b.columns = b.rows.Columns()
+	for {
+		row, err := b.rows.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			b.err = err
+			return
+		}
+		if len(b.data) >= derivedMaxRows {
+			b.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("запрос %s: %w", b.name, errDerivedTooLarge))
+			return
+		}
+		b.data = append(b.data, row)
+	}
+}
+
+// reader возвращает итератор по строкам результата с начала
+func (b *bufferedRows) reader() RowIterator {
+	return &bufferedReader{buffer: b}
+}
+
+// bufferedReader итератор по прочитанному в память результату запроса
+type bufferedReader struct {
+	buffer   *bufferedRows
+	position int
+}
+
+// Columns возвращает колонки результата
+func (r *bufferedReader) Columns() []string {
+	r.buffer.load()
+	return r.buffer.columns
+}
+
+// Next возвращает следующую строку результата
+func (r *bufferedReader) Next() ([]interface{}, error) {
+	r.buffer.load()
+	if r.buffer.err != nil {
+		return nil, r.buffer.err
+	}
+	if r.position >= len(r.buffer.data) {
+		return nil, io.EOF
+	}
+	row := r.buffer.data[r.position]
+	r.position++
+	return row, nil
+}
+
+// Close закрывает исходный итератор результата
+func (r *bufferedReader) Close() error {
+	if closer, ok := r.buffer.rows.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// derivedRows итератор по производному набору. Набор вычисляется при первом обращении
+// по строкам входных наборов inputs в порядке derived.Inputs
+type derivedRows struct {
+	name    string
+	derived *models.Derived
+	inputs  []RowIterator
+
+	started bool
+	columns []string
+	rows    [][]interface{}
+	err     error
+}
+
+// newDerivedRows создает производный набор name по входным наборам
+func newDerivedRows(name string, derived *models.Derived, inputs []RowIterator) *derivedRows {
+	return &derivedRows{name: name, derived: derived, inputs: inputs}
+}
+
+// start читает входные наборы и вычисляет производный
+func (r *derivedRows) start() {
+	if r.started {
+		return
+	}
+	r.started = true
+
+	if err := r.load(); err != nil {
+		r.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("производный набор %s: %w", r.name, err))
+	}
+}
+
+// load читает входные наборы и заполняет колонки и строки результата
+func (r *derivedRows) load() error {
+	columns := make([][]string, len(r.inputs))
+	rows := make([][][]interface{}, len(r.inputs))
+	for i, input := range r.inputs {
+		columns[i] = input.Columns()
+		for {
+			row, err := input.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			rows[i] = append(rows[i], row)
+		}
+	}
+
+	plan, err := planDerived(r.derived, columns)
+	if err != nil {
+		return err
+	}
+	r.columns = plan.columns
+
+	switch r.derived.Operation {
+	case models.DerivedJoin:
+		r.rows, err = plan.join(rows[0], rows[1])
+	case models.DerivedUnion:
+		r.rows = plan.union(rows)
+	case models.DerivedGroup:
+		r.rows, err = plan.group(rows[0])
+	}
+	return err
+}
+
+// Columns возвращает колонки производного набора
+func (r *derivedRows) Columns() []string {
+	r.start()
+	return r.columns
+}
+
+// Next возвращает следующую строку производного набора
+func (r *derivedRows) Next() ([]interface{}, error) {
+	r.start()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+// Close закрывает входные наборы
+func (r *derivedRows) Close() error {
+	var errs []error
+	for _, input := range r.inputs {
+		if closer, ok := input.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// derivedPlan колонки производного набора и их источники во входных наборах
+type derivedPlan struct {
+	derived *models.Derived
+	columns []string
+
+	// join: индексы колонок соединения и выводимых колонок второго набора
+	leftKeys    []int
+	rightKeys   []int
+	rightOutput []int
+	// union: индекс колонки результата для каждой колонки каждого входного набора
+	unionIndex [][]int
+	// group: индексы колонок группировки и колонок агрегатов (-1 - count строк)
+	groupKeys  []int
+	aggregates []int
+}
+
+// planDerived сопоставляет колонки входных наборов с колонками производного набора.
+// Используется и при проверке определения, когда колонки запросов известны без выполнения
+func planDerived(derived *models.Derived, inputs [][]string) (*derivedPlan, error) {
+	plan := &derivedPlan{derived: derived}
+	switch derived.Operation {
+	case models.DerivedJoin:
+		if len(inputs) != 2 {
+			return nil, errors.New("для join задаются два входных набора")
+		}
+		left, right := inputs[0], inputs[1]
+		keys := make(map[int]bool)
+		for _, pair := range derived.JoinColumns() {
+			leftIndex, err := inputColumn(left, pair[0], derived.Inputs[0])
+			if err != nil {
+				return nil, err
+			}
+			rightIndex, err := inputColumn(right, pair[1], derived.Inputs[1])
+			if err != nil {
+				return nil, err
+			}
+			plan.leftKeys = append(plan.leftKeys, leftIndex)
+			plan.rightKeys = append(plan.rightKeys, rightIndex)
+			keys[rightIndex] = true
+		}
+
+		// Колонки соединения второго набора совпадают с первым и не выводятся,
+		// повторяющиеся имена получают префикс имени второго набора
+		plan.columns = append([]string(nil), left...)
+		used := make(map[string]bool, len(left)+len(right))
+		for _, column := range left {
+			used[column] = true
+		}
+		for i, column := range right {
+			if keys[i] {
+				continue
+			}
+			if used[column] {
+				column = derived.Inputs[1] + "_" + column
+			}
+			used[column] = true
+			plan.columns = append(plan.columns, column)
+			plan.rightOutput = append(plan.rightOutput, i)
+		}
+	case models.DerivedUnion:
+		positions := make(map[string]int)
+		plan.unionIndex = make([][]int, len(inputs))
+		for i, columns := range inputs {
+			plan.unionIndex[i] = make([]int, len(columns))
+			for j, column := range columns {
+				position, exists := positions[column]
+				if !exists {
+					position = len(plan.columns)
+					positions[column] = position
+					plan.columns = append(plan.columns, column)
+				}
+				plan.unionIndex[i][j] = position
+			}
+		}
+	case models.DerivedGroup:
+		if len(inputs) != 1 {
+			return nil, errors.New("для group задается один входной набор")
+		}
+		for _, column := range derived.GroupBy {
+			index, err := inputColumn(inputs[0], column, derived.Inputs[0])
+			if err != nil {
+				return nil, err
+			}
+			plan.groupKeys = append(plan.groupKeys, index)
+			plan.columns = append(plan.columns, inputs[0][index])
+		}
+		for _, aggregate := range derived.Aggregates {
+			index := -1
+			if aggregate.Column != "" {
+				var err error
+				if index, err = inputColumn(inputs[0], aggregate.Column, derived.Inputs[0]); err != nil {
+					return nil, err
+				}
+			}
+			plan.aggregates = append(plan.aggregates, index)
+			plan.columns = append(plan.columns, aggregate.OutputName())
+		}
+	default:
+		return nil, fmt.Errorf("неподдерживаемая операция %q", derived.Operation)
+	}
+	return plan, nil
+}
+
+// inputColumn возвращает индекс колонки входного набора, сначала с учетом регистра, затем без
+func inputColumn(columns []string, column, input string) (int, error) {
+	for i, name := range columns {
+		if name == column {
+			return i, nil
+		}
+	}
+	for i, name := range columns {
+		if strings.EqualFold(name, column) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("в наборе %s нет колонки %s", input, column)
+}
+
+// join соединяет строки двух наборов по колонкам соединения. Строки с NULL
+// в колонке соединения не имеют пары, как в SQL
+func (p *derivedPlan) join(left, right [][]interface{}) ([][]interface{}, error) {
+	index := make(map[string][]int, len(right))
+	for i, row := range right {
+		if key, ok := joinKey(row, p.rightKeys); ok {
+			index[key] = append(index[key], i)
+		}
+	}
+
+	var result [][]interface{}
+	for _, row := range left {
+		var matches []int
+		if key, ok := joinKey(row, p.leftKeys); ok {
+			matches = index[key]
+		}
+		if len(matches) == 0 && p.derived.Join == models.JoinLeft {
+			matches = []int{-1}
+		}
+		for _, match := range matches {
+			if len(result) >= derivedMaxRows {
+				return nil, errDerivedTooLarge
+			}
+			joined := make([]interface{}, 0, len(p.columns))
+			joined = append(joined, row...)
+			for _, column := range p.rightOutput {
+				var value interface{}
+				if match >= 0 {
+					value = right[match][column]
+				}
+				joined = append(joined, value)
+			}
+			result = append(result, joined)
+		}
+	}
+	return result, nil
+}
+
+// union выводит строки наборов подряд, отсутствующие в наборе колонки остаются пустыми
+func (p *derivedPlan) union(inputs [][][]interface{}) [][]interface{} {
+	var result [][]interface{}
+	for i, rows := range inputs {
+		for _, row := range rows {
+			merged := make([]interface{}, len(p.columns))
+			for j, value := range row {
+				merged[p.unionIndex[i][j]] = value
+			}
+			result = append(result, merged)
+		}
+	}
+	return result
+}
+
+// group группирует строки по колонкам группировки в порядке первого появления группы
+// и вычисляет агрегаты. NULL пропускаются агрегатами и образуют отдельную группу, как в SQL
+func (p *derivedPlan) group(rows [][]interface{}) ([][]interface{}, error) {
+	var keys []string
+	groups := make(map[string][]*aggregateState)
+	first := make(map[string][]interface{})
+	if len(p.groupKeys) == 0 {
+		// Без колонок группировки результат - одна строка, даже для пустого набора
+		keys = append(keys, "")
+		groups[""] = p.newStates()
+	}
+
+	for _, row := range rows {
+		key := groupKey(row, p.groupKeys)
+		states, exists := groups[key]
+		if !exists {
+			states = p.newStates()
+			groups[key] = states
+			first[key] = row
+			keys = append(keys, key)
+		}
+		for i, column := range p.aggregates {
+			var value interface{} = true
+			if column >= 0 {
+				value = row[column]
+			}
+			if err := states[i].add(value); err != nil {
+				return nil, fmt.Errorf("агрегат %s: %w", p.derived.Aggregates[i].OutputName(), err)
+			}
+		}
+	}
+
+	result := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		row := make([]interface{}, 0, len(p.columns))
+		for _, column := range p.groupKeys {
+			row = append(row, first[key][column])
+		}
+		for _, state := range groups[key] {
+			row = append(row, state.result())
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// newStates создает состояния агрегатов одной группы
+func (p *derivedPlan) newStates() []*aggregateState {
+	states := make([]*aggregateState, len(p.derived.Aggregates))
+	for i, aggregate := range p.derived.Aggregates {
+		states[i] = &aggregateState{function: aggregate.Function, integer: true}
+	}
+	return states
+}
+
+// aggregateState промежуточное значение агрегата группы
+type aggregateState struct {
+	function string
+	count    int64
+	sum      float64
+	// integer сумма целых остается целой
+	integer    bool
+	integerSum int64
+	extreme    interface{}
+}
+
+// add учитывает значение колонки строки группы
+func (s *aggregateState) add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	s.count++
+	switch s.function {
+	case "sum", "avg":
+		if integer, ok := value.(int64); ok {
+			s.integerSum += integer
+		} else {
+			s.integer = false
+		}
+		number, ok := query.Number(value)
+		if !ok {
+			return fmt.Errorf("значение %v не число", value)
+		}
+		s.sum += number
+	case "min", "max":
+		if s.extreme == nil {
+			s.extreme = value
+			return nil
+		}
+		order := compareValues(value, s.extreme)
+		if s.function == "min" && order < 0 || s.function == "max" && order > 0 {
+			s.extreme = value
+		}
+	}
+	return nil
+}
+
+// result возвращает значение агрегата. sum, avg, min и max без значений - NULL
+func (s *aggregateState) result() interface{} {
+	switch s.function {
+	case "count":
+		return s.count
+	case "sum":
+		if s.count == 0 {
+			return nil
+		}
+		if s.integer {
+			return s.integerSum
+		}
+		return s.sum
+	case "avg":
+		if s.count == 0 {
+			return nil
+		}
+		return s.sum / float64(s.count)
+	default:
+		return s.extreme
+	}
+}
+
+// compareValues сравнивает значения колонки: числа и числа в строках по значению,
+// даты по времени, остальное как строки
+func compareValues(a, b interface{}) int {
+	if x, ok := query.Number(a); ok {
+		if y, ok := query.Number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if x, ok := a.(time.Time); ok {
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	}
+	return strings.Compare(formatCSVValue(a), formatCSVValue(b))
+}
+
+// joinKey возвращает ключ соединения строки или false, если в колонках соединения есть NULL
+func joinKey(row []interface{}, columns []int) (string, bool) {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		if row[column] == nil {
+			return "", false
+		}
+		parts[i] = keyText(row[column])
+	}
+	return strings.Join(parts, "\x00"), true
+}
+
+// groupKey возвращает ключ группы строки
+func groupKey(row []interface{}, columns []int) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		if row[column] == nil {
+			parts[i] = "\x01"
+			continue
+		}
+		parts[i] = keyText(row[column])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// keyText приводит значение колонки к тексту ключа. Числа разных типов с одним значением
+// дают один ключ: идентификатор из базы данных совпадает с тем же числом из JSON API
+func keyText(value interface{}) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return formatCSVValue(v)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readDataset(t *testing.T, rows RowIterator) [][]interface{} {
+	t.Helper()
+	var result [][]interface{}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return result
+		}
+		require.NoError(t, err)
+		result = append(result, row)
+	}
+}
+
+func TestDerivedRows(t *testing.T) {
+	orders := &sliceRows{columns: []string{"customer_id", "amount"}, rows: [][]interface{}{
+		{int64(1), int64(10)}, {int64(2), int64(5)}, {int64(1), 2.5}, {nil, int64(7)},
+	}}
+	customers := &sliceRows{columns: []string{"id", "name", "amount"}, rows: [][]interface{}{
+		{"1", "Иванов", int64(100)}, {"3", "Петров", int64(300)},
+	}}
+	buffer := func(rows RowIterator) RowIterator {
+		return (&bufferedRows{name: "input", rows: rows}).reader()
+	}
+	left, right := &bufferedRows{rows: orders}, &bufferedRows{rows: customers}
+
+	// Идентификаторы из разных источников совпадают по значению, повторяющаяся колонка получает префикс
+	join := newDerivedRows("joined", &models.Derived{Operation: models.DerivedJoin, Inputs: []string{"orders", "customers"},
+		On: []string{"customer_id = id"}, Join: models.JoinLeft}, []RowIterator{left.reader(), right.reader()})
+	assert.Equal(t, []string{"customer_id", "amount", "name", "customers_amount"}, join.Columns())
+	assert.Equal(t, [][]interface{}{
+		{int64(1), int64(10), "Иванов", int64(100)},
+		{int64(2), int64(5), nil, nil},
+		{int64(1), 2.5, "Иванов", int64(100)},
+		{nil, int64(7), nil, nil},
+	}, readDataset(t, join))
+
+	inner := newDerivedRows("joined", &models.Derived{Operation: models.DerivedJoin, Inputs: []string{"orders", "customers"},
+		On: []string{"customer_id=id"}}, []RowIterator{left.reader(), right.reader()})
+	assert.Len(t, readDataset(t, inner), 2)
+
+	union := newDerivedRows("all", &models.Derived{Operation: models.DerivedUnion, Inputs: []string{"orders", "customers"}},
+		[]RowIterator{left.reader(), right.reader()})
+	assert.Equal(t, []string{"customer_id", "amount", "id", "name"}, union.Columns())
+	rows := readDataset(t, union)
+	require.Len(t, rows, 6)
+	assert.Equal(t, []interface{}{nil, int64(300), "3", "Петров"}, rows[5])
+
+	group := newDerivedRows("totals", &models.Derived{Operation: models.DerivedGroup, Inputs: []string{"orders"},
+		GroupBy: []string{"CUSTOMER_ID"}, Aggregates: []models.Aggregate{
+			{Function: "count"}, {Function: "sum", Column: "amount", As: "total"}, {Function: "max", Column: "amount"},
+		}}, []RowIterator{left.reader()})
+	assert.Equal(t, []string{"customer_id", "count", "total", "max_amount"}, group.Columns())
+	assert.Equal(t, [][]interface{}{
+		{int64(1), int64(2), 12.5, int64(10)},
+		{int64(2), int64(1), int64(5), int64(5)},
+		{nil, int64(1), int64(7), int64(7)},
+	}, readDataset(t, group))
+
+	// Без колонок группировки пустой набор дает одну строку
+	empty := newDerivedRows("summary", &models.Derived{Operation: models.DerivedGroup, Inputs: []string{"orders"},
+		Aggregates: []models.Aggregate{{Function: "count"}, {Function: "avg", Column: "amount"}}},
+		[]RowIterator{buffer(&sliceRows{columns: []string{"amount"}})})
+	assert.Equal(t, [][]interface{}{{int64(0), nil}}, readDataset(t, empty))
+
+	missing := newDerivedRows("joined", &models.Derived{Operation: models.DerivedJoin, Inputs: []string{"orders", "customers"},
+		On: []string{"region"}}, []RowIterator{left.reader(), right.reader()})
+	_, err := missing.Next()
+	assert.ErrorContains(t, err, "в наборе orders нет колонки region")
+	code, _ := classifyError(err)
+	assert.Equal(t, models.ErrorCodeQuery, code)
+}
+
+func TestDefinitionDataLoaderDerivedDatasets(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("CREATE TABLE orders (customer_id INTEGER, amount INTEGER)").Error)
+	require.NoError(t, db.Exec("INSERT INTO orders VALUES (1, 20), (2, 10), (1, 30)").Error)
+	sources := newTestDataSources(t, db, map[string]config.DataSource{
+		"crm": {Driver: "sqlite", DSN: "file:crm?mode=memory&cache=shared"},
+	})
+	crm, err := sources.DB(ctx, "crm")
+	require.NoError(t, err)
+	require.NoError(t, crm.Exec("CREATE TABLE customers (id INTEGER, name TEXT, email TEXT)").Error)
+	require.NoError(t, crm.Exec("INSERT INTO customers VALUES (1, 'Иванов', 'ivanov@example.com'), (2, 'Петров', 'petrov@example.com')").Error)
+
+	definition := newTestDefinition()
+	definition.ParameterSchema = nil
+	definition.Queries = models.Queries{
+		{Name: "orders", SQL: "SELECT customer_id, amount FROM orders ORDER BY amount"},
+		{Name: "customers", SQL: "SELECT id, name, email FROM customers", Source: "crm", Hidden: true},
+		{Name: "report", Derived: &models.Derived{Operation: models.DerivedJoin, Inputs: []string{"orders", "customers"}, On: []string{"customer_id=id"}}},
+		{Name: "totals", Derived: &models.Derived{Operation: models.DerivedGroup, Inputs: []string{"report"},
+			GroupBy: []string{"name"}, Aggregates: []models.Aggregate{{Function: "sum", Column: "amount", As: "total"}}}},
+	}
+	definition.ColumnMapping = &models.ColumnMapping{Columns: []models.ColumnTransform{{Column: "total", Query: "totals", Rename: "Итого"}}}
+	definition.Masking = models.MaskingRules{{Column: "email"}}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t), sources, NewReportFileStorage(new(MockStorage), logger), logger).
+		WithMasking(NewMaskingPolicy(config.Masking{}))
+	data, err := loader.Load(ctx, &models.Report{DefinitionID: &definition.ID})
+	require.NoError(t, err)
+	defer data.Close()
+
+	// Скрытый запрос не выводится, производные наборы читают результат запроса orders повторно
+	require.Len(t, data.Datasets, 3)
+	assert.Equal(t, []string{"orders", "report", "totals"}, []string{data.Datasets[0].Name, data.Datasets[1].Name, data.Datasets[2].Name})
+	assert.Len(t, readDataset(t, data.Datasets[0].Rows), 3)
+
+	assert.Equal(t, []string{"customer_id", "amount", "name", "email"}, data.Datasets[1].Rows.Columns())
+	report := readDataset(t, data.Datasets[1].Rows)
+	require.Len(t, report, 3)
+	assert.Equal(t, "Петров", report[0][2])
+	assert.NotEqual(t, "petrov@example.com", report[0][3])
+
+	assert.Equal(t, []string{"name", "Итого"}, data.Datasets[2].Rows.Columns())
+	assert.Equal(t, [][]interface{}{{"Петров", int64(10)}, {"Иванов", int64(50)}}, readDataset(t, data.Datasets[2].Rows))
+
+	// Колонки производных наборов проверяются без выполнения запросов
+	service := NewDefinitionService(definitions, newTestQueryValidator(t), sources, new(MockStorage), logger)
+	definition.Queries[3].Derived.GroupBy = []string{"region"}
+	validation, err := service.ValidateDefinition(ctx, definition)
+	require.NoError(t, err)
+	require.Len(t, validation.Problems, 1)
+	assert.Equal(t, "queries[3].derived", validation.Problems[0].Field)
+
+	definition.Queries[2].Derived.Inputs = []string{"orders", "totals"}
+	assert.ErrorContains(t, definition.Validate(), "входной набор totals должен быть объявлен раньше производного")
+	definition.Queries[2].SQL = "SELECT 1"
+	assert.ErrorContains(t, definition.Validate(), "для производного набора не задаются SQL")
+}
@@ -0,0 +1,616 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// maxDiffRows наибольшее число строк таблицы отчета, которое загружается для сравнения
+	maxDiffRows = 100000
+
+	// diffKeySeparator разделяет значения ключевых колонок в ключе строки
+	diffKeySeparator = "\x00"
+
+	// diffMimeType тип содержимого книги Excel с различиями отчетов
+	diffMimeType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+var (
+	// ErrDiffIncompatible отчеты построены не по одному определению
+	ErrDiffIncompatible = newCategoryError(ErrValidation, "сравниваются только отчеты одного определения")
+	// ErrDiffUnsupportedFormat по файлу отчета нельзя восстановить таблицу
+	ErrDiffUnsupportedFormat = newCategoryError(ErrValidation, "сравнение доступно для отчетов форматов csv и xlsx")
+	// ErrDiffTooLarge в таблице отчета больше maxDiffRows строк
+	ErrDiffTooLarge = newCategoryError(ErrValidation, "отчет слишком большой для сравнения")
+	// ErrInvalidDiffKey ключевые колонки не заданы в отчетах или не различают строки
+	ErrInvalidDiffKey = newCategoryError(ErrValidation, "некорректные ключевые колонки")
+)
+
+// DiffService интерфейс сравнения двух готовых отчетов одного определения
+type DiffService interface {
+	// DiffReports сравнивает таблицу отчета id с таблицей базового отчета otherID по ключевым
+	// колонкам keys. Без keys ключом считается первая колонка.
+	DiffReports(ctx context.Context, id, otherID uint, keys []string) (*models.ReportDiff, error)
+	// DiffWorkbook возвращает различия отчетов книгой Excel с листами Summary, Added, Removed и Changed
+	DiffWorkbook(ctx context.Context, id, otherID uint, keys []string) (*ReportFile, error)
+}
+
+// DiffServiceImpl реализация сравнения отчетов. Таблица отчета - первый набор данных:
+// из снимков, если они есть у обоих отчетов, иначе из файла - заголовки и строки до пустой строки.
+type DiffServiceImpl struct {
+	reports ReportService
+	logger  logging.Logger
+}
+
+// NewDiffService создает сервис сравнения отчетов, файлы которых открываются через reports
+func NewDiffService(reports ReportService, logger logging.Logger) DiffService {
+	return &DiffServiceImpl{reports: reports, logger: logger}
+}
+
+// DiffReports сравнивает отчеты по ключевым колонкам
+func (s *DiffServiceImpl) DiffReports(ctx context.Context, id, otherID uint, keys []string) (*models.ReportDiff, error) {
+	report, other, err := s.comparableReports(ctx, id, otherID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Снимки хранят значения без форматирования файла, поэтому сравниваются
+	// только со снимками: отчет без снимка сравнивается по файлу
+	load := s.loadTable
+	if report.SnapshotKey != "" && other.SnapshotKey != "" {
+		load = s.loadSnapshotTable
+	}
+	current, err := load(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	base, err := load(ctx, other)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := diffTables(current, base, keys)
+	if err != nil {
+		return nil, err
+	}
+	diff.ReportID, diff.OtherID = id, otherID
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"report_id": id,
+		"other_id":  otherID,
+		"added":     len(diff.Added),
+		"removed":   len(diff.Removed),
+		"changed":   len(diff.Changed),
+	}).Info("Отчеты сравнены")
+	return diff, nil
+}
+
+// DiffWorkbook формирует книгу Excel с различиями отчетов
+func (s *DiffServiceImpl) DiffWorkbook(ctx context.Context, id, otherID uint, keys []string) (*ReportFile, error) {
+	diff, err := s.DiffReports(ctx, id, otherID, keys)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.reports.GetReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := diffWorkbook(diff)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка формирования книги сравнения: %w", err)
+	}
+	return &ReportFile{
+		Reader:      io.NopCloser(bytes.NewReader(content)),
+		Filename:    fmt.Sprintf("%s_diff_%d_%d.xlsx", report.Title, id, otherID),
+		ContentType: diffMimeType,
+		Size:        int64(len(content)),
+	}, nil
+}
+
+// comparableReports возвращает готовые отчеты, построенные по одному определению.
+// Отчеты без определения сравниваются, если у них один тип.
+func (s *DiffServiceImpl) comparableReports(ctx context.Context, id, otherID uint) (*models.Report, *models.Report, error) {
+	report, err := s.reports.GetReport(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	other, err := s.reports.GetReport(ctx, otherID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, r := range []*models.Report{report, other} {
+		if !r.IsCompleted() || !r.HasFile() {
+			return nil, nil, fmt.Errorf("%w: %d", ErrReportNotReady, r.ID)
+		}
+	}
+
+	switch {
+	case report.DefinitionID != nil && other.DefinitionID != nil:
+		if *report.DefinitionID != *other.DefinitionID {
+			return nil, nil, fmt.Errorf("%w: определения %d и %d", ErrDiffIncompatible, *report.DefinitionID, *other.DefinitionID)
+		}
+	case report.DefinitionID == nil && other.DefinitionID == nil:
+		if report.Type == "" || report.Type != other.Type {
+			return nil, nil, fmt.Errorf("%w: типы %q и %q", ErrDiffIncompatible, report.Type, other.Type)
+		}
+	default:
+		return nil, nil, ErrDiffIncompatible
+	}
+	return report, other, nil
+}
+
+// diffTable таблица отчета: колонки и строки значений в порядке файла
+type diffTable struct {
+	columns []string
+	rows    [][]string
+}
+
+// loadTable читает таблицу из файла отчета. У архива формата zip читается файл csv
+// или xlsx из его состава, сжатый при сохранении файл распаковывается.
+func (s *DiffServiceImpl) loadTable(ctx context.Context, report *models.Report) (*diffTable, error) {
+	format := report.Format
+	var (
+		file *ReportFile
+		err  error
+	)
+	switch format {
+	case models.FormatCSV, models.FormatXLSX:
+		file, err = s.reports.GetReportFile(ctx, report.ID)
+	case models.FormatZIP:
+		format = ""
+		for _, candidate := range []models.ReportFormat{models.FormatCSV, models.FormatXLSX} {
+			if _, ok := report.Bundle.Find(candidate); ok {
+				format = candidate
+				break
+			}
+		}
+		if format == "" {
+			return nil, fmt.Errorf("%w: в архиве отчета %d нет файла csv или xlsx", ErrDiffUnsupportedFormat, report.ID)
+		}
+		file, err = s.reports.GetReportArtifact(ctx, report.ID, format)
+	default:
+		return nil, fmt.Errorf("%w: отчет %d формата %s", ErrDiffUnsupportedFormat, report.ID, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Reader.Close()
+
+	reader, err := unpackDiffFile(report, file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла отчета %d: %w", report.ID, err)
+	}
+
+	var table *diffTable
+	if format == models.FormatXLSX {
+		table, err = readXLSXTable(reader)
+	} else {
+		table, err = readCSVTable(reader)
+	}
+	if err != nil {
+		if errors.Is(err, ErrDiffTooLarge) {
+			return nil, fmt.Errorf("%w: в отчете %d больше %d строк", ErrDiffTooLarge, report.ID, maxDiffRows)
+		}
+		return nil, fmt.Errorf("ошибка чтения таблицы отчета %d: %w", report.ID, err)
+	}
+	return table, nil
+}
+
+// loadSnapshotTable читает таблицу первого набора из снимка данных отчета
+func (s *DiffServiceImpl) loadSnapshotTable(ctx context.Context, report *models.Report) (*diffTable, error) {
+	data, err := s.reports.GetReportSnapshot(ctx, report.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	if len(data.Datasets) == 0 {
+		return nil, fmt.Errorf("%w: в снимке отчета %d нет наборов", ErrDiffUnsupportedFormat, report.ID)
+	}
+
+	rows := data.Datasets[0].Rows
+	table := &diffTable{columns: rows.Columns()}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения снимка отчета %d: %w", report.ID, err)
+		}
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = formatCSVValue(value)
+		}
+		if err := table.add(record); err != nil {
+			return nil, fmt.Errorf("%w: в отчете %d больше %d строк", ErrDiffTooLarge, report.ID, maxDiffRows)
+		}
+	}
+}
+
+// unpackDiffFile распаковывает файл отчета, сжатый при сохранении
+func unpackDiffFile(report *models.Report, file *ReportFile) (io.Reader, error) {
+	if file.ContentEncoding == "gzip" {
+		return gzip.NewReader(file.Reader)
+	}
+	if report.Format == models.FormatZIP || fileCompression(report) != models.CompressionZip {
+		return file.Reader, nil
+	}
+
+	// В архиве сжатия один файл, для чтения ZIP нужен произвольный доступ
+	content, err := io.ReadAll(file.Reader)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	if len(archive.File) == 0 {
+		return nil, errors.New("пустой ZIP архив")
+	}
+	return archive.File[0].Open()
+}
+
+// readCSVTable читает заголовки и строки CSV до первой пустой строки, после которой
+// в файле отчета идет следующий набор данных
+func readCSVTable(r io.Reader) (*diffTable, error) {
+	buffered := bufio.NewReader(r)
+	if bom, _ := buffered.Peek(len(utf8BOM)); string(bom) == utf8BOM {
+		_, _ = buffered.Discard(len(utf8BOM))
+	}
+	reader := csv.NewReader(buffered)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("нет строки заголовков")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := &diffTable{columns: header}
+	end := csvRecordEnd(reader, header)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return table, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// csv.Reader пропускает пустые строки, поэтому разрыв виден по номерам строк
+		if line, _ := reader.FieldPos(0); line > end+1 {
+			return table, nil
+		}
+		end = csvRecordEnd(reader, record)
+		if err := table.add(record); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// csvRecordEnd возвращает номер строки файла, которой заканчивается прочитанная запись
+func csvRecordEnd(reader *csv.Reader, record []string) int {
+	last := len(record) - 1
+	line, _ := reader.FieldPos(last)
+	return line + strings.Count(record[last], "\n")
+}
+
+// readXLSXTable читает заголовки и строки первого листа книги до первой пустой строки
+func readXLSXTable(r io.Reader) (*diffTable, error) {
+	book, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения книги Excel: %w", err)
+	}
+	defer book.Close()
+
+	sheets := book.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("в книге нет листов")
+	}
+	rows, err := book.Rows(sheets[0])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var table *diffTable
+	for rows.Next() {
+		record, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		if isBlankRecord(record) {
+			break
+		}
+		if table == nil {
+			table = &diffTable{columns: record}
+			continue
+		}
+		if err := table.add(record); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Error(); err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return nil, errors.New("нет строки заголовков")
+	}
+	return table, nil
+}
+
+// isBlankRecord проверяет, что в строке нет значений
+func isBlankRecord(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// add добавляет строку, дополняя недостающие ячейки пустыми значениями
+func (t *diffTable) add(record []string) error {
+	if len(t.rows) >= maxDiffRows {
+		return ErrDiffTooLarge
+	}
+	row := make([]string, len(t.columns))
+	copy(row, record)
+	t.rows = append(t.rows, row)
+	return nil
+}
+
+// index возвращает номера колонок таблицы по именам
+func (t *diffTable) index() map[string]int {
+	index := make(map[string]int, len(t.columns))
+	for i, column := range t.columns {
+		if _, exists := index[column]; !exists {
+			index[column] = i
+		}
+	}
+	return index
+}
+
+// keyed сопоставляет строки таблицы с их ключами. Повтор ключа - ошибка:
+// такие строки нельзя сопоставить со строками другого отчета
+func (t *diffTable) keyed(positions []int, keys []string) (map[string]int, error) {
+	byKey := make(map[string]int, len(t.rows))
+	for i, row := range t.rows {
+		key := diffKey(row, positions)
+		if _, exists := byKey[key]; exists {
+			return nil, fmt.Errorf("%w: значение %s повторяется", ErrInvalidDiffKey, formatDiffKey(keys, row, positions))
+		}
+		byKey[key] = i
+	}
+	return byKey, nil
+}
+
+// diffKey возвращает ключ строки по значениям ключевых колонок
+func diffKey(row []string, positions []int) string {
+	values := make([]string, len(positions))
+	for i, position := range positions {
+		values[i] = row[position]
+	}
+	return strings.Join(values, diffKeySeparator)
+}
+
+// formatDiffKey возвращает ключ строки для сообщения об ошибке
+func formatDiffKey(keys []string, row []string, positions []int) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + strconv.Quote(row[positions[i]])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// diffTables сравнивает таблицу current с базовой таблицей base по колонкам keys
+func diffTables(current, base *diffTable, keys []string) (*models.ReportDiff, error) {
+	if len(keys) == 0 {
+		if len(current.columns) == 0 {
+			return nil, fmt.Errorf("%w: в отчете нет колонок", ErrInvalidDiffKey)
+		}
+		keys = current.columns[:1]
+	}
+
+	currentIndex, baseIndex := current.index(), base.index()
+	currentKeys, baseKeys := make([]int, len(keys)), make([]int, len(keys))
+	for i, key := range keys {
+		position, inCurrent := currentIndex[key]
+		basePosition, inBase := baseIndex[key]
+		if !inCurrent || !inBase {
+			return nil, fmt.Errorf("%w: колонки %s нет в одном из отчетов", ErrInvalidDiffKey, key)
+		}
+		currentKeys[i], baseKeys[i] = position, basePosition
+	}
+
+	diff := &models.ReportDiff{
+		KeyColumns: keys,
+		Added:      []models.DiffRow{},
+		Removed:    []models.DiffRow{},
+		Changed:    []models.DiffChange{},
+	}
+	for _, column := range current.columns {
+		if _, ok := baseIndex[column]; ok {
+			diff.Columns = append(diff.Columns, column)
+		} else {
+			diff.AddedColumns = append(diff.AddedColumns, column)
+		}
+	}
+	for _, column := range base.columns {
+		if _, ok := currentIndex[column]; !ok {
+			diff.RemovedColumns = append(diff.RemovedColumns, column)
+		}
+	}
+
+	currentRows, err := current.keyed(currentKeys, keys)
+	if err != nil {
+		return nil, err
+	}
+	baseRows, err := base.keyed(baseKeys, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range current.rows {
+		baseRow, exists := baseRows[diffKey(row, currentKeys)]
+		if !exists {
+			diff.Added = append(diff.Added, diffRow(current.columns, row))
+			continue
+		}
+
+		var fields []models.DiffField
+		for _, column := range diff.Columns {
+			old, value := base.rows[baseRow][baseIndex[column]], row[currentIndex[column]]
+			if old != value {
+				fields = append(fields, models.DiffField{Column: column, Old: old, New: value})
+			}
+		}
+		if len(fields) == 0 {
+			diff.Unchanged++
+			continue
+		}
+		key := make(models.DiffRow, len(keys))
+		for i, column := range keys {
+			key[column] = row[currentKeys[i]]
+		}
+		diff.Changed = append(diff.Changed, models.DiffChange{Key: key, Fields: fields})
+	}
+	for _, row := range base.rows {
+		if _, exists := currentRows[diffKey(row, baseKeys)]; !exists {
+			diff.Removed = append(diff.Removed, diffRow(base.columns, row))
+		}
+	}
+	return diff, nil
+}
+
+// diffRow возвращает строку таблицы значениями по именам колонок
+func diffRow(columns []string, row []string) models.DiffRow {
+	values := make(models.DiffRow, len(columns))
+	for i, column := range columns {
+		values[column] = row[i]
+	}
+	return values
+}
+
+// diffWorkbook записывает различия отчетов в книгу Excel: сводку, добавленные и удаленные
+// строки целиком и измененные значения по одному на строку листа
+func diffWorkbook(diff *models.ReportDiff) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	header, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+	writeSheet := func(name string, columns []string, rows [][]interface{}) error {
+		if name != "Summary" {
+			if _, err := f.NewSheet(name); err != nil {
+				return err
+			}
+		}
+		next := 1
+		if len(columns) > 0 {
+			headerRow := make([]interface{}, len(columns))
+			for i, column := range columns {
+				headerRow[i] = column
+			}
+			if err := f.SetSheetRow(name, "A1", &headerRow); err != nil {
+				return err
+			}
+			if err := f.SetCellStyle(name, "A1", excelCell(len(columns), 1), header); err != nil {
+				return err
+			}
+			next++
+		}
+		for i, row := range rows {
+			if err := f.SetSheetRow(name, excelCell(1, next+i), &row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := f.SetSheetName("Sheet1", "Summary"); err != nil {
+		return nil, err
+	}
+	summary := [][]interface{}{
+		{"report_id", diff.ReportID},
+		{"other_id", diff.OtherID},
+		{"key_columns", strings.Join(diff.KeyColumns, ", ")},
+		{"added", len(diff.Added)},
+		{"removed", len(diff.Removed)},
+		{"changed", len(diff.Changed)},
+		{"unchanged", diff.Unchanged},
+	}
+	if len(diff.AddedColumns) > 0 {
+		summary = append(summary, []interface{}{"added_columns", strings.Join(diff.AddedColumns, ", ")})
+	}
+	if len(diff.RemovedColumns) > 0 {
+		summary = append(summary, []interface{}{"removed_columns", strings.Join(diff.RemovedColumns, ", ")})
+	}
+	if err := writeSheet("Summary", nil, summary); err != nil {
+		return nil, err
+	}
+
+	addedColumns := append(append([]string{}, diff.Columns...), diff.AddedColumns...)
+	if err := writeSheet("Added", addedColumns, diffSheetRows(addedColumns, diff.Added)); err != nil {
+		return nil, err
+	}
+	removedColumns := append(append([]string{}, diff.Columns...), diff.RemovedColumns...)
+	if err := writeSheet("Removed", removedColumns, diffSheetRows(removedColumns, diff.Removed)); err != nil {
+		return nil, err
+	}
+
+	changedColumns := append(append([]string{}, diff.KeyColumns...), "column", "old", "new")
+	var changed [][]interface{}
+	for _, change := range diff.Changed {
+		for _, field := range change.Fields {
+			row := make([]interface{}, 0, len(changedColumns))
+			for _, key := range diff.KeyColumns {
+				row = append(row, change.Key[key])
+			}
+			changed = append(changed, append(row, field.Column, field.Old, field.New))
+		}
+	}
+	if err := writeSheet("Changed", changedColumns, changed); err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := f.Write(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// diffSheetRows возвращает строки для листа книги в порядке колонок columns
+func diffSheetRows(columns []string, rows []models.DiffRow) [][]interface{} {
+	result := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		values := make([]interface{}, len(columns))
+		for j, column := range columns {
+			values[j] = row[column]
+		}
+		result[i] = values
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadCSVTableStopsAtNextDataset(t *testing.T) {
+	content := utf8BOM + "id,name\n1,\"multi\nline\"\n2,b\n\nother\nx\n"
+	table, err := readCSVTable(strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, table.columns)
+	assert.Equal(t, [][]string{{"1", "multi\nline"}, {"2", "b"}}, table.rows)
+}
+
+func TestDiffTables(t *testing.T) {
+	base := &diffTable{
+		columns: []string{"region", "month", "amount", "manager"},
+		rows: [][]string{
+			{"north", "01", "100", "ann"},
+			{"south", "01", "200", "bob"},
+			{"west", "01", "300", "eve"},
+		},
+	}
+	current := &diffTable{
+		columns: []string{"region", "month", "amount", "share"},
+		rows: [][]string{
+			{"north", "01", "100", "0.2"},
+			{"south", "01", "250", "0.5"},
+			{"east", "01", "150", "0.3"},
+		},
+	}
+
+	diff, err := diffTables(current, base, []string{"region", "month"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"region", "month", "amount"}, diff.Columns)
+	assert.Equal(t, []string{"share"}, diff.AddedColumns)
+	assert.Equal(t, []string{"manager"}, diff.RemovedColumns)
+	assert.Equal(t, []models.DiffRow{{"region": "east", "month": "01", "amount": "150", "share": "0.3"}}, diff.Added)
+	assert.Equal(t, []models.DiffRow{{"region": "west", "month": "01", "amount": "300", "manager": "eve"}}, diff.Removed)
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, models.DiffRow{"region": "south", "month": "01"}, diff.Changed[0].Key)
+	assert.Equal(t, []models.DiffField{{Column: "amount", Old: "200", New: "250"}}, diff.Changed[0].Fields)
+	assert.Equal(t, 1, diff.Unchanged)
+	assert.True(t, diff.HasChanges())
+
+	// Ключ по умолчанию - первая колонка, повтор ключа не дает сопоставить строки
+	_, err = diffTables(current, base, []string{"month"})
+	assert.ErrorIs(t, err, ErrInvalidDiffKey)
+	_, err = diffTables(current, base, []string{"manager"})
+	assert.ErrorIs(t, err, ErrInvalidDiffKey)
+	diff, err = diffTables(current, base, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"region"}, diff.KeyColumns)
+}
+
+func TestDiffServiceComparesReportFiles(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	reports := newTestReportService(t, db, mockStorage, logger)
+	diffs := NewDiffService(reports, logger)
+
+	definitionID := uint(7)
+	previous := &models.Report{Title: "Sales", Status: models.StatusCompleted, Format: models.FormatCSV,
+		FileKey: "reports/1/sales.csv", DefinitionID: &definitionID, CreatedBy: "alice", UpdatedBy: "alice"}
+	current := &models.Report{Title: "Sales", Status: models.StatusCompleted, Format: models.FormatCSV,
+		FileKey: "reports/2/sales.csv.gz", DefinitionID: &definitionID, CreatedBy: "alice", UpdatedBy: "alice"}
+	pending := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV,
+		DefinitionID: &definitionID, CreatedBy: "alice", UpdatedBy: "alice"}
+	other := &models.Report{Title: "Stock", Status: models.StatusCompleted, Format: models.FormatCSV,
+		FileKey: "reports/4/stock.csv", Type: "stock", CreatedBy: "alice", UpdatedBy: "alice"}
+	for _, report := range []*models.Report{previous, current, pending, other} {
+		require.NoError(t, db.Create(report).Error)
+	}
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, _ = writer.Write([]byte("id,amount\n1,10\n2,25\n3,5\n"))
+	require.NoError(t, writer.Close())
+
+	mockStorage.On("GetSize", mock.Anything, mock.Anything).Return(int64(-1), nil)
+	files := func() {
+		mockStorage.On("Get", mock.Anything, previous.FileKey).Return(io.NopCloser(strings.NewReader("id,amount\n1,10\n2,20\n4,1\n")), nil).Once()
+		mockStorage.On("Get", mock.Anything, current.FileKey).Return(io.NopCloser(bytes.NewReader(compressed.Bytes())), nil).Once()
+	}
+	files()
+
+	diff, err := diffs.DiffReports(ctx, current.ID, previous.ID, nil)
+	require.NoError(t, err)
+	assert.Equal(t, current.ID, diff.ReportID)
+	assert.Equal(t, previous.ID, diff.OtherID)
+	assert.Equal(t, []models.DiffRow{{"id": "3", "amount": "5"}}, diff.Added)
+	assert.Equal(t, []models.DiffRow{{"id": "4", "amount": "1"}}, diff.Removed)
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, []models.DiffField{{Column: "amount", Old: "20", New: "25"}}, diff.Changed[0].Fields)
+
+	// Книга сравнения содержит листы сводки и различий
+	files()
+	file, err := diffs.DiffWorkbook(ctx, current.ID, previous.ID, []string{"id"})
+	require.NoError(t, err)
+	defer file.Reader.Close()
+	book, err := excelize.OpenReader(file.Reader)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Summary", "Added", "Removed", "Changed"}, book.GetSheetList())
+	changed, err := book.GetRows("Changed")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"id", "column", "old", "new"}, {"2", "amount", "20", "25"}}, changed)
+
+	_, err = diffs.DiffReports(ctx, pending.ID, previous.ID, nil)
+	assert.ErrorIs(t, err, ErrReportNotReady)
+	_, err = diffs.DiffReports(ctx, other.ID, previous.ID, nil)
+	assert.ErrorIs(t, err, ErrDiffIncompatible)
+}
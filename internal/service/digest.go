@@ -0,0 +1,336 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/schema"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// DigestReportType тип отчета ежедневной сводки. Точка в имени не допускается
+	// в именах определений, поэтому тип не пересекается с ними.
+	DigestReportType = "system.digest"
+
+	// Параметры отчета сводки: границы периода в RFC 3339
+	ParamDigestFrom = "period_from"
+	ParamDigestTo   = "period_to"
+
+	// digestUser автор отчетов сводки
+	digestUser = "digest"
+	// digestPeriod период, который охватывает сводка
+	digestPeriod = 24 * time.Hour
+	// digestSlowestDefinitions число самых медленных определений в сводке
+	digestSlowestDefinitions = 10
+	// digestRunTimeout ограничение на создание отчета сводки
+	digestRunTimeout = time.Minute
+	// digestClockSkew допустимое расхождение часов экземпляров сервиса
+	digestClockSkew = time.Minute
+)
+
+// digestParameterSchema схема параметров отчета сводки
+const digestParameterSchema = `{
+	"type": "object",
+	"required": ["period_from", "period_to"],
+	"properties": {
+		"period_from": {"type": "string"},
+		"period_to": {"type": "string"},
+		"email_recipients": {"type": "array", "items": {"type": "string"}}
+	}
+}`
+
+// RegisterDigestSchema добавляет в набор схем параметры отчета сводки
+func RegisterDigestSchema(registry *schema.Registry) error {
+	digestSchema, err := schema.Compile(DigestReportType, []byte(digestParameterSchema))
+	if err != nil {
+		return fmt.Errorf("ошибка схемы параметров сводки: %w", err)
+	}
+	registry.Register(DigestReportType, digestSchema)
+	return nil
+}
+
+// DigestDataLoader загружает данные отчетов сводки из статистики,
+// остальные отчеты передает следующему загрузчику
+type DigestDataLoader struct {
+	stats StatsRepository
+	next  ReportDataLoader
+}
+
+// NewDigestDataLoader создает загрузчик данных сводки
+func NewDigestDataLoader(stats StatsRepository, next ReportDataLoader) *DigestDataLoader {
+	return &DigestDataLoader{stats: stats, next: next}
+}
+
+// Load возвращает наборы сводки: итоги за период, ошибки по причинам и самые медленные определения
+func (l *DigestDataLoader) Load(ctx context.Context, report *models.Report) (*ReportData, error) {
+	if report.Type != DigestReportType {
+		return l.next.Load(ctx, report)
+	}
+
+	from, to, err := digestReportPeriod(report)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := l.stats.Summary(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета итогов сводки: %w", err)
+	}
+	failures, err := l.stats.FailuresByCode(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета ошибок сводки: %w", err)
+	}
+	durations, err := l.stats.DefinitionDurations(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения длительности генерации: %w", err)
+	}
+
+	summaryRows := &tableRows{columns: []string{"Показатель", "Значение"}, rows: [][]interface{}{
+		{"Начало периода", from.Format(time.RFC3339)},
+		{"Конец периода", to.Format(time.RFC3339)},
+		{"Создано отчетов", summary.Created},
+		{"Сгенерировано отчетов", summary.Completed},
+		{"Ошибок генерации", summary.Failed},
+		{"Размер сгенерированных файлов, байт", summary.StoredBytes},
+	}}
+
+	failureRows := &tableRows{columns: []string{"Причина ошибки", "Отчетов"}}
+	for _, failure := range failures {
+		code := string(failure.ErrorCode)
+		if code == "" {
+			code = string(models.ErrorCodeInternal)
+		}
+		failureRows.rows = append(failureRows.rows, []interface{}{code, failure.Reports})
+	}
+
+	return &ReportData{Datasets: []Dataset{
+		{Name: "summary", Rows: summaryRows, Sheet: "Итоги"},
+		{Name: "failures", Rows: failureRows, Sheet: "Ошибки"},
+		{Name: "slowest_definitions", Rows: slowestDefinitions(durations, digestSlowestDefinitions), Sheet: "Медленные определения"},
+	}}, nil
+}
+
+// digestReportPeriod возвращает период сводки из параметров отчета
+func digestReportPeriod(report *models.Report) (time.Time, time.Time, error) {
+	var bounds [2]time.Time
+	for i, param := range []string{ParamDigestFrom, ParamDigestTo} {
+		value, _ := report.Parameters.GetString(param)
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("неверный параметр сводки %s %q: %w", param, value, err)
+		}
+		bounds[i] = parsed
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// slowestDefinitions группирует длительности по определениям и возвращает
+// limit определений с наибольшей средней длительностью
+func slowestDefinitions(durations []DefinitionDuration, limit int) RowIterator {
+	type aggregate struct {
+		name    string
+		reports int64
+		total   time.Duration
+		max     time.Duration
+	}
+	byName := map[string]*aggregate{}
+	for _, d := range durations {
+		a, ok := byName[d.Definition]
+		if !ok {
+			a = &aggregate{name: d.Definition}
+			byName[d.Definition] = a
+		}
+		a.reports++
+		a.total += d.Duration
+		a.max = max(a.max, d.Duration)
+	}
+
+	aggregates := make([]*aggregate, 0, len(byName))
+	for _, a := range byName {
+		aggregates = append(aggregates, a)
+	}
+	average := func(a *aggregate) time.Duration { return a.total / time.Duration(a.reports) }
+	sort.Slice(aggregates, func(i, j int) bool {
+		if average(aggregates[i]) != average(aggregates[j]) {
+			return average(aggregates[i]) > average(aggregates[j])
+		}
+		return aggregates[i].name < aggregates[j].name
+	})
+
+	rows := &tableRows{columns: []string{"Определение", "Отчетов", "Среднее, с", "Максимум, с"}}
+	for _, a := range aggregates[:min(limit, len(aggregates))] {
+		rows.rows = append(rows.rows, []interface{}{
+			a.name, a.reports, roundStat(average(a).Seconds()), roundStat(a.max.Seconds()),
+		})
+	}
+	return rows
+}
+
+// tableRows итератор по заранее подготовленным строкам
+type tableRows struct {
+	columns []string
+	rows    [][]interface{}
+	pos     int
+}
+
+// Columns возвращает заголовки колонок
+func (r *tableRows) Columns() []string {
+	return r.columns
+}
+
+// Next возвращает следующую строку
+func (r *tableRows) Next() ([]interface{}, error) {
+	if r.pos >= len(r.rows) {
+		return nil, io.EOF
+	}
+	row := r.rows[r.pos]
+	r.pos++
+	return row, nil
+}
+
+// DigestJob каждый день создает отчет сводки за прошедшие сутки. Отчет генерируется
+// фоновым процессором, как остальные, и отправляется администраторам по почте.
+type DigestJob struct {
+	reports    ReportService
+	schedule   cron.Schedule
+	recipients []string
+	format     models.ReportFormat
+	logger     logging.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDigestJob создает задание ежедневной сводки
+func NewDigestJob(cfg config.Digest, reports ReportService, logger logging.Logger) (*DigestJob, error) {
+	schedule, err := ParseCronExpression(cfg.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка настройки сводки: %w", err)
+	}
+
+	return &DigestJob{
+		reports:    reports,
+		schedule:   schedule,
+		recipients: cfg.Recipients,
+		format:     models.ReportFormat(cfg.Format),
+		logger:     logger,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// NewDigestJobFromConfig создает задание сводки, если оно включено в конфигурации
+func NewDigestJobFromConfig(cfg config.Config, reports ReportService, logger logging.Logger) (*DigestJob, error) {
+	if !cfg.Digest.Enabled {
+		return nil, nil
+	}
+	return NewDigestJob(cfg.Digest, reports, logger)
+}
+
+// Start запускает ожидание времени сводки в отдельной горутине
+func (j *DigestJob) Start() {
+	j.logger.WithFields(logging.Fields{
+		"next_run_at": j.schedule.Next(time.Now().UTC()),
+		"recipients":  len(j.recipients),
+	}).Info("Запуск ежедневной сводки")
+	go j.loop()
+}
+
+// Stop останавливает задание сводки
+func (j *DigestJob) Stop(ctx context.Context) error {
+	j.stopOnce.Do(func() { close(j.stop) })
+
+	select {
+	case <-j.done:
+		j.logger.Info("Ежедневная сводка остановлена")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop ждет очередного времени сводки по cron выражению
+func (j *DigestJob) loop() {
+	defer close(j.done)
+
+	for {
+		next := j.schedule.Next(time.Now().UTC())
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-j.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), digestRunTimeout)
+			if _, err := j.Run(ctx, next); err != nil {
+				j.logger.WithError(err).Error("Ошибка создания ежедневной сводки")
+			}
+			cancel()
+		}
+	}
+}
+
+// Run создает отчет сводки за сутки до at. Если другой экземпляр сервиса уже
+// создал сводку в это время, повторный отчет не создается и возвращается nil.
+func (j *DigestJob) Run(ctx context.Context, at time.Time) (*models.Report, error) {
+	at = at.UTC()
+	since := at.Add(-digestClockSkew)
+	existing, err := j.reports.ListReports(ctx, ListReportParams{
+		Page:         1,
+		PageSize:     1,
+		CreatedBy:    digestUser,
+		CreatedAfter: &since,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка проверки созданных сводок: %w", err)
+	}
+	if existing.Total > 0 {
+		j.logger.WithField("period_to", at).Debug("Сводка за период уже создана")
+		return nil, nil
+	}
+
+	from := at.Add(-digestPeriod)
+	parameters := models.NewJSON()
+	parameters.Set(ParamDigestFrom, from.Format(time.RFC3339))
+	parameters.Set(ParamDigestTo, at.Format(time.RFC3339))
+	if len(j.recipients) > 0 {
+		// Параметры проверяются JSON Schema, которая ожидает массивы в виде []interface{}
+		recipients := make([]interface{}, len(j.recipients))
+		for i, recipient := range j.recipients {
+			recipients[i] = recipient
+		}
+		parameters.Set(models.ParamEmailRecipients, recipients)
+	}
+
+	report, err := models.NewReportBuilder().
+		WithTitle(fmt.Sprintf("Сводка по отчетам за %s", from.Format("2006-01-02"))).
+		WithDescription(fmt.Sprintf("Отчеты с %s по %s (UTC)", from.Format(time.RFC3339), at.Format(time.RFC3339))).
+		WithType(DigestReportType).
+		WithFormat(j.format).
+		WithParameters(parameters).
+		WithCreatedBy(digestUser).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	if err := j.reports.CreateReport(ctx, report); err != nil {
+		return nil, err
+	}
+
+	j.logger.WithFields(logging.Fields{
+		"report_id": report.ID,
+		"period_to": at,
+	}).Info("Ежедневная сводка создана")
+	return report, nil
+}
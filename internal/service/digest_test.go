@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/schema"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestJob(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.ReportDefinition{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	schemas := schema.NewRegistry()
+	require.NoError(t, RegisterDigestSchema(schemas))
+	reports := NewReportService(NewGormReportRepository(db, logger), NewFormatGenerators(logger),
+		NewReportFileStorage(new(MockStorage), logger), &stubProcessor{}, events.NewInProcessBus(logger), logger).
+		WithSchemas(schemas)
+
+	definition := &models.ReportDefinition{Name: "sales", Queries: models.Queries{{Name: "rows", SQL: "SELECT 1"}}, CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, db.Create(definition).Error)
+	for _, took := range []time.Duration{10 * time.Second, 30 * time.Second} {
+		report := &models.Report{Title: "Sales", Status: models.StatusCompleted, DefinitionID: &definition.ID, FileSize: 100, CreatedBy: "alice", UpdatedBy: "alice"}
+		require.NoError(t, db.Create(report).Error)
+		require.NoError(t, db.Model(report).UpdateColumn("generated_at", report.CreatedAt.Add(took)).Error)
+	}
+	failed := &models.Report{Title: "Sales", Status: models.StatusFailed, ErrorCode: models.ErrorCodeQuery, CreatedBy: "bob", UpdatedBy: "bob"}
+	require.NoError(t, db.Create(failed).Error)
+
+	job, err := NewDigestJob(config.Digest{Cron: "0 6 * * *", Recipients: []string{"admin@example.com"}, Format: "csv"}, reports, logger)
+	require.NoError(t, err)
+
+	at := time.Now().UTC()
+	digest, err := job.Run(ctx, at)
+	require.NoError(t, err)
+	require.NotNil(t, digest)
+	assert.Equal(t, DigestReportType, digest.Type)
+	assert.Equal(t, []string{"admin@example.com"}, digest.EmailRecipients())
+
+	// Другой экземпляр сервиса в то же время сводку не повторяет
+	again, err := job.Run(ctx, at)
+	require.NoError(t, err)
+	assert.Nil(t, again)
+
+	// Отчеты готовы позже времени сводки, поэтому их охватывает сводка за следующий час
+	digest.Parameters.Set(ParamDigestFrom, at.Add(-time.Hour).Format(time.RFC3339))
+	digest.Parameters.Set(ParamDigestTo, at.Add(time.Hour).Format(time.RFC3339))
+	data, err := NewDigestDataLoader(NewGormStatsRepository(db, logger), ReportInfoLoader{}).Load(ctx, digest)
+	require.NoError(t, err)
+	require.Len(t, data.Datasets, 3)
+
+	summary := readAllRows(t, data.Datasets[0].Rows)
+	assert.Equal(t, []interface{}{"Сгенерировано отчетов", int64(2)}, summary[3])
+	assert.Equal(t, []interface{}{"Ошибок генерации", int64(1)}, summary[4])
+	assert.Equal(t, [][]interface{}{{"query_error", int64(1)}}, readAllRows(t, data.Datasets[1].Rows))
+	assert.Equal(t, [][]interface{}{{"sales", int64(2), 20.0, 30.0}}, readAllRows(t, data.Datasets[2].Rows))
+}
+
+func readAllRows(t *testing.T, rows RowIterator) [][]interface{} {
+	var result [][]interface{}
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return result
+		}
+		require.NoError(t, err)
+		result = append(result, row)
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+	"report_srv/internal/template"
+)
+
+// NewDocumentDefaults возвращает свойства документа и водяной знак по умолчанию из конфигурации.
+// nil - по умолчанию файлы не помечаются
+func NewDocumentDefaults(cfg config.Documents) *models.DocumentOptions {
+	defaults := &models.DocumentOptions{
+		Author:         cfg.Author,
+		Company:        cfg.Company,
+		Classification: cfg.Classification,
+		Watermark:      cfg.Watermark,
+	}
+	if defaults.IsEmpty() {
+		return nil
+	}
+	return defaults
+}
+
+// documentStamp возвращает свойства и водяной знак для файла отчета. Дата в водяном
+// знаке выводится в часовом поясе отчета
+func documentStamp(report *models.Report, data *ReportData) template.Stamp {
+	options := data.Document
+	if options.IsEmpty() {
+		return template.Stamp{}
+	}
+	return template.Stamp{
+		Title:          report.Title,
+		Author:         options.Author,
+		Company:        options.Company,
+		Classification: options.Classification,
+		Watermark:      reportWatermark(report, options, time.Now()),
+	}
+}
+
+// reportWatermark возвращает текст водяного знака отчета с автором и датой now
+// в часовом поясе отчета
+func reportWatermark(report *models.Report, options *models.DocumentOptions, now time.Time) string {
+	return options.WatermarkText(report.CreatedBy, report.LocalTime(now).Format(time.DateOnly), report.Title)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestDocumentOptions(t *testing.T) {
+	defaults := NewDocumentDefaults(config.Documents{Company: "ACME", Classification: "INTERNAL", Watermark: "{classification}"})
+	merged := defaults.Merge(&models.DocumentOptions{Classification: "CONFIDENTIAL", Watermark: "{classification} – {title} для {user} от {date}"})
+	assert.Equal(t, &models.DocumentOptions{
+		Company:        "ACME",
+		Classification: "CONFIDENTIAL",
+		Watermark:      "{classification} – {title} для {user} от {date}",
+	}, merged)
+	assert.Equal(t, "CONFIDENTIAL – Продажи для ivanov от 2026-01-02", merged.WatermarkText("ivanov", "2026-01-02", "Продажи"))
+	assert.Equal(t, "ACME", defaults.Company)
+
+	assert.Nil(t, NewDocumentDefaults(config.Documents{}))
+	assert.Nil(t, (*models.DocumentOptions)(nil).Merge(&models.DocumentOptions{}))
+	assert.Len(t, (&models.DocumentOptions{Watermark: string(make([]rune, 201))}).Validate(), 1)
+}
+
+func TestDefinitionDocumentStampsExcelReport(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("CREATE TABLE sales (region TEXT, amount INTEGER)").Error)
+	require.NoError(t, db.Exec("INSERT INTO sales VALUES ('north', 20)").Error)
+
+	definition := newTestDefinition()
+	definition.Document = &models.DocumentOptions{Classification: "CONFIDENTIAL", Watermark: "{classification} – {user} {date}"}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), NewReportFileStorage(new(MockStorage), logger), logger).
+		WithDocumentDefaults(NewDocumentDefaults(config.Documents{Author: "Отдел отчетности", Classification: "INTERNAL"}))
+	report := &models.Report{
+		ID:           3,
+		Title:        "Продажи",
+		DefinitionID: &definition.ID,
+		Parameters:   models.JSON{"region": "north", models.ParamTimezone: "Asia/Tokyo"},
+		CreatedBy:    "ivanov",
+	}
+	data, err := loader.Load(ctx, report)
+	require.NoError(t, err)
+	defer data.Close()
+
+	reader, _, err := NewExcelReportGenerator(logger).Generate(ctx, report, data)
+	require.NoError(t, err)
+	f, err := excelize.OpenReader(reader)
+	require.NoError(t, err)
+	defer f.Close()
+
+	props, err := f.GetDocProps()
+	require.NoError(t, err)
+	assert.Equal(t, "Продажи", props.Title)
+	assert.Equal(t, "Отдел отчетности", props.Creator)
+	assert.Equal(t, "CONFIDENTIAL", props.Category)
+
+	// Дата в водяном знаке выводится в часовом поясе отчета
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	header, err := f.GetHeaderFooter(models.ExcelReportSheet)
+	require.NoError(t, err)
+	assert.Contains(t, header.OddHeader, "CONFIDENTIAL – ivanov "+time.Now().In(tokyo).Format(time.DateOnly))
+
+	rows, err := f.GetRows(models.ExcelReportSheet)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"region", "amount"}, {"north", "20"}}, rows)
+
+	// Отчет без определения получает значения по умолчанию
+	data, err = loader.Load(ctx, &models.Report{ID: 4, Title: "Сведения"})
+	require.NoError(t, err)
+	assert.Equal(t, "INTERNAL", data.Document.Classification)
+	assert.Empty(t, data.Document.Watermark)
+}
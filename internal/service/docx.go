@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/template"
+)
+
+// DOCXReportGenerator заполняет DOCX шаблон определения отчета данными запросов
+type DOCXReportGenerator struct {
+	filler template.TemplateFiller
+	logger logging.Logger
+}
+
+// NewDOCXReportGenerator создает новый генератор DOCX отчетов по шаблону
+func NewDOCXReportGenerator(logger logging.Logger) ReportGenerator {
+	return &DOCXReportGenerator{
+		filler: template.NewDOCXFiller(logger),
+		logger: logger,
+	}
+}
+
+// NewDOCXReportGeneratorFromConfig создает генератор DOCX отчетов с ограничениями шаблонов из конфигурации
+func NewDOCXReportGeneratorFromConfig(cfg config.Templates, logger logging.Logger) ReportGenerator {
+	return &DOCXReportGenerator{
+		filler: template.NewDOCXFillerWithLimits(templateLimits(cfg), logger),
+		logger: logger,
+	}
+}
+
+func init() {
+	RegisterGenerator(models.FormatDOCX, func(cfg config.Config, logger logging.Logger) ReportGenerator {
+		return NewDOCXReportGeneratorFromConfig(cfg.Templates, logger)
+	})
+}
+
+// Generate заполняет шаблон. Первый набор строк доступен в шаблоне как {{.column}},
+// каждый набор - как {{имя_запроса.column}}, параметры и сведения об отчете - как {{name}}.
+func (g *DOCXReportGenerator) Generate(ctx context.Context, report *models.Report, data *ReportData) (io.Reader, string, error) {
+	logger := logging.FromContext(ctx, g.logger).WithFields(logging.Fields{
+		"report_id": report.ID,
+		"title":     report.Title,
+	})
+
+	if data.Template == nil {
+		return nil, "", withErrorCode(models.ErrorCodeTemplate,
+			fmt.Errorf("для формата %s требуется шаблон определения отчета", models.FormatDOCX))
+	}
+
+	logger.Info("Генерация DOCX отчета по шаблону")
+
+	templateData, err := newTemplateData(report, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err := g.filler.Fill(ctx, data.Template, templateData)
+	if err != nil {
+		logger.WithError(err).Error("Ошибка заполнения шаблона")
+		return nil, "", withErrorCode(models.ErrorCodeTemplate, fmt.Errorf("ошибка заполнения шаблона: %w", err))
+	}
+	if content, err = template.StampDOCX(content, documentStamp(report, data)); err != nil {
+		return nil, "", fmt.Errorf("ошибка записи свойств документа: %w", err)
+	}
+
+	filename := fmt.Sprintf("report_%d_%s.docx", report.ID, report.LocalTime(time.Now()).Format("20060102_150405"))
+
+	logger.WithField("filename", filename).Info("DOCX отчет сгенерирован успешно")
+	return bytes.NewReader(content), filename, nil
+}
+
+// templateLimits возвращает ограничения заполнения шаблонов из конфигурации
+func templateLimits(cfg config.Templates) template.Limits {
+	return template.Limits{
+		MaxSize:   cfg.MaxSize,
+		MaxSheets: cfg.MaxSheets,
+		MaxRows:   cfg.MaxRows,
+		MaxCells:  cfg.MaxCells,
+		MaxMemory: cfg.MaxMemory,
+	}
+}
+
+// newTemplateData читает наборы строк в данные для заполнения шаблона
+func newTemplateData(report *models.Report, data *ReportData) (template.Data, error) {
+	fields := map[string]interface{}{
+		"report_id":          report.ID,
+		"report_title":       report.Title,
+		"report_description": report.Description,
+		"report_created_by":  report.CreatedBy,
+		"generated_at":       report.LocalTime(time.Now()),
+	}
+	for key, value := range report.Parameters {
+		fields[key] = value
+	}
+
+	result := template.Data{
+		Fields:   fields,
+		Datasets: make(map[string][]template.Record, len(data.Datasets)),
+	}
+	for i, dataset := range data.Datasets {
+		records, err := readRecords(dataset.Rows)
+		if err != nil {
+			return template.Data{}, fmt.Errorf("ошибка чтения набора %s: %w", dataset.Name, err)
+		}
+		if i == 0 {
+			result.Records = records
+		}
+		result.Datasets[dataset.Name] = records
+	}
+
+	return result, nil
+}
+
+// readRecords читает все строки набора в записи с доступом по имени колонки
+func readRecords(rows RowIterator) ([]template.Record, error) {
+	columns := rows.Columns()
+
+	var records []template.Record
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := make(template.Record, len(columns))
+		for i, column := range columns {
+			if i < len(row) {
+				record[column] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+}
+
+// GetMimeType возвращает MIME тип для DOCX файлов
+func (g *DOCXReportGenerator) GetMimeType() string {
+	return g.filler.GetMimeType()
+}
+
+// GetFileExtension возвращает расширение файла для DOCX
+func (g *DOCXReportGenerator) GetFileExtension() string {
+	return g.filler.GetFileExtension()
+}
@@ -0,0 +1,57 @@
+package service
+
+import "errors"
+
+// Категории ошибок сервисов. Конкретная ошибка относится к категории через errors.Is,
+// по категории HTTP слой выбирает статус ответа. Ошибки без категории - внутренние.
+var (
+	// ErrNotFound запрошенный объект не найден
+	ErrNotFound = errors.New("не найдено")
+	// ErrValidation параметры запроса не прошли проверку
+	ErrValidation = errors.New("ошибка валидации")
+	// ErrConflict операция противоречит текущему состоянию объекта
+	ErrConflict = errors.New("конфликт состояния")
+	// ErrNotReady объект еще не готов для операции
+	ErrNotReady = errors.New("не готово")
+	// ErrQuotaExceeded пользователь исчерпал лимит, подробности в QuotaExceededError
+	ErrQuotaExceeded = errors.New("лимит пользователя исчерпан")
+)
+
+// Ошибки отчетов
+var (
+	// ErrReportNotFound отчет не найден
+	ErrReportNotFound = newCategoryError(ErrNotFound, "отчет не найден")
+	// ErrReportNotReady отчет еще не сгенерирован
+	ErrReportNotReady = newCategoryError(ErrNotReady, "отчет еще не готов")
+	// ErrReportFileNotFound у отчета нет файла
+	ErrReportFileNotFound = newCategoryError(ErrNotFound, "файл отчета не найден")
+	// ErrBundleArtifactNotFound в архиве отчета нет файла запрошенного формата, и отчет не перестраивался в него
+	ErrBundleArtifactNotFound = newCategoryError(ErrNotFound, "файла этого формата нет у отчета")
+	// ErrInvalidStatusTransition отчет нельзя перевести в запрошенный статус
+	ErrInvalidStatusTransition = newCategoryError(ErrConflict, "недопустимая смена статуса отчета")
+	// ErrInvalidPriority неизвестный приоритет отчета
+	ErrInvalidPriority = newCategoryError(ErrValidation, "неверный приоритет отчета")
+	// ErrReportNotQueued приоритет меняется только у отчета, ожидающего генерации
+	ErrReportNotQueued = newCategoryError(ErrConflict, "отчет не ожидает генерации")
+)
+
+// categoryError ошибка сервиса, относящаяся к категории
+type categoryError struct {
+	category error
+	message  string
+}
+
+// newCategoryError создает ошибку категории category с сообщением message
+func newCategoryError(category error, message string) error {
+	return &categoryError{category: category, message: message}
+}
+
+// Error возвращает сообщение ошибки
+func (e *categoryError) Error() string {
+	return e.message
+}
+
+// Is относит ошибку к ее категории
+func (e *categoryError) Is(target error) bool {
+	return target == e.category
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"report_srv/internal/database"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorCategories(t *testing.T) {
+	assert.ErrorIs(t, ErrTaskNotFound, ErrNotFound)
+	assert.ErrorIs(t, ErrDefinitionExists, ErrConflict)
+	assert.ErrorIs(t, ErrInvalidSortField, ErrValidation)
+	assert.NotErrorIs(t, ErrInvalidSortField, ErrNotFound)
+	assert.Equal(t, "задача уже завершена", ErrTaskFinished.Error())
+
+	db := setupTestDB(t)
+	service := newTestReportService(t, db, new(MockStorage), setupTestLogger())
+	ctx := context.Background()
+
+	_, err := service.GetReport(ctx, 42)
+	assert.ErrorIs(t, err, ErrReportNotFound)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV, CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, db.Create(report).Error)
+
+	_, err = service.GetReportFile(ctx, report.ID)
+	assert.ErrorIs(t, err, ErrNotReady)
+
+	require.NoError(t, db.Model(report).Update("status", models.StatusFailed).Error)
+	err = service.CancelReportGeneration(ctx, report.ID)
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.False(t, errors.Is(err, ErrValidation))
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.True(t, isTransientError(withErrorCode(models.ErrorCodeStorage, errStorageUnavailable)))
+	assert.True(t, isTransientError(withErrorCode(models.ErrorCodeQuery, context.DeadlineExceeded)))
+	assert.True(t, isTransientError(withErrorCode(models.ErrorCodeQuery,
+		&database.StatusError{DataSource: "crm", StatusCode: 502})))
+
+	// Ошибки шаблона не повторяются, даже если вызваны сетевой ошибкой
+	assert.False(t, isTransientError(withErrorCode(models.ErrorCodeTemplate, errStorageUnavailable)))
+	assert.False(t, isTransientError(withErrorCode(models.ErrorCodeStorage, fs.ErrPermission)))
+	assert.False(t, isTransientError(withErrorCode(models.ErrorCodeQuery, errors.New("syntax error"))))
+	assert.False(t, isTransientError(context.Canceled))
+	assert.False(t, isTransientError(nil))
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"report_srv/internal/models"
+)
+
+const (
+	// etaHistoryWindow за какой период учитываются длительности генерации для оценки
+	etaHistoryWindow = 7 * 24 * time.Hour
+	// etaHistoryReports сколько последних отчетов учитывается в оценке
+	etaHistoryReports = 50
+)
+
+// QueueEstimator оценивает положение отчета в очереди и время его готовности по медиане
+// длительности генерации недавних отчетов. Отчеты впереди в очереди оцениваются по всем
+// определениям, сам отчет - по своему определению. Оценка приблизительная: не учитывает
+// ход генерации уже запущенных отчетов, обработчики для срочных задач и повышение приоритета
+type QueueEstimator struct {
+	reports ReportRepository
+	// workers число отчетов, генерируемых одновременно. 0 - генерация начинается сразу после создания
+	workers int
+	now     func() time.Time
+}
+
+// NewQueueEstimator создает оценку очереди по отчетам из reports
+func NewQueueEstimator(reports ReportRepository, workers int) *QueueEstimator {
+	return &QueueEstimator{reports: reports, workers: max(workers, 0), now: time.Now}
+}
+
+// Estimate возвращает положение отчета в очереди и оценку времени готовности.
+// Для отчетов не в статусах pending и processing возвращает nil
+func (e *QueueEstimator) Estimate(ctx context.Context, report *models.Report) (*models.ReportQueue, error) {
+	if report.Status != models.StatusPending && report.Status != models.StatusProcessing {
+		return nil, nil
+	}
+	now := e.now().UTC()
+	since := now.Add(-etaHistoryWindow)
+
+	own, err := e.median(ctx, report.DefinitionID, since)
+	if err != nil {
+		return nil, err
+	}
+	if own == 0 && report.DefinitionID != nil {
+		// Определение еще не генерировалось: берем отчеты всех определений
+		if own, err = e.median(ctx, nil, since); err != nil {
+			return nil, err
+		}
+	}
+
+	queue := &models.ReportQueue{EstimatedDuration: roundStat(own.Seconds())}
+	if report.Status == models.StatusProcessing {
+		if own > 0 {
+			started := now
+			if report.StartedAt != nil {
+				started = *report.StartedAt
+			}
+			// Генерация, которая идет дольше оценки, может закончиться в любой момент
+			completion := started.Add(own)
+			if completion.Before(now) {
+				completion = now
+			}
+			queue.EstimatedCompletionAt = &completion
+		}
+		return queue, nil
+	}
+
+	ahead, err := e.reports.CountQueuedAhead(ctx, report)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета отчетов в очереди: %w", err)
+	}
+	queue.Position = ahead + 1
+	if own == 0 {
+		return queue, nil
+	}
+
+	wait := time.Duration(0)
+	if e.workers > 0 && ahead > 0 {
+		typical, err := e.median(ctx, nil, since)
+		if err != nil {
+			return nil, err
+		}
+		// Отчеты впереди разбираются волнами по числу обработчиков
+		wait = time.Duration(ahead/int64(e.workers)) * typical
+	}
+	completion := now.Add(wait + own).Truncate(time.Second)
+	queue.EstimatedCompletionAt = &completion
+	return queue, nil
+}
+
+// median возвращает медиану длительности генерации отчетов определения, 0 - истории нет
+func (e *QueueEstimator) median(ctx context.Context, definitionID *uint, since time.Time) (time.Duration, error) {
+	durations, err := e.reports.GenerationDurations(ctx, definitionID, since, etaHistoryReports)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения длительности генерации: %w", err)
+	}
+	if len(durations) == 0 {
+		return 0, nil
+	}
+	return time.Duration(newDurationStats(durations).P50 * float64(time.Second)), nil
+}
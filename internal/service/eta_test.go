@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func createEstimateReport(t *testing.T, db *gorm.DB, report models.Report) *models.Report {
+	report.Title = "Test Report"
+	report.CreatedBy = "test-user"
+	report.UpdatedBy = "test-user"
+	if report.Priority == "" {
+		report.Priority = models.PriorityNormal
+	}
+	require.NoError(t, db.Create(&report).Error)
+	return &report
+}
+
+func TestQueueEstimator(t *testing.T) {
+	db := setupTestDB(t)
+	repository := NewGormReportRepository(db, setupTestLogger())
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	definitionID := uint(1)
+
+	// История: отчеты определения генерировались 10, 20 и 30 секунд, отчет без определения - минуту
+	for _, seconds := range []int{10, 20, 30, 60} {
+		started := now.Add(-time.Hour)
+		generated := started.Add(time.Duration(seconds) * time.Second)
+		report := models.Report{Status: models.StatusCompleted, StartedAt: &started, GeneratedAt: &generated}
+		if seconds != 60 {
+			report.DefinitionID = &definitionID
+		}
+		createEstimateReport(t, db, report)
+	}
+
+	first := createEstimateReport(t, db, models.Report{Status: models.StatusPending, DefinitionID: &definitionID})
+	urgent := createEstimateReport(t, db, models.Report{Status: models.StatusPending, Priority: models.PriorityHigh})
+	last := createEstimateReport(t, db, models.Report{Status: models.StatusPending, DefinitionID: &definitionID})
+	started := now.Add(-5 * time.Second)
+	running := createEstimateReport(t, db, models.Report{Status: models.StatusProcessing, DefinitionID: &definitionID, StartedAt: &started})
+
+	estimator := NewQueueEstimator(repository, 1)
+	estimator.now = func() time.Time { return now }
+
+	queue, err := estimator.Estimate(ctx, urgent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), queue.Position)
+
+	queue, err = estimator.Estimate(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), queue.Position)
+
+	// Впереди два отчета, один обработчик: две волны по медиане всех отчетов и своя генерация
+	queue, err = estimator.Estimate(ctx, last)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), queue.Position)
+	assert.Equal(t, 20.0, queue.EstimatedDuration)
+	require.NotNil(t, queue.EstimatedCompletionAt)
+	assert.Equal(t, now.Add(60*time.Second), *queue.EstimatedCompletionAt)
+
+	queue, err = estimator.Estimate(ctx, running)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), queue.Position)
+	require.NotNil(t, queue.EstimatedCompletionAt)
+	assert.Equal(t, now.Add(15*time.Second), *queue.EstimatedCompletionAt)
+
+	completed := &models.Report{Status: models.StatusCompleted}
+	queue, err = estimator.Estimate(ctx, completed)
+	require.NoError(t, err)
+	assert.Nil(t, queue)
+}
+
+func TestGetReportIncludesQueueEstimate(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, new(MockStorage), logger)
+
+	pending := createEstimateReport(t, db, models.Report{Status: models.StatusPending})
+	report, err := service.GetReport(context.Background(), pending.ID)
+	require.NoError(t, err)
+	require.NotNil(t, report.Queue)
+	assert.Equal(t, int64(1), report.Queue.Position)
+	// Без истории генерации время готовности не оценивается
+	assert.Nil(t, report.Queue.EstimatedCompletionAt)
+
+	completed := createEstimateReport(t, db, models.Report{Status: models.StatusCompleted})
+	report, err = service.GetReport(context.Background(), completed.ID)
+	require.NoError(t, err)
+	assert.Nil(t, report.Queue)
+}
@@ -0,0 +1,693 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/template"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// excelColumnWidth ширина колонок листов с данными
+	excelColumnWidth = 30.0
+
+	// excelTotalsLabel подпись строки итогов набора
+	excelTotalsLabel = "Итого"
+
+	// excelCancelCheckInterval число строк между проверками отмены генерации
+	excelCancelCheckInterval = 1000
+
+	// excelMaxSheetName наибольшая длина имени листа Excel
+	excelMaxSheetName = 31
+)
+
+// ExcelReportGenerator генератор Excel отчетов.
+// Листы с данными записываются потоково, поэтому книга не держится в памяти целиком.
+// Заполненный до sheetRows строк лист продолжается на листе "<лист> (2)" с повтором
+// заголовков, после maxRows строк данных отчет усекается.
+// Если у определения отчета есть шаблон, заполняется шаблон.
+type ExcelReportGenerator struct {
+	filler    template.TemplateFiller
+	logger    logging.Logger
+	maxRows   int
+	sheetRows int
+}
+
+// NewExcelReportGenerator создает новый генератор Excel отчетов без ограничения числа строк
+func NewExcelReportGenerator(logger logging.Logger) ReportGenerator {
+	return &ExcelReportGenerator{filler: template.NewXLSXFiller(logger), logger: logger, sheetRows: excelize.TotalRows}
+}
+
+// NewExcelReportGeneratorFromConfig создает генератор Excel отчетов с ограничениями отчетов
+// и шаблонов из конфигурации
+func NewExcelReportGeneratorFromConfig(cfg config.Excel, templates config.Templates, logger logging.Logger) ReportGenerator {
+	generator := &ExcelReportGenerator{
+		filler:    template.NewXLSXFillerWithLimits(templateLimits(templates), logger),
+		logger:    logger,
+		maxRows:   cfg.MaxRows,
+		sheetRows: cfg.SheetRows,
+	}
+	if generator.sheetRows <= 0 || generator.sheetRows > excelize.TotalRows {
+		generator.sheetRows = excelize.TotalRows
+	}
+	return generator
+}
+
+func init() {
+	RegisterGenerator(models.FormatXLSX, func(cfg config.Config, logger logging.Logger) ReportGenerator {
+		return NewExcelReportGeneratorFromConfig(cfg.Excel, cfg.Templates, logger)
+	})
+}
+
+// Generate генерирует Excel отчет
+func (g *ExcelReportGenerator) Generate(ctx context.Context, report *models.Report, data *ReportData) (io.Reader, string, error) {
+	logger := logging.FromContext(ctx, g.logger).WithFields(logging.Fields{
+		"report_id": report.ID,
+		"title":     report.Title,
+	})
+
+	if data.Template != nil {
+		return g.fillTemplate(ctx, report, data, logger)
+	}
+
+	logger.Info("Генерация Excel отчета")
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		count, err := g.writeWorkbook(ctx, pw, data, documentStamp(report, data), logger)
+		if err != nil {
+			logger.WithError(err).Error("Ошибка записи Excel файла")
+			pw.CloseWithError(fmt.Errorf("ошибка генерации Excel файла: %w", err))
+			return
+		}
+		logger.WithField("rows", count).Info("Excel отчет сгенерирован успешно")
+		pw.Close()
+	}()
+
+	filename := fmt.Sprintf("report_%d_%s.xlsx", report.ID, report.LocalTime(time.Now()).Format("20060102_150405"))
+	return pr, filename, nil
+}
+
+// fillTemplate заполняет XLSX шаблон определения. Данные в шаблоне доступны так же, как в DOCX шаблоне.
+func (g *ExcelReportGenerator) fillTemplate(ctx context.Context, report *models.Report, data *ReportData, logger logging.Logger) (io.Reader, string, error) {
+	logger.Info("Генерация Excel отчета по шаблону")
+
+	templateData, err := newTemplateData(report, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	content, err := g.filler.Fill(ctx, data.Template, templateData)
+	if err != nil {
+		logger.WithError(err).Error("Ошибка заполнения шаблона")
+		return nil, "", withErrorCode(models.ErrorCodeTemplate, fmt.Errorf("ошибка заполнения шаблона: %w", err))
+	}
+	if content, err = template.StampXLSX(content, documentStamp(report, data)); err != nil {
+		return nil, "", fmt.Errorf("ошибка записи свойств документа: %w", err)
+	}
+
+	filename := fmt.Sprintf("report_%d_%s.xlsx", report.ID, report.LocalTime(time.Now()).Format("20060102_150405"))
+
+	logger.WithField("filename", filename).Info("Excel отчет сгенерирован успешно")
+	return bytes.NewReader(content), filename, nil
+}
+
+// GetMimeType возвращает MIME тип для Excel файлов
+func (g *ExcelReportGenerator) GetMimeType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+// GetFileExtension возвращает расширение файла для Excel
+func (g *ExcelReportGenerator) GetFileExtension() string {
+	return "xlsx"
+}
+
+// writeWorkbook формирует книгу, записывает ее в writer и возвращает число строк данных
+func (g *ExcelReportGenerator) writeWorkbook(ctx context.Context, w io.Writer, data *ReportData, stamp template.Stamp, logger logging.Logger) (int, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	workbook, err := newExcelWorkbook(f, data, g.sheetRows, logger)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := workbook.writeDatasets(ctx, data.Datasets, g.maxRows)
+	if err != nil {
+		return count, err
+	}
+	// Колонтитулы листов потоковой записи задаются до завершения записи в finish
+	if err := template.StampWorkbook(f, stamp); err != nil {
+		return count, err
+	}
+	if err := workbook.finish(); err != nil {
+		return count, fmt.Errorf("ошибка оформления Excel файла: %w", err)
+	}
+	return count, f.Write(w)
+}
+
+// excelSheetWriter запись строк листа. Реализуется excelize.StreamWriter
+// и memorySheetWriter для листов, которые формируются в памяти.
+type excelSheetWriter interface {
+	SetRow(cell string, values []interface{}, opts ...excelize.RowOpts) error
+	SetColWidth(minVal, maxVal int, width float64) error
+	SetPanes(panes *excelize.Panes) error
+	Flush() error
+}
+
+// memorySheetWriter записывает строки в лист книги в памяти
+type memorySheetWriter struct {
+	f     *excelize.File
+	sheet string
+}
+
+func (w *memorySheetWriter) SetRow(cell string, values []interface{}, _ ...excelize.RowOpts) error {
+	column, row, err := excelize.CellNameToCoordinates(cell)
+	if err != nil {
+		return err
+	}
+	for i, value := range values {
+		name, err := excelize.CoordinatesToCellName(column+i, row)
+		if err != nil {
+			return err
+		}
+		style, formula := 0, ""
+		if styled, ok := value.(excelize.Cell); ok {
+			style, formula, value = styled.StyleID, styled.Formula, styled.Value
+		}
+		if value != nil {
+			if err := w.f.SetCellValue(w.sheet, name, value); err != nil {
+				return err
+			}
+		}
+		if formula != "" {
+			if err := w.f.SetCellFormula(w.sheet, name, formula); err != nil {
+				return err
+			}
+		}
+		if style != 0 {
+			if err := w.f.SetCellStyle(w.sheet, name, name, style); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *memorySheetWriter) SetColWidth(minVal, maxVal int, width float64) error {
+	first, err := excelize.ColumnNumberToName(minVal)
+	if err != nil {
+		return err
+	}
+	last, err := excelize.ColumnNumberToName(maxVal)
+	if err != nil {
+		return err
+	}
+	return w.f.SetColWidth(w.sheet, first, last, width)
+}
+
+func (w *memorySheetWriter) SetPanes(panes *excelize.Panes) error {
+	return w.f.SetPanes(w.sheet, panes)
+}
+
+func (w *memorySheetWriter) Flush() error {
+	return nil
+}
+
+// excelSheet лист с данными Excel отчета. После заполнения лист продолжается
+// на следующем, name и writer указывают на текущий лист.
+type excelSheet struct {
+	base   string
+	name   string
+	writer excelSheetWriter
+	// next следующая свободная строка текущего листа
+	next int
+	// part номер текущего листа продолжения, 1 - исходный лист
+	part int
+	// sized колонки оформления с заданной на текущем листе шириной
+	sized map[string]bool
+}
+
+// excelTotal итог колонки набора, который считается при записи строк
+type excelTotal struct {
+	index     int
+	aggregate *template.Aggregate
+}
+
+// excelWorkbook книга Excel отчета в процессе записи
+type excelWorkbook struct {
+	f         *excelize.File
+	layout    *models.ExcelLayout
+	logger    logging.Logger
+	sheetRows int
+
+	headerStyle int
+	// formats стили форматов чисел по именам колонок
+	formats map[string]int
+	// sheets листы наборов по именам в нижнем регистре: имена листов Excel не зависят от регистра
+	sheets map[string]*excelSheet
+	// reserved имена листов в нижнем регистре, которые нельзя занять листами продолжения
+	reserved map[string]bool
+	// inMemory листы с данными сводных таблиц: excelize читает их заголовки при создании таблицы,
+	// поэтому такие листы не записываются потоково
+	inMemory map[string]bool
+	// found колонки оформления, найденные в данных
+	found map[string]bool
+	// header возвращает заголовок колонки в файле с учетом перевода
+	header func(column string) string
+	// rightToLeft листы выводятся справа налево
+	rightToLeft bool
+	writers     []excelSheetWriter
+	regions     []excelRegion
+}
+
+// newExcelWorkbook подготавливает книгу: стили, имена листов и листы сводных таблиц
+func newExcelWorkbook(f *excelize.File, data *ReportData, sheetRows int, logger logging.Logger) (*excelWorkbook, error) {
+	if err := f.SetSheetName("Sheet1", models.ExcelReportSheet); err != nil {
+		return nil, err
+	}
+
+	b := &excelWorkbook{
+		f:           f,
+		layout:      data.Layout,
+		logger:      logger,
+		sheetRows:   sheetRows,
+		formats:     make(map[string]int),
+		sheets:      make(map[string]*excelSheet),
+		reserved:    map[string]bool{strings.ToLower(models.ExcelReportSheet): true},
+		inMemory:    make(map[string]bool),
+		found:       make(map[string]bool),
+		header:      data.Header,
+		rightToLeft: data.RightToLeft(),
+	}
+
+	// Стиль для заголовков
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Color:   []string{"#E6E6FA"},
+			Pattern: 1,
+		},
+		Border: []excelize.Border{
+			{Type: "left", Color: "000000", Style: 1},
+			{Type: "top", Color: "000000", Style: 1},
+			{Type: "bottom", Color: "000000", Style: 1},
+			{Type: "right", Color: "000000", Style: 1},
+		},
+	})
+	if err != nil {
+		logger.WithError(err).Warn("Ошибка создания стиля заголовка")
+	}
+	b.headerStyle = headerStyle
+
+	datasetSheets := make(map[string]string, len(data.Datasets))
+	for _, dataset := range data.Datasets {
+		name := strings.ToLower(excelSheetName(dataset.Sheet))
+		datasetSheets[dataset.Name] = name
+		b.reserved[name] = true
+	}
+
+	if b.layout.IsEmpty() {
+		return b, nil
+	}
+
+	for _, column := range b.layout.Columns {
+		if column.NumberFormat == "" {
+			continue
+		}
+		format := column.NumberFormat
+		style, err := f.NewStyle(&excelize.Style{CustomNumFmt: &format})
+		if err != nil {
+			return nil, fmt.Errorf("ошибка формата колонки %s: %w", column.Name, err)
+		}
+		b.formats[column.Name] = style
+	}
+
+	for _, pivot := range b.layout.PivotTables {
+		b.reserved[strings.ToLower(pivot.Name)] = true
+		dataset := pivot.Dataset
+		if dataset == "" && len(data.Datasets) > 0 {
+			dataset = data.Datasets[0].Name
+		}
+		if sheet, ok := datasetSheets[dataset]; ok {
+			b.inMemory[sheet] = true
+		}
+	}
+	return b, nil
+}
+
+// writeDatasets записывает наборы данных и возвращает число строк данных.
+// Каждый набор выводится на свой лист, по умолчанию общий. Наборы одного листа
+// идут подряд, следующий набор отделяется пустой строкой и своими заголовками.
+// Строка итогов набора выводится после его данных, при усечении - по выведенным строкам.
+func (b *excelWorkbook) writeDatasets(ctx context.Context, datasets []Dataset, maxRows int) (int, error) {
+	count := 0
+	for _, dataset := range datasets {
+		sheet, err := b.sheet(dataset.Sheet)
+		if err != nil {
+			return count, err
+		}
+
+		columns := dataset.Rows.Columns()
+		region, err := b.startRegion(sheet, dataset.Name, columns)
+		if err != nil {
+			return count, err
+		}
+
+		styles := make([]int, len(columns))
+		for i, column := range columns {
+			styles[i] = b.formats[column]
+		}
+		totals := b.datasetTotals(columns)
+
+		cells := make([]interface{}, 0, len(columns))
+		for {
+			row, err := dataset.Rows.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return count, fmt.Errorf("ошибка чтения данных отчета: %w", err)
+			}
+
+			if maxRows > 0 && count >= maxRows {
+				b.closeRegion(sheet, region)
+				if err := b.writeTotals(sheet, dataset.Name, columns, totals); err != nil {
+					return count, err
+				}
+				logging.FromContext(ctx, b.logger).WithField("max_rows", maxRows).Warn("Excel отчет усечен по ограничению числа строк")
+				return count, b.writeRow(sheet, []interface{}{fmt.Sprintf("Отчет усечен: выведены первые %d строк", maxRows)})
+			}
+
+			// Заполненный лист продолжается на следующем с повтором заголовков
+			if sheet.next > b.sheetRows {
+				b.closeRegion(sheet, region)
+				if region, err = b.startRegion(sheet, dataset.Name, columns); err != nil {
+					return count, err
+				}
+			}
+
+			cells = cells[:0]
+			for i, value := range row {
+				if i < len(styles) && styles[i] != 0 {
+					value = excelize.Cell{StyleID: styles[i], Value: value}
+				}
+				cells = append(cells, value)
+			}
+			if err := sheet.writer.SetRow(excelCell(1, sheet.next), cells); err != nil {
+				return count, fmt.Errorf("ошибка записи строки листа %s: %w", sheet.name, err)
+			}
+			sheet.next++
+			count++
+			for _, total := range totals {
+				if total.index < len(row) {
+					total.aggregate.Add(row[total.index])
+				}
+			}
+
+			if count%excelCancelCheckInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return count, err
+				}
+			}
+		}
+
+		b.closeRegion(sheet, region)
+		if err := b.writeTotals(sheet, dataset.Name, columns, totals); err != nil {
+			return count, err
+		}
+		sheet.next++
+	}
+	return count, nil
+}
+
+// datasetTotals возвращает итоги оформления по колонкам набора
+func (b *excelWorkbook) datasetTotals(columns []string) []excelTotal {
+	if b.layout.IsEmpty() {
+		return nil
+	}
+
+	var totals []excelTotal
+	for _, total := range b.layout.Totals {
+		if index := indexOf(columns, total.Column); index >= 0 {
+			b.found[total.Column] = true
+			totals = append(totals, excelTotal{index: index, aggregate: template.NewAggregate(total.Function)})
+		}
+	}
+	return totals
+}
+
+// writeTotals записывает строку итогов набора. Формулы итогов ссылаются на строки данных
+// набора на всех листах, в ячейках сохраняются посчитанные значения.
+func (b *excelWorkbook) writeTotals(sheet *excelSheet, dataset string, columns []string, totals []excelTotal) error {
+	if len(totals) == 0 {
+		return nil
+	}
+
+	cells := make([]interface{}, len(columns))
+	cells[0] = excelize.Cell{StyleID: b.headerStyle, Value: excelTotalsLabel}
+	for _, total := range totals {
+		column := columns[total.index]
+		var ranges []string
+		for _, region := range b.regions {
+			if data, ok := region.columnRange(column); ok && region.dataset == dataset {
+				ranges = append(ranges, template.RangeRef(data.sheet, data.cells))
+			}
+		}
+
+		cell := excelize.Cell{StyleID: b.formats[column], Value: total.aggregate.Value()}
+		if len(ranges) > 0 {
+			cell.Formula = total.aggregate.Formula(ranges)
+		}
+		cells[total.index] = cell
+	}
+	return b.writeRow(sheet, cells)
+}
+
+// finish применяет условное форматирование, завершает запись листов и создает сводные таблицы.
+// Условное форматирование задается до завершения потоковой записи, пока лист доступен для изменений.
+func (b *excelWorkbook) finish() error {
+	for _, column := range b.layoutColumns() {
+		if !b.found[column] {
+			b.logger.WithField("column", column).Warn("Колонка из оформления Excel не найдена в данных отчета")
+		}
+	}
+
+	if err := applyConditionalFormats(b.f, b.layout, b.regions, b.logger); err != nil {
+		return err
+	}
+
+	for _, writer := range b.writers {
+		if err := writer.Flush(); err != nil {
+			return fmt.Errorf("ошибка завершения записи листа: %w", err)
+		}
+	}
+
+	return addPivotTables(b.f, b.layout, b.regions, b.logger)
+}
+
+// sheet возвращает лист набора, создавая его при первом обращении
+func (b *excelWorkbook) sheet(name string) (*excelSheet, error) {
+	name = excelSheetName(name)
+	key := strings.ToLower(name)
+	if sheet, exists := b.sheets[key]; exists {
+		return sheet, nil
+	}
+
+	sheet := &excelSheet{base: name, part: 1}
+	if err := b.openSheet(sheet, name, b.inMemory[key]); err != nil {
+		return nil, err
+	}
+	b.sheets[key] = sheet
+	return sheet, nil
+}
+
+// openSheet создает лист книги и делает его текущим листом sheet
+func (b *excelWorkbook) openSheet(sheet *excelSheet, name string, inMemory bool) error {
+	var err error
+	if len(b.writers) == 0 {
+		err = b.f.SetSheetName(models.ExcelReportSheet, name)
+	} else {
+		_, err = b.f.NewSheet(name)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка создания листа %s: %w", name, err)
+	}
+
+	width := excelColumnWidth
+	if err := b.f.SetSheetProps(name, &excelize.SheetPropsOptions{DefaultColWidth: &width}); err != nil {
+		return fmt.Errorf("ошибка настройки листа %s: %w", name, err)
+	}
+	if b.rightToLeft {
+		rightToLeft := true
+		if err := b.f.SetSheetView(name, 0, &excelize.ViewOptions{RightToLeft: &rightToLeft}); err != nil {
+			return fmt.Errorf("ошибка настройки листа %s: %w", name, err)
+		}
+	}
+
+	var writer excelSheetWriter = &memorySheetWriter{f: b.f, sheet: name}
+	if !inMemory {
+		if writer, err = b.f.NewStreamWriter(name); err != nil {
+			return fmt.Errorf("ошибка создания листа %s: %w", name, err)
+		}
+	}
+
+	b.writers = append(b.writers, writer)
+	sheet.name = name
+	sheet.writer = writer
+	sheet.next = 1
+	sheet.sized = make(map[string]bool)
+	return nil
+}
+
+// continueSheet переводит запись на следующий лист продолжения
+func (b *excelWorkbook) continueSheet(sheet *excelSheet) error {
+	for {
+		sheet.part++
+		suffix := fmt.Sprintf(" (%d)", sheet.part)
+		base := []rune(sheet.base)
+		if len(base)+len(suffix) > excelMaxSheetName {
+			base = base[:excelMaxSheetName-len(suffix)]
+		}
+
+		name := string(base) + suffix
+		if b.reserved[strings.ToLower(name)] {
+			continue
+		}
+		b.reserved[strings.ToLower(name)] = true
+
+		b.logger.WithFields(logging.Fields{"sheet": sheet.base, "continuation": name}).Debug("Данные продолжаются на следующем листе")
+		return b.openSheet(sheet, name, false)
+	}
+}
+
+// startRegion записывает заголовки набора и открывает его область на текущем листе
+func (b *excelWorkbook) startRegion(sheet *excelSheet, dataset string, columns []string) (excelRegion, error) {
+	if sheet.next > b.sheetRows {
+		if err := b.continueSheet(sheet); err != nil {
+			return excelRegion{}, err
+		}
+	}
+	if err := b.setupColumns(sheet, columns); err != nil {
+		return excelRegion{}, fmt.Errorf("ошибка оформления листа %s: %w", sheet.name, err)
+	}
+
+	header := make([]interface{}, len(columns))
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = b.header(column)
+		header[i] = excelize.Cell{StyleID: b.headerStyle, Value: headers[i]}
+	}
+	if err := sheet.writer.SetRow(excelCell(1, sheet.next), header); err != nil {
+		return excelRegion{}, fmt.Errorf("ошибка записи заголовков листа %s: %w", sheet.name, err)
+	}
+
+	region := excelRegion{sheet: sheet.name, dataset: dataset, columns: columns, headers: headers, header: sheet.next}
+	sheet.next++
+	return region, nil
+}
+
+// closeRegion завершает область набора на последней записанной строке
+func (b *excelWorkbook) closeRegion(sheet *excelSheet, region excelRegion) {
+	region.last = sheet.next - 1
+	b.regions = append(b.regions, region)
+}
+
+// setupColumns закрепляет заголовок и задает ширину колонок оформления.
+// Заголовок закрепляется у первого набора листа. Ширина задается по первому набору
+// с колонкой на листе; на потоковом листе - только до записи первой строки.
+func (b *excelWorkbook) setupColumns(sheet *excelSheet, columns []string) error {
+	if b.layout.IsEmpty() {
+		return nil
+	}
+
+	if b.layout.FreezeHeader && sheet.next == 1 {
+		if err := sheet.writer.SetPanes(&excelize.Panes{
+			Freeze:      true,
+			YSplit:      1,
+			TopLeftCell: "A2",
+			ActivePane:  "bottomLeft",
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, column := range b.layout.Columns {
+		index := indexOf(columns, column.Name)
+		if index < 0 {
+			continue
+		}
+		b.found[column.Name] = true
+		if column.Width <= 0 || sheet.sized[column.Name] {
+			continue
+		}
+
+		err := sheet.writer.SetColWidth(index+1, index+1, column.Width)
+		if errors.Is(err, excelize.ErrStreamSetColWidth) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sheet.sized[column.Name] = true
+	}
+	return nil
+}
+
+// writeRow записывает строку после данных набора: итоги или пояснение
+func (b *excelWorkbook) writeRow(sheet *excelSheet, cells []interface{}) error {
+	if sheet.next > b.sheetRows {
+		if err := b.continueSheet(sheet); err != nil {
+			return err
+		}
+	}
+	if err := sheet.writer.SetRow(excelCell(1, sheet.next), cells); err != nil {
+		return fmt.Errorf("ошибка записи листа %s: %w", sheet.name, err)
+	}
+	sheet.next++
+	return nil
+}
+
+// layoutColumns возвращает имена колонок оформления и итогов
+func (b *excelWorkbook) layoutColumns() []string {
+	if b.layout.IsEmpty() {
+		return nil
+	}
+	columns := make([]string, 0, len(b.layout.Columns)+len(b.layout.Totals))
+	for _, column := range b.layout.Columns {
+		columns = append(columns, column.Name)
+	}
+	for _, total := range b.layout.Totals {
+		columns = append(columns, total.Column)
+	}
+	return columns
+}
+
+// excelSheetName возвращает имя листа набора, пустое - общий лист
+func excelSheetName(name string) string {
+	if name == "" {
+		return models.ExcelReportSheet
+	}
+	return name
+}
+
+// excelCell возвращает имя ячейки по номерам колонки и строки
+func excelCell(column, row int) string {
+	cell, _ := excelize.CoordinatesToCellName(column, row)
+	return cell
+}
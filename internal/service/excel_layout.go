@@ -0,0 +1,242 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// Цвета условного форматирования по умолчанию
+	defaultScaleMinColor = "#F8696B"
+	defaultScaleMaxColor = "#63BE7B"
+	defaultDataBarColor  = "#638EC6"
+
+	// pivotTableStyle стиль сводных таблиц
+	pivotTableStyle = "PivotStyleLight16"
+)
+
+// excelRegion область листа с данными одного набора: строка заголовков
+// и последняя строка данных (равна строке заголовков для пустого набора)
+type excelRegion struct {
+	sheet   string
+	dataset string
+	columns []string
+	// headers заголовки колонок на листе, с переводом могут отличаться от имен колонок
+	headers []string
+	header  int
+	last    int
+}
+
+// hasRows проверяет, есть ли в области строки данных
+func (r excelRegion) hasRows() bool {
+	return r.last > r.header
+}
+
+// headerOf возвращает заголовок колонки name на листе
+func (r excelRegion) headerOf(name string) string {
+	if index := indexOf(r.columns, name); index >= 0 && index < len(r.headers) {
+		return r.headers[index]
+	}
+	return name
+}
+
+// excelRange диапазон ячеек листа
+type excelRange struct {
+	sheet string
+	cells string
+}
+
+// columnRange возвращает диапазон данных колонки с именем name
+func (r excelRegion) columnRange(name string) (excelRange, bool) {
+	index := indexOf(r.columns, name)
+	if index < 0 || !r.hasRows() {
+		return excelRange{}, false
+	}
+	column, _ := excelize.ColumnNumberToName(index + 1)
+	return excelRange{sheet: r.sheet, cells: fmt.Sprintf("%s%d:%s%d", column, r.header+1, column, r.last)}, true
+}
+
+// applyConditionalFormats задает условное форматирование колонок всех наборов, где есть колонка.
+// Форматы чисел, ширина колонок и закрепление заголовка задаются при записи листов.
+func applyConditionalFormats(f *excelize.File, layout *models.ExcelLayout, regions []excelRegion, logger logging.Logger) error {
+	if layout.IsEmpty() || len(regions) == 0 {
+		return nil
+	}
+
+	// Правила одного диапазона задаются вместе, чтобы Excel учитывал их порядок
+	var ranges []excelRange
+	rules := make(map[excelRange][]excelize.ConditionalFormatOptions)
+	for _, rule := range layout.ConditionalFormats {
+		options, err := conditionalFormatOptions(f, rule)
+		if err != nil {
+			return fmt.Errorf("условное форматирование колонки %s: %w", rule.Column, err)
+		}
+
+		found := false
+		for _, region := range regions {
+			cells, ok := region.columnRange(rule.Column)
+			if !ok {
+				continue
+			}
+			found = true
+			if _, exists := rules[cells]; !exists {
+				ranges = append(ranges, cells)
+			}
+			rules[cells] = append(rules[cells], options)
+		}
+		if !found {
+			logger.WithField("column", rule.Column).Debug("Нет данных для условного форматирования колонки")
+		}
+	}
+	for _, cells := range ranges {
+		if err := f.SetConditionalFormat(cells.sheet, cells.cells, rules[cells]); err != nil {
+			return fmt.Errorf("ошибка условного форматирования %s!%s: %w", cells.sheet, cells.cells, err)
+		}
+	}
+	return nil
+}
+
+// addPivotTables создает сводные таблицы оформления
+func addPivotTables(f *excelize.File, layout *models.ExcelLayout, regions []excelRegion, logger logging.Logger) error {
+	if layout.IsEmpty() || len(regions) == 0 {
+		return nil
+	}
+
+	for _, pivot := range layout.PivotTables {
+		if err := addPivotTable(f, pivot, regions, logger); err != nil {
+			return fmt.Errorf("сводная таблица %s: %w", pivot.Name, err)
+		}
+	}
+	return nil
+}
+
+// conditionalFormatOptions преобразует правило условного форматирования в настройки excelize
+func conditionalFormatOptions(f *excelize.File, rule models.ExcelConditionalFormat) (excelize.ConditionalFormatOptions, error) {
+	var options excelize.ConditionalFormatOptions
+	switch rule.Type {
+	case models.ExcelConditionColorScale:
+		options = excelize.ConditionalFormatOptions{
+			Type:     "2_color_scale",
+			Criteria: "=",
+			MinType:  "min",
+			MaxType:  "max",
+			MinColor: colorOrDefault(rule.MinColor, defaultScaleMinColor),
+			MaxColor: colorOrDefault(rule.MaxColor, defaultScaleMaxColor),
+		}
+
+	case models.ExcelConditionDataBar:
+		options = excelize.ConditionalFormatOptions{
+			Type:     "data_bar",
+			Criteria: "=",
+			MinType:  "min",
+			MaxType:  "max",
+			BarColor: colorOrDefault(rule.BarColor, defaultDataBarColor),
+		}
+
+	default:
+		style := &excelize.Style{}
+		if rule.Fill != "" {
+			style.Fill = excelize.Fill{Type: "pattern", Color: []string{rule.Fill}, Pattern: 1}
+		}
+		if rule.FontColor != "" || rule.Bold {
+			style.Font = &excelize.Font{Color: rule.FontColor, Bold: rule.Bold}
+		}
+		format, err := f.NewConditionalStyle(style)
+		if err != nil {
+			return options, err
+		}
+
+		options = excelize.ConditionalFormatOptions{
+			Type:     "cell",
+			Criteria: rule.Operator,
+			Format:   &format,
+			Value:    rule.Value,
+		}
+		if strings.HasSuffix(rule.Operator, "between") {
+			options.Value = ""
+			options.MinValue = rule.Value
+			options.MaxValue = rule.MaxValue
+		}
+	}
+	return options, nil
+}
+
+// addPivotTable создает лист со сводной таблицей по данным набора.
+// Таблица пересчитывается Excel при открытии файла.
+func addPivotTable(f *excelize.File, pivot models.ExcelPivotTable, regions []excelRegion, logger logging.Logger) error {
+	dataset := pivot.Dataset
+	if dataset == "" {
+		dataset = regions[0].dataset
+	}
+
+	// Таблица строится по первой области набора, продолжение набора на других листах не учитывается
+	var region excelRegion
+	parts := 0
+	for _, candidate := range regions {
+		if candidate.dataset != dataset {
+			continue
+		}
+		if parts == 0 {
+			region = candidate
+		}
+		parts++
+	}
+	if parts == 0 {
+		return fmt.Errorf("набор данных %s не найден", dataset)
+	}
+	if parts > 1 {
+		logger.WithField("pivot", pivot.Name).Warn("Сводная таблица построена по первому листу набора данных")
+	}
+	if !region.hasRows() {
+		logger.WithField("pivot", pivot.Name).Warn("Сводная таблица не создана: в наборе данных нет строк")
+		return nil
+	}
+
+	if _, err := f.NewSheet(pivot.Name); err != nil {
+		return err
+	}
+
+	lastColumn, _ := excelize.ColumnNumberToName(len(region.columns))
+	options := &excelize.PivotTableOptions{
+		DataRange:           fmt.Sprintf("%s!$A$%d:$%s$%d", region.sheet, region.header, lastColumn, region.last),
+		PivotTableRange:     fmt.Sprintf("%s!$A$3:$H$20", pivot.Name),
+		RowGrandTotals:      true,
+		ColGrandTotals:      true,
+		ShowDrill:           true,
+		ShowRowHeaders:      true,
+		ShowColHeaders:      true,
+		ShowLastColumn:      true,
+		PivotTableStyleName: pivotTableStyle,
+	}
+	for _, row := range pivot.Rows {
+		options.Rows = append(options.Rows, excelize.PivotTableField{Data: region.headerOf(row), DefaultSubtotal: true})
+	}
+	for _, column := range pivot.Columns {
+		options.Columns = append(options.Columns, excelize.PivotTableField{Data: region.headerOf(column), DefaultSubtotal: true})
+	}
+	for _, value := range pivot.Values {
+		function := value.Function
+		if function == "" {
+			function = "sum"
+		}
+		options.Data = append(options.Data, excelize.PivotTableField{
+			Data:     region.headerOf(value.Column),
+			Name:     fmt.Sprintf("%s (%s)", region.headerOf(value.Column), function),
+			Subtotal: function,
+		})
+	}
+
+	return f.AddPivotTable(options)
+}
+
+func colorOrDefault(color, fallback string) string {
+	if color == "" {
+		return fallback
+	}
+	return color
+}
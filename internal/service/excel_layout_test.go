@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func newTestExcelLayout() *models.ExcelLayout {
+	return &models.ExcelLayout{
+		FreezeHeader: true,
+		Columns:      []models.ExcelColumn{{Name: "amount", NumberFormat: "#,##0.00", Width: 18}},
+		ConditionalFormats: []models.ExcelConditionalFormat{
+			{Column: "amount", Operator: ">", Value: "150", Fill: "#FFC7CE", FontColor: "#9C0006"},
+			{Column: "amount", Type: models.ExcelConditionDataBar},
+		},
+		PivotTables: []models.ExcelPivotTable{{
+			Name:    "By region",
+			Dataset: "totals",
+			Rows:    []string{"region"},
+			Values:  []models.ExcelPivotValue{{Column: "amount"}},
+		}},
+	}
+}
+
+func TestDefinitionExcelLayout(t *testing.T) {
+	db, repository := setupDefinitionTest(t)
+	service := NewDefinitionService(repository, newTestQueryValidator(t, "sales"), newTestDataSources(t, db, nil), new(MockStorage), setupTestLogger())
+	ctx := context.Background()
+
+	definition := newTestDefinition()
+	definition.ExcelLayout = newTestExcelLayout()
+	require.NoError(t, service.CreateDefinition(ctx, definition))
+
+	stored, err := service.GetDefinition(ctx, definition.ID)
+	require.NoError(t, err)
+	assert.Equal(t, definition.ExcelLayout, stored.ExcelLayout)
+
+	// Оформление Excel не применяется к другим форматам
+	format := models.FormatCSV
+	_, err = service.UpdateDefinition(ctx, definition.ID, DefinitionUpdateParams{Format: &format, UpdatedBy: "editor"})
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+
+	// Сводная таблица ссылается на запрос определения
+	invalid := newTestExcelLayout()
+	invalid.PivotTables[0].Dataset = "missing"
+	invalid.ConditionalFormats[0].Fill = "red"
+	_, err = service.UpdateDefinition(ctx, definition.ID, DefinitionUpdateParams{ExcelLayout: invalid, UpdatedBy: "editor"})
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+	assert.ErrorContains(t, err, "missing")
+	assert.ErrorContains(t, err, "#RRGGBB")
+
+	// Пустое оформление удаляет текущее
+	_, err = service.UpdateDefinition(ctx, definition.ID, DefinitionUpdateParams{ExcelLayout: &models.ExcelLayout{}, UpdatedBy: "editor"})
+	require.NoError(t, err)
+	stored, err = service.GetDefinition(ctx, definition.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.ExcelLayout.IsEmpty())
+}
+
+func TestExcelReportGeneratorAppliesLayout(t *testing.T) {
+	generator := NewExcelReportGenerator(setupTestLogger())
+
+	report := &models.Report{ID: 3, Title: "Продажи"}
+	data := &ReportData{
+		Layout: newTestExcelLayout(),
+		Datasets: []Dataset{
+			{Name: "summary", Rows: &sliceRows{columns: []string{"total"}, rows: [][]interface{}{{450}}}},
+			{Name: "totals", Rows: &sliceRows{
+				columns: []string{"region", "amount"},
+				rows: [][]interface{}{
+					{"north", 100.5},
+					{"south", 200},
+					{"north", 149.5},
+				},
+			}},
+		},
+	}
+
+	reader, _, err := generator.Generate(context.Background(), report, data)
+	require.NoError(t, err)
+
+	f, err := excelize.OpenReader(reader)
+	require.NoError(t, err)
+	defer f.Close()
+
+	sheet := models.ExcelReportSheet
+
+	// Второй набор выводится после пустой строки со своими заголовками
+	value, err := f.GetCellValue(sheet, "B4")
+	require.NoError(t, err)
+	assert.Equal(t, "amount", value)
+
+	// Формат чисел применен к данным колонки
+	styleID, err := f.GetCellStyle(sheet, "B5")
+	require.NoError(t, err)
+	style, err := f.GetStyle(styleID)
+	require.NoError(t, err)
+	require.NotNil(t, style.CustomNumFmt)
+	assert.Equal(t, "#,##0.00", *style.CustomNumFmt)
+
+	width, err := f.GetColWidth(sheet, "B")
+	require.NoError(t, err)
+	assert.Equal(t, 18.0, width)
+
+	panes, err := f.GetPanes(sheet)
+	require.NoError(t, err)
+	assert.True(t, panes.Freeze)
+	assert.Equal(t, 1, panes.YSplit)
+
+	formats, err := f.GetConditionalFormats(sheet)
+	require.NoError(t, err)
+	require.Contains(t, formats, "B5:B7")
+	assert.Len(t, formats["B5:B7"], 2)
+
+	pivots, err := f.GetPivotTables("By region")
+	require.NoError(t, err)
+	require.Len(t, pivots, 1)
+	assert.Equal(t, "Report!A4:B7", pivots[0].DataRange)
+}
+
+func TestExcelReportGeneratorSheets(t *testing.T) {
+	generator := NewExcelReportGenerator(setupTestLogger())
+
+	layout := newTestExcelLayout()
+	layout.PivotTables[0].Name = "Pivot"
+	data := &ReportData{
+		Layout: layout,
+		Datasets: []Dataset{
+			{Name: "totals", Sheet: "Sales data", Rows: &sliceRows{
+				columns: []string{"region", "amount"},
+				rows:    [][]interface{}{{"north", 100}, {"south", 200}},
+			}},
+			{Name: "summary", Rows: &sliceRows{columns: []string{"total"}, rows: [][]interface{}{{300}}}},
+			// Листы сопоставляются без учета регистра
+			{Name: "plan", Sheet: "sales DATA", Rows: &sliceRows{
+				columns: []string{"region", "amount"},
+				rows:    [][]interface{}{{"north", 150}},
+			}},
+		},
+	}
+
+	reader, _, err := generator.Generate(context.Background(), &models.Report{ID: 4, Title: "Листы"}, data)
+	require.NoError(t, err)
+
+	f, err := excelize.OpenReader(reader)
+	require.NoError(t, err)
+	defer f.Close()
+
+	assert.Equal(t, []string{"Sales data", models.ExcelReportSheet, "Pivot"}, f.GetSheetList())
+
+	rows, err := f.GetRows("Sales data", excelize.Options{RawCellValue: true})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"region", "amount"},
+		{"north", "100"},
+		{"south", "200"},
+		nil,
+		{"region", "amount"},
+		{"north", "150"},
+	}, rows)
+
+	rows, err = f.GetRows(models.ExcelReportSheet)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"total"}, {"300"}}, rows)
+
+	// Оформление применяется к наборам на всех листах
+	formats, err := f.GetConditionalFormats("Sales data")
+	require.NoError(t, err)
+	assert.Contains(t, formats, "B2:B3")
+	assert.Contains(t, formats, "B6:B6")
+
+	pivots, err := f.GetPivotTables("Pivot")
+	require.NoError(t, err)
+	require.Len(t, pivots, 1)
+	assert.Equal(t, "Sales data!A1:B3", pivots[0].DataRange)
+}
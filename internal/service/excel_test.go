@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+// numberRows возвращает набор из count строк с номерами
+func numberRows(count int) *sliceRows {
+	rows := &sliceRows{columns: []string{"n", "amount"}}
+	for i := 1; i <= count; i++ {
+		rows.rows = append(rows.rows, []interface{}{i, i * 10})
+	}
+	return rows
+}
+
+func TestExcelReportGeneratorContinuationSheets(t *testing.T) {
+	generator := NewExcelReportGeneratorFromConfig(config.Excel{SheetRows: 3}, config.Templates{}, setupTestLogger())
+
+	data := &ReportData{
+		Layout: &models.ExcelLayout{
+			FreezeHeader:       true,
+			ConditionalFormats: []models.ExcelConditionalFormat{{Column: "amount", Type: models.ExcelConditionDataBar}},
+		},
+		Datasets: []Dataset{
+			{Name: "numbers", Rows: numberRows(5)},
+			// Имя листа продолжения укорачивается до 31 символа
+			{Name: "long", Sheet: "Very long sheet name for report", Rows: numberRows(3)},
+		},
+	}
+
+	reader, _, err := generator.Generate(context.Background(), &models.Report{ID: 5, Title: "Продолжение"}, data)
+	require.NoError(t, err)
+
+	f, err := excelize.OpenReader(reader)
+	require.NoError(t, err)
+	defer f.Close()
+
+	assert.Equal(t, []string{
+		models.ExcelReportSheet, "Report (2)", "Report (3)",
+		"Very long sheet name for report", "Very long sheet name for re (2)",
+	}, f.GetSheetList())
+
+	// Заголовки повторяются на каждом листе продолжения
+	for sheet, expected := range map[string][][]string{
+		"Report":     {{"n", "amount"}, {"1", "10"}, {"2", "20"}},
+		"Report (2)": {{"n", "amount"}, {"3", "30"}, {"4", "40"}},
+		"Report (3)": {{"n", "amount"}, {"5", "50"}},
+	} {
+		rows, err := f.GetRows(sheet)
+		require.NoError(t, err)
+		assert.Equal(t, expected, rows, sheet)
+	}
+
+	// Оформление применяется к каждому листу потоковой записи
+	panes, err := f.GetPanes("Report (2)")
+	require.NoError(t, err)
+	assert.True(t, panes.Freeze)
+
+	formats, err := f.GetConditionalFormats("Report (3)")
+	require.NoError(t, err)
+	assert.Contains(t, formats, "B2:B2")
+}
+
+func TestExcelReportGeneratorMaxRows(t *testing.T) {
+	generator := NewExcelReportGeneratorFromConfig(config.Excel{MaxRows: 3, SheetRows: excelize.TotalRows}, config.Templates{}, setupTestLogger())
+
+	data := &ReportData{Datasets: []Dataset{
+		{Name: "numbers", Rows: numberRows(5)},
+		{Name: "skipped", Sheet: "Skipped", Rows: numberRows(2)},
+	}}
+
+	reader, _, err := generator.Generate(context.Background(), &models.Report{ID: 6, Title: "Усечение"}, data)
+	require.NoError(t, err)
+
+	f, err := excelize.OpenReader(reader)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// Наборы после ограничения не выводятся
+	assert.Equal(t, []string{models.ExcelReportSheet}, f.GetSheetList())
+
+	rows, err := f.GetRows(models.ExcelReportSheet)
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	assert.Equal(t, []string{"3", "30"}, rows[3])
+	assert.Equal(t, []string{fmt.Sprintf("Отчет усечен: выведены первые %d строк", 3)}, rows[4])
+}
+
+func TestExcelReportGeneratorCanceled(t *testing.T) {
+	generator := NewExcelReportGenerator(setupTestLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := &ReportData{Datasets: []Dataset{{Name: "numbers", Rows: numberRows(excelCancelCheckInterval + 1)}}}
+	reader, _, err := generator.Generate(ctx, &models.Report{ID: 7, Title: "Отмена"}, data)
+	require.NoError(t, err)
+
+	_, err = excelize.OpenReader(reader)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestExcelReportGeneratorTemplate(t *testing.T) {
+	template := excelize.NewFile()
+	defer template.Close()
+	for cell, value := range map[string]string{
+		"A1": "{{report_title}}",
+		"A2": "{{range}}",
+		"A3": "{{.n}}", "B3": "{{.amount}}",
+		"A4": "{{end}}",
+		"A5": "Итого",
+	} {
+		require.NoError(t, template.SetCellValue("Sheet1", cell, value))
+	}
+	content, err := template.WriteToBuffer()
+	require.NoError(t, err)
+
+	generator := NewExcelReportGenerator(setupTestLogger())
+	data := &ReportData{Template: content.Bytes(), Datasets: []Dataset{{Name: "numbers", Rows: numberRows(2)}}}
+	reader, _, err := generator.Generate(context.Background(), &models.Report{ID: 8, Title: "Шаблон"}, data)
+	require.NoError(t, err)
+
+	f, err := excelize.OpenReader(reader)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rows, err := f.GetRows("Sheet1")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Шаблон"}, {"1", "10"}, {"2", "20"}, {"Итого"}}, rows)
+
+	// Оформление Excel задается шаблоном
+	definition := newTestDefinition()
+	definition.TemplateKey = "templates/sales.xlsx"
+	definition.Format = models.FormatXLSX
+	assert.NoError(t, definition.Validate())
+	definition.ExcelLayout = &models.ExcelLayout{FreezeHeader: true}
+	assert.ErrorContains(t, definition.Validate(), "по шаблону")
+}
+
+func TestExcelReportGeneratorTotals(t *testing.T) {
+	generator := NewExcelReportGeneratorFromConfig(config.Excel{SheetRows: 3}, config.Templates{}, setupTestLogger())
+
+	data := &ReportData{
+		Layout:   &models.ExcelLayout{Totals: []models.ExcelTotal{{Column: "amount"}, {Column: "missing", Function: "max"}}},
+		Datasets: []Dataset{{Name: "numbers", Rows: numberRows(5)}},
+	}
+	reader, _, err := generator.Generate(context.Background(), &models.Report{ID: 9, Title: "Итоги"}, data)
+	require.NoError(t, err)
+
+	f, err := excelize.OpenReader(reader)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rows, err := f.GetRows("Report (3)")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"n", "amount"}, {"5", "50"}, {"Итого", "150"}}, rows)
+
+	// Итог учитывает продолжение набора на других листах
+	formula, err := f.GetCellFormula("Report (3)", "B3")
+	require.NoError(t, err)
+	assert.Equal(t, "SUM('Report'!B2:B3,'Report (2)'!B2:B3,'Report (3)'!B2:B2)", formula)
+
+	definition := newTestDefinition()
+	definition.ExcelLayout = &models.ExcelLayout{Totals: []models.ExcelTotal{{Column: "amount", Function: "median"}}}
+	assert.ErrorContains(t, definition.Validate(), "median")
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+
+	"report_srv/internal/database"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+)
+
+// maxErrorMessageLength ограничение длины сообщения об ошибке в отчете
+const maxErrorMessageLength = 1000
+
+// GenerationError ошибка генерации отчета с кодом причины
+type GenerationError struct {
+	Code models.ReportErrorCode
+	Err  error
+}
+
+func (e *GenerationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *GenerationError) Unwrap() error {
+	return e.Err
+}
+
+// withErrorCode помечает ошибку кодом причины. Код, назначенный ближе
+// к источнику ошибки, сохраняется: ошибка запроса, прочитанного при сохранении
+// потокового файла, остается ошибкой запроса.
+func withErrorCode(code models.ReportErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	var generationErr *GenerationError
+	if errors.As(err, &generationErr) {
+		return err
+	}
+	return &GenerationError{Code: code, Err: err}
+}
+
+// classifyError возвращает код причины и сообщение для сохранения в отчете
+func classifyError(err error) (models.ReportErrorCode, string) {
+	if err == nil {
+		return models.ErrorCodeInternal, ""
+	}
+
+	code := models.ErrorCodeInternal
+	var generationErr *GenerationError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		code = models.ErrorCodeTimeout
+	case errors.As(err, &generationErr):
+		code = generationErr.Code
+	}
+
+	return code, truncateMessage(err.Error(), maxErrorMessageLength)
+}
+
+// isTransientError сообщает, может ли повторная генерация отчета завершиться успешно:
+// недоступность или таймаут БД и источников данных, ошибки хранилища 5xx. Ошибки шаблона
+// и сборки файла, ошибки SQL и отмена генерации не повторяются
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var generationErr *GenerationError
+	if errors.As(err, &generationErr) {
+		switch generationErr.Code {
+		case models.ErrorCodeTemplate, models.ErrorCodeGeneration:
+			return false
+		}
+	}
+	return database.IsTransientError(err) || storage.IsRetryable(err)
+}
+
+// truncateMessage обрезает сообщение до заданного числа символов
+func truncateMessage(message string, limit int) string {
+	if utf8.RuneCountInString(message) <= limit {
+		return message
+	}
+	runes := []rune(message)
+	return string(runes[:limit-1]) + "…"
+}
+
+// failReport переводит отчет в статус failed с причиной ошибки и публикует событие
+func failReport(ctx context.Context, repository ReportRepository, publisher events.Publisher, logger logging.Logger, reportID uint, cause error) error {
+	code, message := classifyError(cause)
+	if err := repository.MarkFailed(ctx, reportID, code, message); err != nil {
+		return err
+	}
+
+	logger.WithField("error_code", code).Warn("Генерация отчета завершилась ошибкой")
+	publishEvent(ctx, publisher, logger,
+		events.NewEvent(events.ReportFailed, reportID, models.StatusFailed).WithErrorCode(code))
+	return nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// defaultMaxFanOut наибольшее число отчетов одного запуска расписания по умолчанию
+const defaultMaxFanOut = 500
+
+// ErrFanOutLimit итерационный запрос вернул больше строк, чем отчетов разрешено создать за запуск
+var ErrFanOutLimit = newCategoryError(ErrValidation, "итерационный запрос вернул слишком много строк")
+
+// ScheduleRun отчет одного запуска расписания
+type ScheduleRun struct {
+	// Parameters параметры отчета: параметры расписания и значения строки итерационного запроса
+	Parameters models.JSON
+	// Label значение первой колонки строки итерационного запроса, добавляется к заголовку отчета
+	Label string
+}
+
+// ScheduleFanOut раскладывает запуск расписания на отчеты
+type ScheduleFanOut interface {
+	// Expand возвращает отчеты запуска расписания. Расписание без итерационного запроса
+	// в определении создает один отчет с параметрами расписания
+	Expand(ctx context.Context, schedule *models.Schedule) ([]ScheduleRun, error)
+}
+
+// DefinitionFanOut выполняет итерационный запрос определения расписания и создает
+// по отчету на строку результата
+type DefinitionFanOut struct {
+	definitions DefinitionRepository
+	queries     QueryValidator
+	sources     DataSources
+	// maxRuns наибольшее число отчетов одного запуска
+	maxRuns int
+	logger  logging.Logger
+}
+
+// NewDefinitionFanOut создает раскладку запусков расписаний по итерационным запросам определений.
+// maxRuns 0 - ограничение по умолчанию
+func NewDefinitionFanOut(
+	definitions DefinitionRepository,
+	queries QueryValidator,
+	sources DataSources,
+	maxRuns int,
+	logger logging.Logger,
+) *DefinitionFanOut {
+	if maxRuns <= 0 {
+		maxRuns = defaultMaxFanOut
+	}
+	return &DefinitionFanOut{
+		definitions: definitions,
+		queries:     queries,
+		sources:     sources,
+		maxRuns:     maxRuns,
+		logger:      logger,
+	}
+}
+
+// Expand выполняет итерационный запрос определения расписания. Значения колонок строки
+// заменяют одноименные параметры расписания. Если строк больше допустимого, запуск не
+// создает ни одного отчета: частичный набор отчетов сложнее заметить, чем ошибку
+func (f *DefinitionFanOut) Expand(ctx context.Context, schedule *models.Schedule) ([]ScheduleRun, error) {
+	single := []ScheduleRun{{Parameters: schedule.Parameters}}
+	if schedule.ReportType == "" {
+		return single, nil
+	}
+
+	definition, err := f.definitions.GetByName(ctx, schedule.ReportType)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return single, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения определения отчета %s: %w", schedule.ReportType, err)
+	}
+	if definition.Iterator.IsEmpty() {
+		return single, nil
+	}
+
+	if err := f.queries.Validate(definition.Iterator.SQL); err != nil {
+		return nil, fmt.Errorf("итерационный запрос определения %s: %w", definition.Name, err)
+	}
+	db, err := f.sources.DB(ctx, definition.Iterator.Source)
+	if err != nil {
+		return nil, fmt.Errorf("итерационный запрос определения %s: %w", definition.Name, err)
+	}
+
+	params := map[string]interface{}(schedule.Parameters)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	rows := &queryRows{ctx: ctx, db: db, name: "iterator", sql: definition.Iterator.SQL, params: params}
+	defer rows.Close()
+
+	var runs []ScheduleRun
+	for {
+		values, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == f.maxRuns {
+			return nil, fmt.Errorf("%w: определение %s, не более %d", ErrFanOutLimit, definition.Name, f.maxRuns)
+		}
+
+		parameters := models.NewJSON()
+		for key, value := range schedule.Parameters {
+			parameters.Set(key, value)
+		}
+		for i, column := range rows.Columns() {
+			parameters.Set(column, values[i])
+		}
+		run := ScheduleRun{Parameters: parameters}
+		if len(values) > 0 && values[0] != nil {
+			run.Label = fmt.Sprint(values[0])
+		}
+		runs = append(runs, run)
+	}
+
+	logging.FromContext(ctx, f.logger).WithFields(logging.Fields{
+		"schedule_id": schedule.ID,
+		"definition":  definition.Name,
+		"reports":     len(runs),
+	}).Debug("Итерационный запрос расписания выполнен")
+	return runs, nil
+}
+
+// runTitle возвращает заголовок отчета запуска с меткой строки итерационного запроса,
+// обрезанный до допустимой длины заголовка
+func runTitle(title string, run ScheduleRun) string {
+	if run.Label == "" {
+		return title
+	}
+	title = fmt.Sprintf("%s - %s", title, run.Label)
+	for len(title) > 255 {
+		_, size := utf8.DecodeLastRuneInString(title)
+		title = title[:len(title)-size]
+	}
+	return title
+}
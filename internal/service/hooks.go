@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"report_srv/internal/models"
+)
+
+// BeforeQueryHook вызывается перед загрузкой данных отчета, например для проверки
+// прав или дополнения параметров. Ошибка прерывает генерацию.
+type BeforeQueryHook interface {
+	BeforeQuery(ctx context.Context, report *models.Report) error
+}
+
+// AfterFillHook вызывается после загрузки данных перед генерацией файла. Может заменить
+// наборы, шаблон или оформление. Для архива zip вызывается для данных каждого файла.
+type AfterFillHook interface {
+	AfterFill(ctx context.Context, report *models.Report, data *ReportData) error
+}
+
+// BeforeStoreHook вызывается перед сохранением файла в хранилище. Может заменить
+// содержимое (водяной знак, проверка антивирусом) и ключ файла в хранилище.
+type BeforeStoreHook interface {
+	BeforeStore(ctx context.Context, report *models.Report, file *GeneratedFile) error
+}
+
+// GeneratedFile сгенерированный файл отчета перед сохранением
+type GeneratedFile struct {
+	// Reader содержимое файла. Замененный reader, реализующий io.Closer, закрывается после сохранения
+	Reader io.Reader
+	// Filename имя файла, которое вернул генератор
+	Filename string
+	// Extension расширение файла в хранилище с учетом сжатия, например csv.gz
+	Extension string
+	// Key ключ файла в хранилище
+	Key string
+}
+
+// PipelineHooks хуки генерации отчетов в порядке регистрации. Позволяют добавить
+// поведение генерации без изменения исполнителя задач.
+type PipelineHooks struct {
+	BeforeQuery []BeforeQueryHook
+	AfterFill   []AfterFillHook
+	BeforeStore []BeforeStoreHook
+}
+
+// NewPipelineHooks создает набор хуков генерации
+func NewPipelineHooks(beforeQuery []BeforeQueryHook, afterFill []AfterFillHook, beforeStore []BeforeStoreHook) *PipelineHooks {
+	return &PipelineHooks{BeforeQuery: beforeQuery, AfterFill: afterFill, BeforeStore: beforeStore}
+}
+
+// Count возвращает число зарегистрированных хуков
+func (h *PipelineHooks) Count() int {
+	if h == nil {
+		return 0
+	}
+	return len(h.BeforeQuery) + len(h.AfterFill) + len(h.BeforeStore)
+}
+
+// beforeQuery вызывает хуки BeforeQuery до первой ошибки
+func (h *PipelineHooks) beforeQuery(ctx context.Context, report *models.Report) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.BeforeQuery {
+		if err := hook.BeforeQuery(ctx, report); err != nil {
+			return fmt.Errorf("хук BeforeQuery %T: %w", hook, err)
+		}
+	}
+	return nil
+}
+
+// afterFill вызывает хуки AfterFill до первой ошибки
+func (h *PipelineHooks) afterFill(ctx context.Context, report *models.Report, data *ReportData) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.AfterFill {
+		if err := hook.AfterFill(ctx, report, data); err != nil {
+			return fmt.Errorf("хук AfterFill %T: %w", hook, err)
+		}
+	}
+	return nil
+}
+
+// beforeStore вызывает хуки BeforeStore до первой ошибки
+func (h *PipelineHooks) beforeStore(ctx context.Context, report *models.Report, file *GeneratedFile) error {
+	if h == nil {
+		return nil
+	}
+	for _, hook := range h.BeforeStore {
+		if err := hook.BeforeStore(ctx, report, file); err != nil {
+			return fmt.Errorf("хук BeforeStore %T: %w", hook, err)
+		}
+		if file.Reader == nil || file.Key == "" {
+			return fmt.Errorf("хук BeforeStore %T вернул пустое содержимое или ключ файла", hook)
+		}
+	}
+	return nil
+}
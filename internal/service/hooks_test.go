@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingHooks записывает вызовы хуков и помечает файл отчета
+type recordingHooks struct {
+	calls       []string
+	beforeQuery error
+}
+
+func (h *recordingHooks) BeforeQuery(ctx context.Context, report *models.Report) error {
+	h.calls = append(h.calls, "before_query")
+	return h.beforeQuery
+}
+
+func (h *recordingHooks) AfterFill(ctx context.Context, report *models.Report, data *ReportData) error {
+	h.calls = append(h.calls, "after_fill")
+	return nil
+}
+
+func (h *recordingHooks) BeforeStore(ctx context.Context, report *models.Report, file *GeneratedFile) error {
+	h.calls = append(h.calls, "before_store")
+	file.Reader = io.MultiReader(file.Reader, strings.NewReader("# checked\n"))
+	file.Key = "scanned/" + file.Key
+	return nil
+}
+
+func TestExecutorPipelineHooks(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	basePath := t.TempDir()
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: basePath, Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+	repository := NewGormReportRepository(db, logger)
+
+	hooks := &recordingHooks{}
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(local, logger), logger).
+		WithHooks(NewPipelineHooks([]BeforeQueryHook{hooks}, []AfterFillHook{hooks}, []BeforeStoreHook{hooks}))
+
+	report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV,
+		CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+	require.NoError(t, executor.Execute(ctx, Task{ID: "report_1", Type: TaskTypeReportGeneration, Data: report.ID}))
+	assert.Equal(t, []string{"before_query", "after_fill", "before_store"}, hooks.calls)
+
+	// Файл сохраняется под ключом и с содержимым из хука
+	completed, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(completed.FileKey, "scanned/"))
+	content, err := os.ReadFile(filepath.Join(basePath, completed.FileKey))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(content), "# checked\n"))
+
+	// Ошибка хука прерывает генерацию до загрузки данных
+	hooks.calls = nil
+	hooks.beforeQuery = errors.New("доступ запрещен")
+	failed := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV,
+		CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(failed).Error)
+	err = executor.Execute(ctx, Task{ID: "report_2", Type: TaskTypeReportGeneration, Data: failed.ID})
+	require.Error(t, err)
+	assert.Equal(t, []string{"before_query"}, hooks.calls)
+	code, message := classifyError(err)
+	assert.Equal(t, models.ErrorCodeGeneration, code)
+	assert.Contains(t, message, "доступ запрещен")
+}
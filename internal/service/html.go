@@ -0,0 +1,465 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+const (
+	// htmlDefaultLang язык документа для отчетов без локали
+	htmlDefaultLang = "ru"
+
+	// Типы диаграмм HTML отчета
+	HTMLChartBar  = "bar"
+	HTMLChartLine = "line"
+
+	// htmlFlushInterval количество строк между сбросами буфера и проверками отмены
+	htmlFlushInterval = 1000
+
+	// htmlChartMaxPoints число первых строк набора, попадающих на диаграмму
+	htmlChartMaxPoints = 50
+	// htmlChartLabelLength длина подписи значения на оси диаграммы
+	htmlChartLabelLength = 16
+
+	// Размеры области диаграммы в координатах SVG
+	htmlChartWidth  = 800
+	htmlChartHeight = 360
+	htmlChartLeft   = 64
+	htmlChartRight  = htmlChartWidth - 16
+	htmlChartTop    = 16
+	htmlChartBottom = htmlChartHeight - 80
+)
+
+//go:embed templates/report.html.tmpl
+var htmlTemplates embed.FS
+
+// htmlReportTemplate шаблон HTML отчета. Документ выводится частями
+// (заголовок, начало и конец набора, строки), чтобы строки писались потоково.
+var htmlReportTemplate = template.Must(template.ParseFS(htmlTemplates, "templates/report.html.tmpl"))
+
+// HTMLChart настройки диаграммы HTML отчета из параметра html_chart:
+// по колонке Label берутся подписи, по колонке Value - числовые значения
+type HTMLChart struct {
+	Type    string `json:"type"`
+	Dataset string `json:"dataset"`
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+	Title   string `json:"title"`
+}
+
+// ParseHTMLChart читает настройки диаграммы из параметров отчета.
+// Возвращает nil, если диаграмма не задана.
+func ParseHTMLChart(parameters models.JSON) (*HTMLChart, error) {
+	value, exists := parameters.Get(models.ParamHTMLChart)
+	if !exists || value == nil {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("неверный параметр %s: %w", models.ParamHTMLChart, err)
+	}
+	var chart HTMLChart
+	if err := json.Unmarshal(payload, &chart); err != nil {
+		return nil, fmt.Errorf("параметр %s должен быть объектом: %w", models.ParamHTMLChart, err)
+	}
+
+	if chart.Type == "" {
+		chart.Type = HTMLChartBar
+	}
+	if chart.Type != HTMLChartBar && chart.Type != HTMLChartLine {
+		return nil, fmt.Errorf("неподдерживаемый тип диаграммы: %s", chart.Type)
+	}
+	if chart.Label == "" || chart.Value == "" {
+		return nil, fmt.Errorf("для диаграммы должны быть заданы колонки label и value")
+	}
+	return &chart, nil
+}
+
+// HTMLReportGenerator потоковый генератор HTML отчетов для просмотра в браузере.
+// Каждый набор данных выводится отдельной таблицей, стили встроены в документ.
+type HTMLReportGenerator struct {
+	logger logging.Logger
+}
+
+// NewHTMLReportGenerator создает новый генератор HTML отчетов
+func NewHTMLReportGenerator(logger logging.Logger) ReportGenerator {
+	return &HTMLReportGenerator{logger: logger}
+}
+
+func init() {
+	RegisterGenerator(models.FormatHTML, func(_ config.Config, logger logging.Logger) ReportGenerator {
+		return NewHTMLReportGenerator(logger)
+	})
+}
+
+// Generate запускает потоковую генерацию HTML отчета.
+// Закрытие возвращенного reader прерывает генерацию.
+func (g *HTMLReportGenerator) Generate(ctx context.Context, report *models.Report, data *ReportData) (io.Reader, string, error) {
+	logger := logging.FromContext(ctx, g.logger).WithFields(logging.Fields{
+		"report_id": report.ID,
+		"title":     report.Title,
+	})
+
+	chart, err := ParseHTMLChart(report.Parameters)
+	if err != nil {
+		return nil, "", err
+	}
+
+	logger.Info("Генерация HTML отчета")
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		count, err := g.writeDocument(ctx, pw, report, data, chart, logger)
+		if err != nil {
+			logger.WithError(err).Error("Ошибка записи HTML файла")
+			pw.CloseWithError(fmt.Errorf("ошибка генерации HTML файла: %w", err))
+			return
+		}
+		logger.WithField("rows", count).Info("HTML отчет сгенерирован успешно")
+		pw.Close()
+	}()
+
+	filename := fmt.Sprintf("report_%d_%s.html", report.ID, report.LocalTime(time.Now()).Format("20060102_150405"))
+	return pr, filename, nil
+}
+
+// htmlDataset данные начала и конца таблицы набора
+type htmlDataset struct {
+	Name    string
+	Columns []string
+	Rows    int
+	Chart   *htmlChartView
+}
+
+// htmlCell ячейка таблицы
+type htmlCell struct {
+	Text    string
+	Numeric bool
+}
+
+// writeDocument записывает документ целиком и возвращает число строк данных
+func (g *HTMLReportGenerator) writeDocument(ctx context.Context, w io.Writer, report *models.Report, data *ReportData, chart *HTMLChart, logger logging.Logger) (int, error) {
+	buffered := bufio.NewWriter(w)
+
+	lang, dir := htmlDefaultLang, "ltr"
+	if data.Locale != "" {
+		lang = data.Locale
+	}
+	if data.RightToLeft() {
+		dir = "rtl"
+	}
+
+	header := map[string]interface{}{
+		"Lang":        lang,
+		"Dir":         dir,
+		"ID":          report.ID,
+		"Title":       report.Title,
+		"Description": report.Description,
+		"CreatedBy":   report.CreatedBy,
+		"GeneratedAt": report.LocalTime(time.Now()).Format("2006-01-02 15:04:05"),
+	}
+	if err := htmlReportTemplate.ExecuteTemplate(buffered, "header", header); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	chartPending := chart != nil
+	for _, dataset := range data.Datasets {
+		// Диаграмма строится по указанному набору или по первому набору с нужными колонками
+		var datasetChart *HTMLChart
+		if chartPending && (chart.Dataset == "" || chart.Dataset == dataset.Name) {
+			datasetChart = chart
+		}
+
+		count, chartDrawn, err := g.writeDataset(ctx, buffered, dataset, datasetChart, data.Header)
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if chartDrawn {
+			chartPending = false
+		}
+	}
+	if chartPending {
+		logger.WithField("chart", chart).Warn("Не найден набор данных для диаграммы HTML отчета")
+	}
+
+	if err := htmlReportTemplate.ExecuteTemplate(buffered, "footer", nil); err != nil {
+		return total, err
+	}
+	return total, buffered.Flush()
+}
+
+// writeDataset записывает таблицу набора и, если задана, диаграмму по его первым строкам.
+// Колонки диаграммы ищутся по именам, в таблицу выводятся переведенные заголовки.
+func (g *HTMLReportGenerator) writeDataset(ctx context.Context, w *bufio.Writer, dataset Dataset, chart *HTMLChart, header func(string) string) (int, bool, error) {
+	columns := dataset.Rows.Columns()
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = header(column)
+	}
+	section := htmlDataset{Name: dataset.Name, Columns: headers}
+
+	labelIndex, valueIndex := -1, -1
+	if chart != nil {
+		labelIndex, valueIndex = indexOf(columns, chart.Label), indexOf(columns, chart.Value)
+	}
+	drawChart := labelIndex >= 0 && valueIndex >= 0
+	var points []htmlChartPoint
+
+	if err := htmlReportTemplate.ExecuteTemplate(w, "dataset_start", section); err != nil {
+		return 0, false, err
+	}
+
+	cells := make([]htmlCell, 0, len(columns))
+	for {
+		row, err := dataset.Rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return section.Rows, false, err
+		}
+
+		cells = cells[:0]
+		for _, value := range row {
+			cells = append(cells, htmlCell{Text: formatHTMLValue(value), Numeric: isNumeric(value)})
+		}
+		if err := htmlReportTemplate.ExecuteTemplate(w, "row", cells); err != nil {
+			return section.Rows, false, err
+		}
+		section.Rows++
+
+		if drawChart && len(points) < htmlChartMaxPoints && labelIndex < len(row) && valueIndex < len(row) {
+			if value, ok := toFloat(row[valueIndex]); ok {
+				points = append(points, htmlChartPoint{Label: formatHTMLValue(row[labelIndex]), Value: value})
+			}
+		}
+
+		// Периодически отдаем накопленное и проверяем отмену
+		if section.Rows%htmlFlushInterval == 0 {
+			if err := w.Flush(); err != nil {
+				return section.Rows, false, err
+			}
+			if err := ctx.Err(); err != nil {
+				return section.Rows, false, err
+			}
+		}
+	}
+
+	if drawChart && len(points) > 0 {
+		section.Chart = newHTMLChartView(chart, points, section.Rows > htmlChartMaxPoints)
+	}
+	if err := htmlReportTemplate.ExecuteTemplate(w, "dataset_end", section); err != nil {
+		return section.Rows, false, err
+	}
+	return section.Rows, drawChart, nil
+}
+
+// htmlChartPoint значение диаграммы
+type htmlChartPoint struct {
+	Label string
+	Value float64
+}
+
+// htmlChartBar значение диаграммы в координатах SVG
+type htmlChartBar struct {
+	Label      string
+	ShortLabel string
+	Value      string
+	X, Y       string
+	Width      string
+	Height     string
+	CenterX    string
+}
+
+// htmlChartView диаграмма, подготовленная для вывода в шаблон
+type htmlChartView struct {
+	Caption  string
+	Width    int
+	Height   int
+	Left     int
+	Right    int
+	Top      int
+	Bottom   int
+	Zero     string
+	MinLabel string
+	MaxLabel string
+	Points   []htmlChartBar
+	// Line точки ломаной для линейной диаграммы, пусто для столбчатой
+	Line string
+}
+
+// newHTMLChartView рассчитывает координаты диаграммы. Шкала всегда включает ноль.
+func newHTMLChartView(chart *HTMLChart, points []htmlChartPoint, truncated bool) *htmlChartView {
+	low, high := 0.0, 0.0
+	for _, point := range points {
+		low = math.Min(low, point.Value)
+		high = math.Max(high, point.Value)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	scaleY := func(value float64) float64 {
+		return htmlChartBottom - (value-low)/(high-low)*(htmlChartBottom-htmlChartTop)
+	}
+	zero := scaleY(0)
+	step := float64(htmlChartRight-htmlChartLeft) / float64(len(points))
+
+	caption := chart.Title
+	if caption == "" {
+		caption = chart.Value + " по " + chart.Label
+	}
+	if truncated {
+		caption += fmt.Sprintf(" (первые %d строк)", len(points))
+	}
+
+	view := &htmlChartView{
+		Caption:  caption,
+		Width:    htmlChartWidth,
+		Height:   htmlChartHeight,
+		Left:     htmlChartLeft,
+		Right:    htmlChartRight,
+		Top:      htmlChartTop,
+		Bottom:   htmlChartBottom,
+		Zero:     formatCoordinate(zero),
+		MinLabel: formatChartValue(low),
+		MaxLabel: formatChartValue(high),
+	}
+
+	line := make([]string, 0, len(points))
+	for i, point := range points {
+		x := htmlChartLeft + float64(i)*step
+		y := scaleY(point.Value)
+		centerX := x + step/2
+
+		view.Points = append(view.Points, htmlChartBar{
+			Label:      point.Label,
+			ShortLabel: truncateLabel(point.Label, htmlChartLabelLength),
+			Value:      formatChartValue(point.Value),
+			X:          formatCoordinate(x + step*0.15),
+			Y:          formatCoordinate(math.Min(y, zero)),
+			Width:      formatCoordinate(step * 0.7),
+			Height:     formatCoordinate(math.Abs(zero - y)),
+			CenterX:    formatCoordinate(centerX),
+		})
+		if chart.Type == HTMLChartLine {
+			view.Points[i].Y = formatCoordinate(y)
+			line = append(line, formatCoordinate(centerX)+","+formatCoordinate(y))
+		}
+	}
+	view.Line = strings.Join(line, " ")
+	return view
+}
+
+// formatHTMLValue преобразует значение ячейки в текст
+func formatHTMLValue(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return formatCSVValue(value)
+}
+
+// isNumeric проверяет, является ли значение ячейки числом
+func isNumeric(value interface{}) bool {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// toFloat приводит значение ячейки к числу для диаграммы, строки разбираются как числа
+func toFloat(value interface{}) (float64, bool) {
+	var result float64
+	switch v := value.(type) {
+	case int:
+		result = float64(v)
+	case int8:
+		result = float64(v)
+	case int16:
+		result = float64(v)
+	case int32:
+		result = float64(v)
+	case int64:
+		result = float64(v)
+	case uint:
+		result = float64(v)
+	case uint8:
+		result = float64(v)
+	case uint16:
+		result = float64(v)
+	case uint32:
+		result = float64(v)
+	case uint64:
+		result = float64(v)
+	case float32:
+		result = float64(v)
+	case float64:
+		result = v
+	case string, []byte:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(formatCSVValue(v)), 64)
+		if err != nil {
+			return 0, false
+		}
+		result = parsed
+	default:
+		return 0, false
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, false
+	}
+	return result, true
+}
+
+func indexOf(columns []string, name string) int {
+	for i, column := range columns {
+		if column == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func truncateLabel(label string, length int) string {
+	runes := []rune(label)
+	if len(runes) <= length {
+		return label
+	}
+	return string(runes[:length-1]) + "…"
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
+
+func formatChartValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// GetMimeType возвращает MIME тип для HTML файлов
+func (g *HTMLReportGenerator) GetMimeType() string {
+	return "text/html; charset=utf-8"
+}
+
+// GetFileExtension возвращает расширение файла для HTML
+func (g *HTMLReportGenerator) GetFileExtension() string {
+	return "html"
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceRows итератор по строкам в памяти
+type sliceRows struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func (r *sliceRows) Columns() []string {
+	return r.columns
+}
+
+func (r *sliceRows) Next() ([]interface{}, error) {
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
+
+func TestHTMLReportGenerator(t *testing.T) {
+	generator := NewHTMLReportGenerator(setupTestLogger())
+
+	report := &models.Report{
+		ID:     7,
+		Title:  "Продажи <Q1>",
+		Format: models.FormatHTML,
+		Parameters: models.JSON{
+			models.ParamHTMLChart: map[string]interface{}{"dataset": "sales", "label": "region", "value": "amount"},
+		},
+	}
+	data := &ReportData{Datasets: []Dataset{
+		{Name: "summary", Rows: &sliceRows{columns: []string{"total"}, rows: [][]interface{}{{300}}}},
+		{Name: "sales", Rows: &sliceRows{
+			columns: []string{"region", "amount"},
+			rows: [][]interface{}{
+				{"north", 100},
+				{"<script>", "200.5"},
+			},
+		}},
+	}}
+
+	reader, filename, err := generator.Generate(context.Background(), report, data)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(filename, ".html"))
+
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	html := string(content)
+
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>"))
+	assert.Contains(t, html, "<title>Продажи &lt;Q1&gt;</title>")
+	assert.Contains(t, html, "<h2>summary</h2>")
+	assert.Contains(t, html, "<h2>sales</h2>")
+	assert.Contains(t, html, `<td class="num">100</td>`)
+	assert.NotContains(t, html, "<script>")
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(html), "</html>"))
+
+	// Диаграмма строится только по указанному набору
+	assert.Equal(t, 1, strings.Count(html, "<svg"))
+	assert.Equal(t, 2, strings.Count(html, `class="bar"`))
+	assert.Greater(t, strings.Index(html, "<svg"), strings.Index(html, "<h2>sales</h2>"))
+}
+
+func TestParseHTMLChart(t *testing.T) {
+	chart, err := ParseHTMLChart(models.JSON{})
+	require.NoError(t, err)
+	assert.Nil(t, chart)
+
+	chart, err = ParseHTMLChart(models.JSON{models.ParamHTMLChart: map[string]interface{}{"label": "a", "value": "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, HTMLChartBar, chart.Type)
+
+	_, err = ParseHTMLChart(models.JSON{models.ParamHTMLChart: map[string]interface{}{"type": "pie", "label": "a", "value": "b"}})
+	assert.Error(t, err)
+
+	_, err = ParseHTMLChart(models.JSON{models.ParamHTMLChart: map[string]interface{}{"label": "a"}})
+	assert.Error(t, err)
+
+	_, err = ParseHTMLChart(models.JSON{models.ParamHTMLChart: "bar"})
+	assert.Error(t, err)
+}
+
+func TestHTMLChartViewScale(t *testing.T) {
+	view := newHTMLChartView(&HTMLChart{Type: HTMLChartLine, Label: "day", Value: "delta"}, []htmlChartPoint{
+		{Label: "mon", Value: -10},
+		{Label: "tue", Value: 30},
+	}, false)
+
+	assert.Equal(t, "-10", view.MinLabel)
+	assert.Equal(t, "30", view.MaxLabel)
+	assert.Equal(t, "delta по day", view.Caption)
+	assert.Len(t, strings.Fields(view.Line), 2)
+
+	// Ноль находится на четверти высоты от нижней границы
+	assert.Equal(t, formatCoordinate(htmlChartBottom-float64(htmlChartBottom-htmlChartTop)/4), view.Zero)
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"report_srv/internal/models"
+)
+
+// pathParameterPattern плейсхолдер параметра отчета в пути запроса к API: {region}
+var pathParameterPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// pathParameters возвращает имена параметров отчета, используемых в пути запроса к API
+func pathParameters(path string) []string {
+	var names []string
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(path, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// expandPath подставляет параметры отчета в путь запроса к API. Значения экранируются,
+// поэтому параметр не может изменить путь или добавить аргументы запроса.
+func expandPath(path string, params map[string]interface{}) (string, error) {
+	var missing []string
+	expanded := pathParameterPattern.ReplaceAllStringFunc(path, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		value, exists := params[name]
+		if !exists || value == nil {
+			missing = append(missing, name)
+			return placeholder
+		}
+		return strings.ReplaceAll(url.QueryEscape(formatCSVValue(value)), "+", "%20")
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("не заданы параметры пути запроса: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// rowsPathStep шаг пути к строкам в ответе API: поле объекта или элемент массива
+type rowsPathStep struct {
+	key   string
+	index int
+}
+
+// parseRowsPath разбирает путь JSONPath к массиву строк. Поддерживаются поля через точку
+// и индексы массивов: $.data.items, $.results[0].rows. Пустой путь и $ - весь ответ.
+func parseRowsPath(path string) ([]rowsPathStep, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(path), "$"), ".")
+	var steps []rowsPathStep
+	for rest != "" {
+		var part string
+		if cut := strings.IndexAny(rest[1:], ".["); cut >= 0 {
+			part, rest = rest[:cut+1], strings.TrimPrefix(rest[cut+1:], ".")
+		} else {
+			part, rest = rest, ""
+		}
+
+		if strings.HasPrefix(part, "[") {
+			index, err := strconv.Atoi(strings.TrimSuffix(part[1:], "]"))
+			if err != nil || !strings.HasSuffix(part, "]") || index < 0 {
+				return nil, fmt.Errorf("неверный путь к строкам %s: индекс %s", path, part)
+			}
+			steps = append(steps, rowsPathStep{index: index})
+			continue
+		}
+		if strings.ContainsAny(part, "[]*'\" ") {
+			return nil, fmt.Errorf("неверный путь к строкам %s: поле %s", path, part)
+		}
+		steps = append(steps, rowsPathStep{key: part})
+	}
+	return steps, nil
+}
+
+// httpRows итератор по строкам ответа JSON API. Запрос выполняется при первом обращении,
+// ответ читается целиком (не больше max_response_size источника). Строки - объекты массива
+// по пути rows, колонки - их поля в порядке первого появления. Вложенные объекты и
+// массивы выводятся строкой JSON.
+type httpRows struct {
+	ctx      context.Context
+	sources  DataSources
+	name     string
+	source   string
+	path     string
+	rowsPath []rowsPathStep
+	params   map[string]interface{}
+
+	started bool
+	columns []string
+	rows    [][]interface{}
+	err     error
+}
+
+// start выполняет запрос и разбирает строки ответа
+func (r *httpRows) start() {
+	if r.started {
+		return
+	}
+	r.started = true
+
+	if err := r.load(); err != nil {
+		r.err = withErrorCode(models.ErrorCodeQuery, fmt.Errorf("запрос %s: %w", r.name, err))
+	}
+}
+
+// load получает ответ API и заполняет колонки и строки
+func (r *httpRows) load() error {
+	path, err := expandPath(r.path, r.params)
+	if err != nil {
+		return err
+	}
+	body, err := r.sources.Request(r.ctx, r.source, path)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	document, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения ответа API: %w", err)
+	}
+
+	raw := json.RawMessage(document)
+	for _, step := range r.rowsPath {
+		if raw, err = jsonStep(raw, step); err != nil {
+			return err
+		}
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return errors.New("строки ответа API должны быть массивом объектов")
+	}
+
+	positions := make(map[string]int)
+	objects := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		keys, values, err := jsonObject(item)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, exists := positions[key]; !exists {
+				positions[key] = len(r.columns)
+				r.columns = append(r.columns, key)
+			}
+		}
+		objects = append(objects, values)
+	}
+
+	r.rows = make([][]interface{}, len(objects))
+	for i, object := range objects {
+		row := make([]interface{}, len(r.columns))
+		for key, value := range object {
+			row[positions[key]] = value
+		}
+		r.rows[i] = row
+	}
+	return nil
+}
+
+// jsonStep возвращает поле объекта или элемент массива документа JSON
+func jsonStep(raw json.RawMessage, step rowsPathStep) (json.RawMessage, error) {
+	if step.key != "" {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, fmt.Errorf("в ответе API нет объекта с полем %s", step.key)
+		}
+		value, exists := object[step.key]
+		if !exists {
+			return nil, fmt.Errorf("в ответе API нет поля %s", step.key)
+		}
+		return value, nil
+	}
+
+	var array []json.RawMessage
+	if err := json.Unmarshal(raw, &array); err != nil || step.index >= len(array) {
+		return nil, fmt.Errorf("в ответе API нет элемента массива [%d]", step.index)
+	}
+	return array[step.index], nil
+}
+
+// jsonObject разбирает объект строки ответа API с сохранением порядка полей
+func jsonObject(raw json.RawMessage) ([]string, map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, nil, errors.New("строки ответа API должны быть массивом объектов")
+	}
+
+	var keys []string
+	values := make(map[string]interface{})
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, fmt.Errorf("ошибка разбора ответа API: %w", err)
+		}
+		key := token.(string)
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, fmt.Errorf("ошибка разбора ответа API: %w", err)
+		}
+		if _, exists := values[key]; !exists {
+			keys = append(keys, key)
+		}
+		values[key] = apiValue(value)
+	}
+	return keys, values, nil
+}
+
+// apiValue приводит значение JSON к значению строки отчета: числа к int64 или float64,
+// вложенные объекты и массивы к строке JSON
+func apiValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if integer, err := v.Int64(); err == nil {
+			return integer
+		}
+		float, _ := v.Float64()
+		return float
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return v
+	}
+}
+
+// Columns возвращает колонки строк ответа API
+func (r *httpRows) Columns() []string {
+	r.start()
+	return r.columns
+}
+
+// Next возвращает следующую строку ответа API
+func (r *httpRows) Next() ([]interface{}, error) {
+	r.start()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row, nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRowsPath(t *testing.T) {
+	for path, expected := range map[string][]rowsPathStep{
+		"":                   nil,
+		"$":                  nil,
+		"$.data.items":       {{key: "data"}, {key: "items"}},
+		"results[1].rows":    {{key: "results"}, {index: 1}, {key: "rows"}},
+		"$[0]":               {{index: 0}},
+		"$.data[0][2].items": {{key: "data"}, {index: 0}, {index: 2}, {key: "items"}},
+	} {
+		steps, err := parseRowsPath(path)
+		require.NoError(t, err, path)
+		assert.Equal(t, expected, steps, path)
+	}
+	for _, path := range []string{"$.data[x]", "$.data[-1]", "$.data[0", "$..*", "$['data']"} {
+		_, err := parseRowsPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	path, err := expandPath("/orders/{region}?from={from}&limit=10", map[string]interface{}{"region": "north/east", "from": "a b&c"})
+	require.NoError(t, err)
+	assert.Equal(t, "/orders/north%2Feast?from=a%20b%26c&limit=10", path)
+
+	_, err = expandPath("/orders/{region}", map[string]interface{}{})
+	assert.ErrorContains(t, err, "region")
+}
+
+func TestDefinitionDataLoaderHTTPQueries(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("CREATE TABLE sales (region TEXT, amount INTEGER)").Error)
+	require.NoError(t, db.Exec("INSERT INTO sales VALUES ('north', 20), ('north', 10)").Error)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/managers/north", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"data": {"items": [
+			{"name": "Иванов", "plan": 100, "tags": ["a"]},
+			{"name": "Петров", "rate": 1.5}
+		]}}`))
+	}))
+	defer api.Close()
+	sources := newTestDataSources(t, db, map[string]config.DataSource{
+		"crm": {Driver: config.DataSourceDriverHTTP, URL: api.URL + "/v1", AuthValue: "Bearer token"},
+	})
+
+	definition := newTestDefinition()
+	definition.Queries = append(definition.Queries, models.Query{Name: "managers", Source: "crm", Path: "/managers/{region}", Rows: "$.data.items"})
+	require.NoError(t, checkDefinition(definition, newTestQueryValidator(t), sources))
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t), sources, NewReportFileStorage(new(MockStorage), logger), logger)
+	data, err := loader.Load(ctx, &models.Report{DefinitionID: &definition.ID, Parameters: models.JSON{"region": "north"}})
+	require.NoError(t, err)
+	defer data.Close()
+
+	require.Len(t, data.Datasets, 2)
+	managers := data.Datasets[1].Rows
+	assert.Equal(t, []string{"name", "plan", "tags", "rate"}, managers.Columns())
+	var result [][]interface{}
+	for {
+		row, err := managers.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		result = append(result, row)
+	}
+	assert.Equal(t, [][]interface{}{
+		{"Иванов", int64(100), `["a"]`, nil},
+		{"Петров", nil, nil, 1.5},
+	}, result)
+
+	// Путь к строкам должен вести к массиву объектов
+	definition.Queries[1].Rows = "$.data"
+	data, err = loader.LoadDefinition(ctx, definition, models.JSON{"region": "north"})
+	require.NoError(t, err)
+	_, err = data.Datasets[1].Rows.Next()
+	assert.ErrorContains(t, err, "массивом объектов")
+	code, _ := classifyError(err)
+	assert.Equal(t, models.ErrorCodeQuery, code)
+
+	// SQL запрос к источнику http не выполняется
+	definition.Queries[1] = models.Query{Name: "managers", SQL: "SELECT 1", Source: "crm"}
+	_, err = loader.LoadDefinition(ctx, definition, models.JSON{"region": "north"})
+	assert.Error(t, err)
+}
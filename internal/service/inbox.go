@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotificationNotFound уведомление не найдено или адресовано другому пользователю
+	ErrNotificationNotFound = newCategoryError(ErrNotFound, "уведомление не найдено")
+	// ErrNotificationRecipient не указан пользователь, чьи уведомления запрашиваются
+	ErrNotificationRecipient = newCategoryError(ErrValidation, "не указан пользователь")
+)
+
+// NotificationListParams параметры списка уведомлений пользователя
+type NotificationListParams struct {
+	Recipient  string
+	UnreadOnly bool
+	Page       int
+	PageSize   int
+}
+
+// NotificationList страница уведомлений пользователя
+type NotificationList struct {
+	Notifications []models.Notification `json:"notifications"`
+	// Unread число непрочитанных уведомлений пользователя для значка в интерфейсе
+	Unread     int64 `json:"unread"`
+	Total      int64 `json:"total"`
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// NotificationService лента уведомлений пользователя о его отчетах
+type NotificationService interface {
+	ListNotifications(ctx context.Context, params NotificationListParams) (*NotificationList, error)
+	MarkRead(ctx context.Context, recipient string, id uint) (*models.Notification, error)
+	MarkAllRead(ctx context.Context, recipient string) (int64, error)
+}
+
+// NotificationRepository хранилище уведомлений
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *models.Notification) error
+	List(ctx context.Context, params NotificationListParams) ([]models.Notification, int64, error)
+	CountUnread(ctx context.Context, recipient string) (int64, error)
+	// MarkRead отмечает уведомление прочитанным и возвращает его. Уже прочитанное не меняется
+	MarkRead(ctx context.Context, recipient string, id uint, at time.Time) (*models.Notification, error)
+	MarkAllRead(ctx context.Context, recipient string, at time.Time) (int64, error)
+	DeleteBefore(ctx context.Context, recipient string, before time.Time) (int64, error)
+}
+
+// GormNotificationRepository реализация NotificationRepository с использованием GORM
+type GormNotificationRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormNotificationRepository создает новый GORM репозиторий уведомлений
+func NewGormNotificationRepository(db *gorm.DB, logger logging.Logger) NotificationRepository {
+	return &GormNotificationRepository{db: db, logger: logger}
+}
+
+// Create сохраняет уведомление
+func (r *GormNotificationRepository) Create(ctx context.Context, notification *models.Notification) error {
+	return r.db.WithContext(ctx).Create(notification).Error
+}
+
+// List возвращает страницу уведомлений пользователя, новые первыми, и их общее число
+func (r *GormNotificationRepository) List(ctx context.Context, params NotificationListParams) ([]models.Notification, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Notification{}).Where("recipient = ?", params.Recipient)
+	if params.UnreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (params.Page - 1) * params.PageSize
+	var notifications []models.Notification
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(params.PageSize).Find(&notifications).Error
+
+	return notifications, total, err
+}
+
+// CountUnread возвращает число непрочитанных уведомлений пользователя
+func (r *GormNotificationRepository) CountUnread(ctx context.Context, recipient string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("recipient = ? AND read_at IS NULL", recipient).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkRead отмечает уведомление пользователя прочитанным
+func (r *GormNotificationRepository) MarkRead(ctx context.Context, recipient string, id uint, at time.Time) (*models.Notification, error) {
+	err := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("id = ? AND recipient = ? AND read_at IS NULL", id, recipient).
+		Update("read_at", at).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var notification models.Notification
+	err = r.db.WithContext(ctx).Where("id = ? AND recipient = ?", id, recipient).First(&notification).Error
+	if err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// MarkAllRead отмечает прочитанными все уведомления пользователя
+func (r *GormNotificationRepository) MarkAllRead(ctx context.Context, recipient string, at time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("recipient = ? AND read_at IS NULL", recipient).
+		Update("read_at", at)
+	return result.RowsAffected, result.Error
+}
+
+// DeleteBefore удаляет уведомления пользователя, созданные раньше before
+func (r *GormNotificationRepository) DeleteBefore(ctx context.Context, recipient string, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("recipient = ? AND created_at < ?", recipient, before).
+		Delete(&models.Notification{})
+	return result.RowsAffected, result.Error
+}
+
+// NotificationServiceImpl реализация сервиса ленты уведомлений
+type NotificationServiceImpl struct {
+	repository NotificationRepository
+	settings   UserSettingsRepository
+	logger     logging.Logger
+	now        func() time.Time
+}
+
+// NewNotificationService создает сервис ленты уведомлений
+func NewNotificationService(repository NotificationRepository, logger logging.Logger) *NotificationServiceImpl {
+	return &NotificationServiceImpl{repository: repository, logger: logger, now: time.Now}
+}
+
+// NewNotificationServiceFromDB создает сервис ленты уведомлений с хранилищем в базе данных
+func NewNotificationServiceFromDB(db *gorm.DB, logger logging.Logger) NotificationService {
+	return NewNotificationService(NewGormNotificationRepository(db, logger), logger).
+		WithUserSettings(NewGormUserSettingsRepository(db, logger))
+}
+
+// WithUserSettings подключает размер страницы по умолчанию из настроек пользователя
+func (s *NotificationServiceImpl) WithUserSettings(settings UserSettingsRepository) *NotificationServiceImpl {
+	s.settings = settings
+	return s
+}
+
+// ListNotifications возвращает страницу уведомлений пользователя и число непрочитанных
+func (s *NotificationServiceImpl) ListNotifications(ctx context.Context, params NotificationListParams) (*NotificationList, error) {
+	if params.Recipient == "" {
+		return nil, ErrNotificationRecipient
+	}
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = loadUserSettings(ctx, s.settings, params.Recipient, s.logger).PageSize
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 20
+	}
+	if params.PageSize > 100 {
+		params.PageSize = 100
+	}
+
+	notifications, total, err := s.repository.List(ctx, params)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).Error("Ошибка получения уведомлений")
+		return nil, fmt.Errorf("ошибка получения уведомлений: %w", err)
+	}
+
+	unread := total
+	if !params.UnreadOnly {
+		if unread, err = s.repository.CountUnread(ctx, params.Recipient); err != nil {
+			return nil, fmt.Errorf("ошибка подсчета непрочитанных уведомлений: %w", err)
+		}
+	}
+
+	return &NotificationList{
+		Notifications: notifications,
+		Unread:        unread,
+		Total:         total,
+		Page:          params.Page,
+		PageSize:      params.PageSize,
+		TotalPages:    int((total + int64(params.PageSize) - 1) / int64(params.PageSize)),
+	}, nil
+}
+
+// MarkRead отмечает уведомление пользователя прочитанным. Повторная отметка не меняет время прочтения
+func (s *NotificationServiceImpl) MarkRead(ctx context.Context, recipient string, id uint) (*models.Notification, error) {
+	if recipient == "" {
+		return nil, ErrNotificationRecipient
+	}
+
+	notification, err := s.repository.MarkRead(ctx, recipient, id, s.now().UTC())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotificationNotFound
+		}
+		return nil, fmt.Errorf("ошибка отметки уведомления: %w", err)
+	}
+	return notification, nil
+}
+
+// MarkAllRead отмечает прочитанными все уведомления пользователя и возвращает их число
+func (s *NotificationServiceImpl) MarkAllRead(ctx context.Context, recipient string) (int64, error) {
+	if recipient == "" {
+		return 0, ErrNotificationRecipient
+	}
+
+	updated, err := s.repository.MarkAllRead(ctx, recipient, s.now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отметки уведомлений: %w", err)
+	}
+	return updated, nil
+}
+
+// InboxNotifier записывает в ленту автора отчета уведомления о готовом и упавшем отчете.
+// Уведомления старше inbox.ttl удаляются при записи новых
+type InboxNotifier struct {
+	repository NotificationRepository
+	settings   UserSettingsRepository
+	ttl        time.Duration
+	logger     logging.Logger
+}
+
+// NewInboxNotifier создает запись уведомлений в ленту пользователей. Пользователь может
+// отключить уведомления о готовых или упавших отчетах в своих настройках
+func NewInboxNotifier(cfg config.Inbox, repository NotificationRepository, settings UserSettingsRepository, logger logging.Logger) *InboxNotifier {
+	return &InboxNotifier{repository: repository, settings: settings, ttl: cfg.TTL, logger: logger}
+}
+
+// Notify записывает уведомление о готовом или упавшем отчете. Отчеты в других статусах,
+// отчеты без автора и события, отключенные автором, пропускаются
+func (n *InboxNotifier) Notify(ctx context.Context, report *models.Report) error {
+	if report.CreatedBy == "" {
+		return nil
+	}
+	settings := loadUserSettings(ctx, n.settings, report.CreatedBy, n.logger)
+	if report.Status == models.StatusCompleted && !settings.NotifyCompleted ||
+		report.Status == models.StatusFailed && !settings.NotifyFailed {
+		return nil
+	}
+
+	notification := &models.Notification{
+		Recipient: report.CreatedBy,
+		ReportID:  report.ID,
+	}
+	switch report.Status {
+	case models.StatusCompleted:
+		notification.Type = string(events.ReportCompleted)
+		notification.Title = fmt.Sprintf("Отчет «%s» готов", report.Title)
+		notification.Message = fmt.Sprintf("Отчет #%d сгенерирован в формате %s", report.ID, report.Format)
+	case models.StatusFailed:
+		notification.Type = string(events.ReportFailed)
+		notification.Title = fmt.Sprintf("Ошибка генерации отчета «%s»", report.Title)
+		if report.ScheduleID != nil {
+			notification.Title = fmt.Sprintf("Ошибка генерации отчета по расписанию «%s»", report.Title)
+		}
+		reason := report.ErrorMessage
+		if reason == "" {
+			reason = string(report.ErrorCode)
+		}
+		notification.Message = truncateMessage(fmt.Sprintf("Генерация отчета #%d завершилась ошибкой: %s", report.ID, reason), 1000)
+	default:
+		return nil
+	}
+	notification.Title = truncateMessage(notification.Title, 255)
+
+	if err := n.repository.Create(ctx, notification); err != nil {
+		return fmt.Errorf("ошибка записи уведомления: %w", err)
+	}
+
+	if n.ttl > 0 {
+		if _, err := n.repository.DeleteBefore(ctx, notification.Recipient, time.Now().UTC().Add(-n.ttl)); err != nil {
+			logging.FromContext(ctx, n.logger).WithError(err).Warn("Ошибка удаления устаревших уведомлений")
+		}
+	}
+	return nil
+}
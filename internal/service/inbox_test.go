@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInboxNotifierRecordsReportEvents(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Notification{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	repository := NewGormNotificationRepository(db, logger)
+	notifier := NewInboxNotifier(config.Inbox{TTL: 24 * time.Hour}, repository, nil, logger)
+
+	stale := &models.Notification{Recipient: "alice", Type: string(events.ReportCompleted), ReportID: 1, Title: "old"}
+	require.NoError(t, repository.Create(ctx, stale))
+	require.NoError(t, db.Model(stale).UpdateColumn("created_at", time.Now().UTC().Add(-48*time.Hour)).Error)
+
+	scheduleID := uint(3)
+	require.NoError(t, notifier.Notify(ctx, &models.Report{ID: 7, Title: "Sales", Status: models.StatusCompleted, Format: models.FormatXLSX, CreatedBy: "alice"}))
+	require.NoError(t, notifier.Notify(ctx, &models.Report{ID: 8, Title: "Stock", Status: models.StatusFailed, ScheduleID: &scheduleID, ErrorMessage: "timeout", CreatedBy: "alice"}))
+	require.NoError(t, notifier.Notify(ctx, &models.Report{ID: 9, Title: "Other", Status: models.StatusCompleted, CreatedBy: "bob"}))
+	// Отчеты в других статусах и без автора пропускаются
+	require.NoError(t, notifier.Notify(ctx, &models.Report{ID: 10, Status: models.StatusProcessing, CreatedBy: "alice"}))
+	require.NoError(t, notifier.Notify(ctx, &models.Report{ID: 11, Status: models.StatusCompleted}))
+
+	service := NewNotificationService(repository, logger)
+	list, err := service.ListNotifications(ctx, NotificationListParams{Recipient: "alice"})
+	require.NoError(t, err)
+	require.Len(t, list.Notifications, 2)
+	assert.EqualValues(t, 2, list.Unread)
+	assert.Equal(t, uint(8), list.Notifications[0].ReportID)
+	assert.Equal(t, string(events.ReportFailed), list.Notifications[0].Type)
+	assert.Equal(t, "Ошибка генерации отчета по расписанию «Stock»", list.Notifications[0].Title)
+	assert.Contains(t, list.Notifications[0].Message, "timeout")
+	assert.Equal(t, "Отчет «Sales» готов", list.Notifications[1].Title)
+}
+
+func TestNotificationServiceMarkRead(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Notification{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	repository := NewGormNotificationRepository(db, logger)
+	for i, recipient := range []string{"alice", "alice", "alice", "bob"} {
+		require.NoError(t, repository.Create(ctx, &models.Notification{
+			Recipient: recipient,
+			Type:      string(events.ReportCompleted),
+			ReportID:  uint(i + 1),
+			Title:     "ready",
+		}))
+	}
+
+	service := NewNotificationService(repository, logger)
+	readAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	service.now = func() time.Time { return readAt }
+
+	notification, err := service.MarkRead(ctx, "alice", 1)
+	require.NoError(t, err)
+	require.True(t, notification.IsRead())
+	assert.True(t, notification.ReadAt.Equal(readAt))
+
+	// Чужое и несуществующее уведомление не найдено
+	_, err = service.MarkRead(ctx, "alice", 4)
+	assert.ErrorIs(t, err, ErrNotificationNotFound)
+	_, err = service.MarkRead(ctx, "alice", 99)
+	assert.ErrorIs(t, err, ErrNotificationNotFound)
+	_, err = service.MarkRead(ctx, "", 1)
+	assert.ErrorIs(t, err, ErrValidation)
+
+	list, err := service.ListNotifications(ctx, NotificationListParams{Recipient: "alice", UnreadOnly: true, PageSize: 1})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, list.Total)
+	assert.EqualValues(t, 2, list.Unread)
+	assert.Equal(t, 2, list.TotalPages)
+	require.Len(t, list.Notifications, 1)
+	assert.Equal(t, uint(3), list.Notifications[0].ReportID)
+
+	updated, err := service.MarkAllRead(ctx, "alice")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, updated)
+
+	list, err = service.ListNotifications(ctx, NotificationListParams{Recipient: "alice"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, list.Total)
+	assert.Zero(t, list.Unread)
+
+	list, err = service.ListNotifications(ctx, NotificationListParams{Recipient: "bob"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, list.Unread)
+}
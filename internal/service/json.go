@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+const (
+	// jsonFlushInterval количество строк между сбросами буфера и проверками отмены
+	jsonFlushInterval = 1000
+
+	// jsonDatasetKey поле строки с именем набора, если в отчете несколько наборов
+	jsonDatasetKey = "_dataset"
+)
+
+// JSONReportGenerator потоковый генератор JSON отчетов для программных клиентов.
+// Строки всех наборов выводятся объектами с полями по именам колонок в порядке колонок:
+// массивом (json) или по объекту в строке (ndjson). Числа и логические значения
+// сохраняют свой тип, даты выводятся в RFC 3339, NULL - как null.
+type JSONReportGenerator struct {
+	logger logging.Logger
+	// lines ndjson: по объекту в строке вместо массива
+	lines bool
+}
+
+// NewJSONReportGenerator создает генератор JSON отчетов
+func NewJSONReportGenerator(logger logging.Logger) ReportGenerator {
+	return &JSONReportGenerator{logger: logger}
+}
+
+// NewNDJSONReportGenerator создает генератор отчетов в формате NDJSON
+func NewNDJSONReportGenerator(logger logging.Logger) ReportGenerator {
+	return &JSONReportGenerator{logger: logger, lines: true}
+}
+
+func init() {
+	RegisterGenerator(models.FormatJSON, func(_ config.Config, logger logging.Logger) ReportGenerator {
+		return NewJSONReportGenerator(logger)
+	})
+	RegisterGenerator(models.FormatNDJSON, func(_ config.Config, logger logging.Logger) ReportGenerator {
+		return NewNDJSONReportGenerator(logger)
+	})
+}
+
+// Generate запускает потоковую генерацию JSON отчета.
+// Закрытие возвращенного reader прерывает генерацию.
+func (g *JSONReportGenerator) Generate(ctx context.Context, report *models.Report, data *ReportData) (io.Reader, string, error) {
+	logger := logging.FromContext(ctx, g.logger).WithFields(logging.Fields{
+		"report_id": report.ID,
+		"title":     report.Title,
+		"format":    g.GetFileExtension(),
+	})
+
+	logger.Info("Генерация JSON отчета")
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		count, err := g.writeDatasets(ctx, pw, data.Datasets)
+		if err != nil {
+			logger.WithError(err).Error("Ошибка записи JSON файла")
+			pw.CloseWithError(fmt.Errorf("ошибка генерации JSON файла: %w", err))
+			return
+		}
+		logger.WithField("rows", count).Info("JSON отчет сгенерирован успешно")
+		pw.Close()
+	}()
+
+	filename := fmt.Sprintf("report_%d_%s.%s", report.ID, report.LocalTime(time.Now()).Format("20060102_150405"), g.GetFileExtension())
+	return pr, filename, nil
+}
+
+// writeDatasets записывает строки всех наборов и возвращает их число. Если наборов
+// несколько, в каждую строку добавляется поле _dataset с именем набора.
+func (g *JSONReportGenerator) writeDatasets(ctx context.Context, w io.Writer, datasets []Dataset) (int, error) {
+	buffered := bufio.NewWriter(w)
+	if !g.lines {
+		if err := buffered.WriteByte('['); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for _, dataset := range datasets {
+		keys, err := jsonKeys(dataset.Rows.Columns())
+		if err != nil {
+			return count, err
+		}
+		var name []byte
+		if len(datasets) > 1 {
+			if name, err = json.Marshal(dataset.Name); err != nil {
+				return count, err
+			}
+		}
+
+		for {
+			row, err := dataset.Rows.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return count, err
+			}
+
+			if !g.lines && count > 0 {
+				if err := buffered.WriteByte(','); err != nil {
+					return count, err
+				}
+			}
+			if err := writeJSONObject(buffered, keys, row, name); err != nil {
+				return count, err
+			}
+			if g.lines {
+				if err := buffered.WriteByte('\n'); err != nil {
+					return count, err
+				}
+			}
+			count++
+
+			// Периодически отдаем накопленное и проверяем отмену
+			if count%jsonFlushInterval == 0 {
+				if err := buffered.Flush(); err != nil {
+					return count, err
+				}
+				if err := ctx.Err(); err != nil {
+					return count, err
+				}
+			}
+		}
+	}
+
+	if !g.lines {
+		if _, err := buffered.WriteString("]\n"); err != nil {
+			return count, err
+		}
+	}
+	return count, buffered.Flush()
+}
+
+// jsonKeys кодирует имена колонок набора для полей объектов строк
+func jsonKeys(columns []string) ([][]byte, error) {
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// writeJSONObject записывает строку объектом с полями в порядке колонок
+func writeJSONObject(w *bufio.Writer, keys [][]byte, row []interface{}, dataset []byte) error {
+	w.WriteByte('{')
+	written := 0
+	if dataset != nil {
+		w.WriteString(`"` + jsonDatasetKey + `":`)
+		w.Write(dataset)
+		written++
+	}
+	for i, key := range keys {
+		var value interface{}
+		if i < len(row) {
+			value = row[i]
+		}
+		encoded, err := json.Marshal(jsonValue(value))
+		if err != nil {
+			return fmt.Errorf("ошибка кодирования колонки %s: %w", key, err)
+		}
+
+		if written > 0 {
+			w.WriteByte(',')
+		}
+		w.Write(key)
+		w.WriteByte(':')
+		w.Write(encoded)
+		written++
+	}
+	// Ошибки записи буфера сохраняются и возвращаются при следующей записи или Flush
+	_, err := w.WriteString("}")
+	return err
+}
+
+// jsonValue приводит значение ячейки к виду JSON: байты - строкой, время - в RFC 3339,
+// NaN и бесконечности, которых нет в JSON, - null
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil
+		}
+	}
+	return value
+}
+
+// GetMimeType возвращает MIME тип для JSON и NDJSON файлов
+func (g *JSONReportGenerator) GetMimeType() string {
+	if g.lines {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// GetFileExtension возвращает расширение файла для JSON или NDJSON
+func (g *JSONReportGenerator) GetFileExtension() string {
+	if g.lines {
+		return string(models.FormatNDJSON)
+	}
+	return string(models.FormatJSON)
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jsonTestData() *ReportData {
+	created := time.Date(2024, 12, 31, 10, 30, 0, 0, time.UTC)
+	return &ReportData{Datasets: []Dataset{{Name: "sales", Rows: &sliceRows{
+		columns: []string{"region", "amount", "share", "closed", "created_at", "note"},
+		rows: [][]interface{}{
+			{"north", int64(1200), 0.25, true, created, nil},
+			{[]byte("south"), int64(800), math.NaN(), false, created, "<b>"},
+		},
+	}}}}
+}
+
+func TestJSONReportGenerator(t *testing.T) {
+	generator := NewJSONReportGenerator(setupTestLogger())
+	assert.Equal(t, "application/json", generator.GetMimeType())
+
+	reader, filename, err := generator.Generate(context.Background(), &models.Report{ID: 4}, jsonTestData())
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(filename, ".json"))
+
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	// Поля выводятся в порядке колонок, числа и логические значения не превращаются в строки
+	assert.True(t, strings.HasPrefix(string(content),
+		`[{"region":"north","amount":1200,"share":0.25,"closed":true,"created_at":"2024-12-31T10:30:00Z","note":null},`))
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(content, &rows))
+	require.Len(t, rows, 2)
+	assert.Equal(t, "south", rows[1]["region"])
+	assert.Nil(t, rows[1]["share"])
+	assert.Equal(t, "<b>", rows[1]["note"])
+}
+
+func TestNDJSONReportGenerator(t *testing.T) {
+	generator := NewNDJSONReportGenerator(setupTestLogger())
+	assert.Equal(t, "ndjson", generator.GetFileExtension())
+
+	data := jsonTestData()
+	data.Datasets = append(data.Datasets, Dataset{Name: "totals", Rows: &sliceRows{
+		columns: []string{"total"},
+		rows:    [][]interface{}{{2000}},
+	}})
+
+	reader, _, err := generator.Generate(context.Background(), &models.Report{ID: 4}, data)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	// С несколькими наборами строка получает имя своего набора
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], `{"_dataset":"sales","region":"north",`))
+	assert.Equal(t, `{"_dataset":"totals","total":2000}`, lines[2])
+}
+
+func TestJSONReportGeneratorEmpty(t *testing.T) {
+	reader, _, err := NewJSONReportGenerator(setupTestLogger()).Generate(context.Background(), &models.Report{ID: 4},
+		&ReportData{Datasets: []Dataset{{Name: "sales", Rows: &sliceRows{columns: []string{"region"}}}}})
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "[]\n", string(content))
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// LinkTokenPrefix начало токена публичной ссылки
+	LinkTokenPrefix = "rsl_"
+
+	// DefaultLinkExpiration срок действия ссылки по умолчанию
+	DefaultLinkExpiration = 7 * 24 * time.Hour
+	// MaxLinkExpiration максимальный срок действия ссылки
+	MaxLinkExpiration = 30 * 24 * time.Hour
+
+	// linkTokenBytes число случайных байт токена
+	linkTokenBytes = 32
+	// linkDisplayPrefix длина начала токена, которое хранится для опознания ссылки
+	linkDisplayPrefix = 12
+)
+
+var (
+	// ErrInvalidLinkRequest параметры создаваемой ссылки не прошли проверку
+	ErrInvalidLinkRequest = newCategoryError(ErrValidation, "некорректные параметры ссылки")
+	// ErrLinkNotFound ссылка не найдена или отозвана
+	ErrLinkNotFound = newCategoryError(ErrNotFound, "ссылка не найдена")
+	// ErrLinkExpired срок действия ссылки истек, скачивания закончились или файл отчета удален
+	ErrLinkExpired = errors.New("ссылка больше не действует")
+)
+
+// SharedReport файл отчета, открытый по публичной ссылке. Reader файла
+// должен быть закрыт вызывающей стороной.
+type SharedReport struct {
+	Report *models.Report
+	File   *ReportFile
+}
+
+// LinkService интерфейс для управления публичными ссылками на отчеты
+type LinkService interface {
+	// CreateLink создает ссылку и возвращает ее токен, который больше нигде не хранится
+	CreateLink(ctx context.Context, link *models.ReportLink) (string, error)
+	ListLinks(ctx context.Context, reportID uint) ([]models.ReportLink, error)
+	RevokeLink(ctx context.Context, reportID, id uint) error
+	// OpenLink проверяет ссылку, засчитывает скачивание и открывает файл отчета
+	OpenLink(ctx context.Context, token string) (*SharedReport, error)
+}
+
+// LinkRepository интерфейс для работы с публичными ссылками в базе данных
+type LinkRepository interface {
+	Create(ctx context.Context, link *models.ReportLink) error
+	GetByHash(ctx context.Context, hash string) (*models.ReportLink, error)
+	ListByReport(ctx context.Context, reportID uint) ([]models.ReportLink, error)
+	Delete(ctx context.Context, reportID, id uint) error
+	// Consume засчитывает скачивание, если ссылка еще действует
+	Consume(ctx context.Context, id uint, now time.Time) (bool, error)
+}
+
+// GormLinkRepository реализация LinkRepository с использованием GORM
+type GormLinkRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormLinkRepository создает новый репозиторий публичных ссылок
+func NewGormLinkRepository(db *gorm.DB, logger logging.Logger) LinkRepository {
+	return &GormLinkRepository{db: db, logger: logger}
+}
+
+// Create сохраняет ссылку
+func (r *GormLinkRepository) Create(ctx context.Context, link *models.ReportLink) error {
+	return r.db.WithContext(ctx).Create(link).Error
+}
+
+// GetByHash возвращает неотозванную ссылку по SHA-256 ее токена
+func (r *GormLinkRepository) GetByHash(ctx context.Context, hash string) (*models.ReportLink, error) {
+	var link models.ReportLink
+	if err := r.db.WithContext(ctx).Where("token_hash = ?", hash).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// ListByReport возвращает неотозванные ссылки отчета от новых к старым
+func (r *GormLinkRepository) ListByReport(ctx context.Context, reportID uint) ([]models.ReportLink, error) {
+	var links []models.ReportLink
+	err := r.db.WithContext(ctx).Where("report_id = ?", reportID).Order("created_at DESC").Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Delete отзывает ссылку отчета
+func (r *GormLinkRepository) Delete(ctx context.Context, reportID, id uint) error {
+	result := r.db.WithContext(ctx).Where("report_id = ?", reportID).Delete(&models.ReportLink{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Consume увеличивает счетчик скачиваний одним запросом, чтобы одновременные
+// скачивания не превысили лимит ссылки
+func (r *GormLinkRepository) Consume(ctx context.Context, id uint, now time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.ReportLink{}).
+		Where("id = ? AND expires_at > ?", id, now).
+		Where("max_downloads IS NULL OR downloads < max_downloads").
+		UpdateColumns(map[string]interface{}{
+			"downloads":          gorm.Expr("downloads + 1"),
+			"last_downloaded_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// LinkServiceImpl реализация сервиса публичных ссылок
+type LinkServiceImpl struct {
+	repository LinkRepository
+	reports    ReportService
+	logger     logging.Logger
+	now        func() time.Time
+}
+
+// NewLinkService создает новый сервис публичных ссылок
+func NewLinkService(repository LinkRepository, reports ReportService, logger logging.Logger) *LinkServiceImpl {
+	return &LinkServiceImpl{
+		repository: repository,
+		reports:    reports,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// NewLinkServiceFromDB создает сервис публичных ссылок с хранением в базе данных
+func NewLinkServiceFromDB(db *gorm.DB, reports ReportService, logger logging.Logger) LinkService {
+	return NewLinkService(NewGormLinkRepository(db, logger), reports, logger)
+}
+
+// CreateLink создает публичную ссылку на готовый отчет. Без срока действия
+// ссылка действует DefaultLinkExpiration.
+func (s *LinkServiceImpl) CreateLink(ctx context.Context, link *models.ReportLink) (string, error) {
+	link.CreatedBy = actorOr(ctx, link.CreatedBy)
+	now := s.now().UTC()
+	if link.ExpiresAt.IsZero() {
+		link.ExpiresAt = now.Add(DefaultLinkExpiration)
+	}
+	if err := link.Validate(); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidLinkRequest, err)
+	}
+	if link.IsExpired(now) {
+		return "", fmt.Errorf("%w: срок действия ссылки уже истек", ErrInvalidLinkRequest)
+	}
+	if link.ExpiresAt.After(now.Add(MaxLinkExpiration)) {
+		return "", fmt.Errorf("%w: срок действия ссылки больше %s", ErrInvalidLinkRequest, MaxLinkExpiration)
+	}
+
+	report, err := s.reports.GetReport(ctx, link.ReportID)
+	if err != nil {
+		return "", err
+	}
+	if !report.IsCompleted() || !report.HasFile() {
+		return "", fmt.Errorf("%w: отчет еще не готов для скачивания", ErrInvalidLinkRequest)
+	}
+
+	secret := make([]byte, linkTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("ошибка генерации токена ссылки: %w", err)
+	}
+	token := LinkTokenPrefix + hex.EncodeToString(secret)
+	link.Prefix = token[:linkDisplayPrefix]
+	link.TokenHash = hashSecret(token)
+
+	if err := s.repository.Create(ctx, link); err != nil {
+		return "", fmt.Errorf("ошибка сохранения ссылки: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"link_id":       link.ID,
+		"report_id":     link.ReportID,
+		"expires_at":    link.ExpiresAt,
+		"max_downloads": link.MaxDownloads,
+		"created_by":    link.CreatedBy,
+	}).Info("Публичная ссылка на отчет создана")
+
+	return token, nil
+}
+
+// ListLinks возвращает неотозванные ссылки отчета, включая истекшие
+func (s *LinkServiceImpl) ListLinks(ctx context.Context, reportID uint) ([]models.ReportLink, error) {
+	links, err := s.repository.ListByReport(ctx, reportID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения ссылок отчета: %w", err)
+	}
+	return links, nil
+}
+
+// RevokeLink отзывает ссылку отчета
+func (s *LinkServiceImpl) RevokeLink(ctx context.Context, reportID, id uint) error {
+	if err := s.repository.Delete(ctx, reportID, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %d", ErrLinkNotFound, id)
+		}
+		return fmt.Errorf("ошибка отзыва ссылки: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"link_id":   id,
+		"report_id": reportID,
+	}).Info("Публичная ссылка на отчет отозвана")
+	return nil
+}
+
+// OpenLink открывает файл отчета по токену ссылки. Скачивание засчитывается
+// после открытия файла, чтобы ошибка хранилища не тратила скачивания.
+func (s *LinkServiceImpl) OpenLink(ctx context.Context, token string) (*SharedReport, error) {
+	link, err := s.repository.GetByHash(ctx, hashSecret(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLinkNotFound
+		}
+		return nil, fmt.Errorf("ошибка получения ссылки: %w", err)
+	}
+
+	now := s.now().UTC()
+	if link.IsExpired(now) || link.IsExhausted() {
+		return nil, ErrLinkExpired
+	}
+
+	report, err := s.reports.GetReport(ctx, link.ReportID)
+	if err != nil {
+		return nil, ErrLinkNotFound
+	}
+	if !report.IsCompleted() || !report.HasFile() {
+		return nil, ErrLinkExpired
+	}
+
+	file, err := s.reports.GetReportFile(ctx, link.ReportID)
+	if err != nil {
+		return nil, err
+	}
+
+	consumed, err := s.repository.Consume(ctx, link.ID, now)
+	if err != nil || !consumed {
+		file.Reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка учета скачивания по ссылке: %w", err)
+		}
+		return nil, ErrLinkExpired
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"link_id":   link.ID,
+		"report_id": link.ReportID,
+		"downloads": link.Downloads + 1,
+	}).Info("Отчет скачан по публичной ссылке")
+
+	return &SharedReport{Report: report, File: file}, nil
+}
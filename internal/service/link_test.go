@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkServiceLimitsDownloads(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.ReportLink{}))
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	reports := newTestReportService(t, db, mockStorage, logger)
+	links := NewLinkService(NewGormLinkRepository(db, logger), reports, logger)
+
+	report := &models.Report{
+		Title:     "Audit",
+		Status:    models.StatusCompleted,
+		Format:    models.FormatCSV,
+		FileKey:   "reports/audit.csv",
+		CreatedBy: "alice",
+		UpdatedBy: "alice",
+	}
+	require.NoError(t, db.Create(report).Error)
+
+	mockStorage.On("GetSize", mock.Anything, report.FileKey).Return(int64(3), nil)
+	mockStorage.On("Get", mock.Anything, report.FileKey).Return(io.NopCloser(strings.NewReader("a;b")), nil)
+
+	maxDownloads := 2
+	link := &models.ReportLink{ReportID: report.ID, MaxDownloads: &maxDownloads, CreatedBy: "alice"}
+	token, err := links.CreateLink(ctx, link)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, LinkTokenPrefix))
+	assert.Equal(t, token[:linkDisplayPrefix], link.Prefix)
+	assert.NotContains(t, link.TokenHash, token)
+	assert.WithinDuration(t, time.Now().Add(DefaultLinkExpiration), link.ExpiresAt, time.Minute)
+
+	// Скачивания засчитываются до исчерпания лимита
+	for i := 0; i < maxDownloads; i++ {
+		shared, err := links.OpenLink(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, report.ID, shared.Report.ID)
+		assert.Equal(t, "Audit.csv", shared.File.Filename)
+		shared.File.Reader.Close()
+	}
+	_, err = links.OpenLink(ctx, token)
+	assert.ErrorIs(t, err, ErrLinkExpired)
+
+	stored, err := links.ListLinks(ctx, report.ID)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, maxDownloads, stored[0].Downloads)
+	assert.NotNil(t, stored[0].LastDownloadedAt)
+
+	_, err = links.OpenLink(ctx, LinkTokenPrefix+"unknown")
+	assert.ErrorIs(t, err, ErrLinkNotFound)
+}
+
+func TestLinkServiceExpirationAndRevoke(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.ReportLink{}))
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	reports := newTestReportService(t, db, mockStorage, logger)
+	links := NewLinkService(NewGormLinkRepository(db, logger), reports, logger)
+
+	pending := &models.Report{Title: "Pending", Status: models.StatusPending, Format: models.FormatCSV, CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, db.Create(pending).Error)
+	_, err := links.CreateLink(ctx, &models.ReportLink{ReportID: pending.ID, CreatedBy: "alice"})
+	assert.ErrorIs(t, err, ErrInvalidLinkRequest)
+
+	report := &models.Report{Title: "Audit", Status: models.StatusCompleted, Format: models.FormatCSV, FileKey: "reports/audit.csv", CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, db.Create(report).Error)
+
+	_, err = links.CreateLink(ctx, &models.ReportLink{ReportID: report.ID, ExpiresAt: time.Now().Add(MaxLinkExpiration + time.Hour), CreatedBy: "alice"})
+	assert.ErrorIs(t, err, ErrInvalidLinkRequest)
+
+	link := &models.ReportLink{ReportID: report.ID, ExpiresAt: time.Now().Add(time.Hour), CreatedBy: "alice"}
+	token, err := links.CreateLink(ctx, link)
+	require.NoError(t, err)
+
+	// Истекшая ссылка не открывает файл
+	links.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = links.OpenLink(ctx, token)
+	assert.ErrorIs(t, err, ErrLinkExpired)
+
+	// Отозванная ссылка не находится
+	links.now = time.Now
+	assert.ErrorIs(t, links.RevokeLink(ctx, report.ID+1, link.ID), ErrLinkNotFound)
+	require.NoError(t, links.RevokeLink(ctx, report.ID, link.ID))
+	_, err = links.OpenLink(ctx, token)
+	assert.ErrorIs(t, err, ErrLinkNotFound)
+	mockStorage.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"golang.org/x/text/language"
+)
+
+// localizationFileExtension расширение файлов переводов заголовков
+const localizationFileExtension = ".json"
+
+// rightToLeftLanguages языки с письмом справа налево
+var rightToLeftLanguages = map[string]bool{
+	"ar": true, "he": true, "fa": true, "ur": true, "yi": true, "ps": true, "dv": true, "sd": true, "ug": true, "ckb": true,
+}
+
+// Localization переводы заголовков колонок отчетов по локалям. Заголовок ищется сначала
+// в переводах полной локали (ar-EG), затем языка (ar); без перевода выводится как есть.
+type Localization struct {
+	bundles map[string]map[string]string
+}
+
+// NewLocalization создает локализацию по переводам: локаль -> заголовок -> перевод
+func NewLocalization(bundles map[string]map[string]string) *Localization {
+	localization := &Localization{bundles: make(map[string]map[string]string, len(bundles))}
+	for locale, headers := range bundles {
+		localization.bundles[canonicalLocale(locale)] = headers
+	}
+	return localization
+}
+
+// NewLocalizationFromConfig загружает переводы заголовков из каталога конфигурации.
+// Если каталог не задан, заголовки не переводятся.
+func NewLocalizationFromConfig(cfg config.Config, logger logging.Logger) (*Localization, error) {
+	if cfg.Localization.Path == "" {
+		return NewLocalization(nil), nil
+	}
+
+	localization, err := LoadLocalization(cfg.Localization.Path)
+	if err != nil {
+		return nil, err
+	}
+	logger.WithField("locales", localization.Locales()).Info("Переводы заголовков отчетов загружены")
+	return localization, nil
+}
+
+// LoadLocalization читает переводы из файлов <локаль>.json каталога dir. Файл содержит
+// объект, в котором ключ - заголовок колонки, значение - его перевод.
+func LoadLocalization(dir string) (*Localization, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога переводов %s: %w", dir, err)
+	}
+
+	bundles := make(map[string]map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != localizationFileExtension {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		locale := strings.TrimSuffix(entry.Name(), localizationFileExtension)
+		if _, err := language.Parse(locale); err != nil {
+			return nil, fmt.Errorf("файл переводов %s: неизвестная локаль %q", path, locale)
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения переводов %s: %w", path, err)
+		}
+		var headers map[string]string
+		if err := json.Unmarshal(raw, &headers); err != nil {
+			return nil, fmt.Errorf("ошибка разбора переводов %s: %w", path, err)
+		}
+		bundles[locale] = headers
+	}
+	return NewLocalization(bundles), nil
+}
+
+// Locales возвращает локали с переводами
+func (l *Localization) Locales() []string {
+	locales := make([]string, 0, len(l.bundles))
+	for locale := range l.bundles {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Headers возвращает переводы заголовков для локали. Переводы полной локали
+// дополняют и заменяют переводы языка.
+func (l *Localization) Headers(locale string) map[string]string {
+	if l == nil || locale == "" || len(l.bundles) == 0 {
+		return nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil
+	}
+	base, _ := tag.Base()
+
+	headers := make(map[string]string)
+	for _, key := range []string{base.String(), tag.String()} {
+		for header, translation := range l.bundles[key] {
+			headers[header] = translation
+		}
+	}
+	return headers
+}
+
+// localize задает данным отчета локаль из параметров и переводы заголовков
+func (l *Localization) localize(data *ReportData, parameters models.JSON) {
+	report := models.Report{Parameters: parameters}
+	locale, ok, err := report.Locale()
+	if err != nil || !ok {
+		return
+	}
+	data.Locale = locale
+	data.Headers = l.Headers(locale)
+}
+
+// canonicalLocale приводит локаль к виду BCP 47, неизвестная локаль не меняется
+func canonicalLocale(locale string) string {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return locale
+	}
+	return tag.String()
+}
+
+// isRightToLeft проверяет, пишется ли язык локали справа налево
+func isRightToLeft(locale string) bool {
+	if locale == "" {
+		return false
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return false
+	}
+	base, _ := tag.Base()
+	return rightToLeftLanguages[base.String()]
+}
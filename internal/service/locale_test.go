@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestLoadLocalization(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ar.json"), []byte(`{"region": "المنطقة", "amount": "المبلغ"}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ar-EG.json"), []byte(`{"amount": "القيمة"}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("не переводы"), 0o644))
+
+	localization, err := LoadLocalization(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ar", "ar-EG"}, localization.Locales())
+
+	// Переводы полной локали заменяют переводы языка
+	assert.Equal(t, map[string]string{"region": "المنطقة", "amount": "القيمة"}, localization.Headers("ar-EG"))
+	assert.Equal(t, map[string]string{"region": "المنطقة", "amount": "المبلغ"}, localization.Headers("ar-SA"))
+	assert.Empty(t, localization.Headers("en"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{}`), 0o644))
+	_, err = LoadLocalization(dir)
+	assert.Error(t, err)
+}
+
+func TestReportLocaleValidation(t *testing.T) {
+	report := &models.Report{Parameters: models.JSON{models.ParamLocale: "en_us"}}
+	locale, ok, err := report.Locale()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "en-US", locale)
+
+	report.Parameters[models.ParamLocale] = "not a locale"
+	_, _, err = report.Locale()
+	assert.Error(t, err)
+
+	report.Parameters[models.ParamLocale] = 42
+	_, _, err = report.Locale()
+	assert.Error(t, err)
+}
+
+func TestLocalizedGenerators(t *testing.T) {
+	localization := NewLocalization(map[string]map[string]string{"ar": {"region": "المنطقة"}})
+	newData := func() *ReportData {
+		data := &ReportData{Datasets: []Dataset{{Name: "sales", Rows: &sliceRows{
+			columns: []string{"region", "amount"},
+			rows:    [][]interface{}{{"north", 100}},
+		}}}}
+		localization.localize(data, models.JSON{models.ParamLocale: "ar-EG"})
+		return data
+	}
+	report := &models.Report{ID: 3, Title: "تقرير"}
+
+	t.Run("HTML", func(t *testing.T) {
+		reader, _, err := NewHTMLReportGenerator(setupTestLogger()).Generate(context.Background(), report, newData())
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		assert.Contains(t, string(content), `<html lang="ar-EG" dir="rtl">`)
+		assert.Contains(t, string(content), "<th>المنطقة</th><th>amount</th>")
+	})
+
+	t.Run("XLSX", func(t *testing.T) {
+		reader, _, err := NewExcelReportGenerator(setupTestLogger()).Generate(context.Background(), report, newData())
+		require.NoError(t, err)
+		f, err := excelize.OpenReader(reader)
+		require.NoError(t, err)
+		defer f.Close()
+
+		rows, err := f.GetRows(models.ExcelReportSheet)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"المنطقة", "amount"}, rows[0])
+
+		view, err := f.GetSheetView(models.ExcelReportSheet, 0)
+		require.NoError(t, err)
+		require.NotNil(t, view.RightToLeft)
+		assert.True(t, *view.RightToLeft)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		reader, _, err := NewCSVReportGenerator(setupTestLogger()).Generate(context.Background(), report, newData())
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "المنطقة,amount")
+	})
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// Варианты блокировки генерации отчетов
+	ReportLockAuto     = "auto"
+	ReportLockNone     = "none"
+	ReportLockRedis    = "redis"
+	ReportLockPostgres = "postgres"
+
+	// redisReportLockTTL время жизни блокировки в Redis. Пока генерация идет,
+	// блокировка продлевается каждую треть TTL, после падения экземпляра истекает сама
+	redisReportLockTTL = time.Minute
+
+	// postgresReportLockNamespace первый ключ advisory-блокировок генерации отчетов,
+	// отделяет их от других advisory-блокировок в той же БД
+	postgresReportLockNamespace = 0x52505254
+)
+
+// ErrReportLocked отчет генерирует другой экземпляр сервиса
+var ErrReportLocked = errors.New("отчет генерируется другим экземпляром сервиса")
+
+// ReportLocker блокировка генерации отчета между экземплярами сервиса.
+// TryLock не ждет освобождения блокировки: если отчет уже заблокирован,
+// возвращается ErrReportLocked. Возвращенная функция снимает блокировку.
+type ReportLocker interface {
+	TryLock(ctx context.Context, reportID uint) (func(), error)
+}
+
+// NopReportLocker блокировка для единственного экземпляра сервиса
+type NopReportLocker struct{}
+
+// TryLock всегда успешно блокирует отчет
+func (NopReportLocker) TryLock(ctx context.Context, reportID uint) (func(), error) {
+	return func() {}, nil
+}
+
+// NewReportLockerFromConfig создает блокировку генерации отчетов по настройкам приложения
+func NewReportLockerFromConfig(cfg config.Config, db *gorm.DB, logger logging.Logger) (ReportLocker, error) {
+	lock := cfg.Processor.Lock
+	if lock == ReportLockAuto || lock == "" {
+		switch {
+		case cfg.Processor.Type == "redis":
+			lock = ReportLockRedis
+		case db.Dialector.Name() == "postgres":
+			lock = ReportLockPostgres
+		default:
+			lock = ReportLockNone
+		}
+	}
+
+	logger.WithField("lock", lock).Info("Блокировка генерации отчетов настроена")
+
+	switch lock {
+	case ReportLockNone:
+		return NopReportLocker{}, nil
+	case ReportLockRedis:
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Address,
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		return NewRedisReportLocker(client, cfg.Processor.QueuePrefix, logger), nil
+	case ReportLockPostgres:
+		if name := db.Dialector.Name(); name != "postgres" {
+			return nil, fmt.Errorf("блокировка генерации в PostgreSQL недоступна для БД %s", name)
+		}
+		return NewPostgresReportLocker(db, logger), nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемая блокировка генерации отчетов: %s", lock)
+	}
+}
+
+// releaseScript снимает блокировку, только если ее держит этот владелец.
+// KEYS[1] - ключ блокировки, ARGV[1] - токен владельца.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// renewScript продлевает блокировку, только если ее держит этот владелец.
+// KEYS[1] - ключ блокировки, ARGV[1] - токен владельца, ARGV[2] - TTL в мс.
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// RedisReportLocker блокировка генерации отчетов в Redis
+type RedisReportLocker struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+	logger logging.Logger
+}
+
+// NewRedisReportLocker создает блокировку генерации отчетов в Redis
+func NewRedisReportLocker(client redis.UniversalClient, prefix string, logger logging.Logger) *RedisReportLocker {
+	if prefix == "" {
+		prefix = "report_srv"
+	}
+	return &RedisReportLocker{
+		client: client,
+		prefix: prefix,
+		ttl:    redisReportLockTTL,
+		logger: logger,
+	}
+}
+
+// TryLock блокирует отчет и продлевает блокировку до ее снятия
+func (l *RedisReportLocker) TryLock(ctx context.Context, reportID uint) (func(), error) {
+	key := l.lockKey(reportID)
+	token := uuid.NewString()
+
+	locked, err := l.client.SetNX(ctx, key, token, l.ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка блокировки отчета в Redis: %w", err)
+	}
+	if !locked {
+		return nil, ErrReportLocked
+	}
+
+	logger := logging.FromContext(ctx, l.logger).WithField("report_id", reportID)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				renewed, err := renewScript.Run(context.Background(), l.client, []string{key}, token, l.ttl.Milliseconds()).Int()
+				if err != nil {
+					logger.WithError(err).Warn("Ошибка продления блокировки отчета")
+				} else if renewed == 0 {
+					logger.Warn("Блокировка отчета потеряна до завершения генерации")
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+
+		// Контекст генерации может быть уже отменен
+		ctx, cancel := context.WithTimeout(context.Background(), defaultContextTimeout)
+		defer cancel()
+		if err := releaseScript.Run(ctx, l.client, []string{key}, token).Err(); err != nil {
+			logger.WithError(err).Warn("Ошибка снятия блокировки отчета")
+		}
+	}, nil
+}
+
+func (l *RedisReportLocker) lockKey(reportID uint) string {
+	return l.prefix + ":lock:report:" + strconv.FormatUint(uint64(reportID), 10)
+}
+
+// PostgresReportLocker блокировка генерации отчетов через advisory-блокировки PostgreSQL.
+// Блокировка держится на выделенном соединении и снимается сервером при его разрыве,
+// поэтому падение экземпляра не оставляет отчет заблокированным.
+type PostgresReportLocker struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewPostgresReportLocker создает блокировку генерации отчетов в PostgreSQL
+func NewPostgresReportLocker(db *gorm.DB, logger logging.Logger) *PostgresReportLocker {
+	return &PostgresReportLocker{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// TryLock блокирует отчет на выделенном соединении с БД
+func (l *PostgresReportLocker) TryLock(ctx context.Context, reportID uint) (func(), error) {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения соединения с БД: %w", err)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения соединения с БД: %w", err)
+	}
+
+	key := int32(reportID)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", postgresReportLockNamespace, key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ошибка блокировки отчета в PostgreSQL: %w", err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, ErrReportLocked
+	}
+
+	return func() {
+		// Контекст генерации может быть уже отменен
+		ctx, cancel := context.WithTimeout(context.Background(), defaultContextTimeout)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1, $2)", postgresReportLockNamespace, key); err != nil {
+			logging.FromContext(ctx, l.logger).WithError(err).WithField("report_id", reportID).Warn("Ошибка снятия блокировки отчета")
+			// Соединение с неснятой блокировкой не возвращаем в пул: сервер снимет ее при закрытии
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
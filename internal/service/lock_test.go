@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisReportLocker(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	logger := setupTestLogger()
+	first := NewRedisReportLocker(client, "test", logger)
+	second := NewRedisReportLocker(client, "test", logger)
+
+	unlock, err := first.TryLock(context.Background(), 1)
+	require.NoError(t, err)
+	assert.True(t, server.Exists("test:lock:report:1"))
+
+	// Другой экземпляр не может заблокировать тот же отчет, но может другой
+	_, err = second.TryLock(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrReportLocked)
+
+	unlockOther, err := second.TryLock(context.Background(), 2)
+	require.NoError(t, err)
+	unlockOther()
+
+	unlock()
+	assert.False(t, server.Exists("test:lock:report:1"))
+
+	unlock, err = second.TryLock(context.Background(), 1)
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestExecutorSkipsLockedAndFinishedReports(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	repository := NewGormReportRepository(db, logger)
+	locker := NewRedisReportLocker(client, "test", logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger).
+		WithLocker(locker)
+
+	report := &models.Report{Title: "Report", Format: models.FormatCSV, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, repository.Create(context.Background(), report))
+
+	// Отчет генерирует другой экземпляр: задача завершается без генерации
+	unlock, err := locker.TryLock(context.Background(), report.ID)
+	require.NoError(t, err)
+	require.NoError(t, executor.generateReport(context.Background(), report.ID))
+
+	stored, err := repository.GetByID(context.Background(), report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, stored.Status)
+	mockStorage.AssertNotCalled(t, "Save", mock.Anything, mock.Anything, mock.Anything)
+	unlock()
+
+	require.NoError(t, executor.generateReport(context.Background(), report.ID))
+	stored, err = repository.GetByID(context.Background(), report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+
+	// Повторная задача для готового отчета не генерирует его заново
+	require.NoError(t, executor.generateReport(context.Background(), report.ID))
+	mockStorage.AssertNumberOfCalls(t, "Save", 1)
+}
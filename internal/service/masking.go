@@ -0,0 +1,119 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+)
+
+// hashedValueLength длина хеша, которым способ hash заменяет значение
+const hashedValueLength = 16
+
+// MaskingPolicy маскирует персональные данные в файлах отчетов по правилам из конфигурации
+// и определений. Отчеты пользователей с областью pii:unmasked не маскируются.
+type MaskingPolicy struct {
+	rules   []models.MaskingRule
+	hashKey []byte
+}
+
+// NewMaskingPolicy создает политику маскирования из конфигурации
+func NewMaskingPolicy(cfg config.Masking) MaskingPolicy {
+	policy := MaskingPolicy{}
+	if cfg.HashKey != "" {
+		policy.hashKey = []byte(cfg.HashKey)
+	}
+	for _, rule := range cfg.Rules {
+		policy.rules = append(policy.rules, models.MaskingRule{Column: rule.Column, Pattern: rule.Pattern, Method: rule.Method})
+	}
+	return policy
+}
+
+// Fingerprint возвращает хеш правил из конфигурации или пустую строку без правил.
+// Входит в ключ повторного использования файлов: после смены правил маскированные файлы не используются.
+func (p MaskingPolicy) Fingerprint() string {
+	if len(p.rules) == 0 {
+		return ""
+	}
+	content, _ := json.Marshal(p.rules)
+	sum := sha256.Sum256(append(content, p.hashKey...))
+	return hex.EncodeToString(sum[:])
+}
+
+// forDefinition возвращает маскирование колонок отчета по определению
+func (p MaskingPolicy) forDefinition(definition *models.ReportDefinition) columnMasking {
+	rules := append(append([]models.MaskingRule(nil), p.rules...), definition.Masking...)
+	return columnMasking{rules: rules, hashKey: p.hashKey}
+}
+
+// columnMasking правила маскирования колонок одного отчета
+type columnMasking struct {
+	rules   []models.MaskingRule
+	hashKey []byte
+}
+
+// isEmpty проверяет, есть ли правила маскирования
+func (m columnMasking) isEmpty() bool {
+	return len(m.rules) == 0
+}
+
+// methods возвращает способ маскирования каждой колонки набора или пустую строку для открытых колонок.
+// Колонка проверяется по исходному имени names и по заголовку columns после переименования.
+func (m columnMasking) methods(dataset string, names, columns []string) []string {
+	if m.isEmpty() {
+		return nil
+	}
+	methods := make([]string, len(names))
+	for i := range names {
+		for _, rule := range m.rules {
+			if rule.Matches(dataset, names[i], columns[i]) {
+				methods[i] = rule.MaskingMethod()
+				break
+			}
+		}
+	}
+	return methods
+}
+
+// apply маскирует значение колонки способом method. NULL остается NULL
+func (m columnMasking) apply(method string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if method == models.MaskingMethodHash {
+		return m.hash(value)
+	}
+	return maskValue(value)
+}
+
+// hash возвращает начало HMAC-SHA256 значения в hex, без ключа - SHA-256
+func (m columnMasking) hash(value interface{}) string {
+	var sum []byte
+	text := []byte(maskedText(value))
+	if len(m.hashKey) > 0 {
+		mac := hmac.New(sha256.New, m.hashKey)
+		mac.Write(text)
+		sum = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256(text)
+		sum = digest[:]
+	}
+	return hex.EncodeToString(sum)[:hashedValueLength]
+}
+
+// maskedText приводит значение колонки к строке для маскирования
+func maskedText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskingPolicyMasksSensitiveColumns(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("CREATE TABLE customers (name TEXT, email TEXT, phone TEXT, passport TEXT)").Error)
+	require.NoError(t, db.Exec("INSERT INTO customers VALUES ('Иванов', 'ivanov@example.com', '+79001234567', '4510123456')").Error)
+
+	definition := newTestDefinition()
+	definition.ParameterSchema = nil
+	definition.Queries = models.Queries{{Name: "customers", SQL: "SELECT name, email, phone, passport FROM customers"}}
+	definition.ColumnMapping = &models.ColumnMapping{Columns: []models.ColumnTransform{{Column: "passport", Rename: "Паспорт"}}}
+	definition.Masking = models.MaskingRules{{Column: "паспорт"}}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	masking := NewMaskingPolicy(config.Masking{
+		Rules:   []config.MaskingRule{{Pattern: "^(email|phone)$", Method: models.MaskingMethodHash}},
+		HashKey: "secret",
+	})
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t, "customers"), newTestDataSources(t, db, nil),
+		NewReportFileStorage(new(MockStorage), logger), logger).WithMasking(masking)
+
+	load := func(report *models.Report) []interface{} {
+		data, err := loader.Load(ctx, report)
+		require.NoError(t, err)
+		defer data.Close()
+		row, err := data.Datasets[0].Rows.Next()
+		require.NoError(t, err)
+		return row
+	}
+
+	row := load(&models.Report{DefinitionID: &definition.ID})
+	assert.Equal(t, "Иванов", row[0])
+	require.Len(t, row[1], hashedValueLength)
+	assert.NotEqual(t, row[1], row[2])
+	assert.Equal(t, "******3456", row[3])
+
+	// Хеш одинаковых значений совпадает между отчетами
+	assert.Equal(t, row[1], load(&models.Report{DefinitionID: &definition.ID})[1])
+
+	row = load(&models.Report{DefinitionID: &definition.ID, Unmasked: true})
+	assert.Equal(t, []interface{}{"Иванов", "ivanov@example.com", "+79001234567", "4510123456"}, row)
+}
+
+func TestCreateReportRecordsUnmaskedPermission(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+
+	definition := newTestDefinition()
+	require.NoError(t, definitions.Create(context.Background(), definition))
+
+	reports := NewReportService(NewGormReportRepository(db, logger), NewFormatGenerators(logger),
+		NewReportFileStorage(new(MockStorage), logger), &stubProcessor{}, events.NewInProcessBus(logger), logger).
+		WithDefinitions(definitions)
+
+	ctx := WithUnmasked(WithActor(context.Background(), "analyst"))
+	report := &models.Report{Title: "Sales", Type: "sales", Parameters: models.JSON{"region": "north"}}
+	require.NoError(t, reports.CreateReport(ctx, report))
+	assert.True(t, report.Unmasked)
+
+	// Значение от клиента не учитывается
+	report = &models.Report{Title: "Sales", Type: "sales", Parameters: models.JSON{"region": "north"}, CreatedBy: "test-user", UpdatedBy: "test-user", Unmasked: true}
+	require.NoError(t, reports.CreateReport(context.Background(), report))
+	assert.False(t, report.Unmasked)
+}
@@ -0,0 +1,447 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+const (
+	// Режимы шифрования SMTP соединения
+	SMTPTLSNone     = "none"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+
+	// base64LineLength длина строки вложения по RFC 2045
+	base64LineLength = 76
+
+	// defaultNotificationTimeout ограничение на доставку одного отчета
+	defaultNotificationTimeout = 10 * time.Minute
+)
+
+// ReportNotifier уведомляет получателей о готовом отчете
+type ReportNotifier interface {
+	Notify(ctx context.Context, report *models.Report) error
+}
+
+// SubscribeNotifier подписывает уведомитель на завершение генерации отчетов.
+// Доставка выполняется в отдельной горутине, чтобы не задерживать публикацию
+func SubscribeNotifier(subscriber events.Subscriber, notifier ReportNotifier, repository ReportRepository, logger logging.Logger) func() {
+	return subscribeNotifier(subscriber, notifier, repository, logger, events.ReportCompleted)
+}
+
+// SubscribeChannelNotifier подписывает сообщения в каналы на готовые и упавшие отчеты
+func SubscribeChannelNotifier(subscriber events.Subscriber, notifier *ChannelNotifier, repository ReportRepository, logger logging.Logger) func() {
+	return subscribeNotifier(subscriber, notifier, repository, logger, events.ReportCompleted, events.ReportFailed)
+}
+
+// SubscribeInbox подписывает ленту уведомлений пользователей на готовые и упавшие отчеты
+func SubscribeInbox(subscriber events.Subscriber, notifier *InboxNotifier, repository ReportRepository, logger logging.Logger) func() {
+	return subscribeNotifier(subscriber, notifier, repository, logger, events.ReportCompleted, events.ReportFailed)
+}
+
+// subscribeNotifier подписывает уведомитель на события types
+func subscribeNotifier(subscriber events.Subscriber, notifier ReportNotifier, repository ReportRepository, logger logging.Logger, types ...events.EventType) func() {
+	return subscriber.Subscribe(func(ctx context.Context, event events.Event) {
+		// Контекст публикации завершается вместе с задачей генерации
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultNotificationTimeout)
+
+		go func() {
+			defer cancel()
+			logger := logger.WithField("report_id", event.ReportID)
+
+			report, err := repository.GetByID(ctx, event.ReportID)
+			if err != nil {
+				logger.WithError(err).Error("Ошибка получения отчета для доставки")
+				return
+			}
+
+			// Ошибка доставки не влияет на статус отчета
+			if err := notifier.Notify(ctx, report); err != nil {
+				logger.WithError(err).Warn("Не удалось доставить отчет получателям")
+			}
+		}()
+	}, types...)
+}
+
+// MailSender отправляет письмо. Тело письма пишется функцией write
+// напрямую в соединение, чтобы не держать вложение в памяти.
+type MailSender interface {
+	Send(ctx context.Context, from string, to []string, write func(w io.Writer) error) error
+}
+
+// SMTPSender реализация MailSender поверх net/smtp
+type SMTPSender struct {
+	host     string
+	port     int
+	username string
+	password string
+	tlsMode  string
+}
+
+// NewSMTPSender создает отправителя писем через SMTP сервер
+func NewSMTPSender(cfg config.SMTP) *SMTPSender {
+	return &SMTPSender{
+		host:     cfg.Host,
+		port:     cfg.Port,
+		username: cfg.Username,
+		password: cfg.Password,
+		tlsMode:  cfg.TLS,
+	}
+}
+
+// Send отправляет письмо через SMTP сервер
+func (s *SMTPSender) Send(ctx context.Context, from string, to []string, write func(w io.Writer) error) error {
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("ошибка аутентификации SMTP: %w", err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("ошибка установки отправителя: %w", err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("ошибка добавления получателя %s: %w", recipient, err)
+		}
+	}
+
+	data, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("ошибка начала передачи письма: %w", err)
+	}
+	if err := write(data); err != nil {
+		data.Close()
+		return fmt.Errorf("ошибка записи письма: %w", err)
+	}
+	if err := data.Close(); err != nil {
+		return fmt.Errorf("ошибка завершения передачи письма: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// dial устанавливает соединение с SMTP сервером с учетом режима TLS
+func (s *SMTPSender) dial(ctx context.Context) (*smtp.Client, error) {
+	address := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	tlsConfig := &tls.Config{ServerName: s.host}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подключения к SMTP серверу: %w", err)
+	}
+
+	// Дедлайн контекста распространяется на весь SMTP диалог
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if s.tlsMode == SMTPTLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ошибка инициализации SMTP клиента: %w", err)
+	}
+
+	if s.tlsMode == SMTPTLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("ошибка STARTTLS: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// EmailNotifier отправляет готовый отчет на адреса из параметров отчета.
+// Небольшие файлы прикладываются к письму, для больших отправляется ссылка.
+type EmailNotifier struct {
+	sender            MailSender
+	repository        ReportRepository
+	generators        FormatGenerators
+	fileStorage       ReportFileStorage
+	from              mail.Address
+	maxAttachmentSize int64
+	linkExpiration    time.Duration
+	logger            logging.Logger
+}
+
+// NewEmailNotifier создает уведомитель о готовых отчетах по почте
+func NewEmailNotifier(
+	cfg config.SMTP,
+	sender MailSender,
+	repository ReportRepository,
+	generators FormatGenerators,
+	fileStorage ReportFileStorage,
+	logger logging.Logger,
+) *EmailNotifier {
+	return &EmailNotifier{
+		sender:            sender,
+		repository:        repository,
+		generators:        generators,
+		fileStorage:       fileStorage,
+		from:              mail.Address{Name: cfg.FromName, Address: cfg.From},
+		maxAttachmentSize: cfg.MaxAttachmentSize,
+		linkExpiration:    cfg.LinkExpiration,
+		logger:            logger,
+	}
+}
+
+// Notify отправляет отчет получателям и сохраняет статус доставки. Сгенерированный пароль
+// файла отправляется отдельным письмом и удаляется из отчета. Отчеты без получателей пропускаются.
+func (n *EmailNotifier) Notify(ctx context.Context, report *models.Report) error {
+	recipients := report.EmailRecipients()
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	sendErr := n.send(ctx, report, recipients)
+	if sendErr == nil && report.PasswordGenerated {
+		sendErr = n.sendPassword(ctx, report, recipients)
+	}
+
+	updates := map[string]interface{}{
+		"delivery_status": models.DeliverySent,
+		"delivery_error":  "",
+	}
+	if report.PasswordGenerated {
+		// Пароль отправляется один раз, после отправки он больше не нужен
+		updates["file_password"] = ""
+	}
+	if sendErr != nil {
+		updates["delivery_status"] = models.DeliveryFailed
+		updates["delivery_error"] = sendErr.Error()
+	} else {
+		now := time.Now().UTC()
+		updates["delivered_at"] = &now
+		logging.FromContext(ctx, n.logger).WithFields(logging.Fields{
+			"report_id":  report.ID,
+			"recipients": len(recipients),
+		}).Info("Отчет отправлен по почте")
+	}
+
+	if err := n.repository.Update(ctx, report.ID, updates); err != nil {
+		return fmt.Errorf("ошибка сохранения статуса доставки: %w", err)
+	}
+
+	if sendErr != nil {
+		return fmt.Errorf("ошибка отправки отчета по почте: %w", sendErr)
+	}
+	return nil
+}
+
+// recipientAddresses возвращает адреса получателей без имен
+func recipientAddresses(recipients []string) ([]string, error) {
+	to := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("неверный адрес получателя %q: %w", recipient, err)
+		}
+		to = append(to, address.Address)
+	}
+	return to, nil
+}
+
+// sendPassword отправляет пароль файла письмом без вложения и ссылки на файл
+func (n *EmailNotifier) sendPassword(ctx context.Context, report *models.Report, recipients []string) error {
+	to, err := recipientAddresses(recipients)
+	if err != nil {
+		return err
+	}
+
+	message := &emailMessage{
+		from:    n.from.String(),
+		to:      to,
+		subject: fmt.Sprintf("Пароль к отчету «%s»", report.Title),
+		body: fmt.Sprintf("Файл отчета «%s» защищен паролем. Файл отправлен отдельным письмом.\r\n\r\nПароль: %s\r\n",
+			report.Title, report.FilePassword),
+	}
+	if err := n.sender.Send(ctx, n.from.Address, to, message.Write); err != nil {
+		return fmt.Errorf("ошибка отправки пароля файла: %w", err)
+	}
+	return nil
+}
+
+// send формирует и отправляет письмо с отчетом
+func (n *EmailNotifier) send(ctx context.Context, report *models.Report, recipients []string) error {
+	to, err := recipientAddresses(recipients)
+	if err != nil {
+		return err
+	}
+
+	generator, err := n.generators.ForFormat(report.Format)
+	if err != nil {
+		return err
+	}
+	filename, contentType := storedFile(report, generator)
+
+	size, err := n.fileStorage.Size(ctx, report.FileKey)
+	if err != nil {
+		return fmt.Errorf("ошибка получения размера файла: %w", err)
+	}
+
+	message := &emailMessage{
+		from:    n.from.String(),
+		to:      to,
+		subject: fmt.Sprintf("Отчет «%s» готов", report.Title),
+	}
+
+	if size > n.maxAttachmentSize {
+		url, err := n.fileStorage.PresignedURL(ctx, report.FileKey, n.linkExpiration)
+		if err != nil {
+			return fmt.Errorf("ошибка получения ссылки на файл: %w", err)
+		}
+		message.body = fmt.Sprintf("Отчет «%s» сгенерирован.\r\n\r\nСкачать файл %s: %s\r\nСсылка действительна до %s.\r\n",
+			report.Title, filename, url, time.Now().UTC().Add(n.linkExpiration).Format(time.RFC1123))
+		return n.sender.Send(ctx, n.from.Address, to, message.Write)
+	}
+
+	reader, err := n.fileStorage.Get(ctx, report.FileKey)
+	if err != nil {
+		return fmt.Errorf("ошибка получения файла: %w", err)
+	}
+	defer reader.Close()
+
+	message.body = fmt.Sprintf("Отчет «%s» сгенерирован. Файл во вложении.\r\n", report.Title)
+	message.attachment = &emailAttachment{
+		filename:    filename,
+		contentType: contentType,
+		reader:      verifyChecksum(reader, report.Checksum),
+	}
+
+	return n.sender.Send(ctx, n.from.Address, to, message.Write)
+}
+
+// emailMessage письмо в формате MIME
+type emailMessage struct {
+	from       string
+	to         []string
+	subject    string
+	body       string
+	attachment *emailAttachment
+}
+
+// emailAttachment вложение письма
+type emailAttachment struct {
+	filename    string
+	contentType string
+	reader      io.Reader
+}
+
+// Write записывает письмо, кодируя вложение потоком
+func (m *emailMessage) Write(w io.Writer) error {
+	writer := multipart.NewWriter(w)
+
+	headers := []string{
+		"From: " + m.from,
+		"To: " + strings.Join(m.to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", m.subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: " + mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": writer.Boundary()}),
+	}
+	if _, err := io.WriteString(w, strings.Join(headers, "\r\n")+"\r\n\r\n"); err != nil {
+		return err
+	}
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	body := quotedprintable.NewWriter(part)
+	if _, err := io.WriteString(body, m.body); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+
+	if m.attachment != nil {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {m.attachment.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition": {mime.FormatMediaType("attachment", map[string]string{
+				"filename": m.attachment.filename,
+			})},
+		})
+		if err != nil {
+			return err
+		}
+
+		encoder := base64.NewEncoder(base64.StdEncoding, &lineWriter{w: part, limit: base64LineLength})
+		if _, err := io.Copy(encoder, m.attachment.reader); err != nil {
+			return fmt.Errorf("ошибка записи вложения: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// lineWriter разбивает поток на строки фиксированной длины
+type lineWriter struct {
+	w      io.Writer
+	limit  int
+	length int
+}
+
+// Write записывает данные, вставляя перевод строки каждые limit байт
+func (l *lineWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := l.limit - l.length
+		if chunk > len(p) {
+			chunk = len(p)
+		}
+
+		n, err := l.w.Write(p[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[chunk:]
+		l.length += chunk
+		if l.length == l.limit {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+			l.length = 0
+		}
+	}
+	return written, nil
+}
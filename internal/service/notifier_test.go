@@ -0,0 +1,177 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMailSender struct {
+	to      []string
+	message bytes.Buffer
+	err     error
+}
+
+func (s *fakeMailSender) Send(ctx context.Context, from string, to []string, write func(w io.Writer) error) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.to = to
+	return write(&s.message)
+}
+
+func setupEmailNotifier(t *testing.T, sender MailSender, mockStorage *MockStorage) (*EmailNotifier, *models.Report) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	repository := NewGormReportRepository(db, logger)
+
+	report := &models.Report{
+		Title:      "Продажи",
+		Status:     models.StatusCompleted,
+		Format:     models.FormatCSV,
+		FileKey:    "reports/1/sales.csv",
+		Parameters: models.JSON{models.ParamEmailRecipients: []interface{}{"a@example.com", "Bob <b@example.com>"}},
+		CreatedBy:  "test-user",
+		UpdatedBy:  "test-user",
+	}
+	require.NoError(t, db.Create(report).Error)
+
+	cfg := config.SMTP{From: "reports@example.com", FromName: "Reports", MaxAttachmentSize: 1024, LinkExpiration: time.Hour}
+	notifier := NewEmailNotifier(cfg, sender, repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+
+	return notifier, report
+}
+
+func TestEmailNotifierSendsAttachment(t *testing.T) {
+	sender := &fakeMailSender{}
+	mockStorage := new(MockStorage)
+	notifier, report := setupEmailNotifier(t, sender, mockStorage)
+
+	content := "id;name\n1;Иван\n"
+	mockStorage.On("GetSize", mock.Anything, report.FileKey).Return(int64(len(content)), nil)
+	mockStorage.On("Get", mock.Anything, report.FileKey).Return(io.NopCloser(strings.NewReader(content)), nil)
+
+	require.NoError(t, notifier.Notify(context.Background(), report))
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, sender.to)
+
+	message, err := mail.ReadMessage(&sender.message)
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Отчет «Продажи» готов", subject)
+
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+
+	_, err = reader.NextPart()
+	require.NoError(t, err)
+
+	attachment, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "Продажи.csv", attachment.FileName())
+
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decoded))
+
+	var stored models.Report
+	require.NoError(t, notifier.repository.(*GormReportRepository).db.First(&stored, report.ID).Error)
+	assert.Equal(t, models.DeliverySent, stored.DeliveryStatus)
+	assert.NotNil(t, stored.DeliveredAt)
+}
+
+func TestEmailNotifierSendsLinkForLargeFiles(t *testing.T) {
+	sender := &fakeMailSender{}
+	mockStorage := new(MockStorage)
+	notifier, report := setupEmailNotifier(t, sender, mockStorage)
+
+	mockStorage.On("GetSize", mock.Anything, report.FileKey).Return(int64(1<<20), nil)
+	mockStorage.On("GetPresignedURL", mock.Anything, report.FileKey, time.Hour).Return("https://files.example.com/sales.csv", nil)
+
+	require.NoError(t, notifier.Notify(context.Background(), report))
+
+	message, err := mail.ReadMessage(&sender.message)
+	require.NoError(t, err)
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+
+	text, err := reader.NextPart()
+	require.NoError(t, err)
+	body, err := io.ReadAll(text)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "https://files.example.com/sales.csv")
+
+	_, err = reader.NextPart()
+	assert.ErrorIs(t, err, io.EOF)
+
+	mockStorage.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+}
+
+func TestEmailNotifierRecordsFailure(t *testing.T) {
+	sender := &fakeMailSender{err: errors.New("connection refused")}
+	mockStorage := new(MockStorage)
+	notifier, report := setupEmailNotifier(t, sender, mockStorage)
+
+	mockStorage.On("GetSize", mock.Anything, report.FileKey).Return(int64(1<<20), nil)
+	mockStorage.On("GetPresignedURL", mock.Anything, report.FileKey, time.Hour).Return("https://files.example.com/sales.csv", nil)
+
+	assert.Error(t, notifier.Notify(context.Background(), report))
+
+	var stored models.Report
+	require.NoError(t, notifier.repository.(*GormReportRepository).db.First(&stored, report.ID).Error)
+	assert.Equal(t, models.DeliveryFailed, stored.DeliveryStatus)
+	assert.Contains(t, stored.DeliveryError, "connection refused")
+	assert.Nil(t, stored.DeliveredAt)
+}
+
+type notifierFunc func(ctx context.Context, report *models.Report) error
+
+func (f notifierFunc) Notify(ctx context.Context, report *models.Report) error {
+	return f(ctx, report)
+}
+
+func TestSubscribeNotifierOnCompletedReports(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	repository := NewGormReportRepository(db, logger)
+	bus := events.NewInProcessBus(logger)
+
+	report := &models.Report{Title: "Report", Status: models.StatusCompleted, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+
+	notified := make(chan uint, 1)
+	SubscribeNotifier(bus, notifierFunc(func(ctx context.Context, report *models.Report) error {
+		notified <- report.ID
+		return nil
+	}), repository, logger)
+
+	require.NoError(t, bus.Publish(context.Background(), events.NewEvent(events.ReportStarted, report.ID, models.StatusProcessing)))
+	require.NoError(t, bus.Publish(context.Background(), events.NewEvent(events.ReportCompleted, report.ID, models.StatusCompleted)))
+
+	select {
+	case id := <-notified:
+		assert.Equal(t, report.ID, id)
+	case <-time.After(time.Second):
+		t.Fatal("уведомитель не вызван")
+	}
+	assert.Empty(t, notified)
+}
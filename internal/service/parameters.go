@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+	"report_srv/internal/schema"
+)
+
+// ErrUnknownReportType для типа отчета не задана схема параметров
+var ErrUnknownReportType = newCategoryError(ErrValidation, "неизвестный тип отчета")
+
+// ParameterSchemas источник JSON Schema параметров по типу отчета
+type ParameterSchemas interface {
+	Get(reportType string) (*schema.Schema, bool)
+}
+
+// NewParameterSchemasFromConfig загружает схемы параметров из каталога, заданного в конфигурации.
+// Если каталог не задан, набор схем пуст и принимаются только отчеты без типа.
+func NewParameterSchemasFromConfig(cfg config.Schemas) (*schema.Registry, error) {
+	if cfg.Path == "" {
+		return schema.NewRegistry(), nil
+	}
+	return schema.LoadDir(cfg.Path)
+}
+
+// validateParameters проверяет параметры отчета по схеме его типа.
+// Отчеты без типа принимают произвольные параметры.
+func validateParameters(schemas ParameterSchemas, reportType string, params models.JSON) error {
+	if reportType == "" {
+		return nil
+	}
+
+	var parameterSchema *schema.Schema
+	exists := false
+	if schemas != nil {
+		parameterSchema, exists = schemas.Get(reportType)
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownReportType, reportType)
+	}
+
+	return parameterSchema.Validate(params)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/schema"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateReportValidatesParametersBySchema(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	mockStorage := new(MockStorage)
+
+	salesSchema, err := schema.Compile("sales.json", []byte(`{
+		"type": "object",
+		"properties": {"region": {"type": "string"}, "year": {"type": "integer"}},
+		"required": ["region"]
+	}`))
+	require.NoError(t, err)
+	schemas := schema.NewRegistry()
+	schemas.Register("sales", salesSchema)
+
+	repository := NewGormReportRepository(db, logger)
+	generators := NewFormatGenerators(logger)
+	service := NewReportService(repository, generators, NewReportFileStorage(mockStorage, logger),
+		&stubProcessor{}, events.NewInProcessBus(logger), logger).WithSchemas(schemas)
+
+	newReport := func(reportType string, params models.JSON) *models.Report {
+		return &models.Report{Title: "Report", Type: reportType, Parameters: params, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	}
+
+	// Параметры не соответствуют схеме
+	err = service.CreateReport(context.Background(), newReport("sales", models.JSON{"year": "2024"}))
+	var validationErr *schema.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	fields := make([]string, 0, len(validationErr.Fields))
+	for _, field := range validationErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	assert.Equal(t, []string{"region", "year"}, fields)
+
+	// Тип без схемы
+	err = service.CreateReport(context.Background(), newReport("unknown", nil))
+	assert.ErrorIs(t, err, ErrUnknownReportType)
+
+	var count int64
+	require.NoError(t, db.Model(&models.Report{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Корректные параметры и отчет без типа
+	report := newReport("sales", models.JSON{"region": "north", "year": 2024})
+	require.NoError(t, service.CreateReport(context.Background(), report))
+	require.NoError(t, service.CreateReport(context.Background(), newReport("", models.JSON{"any": true})))
+
+	// Изменение параметров проверяется по схеме типа отчета
+	invalid := models.JSON{"region": 1}
+	err = service.UpdateReport(context.Background(), report.ID, ReportUpdateParams{Parameters: &invalid, UpdatedBy: "test-user"})
+	assert.ErrorAs(t, err, &validationErr)
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPreviewRows число строк каждого набора в предпросмотре по умолчанию
+	DefaultPreviewRows = 50
+	// MaxPreviewRows наибольшее число строк набора в предпросмотре
+	MaxPreviewRows = 500
+
+	// previewTimeout ограничение на выполнение запросов и генерацию файла предпросмотра
+	previewTimeout = 30 * time.Second
+	// previewDefinitionName имя несохраненного определения без имени
+	previewDefinitionName = "preview"
+)
+
+var (
+	// ErrPreviewFailed запросы или шаблон предпросмотра завершились ошибкой
+	ErrPreviewFailed = newCategoryError(ErrValidation, "ошибка предпросмотра отчета")
+	// ErrInvalidPreviewLimit число строк предпросмотра вне допустимого диапазона
+	ErrInvalidPreviewLimit = newCategoryError(ErrValidation, "недопустимое число строк предпросмотра")
+)
+
+// PreviewRequest запрос предпросмотра отчета. Задается имя сохраненного определения
+// или несохраненное определение, например при отладке запросов.
+type PreviewRequest struct {
+	Type       string
+	Definition *models.ReportDefinition
+	Parameters models.JSON
+	// Format формат файла предпросмотра. Пустой - данные возвращаются без файла
+	Format models.ReportFormat
+	// Limit число строк каждого набора, 0 - DefaultPreviewRows
+	Limit int
+}
+
+// PreviewDataset строки набора в предпросмотре
+type PreviewDataset struct {
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// Truncated в результате запроса больше строк, чем в предпросмотре
+	Truncated bool `json:"truncated"`
+}
+
+// ReportPreview результат предпросмотра: первые строки наборов и файл, если запрошен формат
+type ReportPreview struct {
+	Definition string           `json:"definition"`
+	Datasets   []PreviewDataset `json:"datasets"`
+	File       *ReportFile      `json:"-"`
+}
+
+// PreviewService выполняет запросы определения с ограничением строк без создания отчета
+type PreviewService interface {
+	Preview(ctx context.Context, request PreviewRequest) (*ReportPreview, error)
+}
+
+// PreviewServiceImpl реализация предпросмотра отчетов
+type PreviewServiceImpl struct {
+	definitions DefinitionRepository
+	queries     QueryValidator
+	sources     DataSources
+	loader      *DefinitionDataLoader
+	generators  FormatGenerators
+	logger      logging.Logger
+}
+
+// NewPreviewService создает сервис предпросмотра отчетов
+func NewPreviewService(
+	definitions DefinitionRepository,
+	queries QueryValidator,
+	sources DataSources,
+	generators FormatGenerators,
+	fileStorage ReportFileStorage,
+	masking MaskingPolicy,
+	localization *Localization,
+	logger logging.Logger,
+) PreviewService {
+	loader := NewDefinitionDataLoader(definitions, queries, sources, fileStorage, logger).
+		WithMasking(masking).
+		WithLocalization(localization)
+	return &PreviewServiceImpl{
+		definitions: definitions,
+		queries:     queries,
+		sources:     sources,
+		loader:      loader,
+		generators:  generators,
+		logger:      logger,
+	}
+}
+
+// NewPreviewServiceFromConfig создает сервис предпросмотра с генераторами, хранилищем шаблонов,
+// загруженными файлами с данными и правилами маскирования из конфигурации
+func NewPreviewServiceFromConfig(
+	cfg config.Config,
+	db *gorm.DB,
+	definitions DefinitionRepository,
+	queries QueryValidator,
+	sources DataSources,
+	generators FormatGenerators,
+	fileStorage storage.Storage,
+	localization *Localization,
+	logger logging.Logger,
+) PreviewService {
+	preview := NewPreviewService(definitions, queries, sources, generators,
+		NewReportFileStorage(fileStorage, logger), NewMaskingPolicy(cfg.Masking), localization, logger).(*PreviewServiceImpl)
+	preview.loader.
+		WithDatasets(NewGormDatasetRepository(db, logger)).
+		WithTemplateMaxSize(cfg.Templates.MaxSize)
+	return preview
+}
+
+// Preview выполняет запросы определения и возвращает не больше Limit строк каждого набора.
+// Если задан формат, по этим строкам генерируется файл. Отчет и файл не сохраняются.
+func (s *PreviewServiceImpl) Preview(ctx context.Context, request PreviewRequest) (*ReportPreview, error) {
+	limit := request.Limit
+	if limit == 0 {
+		limit = DefaultPreviewRows
+	}
+	if limit < 0 || limit > MaxPreviewRows {
+		return nil, fmt.Errorf("%w: %d, допустимо от 1 до %d", ErrInvalidPreviewLimit, request.Limit, MaxPreviewRows)
+	}
+
+	definition, err := s.previewDefinition(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	parameterSchema, err := definitionSchema(definition)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDefinition, err)
+	}
+	if parameterSchema != nil {
+		if err := parameterSchema.Validate(request.Parameters); err != nil {
+			return nil, fmt.Errorf("ошибка валидации параметров отчета: %w", err)
+		}
+	}
+
+	var generator ReportGenerator
+	if request.Format != "" {
+		if request.Format.IsTemplated() && !definition.HasTemplate() {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateRequired, request.Format)
+		}
+		if generator, err = s.generators.ForFormat(request.Format); err != nil {
+			return nil, fmt.Errorf("ошибка валидации отчета: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+
+	data, err := s.loader.LoadDefinition(ctx, definition, request.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPreviewFailed, err)
+	}
+	defer data.Close()
+
+	preview := &ReportPreview{Definition: definition.Name}
+	for i, dataset := range data.Datasets {
+		rows, err := previewRows(dataset, limit)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPreviewFailed, err)
+		}
+		preview.Datasets = append(preview.Datasets, rows)
+		// Курсор запроса закрывается сразу, генератор получает уже прочитанные строки
+		if closer, ok := dataset.Rows.(io.Closer); ok {
+			closer.Close()
+		}
+		data.Datasets[i].Rows = &tableRows{columns: rows.Columns, rows: rows.Rows}
+	}
+	// Файлы архива строятся по уже прочитанным строкам
+	data.Reload = func(context.Context) (*ReportData, error) {
+		reloaded := *data
+		reloaded.Datasets = make([]Dataset, len(data.Datasets))
+		for i, dataset := range data.Datasets {
+			dataset.Rows = &tableRows{columns: preview.Datasets[i].Columns, rows: preview.Datasets[i].Rows}
+			reloaded.Datasets[i] = dataset
+		}
+		return &reloaded, nil
+	}
+
+	if generator != nil {
+		report := &models.Report{
+			Title:      "Предпросмотр " + definition.Name,
+			Type:       definition.Name,
+			Format:     request.Format,
+			Parameters: request.Parameters,
+			Status:     models.StatusCompleted,
+			CreatedBy:  actorOr(ctx, previewDefinitionName),
+			CreatedAt:  time.Now().UTC(),
+		}
+		if definition.ID != 0 {
+			report.DefinitionID = &definition.ID
+		}
+		if preview.File, err = s.renderPreview(ctx, generator, report, data); err != nil {
+			return nil, err
+		}
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"definition": definition.Name,
+		"datasets":   len(preview.Datasets),
+		"format":     request.Format,
+	}).Debug("Предпросмотр отчета выполнен")
+	return preview, nil
+}
+
+// previewDefinition возвращает несохраненное определение из запроса после проверки
+// или сохраненное определение по типу отчета
+func (s *PreviewServiceImpl) previewDefinition(ctx context.Context, request PreviewRequest) (*models.ReportDefinition, error) {
+	if request.Definition != nil {
+		definition := *request.Definition
+		if definition.Name == "" {
+			definition.Name = previewDefinitionName
+		}
+		// Несохраненное определение проверяется как новое от имени автора запроса
+		actor := actorOr(ctx, previewDefinitionName)
+		definition.CreatedBy, definition.UpdatedBy = actor, actor
+		if err := checkDefinition(&definition, s.queries, s.sources); err != nil {
+			return nil, err
+		}
+		return &definition, nil
+	}
+
+	if request.Type == "" {
+		return nil, fmt.Errorf("%w: не задано определение или тип отчета", ErrInvalidDefinition)
+	}
+	definition, err := s.definitions.GetByName(ctx, request.Type)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrDefinitionNotFound, request.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения определения отчета: %w", err)
+	}
+	return definition, nil
+}
+
+// renderPreview генерирует файл предпросмотра в памяти: строк в нем не больше лимита
+func (s *PreviewServiceImpl) renderPreview(ctx context.Context, generator ReportGenerator, report *models.Report, data *ReportData) (*ReportFile, error) {
+	reader, filename, err := generator.Generate(ctx, report, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPreviewFailed, err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPreviewFailed, err)
+	}
+	return &ReportFile{
+		Reader:      io.NopCloser(bytes.NewReader(content)),
+		Filename:    filename,
+		ContentType: generator.GetMimeType(),
+		Size:        int64(len(content)),
+	}, nil
+}
+
+// previewRows читает до limit строк набора и проверяет, есть ли в нем еще строки
+func previewRows(dataset Dataset, limit int) (PreviewDataset, error) {
+	preview := PreviewDataset{Name: dataset.Name, Rows: [][]interface{}{}}
+	for {
+		row, err := dataset.Rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return preview, err
+		}
+		if len(preview.Rows) == limit {
+			preview.Truncated = true
+			break
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+	preview.Columns = dataset.Rows.Columns()
+	return preview, nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPreviewTest(t *testing.T) (PreviewService, DefinitionRepository) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+
+	require.NoError(t, db.Exec("CREATE TABLE sales (region TEXT, amount INTEGER)").Error)
+	require.NoError(t, db.Exec("INSERT INTO sales VALUES ('north', 20), ('north', 10), ('north', 5), ('south', 30)").Error)
+
+	previews := NewPreviewService(definitions, newTestQueryValidator(t, "sales"), newTestDataSources(t, db, nil),
+		NewFormatGenerators(logger), NewReportFileStorage(new(MockStorage), logger), MaskingPolicy{}, nil, logger)
+	return previews, definitions
+}
+
+func TestPreviewLimitsRows(t *testing.T) {
+	previews, definitions := setupPreviewTest(t)
+	ctx := context.Background()
+
+	definition := newTestDefinition()
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	preview, err := previews.Preview(ctx, PreviewRequest{
+		Type:       "sales",
+		Parameters: models.JSON{"region": "north"},
+		Limit:      2,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, preview.Datasets, 1)
+	dataset := preview.Datasets[0]
+	assert.Equal(t, "totals", dataset.Name)
+	assert.Equal(t, []string{"region", "amount"}, dataset.Columns)
+	assert.Len(t, dataset.Rows, 2)
+	assert.True(t, dataset.Truncated)
+	assert.Nil(t, preview.File)
+
+	// Все строки помещаются в лимит по умолчанию
+	preview, err = previews.Preview(ctx, PreviewRequest{Type: "sales", Parameters: models.JSON{"region": "north"}})
+	require.NoError(t, err)
+	assert.Len(t, preview.Datasets[0].Rows, 3)
+	assert.False(t, preview.Datasets[0].Truncated)
+}
+
+func TestPreviewInlineDefinitionRendersFile(t *testing.T) {
+	previews, _ := setupPreviewTest(t)
+
+	preview, err := previews.Preview(context.Background(), PreviewRequest{
+		Definition: &models.ReportDefinition{
+			Queries: models.Queries{{Name: "all", SQL: "SELECT region, amount FROM sales ORDER BY amount"}},
+		},
+		Format: models.FormatCSV,
+		Limit:  1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, previewDefinitionName, preview.Definition)
+	require.NotNil(t, preview.File)
+	defer preview.File.Reader.Close()
+
+	content, err := io.ReadAll(preview.File.Reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "north")
+	assert.NotContains(t, string(content), "south")
+	assert.Equal(t, int64(len(content)), preview.File.Size)
+}
+
+func TestPreviewRejectsInvalidRequest(t *testing.T) {
+	previews, _ := setupPreviewTest(t)
+	ctx := context.Background()
+
+	_, err := previews.Preview(ctx, PreviewRequest{Type: "sales", Limit: MaxPreviewRows + 1})
+	assert.ErrorIs(t, err, ErrInvalidPreviewLimit)
+	assert.ErrorIs(t, err, ErrValidation)
+
+	_, err = previews.Preview(ctx, PreviewRequest{Type: "missing"})
+	assert.ErrorIs(t, err, ErrDefinitionNotFound)
+
+	// Таблица вне списка разрешенных
+	_, err = previews.Preview(ctx, PreviewRequest{
+		Definition: &models.ReportDefinition{Queries: models.Queries{{Name: "users", SQL: "SELECT * FROM users"}}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidDefinition)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// TaskPrioritizer фоновый процессор, который меняет приоритет задачи в очереди.
+// Процессор без очереди (sync) запускает задачи сразу, и приоритет сохраняется только в отчете
+type TaskPrioritizer interface {
+	SetTaskPriority(ctx context.Context, taskID string, priority Priority) error
+}
+
+// SetReportPriority меняет приоритет отчета, ожидающего генерации, и его задачи в очереди процессора
+func (s *ReportServiceImpl) SetReportPriority(ctx context.Context, id uint, priority models.ReportPriority, updatedBy string) (*models.Report, error) {
+	if !priority.IsValid() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPriority, priority)
+	}
+	updatedBy = actorOr(ctx, updatedBy)
+	logger := logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"report_id":  id,
+		"priority":   priority,
+		"updated_by": updatedBy,
+	})
+
+	report, err := s.repository.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrReportNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения отчета: %w", err)
+	}
+	if report.Status != models.StatusPending {
+		return nil, fmt.Errorf("%w: статус %s", ErrReportNotQueued, report.Status)
+	}
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"priority":   priority,
+		"updated_by": updatedBy,
+		"updated_at": now,
+	}
+	if err := s.repository.Update(ctx, id, updates); err != nil {
+		logger.WithError(err).Error("Ошибка обновления приоритета отчета")
+		return nil, fmt.Errorf("ошибка обновления отчета: %w", err)
+	}
+	previous := report.Priority
+	report.Priority = priority
+	report.UpdatedBy = updatedBy
+	report.UpdatedAt = now
+
+	// Задача могла уже начать выполняться: приоритет отчета сохранен, очередь менять не нужно
+	if prioritizer, ok := s.processor.(TaskPrioritizer); ok {
+		err := prioritizer.SetTaskPriority(ctx, reportTaskID(id), taskPriority(priority))
+		if err != nil && !errors.Is(err, ErrTaskNotPending) && !errors.Is(err, ErrTaskNotFound) {
+			logger.WithError(err).Error("Ошибка изменения приоритета задачи в очереди")
+			return nil, fmt.Errorf("ошибка изменения приоритета задачи: %w", err)
+		}
+	}
+
+	logger.WithField("previous", previous).Info("Приоритет отчета изменен")
+	return report, nil
+}
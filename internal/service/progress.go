@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"report_srv/internal/logging"
+)
+
+const (
+	// progressSaveInterval минимальный интервал сохранения числа прочитанных строк
+	progressSaveInterval = 2 * time.Second
+	// progressReadShare доля прогресса, приходящаяся на чтение наборов.
+	// Остаток соответствует сохранению файла в хранилище.
+	progressReadShare = 90
+)
+
+// GenerationProgress ход генерации отчета
+type GenerationProgress struct {
+	// Percent процент выполнения от 0 до 100
+	Percent int
+	// Rows число строк, прочитанных генератором из наборов
+	Rows int64
+}
+
+// ProgressFunc получает ход генерации отчета
+type ProgressFunc func(progress GenerationProgress)
+
+// WithProgress подключает отчет о ходе генерации: генератор сообщает о каждой
+// прочитанной строке, а процент растет по мере завершения наборов.
+// Число строк в наборе заранее неизвестно, поэтому внутри набора растет только счетчик строк.
+func (d *ReportData) WithProgress(report ProgressFunc) *ReportData {
+	tracker := &progressTracker{datasets: len(d.Datasets), report: report}
+	for i := range d.Datasets {
+		d.Datasets[i].Rows = &progressRows{rows: d.Datasets[i].Rows, tracker: tracker}
+	}
+	return d
+}
+
+// progressTracker считает прочитанные строки и завершенные наборы
+type progressTracker struct {
+	datasets int
+	done     int
+	rows     int64
+	report   ProgressFunc
+}
+
+func (t *progressTracker) row() {
+	t.rows++
+	t.notify()
+}
+
+func (t *progressTracker) datasetDone() {
+	t.done++
+	t.notify()
+}
+
+func (t *progressTracker) notify() {
+	percent := progressReadShare
+	if t.datasets > 0 {
+		percent = progressReadShare * t.done / t.datasets
+	}
+	t.report(GenerationProgress{Percent: percent, Rows: t.rows})
+}
+
+// progressRows итератор набора, сообщающий о прочитанных строках
+type progressRows struct {
+	rows     RowIterator
+	tracker  *progressTracker
+	finished bool
+}
+
+// Columns возвращает колонки набора
+func (r *progressRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+// Next возвращает следующую строку набора
+func (r *progressRows) Next() ([]interface{}, error) {
+	row, err := r.rows.Next()
+	switch {
+	case err == nil:
+		r.tracker.row()
+	case err == io.EOF && !r.finished:
+		r.finished = true
+		r.tracker.datasetDone()
+	}
+	return row, err
+}
+
+// Close закрывает исходный набор
+func (r *progressRows) Close() error {
+	if closer, ok := r.rows.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// progressRecorder сохраняет ход генерации в отчете. Процент сохраняется при каждом
+// изменении, число строк - не чаще progressSaveInterval.
+type progressRecorder struct {
+	ctx        context.Context
+	repository ReportRepository
+	reportID   uint
+	logger     logging.Logger
+
+	saved   GenerationProgress
+	savedAt time.Time
+}
+
+// newProgressRecorder создает сохранение хода генерации отчета
+func newProgressRecorder(ctx context.Context, repository ReportRepository, reportID uint, logger logging.Logger) *progressRecorder {
+	return &progressRecorder{
+		ctx:        ctx,
+		repository: repository,
+		reportID:   reportID,
+		logger:     logger,
+		savedAt:    time.Now(),
+	}
+}
+
+// Record сохраняет ход генерации
+func (r *progressRecorder) Record(progress GenerationProgress) {
+	if progress == r.saved {
+		return
+	}
+	if progress.Percent == r.saved.Percent && time.Since(r.savedAt) < progressSaveInterval {
+		return
+	}
+
+	// Ошибка сохранения прогресса не прерывает генерацию
+	if err := r.repository.UpdateProgress(r.ctx, r.reportID, progress.Percent, progress.Rows); err != nil {
+		r.logger.WithError(err).Warn("Ошибка сохранения хода генерации отчета")
+	}
+	r.saved = progress
+	r.savedAt = time.Now()
+}
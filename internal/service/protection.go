@@ -0,0 +1,209 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"report_srv/internal/models"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Ошибки паролей файлов отчетов
+var (
+	// ErrInvalidFilePassword пароль файла в параметрах отчета задан неверно
+	ErrInvalidFilePassword = newCategoryError(ErrValidation, "неверный пароль файла отчета")
+	// ErrPasswordUnsupportedFormat файл формата нельзя зашифровать паролем
+	ErrPasswordUnsupportedFormat = newCategoryError(ErrValidation, "пароль поддерживается только для форматов xlsx, docx и zip")
+)
+
+const (
+	// generatedPasswordLength длина сгенерированного пароля
+	generatedPasswordLength = 16
+	// generatedPasswordAlphabet символы сгенерированного пароля без похожих друг на друга I, l, O, 0 и 1
+	generatedPasswordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+
+	// Шифрование записей ZIP архива по спецификации WinZip AE-2 с ключом AES-256
+	zipMethodAES         = 99
+	zipExtraAES          = 0x9901
+	zipAESVersion        = 2
+	zipAESStrength       = 3
+	zipAESKeySize        = 32
+	zipAESSaltSize       = 16
+	zipAESIterations     = 1000
+	zipAESVerifierSize   = 2
+	zipAESAuthCodeSize   = 10
+	zipFlagEncrypted     = 0x1
+	zipAESExtraBlockSize = 7
+)
+
+// applyFilePassword переносит пароль файла из параметров отчета в FilePassword, чтобы пароль
+// не возвращался вместе с параметрами. Сгенерированный пароль возвращается в GeneratedPassword
+func applyFilePassword(report *models.Report) error {
+	password, generate, err := report.RequestedPassword()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidFilePassword, err)
+	}
+	if password == "" && !generate {
+		delete(report.Parameters, models.ParamPassword)
+		return nil
+	}
+	if !report.Format.SupportsPassword() {
+		return fmt.Errorf("%w, формат отчета: %s", ErrPasswordUnsupportedFormat, report.Format)
+	}
+
+	if generate {
+		if password, err = generateFilePassword(); err != nil {
+			return err
+		}
+		report.GeneratedPassword = password
+		report.PasswordGenerated = true
+	}
+	report.FilePassword = password
+	report.PasswordProtected = true
+	delete(report.Parameters, models.ParamPassword)
+	return nil
+}
+
+// generateFilePassword создает случайный пароль файла
+func generateFilePassword() (string, error) {
+	var builder strings.Builder
+	limit := big.NewInt(int64(len(generatedPasswordAlphabet)))
+	for range generatedPasswordLength {
+		index, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", fmt.Errorf("ошибка генерации пароля: %w", err)
+		}
+		builder.WriteByte(generatedPasswordAlphabet[index.Int64()])
+	}
+	return builder.String(), nil
+}
+
+// protectFile шифрует файл отчета паролем: XLSX и DOCX - шифрованием Office (ECMA-376),
+// ZIP - шифрованием записей AES-256. Файл собирается в памяти целиком
+func protectFile(format models.ReportFormat, reader io.Reader, password string) (io.Reader, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case models.FormatXLSX, models.FormatDOCX:
+		content, err = excelize.Encrypt(content, &excelize.Options{Password: password})
+	case models.FormatZIP:
+		content, err = encryptZip(content, password)
+	default:
+		return nil, fmt.Errorf("%w, формат отчета: %s", ErrPasswordUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка шифрования файла: %w", err)
+	}
+	return bytes.NewReader(content), nil
+}
+
+// encryptZip шифрует записи архива паролем. Сжатое содержимое записей не распаковывается
+func encryptZip(content []byte, password string) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия ZIP архива: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, file := range reader.File {
+		if err := encryptZipEntry(writer, file, password); err != nil {
+			return nil, fmt.Errorf("ошибка шифрования %s: %w", file.Name, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// encryptZipEntry записывает запись архива зашифрованной: соль, значение проверки пароля,
+// зашифрованное сжатое содержимое и код аутентификации HMAC-SHA1
+func encryptZipEntry(writer *zip.Writer, file *zip.File, password string) error {
+	header := file.FileHeader
+	if strings.HasSuffix(header.Name, "/") {
+		_, err := writer.CreateRaw(&header)
+		return err
+	}
+
+	raw, err := file.OpenRaw()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(raw)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, zipAESSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	keys := pbkdf2.Key([]byte(password), salt, zipAESIterations, 2*zipAESKeySize+zipAESVerifierSize, sha1.New)
+	block, err := aes.NewCipher(keys[:zipAESKeySize])
+	if err != nil {
+		return err
+	}
+	encrypted := make([]byte, len(data))
+	zipAESCrypt(block, encrypted, data)
+	mac := hmac.New(sha1.New, keys[zipAESKeySize:2*zipAESKeySize])
+	mac.Write(encrypted)
+
+	// Способ сжатия записи переносится в дополнительное поле AES, CRC в AE-2 не записывается
+	extra := make([]byte, 4+zipAESExtraBlockSize)
+	binary.LittleEndian.PutUint16(extra[0:], zipExtraAES)
+	binary.LittleEndian.PutUint16(extra[2:], zipAESExtraBlockSize)
+	binary.LittleEndian.PutUint16(extra[4:], zipAESVersion)
+	copy(extra[6:], "AE")
+	extra[8] = zipAESStrength
+	binary.LittleEndian.PutUint16(extra[9:], header.Method)
+
+	header.Extra = append(header.Extra, extra...)
+	header.Method = zipMethodAES
+	header.Flags |= zipFlagEncrypted
+	header.CRC32 = 0
+	header.CompressedSize64 = uint64(zipAESSaltSize + zipAESVerifierSize + len(encrypted) + zipAESAuthCodeSize)
+
+	w, err := writer.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+	for _, part := range [][]byte{salt, keys[2*zipAESKeySize:], encrypted, mac.Sum(nil)[:zipAESAuthCodeSize]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipAESCrypt шифрует и расшифровывает данные AES в режиме счетчика WinZip:
+// счетчик начинается с 1 и записывается в блок в порядке little-endian
+func zipAESCrypt(block cipher.Block, dst, src []byte) {
+	counter := make([]byte, aes.BlockSize)
+	stream := make([]byte, aes.BlockSize)
+	var number uint64
+	for offset := 0; offset < len(src); offset += aes.BlockSize {
+		number++
+		binary.LittleEndian.PutUint64(counter, number)
+		block.Encrypt(stream, counter)
+		end := min(offset+aes.BlockSize, len(src))
+		for i := offset; i < end; i++ {
+			dst[i] = src[i] ^ stream[i-offset]
+		}
+	}
+}
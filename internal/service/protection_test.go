@@ -0,0 +1,304 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/crypto/pbkdf2"
+	"gorm.io/gorm"
+)
+
+// recordingMailSender сохраняет все отправленные письма с раскодированным текстом
+type recordingMailSender struct {
+	messages []string
+}
+
+func (s *recordingMailSender) Send(ctx context.Context, from string, to []string, write func(w io.Writer) error) error {
+	var buffer bytes.Buffer
+	if err := write(&buffer); err != nil {
+		return err
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(&buffer))
+	if err != nil {
+		return err
+	}
+	s.messages = append(s.messages, string(body))
+	return nil
+}
+
+// decryptZipEntry расшифровывает запись архива WinZip AES и распаковывает ее содержимое
+func decryptZipEntry(t *testing.T, file *zip.File, password string) []byte {
+	require.Equal(t, uint16(zipMethodAES), file.Method)
+	extra := file.Extra[bytes.Index(file.Extra, []byte{0x01, 0x99}):]
+	method := binary.LittleEndian.Uint16(extra[9:])
+
+	raw, err := file.OpenRaw()
+	require.NoError(t, err)
+	data, err := io.ReadAll(raw)
+	require.NoError(t, err)
+
+	salt := data[:zipAESSaltSize]
+	verifier := data[zipAESSaltSize : zipAESSaltSize+zipAESVerifierSize]
+	encrypted := data[zipAESSaltSize+zipAESVerifierSize : len(data)-zipAESAuthCodeSize]
+	code := data[len(data)-zipAESAuthCodeSize:]
+
+	keys := pbkdf2.Key([]byte(password), salt, zipAESIterations, 2*zipAESKeySize+zipAESVerifierSize, sha1.New)
+	require.Equal(t, keys[2*zipAESKeySize:], verifier, "неверный пароль")
+	mac := hmac.New(sha1.New, keys[zipAESKeySize:2*zipAESKeySize])
+	mac.Write(encrypted)
+	require.Equal(t, mac.Sum(nil)[:zipAESAuthCodeSize], code)
+
+	block, err := aes.NewCipher(keys[:zipAESKeySize])
+	require.NoError(t, err)
+	decrypted := make([]byte, len(encrypted))
+	zipAESCrypt(block, decrypted, encrypted)
+	if method == zip.Store {
+		return decrypted
+	}
+	content, err := io.ReadAll(flate.NewReader(bytes.NewReader(decrypted)))
+	require.NoError(t, err)
+	return content
+}
+
+func TestApplyFilePassword(t *testing.T) {
+	newReport := func(format models.ReportFormat, password interface{}) *models.Report {
+		return &models.Report{Format: format, Parameters: models.JSON{"region": "north", models.ParamPassword: password}}
+	}
+
+	report := newReport(models.FormatXLSX, "s3cret-salary")
+	require.NoError(t, applyFilePassword(report))
+	assert.True(t, report.PasswordProtected)
+	assert.False(t, report.PasswordGenerated)
+	assert.Equal(t, "s3cret-salary", report.FilePassword)
+	assert.Empty(t, report.GeneratedPassword)
+	assert.Equal(t, models.JSON{"region": "north"}, report.Parameters)
+
+	report = newReport(models.FormatZIP, true)
+	require.NoError(t, applyFilePassword(report))
+	assert.True(t, report.PasswordGenerated)
+	assert.Len(t, report.GeneratedPassword, generatedPasswordLength)
+	assert.Equal(t, report.GeneratedPassword, report.FilePassword)
+
+	// Пароль не попадает в JSON отчета, сгенерированный возвращается отдельным полем
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(encoded), report.FilePassword))
+	assert.Contains(t, string(encoded), `"generated_password"`)
+
+	report = newReport(models.FormatXLSX, false)
+	require.NoError(t, applyFilePassword(report))
+	assert.False(t, report.PasswordProtected)
+	assert.NotContains(t, report.Parameters, models.ParamPassword)
+
+	assert.ErrorIs(t, applyFilePassword(newReport(models.FormatXLSX, "short")), ErrInvalidFilePassword)
+	assert.ErrorIs(t, applyFilePassword(newReport(models.FormatXLSX, 42)), ErrInvalidFilePassword)
+	assert.ErrorIs(t, applyFilePassword(newReport(models.FormatCSV, true)), ErrPasswordUnsupportedFormat)
+}
+
+func TestProtectFileZIP(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	files := map[string]string{
+		"report.csv":          strings.Repeat("region;amount\nnorth;10\n", 100),
+		"attachments/":        "",
+		"attachments/doc.txt": "приложение",
+	}
+	for _, name := range []string{"report.csv", "attachments/", "attachments/doc.txt"} {
+		w, err := writer.Create(name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, files[name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	protected, err := protectFile(models.FormatZIP, &buffer, "s3cret-salary")
+	require.NoError(t, err)
+	content, err := io.ReadAll(protected)
+	require.NoError(t, err)
+
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	require.Len(t, reader.File, 3)
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		assert.Equal(t, uint16(zipFlagEncrypted), file.Flags&zipFlagEncrypted)
+		assert.Equal(t, files[file.Name], string(decryptZipEntry(t, file, "s3cret-salary")))
+		assert.NotContains(t, string(content), "north;10")
+	}
+
+	_, err = protectFile(models.FormatCSV, strings.NewReader("a;b"), "s3cret-salary")
+	assert.ErrorIs(t, err, ErrPasswordUnsupportedFormat)
+}
+
+func TestExecutorEncryptsPasswordProtectedReport(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	mockStorage := new(MockStorage)
+	var saved bytes.Buffer
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		io.Copy(&saved, args.Get(2).(io.Reader))
+	})
+
+	repository := NewGormReportRepository(db, logger)
+	service := NewReportService(repository, NewFormatGenerators(logger),
+		NewReportFileStorage(mockStorage, logger), &stubProcessor{}, events.NewInProcessBus(logger), logger)
+	report := &models.Report{
+		Title:      "Зарплаты",
+		Format:     models.FormatXLSX,
+		Parameters: models.JSON{models.ParamPassword: true, models.ParamSnapshot: true},
+		CreatedBy:  "test-user",
+		UpdatedBy:  "test-user",
+	}
+	require.NoError(t, service.CreateReport(ctx, report))
+	password := report.GeneratedPassword
+	require.NotEmpty(t, password)
+
+	stored, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, password, stored.FilePassword)
+	assert.Empty(t, stored.GeneratedPassword)
+	assert.NotContains(t, stored.Parameters, models.ParamPassword)
+
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger).
+		WithSnapshots(SnapshotPolicy{Default: true})
+	require.NoError(t, executor.generateReport(ctx, report.ID))
+
+	// Файл открывается только с паролем, снимок данных в открытом виде не сохраняется
+	_, err = excelize.OpenReader(bytes.NewReader(saved.Bytes()))
+	assert.Error(t, err)
+	f, err := excelize.OpenReader(bytes.NewReader(saved.Bytes()), excelize.Options{Password: password})
+	require.NoError(t, err)
+	defer f.Close()
+	assert.NotEmpty(t, f.GetSheetList())
+	mockStorage.AssertNumberOfCalls(t, "Save", 1)
+
+	stored, err = repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+	assert.Empty(t, stored.SnapshotKey)
+
+	// После шифрования файла пароль в отчете не хранится
+	assert.Empty(t, stored.FilePassword)
+	assertNoStoredPassword(t, db, report.ID, password)
+}
+
+// assertNoStoredPassword проверяет, что ни одна колонка записи отчета не содержит пароль
+func assertNoStoredPassword(t *testing.T, db *gorm.DB, reportID uint, password string) {
+	t.Helper()
+	row := map[string]interface{}{}
+	require.NoError(t, db.Table("reports").Where("id = ?", reportID).Take(&row).Error)
+	require.NotEmpty(t, row)
+	for column, value := range row {
+		assert.NotContains(t, fmt.Sprint(value), password, column)
+	}
+}
+
+func TestExecutorKeepsGeneratedPasswordUntilDelivery(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockStorage.On("GetSize", mock.Anything, mock.Anything).Return(int64(1<<20), nil)
+	mockStorage.On("GetPresignedURL", mock.Anything, mock.Anything, time.Hour).Return("https://files.example.com/salary.xlsx", nil)
+
+	repository := NewGormReportRepository(db, logger)
+	service := NewReportService(repository, NewFormatGenerators(logger),
+		NewReportFileStorage(mockStorage, logger), &stubProcessor{}, events.NewInProcessBus(logger), logger)
+	report := &models.Report{
+		Title:  "Зарплаты",
+		Format: models.FormatXLSX,
+		Parameters: models.JSON{
+			models.ParamPassword:        true,
+			models.ParamEmailRecipients: []interface{}{"hr@example.com"},
+		},
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	require.NoError(t, service.CreateReport(ctx, report))
+	password := report.GeneratedPassword
+
+	// Пароль, который еще нужно отправить получателям, остается до отправки
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger).
+		WithPasswordDelivery()
+	require.NoError(t, executor.generateReport(ctx, report.ID))
+	stored, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, password, stored.FilePassword)
+
+	sender := &recordingMailSender{}
+	cfg := config.SMTP{From: "reports@example.com", MaxAttachmentSize: 1024, LinkExpiration: time.Hour}
+	notifier := NewEmailNotifier(cfg, sender, repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+	require.NoError(t, notifier.Notify(ctx, stored))
+	require.Len(t, sender.messages, 2)
+	assert.Contains(t, sender.messages[1], password)
+
+	assertNoStoredPassword(t, db, report.ID, password)
+}
+
+func TestEmailNotifierSendsGeneratedPasswordSeparately(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+
+	report := &models.Report{
+		Title:             "Зарплаты",
+		Status:            models.StatusCompleted,
+		Format:            models.FormatXLSX,
+		FileKey:           "reports/1/salary.xlsx",
+		Parameters:        models.JSON{models.ParamEmailRecipients: []interface{}{"hr@example.com"}},
+		PasswordProtected: true,
+		PasswordGenerated: true,
+		FilePassword:      "Kq7mZp3xW9aB2cDe",
+		CreatedBy:         "test-user",
+		UpdatedBy:         "test-user",
+	}
+	require.NoError(t, db.Create(report).Error)
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("GetSize", mock.Anything, report.FileKey).Return(int64(1<<20), nil)
+	mockStorage.On("GetPresignedURL", mock.Anything, report.FileKey, time.Hour).Return("https://files.example.com/salary.xlsx", nil)
+
+	sender := &recordingMailSender{}
+	cfg := config.SMTP{From: "reports@example.com", MaxAttachmentSize: 1024, LinkExpiration: time.Hour}
+	notifier := NewEmailNotifier(cfg, sender, NewGormReportRepository(db, logger), NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+	require.NoError(t, notifier.Notify(context.Background(), report))
+
+	require.Len(t, sender.messages, 2)
+	assert.Contains(t, sender.messages[0], "https://files.example.com/salary.xlsx")
+	assert.NotContains(t, sender.messages[0], report.FilePassword)
+	assert.Contains(t, sender.messages[1], report.FilePassword)
+	assert.NotContains(t, sender.messages[1], "https://files.example.com/salary.xlsx")
+	assertNoStoredPassword(t, db, report.ID, report.FilePassword)
+
+	// Пароль, заданный автором отчета, не рассылается
+	report.PasswordGenerated = false
+	sender.messages = nil
+	require.NoError(t, notifier.Notify(context.Background(), report))
+	assert.Len(t, sender.messages, 1)
+}
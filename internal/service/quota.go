@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidQuota лимиты пользователя не прошли проверку
+	ErrInvalidQuota = newCategoryError(ErrValidation, "некорректные лимиты пользователя")
+	// ErrQuotaNotFound лимиты пользователю не задавались
+	ErrQuotaNotFound = newCategoryError(ErrNotFound, "лимиты пользователя не заданы")
+)
+
+// QuotaLimit вид лимита пользователя
+type QuotaLimit string
+
+const (
+	// QuotaConcurrent число отчетов в очереди и в генерации
+	QuotaConcurrent QuotaLimit = "max_concurrent"
+	// QuotaReportsPerDay число отчетов, созданных за сутки (UTC)
+	QuotaReportsPerDay QuotaLimit = "max_reports_per_day"
+	// QuotaStoredBytes суммарный размер хранимых файлов отчетов
+	QuotaStoredBytes QuotaLimit = "max_stored_bytes"
+)
+
+// QuotaExceededError ошибка превышения лимита пользователя
+type QuotaExceededError struct {
+	Subject string     `json:"subject"`
+	Limit   QuotaLimit `json:"limit"`
+	Max     int64      `json:"max"`
+	Current int64      `json:"current"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %s %d из %d", ErrQuotaExceeded, e.Limit, e.Current, e.Max)
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Temporary возвращает true, если лимит освободится со временем без действий пользователя:
+// после завершения генерации или в следующие сутки
+func (e *QuotaExceededError) Temporary() bool {
+	return e.Limit != QuotaStoredBytes
+}
+
+// QuotaLimits лимиты пользователя, 0 - без ограничения
+type QuotaLimits struct {
+	MaxConcurrent    int   `json:"max_concurrent"`
+	MaxReportsPerDay int   `json:"max_reports_per_day"`
+	MaxStoredBytes   int64 `json:"max_stored_bytes"`
+}
+
+// NewQuotaLimits создает лимиты по умолчанию из конфигурации
+func NewQuotaLimits(cfg config.Quotas) QuotaLimits {
+	return QuotaLimits{
+		MaxConcurrent:    cfg.MaxConcurrent,
+		MaxReportsPerDay: cfg.MaxReportsPerDay,
+		MaxStoredBytes:   cfg.MaxStoredBytes,
+	}
+}
+
+// With возвращает лимиты, переопределенные лимитами пользователя
+func (l QuotaLimits) With(quota *models.Quota) QuotaLimits {
+	if quota == nil {
+		return l
+	}
+	if quota.MaxConcurrent != nil {
+		l.MaxConcurrent = *quota.MaxConcurrent
+	}
+	if quota.MaxReportsPerDay != nil {
+		l.MaxReportsPerDay = *quota.MaxReportsPerDay
+	}
+	if quota.MaxStoredBytes != nil {
+		l.MaxStoredBytes = *quota.MaxStoredBytes
+	}
+	return l
+}
+
+// QuotaUsage использование лимитов пользователем
+type QuotaUsage struct {
+	Concurrent   int64 `json:"concurrent"`
+	ReportsToday int64 `json:"reports_today"`
+	StoredBytes  int64 `json:"stored_bytes"`
+}
+
+// QuotaStatus лимиты пользователя и их использование
+type QuotaStatus struct {
+	Subject string `json:"subject"`
+	// Limits действующие лимиты с учетом переопределения
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+	// Override лимиты, заданные пользователю через API, nil - действуют лимиты по умолчанию
+	Override *models.Quota `json:"override,omitempty"`
+}
+
+// QuotaList лимиты по умолчанию и пользователи с переопределенными лимитами
+type QuotaList struct {
+	Defaults QuotaLimits    `json:"defaults"`
+	Quotas   []models.Quota `json:"quotas"`
+}
+
+// QuotaChecker проверяет лимиты пользователя перед созданием отчета
+type QuotaChecker interface {
+	Check(ctx context.Context, subject string) error
+}
+
+// QuotaService интерфейс для проверки и настройки лимитов пользователей
+type QuotaService interface {
+	QuotaChecker
+	ListQuotas(ctx context.Context) (*QuotaList, error)
+	GetQuota(ctx context.Context, subject string) (*QuotaStatus, error)
+	SetQuota(ctx context.Context, quota *models.Quota) (*QuotaStatus, error)
+	DeleteQuota(ctx context.Context, subject string) error
+}
+
+// QuotaRepository интерфейс для работы с лимитами пользователей в базе данных
+type QuotaRepository interface {
+	Get(ctx context.Context, subject string) (*models.Quota, error)
+	List(ctx context.Context) ([]models.Quota, error)
+	Save(ctx context.Context, quota *models.Quota) error
+	Delete(ctx context.Context, subject string) error
+	// Usage считает использование лимитов; отчеты за сутки считаются с since
+	Usage(ctx context.Context, subject string, since time.Time) (QuotaUsage, error)
+}
+
+// GormQuotaRepository реализация QuotaRepository с использованием GORM
+type GormQuotaRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormQuotaRepository создает новый репозиторий лимитов пользователей
+func NewGormQuotaRepository(db *gorm.DB, logger logging.Logger) QuotaRepository {
+	return &GormQuotaRepository{db: db, logger: logger}
+}
+
+// Get возвращает лимиты пользователя
+func (r *GormQuotaRepository) Get(ctx context.Context, subject string) (*models.Quota, error) {
+	var quota models.Quota
+	if err := r.db.WithContext(ctx).Where("subject = ?", subject).First(&quota).Error; err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// List возвращает пользователей с переопределенными лимитами
+func (r *GormQuotaRepository) List(ctx context.Context) ([]models.Quota, error) {
+	var quotas []models.Quota
+	if err := r.db.WithContext(ctx).Order("subject").Find(&quotas).Error; err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
+
+// Save создает или заменяет лимиты пользователя
+func (r *GormQuotaRepository) Save(ctx context.Context, quota *models.Quota) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_concurrent", "max_reports_per_day", "max_stored_bytes", "updated_by", "updated_at"}),
+	}).Create(quota).Error
+}
+
+// Delete удаляет лимиты пользователя
+func (r *GormQuotaRepository) Delete(ctx context.Context, subject string) error {
+	result := r.db.WithContext(ctx).Where("subject = ?", subject).Delete(&models.Quota{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Usage считает отчеты пользователя в генерации, созданные с since и размер хранимых файлов
+func (r *GormQuotaRepository) Usage(ctx context.Context, subject string, since time.Time) (QuotaUsage, error) {
+	var usage QuotaUsage
+	reports := func() *gorm.DB {
+		return r.db.WithContext(ctx).Model(&models.Report{}).Where("created_by = ?", subject)
+	}
+
+	if err := reports().Where("status IN ?", []models.ReportStatus{models.StatusPending, models.StatusProcessing}).
+		Count(&usage.Concurrent).Error; err != nil {
+		return usage, err
+	}
+	// Удаленные за сутки отчеты тоже учитываются, иначе удаление обходило бы лимит
+	if err := reports().Unscoped().Where("created_at >= ?", since).Count(&usage.ReportsToday).Error; err != nil {
+		return usage, err
+	}
+	if err := reports().Select("COALESCE(SUM(file_size), 0)").Scan(&usage.StoredBytes).Error; err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
+
+// QuotaServiceImpl реализация сервиса лимитов пользователей. Лимиты проверяются
+// перед созданием отчета, поэтому одновременные запросы могут немного их превысить.
+type QuotaServiceImpl struct {
+	repository QuotaRepository
+	defaults   QuotaLimits
+	logger     logging.Logger
+	now        func() time.Time
+}
+
+// NewQuotaService создает новый сервис лимитов пользователей
+func NewQuotaService(repository QuotaRepository, defaults QuotaLimits, logger logging.Logger) *QuotaServiceImpl {
+	return &QuotaServiceImpl{
+		repository: repository,
+		defaults:   defaults,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// NewQuotaServiceFromConfig создает сервис лимитов пользователей с лимитами по умолчанию из конфигурации
+func NewQuotaServiceFromConfig(cfg config.Config, db *gorm.DB, logger logging.Logger) QuotaService {
+	return NewQuotaService(NewGormQuotaRepository(db, logger), NewQuotaLimits(cfg.Quotas), logger)
+}
+
+// Check проверяет, что пользователь может создать еще один отчет
+func (s *QuotaServiceImpl) Check(ctx context.Context, subject string) error {
+	override, err := s.override(ctx, subject)
+	if err != nil {
+		return err
+	}
+	limits := s.defaults.With(override)
+	if limits == (QuotaLimits{}) {
+		return nil
+	}
+
+	usage, err := s.usage(ctx, subject)
+	if err != nil {
+		return err
+	}
+
+	checks := []struct {
+		limit   QuotaLimit
+		max     int64
+		current int64
+	}{
+		{QuotaConcurrent, int64(limits.MaxConcurrent), usage.Concurrent},
+		{QuotaReportsPerDay, int64(limits.MaxReportsPerDay), usage.ReportsToday},
+		{QuotaStoredBytes, limits.MaxStoredBytes, usage.StoredBytes},
+	}
+	for _, check := range checks {
+		if check.max > 0 && check.current >= check.max {
+			logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+				"subject": subject,
+				"limit":   check.limit,
+				"max":     check.max,
+				"current": check.current,
+			}).Warn("Лимит пользователя исчерпан")
+			return &QuotaExceededError{Subject: subject, Limit: check.limit, Max: check.max, Current: check.current}
+		}
+	}
+	return nil
+}
+
+// ListQuotas возвращает лимиты по умолчанию и пользователей с переопределенными лимитами
+func (s *QuotaServiceImpl) ListQuotas(ctx context.Context) (*QuotaList, error) {
+	quotas, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения лимитов пользователей: %w", err)
+	}
+	return &QuotaList{Defaults: s.defaults, Quotas: quotas}, nil
+}
+
+// GetQuota возвращает действующие лимиты пользователя и их использование
+func (s *QuotaServiceImpl) GetQuota(ctx context.Context, subject string) (*QuotaStatus, error) {
+	override, err := s.override(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.usage(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuotaStatus{
+		Subject:  subject,
+		Limits:   s.defaults.With(override),
+		Usage:    usage,
+		Override: override,
+	}, nil
+}
+
+// override возвращает лимиты, заданные пользователю, или nil
+func (s *QuotaServiceImpl) override(ctx context.Context, subject string) (*models.Quota, error) {
+	quota, err := s.repository.Get(ctx, subject)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("ошибка получения лимитов пользователя: %w", err)
+	}
+	return quota, nil
+}
+
+// usage считает использование лимитов пользователем, сутки отсчитываются с полуночи UTC
+func (s *QuotaServiceImpl) usage(ctx context.Context, subject string) (QuotaUsage, error) {
+	now := s.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	usage, err := s.repository.Usage(ctx, subject, day)
+	if err != nil {
+		return usage, fmt.Errorf("ошибка подсчета использования лимитов: %w", err)
+	}
+	return usage, nil
+}
+
+// SetQuota задает лимиты пользователя. Незаданные лимиты берутся из настроек по умолчанию.
+func (s *QuotaServiceImpl) SetQuota(ctx context.Context, quota *models.Quota) (*QuotaStatus, error) {
+	quota.UpdatedBy = actorOr(ctx, quota.UpdatedBy)
+	if err := quota.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuota, err)
+	}
+	if err := s.repository.Save(ctx, quota); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения лимитов пользователя: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"subject":    quota.Subject,
+		"updated_by": quota.UpdatedBy,
+	}).Info("Лимиты пользователя изменены")
+
+	return s.GetQuota(ctx, quota.Subject)
+}
+
+// DeleteQuota удаляет лимиты пользователя, после чего действуют лимиты по умолчанию
+func (s *QuotaServiceImpl) DeleteQuota(ctx context.Context, subject string) error {
+	if err := s.repository.Delete(ctx, subject); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrQuotaNotFound, subject)
+		}
+		return fmt.Errorf("ошибка удаления лимитов пользователя: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithField("subject", subject).Info("Лимиты пользователя сброшены")
+	return nil
+}
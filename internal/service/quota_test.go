@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaServiceLimitsReports(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Quota{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	quotas := NewQuotaService(NewGormQuotaRepository(db, logger), QuotaLimits{MaxConcurrent: 2}, logger)
+	service := NewReportService(NewGormReportRepository(db, logger), NewFormatGenerators(logger),
+		NewReportFileStorage(new(MockStorage), logger), &stubProcessor{}, events.NewInProcessBus(logger), logger).WithQuotas(quotas)
+
+	newReport := func(user string) *models.Report {
+		return &models.Report{Title: "Report", Format: models.FormatCSV, CreatedBy: user, UpdatedBy: user}
+	}
+
+	// Отчеты остаются в очереди, третий превышает лимит одновременных отчетов
+	require.NoError(t, service.CreateReport(ctx, newReport("alice")))
+	require.NoError(t, service.CreateReport(ctx, newReport("alice")))
+	err := service.CreateReport(ctx, newReport("alice"))
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, QuotaConcurrent, quotaErr.Limit)
+	assert.True(t, quotaErr.Temporary())
+	require.NoError(t, service.CreateReport(ctx, newReport("bob")))
+
+	// Лимиты пользователя переопределяют лимиты по умолчанию
+	unlimited, daily := 0, 3
+	status, err := quotas.SetQuota(ctx, &models.Quota{Subject: "alice", MaxConcurrent: &unlimited, MaxReportsPerDay: &daily, UpdatedBy: "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, QuotaLimits{MaxReportsPerDay: 3}, status.Limits)
+	assert.Equal(t, int64(2), status.Usage.ReportsToday)
+
+	require.NoError(t, service.CreateReport(ctx, newReport("alice")))
+	err = service.CreateReport(ctx, newReport("alice"))
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, QuotaReportsPerDay, quotaErr.Limit)
+
+	// На следующие сутки лимит снова доступен
+	quotas.now = func() time.Time { return time.Now().Add(24 * time.Hour) }
+	require.NoError(t, quotas.Check(ctx, "alice"))
+
+	// Размер хранимых файлов
+	stored := int64(100)
+	_, err = quotas.SetQuota(ctx, &models.Quota{Subject: "bob", MaxStoredBytes: &stored, UpdatedBy: "admin"})
+	require.NoError(t, err)
+	require.NoError(t, db.Model(&models.Report{}).Where("created_by = ?", "bob").Update("file_size", 150).Error)
+	err = quotas.Check(ctx, "bob")
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, QuotaStoredBytes, quotaErr.Limit)
+	assert.False(t, quotaErr.Temporary())
+
+	list, err := quotas.ListQuotas(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list.Quotas, 2)
+
+	require.NoError(t, quotas.DeleteQuota(ctx, "bob"))
+	assert.ErrorIs(t, quotas.DeleteQuota(ctx, "bob"), ErrQuotaNotFound)
+	require.NoError(t, quotas.Check(ctx, "bob"))
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Действия с отчетами, генерация которых прервалась
+	RecoveryActionRequeue = "requeue"
+	RecoveryActionFail    = "fail"
+
+	// reportHeartbeatInterval период обновления heartbeat выполняющейся генерации
+	reportHeartbeatInterval = 30 * time.Second
+
+	// Значения по умолчанию для восстановления прерванных отчетов
+	defaultRecoveryStaleAfter = 5 * time.Minute
+	defaultRecoveryInterval   = time.Minute
+
+	// Максимальное число отчетов, восстанавливаемых за один проход
+	recoveryBatchSize = 100
+)
+
+// errGenerationInterrupted генерация прервана остановкой экземпляра сервиса
+var errGenerationInterrupted = errors.New("генерация прервана: экземпляр сервиса остановился во время генерации")
+
+// ReportRecovery находит отчеты, генерация которых прервалась падением или перезапуском
+// экземпляра сервиса, и повторяет их генерацию или помечает failed.
+// Прерванной считается генерация, heartbeat которой не обновлялся дольше порога.
+type ReportRecovery struct {
+	repository  ReportRepository
+	processor   BackgroundProcessor
+	publisher   events.Publisher
+	deadLetters DeadLetterRepository
+	staleAfter  time.Duration
+	interval    time.Duration
+	action      string
+	maxAttempts int
+	logger      logging.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewReportRecovery создает восстановление прерванных отчетов
+func NewReportRecovery(
+	cfg config.Recovery,
+	repository ReportRepository,
+	processor BackgroundProcessor,
+	publisher events.Publisher,
+	logger logging.Logger,
+) *ReportRecovery {
+	staleAfter := cfg.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultRecoveryStaleAfter
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultRecoveryInterval
+	}
+	action := cfg.Action
+	if action == "" {
+		action = RecoveryActionRequeue
+	}
+
+	return &ReportRecovery{
+		repository:  repository,
+		processor:   processor,
+		publisher:   publisher,
+		staleAfter:  staleAfter,
+		interval:    interval,
+		action:      action,
+		maxAttempts: cfg.MaxAttempts,
+		logger:      logger,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// NewReportRecoveryFromConfig создает восстановление прерванных отчетов с репозиторием из конфигурации
+func NewReportRecoveryFromConfig(
+	cfg config.Config,
+	db *gorm.DB,
+	processor BackgroundProcessor,
+	bus events.Bus,
+	logger logging.Logger,
+) *ReportRecovery {
+	return NewReportRecovery(cfg.Recovery, NewGormReportRepository(db, logger), processor, bus, logger).
+		WithDeadLetters(NewGormDeadLetterRepository(db, logger))
+}
+
+// WithDeadLetters подключает хранилище задач, исчерпавших попытки: в него попадают отчеты,
+// генерация которых прерывалась больше допустимого числа раз
+func (r *ReportRecovery) WithDeadLetters(deadLetters DeadLetterRepository) *ReportRecovery {
+	r.deadLetters = deadLetters
+	return r
+}
+
+// Start запускает проверку прерванных отчетов: сразу и затем периодически
+func (r *ReportRecovery) Start() {
+	r.logger.WithFields(logging.Fields{
+		"stale_after": r.staleAfter,
+		"action":      r.action,
+	}).Info("Запуск восстановления прерванных отчетов")
+	go r.loop()
+}
+
+// Stop останавливает проверку прерванных отчетов
+func (r *ReportRecovery) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	select {
+	case <-r.done:
+		r.logger.Info("Восстановление прерванных отчетов остановлено")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop основной цикл проверки
+func (r *ReportRecovery) loop() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+		r.Recover(ctx, time.Now().UTC())
+		cancel()
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Recover обрабатывает отчеты, генерация которых прервалась к моменту now, и возвращает их число
+func (r *ReportRecovery) Recover(ctx context.Context, now time.Time) int {
+	before := now.Add(-r.staleAfter)
+
+	reports, err := r.repository.ListStale(ctx, before, recoveryBatchSize)
+	if err != nil {
+		r.logger.WithError(err).Error("Ошибка получения прерванных отчетов")
+		return 0
+	}
+
+	recovered := 0
+	for i := range reports {
+		if ctx.Err() != nil {
+			break
+		}
+		ok, err := r.recover(ctx, &reports[i], before)
+		if err != nil {
+			r.logger.WithError(err).WithField("report_id", reports[i].ID).Error("Ошибка восстановления прерванного отчета")
+			continue
+		}
+		if ok {
+			recovered++
+		}
+	}
+
+	if recovered > 0 {
+		r.logger.WithField("count", recovered).Info("Прерванные отчеты восстановлены")
+	}
+	return recovered
+}
+
+// recover перезапускает генерацию прерванного отчета или помечает его failed.
+// Возвращает false, если отчет восстанавливать не нужно.
+func (r *ReportRecovery) recover(ctx context.Context, report *models.Report, before time.Time) (bool, error) {
+	logger := r.logger.WithFields(logging.Fields{
+		"report_id":  report.ID,
+		"recoveries": report.Recoveries,
+	})
+
+	// Задачу, которую процессор еще ведет, он повторит сам после истечения аренды
+	switch r.processor.GetTaskStatus(reportTaskID(report.ID)) {
+	case TaskStatusPending, TaskStatusRunning:
+		return false, nil
+	}
+
+	claimed, err := r.repository.ClaimStale(ctx, report.ID, before)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	if r.action == RecoveryActionFail || report.Recoveries >= r.maxAttempts {
+		logger.Warn("Генерация отчета прервана, отчет помечен failed")
+		if err := failReport(ctx, r.repository, r.publisher, logger, report.ID, errGenerationInterrupted); err != nil {
+			return true, err
+		}
+		if r.action == RecoveryActionRequeue {
+			saveDeadLetter(ctx, r.deadLetters, logger,
+				newDeadLetter(newReportTask(ctx, report), report.ID, report.Recoveries+1, errGenerationInterrupted))
+		}
+		return true, nil
+	}
+
+	if err := r.processor.SubmitTask(ctx, newReportTask(ctx, report)); err != nil {
+		logger.WithError(err).Error("Ошибка повторного запуска прерванной генерации")
+		return true, failReport(ctx, r.repository, r.publisher, logger, report.ID, err)
+	}
+
+	logger.Warn("Генерация отчета прервана, отчет поставлен в очередь повторно")
+	return true, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingProcessor процессор, запоминающий поставленные задачи
+type recordingProcessor struct {
+	stubProcessor
+	submitted []Task
+	statuses  map[string]TaskStatus
+}
+
+func (p *recordingProcessor) SubmitTask(ctx context.Context, task Task) error {
+	p.submitted = append(p.submitted, task)
+	return nil
+}
+
+func (p *recordingProcessor) GetTaskStatus(taskID string) TaskStatus {
+	if status, exists := p.statuses[taskID]; exists {
+		return status
+	}
+	return TaskStatusUnknown
+}
+
+func TestReportRecoveryRequeuesStaleReports(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.DeadLetter{}))
+	logger := setupTestLogger()
+	repository := NewGormReportRepository(db, logger)
+	deadLetters := NewGormDeadLetterRepository(db, logger)
+	now := time.Now().UTC()
+
+	createProcessing := func(heartbeatAt time.Time, recoveries int) *models.Report {
+		report := &models.Report{Title: "Report", Status: models.StatusProcessing, HeartbeatAt: &heartbeatAt,
+			Recoveries: recoveries, CreatedBy: "test-user", UpdatedBy: "test-user"}
+		require.NoError(t, db.Create(report).Error)
+		return report
+	}
+	stale := createProcessing(now.Add(-10*time.Minute), 0)
+	alive := createProcessing(now.Add(-time.Minute), 0)
+	exhausted := createProcessing(now.Add(-10*time.Minute), 3)
+	tracked := createProcessing(now.Add(-10*time.Minute), 0)
+
+	processor := &recordingProcessor{statuses: map[string]TaskStatus{reportTaskID(tracked.ID): TaskStatusRunning}}
+	recovery := NewReportRecovery(config.Recovery{StaleAfter: 5 * time.Minute, MaxAttempts: 3},
+		repository, processor, events.NopPublisher{}, logger).WithDeadLetters(deadLetters)
+
+	assert.Equal(t, 2, recovery.Recover(context.Background(), now))
+
+	require.Len(t, processor.submitted, 1)
+	assert.Equal(t, reportTaskID(stale.ID), processor.submitted[0].ID)
+
+	report, err := repository.GetByID(context.Background(), stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, report.Status)
+	assert.Equal(t, 1, report.Recoveries)
+	assert.Nil(t, report.HeartbeatAt)
+
+	report, err = repository.GetByID(context.Background(), exhausted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusFailed, report.Status)
+	assert.Equal(t, models.ErrorCodeInternal, report.ErrorCode)
+
+	// Отчет, генерация которого прерывалась больше допустимого, сохраняется для повторного запуска
+	letters, _, err := deadLetters.List(context.Background(), DeadLetterListParams{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, exhausted.ID, letters[0].ReportID)
+	assert.Equal(t, 4, letters[0].Attempts)
+
+	for _, id := range []uint{alive.ID, tracked.ID} {
+		report, err = repository.GetByID(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusProcessing, report.Status)
+	}
+
+	// Повторный проход не находит уже восстановленные отчеты
+	assert.Equal(t, 0, recovery.Recover(context.Background(), now))
+}
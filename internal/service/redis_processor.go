@@ -0,0 +1,949 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Период опроса очередей и переноса отложенных задач
+	defaultRedisPollInterval = time.Second
+
+	// Запас времени сверх таймаута задачи, после которого задача считается потерянной
+	redisLeaseGrace = time.Minute
+
+	// Время хранения завершенных задач
+	redisFinishedTaskTTL = 7 * 24 * time.Hour
+
+	// Максимальная задержка перед повторной попыткой
+	maxRedisRetryDelay = 10 * time.Minute
+
+	// Время, после которого экземпляр без отметки о своих обработчиках считается остановленным
+	redisWorkersTTL = 30 * time.Second
+)
+
+// dequeueScript атомарно забирает задачу из очередей в порядке приоритета
+// и помещает ее в набор выполняемых с крайним сроком аренды.
+// Из приостановленной очереди задачи не забираются.
+// KEYS[1] - набор выполняемых задач, KEYS[2..] - очереди от высшего приоритета к низшему.
+// ARGV[1] - текущее время в мс, ARGV[2] - запас аренды в мс, ARGV[3] - префикс ключей задач,
+// ARGV[4] - ключ признака приостановки очереди.
+var dequeueScript = redis.NewScript(`
+if redis.call('EXISTS', ARGV[4]) == 1 then
+	return false
+end
+for i = 2, #KEYS do
+	local id = redis.call('RPOP', KEYS[i])
+	while id do
+		local key = ARGV[3] .. id
+		if redis.call('HGET', key, 'status') == 'pending' then
+			local timeout = tonumber(redis.call('HGET', key, 'timeout_ms')) or 0
+			redis.call('ZADD', KEYS[1], tonumber(ARGV[1]) + timeout + tonumber(ARGV[2]), id)
+			redis.call('HSET', key, 'status', 'running', 'started_at', ARGV[1], 'updated_at', ARGV[1])
+			return {id, redis.call('HGET', key, 'payload'), redis.call('HGET', key, 'attempts')}
+		end
+		id = redis.call('RPOP', KEYS[i])
+	end
+end
+return false
+`)
+
+// requeueScript возвращает в очереди задачи из набора, срок которых наступил.
+// Используется для отложенных повторов и для восстановления задач после падения обработчика.
+// KEYS[1] - набор задач, ARGV[1] - текущее время в мс, ARGV[2] - префикс ключей задач,
+// ARGV[3] - префикс очередей, ARGV[4] - максимальное число задач.
+var requeueScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[4]))
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local key = ARGV[2] .. id
+	local status = redis.call('HGET', key, 'status')
+	if status == 'pending' or status == 'running' then
+		local priority = redis.call('HGET', key, 'priority') or '1'
+		redis.call('HSET', key, 'status', 'pending', 'queued_at', ARGV[1], 'updated_at', ARGV[1])
+		redis.call('LPUSH', ARGV[3] .. priority, id)
+	end
+end
+return #ids
+`)
+
+// agingScript повышает на один уровень приоритет задач, ожидающих в очереди дольше срока старения,
+// чтобы задачи низкого приоритета не ждали бесконечно. Очередь просматривается с самой старой задачи.
+// ARGV[1] - текущее время в мс, ARGV[2] - срок старения в мс, ARGV[3] - префикс ключей задач,
+// ARGV[4] - префикс очередей, ARGV[5] - наибольший приоритет, до которого повышаются задачи,
+// ARGV[6] - максимальное число задач одной очереди за проход.
+var agingScript = redis.NewScript(`
+local promoted = 0
+local deadline = tonumber(ARGV[1]) - tonumber(ARGV[2])
+for priority = 0, tonumber(ARGV[5]) - 1 do
+	local queue = ARGV[4] .. priority
+	for _ = 1, tonumber(ARGV[6]) do
+		local id = redis.call('LINDEX', queue, -1)
+		if not id then
+			break
+		end
+		local key = ARGV[3] .. id
+		local queued = tonumber(redis.call('HGET', key, 'queued_at') or redis.call('HGET', key, 'created_at')) or 0
+		if queued > deadline then
+			break
+		end
+		redis.call('RPOP', queue)
+		if redis.call('HGET', key, 'status') == 'pending' then
+			redis.call('HSET', key, 'priority', priority + 1, 'queued_at', ARGV[1], 'updated_at', ARGV[1])
+			redis.call('LPUSH', ARGV[4] .. (priority + 1), id)
+			promoted = promoted + 1
+		end
+	end
+end
+return promoted
+`)
+
+// prioritizeScript меняет приоритет ожидающей задачи и переносит ее в очередь нового приоритета.
+// Задача, ожидающая повтора, попадет в новую очередь при возврате из набора повторов.
+// KEYS[1] - ключ задачи, ARGV[1] - новый приоритет, ARGV[2] - префикс очередей,
+// ARGV[3] - ID задачи, ARGV[4] - текущее время в мс. Возвращает статус задачи.
+var prioritizeScript = redis.NewScript(`
+local status = redis.call('HGET', KEYS[1], 'status')
+if not status or status ~= 'pending' then
+	return status
+end
+local previous = redis.call('HGET', KEYS[1], 'priority') or '1'
+redis.call('HSET', KEYS[1], 'priority', ARGV[1], 'updated_at', ARGV[4])
+if redis.call('LREM', ARGV[2] .. previous, 0, ARGV[3]) > 0 then
+	redis.call('HSET', KEYS[1], 'queued_at', ARGV[4])
+	redis.call('LPUSH', ARGV[2] .. ARGV[1], ARGV[3])
+end
+return status
+`)
+
+// RedisProcessorOptions параметры Redis процессора
+type RedisProcessorOptions struct {
+	// Prefix префикс всех ключей процессора
+	Prefix string
+	// Concurrency число одновременно выполняемых задач
+	Concurrency int
+	// MaxRetries число повторных попыток после первой неудачи
+	MaxRetries int
+	// PollInterval период опроса очередей
+	PollInterval time.Duration
+	// ReservedWorkers число обработчиков, которые выполняют только задачи приоритета high и critical,
+	// чтобы срочные отчеты не ждали освобождения обработчиков, занятых обычными
+	ReservedWorkers int
+	// PriorityAging срок ожидания в очереди, после которого приоритет задачи повышается на уровень
+	// (не выше high). 0 - приоритет не повышается
+	PriorityAging time.Duration
+}
+
+// redisTaskPayload сериализованное представление задачи
+type redisTaskPayload struct {
+	ID        string            `json:"id"`
+	Type      TaskType          `json:"type"`
+	Data      json.RawMessage   `json:"data"`
+	Priority  Priority          `json:"priority"`
+	Timeout   time.Duration     `json:"timeout"`
+	Trace     map[string]string `json:"trace,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+// RedisBackgroundProcessor фоновый процессор с очередью задач в Redis.
+// Задачи переживают перезапуск сервиса, выполняются с учетом приоритета
+// и повторяются с экспоненциальной задержкой при ошибках.
+type RedisBackgroundProcessor struct {
+	client   redis.UniversalClient
+	executor *ReportTaskExecutor
+	logger   logging.Logger
+	options  RedisProcessorOptions
+
+	cancellations sync.Map // map[string]context.CancelFunc
+
+	// instanceID отличает обработчики этого экземпляра сервиса в сведениях об очереди
+	instanceID string
+	busy       atomic.Int64
+
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewRedisBackgroundProcessor создает новый Redis процессор
+func NewRedisBackgroundProcessor(
+	client redis.UniversalClient,
+	executor *ReportTaskExecutor,
+	options RedisProcessorOptions,
+	logger logging.Logger,
+) *RedisBackgroundProcessor {
+	if options.Prefix == "" {
+		options.Prefix = "report_srv"
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = maxConcurrentGeneration
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = maxRetryAttempts
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultRedisPollInterval
+	}
+	// Хотя бы один обработчик выполняет задачи любого приоритета
+	if options.ReservedWorkers >= options.Concurrency {
+		options.ReservedWorkers = options.Concurrency - 1
+	}
+	if options.ReservedWorkers < 0 {
+		options.ReservedWorkers = 0
+	}
+
+	return &RedisBackgroundProcessor{
+		client:     client,
+		executor:   executor,
+		logger:     logger,
+		options:    options,
+		instanceID: newInstanceID(),
+		stop:       make(chan struct{}),
+	}
+}
+
+// newInstanceID создает случайный ID экземпляра процессора
+func newInstanceID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// NewRedisBackgroundProcessorFromConfig создает Redis процессор по настройкам приложения
+func NewRedisBackgroundProcessorFromConfig(
+	cfg config.Config,
+	executor *ReportTaskExecutor,
+	logger logging.Logger,
+) *RedisBackgroundProcessor {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Address,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+
+	return NewRedisBackgroundProcessor(client, executor, RedisProcessorOptions{
+		Prefix:          cfg.Processor.QueuePrefix,
+		Concurrency:     cfg.Processor.Concurrency,
+		MaxRetries:      cfg.Processor.MaxRetries,
+		ReservedWorkers: reservedWorkers(cfg.Processor.Concurrency, cfg.Processor.ReservedShare),
+		PriorityAging:   cfg.Processor.PriorityAging,
+	}, logger)
+}
+
+// reservedWorkers возвращает число обработчиков для срочных задач по их доле. Ненулевая доля
+// резервирует хотя бы один обработчик
+func reservedWorkers(concurrency int, share float64) int {
+	if share <= 0 || concurrency <= 1 {
+		return 0
+	}
+	reserved := int(float64(concurrency) * share)
+	if reserved < 1 {
+		reserved = 1
+	}
+	return reserved
+}
+
+// SubmitTask сохраняет задачу в Redis и ставит ее в очередь
+func (p *RedisBackgroundProcessor) SubmitTask(ctx context.Context, task Task) error {
+	data, err := json.Marshal(task.Data)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации данных задачи: %w", err)
+	}
+
+	payload, err := json.Marshal(redisTaskPayload{
+		ID:        task.ID,
+		Type:      task.Type,
+		Data:      data,
+		Priority:  task.Priority,
+		Timeout:   task.Timeout,
+		Trace:     task.Trace,
+		RequestID: task.RequestID,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации задачи: %w", err)
+	}
+
+	priority := clampPriority(task.Priority)
+	now := time.Now().UTC()
+
+	_, err = p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, p.taskKey(task.ID))
+		pipe.HSet(ctx, p.taskKey(task.ID), map[string]interface{}{
+			"payload":    payload,
+			"status":     string(TaskStatusPending),
+			"priority":   int(priority),
+			"timeout_ms": task.Timeout.Milliseconds(),
+			"attempts":   0,
+			"created_at": now.UnixMilli(),
+			"queued_at":  now.UnixMilli(),
+			"updated_at": now.UnixMilli(),
+		})
+		pipe.LPush(ctx, p.queueKey(priority), task.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка постановки задачи в очередь: %w", err)
+	}
+
+	p.logger.WithFields(logging.Fields{
+		"task_id":  task.ID,
+		"priority": priority,
+	}).Debug("Задача поставлена в очередь Redis")
+
+	return nil
+}
+
+// CancelTask отменяет задачу в очереди или выполняющуюся на любом экземпляре сервиса
+func (p *RedisBackgroundProcessor) CancelTask(taskID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultContextTimeout)
+	defer cancel()
+
+	status, err := p.client.HGet(ctx, p.taskKey(taskID), "status").Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+		}
+		return fmt.Errorf("ошибка получения статуса задачи: %w", err)
+	}
+
+	if TaskStatus(status).IsFinished() {
+		return fmt.Errorf("%w: %s со статусом %s", ErrTaskFinished, taskID, status)
+	}
+
+	now := time.Now().UTC().UnixMilli()
+	_, err = p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, p.taskKey(taskID), "status", string(TaskStatusCanceled), "finished_at", now, "updated_at", now)
+		pipe.Expire(ctx, p.taskKey(taskID), redisFinishedTaskTTL)
+		pipe.ZRem(ctx, p.retryKey(), taskID)
+		for _, priority := range queuePriorities() {
+			pipe.LRem(ctx, p.queueKey(priority), 0, taskID)
+		}
+		pipe.Publish(ctx, p.cancelChannel(), taskID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка отмены задачи: %w", err)
+	}
+
+	return nil
+}
+
+// SetTaskPriority меняет приоритет задачи, ожидающей выполнения, на любом экземпляре сервиса
+func (p *RedisBackgroundProcessor) SetTaskPriority(ctx context.Context, taskID string, priority Priority) error {
+	priority = clampPriority(priority)
+	status, err := prioritizeScript.Run(ctx, p.client, []string{p.taskKey(taskID)},
+		int(priority), p.options.Prefix+":queue:", taskID, time.Now().UTC().UnixMilli()).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+		}
+		return fmt.Errorf("ошибка изменения приоритета задачи: %w", err)
+	}
+	if TaskStatus(status) != TaskStatusPending {
+		return fmt.Errorf("%w: %s со статусом %s", ErrTaskNotPending, taskID, status)
+	}
+
+	p.logger.WithFields(logging.Fields{
+		"task_id":  taskID,
+		"priority": priority,
+	}).Info("Приоритет задачи изменен")
+	return nil
+}
+
+// GetTaskStatus возвращает статус задачи из Redis
+func (p *RedisBackgroundProcessor) GetTaskStatus(taskID string) TaskStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultContextTimeout)
+	defer cancel()
+
+	status, err := p.client.HGet(ctx, p.taskKey(taskID), "status").Result()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			p.logger.WithError(err).WithField("task_id", taskID).Error("Ошибка получения статуса задачи")
+		}
+		return TaskStatusUnknown
+	}
+
+	return TaskStatus(status)
+}
+
+// GetTask возвращает сведения о задаче из Redis
+func (p *RedisBackgroundProcessor) GetTask(ctx context.Context, taskID string) (*TaskInfo, error) {
+	fields, err := p.client.HGetAll(ctx, p.taskKey(taskID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения задачи: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+
+	info := decodeRedisTaskInfo(taskID, fields)
+	return &info, nil
+}
+
+// ListTasks возвращает задачи из Redis от новых к старым.
+// Завершенные задачи хранятся redisFinishedTaskTTL.
+func (p *RedisBackgroundProcessor) ListTasks(ctx context.Context, filter TaskFilter) ([]TaskInfo, error) {
+	prefix := p.taskKey("")
+
+	var keys []string
+	iter := p.client.Scan(ctx, 0, prefix+"*", 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка получения списка задач: %w", err)
+	}
+
+	commands := make([]*redis.MapStringStringCmd, len(keys))
+	_, err := p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			commands[i] = pipe.HGetAll(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения задач: %w", err)
+	}
+
+	tasks := make([]TaskInfo, 0, len(keys))
+	for i, command := range commands {
+		// Задача могла истечь между SCAN и HGETALL
+		if fields := command.Val(); len(fields) > 0 {
+			tasks = append(tasks, decodeRedisTaskInfo(strings.TrimPrefix(keys[i], prefix), fields))
+		}
+	}
+
+	return sortTasks(tasks, filter), nil
+}
+
+// Start проверяет соединение с Redis и запускает обработчики задач
+func (p *RedisBackgroundProcessor) Start(ctx context.Context) error {
+	if err := p.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("ошибка подключения к Redis: %w", err)
+	}
+
+	pubsub := p.client.Subscribe(ctx, p.cancelChannel())
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("ошибка подписки на отмену задач: %w", err)
+	}
+
+	p.wg.Add(2 + p.options.Concurrency)
+	go p.listenCancellations(pubsub)
+	go p.maintain()
+	for i := 0; i < p.options.Concurrency; i++ {
+		priorities := queuePriorities()
+		if i < p.options.ReservedWorkers {
+			priorities = urgentPriorities()
+		}
+		go p.work(priorities)
+	}
+
+	p.logger.WithFields(logging.Fields{
+		"concurrency":      p.options.Concurrency,
+		"reserved_workers": p.options.ReservedWorkers,
+		"priority_aging":   p.options.PriorityAging,
+		"max_retries":      p.options.MaxRetries,
+	}).Info("Redis процессор задач запущен")
+
+	return nil
+}
+
+// HealthCheck проверяет соединение с Redis
+func (p *RedisBackgroundProcessor) HealthCheck(ctx context.Context) error {
+	if err := p.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("Redis недоступен: %w", err)
+	}
+	return nil
+}
+
+// Stop останавливает обработчики и ожидает завершения выполняющихся задач.
+// Незавершенные задачи будут возвращены в очередь после истечения аренды.
+func (p *RedisBackgroundProcessor) Stop(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if err := p.client.HDel(ctx, p.workersKey(), p.instanceID).Err(); err != nil {
+			p.logger.WithError(err).Warn("Ошибка удаления сведений об обработчиках экземпляра")
+		}
+		p.logger.Info("Redis процессор задач остановлен")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// work цикл обработчика задач из очередей приоритетов priorities
+func (p *RedisBackgroundProcessor) work(priorities []Priority) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		processed, err := p.processNext(context.Background(), priorities)
+		if err != nil {
+			p.logger.WithError(err).Error("Ошибка получения задачи из очереди")
+		}
+		if processed {
+			continue
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(p.options.PollInterval):
+		}
+	}
+}
+
+// maintain периодически возвращает в очередь отложенные и потерянные задачи
+func (p *RedisBackgroundProcessor) maintain() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		p.Requeue(context.Background(), time.Now().UTC())
+		p.reportWorkers(context.Background(), time.Now().UTC())
+		if p.options.PriorityAging > 0 {
+			p.Age(context.Background(), time.Now().UTC())
+		}
+
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// listenCancellations отменяет локально выполняющиеся задачи по сообщениям других экземпляров
+func (p *RedisBackgroundProcessor) listenCancellations(pubsub *redis.PubSub) {
+	defer p.wg.Done()
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			if cancel, exists := p.cancellations.Load(message.Payload); exists {
+				cancel.(context.CancelFunc)()
+				p.logger.WithField("task_id", message.Payload).Info("Выполнение задачи отменено")
+			}
+		}
+	}
+}
+
+// Requeue возвращает в очереди задачи, время повтора которых наступило,
+// и задачи с истекшей арендой (обработчик упал или сервис был перезапущен)
+func (p *RedisBackgroundProcessor) Requeue(ctx context.Context, now time.Time) int {
+	requeued := 0
+	for _, key := range []string{p.retryKey(), p.activeKey()} {
+		count, err := requeueScript.Run(ctx, p.client, []string{key},
+			now.UnixMilli(), p.taskKey(""), p.options.Prefix+":queue:", 100).Int()
+		if err != nil {
+			p.logger.WithError(err).WithField("key", key).Error("Ошибка возврата задач в очередь")
+			continue
+		}
+		requeued += count
+	}
+	return requeued
+}
+
+// Age повышает приоритет задач, ожидающих в очереди дольше PriorityAging, и возвращает их число
+func (p *RedisBackgroundProcessor) Age(ctx context.Context, now time.Time) int {
+	promoted, err := agingScript.Run(ctx, p.client, nil, now.UnixMilli(), p.options.PriorityAging.Milliseconds(),
+		p.taskKey(""), p.options.Prefix+":queue:", int(PriorityHigh), 100).Int()
+	if err != nil {
+		p.logger.WithError(err).Error("Ошибка повышения приоритета ожидающих задач")
+		return 0
+	}
+	if promoted > 0 {
+		p.logger.WithField("tasks", promoted).Info("Повышен приоритет долго ожидающих задач")
+	}
+	return promoted
+}
+
+// PauseQueue приостанавливает выдачу задач из очереди обработчикам всех экземпляров сервиса.
+// Выполняющиеся задачи не прерываются, новые задачи ставятся в очередь
+func (p *RedisBackgroundProcessor) PauseQueue(ctx context.Context) error {
+	if err := p.client.Set(ctx, p.pausedKey(), time.Now().UTC().UnixMilli(), 0).Err(); err != nil {
+		return fmt.Errorf("ошибка приостановки очереди: %w", err)
+	}
+	return nil
+}
+
+// ResumeQueue возобновляет выдачу задач из очереди
+func (p *RedisBackgroundProcessor) ResumeQueue(ctx context.Context) error {
+	if err := p.client.Del(ctx, p.pausedKey()).Err(); err != nil {
+		return fmt.Errorf("ошибка возобновления очереди: %w", err)
+	}
+	return nil
+}
+
+// QueueState возвращает состояние очереди и обработчиков всех экземпляров сервиса
+func (p *RedisBackgroundProcessor) QueueState(ctx context.Context) (*QueueState, error) {
+	var (
+		paused  *redis.IntCmd
+		queues  []*redis.IntCmd
+		active  *redis.IntCmd
+		retries *redis.IntCmd
+		workers *redis.MapStringStringCmd
+	)
+	_, err := p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		paused = pipe.Exists(ctx, p.pausedKey())
+		for _, priority := range queuePriorities() {
+			queues = append(queues, pipe.LLen(ctx, p.queueKey(priority)))
+		}
+		active = pipe.ZCard(ctx, p.activeKey())
+		retries = pipe.ZCard(ctx, p.retryKey())
+		workers = pipe.HGetAll(ctx, p.workersKey())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения состояния очереди: %w", err)
+	}
+
+	state := &QueueState{
+		Paused:   paused.Val() == 1,
+		Running:  active.Val(),
+		Retrying: retries.Val(),
+	}
+	for _, queue := range queues {
+		state.Pending += queue.Val()
+	}
+
+	// Сведения остановившихся без Stop экземпляров не учитываются и удаляются
+	deadline := time.Now().UTC().Add(-max(redisWorkersTTL, 3*p.options.PollInterval))
+	var stale []string
+	for instance, value := range workers.Val() {
+		var entry redisWorkersEntry
+		if json.Unmarshal([]byte(value), &entry) != nil || time.UnixMilli(entry.SeenAt).Before(deadline) {
+			stale = append(stale, instance)
+			continue
+		}
+		state.Instances++
+		state.Workers += entry.Concurrency
+		state.Busy += entry.Busy
+	}
+	if len(stale) > 0 {
+		p.client.HDel(ctx, p.workersKey(), stale...)
+	}
+	return state, nil
+}
+
+// redisWorkersEntry сведения об обработчиках экземпляра сервиса
+type redisWorkersEntry struct {
+	Concurrency int   `json:"concurrency"`
+	Busy        int64 `json:"busy"`
+	SeenAt      int64 `json:"seen_at"`
+}
+
+// reportWorkers сохраняет число обработчиков экземпляра и занятых из них
+func (p *RedisBackgroundProcessor) reportWorkers(ctx context.Context, now time.Time) {
+	entry, _ := json.Marshal(redisWorkersEntry{
+		Concurrency: p.options.Concurrency,
+		Busy:        p.busy.Load(),
+		SeenAt:      now.UnixMilli(),
+	})
+	if err := p.client.HSet(ctx, p.workersKey(), p.instanceID, entry).Err(); err != nil {
+		p.logger.WithError(err).Error("Ошибка сохранения сведений об обработчиках экземпляра")
+	}
+}
+
+// ProcessNext забирает из очереди и выполняет одну задачу любого приоритета.
+// Возвращает false, если очереди пусты.
+func (p *RedisBackgroundProcessor) ProcessNext(ctx context.Context) (bool, error) {
+	return p.processNext(ctx, queuePriorities())
+}
+
+// processNext забирает и выполняет задачу из очередей приоритетов priorities
+func (p *RedisBackgroundProcessor) processNext(ctx context.Context, priorities []Priority) (bool, error) {
+	now := time.Now().UTC()
+
+	keys := []string{p.activeKey()}
+	for _, priority := range priorities {
+		keys = append(keys, p.queueKey(priority))
+	}
+
+	result, err := dequeueScript.Run(ctx, p.client, keys,
+		now.UnixMilli(), redisLeaseGrace.Milliseconds(), p.taskKey(""), p.pausedKey()).StringSlice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	taskID, payload := result[0], result[1]
+	attempts, _ := strconv.Atoi(result[2])
+
+	task, err := decodeRedisTask([]byte(payload))
+	if err != nil {
+		p.logger.WithError(err).WithField("task_id", taskID).Error("Некорректная задача в очереди")
+		p.finish(ctx, taskID, TaskStatusFailed, attempts, err)
+		return true, nil
+	}
+
+	p.execute(task, attempts)
+	return true, nil
+}
+
+// execute выполняет задачу и фиксирует результат
+func (p *RedisBackgroundProcessor) execute(task Task, attempts int) {
+	logger := p.logger.WithFields(logging.Fields{
+		"task_id": task.ID,
+		"attempt": attempts + 1,
+	})
+
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = defaultGenerationTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	p.cancellations.Store(task.ID, cancel)
+	defer p.cancellations.Delete(task.ID)
+
+	p.busy.Add(1)
+	err := p.executor.Execute(ctx, task)
+	p.busy.Add(-1)
+
+	// Статус сохраняем с отдельным контекстом: контекст задачи может быть уже отменен
+	saveCtx, saveCancel := context.WithTimeout(context.Background(), defaultContextTimeout)
+	defer saveCancel()
+
+	if err == nil {
+		p.finish(saveCtx, task.ID, TaskStatusCompleted, attempts, nil)
+		logger.Info("Задача выполнена")
+		return
+	}
+
+	if errors.Is(err, context.Canceled) {
+		// Отмененную задачу переводит в статус canceled CancelTask
+		p.client.ZRem(saveCtx, p.activeKey(), task.ID)
+		logger.Info("Задача отменена")
+		return
+	}
+
+	attempts++
+	if !isTransientError(err) {
+		logger.WithError(err).Error("Ошибка выполнения задачи не устраняется повтором")
+		p.finish(saveCtx, task.ID, TaskStatusFailed, attempts, err)
+		p.executor.Fail(saveCtx, task, attempts, err)
+		return
+	}
+	if attempts <= p.options.MaxRetries {
+		delay := retryDelay(attempts)
+		if retryErr := p.retry(saveCtx, task.ID, attempts, delay, err); retryErr != nil {
+			logger.WithError(retryErr).Error("Ошибка планирования повтора задачи")
+		}
+		logger.WithError(err).WithField("retry_in", delay).Warn("Ошибка выполнения задачи, запланирован повтор")
+		return
+	}
+
+	logger.WithError(err).Error("Ошибка выполнения задачи, попытки исчерпаны")
+	p.finish(saveCtx, task.ID, TaskStatusFailed, attempts, err)
+	p.executor.Fail(saveCtx, task, attempts, err)
+}
+
+// retry откладывает повтор задачи
+func (p *RedisBackgroundProcessor) retry(ctx context.Context, taskID string, attempts int, delay time.Duration, cause error) error {
+	now := time.Now().UTC()
+	_, err := p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, p.activeKey(), taskID)
+		pipe.HSet(ctx, p.taskKey(taskID), map[string]interface{}{
+			"status":     string(TaskStatusPending),
+			"attempts":   attempts,
+			"error":      cause.Error(),
+			"updated_at": now.UnixMilli(),
+		})
+		pipe.ZAdd(ctx, p.retryKey(), redis.Z{Score: float64(now.Add(delay).UnixMilli()), Member: taskID})
+		return nil
+	})
+	return err
+}
+
+// finish фиксирует окончательный статус задачи
+func (p *RedisBackgroundProcessor) finish(ctx context.Context, taskID string, status TaskStatus, attempts int, cause error) {
+	now := time.Now().UTC().UnixMilli()
+	fields := map[string]interface{}{
+		"status":      string(status),
+		"attempts":    attempts,
+		"finished_at": now,
+		"updated_at":  now,
+	}
+	if cause != nil {
+		fields["error"] = cause.Error()
+	}
+
+	_, err := p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, p.activeKey(), taskID)
+		pipe.HSet(ctx, p.taskKey(taskID), fields)
+		pipe.Expire(ctx, p.taskKey(taskID), redisFinishedTaskTTL)
+		return nil
+	})
+	if err != nil {
+		p.logger.WithError(err).WithField("task_id", taskID).Error("Ошибка сохранения статуса задачи")
+	}
+}
+
+func (p *RedisBackgroundProcessor) taskKey(taskID string) string {
+	return p.options.Prefix + ":task:" + taskID
+}
+
+func (p *RedisBackgroundProcessor) queueKey(priority Priority) string {
+	return p.options.Prefix + ":queue:" + strconv.Itoa(int(priority))
+}
+
+func (p *RedisBackgroundProcessor) activeKey() string {
+	return p.options.Prefix + ":active"
+}
+
+func (p *RedisBackgroundProcessor) retryKey() string {
+	return p.options.Prefix + ":retry"
+}
+
+func (p *RedisBackgroundProcessor) pausedKey() string {
+	return p.options.Prefix + ":paused"
+}
+
+func (p *RedisBackgroundProcessor) workersKey() string {
+	return p.options.Prefix + ":workers"
+}
+
+func (p *RedisBackgroundProcessor) cancelChannel() string {
+	return p.options.Prefix + ":cancel"
+}
+
+// queuePriorities возвращает приоритеты в порядке обработки очередей
+func queuePriorities() []Priority {
+	return []Priority{PriorityCritical, PriorityHigh, PriorityNormal, PriorityLow}
+}
+
+// urgentPriorities возвращает приоритеты, задачи которых выполняют зарезервированные обработчики
+func urgentPriorities() []Priority {
+	return []Priority{PriorityCritical, PriorityHigh}
+}
+
+// clampPriority приводит приоритет к допустимому диапазону
+func clampPriority(priority Priority) Priority {
+	if priority < PriorityLow {
+		return PriorityLow
+	}
+	if priority > PriorityCritical {
+		return PriorityCritical
+	}
+	return priority
+}
+
+// retryDelay возвращает экспоненциальную задержку перед повторной попыткой
+func retryDelay(attempt int) time.Duration {
+	delay := time.Duration(1<<uint(attempt)) * 5 * time.Second
+	if delay > maxRedisRetryDelay {
+		return maxRedisRetryDelay
+	}
+	return delay
+}
+
+// decodeRedisTask восстанавливает задачу из сериализованного представления
+func decodeRedisTask(payload []byte) (Task, error) {
+	var raw redisTaskPayload
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return Task{}, fmt.Errorf("ошибка разбора задачи: %w", err)
+	}
+
+	task := Task{
+		ID:        raw.ID,
+		Type:      raw.Type,
+		Priority:  raw.Priority,
+		Timeout:   raw.Timeout,
+		Trace:     raw.Trace,
+		RequestID: raw.RequestID,
+	}
+
+	switch raw.Type {
+	case TaskTypeReportGeneration:
+		var reportID uint
+		if err := json.Unmarshal(raw.Data, &reportID); err != nil {
+			return Task{}, fmt.Errorf("ошибка разбора данных задачи: %w", err)
+		}
+		task.Data = reportID
+	default:
+		return Task{}, fmt.Errorf("неизвестный тип задачи: %s", raw.Type)
+	}
+
+	return task, nil
+}
+
+// decodeRedisTaskInfo восстанавливает сведения о задаче из полей хеша задачи
+func decodeRedisTaskInfo(taskID string, fields map[string]string) TaskInfo {
+	priority, _ := strconv.Atoi(fields["priority"])
+	attempts, _ := strconv.Atoi(fields["attempts"])
+
+	info := TaskInfo{
+		ID:        taskID,
+		Status:    TaskStatus(fields["status"]),
+		Priority:  Priority(priority),
+		Attempts:  attempts,
+		Error:     fields["error"],
+		CreatedAt: parseRedisTime(fields["created_at"]),
+		UpdatedAt: parseRedisTime(fields["updated_at"]),
+	}
+	if value, exists := fields["started_at"]; exists {
+		startedAt := parseRedisTime(value)
+		info.StartedAt = &startedAt
+	}
+	if value, exists := fields["finished_at"]; exists {
+		finishedAt := parseRedisTime(value)
+		info.FinishedAt = &finishedAt
+	}
+
+	// Некорректная задача отображается без типа, ее ошибка сохранена в поле error
+	if task, err := decodeRedisTask([]byte(fields["payload"])); err == nil {
+		info.Type = task.Type
+		if reportID, ok := task.Data.(uint); ok {
+			info.ReportID = reportID
+		}
+	}
+
+	return info
+}
+
+// parseRedisTime разбирает время в миллисекундах Unix
+func parseRedisTime(value string) time.Time {
+	millis, _ := strconv.ParseInt(value, 10, 64)
+	return time.UnixMilli(millis).UTC()
+}
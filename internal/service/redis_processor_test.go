@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"testing"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// errStorageUnavailable временная ошибка хранилища, после которой генерация повторяется
+var errStorageUnavailable = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("storage unavailable")}
+
+func setupRedisProcessor(t *testing.T, mockStorage *MockStorage, maxRetries int) (*RedisBackgroundProcessor, *gorm.DB) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	repository := NewGormReportRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+
+	processor := NewRedisBackgroundProcessor(client, executor, RedisProcessorOptions{
+		Prefix:     "test",
+		MaxRetries: maxRetries,
+	}, logger)
+
+	return processor, db
+}
+
+func createTestReportTask(t *testing.T, db *gorm.DB, priority Priority) Task {
+	report := &models.Report{
+		Title:     "Test Report",
+		Status:    models.StatusPending,
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	require.NoError(t, db.Create(report).Error)
+
+	return Task{
+		ID:       fmt.Sprintf("report_%d", report.ID),
+		Type:     TaskTypeReportGeneration,
+		Data:     report.ID,
+		Priority: priority,
+		Timeout:  time.Minute,
+	}
+}
+
+func reportStatus(t *testing.T, db *gorm.DB, task Task) models.ReportStatus {
+	var report models.Report
+	require.NoError(t, db.First(&report, task.Data.(uint)).Error)
+	return report.Status
+}
+
+func TestRedisProcessorProcessesByPriority(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 0)
+	ctx := context.Background()
+
+	low := createTestReportTask(t, db, PriorityLow)
+	high := createTestReportTask(t, db, PriorityHigh)
+	require.NoError(t, processor.SubmitTask(ctx, low))
+	require.NoError(t, processor.SubmitTask(ctx, high))
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(low.ID))
+
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusCompleted, processor.GetTaskStatus(high.ID))
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(low.ID))
+	assert.Equal(t, models.StatusCompleted, reportStatus(t, db, high))
+
+	processed, err = processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusCompleted, processor.GetTaskStatus(low.ID))
+
+	processed, err = processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.False(t, processed)
+	assert.Equal(t, TaskStatusUnknown, processor.GetTaskStatus("missing"))
+}
+
+func TestRedisProcessorRetriesFailedTask(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(errStorageUnavailable).Once()
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 1)
+	ctx := context.Background()
+
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(task.ID))
+
+	// Повтор отложен и не выполняется раньше времени
+	assert.Equal(t, 0, processor.Requeue(ctx, time.Now().UTC()))
+	assert.Equal(t, 1, processor.Requeue(ctx, time.Now().UTC().Add(maxRedisRetryDelay)))
+
+	processed, err = processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusCompleted, processor.GetTaskStatus(task.ID))
+
+	var report models.Report
+	require.NoError(t, db.First(&report, task.Data.(uint)).Error)
+	assert.Equal(t, models.StatusCompleted, report.Status)
+	assert.Equal(t, 2, report.Attempts)
+}
+
+func TestRedisProcessorFailsAfterRetries(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(errStorageUnavailable)
+	processor, db := setupRedisProcessor(t, mockStorage, 0)
+	ctx := context.Background()
+
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusFailed, processor.GetTaskStatus(task.ID))
+
+	var report models.Report
+	require.NoError(t, db.First(&report, task.Data.(uint)).Error)
+	assert.Equal(t, models.StatusFailed, report.Status)
+	assert.Equal(t, models.ErrorCodeStorage, report.ErrorCode)
+	assert.Contains(t, report.ErrorMessage, "storage unavailable")
+}
+
+func TestRedisProcessorDoesNotRetryPermanentError(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(fs.ErrPermission)
+	processor, db := setupRedisProcessor(t, mockStorage, 3)
+	processor.executor.WithMaxAttempts(4)
+	ctx := context.Background()
+
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+
+	// Ошибка доступа к хранилищу не устраняется повтором: задача падает с первой попытки
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusFailed, processor.GetTaskStatus(task.ID))
+	assert.Equal(t, 0, processor.Requeue(ctx, time.Now().UTC().Add(maxRedisRetryDelay)))
+	mockStorage.AssertNumberOfCalls(t, "Save", 1)
+
+	var report models.Report
+	require.NoError(t, db.First(&report, task.Data.(uint)).Error)
+	assert.Equal(t, models.StatusFailed, report.Status)
+	assert.Equal(t, 1, report.Attempts)
+	assert.Equal(t, 4, report.MaxAttempts)
+}
+
+func TestRedisProcessorCancelQueuedTask(t *testing.T) {
+	processor, db := setupRedisProcessor(t, new(MockStorage), 0)
+	ctx := context.Background()
+
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+	require.NoError(t, processor.CancelTask(task.ID))
+	assert.Equal(t, TaskStatusCanceled, processor.GetTaskStatus(task.ID))
+	assert.Error(t, processor.CancelTask(task.ID))
+
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.False(t, processed)
+}
+
+func TestRedisProcessorRecoversLostTask(t *testing.T) {
+	processor, db := setupRedisProcessor(t, new(MockStorage), 0)
+	ctx := context.Background()
+
+	task := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+
+	// Имитируем обработчик, который забрал задачу и упал
+	now := time.Now().UTC()
+	_, err := dequeueScript.Run(ctx, processor.client,
+		[]string{processor.activeKey(), processor.queueKey(PriorityNormal)},
+		now.UnixMilli(), redisLeaseGrace.Milliseconds(), processor.taskKey(""), processor.pausedKey()).StringSlice()
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusRunning, processor.GetTaskStatus(task.ID))
+
+	// Пока аренда не истекла, задача остается у обработчика
+	assert.Equal(t, 0, processor.Requeue(ctx, now))
+	assert.Equal(t, 1, processor.Requeue(ctx, now.Add(task.Timeout+redisLeaseGrace+time.Second)))
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(task.ID))
+}
+
+func TestRedisProcessorInspectsTasks(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 0)
+	ctx := context.Background()
+
+	completed := createTestReportTask(t, db, PriorityHigh)
+	pending := createTestReportTask(t, db, PriorityLow)
+	require.NoError(t, processor.SubmitTask(ctx, completed))
+	require.NoError(t, processor.SubmitTask(ctx, pending))
+
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	require.True(t, processed)
+
+	info, err := processor.GetTask(ctx, completed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCompleted, info.Status)
+	assert.Equal(t, TaskTypeReportGeneration, info.Type)
+	assert.Equal(t, completed.Data, info.ReportID)
+	assert.Equal(t, PriorityHigh, info.Priority)
+	assert.NotNil(t, info.StartedAt)
+	assert.NotNil(t, info.FinishedAt)
+
+	tasks, err := processor.ListTasks(ctx, TaskFilter{})
+	require.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	tasks, err = processor.ListTasks(ctx, TaskFilter{Status: TaskStatusPending})
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, pending.ID, tasks[0].ID)
+	assert.Nil(t, tasks[0].StartedAt)
+
+	_, err = processor.GetTask(ctx, "missing")
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+	assert.ErrorIs(t, processor.CancelTask(completed.ID), ErrTaskFinished)
+}
+
+func TestRedisProcessorHealthCheck(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	processor := NewRedisBackgroundProcessor(client, nil, RedisProcessorOptions{}, setupTestLogger())
+	assert.NoError(t, processor.HealthCheck(context.Background()))
+
+	server.Close()
+	assert.Error(t, processor.HealthCheck(context.Background()))
+}
+
+func TestRedisTaskKeepsRequestID(t *testing.T) {
+	ctx := logging.ContextWithRequestID(context.Background(), "req-42")
+	task := newReportTask(ctx, &models.Report{ID: 7, Priority: models.PriorityHigh})
+	assert.Equal(t, "req-42", task.RequestID)
+	assert.Equal(t, PriorityHigh, task.Priority)
+
+	payload, err := json.Marshal(redisTaskPayload{ID: task.ID, Type: task.Type, Data: json.RawMessage("7"), RequestID: task.RequestID})
+	require.NoError(t, err)
+
+	decoded, err := decodeRedisTask(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "req-42", decoded.RequestID)
+	assert.Equal(t, uint(7), decoded.Data)
+}
+
+func TestRedisProcessorReservedWorkersTakeUrgentTasks(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 0)
+	ctx := context.Background()
+
+	normal := createTestReportTask(t, db, PriorityNormal)
+	critical := createTestReportTask(t, db, PriorityCritical)
+	require.NoError(t, processor.SubmitTask(ctx, normal))
+	require.NoError(t, processor.SubmitTask(ctx, critical))
+
+	processed, err := processor.processNext(ctx, urgentPriorities())
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusCompleted, processor.GetTaskStatus(critical.ID))
+
+	// Резервный обработчик не берет задачи обычного приоритета
+	processed, err = processor.processNext(ctx, urgentPriorities())
+	require.NoError(t, err)
+	assert.False(t, processed)
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(normal.ID))
+}
+
+func TestRedisProcessorAgesWaitingTasks(t *testing.T) {
+	processor, db := setupRedisProcessor(t, new(MockStorage), 0)
+	processor.options.PriorityAging = time.Minute
+	ctx := context.Background()
+
+	task := createTestReportTask(t, db, PriorityLow)
+	require.NoError(t, processor.SubmitTask(ctx, task))
+
+	now := time.Now().UTC()
+	assert.Equal(t, 0, processor.Age(ctx, now))
+	assert.Equal(t, 1, processor.Age(ctx, now.Add(2*time.Minute)))
+	assert.Equal(t, int64(1), processor.client.LLen(ctx, processor.queueKey(PriorityNormal)).Val())
+	assert.Equal(t, int64(0), processor.client.LLen(ctx, processor.queueKey(PriorityLow)).Val())
+
+	// Срок ожидания отсчитывается заново с момента повышения
+	assert.Equal(t, 0, processor.Age(ctx, now.Add(2*time.Minute)))
+}
+
+func TestRedisProcessorSetsTaskPriority(t *testing.T) {
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	processor, db := setupRedisProcessor(t, mockStorage, 0)
+	ctx := context.Background()
+
+	low := createTestReportTask(t, db, PriorityLow)
+	normal := createTestReportTask(t, db, PriorityNormal)
+	require.NoError(t, processor.SubmitTask(ctx, low))
+	require.NoError(t, processor.SubmitTask(ctx, normal))
+
+	require.NoError(t, processor.SetTaskPriority(ctx, low.ID, PriorityCritical))
+	processed, err := processor.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+	assert.Equal(t, TaskStatusCompleted, processor.GetTaskStatus(low.ID))
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(normal.ID))
+
+	assert.ErrorIs(t, processor.SetTaskPriority(ctx, low.ID, PriorityHigh), ErrTaskNotPending)
+	assert.ErrorIs(t, processor.SetTaskPriority(ctx, "missing", PriorityHigh), ErrTaskNotFound)
+}
+
+func TestReservedWorkers(t *testing.T) {
+	assert.Equal(t, 0, reservedWorkers(10, 0))
+	assert.Equal(t, 0, reservedWorkers(1, 0.5))
+	assert.Equal(t, 1, reservedWorkers(4, 0.1))
+	assert.Equal(t, 2, reservedWorkers(10, 0.2))
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+// GeneratorFactory создает генератор формата по настройкам приложения
+type GeneratorFactory func(cfg config.Config, logger logging.Logger) ReportGenerator
+
+// GeneratorRegistry реестр генераторов отчетов по форматам. Встроенные генераторы
+// регистрируются при инициализации пакета, внешние пакеты добавляют свои
+// через RegisterGenerator до запуска приложения.
+type GeneratorRegistry struct {
+	mu        sync.RWMutex
+	factories map[models.ReportFormat]GeneratorFactory
+}
+
+// NewGeneratorRegistry создает пустой реестр генераторов
+func NewGeneratorRegistry() *GeneratorRegistry {
+	return &GeneratorRegistry{factories: make(map[models.ReportFormat]GeneratorFactory)}
+}
+
+// DefaultGeneratorRegistry реестр, из которого собираются генераторы приложения
+var DefaultGeneratorRegistry = NewGeneratorRegistry()
+
+// RegisterGenerator регистрирует генератор формата в реестре приложения.
+// Формат становится допустимым для отчетов, определений и расписаний.
+func RegisterGenerator(format models.ReportFormat, factory GeneratorFactory) {
+	DefaultGeneratorRegistry.Register(format, factory)
+}
+
+// Register добавляет генератор формата. Повторная регистрация формата заменяет генератор,
+// так внешний пакет может подменить встроенный генератор.
+func (r *GeneratorRegistry) Register(format models.ReportFormat, factory GeneratorFactory) {
+	format = models.ReportFormat(strings.ToLower(string(format)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[format] = factory
+	models.RegisterFormat(format)
+}
+
+// Formats возвращает зарегистрированные форматы по алфавиту
+func (r *GeneratorRegistry) Formats() []models.ReportFormat {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	formats := make([]models.ReportFormat, 0, len(r.factories))
+	for format := range r.factories {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i] < formats[j] })
+	return formats
+}
+
+// Build создает генераторы всех зарегистрированных форматов
+func (r *GeneratorRegistry) Build(cfg config.Config, logger logging.Logger) FormatGenerators {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	generators := make(FormatGenerators, len(r.factories))
+	for format, factory := range r.factories {
+		generators[format] = factory(cfg, logger)
+	}
+	return generators
+}
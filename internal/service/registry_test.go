@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// textGenerator генератор внешнего формата для проверки реестра
+type textGenerator struct {
+	prefix string
+}
+
+func (g *textGenerator) Generate(_ context.Context, report *models.Report, _ *ReportData) (io.Reader, string, error) {
+	return strings.NewReader(g.prefix + report.Title), "report.txt", nil
+}
+
+func (g *textGenerator) GetMimeType() string {
+	return "text/plain; charset=utf-8"
+}
+
+func (g *textGenerator) GetFileExtension() string {
+	return "txt"
+}
+
+func TestGeneratorRegistry(t *testing.T) {
+	registry := NewGeneratorRegistry()
+	registry.Register("TXT", func(cfg config.Config, _ logging.Logger) ReportGenerator {
+		return &textGenerator{prefix: cfg.Logging.Level}
+	})
+	assert.Equal(t, []models.ReportFormat{"txt"}, registry.Formats())
+
+	// Зарегистрированный формат допустим для отчетов
+	assert.True(t, models.ReportFormat("txt").IsValid())
+	assert.False(t, models.ReportFormat("parquet").IsValid())
+
+	// Генератор получает настройки приложения
+	generators := registry.Build(config.Config{Logging: config.Logging{Level: "debug: "}}, setupTestLogger())
+	generator, err := generators.ForFormat("txt")
+	require.NoError(t, err)
+	reader, _, err := generator.Generate(context.Background(), &models.Report{Title: "Продажи"}, &ReportData{})
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "debug: Продажи", string(content))
+}
+
+func TestNewFormatGeneratorsFromConfig(t *testing.T) {
+	logger := setupTestLogger()
+
+	generators, err := NewFormatGeneratorsFromConfig(config.Config{}, logger)
+	require.NoError(t, err)
+	assert.Subset(t, generators.Formats(), []models.ReportFormat{models.FormatCSV, models.FormatDOCX, models.FormatHTML, models.FormatXLSX})
+
+	// Ограничения Excel передаются генератору из конфигурации
+	generators, err = NewFormatGeneratorsFromConfig(config.Config{
+		Excel:      config.Excel{MaxRows: 10, SheetRows: 100},
+		Generators: config.Generators{Formats: []string{"CSV", " xlsx"}},
+	}, logger)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ReportFormat{models.FormatCSV, models.FormatXLSX}, generators.Formats())
+	assert.Equal(t, 10, generators[models.FormatXLSX].(*ExcelReportGenerator).maxRows)
+
+	_, err = NewFormatGeneratorsFromConfig(config.Config{Generators: config.Generators{Formats: []string{"parquet"}}}, logger)
+	assert.Error(t, err)
+}
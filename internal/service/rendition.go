@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRenderUnsupportedFormat отчет нельзя перестроить в запрошенный формат
+var ErrRenderUnsupportedFormat = newCategoryError(ErrValidation, "формат недоступен для перестроения отчета")
+
+// RenditionRepository интерфейс для работы с файлами отчетов в других форматах в базе данных
+type RenditionRepository interface {
+	// Save сохраняет файл формата, заменяя сведения о прежнем файле того же формата
+	Save(ctx context.Context, rendition *models.ReportRendition) error
+	GetByFormat(ctx context.Context, reportID uint, format models.ReportFormat) (*models.ReportRendition, error)
+	ListByReport(ctx context.Context, reportID uint) ([]models.ReportRendition, error)
+	DeleteByReport(ctx context.Context, reportID uint) error
+}
+
+// GormRenditionRepository реализация RenditionRepository с использованием GORM
+type GormRenditionRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormRenditionRepository создает новый репозиторий файлов отчетов в других форматах
+func NewGormRenditionRepository(db *gorm.DB, logger logging.Logger) RenditionRepository {
+	return &GormRenditionRepository{db: db, logger: logger}
+}
+
+// Save сохраняет сведения о файле формата
+func (r *GormRenditionRepository) Save(ctx context.Context, rendition *models.ReportRendition) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "report_id"}, {Name: "format"}},
+		DoUpdates: clause.AssignmentColumns([]string{"created_at", "size", "checksum", "file_key", "created_by"}),
+	}).Create(rendition).Error
+}
+
+// GetByFormat возвращает файл отчета формата format
+func (r *GormRenditionRepository) GetByFormat(ctx context.Context, reportID uint, format models.ReportFormat) (*models.ReportRendition, error) {
+	var rendition models.ReportRendition
+	err := r.db.WithContext(ctx).Where("report_id = ? AND format = ?", reportID, format).First(&rendition).Error
+	if err != nil {
+		return nil, err
+	}
+	return &rendition, nil
+}
+
+// ListByReport возвращает файлы отчета в других форматах в порядке создания
+func (r *GormRenditionRepository) ListByReport(ctx context.Context, reportID uint) ([]models.ReportRendition, error) {
+	var renditions []models.ReportRendition
+	err := r.db.WithContext(ctx).Where("report_id = ?", reportID).Order("id").Find(&renditions).Error
+	if err != nil {
+		return nil, err
+	}
+	return renditions, nil
+}
+
+// DeleteByReport удаляет сведения о файлах отчета в других форматах
+func (r *GormRenditionRepository) DeleteByReport(ctx context.Context, reportID uint) error {
+	return r.db.WithContext(ctx).Where("report_id = ?", reportID).Delete(&models.ReportRendition{}).Error
+}
+
+// RenderReport перестраивает готовый отчет в формат format по его снимку данных, не выполняя
+// запросы. Файл сохраняется рядом с файлом отчета и заменяет прежний файл того же формата.
+func (s *ReportServiceImpl) RenderReport(ctx context.Context, id uint, format models.ReportFormat) (*models.ReportRendition, error) {
+	if s.renditions == nil {
+		return nil, fmt.Errorf("%w: файлы в других форматах не подключены", ErrRenderUnsupportedFormat)
+	}
+	report, _, err := s.completedReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Архив собирается из нескольких выборок, а формат самого отчета уже построен
+	if format == models.FormatZIP || format == report.Format {
+		return nil, fmt.Errorf("%w: %s", ErrRenderUnsupportedFormat, format)
+	}
+	generator, err := s.generators.ForFormat(format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRenderUnsupportedFormat, format)
+	}
+
+	logger := logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"report_id": id, "format": format})
+
+	data, err := s.GetReportSnapshot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+	if err := s.renderDefinition(ctx, report, format, data); err != nil {
+		return nil, err
+	}
+
+	target := *report
+	target.Format = format
+	reader, _, err := generator.Generate(ctx, &target, data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка перестроения отчета: %w", err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	key := s.fileStorage.GenerateKey(report, generator.GetFileExtension())
+	checksum := newChecksumReader(reader)
+	if err := s.fileStorage.Save(ctx, key, checksum); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения файла отчета: %w", err)
+	}
+
+	previous, err := s.renditions.GetByFormat(ctx, id, format)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.deleteRenditionFile(ctx, key, logger)
+		return nil, fmt.Errorf("ошибка получения файлов отчета: %w", err)
+	}
+	rendition := &models.ReportRendition{
+		ReportID:  id,
+		Format:    format,
+		Size:      checksum.Size(),
+		Checksum:  checksum.Sum(),
+		FileKey:   key,
+		CreatedBy: actorOr(ctx, "api"),
+	}
+	if err := s.renditions.Save(ctx, rendition); err != nil {
+		s.deleteRenditionFile(ctx, key, logger)
+		return nil, fmt.Errorf("ошибка сохранения файла отчета: %w", err)
+	}
+	if previous != nil && previous.FileKey != key {
+		s.deleteRenditionFile(ctx, previous.FileKey, logger)
+	}
+
+	logger.WithFields(logging.Fields{
+		"file_key":   key,
+		"size":       rendition.Size,
+		"created_by": rendition.CreatedBy,
+	}).Info("Отчет перестроен по снимку данных")
+	return rendition, nil
+}
+
+// renderDefinition добавляет к данным снимка шаблон и оформление определения отчета. Они
+// хранятся в определении и применяются, только если определение строит файлы формата format.
+func (s *ReportServiceImpl) renderDefinition(ctx context.Context, report *models.Report, format models.ReportFormat, data *ReportData) error {
+	if report.DefinitionID == nil || s.definitions == nil {
+		return nil
+	}
+	definition, err := s.definitions.GetByID(ctx, *report.DefinitionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка получения определения отчета %d: %w", *report.DefinitionID, err)
+	}
+	if definition.Format != format {
+		return nil
+	}
+
+	if !definition.ExcelLayout.IsEmpty() {
+		data.Layout = definition.ExcelLayout
+	}
+	if definition.HasTemplate() {
+		if data.Template, err = readTemplate(ctx, s.fileStorage, definition.TemplateKey, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openRendition открывает файл отчета в другом формате с проверкой контрольной суммы
+func (s *ReportServiceImpl) openRendition(ctx context.Context, report *models.Report, format models.ReportFormat) (*ReportFile, error) {
+	rendition, err := s.renditions.GetByFormat(ctx, report.ID, format)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrBundleArtifactNotFound, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения файлов отчета: %w", err)
+	}
+
+	reader, err := s.fileStorage.Get(ctx, rendition.FileKey)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("file_key", rendition.FileKey).
+			Error("Ошибка получения файла из хранилища")
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
+	}
+
+	contentType := "application/octet-stream"
+	filename := fmt.Sprintf("%s.%s", report.Title, format)
+	if generator, err := s.generators.ForFormat(format); err == nil {
+		contentType = generator.GetMimeType()
+		filename = reportFilename(report, generator)
+	}
+	return &ReportFile{
+		Reader:      verifyChecksum(reader, rendition.Checksum),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        rendition.Size,
+		Checksum:    rendition.Checksum,
+	}, nil
+}
+
+// deleteRenditions удаляет файлы удаленного отчета в других форматах. Ошибки только
+// записываются в лог: отчет уже удален
+func (s *ReportServiceImpl) deleteRenditions(ctx context.Context, id uint, logger logging.Logger) {
+	renditions, err := s.renditions.ListByReport(ctx, id)
+	if err != nil {
+		logger.WithError(err).Error("Ошибка получения файлов удаленного отчета в других форматах")
+		return
+	}
+	if err := s.renditions.DeleteByReport(ctx, id); err != nil {
+		logger.WithError(err).Error("Ошибка удаления файлов отчета в других форматах")
+		return
+	}
+	for _, rendition := range renditions {
+		s.deleteRenditionFile(ctx, rendition.FileKey, logger)
+	}
+}
+
+// deleteRenditionFile удаляет файл отчета в другом формате из хранилища, ошибка только записывается в лог
+func (s *ReportServiceImpl) deleteRenditionFile(ctx context.Context, key string, logger logging.Logger) {
+	if err := s.fileStorage.Delete(ctx, key); err != nil {
+		logger.WithError(err).WithField("file_key", key).Warn("Ошибка удаления файла отчета в другом формате")
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderReportFromSnapshot(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	report := &models.Report{Title: "Sales", Status: models.StatusPending, Format: models.FormatCSV,
+		CreatedBy: "test-user", UpdatedBy: "test-user"}
+	withoutSnapshot := &models.Report{Title: "Stock", Status: models.StatusPending, Format: models.FormatCSV,
+		CreatedBy: "test-user", UpdatedBy: "test-user", Parameters: models.JSON{models.ParamSnapshot: false}}
+	require.NoError(t, db.Create(report).Error)
+	require.NoError(t, db.Create(withoutSnapshot).Error)
+
+	local, err := storage.NewLocalStorage(storage.LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+
+	repository := NewGormReportRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(local, logger), logger).
+		WithSnapshots(SnapshotPolicy{Default: true})
+	require.NoError(t, executor.Execute(ctx, Task{ID: "report_1", Type: TaskTypeReportGeneration, Data: report.ID}))
+	require.NoError(t, executor.Execute(ctx, Task{ID: "report_2", Type: TaskTypeReportGeneration, Data: withoutSnapshot.ID}))
+
+	completed, err := repository.GetByID(ctx, report.ID)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(completed.SnapshotKey, ".snapshot.ndjson.gz"), completed.SnapshotKey)
+
+	service := newTestReportService(t, db, local, logger)
+	rendition, err := service.RenderReport(ctx, report.ID, models.FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, models.FormatJSON, rendition.Format)
+	assert.NotEmpty(t, rendition.Checksum)
+
+	// Файл отдается как файл отчета формата json и перечислен в отчете
+	file, err := service.GetReportArtifact(ctx, report.ID, models.FormatJSON)
+	require.NoError(t, err)
+	body, err := io.ReadAll(file.Reader)
+	require.NoError(t, err)
+	require.NoError(t, file.Reader.Close())
+	assert.Equal(t, "Sales.json", file.Filename)
+	assert.Contains(t, string(body), `{"Параметр":"Название","Значение":"Sales"}`)
+
+	loaded, err := service.GetReport(ctx, report.ID)
+	require.NoError(t, err)
+	require.Len(t, loaded.Renditions, 1)
+
+	// Повторное перестроение заменяет файл того же формата
+	_, err = service.RenderReport(ctx, report.ID, models.FormatJSON)
+	require.NoError(t, err)
+	loaded, err = service.GetReport(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Renditions, 1)
+
+	_, err = service.RenderReport(ctx, report.ID, models.FormatCSV)
+	assert.ErrorIs(t, err, ErrRenderUnsupportedFormat)
+	_, err = service.RenderReport(ctx, report.ID, "pdf")
+	assert.ErrorIs(t, err, ErrRenderUnsupportedFormat)
+	_, err = service.RenderReport(ctx, withoutSnapshot.ID, models.FormatJSON)
+	assert.ErrorIs(t, err, ErrSnapshotNotFound)
+	_, err = service.GetReportArtifact(ctx, report.ID, models.FormatHTML)
+	assert.ErrorIs(t, err, ErrBundleArtifactNotFound)
+}
@@ -1,19 +1,28 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
 	"report_srv/internal/models"
 	"report_srv/internal/storage"
+	"report_srv/internal/telemetry"
 
-	"github.com/sirupsen/logrus"
-	"github.com/xuri/excelize/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
@@ -34,7 +43,35 @@ type ReportService interface {
 	UpdateReport(ctx context.Context, id uint, updates ReportUpdateParams) error
 	DeleteReport(ctx context.Context, id uint) error
 	CancelReportGeneration(ctx context.Context, id uint) error
-	GetReportFile(ctx context.Context, id uint) (io.ReadCloser, string, error)
+	GetReportFile(ctx context.Context, id uint) (*ReportFile, error)
+	GetReportFileRange(ctx context.Context, id uint, offset, length int64) (*ReportFile, error)
+	GetReportDownloadURL(ctx context.Context, id uint, expiration time.Duration) (*ReportDownloadURL, error)
+	GetReportArtifact(ctx context.Context, id uint, format models.ReportFormat) (*ReportFile, error)
+	GetReportSnapshot(ctx context.Context, id uint) (*ReportData, error)
+	RenderReport(ctx context.Context, id uint, format models.ReportFormat) (*models.ReportRendition, error)
+	SetReportPriority(ctx context.Context, id uint, priority models.ReportPriority, updatedBy string) (*models.Report, error)
+	SubscribeStatus(ctx context.Context, id uint) (<-chan events.Event, error)
+}
+
+// ReportFile файл сгенерированного отчета для отдачи клиенту.
+// Reader должен быть закрыт вызывающей стороной.
+type ReportFile struct {
+	Reader      io.ReadCloser
+	Filename    string
+	ContentType string
+	// ContentEncoding кодировка сжатого содержимого (gzip), пустая - файл не сжат
+	ContentEncoding string
+	// Size размер файла в байтах, -1 если неизвестен
+	Size int64
+	// Checksum SHA-256 сохраненного файла в hex, пустая - не известна
+	Checksum string
+}
+
+// ReportDownloadURL временная ссылка для скачивания файла отчета напрямую из хранилища
+type ReportDownloadURL struct {
+	URL       string    `json:"url"`
+	Filename  string    `json:"filename"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // ReportRepository интерфейс для работы с базой данных отчетов
@@ -45,21 +82,144 @@ type ReportRepository interface {
 	Update(ctx context.Context, id uint, updates map[string]interface{}) error
 	Delete(ctx context.Context, id uint) error
 	UpdateStatus(ctx context.Context, id uint, status models.ReportStatus, fileKey string) error
+	// StartAttempt переводит ожидающий или повторяемый отчет в статус processing, увеличивает
+	// число попыток генерации и сохраняет их предел maxAttempts. Возвращает false, если отчет
+	// уже в другом статусе, например отменен
+	StartAttempt(ctx context.Context, id uint, maxAttempts int) (bool, error)
+	// Complete сохраняет сведения о файле updates и переводит генерируемый отчет в статус completed.
+	// Возвращает false, если отчет уже не в статусе processing, например отменен
+	Complete(ctx context.Context, id uint, fileKey string, updates map[string]interface{}) (bool, error)
+	MarkFailed(ctx context.Context, id uint, code models.ReportErrorCode, message string) error
+	UpdateProgress(ctx context.Context, id uint, progress int, rows int64) error
+	Heartbeat(ctx context.Context, id uint) error
+	ListStale(ctx context.Context, before time.Time, limit int) ([]models.Report, error)
+	ClaimStale(ctx context.Context, id uint, before time.Time) (bool, error)
+	// Requeue переводит упавший или отмененный отчет в статус pending и сбрасывает причину ошибки
+	// и счетчик попыток. Возвращает false, если отчет уже не в статусе from
+	Requeue(ctx context.Context, id uint, from models.ReportStatus) (bool, error)
+	ListExpired(ctx context.Context, now time.Time, limit int) ([]models.Report, error)
+	// ListForTransition возвращает готовые отчеты со стандартным классом хранения файла,
+	// сгенерированные не позже before
+	ListForTransition(ctx context.Context, before time.Time, limit int) ([]models.Report, error)
+	// SetStorageClass сохраняет класс хранения файла отчета
+	SetStorageClass(ctx context.Context, id uint, class string) error
+	// FindCached возвращает последний готовый отчет с ключом cacheKey, сгенерированный
+	// не раньше since, файл которого можно прочитать без восстановления из архива
+	FindCached(ctx context.Context, cacheKey string, since time.Time) (*models.Report, error)
+	// CountActiveByDefinition считает отчеты определения в очереди и в генерации
+	CountActiveByDefinition(ctx context.Context, definitionID uint) (int64, error)
+	// ListRecentByDefinition возвращает отчеты определения, созданные не раньше since,
+	// кроме завершенных ошибкой, отмененных и удаленных по сроку хранения, от новых к старым
+	ListRecentByDefinition(ctx context.Context, definitionID uint, since time.Time) ([]models.Report, error)
+	// CountQueuedAhead считает отчеты в очереди, которые будут выбраны раньше report:
+	// с более высоким приоритетом или с тем же приоритетом, созданные раньше
+	CountQueuedAhead(ctx context.Context, report *models.Report) (int64, error)
+	// GenerationDurations возвращает длительности генерации не более limit последних отчетов,
+	// готовых с since. definitionID nil - отчеты всех определений
+	GenerationDurations(ctx context.Context, definitionID *uint, since time.Time, limit int) ([]time.Duration, error)
+	// ListSLACandidates возвращает отчеты определения без отметки нарушения breach: для queue_wait -
+	// в очереди, созданные раньше before, для duration - в генерации, начатой раньше before
+	ListSLACandidates(ctx context.Context, definitionID uint, breach models.SLABreach, before time.Time, limit int) ([]models.Report, error)
+	// MarkSLABreach отмечает нарушение SLA отчета. Возвращает false, если отчет уже отмечен
+	// или вышел из статуса, в котором проверялся срок
+	MarkSLABreach(ctx context.Context, id uint, breach models.SLABreach, at time.Time) (bool, error)
+	// ListSLABreaches возвращает отчеты в очереди и в генерации с нарушением SLA, от давних к новым
+	ListSLABreaches(ctx context.Context, limit int) ([]models.Report, error)
+	// DeleteLinks удаляет публичные ссылки на отчет
+	DeleteLinks(ctx context.Context, reportID uint) error
+	// Transaction выполняет fn в одной транзакции: изменения через переданный
+	// репозиторий сохраняются, только если fn вернула nil
+	Transaction(ctx context.Context, fn func(repository ReportRepository) error) error
+}
+
+// ReadReplica подключение к реплике БД для запросов только на чтение
+type ReadReplica interface {
+	DB() *gorm.DB
 }
 
 // ReportGenerator интерфейс для генерации отчетов
 type ReportGenerator interface {
-	Generate(ctx context.Context, report *models.Report) (io.Reader, string, error)
+	Generate(ctx context.Context, report *models.Report, data *ReportData) (io.Reader, string, error)
 	GetMimeType() string
 	GetFileExtension() string
 }
 
+// FormatGenerators сопоставляет формат отчета с генератором
+type FormatGenerators map[models.ReportFormat]ReportGenerator
+
+// NewFormatGenerators создает набор генераторов всех зарегистрированных форматов без ограничений
+func NewFormatGenerators(logger logging.Logger) FormatGenerators {
+	return withBundle(DefaultGeneratorRegistry.Build(config.Config{}, logger), logger)
+}
+
+// NewFormatGeneratorsFromConfig создает генераторы зарегистрированных форматов с настройками
+// из конфигурации. Если задан generators.formats, доступны только перечисленные форматы.
+// Архив zip собирается из файлов доступных форматов.
+func NewFormatGeneratorsFromConfig(cfg config.Config, logger logging.Logger) (FormatGenerators, error) {
+	generators := DefaultGeneratorRegistry.Build(cfg, logger)
+	if len(cfg.Generators.Formats) == 0 {
+		generators = withBundle(generators, logger)
+		logger.WithField("formats", generators.Formats()).Info("Генераторы отчетов созданы")
+		return generators, nil
+	}
+
+	enabled := make(FormatGenerators, len(cfg.Generators.Formats))
+	bundle := false
+	for _, name := range cfg.Generators.Formats {
+		format := models.ReportFormat(strings.ToLower(strings.TrimSpace(name)))
+		if format == models.FormatZIP {
+			bundle = true
+			continue
+		}
+		generator, exists := generators[format]
+		if !exists {
+			return nil, fmt.Errorf("генератор для формата %s не зарегистрирован", name)
+		}
+		enabled[format] = generator
+	}
+	if bundle {
+		enabled = withBundle(enabled, logger)
+	}
+	if _, exists := enabled[models.DefaultFormat]; !exists {
+		logger.WithField("format", models.DefaultFormat).Warn("Формат по умолчанию отключен: отчеты без формата будут отклоняться")
+	}
+	logger.WithField("formats", enabled.Formats()).Info("Генераторы отчетов созданы")
+	return enabled, nil
+}
+
+// Formats возвращает форматы набора по алфавиту
+func (g FormatGenerators) Formats() []models.ReportFormat {
+	formats := make([]models.ReportFormat, 0, len(g))
+	for format := range g {
+		formats = append(formats, format)
+	}
+	sort.Slice(formats, func(i, j int) bool { return formats[i] < formats[j] })
+	return formats
+}
+
+// ForFormat возвращает генератор для указанного формата
+func (g FormatGenerators) ForFormat(format models.ReportFormat) (ReportGenerator, error) {
+	if format == "" {
+		format = models.DefaultFormat
+	}
+
+	generator, exists := g[format]
+	if !exists {
+		return nil, fmt.Errorf("генератор для формата %s не найден", format)
+	}
+	return generator, nil
+}
+
 // ReportFileStorage интерфейс для работы с файлами отчетов
 type ReportFileStorage interface {
 	Save(ctx context.Context, key string, data io.Reader) error
 	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
-	GenerateKey(report *models.Report) string
+	Size(ctx context.Context, key string) (int64, error)
+	PresignedURL(ctx context.Context, key string, expiration time.Duration) (string, error)
+	Copy(ctx context.Context, srcKey, dstKey string) error
+	GenerateKey(report *models.Report, extension string) string
 }
 
 // BackgroundProcessor интерфейс для фоновой обработки
@@ -69,6 +229,18 @@ type BackgroundProcessor interface {
 	GetTaskStatus(taskID string) TaskStatus
 }
 
+// ManagedProcessor фоновый процессор, требующий явного запуска и остановки
+type ManagedProcessor interface {
+	BackgroundProcessor
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// HealthChecker компонент, который проверяет свою работоспособность для readiness probe
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
 // Task представляет фоновую задачу
 type Task struct {
 	ID       string
@@ -76,6 +248,28 @@ type Task struct {
 	Data     interface{}
 	Priority Priority
 	Timeout  time.Duration
+	// Trace контекст трассировки запроса, породившего задачу
+	Trace map[string]string
+	// RequestID ID HTTP запроса, породившего задачу, для корреляции логов
+	RequestID string
+}
+
+// reportTaskID возвращает ID задачи генерации отчета
+func reportTaskID(reportID uint) string {
+	return fmt.Sprintf("report_%d", reportID)
+}
+
+// newReportTask создает задачу генерации отчета с приоритетом отчета, контекстом трассировки и ID запроса
+func newReportTask(ctx context.Context, report *models.Report) Task {
+	return Task{
+		ID:        reportTaskID(report.ID),
+		Type:      TaskTypeReportGeneration,
+		Data:      report.ID,
+		Priority:  taskPriority(report.Priority),
+		Timeout:   defaultGenerationTimeout,
+		Trace:     telemetry.Inject(ctx),
+		RequestID: logging.RequestIDFromContext(ctx),
+	}
 }
 
 // TaskType тип задачи
@@ -94,6 +288,7 @@ const (
 	TaskStatusCompleted TaskStatus = "completed"
 	TaskStatusFailed    TaskStatus = "failed"
 	TaskStatusCanceled  TaskStatus = "canceled"
+	TaskStatusUnknown   TaskStatus = "unknown"
 )
 
 // Priority приоритет задачи
@@ -106,16 +301,61 @@ const (
 	PriorityCritical
 )
 
+// taskPriority возвращает приоритет задачи для приоритета отчета. Пустой приоритет - обычный
+func taskPriority(priority models.ReportPriority) Priority {
+	switch priority {
+	case models.PriorityLow:
+		return PriorityLow
+	case models.PriorityHigh:
+		return PriorityHigh
+	case models.PriorityCritical:
+		return PriorityCritical
+	default:
+		return PriorityNormal
+	}
+}
+
+// ErrInvalidSortField поле сортировки списка отчетов не поддерживается
+var ErrInvalidSortField = newCategoryError(ErrValidation, "недопустимое поле сортировки")
+
+// reportSortFields поля, по которым разрешена сортировка списка отчетов
+var reportSortFields = map[string]bool{
+	"created_at":   true,
+	"updated_at":   true,
+	"generated_at": true,
+	"title":        true,
+	"status":       true,
+	"format":       true,
+}
+
 // ListReportParams параметры для получения списка отчетов
 type ListReportParams struct {
-	Page     int                  `json:"page"`
-	PageSize int                  `json:"page_size"`
-	Status   *models.ReportStatus `json:"status,omitempty"`
-	Search   string               `json:"search,omitempty"`
-	SortBy   string               `json:"sort_by,omitempty"`
-	SortDesc bool                 `json:"sort_desc,omitempty"`
+	Page       int                  `json:"page"`
+	PageSize   int                  `json:"page_size"`
+	Status     *models.ReportStatus `json:"status,omitempty"`
+	Format     *models.ReportFormat `json:"format,omitempty"`
+	CreatedBy  string               `json:"created_by,omitempty"`
+	Search     string               `json:"search,omitempty"`
+	SearchMode SearchMode           `json:"search_mode,omitempty"`
+	// Границы периодов включительно
+	CreatedAfter    *time.Time `json:"created_after,omitempty"`
+	CreatedBefore   *time.Time `json:"created_before,omitempty"`
+	GeneratedAfter  *time.Time `json:"generated_after,omitempty"`
+	GeneratedBefore *time.Time `json:"generated_before,omitempty"`
+	SortBy          string     `json:"sort_by,omitempty"`
+	SortDesc        bool       `json:"sort_desc,omitempty"`
 }
 
+// SearchMode режим поиска отчетов
+type SearchMode string
+
+const (
+	// SearchModeSubstring поиск подстроки без учета регистра
+	SearchModeSubstring SearchMode = "substring"
+	// SearchModeFullText полнотекстовый поиск, на СУБД кроме PostgreSQL выполняется поиск подстроки
+	SearchModeFullText SearchMode = "fulltext"
+)
+
 // ReportUpdateParams параметры для обновления отчета
 type ReportUpdateParams struct {
 	Title       *string              `json:"title,omitempty"`
@@ -137,47 +377,203 @@ type ReportList struct {
 // ReportServiceImpl реализация сервиса отчетов
 type ReportServiceImpl struct {
 	repository  ReportRepository
-	generator   ReportGenerator
+	reader      ReportRepository
+	generators  FormatGenerators
 	fileStorage ReportFileStorage
 	processor   BackgroundProcessor
-	logger      *logrus.Logger
-
-	// Канал для отмены генерации
-	cancellations sync.Map // map[uint]context.CancelFunc
+	bus         events.Bus
+	schemas     ParameterSchemas
+	definitions DefinitionRepository
+	quotas      QuotaChecker
+	cache       ResultCachePolicy
+	archive     *reportArchive
+	attachments AttachmentRepository
+	renditions  RenditionRepository
+	estimator   *QueueEstimator
+	settings    UserSettingsRepository
+	deadLetters DeadLetterRepository
+	logger      logging.Logger
 }
 
 // NewReportService создает новый сервис отчетов
 func NewReportService(
 	repository ReportRepository,
-	generator ReportGenerator,
+	generators FormatGenerators,
 	fileStorage ReportFileStorage,
 	processor BackgroundProcessor,
-	logger *logrus.Logger,
-) ReportService {
+	bus events.Bus,
+	logger logging.Logger,
+) *ReportServiceImpl {
 	return &ReportServiceImpl{
 		repository:  repository,
-		generator:   generator,
+		reader:      repository,
+		generators:  generators,
 		fileStorage: fileStorage,
 		processor:   processor,
+		bus:         bus,
 		logger:      logger,
 	}
 }
 
-// CreateReport создает новый отчет
+// WithReader задает репозиторий для списков и карточек отчетов, например на реплике БД.
+// Изменения отчетов по-прежнему выполняются через основной репозиторий.
+func (s *ReportServiceImpl) WithReader(reader ReportRepository) *ReportServiceImpl {
+	s.reader = reader
+	return s
+}
+
+// WithSchemas задает схемы параметров для типов отчетов
+func (s *ReportServiceImpl) WithSchemas(schemas ParameterSchemas) *ReportServiceImpl {
+	s.schemas = schemas
+	return s
+}
+
+// WithDefinitions задает репозиторий определений отчетов, на которые ссылается тип отчета
+func (s *ReportServiceImpl) WithDefinitions(definitions DefinitionRepository) *ReportServiceImpl {
+	s.definitions = definitions
+	return s
+}
+
+// WithQuotas задает проверку лимитов пользователя перед созданием отчета
+func (s *ReportServiceImpl) WithQuotas(quotas QuotaChecker) *ReportServiceImpl {
+	s.quotas = quotas
+	return s
+}
+
+// WithAttachments подключает приложенные файлы: они возвращаются с отчетом и удаляются вместе с ним
+func (s *ReportServiceImpl) WithAttachments(attachments AttachmentRepository) *ReportServiceImpl {
+	s.attachments = attachments
+	return s
+}
+
+// WithRenditions подключает файлы отчетов в других форматах, построенные по снимку данных:
+// они возвращаются с отчетом, скачиваются как файлы архива и удаляются вместе с отчетом
+func (s *ReportServiceImpl) WithRenditions(renditions RenditionRepository) *ReportServiceImpl {
+	s.renditions = renditions
+	return s
+}
+
+// WithQueueEstimator подключает оценку положения в очереди и времени готовности отчетов,
+// ожидающих генерации и генерируемых
+func (s *ReportServiceImpl) WithQueueEstimator(estimator *QueueEstimator) *ReportServiceImpl {
+	s.estimator = estimator
+	return s
+}
+
+// WithUserSettings подключает настройки пользователей: формат, локаль и часовой пояс
+// новых отчетов и размер страницы списка по умолчанию
+func (s *ReportServiceImpl) WithUserSettings(settings UserSettingsRepository) *ReportServiceImpl {
+	s.settings = settings
+	return s
+}
+
+// WithDeadLetters подключает задачи, исчерпавшие попытки: при повторном запуске упавшего
+// отчета сменой статуса они отмечаются поставленными в очередь повторно
+func (s *ReportServiceImpl) WithDeadLetters(deadLetters DeadLetterRepository) *ReportServiceImpl {
+	s.deadLetters = deadLetters
+	return s
+}
+
+// WithResultCache задает повторное использование файлов отчетов с одинаковыми параметрами
+func (s *ReportServiceImpl) WithResultCache(cache ResultCachePolicy) *ReportServiceImpl {
+	s.cache = cache
+	return s
+}
+
+// CreateReport создает новый отчет. Если включено повторное использование файлов и
+// в контексте нет WithForceGeneration, отчет по определению получает копию файла
+// недавнего отчета с теми же параметрами вместо генерации.
 func (s *ReportServiceImpl) CreateReport(ctx context.Context, report *models.Report) error {
-	logger := s.logger.WithFields(logrus.Fields{
+	report.CreatedBy = actorOr(ctx, report.CreatedBy)
+	if actor := ActorFromContext(ctx); actor != "" {
+		report.UpdatedBy = actor
+	}
+	report.Unmasked = unmaskedAllowed(ctx)
+
+	logger := logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
 		"title":      report.Title,
+		"type":       report.Type,
 		"created_by": report.CreatedBy,
 	})
 
 	logger.Info("Создание нового отчета")
 
+	// Значения по умолчанию, в том числе из настроек автора
+	settings := loadUserSettings(ctx, s.settings, report.CreatedBy, s.logger)
+	applyUserSettings(report, settings)
+	if report.Status == "" {
+		report.Status = models.StatusPending
+	}
+	if report.Priority == "" {
+		report.Priority = models.PriorityNormal
+	}
+
+	// Список форматов в параметре bundle означает архив с файлами этих форматов
+	bundle, bundled, _ := report.BundleFormats()
+	if bundled && report.Format == "" {
+		report.Format = models.FormatZIP
+	}
+
+	// Тип отчета может ссылаться на определение: формат берется из него
+	definition, err := s.findDefinition(ctx, report.Type)
+	if err != nil {
+		logger.WithError(err).Error("Ошибка получения определения отчета")
+		return fmt.Errorf("ошибка создания отчета: %w", err)
+	}
+	if definition != nil {
+		report.DefinitionID = &definition.ID
+		if report.Format == "" || (definition.HasTemplate() && report.Format != models.FormatZIP) {
+			report.Format = definition.Format
+		}
+	}
+
+	if report.Format == "" {
+		report.Format = settings.DefaultFormat
+	}
+	if report.Format == "" {
+		report.Format = models.DefaultFormat
+	}
+	// Проверяем, что форматы отчета и файлов архива поддерживаются
+	for _, format := range append([]models.ReportFormat{report.Format}, bundle...) {
+		if format.IsTemplated() && definition == nil {
+			return fmt.Errorf("%w: %s", ErrTemplateRequired, format)
+		}
+		if _, err := s.generators.ForFormat(format); err != nil {
+			logger.WithError(err).Error("Неподдерживаемый формат отчета")
+			return fmt.Errorf("ошибка валидации отчета: %w", err)
+		}
+	}
+
+	// Пароль файла убирается из параметров до проверки по схеме и сохранения
+	if err := applyFilePassword(report); err != nil {
+		logger.WithError(err).Warn("Пароль файла отчета задан неверно")
+		return fmt.Errorf("ошибка валидации отчета: %w", err)
+	}
+
 	// Валидация отчета
 	if err := report.Validate(); err != nil {
 		logger.WithError(err).Error("Ошибка валидации отчета")
 		return fmt.Errorf("ошибка валидации отчета: %w", err)
 	}
 
+	// Проверка параметров по схеме типа отчета
+	if err := s.validateReportParameters(definition, report.Type, report.Parameters); err != nil {
+		logger.WithError(err).Warn("Параметры отчета не прошли проверку")
+		return fmt.Errorf("ошибка валидации параметров отчета: %w", err)
+	}
+
+	// Лимиты пользователя проверяются последними: некорректный запрос не должен их расходовать
+	if s.quotas != nil {
+		if err := s.quotas.Check(ctx, report.CreatedBy); err != nil {
+			return fmt.Errorf("ошибка создания отчета: %w", err)
+		}
+	}
+
+	// Файл, зашифрованный паролем, не берется из готового отчета и не отдается другим отчетам
+	if s.cache.Enabled() && definition != nil && !report.PasswordProtected {
+		s.applyResultCache(ctx, report, definition, logger)
+	}
+
 	// Сохранение в БД
 	if err := s.repository.Create(ctx, report); err != nil {
 		logger.WithError(err).Error("Ошибка сохранения отчета в БД")
@@ -185,37 +581,52 @@ func (s *ReportServiceImpl) CreateReport(ctx context.Context, report *models.Rep
 	}
 
 	logger.WithField("report_id", report.ID).Info("Отчет создан, запуск генерации")
+	publishEvent(ctx, s.bus, logger, events.NewEvent(events.ReportCreated, report.ID, report.Status))
 
 	// Запуск фоновой генерации
-	task := Task{
-		ID:       fmt.Sprintf("report_%d", report.ID),
-		Type:     TaskTypeReportGeneration,
-		Data:     report.ID,
-		Priority: PriorityNormal,
-		Timeout:  defaultGenerationTimeout,
-	}
-
-	if err := s.processor.SubmitTask(ctx, task); err != nil {
+	if err := s.processor.SubmitTask(ctx, newReportTask(ctx, report)); err != nil {
 		logger.WithError(err).Error("Ошибка запуска фоновой генерации")
-		// Обновляем статус на failed
-		s.updateReportStatus(ctx, report.ID, models.StatusFailed, "")
+		if failErr := failReport(ctx, s.repository, s.bus, logger.WithField("report_id", report.ID), report.ID, err); failErr != nil {
+			logger.WithError(failErr).Error("Ошибка обновления статуса на failed")
+		}
 		return fmt.Errorf("ошибка запуска генерации отчета: %w", err)
 	}
 
 	return nil
 }
 
-// GetReport получает отчет по ID
+// GetReport получает отчет по ID. Отчет, которого еще нет на реплике из-за задержки
+// репликации, читается из основной БД.
 func (s *ReportServiceImpl) GetReport(ctx context.Context, id uint) (*models.Report, error) {
-	report, err := s.repository.GetByID(ctx, id)
+	report, err := s.reader.GetByID(ctx, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) && s.reader != s.repository {
+		report, err = s.repository.GetByID(ctx, id)
+	}
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("отчет с ID %d не найден", id)
+			return nil, fmt.Errorf("%w: %d", ErrReportNotFound, id)
 		}
-		s.logger.WithError(err).WithField("report_id", id).Error("Ошибка получения отчета")
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("report_id", id).Error("Ошибка получения отчета")
 		return nil, fmt.Errorf("ошибка получения отчета: %w", err)
 	}
 
+	if s.attachments != nil {
+		if report.Attachments, err = s.attachments.ListByReport(ctx, id); err != nil {
+			return nil, fmt.Errorf("ошибка получения приложенных файлов: %w", err)
+		}
+	}
+	if s.renditions != nil {
+		if report.Renditions, err = s.renditions.ListByReport(ctx, id); err != nil {
+			return nil, fmt.Errorf("ошибка получения файлов отчета в других форматах: %w", err)
+		}
+	}
+	// Без оценки очереди отчет остается доступен
+	if s.estimator != nil {
+		if report.Queue, err = s.estimator.Estimate(ctx, report); err != nil {
+			logging.FromContext(ctx, s.logger).WithError(err).WithField("report_id", id).Warn("Ошибка оценки времени готовности отчета")
+			report.Queue = nil
+		}
+	}
 	return report, nil
 }
 
@@ -225,16 +636,22 @@ func (s *ReportServiceImpl) ListReports(ctx context.Context, params ListReportPa
 	if params.Page <= 0 {
 		params.Page = 1
 	}
+	if params.PageSize <= 0 {
+		params.PageSize = loadUserSettings(ctx, s.settings, ActorFromContext(ctx), s.logger).PageSize
+	}
 	if params.PageSize <= 0 {
 		params.PageSize = 20
 	}
 	if params.PageSize > 100 {
 		params.PageSize = 100
 	}
+	if params.SortBy != "" && !reportSortFields[params.SortBy] {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSortField, params.SortBy)
+	}
 
-	reports, total, err := s.repository.List(ctx, params)
+	reports, total, err := s.reader.List(ctx, params)
 	if err != nil {
-		s.logger.WithError(err).Error("Ошибка получения списка отчетов")
+		logging.FromContext(ctx, s.logger).WithError(err).Error("Ошибка получения списка отчетов")
 		return nil, fmt.Errorf("ошибка получения списка отчетов: %w", err)
 	}
 
@@ -251,7 +668,8 @@ func (s *ReportServiceImpl) ListReports(ctx context.Context, params ListReportPa
 
 // UpdateReport обновляет отчет
 func (s *ReportServiceImpl) UpdateReport(ctx context.Context, id uint, params ReportUpdateParams) error {
-	logger := s.logger.WithFields(logrus.Fields{
+	params.UpdatedBy = actorOr(ctx, params.UpdatedBy)
+	logger := logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
 		"report_id":  id,
 		"updated_by": params.UpdatedBy,
 	})
@@ -260,7 +678,7 @@ func (s *ReportServiceImpl) UpdateReport(ctx context.Context, id uint, params Re
 	report, err := s.repository.GetByID(ctx, id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("отчет с ID %d не найден", id)
+			return fmt.Errorf("%w: %d", ErrReportNotFound, id)
 		}
 		return fmt.Errorf("ошибка получения отчета: %w", err)
 	}
@@ -277,19 +695,29 @@ func (s *ReportServiceImpl) UpdateReport(ctx context.Context, id uint, params Re
 		updates["description"] = *params.Description
 	}
 	if params.Parameters != nil {
+		var definition *models.ReportDefinition
+		if report.DefinitionID != nil && s.definitions != nil {
+			if definition, err = s.definitions.GetByID(ctx, *report.DefinitionID); err != nil {
+				return fmt.Errorf("ошибка получения определения отчета: %w", err)
+			}
+		}
+		if err := s.validateReportParameters(definition, report.Type, *params.Parameters); err != nil {
+			return fmt.Errorf("ошибка валидации параметров отчета: %w", err)
+		}
 		updates["parameters"] = *params.Parameters
 	}
 
-	// Обработка изменения статуса
+	// Обработка изменения статуса: processing и completed выставляет только генерация
 	if params.Status != nil {
-		if !report.Status.CanTransitionTo(*params.Status) {
-			return fmt.Errorf("невозможен переход со статуса %s на %s", report.Status, *params.Status)
+		status := *params.Status
+		if status == models.StatusProcessing || status == models.StatusCompleted {
+			return fmt.Errorf("%w: статус %s выставляется только генерацией отчета", ErrInvalidStatusTransition, status)
 		}
-		updates["status"] = *params.Status
-
-		// Если отменяем генерацию
-		if *params.Status == models.StatusCanceled {
-			s.cancelGeneration(id)
+		if !report.Status.CanTransitionTo(status) {
+			return fmt.Errorf("%w: невозможен переход со статуса %s на %s", ErrInvalidStatusTransition, report.Status, status)
+		}
+		if status == models.StatusFailed {
+			updates["status"] = status
 		}
 	}
 
@@ -298,27 +726,60 @@ func (s *ReportServiceImpl) UpdateReport(ctx context.Context, id uint, params Re
 		return fmt.Errorf("ошибка обновления отчета: %w", err)
 	}
 
+	// Отмена и повторный запуск проходят тем же путем, что и в API отмены и администрирования
+	if params.Status != nil {
+		switch *params.Status {
+		case models.StatusCanceled:
+			if err := s.CancelReportGeneration(ctx, id); err != nil {
+				return err
+			}
+		case models.StatusPending:
+			if err := s.requeueReport(ctx, id, report.Status); err != nil {
+				return err
+			}
+		case models.StatusFailed:
+			publishEvent(ctx, s.bus, logger, events.NewEvent(events.ReportFailed, id, models.StatusFailed))
+		}
+	}
+
 	logger.Info("Отчет обновлен успешно")
 	return nil
 }
 
 // DeleteReport удаляет отчет
 func (s *ReportServiceImpl) DeleteReport(ctx context.Context, id uint) error {
-	logger := s.logger.WithField("report_id", id)
+	logger := logging.FromContext(ctx, s.logger).WithField("report_id", id)
 
 	// Получаем отчет для проверки существования и получения file_key
 	report, err := s.repository.GetByID(ctx, id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("отчет с ID %d не найден", id)
+			return fmt.Errorf("%w: %d", ErrReportNotFound, id)
 		}
 		return fmt.Errorf("ошибка получения отчета: %w", err)
 	}
 
-	// Отменяем генерацию, если она идет
-	s.cancelGeneration(id)
+	// Отменяем генерацию, если она идет или ожидает в очереди
+	if report.Status == models.StatusPending || report.Status == models.StatusProcessing {
+		if err := s.processor.CancelTask(reportTaskID(id)); err != nil && !errors.Is(err, ErrTaskNotFound) && !errors.Is(err, ErrTaskFinished) {
+			logger.WithError(err).Warn("Ошибка отмены задачи удаляемого отчета в процессоре")
+		}
+	}
+
+	// Отчет и ссылки на него удаляются вместе: ссылка не должна пережить отчет
+	err = s.repository.Transaction(ctx, func(repository ReportRepository) error {
+		if err := repository.Delete(ctx, id); err != nil {
+			return err
+		}
+		return repository.DeleteLinks(ctx, id)
+	})
+	if err != nil {
+		logger.WithError(err).Error("Ошибка удаления отчета из БД")
+		return fmt.Errorf("ошибка удаления отчета: %w", err)
+	}
 
-	// Удаляем файл из хранилища, если он существует
+	// Файл удаляется после фиксации транзакции: при ошибке в БД отчет
+	// остается со своим файлом, а не ссылается на удаленный
 	if report.HasFile() {
 		if err := s.fileStorage.Delete(ctx, report.FileKey); err != nil {
 			logger.WithError(err).WithField("file_key", report.FileKey).
@@ -326,44 +787,67 @@ func (s *ReportServiceImpl) DeleteReport(ctx context.Context, id uint) error {
 			// Не прерываем удаление отчета из-за ошибки удаления файла
 		}
 	}
-
-	// Удаляем отчет из БД
-	if err := s.repository.Delete(ctx, id); err != nil {
-		logger.WithError(err).Error("Ошибка удаления отчета из БД")
-		return fmt.Errorf("ошибка удаления отчета: %w", err)
+	if report.SnapshotKey != "" {
+		if err := s.fileStorage.Delete(ctx, report.SnapshotKey); err != nil {
+			logger.WithError(err).WithField("snapshot_key", report.SnapshotKey).
+				Error("Ошибка удаления снимка данных отчета")
+		}
+	}
+	if s.attachments != nil {
+		s.deleteAttachments(ctx, id, logger)
+	}
+	if s.renditions != nil {
+		s.deleteRenditions(ctx, id, logger)
 	}
 
+	publishEvent(ctx, s.bus, logger, events.NewEvent(events.ReportDeleted, id, report.Status))
+
 	logger.WithField("title", report.Title).Info("Отчет удален успешно")
 	return nil
 }
 
+// deleteAttachments удаляет приложенные к удаленному отчету файлы. Ошибки только
+// записываются в лог: отчет уже удален
+func (s *ReportServiceImpl) deleteAttachments(ctx context.Context, id uint, logger logging.Logger) {
+	attachments, err := s.attachments.ListByReport(ctx, id)
+	if err != nil {
+		logger.WithError(err).Error("Ошибка получения приложенных файлов удаленного отчета")
+		return
+	}
+	for _, attachment := range attachments {
+		if err := s.attachments.Delete(ctx, id, attachment.ID); err != nil {
+			logger.WithError(err).WithField("attachment_id", attachment.ID).Error("Ошибка удаления приложенного файла")
+			continue
+		}
+		if err := s.fileStorage.Delete(ctx, attachment.FileKey); err != nil {
+			logger.WithError(err).WithField("file_key", attachment.FileKey).Error("Ошибка удаления приложенного файла")
+		}
+	}
+}
+
 // CancelReportGeneration отменяет генерацию отчета
 func (s *ReportServiceImpl) CancelReportGeneration(ctx context.Context, id uint) error {
-	logger := s.logger.WithField("report_id", id)
+	logger := logging.FromContext(ctx, s.logger).WithField("report_id", id)
 
 	// Проверяем существование отчета
 	report, err := s.repository.GetByID(ctx, id)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("отчет с ID %d не найден", id)
+			return fmt.Errorf("%w: %d", ErrReportNotFound, id)
 		}
 		return fmt.Errorf("ошибка получения отчета: %w", err)
 	}
 
 	// Проверяем, что отчет можно отменить
 	if !report.Status.CanTransitionTo(models.StatusCanceled) {
-		return fmt.Errorf("отчет в статусе %s нельзя отменить", report.Status)
+		return fmt.Errorf("%w: отчет в статусе %s нельзя отменить", ErrInvalidStatusTransition, report.Status)
 	}
 
 	// Отменяем задачу в процессоре
-	taskID := fmt.Sprintf("report_%d", id)
-	if err := s.processor.CancelTask(taskID); err != nil {
+	if err := s.processor.CancelTask(reportTaskID(id)); err != nil {
 		logger.WithError(err).Error("Ошибка отмены задачи в процессоре")
 	}
 
-	// Отменяем генерацию
-	s.cancelGeneration(id)
-
 	// Обновляем статус
 	if err := s.updateReportStatus(ctx, id, models.StatusCanceled, ""); err != nil {
 		return fmt.Errorf("ошибка обновления статуса отчета: %w", err)
@@ -374,165 +858,213 @@ func (s *ReportServiceImpl) CancelReportGeneration(ctx context.Context, id uint)
 }
 
 // GetReportFile возвращает файл отчета
-func (s *ReportServiceImpl) GetReportFile(ctx context.Context, id uint) (io.ReadCloser, string, error) {
-	report, err := s.repository.GetByID(ctx, id)
+func (s *ReportServiceImpl) GetReportFile(ctx context.Context, id uint) (*ReportFile, error) {
+	report, generator, err := s.completedReport(ctx, id)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, "", fmt.Errorf("отчет с ID %d не найден", id)
-		}
-		return nil, "", fmt.Errorf("ошибка получения отчета: %w", err)
+		return nil, err
 	}
-
-	if !report.IsCompleted() {
-		return nil, "", fmt.Errorf("отчет еще не готов")
+	if err := s.archive.ensureReadable(ctx, report, logging.FromContext(ctx, s.logger).WithField("report_id", id)); err != nil {
+		return nil, err
 	}
 
-	if !report.HasFile() {
-		return nil, "", fmt.Errorf("файл отчета не найден")
+	// Размер нужен только для Content-Length, поэтому его отсутствие не ошибка
+	size, err := s.fileStorage.Size(ctx, report.FileKey)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("file_key", report.FileKey).
+			Warn("Не удалось получить размер файла отчета")
+		size = -1
 	}
 
 	reader, err := s.fileStorage.Get(ctx, report.FileKey)
 	if err != nil {
-		s.logger.WithError(err).WithField("file_key", report.FileKey).
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("file_key", report.FileKey).
 			Error("Ошибка получения файла из хранилища")
-		return nil, "", fmt.Errorf("ошибка получения файла: %w", err)
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
 	}
 
-	filename := fmt.Sprintf("%s.%s", report.Title, s.generator.GetFileExtension())
-	return reader, filename, nil
+	filename, contentType, encoding := downloadFile(report, generator)
+	return &ReportFile{
+		Reader:          verifyChecksum(reader, report.Checksum),
+		Filename:        filename,
+		ContentType:     contentType,
+		ContentEncoding: encoding,
+		Size:            size,
+		Checksum:        report.Checksum,
+	}, nil
 }
 
-// cancelGeneration отменяет генерацию отчета
-func (s *ReportServiceImpl) cancelGeneration(reportID uint) {
-	if cancel, exists := s.cancellations.LoadAndDelete(reportID); exists {
-		if cancelFunc, ok := cancel.(context.CancelFunc); ok {
-			cancelFunc()
-		}
+// GetReportFileRange возвращает length байт файла отчета начиная с offset в том виде,
+// в котором файл сохранен. Часть файла нельзя сверить с контрольной суммой, поэтому
+// Checksum относится ко всему файлу и проверяется клиентом после докачки.
+func (s *ReportServiceImpl) GetReportFileRange(ctx context.Context, id uint, offset, length int64) (*ReportFile, error) {
+	report, generator, err := s.completedReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.archive.ensureReadable(ctx, report, logging.FromContext(ctx, s.logger).WithField("report_id", id)); err != nil {
+		return nil, err
 	}
-}
-
-// updateReportStatus обновляет статус отчета
-func (s *ReportServiceImpl) updateReportStatus(ctx context.Context, id uint, status models.ReportStatus, fileKey string) error {
-	return s.repository.UpdateStatus(ctx, id, status, fileKey)
-}
 
-// ExcelReportGenerator генератор Excel отчетов
-type ExcelReportGenerator struct {
-	logger *logrus.Logger
-}
+	reader, err := s.fileStorage.GetRange(ctx, report.FileKey, offset, length)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithFields(logging.Fields{
+			"file_key": report.FileKey,
+			"offset":   offset,
+			"length":   length,
+		}).Error("Ошибка получения части файла из хранилища")
+		return nil, fmt.Errorf("ошибка получения файла: %w", err)
+	}
 
-// NewExcelReportGenerator создает новый генератор Excel отчетов
-func NewExcelReportGenerator(logger *logrus.Logger) ReportGenerator {
-	return &ExcelReportGenerator{logger: logger}
+	filename, contentType, encoding := downloadFile(report, generator)
+	return &ReportFile{
+		Reader:          reader,
+		Filename:        filename,
+		ContentType:     contentType,
+		ContentEncoding: encoding,
+		Size:            length,
+		Checksum:        report.Checksum,
+	}, nil
 }
 
-// Generate генерирует Excel отчет
-func (g *ExcelReportGenerator) Generate(ctx context.Context, report *models.Report) (io.Reader, string, error) {
-	logger := g.logger.WithFields(logrus.Fields{
-		"report_id": report.ID,
-		"title":     report.Title,
-	})
+// GetReportDownloadURL возвращает временную ссылку на файл отчета в хранилище
+func (s *ReportServiceImpl) GetReportDownloadURL(ctx context.Context, id uint, expiration time.Duration) (*ReportDownloadURL, error) {
+	report, generator, err := s.completedReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.archive.ensureReadable(ctx, report, logging.FromContext(ctx, s.logger).WithField("report_id", id)); err != nil {
+		return nil, err
+	}
 
-	logger.Info("Генерация Excel отчета")
-
-	f := excelize.NewFile()
-	defer f.Close()
-
-	sheet := "Report"
-	f.SetSheetName("Sheet1", sheet)
-
-	// Стиль для заголовков
-	headerStyle, err := f.NewStyle(&excelize.Style{
-		Font: &excelize.Font{
-			Bold: true,
-			Size: 12,
-		},
-		Fill: excelize.Fill{
-			Type:    "pattern",
-			Color:   []string{"#E6E6FA"},
-			Pattern: 1,
-		},
-		Border: []excelize.Border{
-			{Type: "left", Color: "000000", Style: 1},
-			{Type: "top", Color: "000000", Style: 1},
-			{Type: "bottom", Color: "000000", Style: 1},
-			{Type: "right", Color: "000000", Style: 1},
-		},
-	})
+	url, err := s.fileStorage.PresignedURL(ctx, report.FileKey, expiration)
 	if err != nil {
-		logger.WithError(err).Warn("Ошибка создания стиля заголовка")
+		return nil, fmt.Errorf("ошибка получения ссылки на файл: %w", err)
 	}
 
-	// Заголовки
-	headers := []string{"Параметр", "Значение"}
-	for i, header := range headers {
-		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
-		f.SetCellValue(sheet, cell, header)
-		if headerStyle != 0 {
-			f.SetCellStyle(sheet, cell, cell, headerStyle)
+	filename, _, _ := downloadFile(report, generator)
+	return &ReportDownloadURL{
+		URL:       url,
+		Filename:  filename,
+		ExpiresAt: time.Now().UTC().Add(expiration),
+	}, nil
+}
+
+// SubscribeStatus подписывается на смены статуса отчета до отмены контекста
+func (s *ReportServiceImpl) SubscribeStatus(ctx context.Context, id uint) (<-chan events.Event, error) {
+	if _, err := s.repository.GetByID(ctx, id); err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %d", ErrReportNotFound, id)
 		}
+		return nil, fmt.Errorf("ошибка получения отчета: %w", err)
 	}
 
-	// Данные отчета
-	data := [][]interface{}{
-		{"ID отчета", report.ID},
-		{"Название", report.Title},
-		{"Описание", report.Description},
-		{"Статус", string(report.Status)},
-		{"Создал", report.CreatedBy},
-		{"Дата создания", report.CreatedAt.Format("2006-01-02 15:04:05")},
-	}
+	return subscribeReport(ctx, s.bus, id), nil
+}
 
-	// Добавляем параметры
-	if report.Parameters != nil && !report.Parameters.IsEmpty() {
-		data = append(data, []interface{}{"--- Параметры ---", ""})
-		for key, value := range report.Parameters {
-			data = append(data, []interface{}{key, fmt.Sprintf("%v", value)})
+// completedReport возвращает готовый отчет с файлом и генератор его формата
+func (s *ReportServiceImpl) completedReport(ctx context.Context, id uint) (*models.Report, ReportGenerator, error) {
+	report, err := s.repository.GetByID(ctx, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, fmt.Errorf("%w: %d", ErrReportNotFound, id)
 		}
+		return nil, nil, fmt.Errorf("ошибка получения отчета: %w", err)
 	}
 
-	// Заполняем данные
-	for rowIndex, row := range data {
-		for colIndex, value := range row {
-			cell, _ := excelize.CoordinatesToCellName(colIndex+1, rowIndex+2)
-			f.SetCellValue(sheet, cell, value)
-		}
+	if !report.IsCompleted() {
+		return nil, nil, fmt.Errorf("%w: %d", ErrReportNotReady, id)
+	}
+
+	if !report.HasFile() {
+		return nil, nil, fmt.Errorf("%w: %d", ErrReportFileNotFound, id)
 	}
 
-	// Автоширина колонок
-	f.SetColWidth(sheet, "A", "B", 30)
+	generator, err := s.generators.ForFormat(report.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return report, generator, nil
+}
+
+// reportFilename возвращает имя файла отчета для клиента
+func reportFilename(report *models.Report, generator ReportGenerator) string {
+	return fmt.Sprintf("%s.%s", report.Title, generator.GetFileExtension())
+}
+
+// findDefinition возвращает определение, на которое ссылается тип отчета, или nil
+func (s *ReportServiceImpl) findDefinition(ctx context.Context, reportType string) (*models.ReportDefinition, error) {
+	if reportType == "" || s.definitions == nil {
+		return nil, nil
+	}
 
-	// Генерируем буфер
-	var buffer bytes.Buffer
-	if err := f.Write(&buffer); err != nil {
-		logger.WithError(err).Error("Ошибка записи Excel файла")
-		return nil, "", fmt.Errorf("ошибка генерации Excel файла: %w", err)
+	definition, err := s.definitions.GetByName(ctx, reportType)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
 
-	filename := fmt.Sprintf("report_%d_%s.xlsx", report.ID, time.Now().Format("20060102_150405"))
+// validateReportParameters проверяет параметры по схеме определения,
+// а для отчетов без определения - по схеме типа из конфигурации
+func (s *ReportServiceImpl) validateReportParameters(definition *models.ReportDefinition, reportType string, params models.JSON) error {
+	if definition == nil {
+		return validateParameters(s.schemas, reportType, params)
+	}
 
-	logger.WithField("filename", filename).Info("Excel отчет сгенерирован успешно")
-	return &buffer, filename, nil
+	parameterSchema, err := definitionSchema(definition)
+	if err != nil {
+		return fmt.Errorf("ошибка схемы параметров определения %s: %w", definition.Name, err)
+	}
+	if parameterSchema == nil {
+		return nil
+	}
+	return parameterSchema.Validate(params)
 }
 
-// GetMimeType возвращает MIME тип для Excel файлов
-func (g *ExcelReportGenerator) GetMimeType() string {
-	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+// requeueReport повторно ставит упавший или отмененный отчет в очередь генерации
+func (s *ReportServiceImpl) requeueReport(ctx context.Context, id uint, from models.ReportStatus) error {
+	requeuer := reportRequeuer{
+		reports:     s.repository,
+		deadLetters: s.deadLetters,
+		processor:   s.processor,
+		publisher:   s.bus,
+		logger:      s.logger,
+		now:         time.Now,
+	}
+	claimed, err := requeuer.requeue(ctx, id, from)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return fmt.Errorf("%w: отчет %d уже не в статусе %s", ErrInvalidStatusTransition, id, from)
+	}
+	return nil
 }
 
-// GetFileExtension возвращает расширение файла для Excel
-func (g *ExcelReportGenerator) GetFileExtension() string {
-	return "xlsx"
+// updateReportStatus обновляет статус отчета
+func (s *ReportServiceImpl) updateReportStatus(ctx context.Context, id uint, status models.ReportStatus, fileKey string) error {
+	if err := s.repository.UpdateStatus(ctx, id, status, fileKey); err != nil {
+		return err
+	}
+
+	if eventType, ok := events.TypeForStatus(status); ok {
+		publishEvent(ctx, s.bus, logging.FromContext(ctx, s.logger).WithField("report_id", id), events.NewEvent(eventType, id, status).WithFileKey(fileKey))
+	}
+	return nil
 }
 
 // ReportFileStorageImpl реализация хранилища файлов отчетов
 type ReportFileStorageImpl struct {
 	storage storage.Storage
-	logger  *logrus.Logger
+	logger  logging.Logger
 }
 
 // NewReportFileStorage создает новое хранилище файлов отчетов
-func NewReportFileStorage(storage storage.Storage, logger *logrus.Logger) ReportFileStorage {
+func NewReportFileStorage(storage storage.Storage, logger logging.Logger) ReportFileStorage {
 	return &ReportFileStorageImpl{
 		storage: storage,
 		logger:  logger,
@@ -549,27 +1081,54 @@ func (s *ReportFileStorageImpl) Get(ctx context.Context, key string) (io.ReadClo
 	return s.storage.Get(ctx, key)
 }
 
+// GetRange получает часть файла из хранилища
+func (s *ReportFileStorageImpl) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	return s.storage.GetRange(ctx, key, offset, length)
+}
+
 // Delete удаляет файл из хранилища
 func (s *ReportFileStorageImpl) Delete(ctx context.Context, key string) error {
 	return s.storage.Delete(ctx, key)
 }
 
-// GenerateKey генерирует ключ для файла отчета
-func (s *ReportFileStorageImpl) GenerateKey(report *models.Report) string {
-	return fmt.Sprintf("reports/%d/%s_%s.xlsx",
+// Size возвращает размер файла в хранилище
+func (s *ReportFileStorageImpl) Size(ctx context.Context, key string) (int64, error) {
+	return s.storage.GetSize(ctx, key)
+}
+
+// PresignedURL возвращает временную ссылку на файл в хранилище
+func (s *ReportFileStorageImpl) PresignedURL(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return s.storage.GetPresignedURL(ctx, key, expiration)
+}
+
+// Copy копирует файл в хранилище
+func (s *ReportFileStorageImpl) Copy(ctx context.Context, srcKey, dstKey string) error {
+	return s.storage.Copy(ctx, srcKey, dstKey)
+}
+
+// GenerateKey генерирует ключ для файла отчета. Название отчета приводится к латинице
+// без пробелов и слешей, поэтому ключ безопасен для локального хранилища и S3.
+// Время в имени файла выводится в часовом поясе отчета.
+func (s *ReportFileStorageImpl) GenerateKey(report *models.Report, extension string) string {
+	name := storage.KeySegment(report.Title)
+	if name == "" {
+		name = "report"
+	}
+	return fmt.Sprintf("reports/%d/%s_%s.%s",
 		report.ID,
-		report.Title,
-		time.Now().Format("20060102150405"))
+		name,
+		report.LocalTime(time.Now()).Format("20060102150405"),
+		extension)
 }
 
 // GormReportRepository реализация репозитория отчетов для GORM
 type GormReportRepository struct {
 	db     *gorm.DB
-	logger *logrus.Logger
+	logger logging.Logger
 }
 
 // NewGormReportRepository создает новый GORM репозиторий отчетов
-func NewGormReportRepository(db *gorm.DB, logger *logrus.Logger) ReportRepository {
+func NewGormReportRepository(db *gorm.DB, logger logging.Logger) ReportRepository {
 	return &GormReportRepository{
 		db:     db,
 		logger: logger,
@@ -596,11 +1155,36 @@ func (r *GormReportRepository) List(ctx context.Context, params ListReportParams
 	if params.Status != nil {
 		query = query.Where("status = ?", *params.Status)
 	}
+	if params.Format != nil {
+		query = query.Where("format = ?", *params.Format)
+	}
+	if params.CreatedBy != "" {
+		query = query.Where("created_by = ?", params.CreatedBy)
+	}
+
+	// Фильтрация по периодам
+	if params.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *params.CreatedAfter)
+	}
+	if params.CreatedBefore != nil {
+		query = query.Where("created_at <= ?", *params.CreatedBefore)
+	}
+	if params.GeneratedAfter != nil {
+		query = query.Where("generated_at >= ?", *params.GeneratedAfter)
+	}
+	if params.GeneratedBefore != nil {
+		query = query.Where("generated_at <= ?", *params.GeneratedBefore)
+	}
 
 	// Поиск
+	fullText := false
 	if params.Search != "" {
-		searchPattern := "%" + params.Search + "%"
-		query = query.Where("title ILIKE ? OR description ILIKE ?", searchPattern, searchPattern)
+		fullText = params.SearchMode == SearchModeFullText && r.isPostgres()
+		if fullText {
+			query = query.Where(reportSearchVector+" @@ websearch_to_tsquery('russian', ?)", params.Search)
+		} else {
+			query = r.whereContains(query, params.Search)
+		}
 	}
 
 	// Подсчет общего количества
@@ -609,15 +1193,18 @@ func (r *GormReportRepository) List(ctx context.Context, params ListReportParams
 		return nil, 0, err
 	}
 
-	// Сортировка
-	if params.SortBy != "" {
-		order := params.SortBy
-		if params.SortDesc {
-			order += " DESC"
-		}
-		query = query.Order(order)
+	// Сортировка. ID в том же направлении, что и основное поле, делает порядок страниц
+	// устойчивым и совпадает с индексами idx_reports_*list (created_at DESC, id DESC)
+	if reportSortFields[params.SortBy] {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: params.SortBy}, Desc: params.SortDesc}).
+			Order(clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: params.SortDesc})
+	} else if fullText {
+		query = query.Order(clause.Expr{
+			SQL:  "ts_rank(" + reportSearchVector + ", websearch_to_tsquery('russian', ?)) DESC, created_at DESC, id DESC",
+			Vars: []interface{}{params.Search},
+		})
 	} else {
-		query = query.Order("created_at DESC")
+		query = query.Order("created_at DESC, id DESC")
 	}
 
 	// Пагинация
@@ -630,8 +1217,35 @@ func (r *GormReportRepository) List(ctx context.Context, params ListReportParams
 	return reports, total, err
 }
 
-// Update обновляет отчет
+// reportSearchVector выражение полнотекстового поиска по названию и описанию.
+// Совпадает с выражением индекса idx_reports_search, иначе Postgres не использует индекс.
+const reportSearchVector = "to_tsvector('russian', coalesce(title, '') || ' ' || coalesce(description, ''))"
+
+// likeEscaper экранирует служебные символы шаблона LIKE
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// isPostgres проверяет, работает ли репозиторий с PostgreSQL
+func (r *GormReportRepository) isPostgres() bool {
+	return r.db.Dialector.Name() == "postgres"
+}
+
+// whereContains добавляет регистронезависимый поиск подстроки в названии и описании.
+// ILIKE есть только в PostgreSQL, для остальных СУБД сравниваются строки в нижнем регистре.
+func (r *GormReportRepository) whereContains(query *gorm.DB, search string) *gorm.DB {
+	pattern := "%" + likeEscaper.Replace(search) + "%"
+	if r.isPostgres() {
+		return query.Where("title ILIKE ? ESCAPE '!' OR description ILIKE ? ESCAPE '!'", pattern, pattern)
+	}
+	return query.Where("LOWER(title) LIKE LOWER(?) ESCAPE '!' OR LOWER(description) LIKE LOWER(?) ESCAPE '!'", pattern, pattern)
+}
+
+// Update обновляет отчет. Изменение от имени пользователя записывается в updated_by.
 func (r *GormReportRepository) Update(ctx context.Context, id uint, updates map[string]interface{}) error {
+	// Карта вызывающего не меняется: он может использовать ее повторно
+	if actor := ActorFromContext(ctx); actor != "" {
+		updates = maps.Clone(updates)
+		updates["updated_by"] = actor
+	}
 	return r.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", id).Updates(updates).Error
 }
 
@@ -640,12 +1254,28 @@ func (r *GormReportRepository) Delete(ctx context.Context, id uint) error {
 	return r.db.WithContext(ctx).Delete(&models.Report{}, id).Error
 }
 
+// DeleteLinks удаляет публичные ссылки на отчет
+func (r *GormReportRepository) DeleteLinks(ctx context.Context, reportID uint) error {
+	return r.db.WithContext(ctx).Where("report_id = ?", reportID).Delete(&models.ReportLink{}).Error
+}
+
+// Transaction выполняет fn в транзакции базы данных. Вложенный вызов
+// в репозитории транзакции создает точку сохранения.
+func (r *GormReportRepository) Transaction(ctx context.Context, fn func(repository ReportRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormReportRepository{db: tx, logger: r.logger})
+	})
+}
+
 // UpdateStatus обновляет статус отчета
 func (r *GormReportRepository) UpdateStatus(ctx context.Context, id uint, status models.ReportStatus, fileKey string) error {
 	updates := map[string]interface{}{
 		"status":     status,
 		"updated_at": time.Now().UTC(),
 	}
+	if actor := ActorFromContext(ctx); actor != "" {
+		updates["updated_by"] = actor
+	}
 
 	if fileKey != "" {
 		updates["file_key"] = fileKey
@@ -654,69 +1284,473 @@ func (r *GormReportRepository) UpdateStatus(ctx context.Context, id uint, status
 	if status == models.StatusCompleted {
 		now := time.Now().UTC()
 		updates["generated_at"] = &now
+		updates["progress"] = 100
+	}
+
+	if status == models.StatusProcessing {
+		attemptUpdates(updates)
 	}
 
 	return r.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", id).Updates(updates).Error
 }
 
-// NewReportServiceFromDB создает полностью настроенный сервис отчетов (обратная совместимость)
-func NewReportServiceFromDB(db *gorm.DB, storage storage.Storage, logger *logrus.Logger) ReportService {
-	repository := NewGormReportRepository(db, logger)
-	generator := NewExcelReportGenerator(logger)
-	fileStorage := NewReportFileStorage(storage, logger)
-
-	// Создаем простой синхронный процессор для совместимости
-	processor := NewSyncBackgroundProcessor(repository, generator, fileStorage, logger)
+// StartAttempt переводит отчет в статус processing, увеличивает число попыток генерации
+// и сохраняет их предел. Повтор после временной ошибки застает отчет в статусе processing
+func (r *GormReportRepository) StartAttempt(ctx context.Context, id uint, maxAttempts int) (bool, error) {
+	updates := map[string]interface{}{
+		"status":       models.StatusProcessing,
+		"max_attempts": maxAttempts,
+		"updated_at":   time.Now().UTC(),
+	}
+	if actor := ActorFromContext(ctx); actor != "" {
+		updates["updated_by"] = actor
+	}
+	attemptUpdates(updates)
 
-	service := NewReportService(repository, generator, fileStorage, processor, logger)
+	result := r.db.WithContext(ctx).Model(&models.Report{}).
+		Where("id = ? AND status IN ?", id, []models.ReportStatus{models.StatusPending, models.StatusProcessing}).
+		Updates(updates)
+	return result.RowsAffected == 1, result.Error
+}
 
-	// Запускаем обработку фоновых задач для синхронного процессора
-	if syncProcessor, ok := processor.(*SyncBackgroundProcessor); ok {
-		go syncProcessor.Start()
+// Complete переводит генерируемый отчет в статус completed вместе со сведениями о файле
+func (r *GormReportRepository) Complete(ctx context.Context, id uint, fileKey string, updates map[string]interface{}) (bool, error) {
+	now := time.Now().UTC()
+	updates = maps.Clone(updates)
+	updates["status"] = models.StatusCompleted
+	updates["file_key"] = fileKey
+	updates["generated_at"] = &now
+	updates["progress"] = 100
+	updates["updated_at"] = now
+	if actor := ActorFromContext(ctx); actor != "" {
+		updates["updated_by"] = actor
 	}
 
-	return service
+	result := r.db.WithContext(ctx).Model(&models.Report{}).
+		Where("id = ? AND status = ?", id, models.StatusProcessing).
+		Updates(updates)
+	return result.RowsAffected == 1, result.Error
 }
 
-// SyncBackgroundProcessor простая синхронная реализация фонового процессора
-type SyncBackgroundProcessor struct {
-	repository    ReportRepository
-	generator     ReportGenerator
-	fileStorage   ReportFileStorage
-	logger        *logrus.Logger
-	tasks         chan Task
+// attemptUpdates добавляет изменения начала попытки генерации: новая попытка увеличивает
+// счетчик попыток и сбрасывает ход и причину предыдущей ошибки
+func attemptUpdates(updates map[string]interface{}) {
+	now := time.Now().UTC()
+	updates["attempts"] = gorm.Expr("attempts + 1")
+	updates["started_at"] = now
+	updates["heartbeat_at"] = now
+	updates["progress"] = 0
+	updates["rows_processed"] = 0
+	updates["error_code"] = ""
+	updates["error_message"] = ""
+}
+
+// UpdateProgress сохраняет ход генерации отчета. Время изменения отчета не обновляется
+func (r *GormReportRepository) UpdateProgress(ctx context.Context, id uint, progress int, rows int64) error {
+	return r.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"progress":       progress,
+		"rows_processed": rows,
+	}).Error
+}
+
+// Heartbeat подтверждает, что генерация отчета выполняется
+func (r *GormReportRepository) Heartbeat(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", id).
+		UpdateColumn("heartbeat_at", time.Now().UTC()).Error
+}
+
+// ListStale возвращает отчеты в статусе processing без heartbeat с момента before
+func (r *GormReportRepository) ListStale(ctx context.Context, before time.Time, limit int) ([]models.Report, error) {
+	var reports []models.Report
+	err := r.staleQuery(ctx, before).
+		Order("updated_at").
+		Limit(limit).
+		Find(&reports).Error
+	return reports, err
+}
+
+// ClaimStale возвращает прерванный отчет в статус pending и увеличивает счетчик перезапусков.
+// Обновление условное, поэтому отчет забирает только один экземпляр сервиса.
+func (r *GormReportRepository) ClaimStale(ctx context.Context, id uint, before time.Time) (bool, error) {
+	result := r.staleQuery(ctx, before).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":       models.StatusPending,
+			"recoveries":   gorm.Expr("recoveries + 1"),
+			"heartbeat_at": nil,
+			"updated_at":   time.Now().UTC(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// Requeue переводит отчет из статуса from в статус pending
+func (r *GormReportRepository) Requeue(ctx context.Context, id uint, from models.ReportStatus) (bool, error) {
+	updates := map[string]interface{}{
+		"status":        models.StatusPending,
+		"error_code":    "",
+		"error_message": "",
+		"progress":      0,
+		"attempts":      0,
+		"updated_at":    time.Now().UTC(),
+	}
+	if actor := ActorFromContext(ctx); actor != "" {
+		updates["updated_by"] = actor
+	}
+
+	result := r.db.WithContext(ctx).Model(&models.Report{}).
+		Where("id = ? AND status = ?", id, from).
+		Updates(updates)
+	return result.RowsAffected == 1, result.Error
+}
+
+// staleQuery выбирает прерванные отчеты. У отчетов, созданных до появления heartbeat,
+// учитывается время последнего изменения.
+func (r *GormReportRepository) staleQuery(ctx context.Context, before time.Time) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&models.Report{}).
+		Where("status = ?", models.StatusProcessing).
+		Where("heartbeat_at < ? OR (heartbeat_at IS NULL AND updated_at < ?)", before, before)
+}
+
+// MarkFailed переводит отчет в статус failed и сохраняет причину ошибки
+func (r *GormReportRepository) MarkFailed(ctx context.Context, id uint, code models.ReportErrorCode, message string) error {
+	return r.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":        models.StatusFailed,
+		"error_code":    code,
+		"error_message": message,
+		"updated_at":    time.Now().UTC(),
+	}).Error
+}
+
+// ListExpired возвращает готовые отчеты, срок хранения которых истек
+func (r *GormReportRepository) ListExpired(ctx context.Context, now time.Time, limit int) ([]models.Report, error) {
+	var reports []models.Report
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", models.StatusCompleted, now).
+		Order("expires_at").
+		Limit(limit).
+		Find(&reports).Error
+	return reports, err
+}
+
+// ListForTransition возвращает готовые отчеты с файлом в стандартном классе хранения,
+// сгенерированные не позже before
+func (r *GormReportRepository) ListForTransition(ctx context.Context, before time.Time, limit int) ([]models.Report, error) {
+	var reports []models.Report
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND file_key <> '' AND (storage_class IS NULL OR storage_class = '') AND generated_at <= ?",
+			models.StatusCompleted, before).
+		Order("generated_at").
+		Limit(limit).
+		Find(&reports).Error
+	return reports, err
+}
+
+// FindCached возвращает последний готовый отчет с ключом cacheKey, сгенерированный не раньше since
+func (r *GormReportRepository) FindCached(ctx context.Context, cacheKey string, since time.Time) (*models.Report, error) {
+	var report models.Report
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND cache_key = ? AND file_key <> '' AND generated_at >= ?", models.StatusCompleted, cacheKey, since).
+		Where("storage_class IS NULL OR storage_class NOT IN ?",
+			[]string{string(storage.StorageClassGlacier), string(storage.StorageClassDeepArchive)}).
+		Order("generated_at DESC").
+		First(&report).Error
+	return &report, err
+}
+
+// CountActiveByDefinition считает отчеты определения в очереди и в генерации
+func (r *GormReportRepository) CountActiveByDefinition(ctx context.Context, definitionID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Report{}).
+		Where("definition_id = ? AND status IN ?", definitionID,
+			[]models.ReportStatus{models.StatusPending, models.StatusProcessing}).
+		Count(&count).Error
+	return count, err
+}
+
+// ListRecentByDefinition возвращает отчеты определения, созданные не раньше since, кроме
+// завершенных ошибкой, отмененных и удаленных по сроку хранения, от новых к старым
+func (r *GormReportRepository) ListRecentByDefinition(ctx context.Context, definitionID uint, since time.Time) ([]models.Report, error) {
+	var reports []models.Report
+	err := r.db.WithContext(ctx).
+		Where("definition_id = ? AND created_at >= ? AND status IN ?", definitionID, since,
+			[]models.ReportStatus{models.StatusPending, models.StatusProcessing, models.StatusCompleted}).
+		Order("created_at DESC").
+		Order("id DESC").
+		Find(&reports).Error
+	return reports, err
+}
+
+// CountQueuedAhead считает отчеты в очереди, которые будут выбраны раньше report
+func (r *GormReportRepository) CountQueuedAhead(ctx context.Context, report *models.Report) (int64, error) {
+	var higher []models.ReportPriority
+	for _, priority := range []models.ReportPriority{models.PriorityLow, models.PriorityNormal, models.PriorityHigh, models.PriorityCritical} {
+		if taskPriority(priority) > taskPriority(report.Priority) {
+			higher = append(higher, priority)
+		}
+	}
+
+	ahead := r.db.Where("priority = ? AND id < ?", report.Priority, report.ID)
+	if len(higher) > 0 {
+		ahead = ahead.Or("priority IN ?", higher)
+	}
+
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Report{}).
+		Where("status = ?", models.StatusPending).
+		Where(ahead).
+		Count(&count).Error
+	return count, err
+}
+
+// GenerationDurations возвращает длительности генерации последних готовых отчетов
+func (r *GormReportRepository) GenerationDurations(ctx context.Context, definitionID *uint, since time.Time, limit int) ([]time.Duration, error) {
+	query := r.db.WithContext(ctx).Model(&models.Report{}).
+		Select("started_at, generated_at").
+		Where("status = ? AND started_at IS NOT NULL AND generated_at >= ?", models.StatusCompleted, since)
+	if definitionID != nil {
+		query = query.Where("definition_id = ?", *definitionID)
+	}
+
+	var rows []struct {
+		StartedAt   time.Time
+		GeneratedAt time.Time
+	}
+	if err := query.Order("generated_at DESC").Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	durations := make([]time.Duration, 0, len(rows))
+	for _, row := range rows {
+		if d := row.GeneratedAt.Sub(row.StartedAt); d >= 0 {
+			durations = append(durations, d)
+		}
+	}
+	return durations, nil
+}
+
+// ListSLACandidates возвращает отчеты определения, нарушившие срок breach, без отметки нарушения
+func (r *GormReportRepository) ListSLACandidates(ctx context.Context, definitionID uint, breach models.SLABreach, before time.Time, limit int) ([]models.Report, error) {
+	var reports []models.Report
+	err := r.slaCandidatesQuery(ctx, breach, before).
+		Where("definition_id = ?", definitionID).
+		Order("id").
+		Limit(limit).
+		Find(&reports).Error
+	return reports, err
+}
+
+// MarkSLABreach отмечает нарушение SLA. Обновление условное, поэтому о нарушении
+// оповещает только один экземпляр сервиса
+func (r *GormReportRepository) MarkSLABreach(ctx context.Context, id uint, breach models.SLABreach, at time.Time) (bool, error) {
+	result := r.slaCandidatesQuery(ctx, breach, at).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"sla_breach":      breach,
+			"sla_breached_at": at,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// slaCandidatesQuery выбирает отчеты, нарушившие срок breach к моменту before. Нарушение срока
+// генерации заменяет отметку о долгом ожидании в очереди: отчет прошел очередь, но завис в генерации.
+// У отчетов, начатых до появления started_at, учитывается время последнего изменения
+func (r *GormReportRepository) slaCandidatesQuery(ctx context.Context, breach models.SLABreach, before time.Time) *gorm.DB {
+	query := r.db.WithContext(ctx).Model(&models.Report{})
+	if breach == models.SLABreachDuration {
+		return query.
+			Where("status = ?", models.StatusProcessing).
+			Where("started_at < ? OR (started_at IS NULL AND updated_at < ?)", before, before).
+			Where("sla_breached_at IS NULL OR sla_breach = ?", models.SLABreachQueueWait)
+	}
+	return query.
+		Where("status = ? AND created_at < ?", models.StatusPending, before).
+		Where("sla_breached_at IS NULL")
+}
+
+// ListSLABreaches возвращает отчеты в очереди и в генерации с нарушением SLA
+func (r *GormReportRepository) ListSLABreaches(ctx context.Context, limit int) ([]models.Report, error) {
+	var reports []models.Report
+	err := r.db.WithContext(ctx).
+		Where("sla_breached_at IS NOT NULL AND status IN ?",
+			[]models.ReportStatus{models.StatusPending, models.StatusProcessing}).
+		Order("sla_breached_at").
+		Order("id").
+		Limit(limit).
+		Find(&reports).Error
+	return reports, err
+}
+
+// SetStorageClass сохраняет класс хранения файла отчета. Время изменения отчета не обновляется:
+// перевод файла не меняет сам отчет
+func (r *GormReportRepository) SetStorageClass(ctx context.Context, id uint, class string) error {
+	return r.db.WithContext(ctx).Model(&models.Report{}).Where("id = ?", id).
+		UpdateColumn("storage_class", class).Error
+}
+
+// NewReportServiceFromConfig создает сервис отчетов с фоновым процессором, выбранным в конфигурации
+func NewReportServiceFromConfig(
+	cfg config.Config,
+	db *gorm.DB,
+	replica ReadReplica,
+	storage storage.Storage,
+	generators FormatGenerators,
+	definitions DefinitionRepository,
+	queries QueryValidator,
+	sources DataSources,
+	quotas QuotaService,
+	bus events.Bus,
+	localization *Localization,
+	hooks *PipelineHooks,
+	logger logging.Logger,
+) (ReportService, BackgroundProcessor, error) {
+	schemas, err := NewParameterSchemasFromConfig(cfg.Schemas)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка загрузки схем параметров отчетов: %w", err)
+	}
+	if types := schemas.Types(); len(types) > 0 {
+		logger.WithField("types", types).Info("Схемы параметров отчетов загружены")
+	}
+	if err := RegisterDigestSchema(schemas); err != nil {
+		return nil, nil, err
+	}
+
+	locker, err := NewReportLockerFromConfig(cfg, db, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repository := NewGormReportRepository(db, logger)
+	fileStorage := NewReportFileStorage(storage, logger)
+	masking := NewMaskingPolicy(cfg.Masking)
+	documents := NewDocumentDefaults(cfg.Documents)
+	attachments := NewGormAttachmentRepository(db, logger)
+	deadLetters := NewGormDeadLetterRepository(db, logger)
+
+	executor := NewReportTaskExecutor(repository, generators, fileStorage, logger).
+		WithDataLoader(NewDigestDataLoader(
+			NewGormStatsRepository(db, logger),
+			NewDefinitionDataLoader(definitions, queries, sources, fileStorage, logger).
+				WithMasking(masking).
+				WithLocalization(localization).
+				WithDatasets(NewGormDatasetRepository(db, logger)).
+				WithTemplateMaxSize(cfg.Templates.MaxSize).
+				WithDocumentDefaults(documents),
+		)).
+		WithPublisher(bus).
+		WithRetention(NewRetentionPolicy(cfg.Retention)).
+		WithCompression(NewCompressionPolicy(cfg.Storage)).
+		WithSnapshots(NewSnapshotPolicy(cfg.Storage)).
+		WithLocker(locker).
+		WithAttachments(attachments).
+		WithDeadLetters(deadLetters).
+		WithMaxAttempts(cfg.Processor.MaxRetries + 1).
+		WithHooks(hooks)
+	if count := hooks.Count(); count > 0 {
+		logger.WithField("hooks", count).Info("Хуки генерации отчетов подключены")
+	}
+	if cfg.SMTP.Enabled {
+		executor.WithPasswordDelivery()
+		notifier := NewEmailNotifier(cfg.SMTP, NewSMTPSender(cfg.SMTP), repository, generators, fileStorage, logger)
+		SubscribeNotifier(bus, notifier, repository, logger)
+		logger.WithField("smtp_host", cfg.SMTP.Host).Info("Отправка отчетов по почте включена")
+	}
+	if cfg.Channels.Enabled {
+		notifier := NewChannelNotifier(cfg.Channels, definitions, fileStorage, logger)
+		SubscribeChannelNotifier(bus, notifier, repository, logger)
+	}
+	settings := NewGormUserSettingsRepository(db, logger)
+	if cfg.Inbox.Enabled {
+		notifier := NewInboxNotifier(cfg.Inbox, NewGormNotificationRepository(db, logger), settings, logger)
+		SubscribeInbox(bus, notifier, repository, logger)
+	}
+
+	var processor BackgroundProcessor
+	// Процессор sync запускает генерацию сразу, очереди у него нет
+	workers := 0
+	switch cfg.Processor.Type {
+	case "redis":
+		processor = NewRedisBackgroundProcessorFromConfig(cfg, executor, logger)
+		workers = cfg.Processor.Concurrency
+	case "sync", "":
+		syncProcessor := NewSyncBackgroundProcessorWithExecutor(executor, logger).(*SyncBackgroundProcessor).
+			WithMaxRetries(cfg.Processor.MaxRetries)
+		go syncProcessor.Start()
+		processor = syncProcessor
+	default:
+		return nil, nil, fmt.Errorf("неподдерживаемый тип процессора: %s", cfg.Processor.Type)
+	}
+
+	logger.WithField("processor", cfg.Processor.Type).Info("Фоновый процессор задач создан")
+
+	reportService := NewReportService(repository, generators, fileStorage, processor, bus, logger).
+		WithSchemas(schemas).
+		WithDefinitions(definitions).
+		WithQuotas(quotas).
+		WithAttachments(attachments).
+		WithRenditions(NewGormRenditionRepository(db, logger)).
+		WithUserSettings(settings).
+		WithDeadLetters(deadLetters).
+		WithResultCache(NewResultCachePolicy(cfg.ResultCache, masking, documents))
+	if replica != nil && replica.DB() != db {
+		reportService.WithReader(NewGormReportRepository(replica.DB(), logger))
+	}
+	reportService.WithQueueEstimator(NewQueueEstimator(reportService.reader, workers))
+	reportService.archive = newReportArchive(cfg.Storage.Transition, storage)
+	service := NewTracingReportService(reportService)
+
+	return service, processor, nil
+}
+
+// SyncBackgroundProcessor простая синхронная реализация фонового процессора
+type SyncBackgroundProcessor struct {
+	executor      *ReportTaskExecutor
+	logger        logging.Logger
+	tasks         chan Task
+	registry      *taskRegistry
 	cancellations sync.Map
+	running       atomic.Int64
+	// maxRetries число повторов задачи после временной ошибки
+	maxRetries int
+
+	// resumed закрывается при возобновлении приостановленной очереди, nil - очередь не приостановлена
+	pauseMu sync.Mutex
+	resumed chan struct{}
 }
 
-// NewSyncBackgroundProcessor создает новый синхронный фоновый процессор
-func NewSyncBackgroundProcessor(
-	repository ReportRepository,
-	generator ReportGenerator,
-	fileStorage ReportFileStorage,
-	logger *logrus.Logger,
-) BackgroundProcessor {
+// NewSyncBackgroundProcessorWithExecutor создает синхронный процессор с заданным исполнителем задач
+func NewSyncBackgroundProcessorWithExecutor(executor *ReportTaskExecutor, logger logging.Logger) BackgroundProcessor {
 	return &SyncBackgroundProcessor{
-		repository:  repository,
-		generator:   generator,
-		fileStorage: fileStorage,
-		logger:      logger,
-		tasks:       make(chan Task, 100),
+		executor: executor,
+		logger:   logger,
+		tasks:    make(chan Task, 100),
+		registry: newTaskRegistry(),
 	}
 }
 
+// WithMaxRetries задает число повторов задачи после временной ошибки генерации
+func (p *SyncBackgroundProcessor) WithMaxRetries(maxRetries int) *SyncBackgroundProcessor {
+	p.maxRetries = maxRetries
+	return p
+}
+
 // SubmitTask отправляет задачу на выполнение
 func (p *SyncBackgroundProcessor) SubmitTask(ctx context.Context, task Task) error {
+	p.registry.submit(task)
+
 	select {
 	case p.tasks <- task:
 		return nil
 	case <-ctx.Done():
+		p.registry.finish(task.ID, TaskStatusFailed, ctx.Err())
 		return ctx.Err()
 	default:
-		return fmt.Errorf("очередь задач переполнена")
+		err := fmt.Errorf("очередь задач переполнена")
+		p.registry.finish(task.ID, TaskStatusFailed, err)
+		return err
 	}
 }
 
-// CancelTask отменяет задачу
+// CancelTask отменяет задачу в очереди или выполняющуюся задачу
 func (p *SyncBackgroundProcessor) CancelTask(taskID string) error {
 	if cancel, exists := p.cancellations.Load(taskID); exists {
 		if cancelFunc, ok := cancel.(context.CancelFunc); ok {
@@ -724,24 +1758,117 @@ func (p *SyncBackgroundProcessor) CancelTask(taskID string) error {
 			return nil
 		}
 	}
-	return fmt.Errorf("задача %s не найдена", taskID)
+
+	// Отмененная задача будет пропущена при извлечении из очереди
+	canceled, err := p.registry.cancelPending(taskID)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, taskID)
+	}
+	if !canceled {
+		return fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	return nil
 }
 
 // GetTaskStatus возвращает статус задачи
 func (p *SyncBackgroundProcessor) GetTaskStatus(taskID string) TaskStatus {
-	// Простая реализация - в реальном приложении нужно отслеживать статусы
-	return TaskStatusRunning
+	info, exists := p.registry.get(taskID)
+	if !exists {
+		return TaskStatusUnknown
+	}
+	return info.Status
+}
+
+// GetTask возвращает сведения о задаче
+func (p *SyncBackgroundProcessor) GetTask(ctx context.Context, taskID string) (*TaskInfo, error) {
+	info, exists := p.registry.get(taskID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	return &info, nil
+}
+
+// ListTasks возвращает задачи, известные процессору, от новых к старым
+func (p *SyncBackgroundProcessor) ListTasks(ctx context.Context, filter TaskFilter) ([]TaskInfo, error) {
+	return p.registry.list(filter), nil
+}
+
+// HealthCheck сообщает о переполненной очереди задач
+func (p *SyncBackgroundProcessor) HealthCheck(ctx context.Context) error {
+	if len(p.tasks) == cap(p.tasks) {
+		return fmt.Errorf("очередь задач переполнена")
+	}
+	return nil
+}
+
+// PauseQueue приостанавливает запуск задач из очереди. Выполняющиеся задачи не прерываются
+func (p *SyncBackgroundProcessor) PauseQueue(ctx context.Context) error {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+
+	if p.resumed == nil {
+		p.resumed = make(chan struct{})
+	}
+	return nil
+}
+
+// ResumeQueue возобновляет запуск задач из очереди
+func (p *SyncBackgroundProcessor) ResumeQueue(ctx context.Context) error {
+	p.pauseMu.Lock()
+	defer p.pauseMu.Unlock()
+
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+	}
+	return nil
+}
+
+// QueueState возвращает состояние очереди. Число обработчиков не ограничено
+func (p *SyncBackgroundProcessor) QueueState(ctx context.Context) (*QueueState, error) {
+	p.pauseMu.Lock()
+	paused := p.resumed != nil
+	p.pauseMu.Unlock()
+
+	running := p.running.Load()
+	return &QueueState{
+		Paused:    paused,
+		Pending:   int64(p.registry.count(TaskStatusPending)),
+		Running:   running,
+		Instances: 1,
+		Busy:      running,
+	}, nil
+}
+
+// waitResumed ожидает возобновления приостановленной очереди
+func (p *SyncBackgroundProcessor) waitResumed() {
+	p.pauseMu.Lock()
+	resumed := p.resumed
+	p.pauseMu.Unlock()
+
+	if resumed != nil {
+		<-resumed
+	}
 }
 
 // Start запускает обработку фоновых задач
 func (p *SyncBackgroundProcessor) Start() {
 	for task := range p.tasks {
+		p.waitResumed()
 		go p.processTask(task)
 	}
 }
 
 // processTask обрабатывает задачу
 func (p *SyncBackgroundProcessor) processTask(task Task) {
+	if !p.registry.start(task.ID) {
+		p.logger.WithField("task_id", task.ID).Info("Задача отменена до запуска")
+		return
+	}
+
+	p.running.Add(1)
+	defer p.running.Add(-1)
+
 	ctx, cancel := context.WithTimeout(context.Background(), task.Timeout)
 	defer cancel()
 
@@ -749,64 +1876,520 @@ func (p *SyncBackgroundProcessor) processTask(task Task) {
 	p.cancellations.Store(task.ID, cancel)
 	defer p.cancellations.Delete(task.ID)
 
+	err := p.executor.Execute(ctx, task)
+	switch {
+	case err == nil:
+		p.registry.finish(task.ID, TaskStatusCompleted, nil)
+	case errors.Is(err, context.Canceled):
+		// Отмененные задачи переводит в статус canceled сервис отчетов
+		p.registry.finish(task.ID, TaskStatusCanceled, nil)
+	default:
+		attempts := 1
+		if info, exists := p.registry.get(task.ID); exists {
+			attempts = info.Attempts
+		}
+		logger := p.logger.WithFields(logging.Fields{"task_id": task.ID, "attempt": attempts})
+
+		if attempts <= p.maxRetries && isTransientError(err) {
+			delay := retryDelay(attempts)
+			p.registry.retry(task.ID, err)
+			logger.WithError(err).WithField("retry_in", delay).Warn("Ошибка выполнения задачи, запланирован повтор")
+			time.AfterFunc(delay, func() { p.resubmit(task, attempts) })
+			return
+		}
+
+		logger.WithError(err).Error("Ошибка выполнения задачи")
+		p.registry.finish(task.ID, TaskStatusFailed, err)
+		p.executor.Fail(ctx, task, attempts, err)
+	}
+}
+
+// resubmit возвращает задачу в очередь после задержки повтора. Задача, отмененная
+// за время задержки, будет пропущена при извлечении из очереди
+func (p *SyncBackgroundProcessor) resubmit(task Task, attempts int) {
+	select {
+	case p.tasks <- task:
+	default:
+		err := fmt.Errorf("очередь задач переполнена")
+		p.registry.finish(task.ID, TaskStatusFailed, err)
+		p.executor.Fail(context.Background(), task, attempts, err)
+	}
+}
+
+// ReportTaskExecutor выполняет фоновые задачи генерации отчетов.
+// Используется всеми реализациями BackgroundProcessor.
+type ReportTaskExecutor struct {
+	repository  ReportRepository
+	generators  FormatGenerators
+	fileStorage ReportFileStorage
+	data        ReportDataLoader
+	publisher   events.Publisher
+	retention   RetentionPolicy
+	compression CompressionPolicy
+	snapshots   SnapshotPolicy
+	locker      ReportLocker
+	attachments AttachmentRepository
+	deadLetters DeadLetterRepository
+	hooks       *PipelineHooks
+	logger      logging.Logger
+	tracer      trace.Tracer
+
+	// heartbeatInterval период подтверждения, что генерация выполняется
+	heartbeatInterval time.Duration
+	// maxAttempts предел попыток генерации, сохраняемый в отчете
+	maxAttempts int
+	// passwordDelivery сгенерированные пароли файлов отправляются по почте
+	passwordDelivery bool
+}
+
+// NewReportTaskExecutor создает новый исполнитель задач генерации отчетов
+func NewReportTaskExecutor(
+	repository ReportRepository,
+	generators FormatGenerators,
+	fileStorage ReportFileStorage,
+	logger logging.Logger,
+) *ReportTaskExecutor {
+	return &ReportTaskExecutor{
+		repository:  repository,
+		generators:  generators,
+		fileStorage: fileStorage,
+		data:        ReportInfoLoader{},
+		publisher:   events.NopPublisher{},
+		locker:      NopReportLocker{},
+		logger:      logger,
+		tracer:      telemetry.Tracer("processor"),
+
+		heartbeatInterval: reportHeartbeatInterval,
+		maxAttempts:       1,
+	}
+}
+
+// WithMaxAttempts задает предел попыток генерации с учетом повторов обработчика задач
+func (e *ReportTaskExecutor) WithMaxAttempts(maxAttempts int) *ReportTaskExecutor {
+	if maxAttempts > 0 {
+		e.maxAttempts = maxAttempts
+	}
+	return e
+}
+
+// WithPasswordDelivery оставляет сгенерированный пароль файла в отчете с получателями
+// email_recipients до отправки письмом, после нее пароль удаляет EmailNotifier
+func (e *ReportTaskExecutor) WithPasswordDelivery() *ReportTaskExecutor {
+	e.passwordDelivery = true
+	return e
+}
+
+// WithAttachments подключает приложенные к отчетам файлы, которые включаются в ZIP архив
+func (e *ReportTaskExecutor) WithAttachments(attachments AttachmentRepository) *ReportTaskExecutor {
+	e.attachments = attachments
+	return e
+}
+
+// WithDeadLetters подключает хранилище задач, исчерпавших попытки
+func (e *ReportTaskExecutor) WithDeadLetters(deadLetters DeadLetterRepository) *ReportTaskExecutor {
+	e.deadLetters = deadLetters
+	return e
+}
+
+// WithHooks подключает хуки генерации отчетов
+func (e *ReportTaskExecutor) WithHooks(hooks *PipelineHooks) *ReportTaskExecutor {
+	e.hooks = hooks
+	return e
+}
+
+// WithPublisher устанавливает публикатор событий жизненного цикла отчетов
+func (e *ReportTaskExecutor) WithPublisher(publisher events.Publisher) *ReportTaskExecutor {
+	e.publisher = publisher
+	return e
+}
+
+// WithDataLoader устанавливает загрузчик данных для генерации отчетов
+func (e *ReportTaskExecutor) WithDataLoader(data ReportDataLoader) *ReportTaskExecutor {
+	e.data = data
+	return e
+}
+
+// WithRetention устанавливает политику хранения готовых отчетов
+func (e *ReportTaskExecutor) WithRetention(retention RetentionPolicy) *ReportTaskExecutor {
+	e.retention = retention
+	return e
+}
+
+// WithCompression устанавливает политику сжатия файлов отчетов
+func (e *ReportTaskExecutor) WithCompression(compression CompressionPolicy) *ReportTaskExecutor {
+	e.compression = compression
+	return e
+}
+
+// WithSnapshots устанавливает политику сохранения снимков данных отчетов
+func (e *ReportTaskExecutor) WithSnapshots(snapshots SnapshotPolicy) *ReportTaskExecutor {
+	e.snapshots = snapshots
+	return e
+}
+
+// WithLocker устанавливает блокировку генерации отчета между экземплярами сервиса
+func (e *ReportTaskExecutor) WithLocker(locker ReportLocker) *ReportTaskExecutor {
+	e.locker = locker
+	return e
+}
+
+// Execute выполняет задачу. Статус failed не выставляется:
+// решение о повторной попытке принимает процессор через Fail
+func (e *ReportTaskExecutor) Execute(ctx context.Context, task Task) error {
+	// Продолжаем трассу запроса, создавшего задачу, и его ID в логах генерации
+	ctx = logging.ContextWithRequestID(telemetry.Extract(ctx, task.Trace), task.RequestID)
+	ctx, span := e.tracer.Start(ctx, "task."+string(task.Type),
+		trace.WithAttributes(attribute.String("task.id", task.ID)))
+	defer span.End()
+
+	var err error
 	switch task.Type {
 	case TaskTypeReportGeneration:
-		p.processReportGeneration(ctx, task)
+		reportID, ok := task.Data.(uint)
+		if !ok {
+			err = fmt.Errorf("неверный тип данных для задачи генерации отчета: %T", task.Data)
+			break
+		}
+		span.SetAttributes(reportIDAttribute(reportID))
+		err = e.generateReport(ctx, reportID)
 	default:
-		p.logger.WithField("task_type", task.Type).Warn("Неизвестный тип задачи")
+		err = fmt.Errorf("неизвестный тип задачи: %s", task.Type)
 	}
+
+	telemetry.RecordError(span, err)
+	return err
 }
 
-// processReportGeneration обрабатывает генерацию отчета
-func (p *SyncBackgroundProcessor) processReportGeneration(ctx context.Context, task Task) {
+// Fail переводит отчет задачи в статус failed после исчерпания attempts попыток,
+// сохраняет причину последней ошибки и задачу в хранилище задач, исчерпавших попытки
+func (e *ReportTaskExecutor) Fail(ctx context.Context, task Task, attempts int, cause error) {
 	reportID, ok := task.Data.(uint)
-	if !ok {
-		p.logger.Error("Неверный тип данных для задачи генерации отчета")
+	if task.Type != TaskTypeReportGeneration || !ok {
 		return
 	}
 
-	logger := p.logger.WithField("report_id", reportID)
+	// Контекст задачи может быть уже отменен по таймауту
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultContextTimeout)
+	defer cancel()
 
-	// Обновляем статус на "processing"
-	if err := p.repository.UpdateStatus(ctx, reportID, models.StatusProcessing, ""); err != nil {
-		logger.WithError(err).Error("Ошибка обновления статуса на processing")
-		return
+	logger := logging.FromContext(ctx, e.logger).WithField("report_id", reportID)
+	if err := failReport(ctx, e.repository, e.publisher, logger, reportID, cause); err != nil {
+		logger.WithError(err).Error("Ошибка обновления статуса на failed")
+	}
+	saveDeadLetter(ctx, e.deadLetters, logger, newDeadLetter(task, reportID, attempts, cause))
+}
+
+// startHeartbeat периодически обновляет heartbeat отчета до вызова возвращенной функции
+func (e *ReportTaskExecutor) startHeartbeat(ctx context.Context, reportID uint, logger logging.Logger) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(e.heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := e.repository.Heartbeat(ctx, reportID); err != nil && ctx.Err() == nil {
+					logger.WithError(err).Warn("Ошибка обновления heartbeat отчета")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
 	}
+}
+
+// errReportCanceled отчет отменен во время генерации. Оборачивает context.Canceled: процессоры
+// не повторяют такую задачу и не переводят отчет в failed
+var errReportCanceled = fmt.Errorf("отчет отменен во время генерации: %w", context.Canceled)
+
+// generateReport генерирует файл отчета и сохраняет его в хранилище
+func (e *ReportTaskExecutor) generateReport(ctx context.Context, reportID uint) error {
+	logger := logging.FromContext(ctx, e.logger).WithField("report_id", reportID)
+
+	// Блокировка не дает нескольким экземплярам сервиса генерировать один отчет
+	unlock, err := e.locker.TryLock(ctx, reportID)
+	if errors.Is(err, ErrReportLocked) {
+		logger.Info("Отчет генерируется другим экземпляром сервиса, задача пропущена")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка блокировки отчета: %w", err)
+	}
+	defer unlock()
+
+	// Отчет мог быть сгенерирован или отменен, пока задача ждала в очереди
+	current, err := e.repository.GetByID(ctx, reportID)
+	if err != nil {
+		return fmt.Errorf("ошибка получения отчета для генерации: %w", err)
+	}
+	if current.Status.IsFinal() {
+		logger.WithField("status", current.Status).Info("Отчет уже в окончательном статусе, генерация пропущена")
+		return nil
+	}
+
+	// Обновляем статус на "processing" и начинаем новую попытку. Отчет, отмененный
+	// после проверки выше, не переводится обратно в processing
+	started, err := e.repository.StartAttempt(ctx, reportID, e.maxAttempts)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления статуса на processing: %w", err)
+	}
+	if !started {
+		logger.Info("Отчет отменен до начала генерации")
+		return errReportCanceled
+	}
+	publishEvent(ctx, e.publisher, logger, events.NewEvent(events.ReportStarted, reportID, models.StatusProcessing))
+
+	// Heartbeat позволяет отличить долгую генерацию от прерванной падением сервиса
+	stopHeartbeat := e.startHeartbeat(ctx, reportID, logger)
+	defer stopHeartbeat()
 
 	// Получаем отчет
-	report, err := p.repository.GetByID(ctx, reportID)
+	report, err := e.repository.GetByID(ctx, reportID)
 	if err != nil {
-		logger.WithError(err).Error("Ошибка получения отчета для генерации")
-		p.repository.UpdateStatus(ctx, reportID, models.StatusFailed, "")
-		return
+		return fmt.Errorf("ошибка получения отчета для генерации: %w", err)
+	}
+
+	// Файл недавнего отчета с теми же параметрами копируется вместо генерации
+	if report.CachedFromID != nil {
+		reused, err := e.reuseCachedFile(ctx, report, logger)
+		if err != nil || reused {
+			return err
+		}
+	}
+
+	// Выбираем генератор по формату отчета
+	generator, err := e.generators.ForFormat(report.Format)
+	if err != nil {
+		return withErrorCode(models.ErrorCodeGeneration, fmt.Errorf("ошибка выбора генератора отчета: %w", err))
+	}
+
+	if err := e.hooks.beforeQuery(ctx, report); err != nil {
+		return withErrorCode(models.ErrorCodeGeneration, err)
+	}
+
+	// Загружаем данные отчета. Наборы закрываются после сохранения файла:
+	// потоковые генераторы читают строки во время сохранения
+	data, err := e.data.Load(ctx, report)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки данных отчета: %w", err)
+	}
+	defer data.Close()
+	if err := e.hooks.afterFill(ctx, report, data); err != nil {
+		return withErrorCode(models.ErrorCodeGeneration, err)
+	}
+	// Снимок записывает строки по мере чтения генератором: запросы не выполняются повторно
+	var snapshot *snapshotRecorder
+	if e.snapshots.For(report) {
+		if snapshot, err = recordSnapshot(data); err != nil {
+			logger.WithError(err).Warn("Не удалось начать запись снимка данных отчета")
+		} else {
+			defer snapshot.Close()
+		}
+	}
+	progress := newProgressRecorder(ctx, e.repository, reportID, logger).Record
+	data.WithProgress(progress)
+	data.Reload = func(ctx context.Context) (*ReportData, error) {
+		reloaded, err := e.data.Load(ctx, report)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.hooks.afterFill(ctx, report, reloaded); err != nil {
+			reloaded.Close()
+			return nil, err
+		}
+		return reloaded.WithProgress(progress), nil
+	}
+	if report.Format == models.FormatZIP && e.attachments != nil {
+		attachments, err := e.attachments.ListByReport(ctx, reportID)
+		if err != nil {
+			return fmt.Errorf("ошибка получения приложенных файлов: %w", err)
+		}
+		data.Attachments = attachmentFiles(attachments, e.fileStorage)
 	}
 
 	// Генерируем файл
-	fileReader, filename, err := p.generator.Generate(ctx, report)
+	fileReader, filename, err := generator.Generate(ctx, report, data)
 	if err != nil {
-		logger.WithError(err).Error("Ошибка генерации файла отчета")
-		p.repository.UpdateStatus(ctx, reportID, models.StatusFailed, "")
-		return
+		return withErrorCode(models.ErrorCodeGeneration, fmt.Errorf("ошибка генерации файла отчета: %w", err))
+	}
+
+	// Потоковые генераторы возвращают закрываемый reader: закрытие
+	// останавливает генерацию, если сохранение прервалось
+	if closer, ok := fileReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if report.PasswordProtected {
+		if fileReader, err = protectFile(report.Format, fileReader, report.FilePassword); err != nil {
+			return withErrorCode(models.ErrorCodeGeneration, fmt.Errorf("ошибка шифрования файла отчета: %w", err))
+		}
+		logger.Debug("Файл отчета зашифрован паролем")
+	}
+
+	// Сжатый файл сохраняется с расширением сжатия, по нему файл распознается при отдаче
+	extension := generator.GetFileExtension()
+	if compression := e.compression.For(report); compression != models.CompressionNone {
+		compressed := compressReader(fileReader, compression, filename)
+		defer compressed.Close()
+		fileReader = compressed
+		extension = compression.Extension(extension)
+		logger.WithField("compression", compression).Debug("Файл отчета сжимается перед сохранением")
 	}
 
 	// Генерируем ключ файла
-	fileKey := p.fileStorage.GenerateKey(report)
+	fileKey := e.fileStorage.GenerateKey(report, extension)
 
-	// Сохраняем файл
-	if err := p.fileStorage.Save(ctx, fileKey, fileReader); err != nil {
-		logger.WithError(err).Error("Ошибка сохранения файла отчета")
-		p.repository.UpdateStatus(ctx, reportID, models.StatusFailed, "")
-		return
+	// Хуки могут заменить содержимое и ключ файла до сохранения
+	if e.hooks.Count() > 0 {
+		file := &GeneratedFile{Reader: fileReader, Filename: filename, Extension: extension, Key: fileKey}
+		if err := e.hooks.beforeStore(ctx, report, file); err != nil {
+			return withErrorCode(models.ErrorCodeGeneration, err)
+		}
+		if file.Reader != fileReader {
+			if closer, ok := file.Reader.(io.Closer); ok {
+				defer closer.Close()
+			}
+		}
+		fileReader, fileKey = file.Reader, file.Key
 	}
 
-	// Обновляем статус на "completed"
-	if err := p.repository.UpdateStatus(ctx, reportID, models.StatusCompleted, fileKey); err != nil {
-		logger.WithError(err).Error("Ошибка обновления статуса на completed")
-		return
+	// Сохраняем файл, считая контрольную сумму сохраняемого содержимого.
+	// Теги позволяют правилам жизненного цикла bucket различать файлы отчетов
+	checksum := newChecksumReader(fileReader)
+	saveCtx := storage.WithObjectTags(ctx, reportObjectTags(report, e.retention))
+	if err := e.fileStorage.Save(saveCtx, fileKey, checksum); err != nil {
+		return withErrorCode(models.ErrorCodeStorage, fmt.Errorf("ошибка сохранения файла отчета: %w", err))
+	}
+
+	updates := map[string]interface{}{"checksum": checksum.Sum(), "file_size": checksum.Size(), "snapshot_key": ""}
+	if report.PasswordProtected && !e.deliversPassword(report) {
+		// Пароль нужен только для шифрования файла, поэтому не хранится после генерации
+		updates["file_password"] = ""
+	}
+	if snapshot != nil {
+		// Отчет пригоден и без снимка, поэтому ошибка снимка не прерывает генерацию
+		if key, err := e.saveSnapshot(saveCtx, report, snapshot); err != nil {
+			logger.WithError(err).Warn("Не удалось сохранить снимок данных отчета")
+		} else {
+			updates["snapshot_key"] = key
+		}
+	}
+	if len(data.Bundle) > 0 {
+		updates["bundle"] = data.Bundle
+	}
+	if err := e.completeReport(ctx, report, fileKey, updates, logger); err != nil {
+		return err
 	}
 
-	logger.WithFields(logrus.Fields{
+	logger.WithFields(logging.Fields{
 		"filename": filename,
 		"file_key": fileKey,
 	}).Info("Отчет сгенерирован успешно")
+	return nil
+}
+
+// deliversPassword сообщает, отправляется ли пароль файла отчета письмом получателям
+func (e *ReportTaskExecutor) deliversPassword(report *models.Report) bool {
+	return e.passwordDelivery && report.PasswordGenerated && len(report.EmailRecipients()) > 0
+}
+
+// completeReport сохраняет сведения о файле и переводит отчет в статус completed. Если отчет
+// отменили во время генерации, статус не меняется, а сохраненные файлы удаляются
+func (e *ReportTaskExecutor) completeReport(ctx context.Context, report *models.Report, fileKey string, updates map[string]interface{}, logger logging.Logger) error {
+	// Срок хранения сохраняется вместе со статусом: очистка выбирает только готовые отчеты
+	if expiresAt := e.retention.ExpiresAt(report, time.Now().UTC()); expiresAt != nil {
+		updates["expires_at"] = expiresAt
+	}
+	completed, err := e.repository.Complete(ctx, report.ID, fileKey, updates)
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("ошибка обновления статуса на completed: %w", err)
+	}
+	if err != nil || !completed {
+		// Генерацию отменили после сохранения файла: отчет не станет готовым, файл удаляется
+		e.deleteFiles(ctx, fileKey, updates, logger)
+		if err != nil {
+			return fmt.Errorf("ошибка обновления статуса на completed: %w", err)
+		}
+		logger.Info("Отчет отменен во время генерации, файл удален")
+		return errReportCanceled
+	}
+
+	publishEvent(ctx, e.publisher, logger,
+		events.NewEvent(events.ReportCompleted, report.ID, models.StatusCompleted).WithFileKey(fileKey))
+	return nil
+}
+
+// deleteFiles удаляет файл и снимок данных отчета, который не стал готовым
+func (e *ReportTaskExecutor) deleteFiles(ctx context.Context, fileKey string, updates map[string]interface{}, logger logging.Logger) {
+	// Контекст генерации уже может быть отменен вместе с отчетом
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultContextTimeout)
+	defer cancel()
+
+	keys := []string{fileKey}
+	if snapshotKey, _ := updates["snapshot_key"].(string); snapshotKey != "" {
+		keys = append(keys, snapshotKey)
+	}
+	for _, key := range keys {
+		if err := e.fileStorage.Delete(ctx, key); err != nil {
+			logger.WithError(err).WithField("file_key", key).Warn("Не удалось удалить файл отмененного отчета")
+		}
+	}
+}
+
+// reuseCachedFile копирует файл отчета, выбранного при создании, и завершает отчет.
+// Если исходный отчет удален, его файл недоступен или к одному из ZIP архивов приложены
+// файлы, возвращает false: отчет генерируется.
+func (e *ReportTaskExecutor) reuseCachedFile(ctx context.Context, report *models.Report, logger logging.Logger) (bool, error) {
+	logger = logger.WithField("cached_from_id", *report.CachedFromID)
+
+	source, err := e.repository.GetByID(ctx, *report.CachedFromID)
+	if err == nil && (!source.IsCompleted() || !source.HasFile()) {
+		err = fmt.Errorf("%w: %d", ErrReportFileNotFound, source.ID)
+	}
+	if err == nil && report.Format == models.FormatZIP {
+		err = e.checkBundleAttachments(ctx, report.ID, source.ID)
+	}
+
+	var fileKey string
+	if err == nil {
+		fileKey = e.fileStorage.GenerateKey(report, cachedFileExtension(source.FileKey))
+		tagged := storage.WithObjectTags(ctx, reportObjectTags(report, e.retention))
+		err = e.fileStorage.Copy(tagged, source.FileKey, fileKey)
+	}
+	if err != nil {
+		if errors.Is(err, errBundleAttachments) {
+			logger.WithError(err).Info("Архив отчета будет собран заново вместе с приложенными файлами")
+		} else {
+			logger.WithError(err).Warn("Не удалось скопировать файл готового отчета, отчет будет сгенерирован")
+		}
+		if err := e.repository.Update(ctx, report.ID, map[string]interface{}{"cached_from_id": nil}); err != nil {
+			return false, fmt.Errorf("ошибка обновления отчета: %w", err)
+		}
+		report.CachedFromID = nil
+		return false, nil
+	}
+
+	updates := map[string]interface{}{
+		"checksum":       source.Checksum,
+		"file_size":      source.FileSize,
+		"rows_processed": source.RowsProcessed,
+		"bundle":         source.Bundle,
+		"snapshot_key":   e.reuseSnapshot(storage.WithObjectTags(ctx, reportObjectTags(report, e.retention)), report, source, logger),
+	}
+	if err := e.completeReport(ctx, report, fileKey, updates, logger); err != nil {
+		return false, err
+	}
+
+	logger.WithField("file_key", fileKey).Info("Файл отчета скопирован из готового отчета с теми же параметрами")
+	return true, nil
 }
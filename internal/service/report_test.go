@@ -2,16 +2,23 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"strings"
 	"testing"
 	"time"
 
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
 	"report_srv/internal/models"
 	"report_srv/internal/storage"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -31,6 +38,11 @@ func (m *MockStorage) Get(ctx context.Context, key string) (io.ReadCloser, error
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
+func (m *MockStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	args := m.Called(ctx, key, offset, length)
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
 func (m *MockStorage) Delete(ctx context.Context, key string) error {
 	args := m.Called(ctx, key)
 	return args.Error(0)
@@ -86,27 +98,37 @@ func (m *MockStorage) ValidateKey(key string) error {
 	return args.Error(0)
 }
 
-func setupTestLogger() *logrus.Logger {
+func setupTestLogger() logging.Logger {
 	logger := logrus.New()
 	logger.SetLevel(logrus.DebugLevel)
-	return logger
+	return logging.NewLogrus(logger)
 }
 
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 
-	err = db.AutoMigrate(&models.Report{})
+	err = db.AutoMigrate(&models.Report{}, &models.ReportLink{}, &models.ReportAttachment{}, &models.ReportRendition{})
 	assert.NoError(t, err)
 
 	return db
 }
 
+// newTestReportService создает сервис отчетов тем же конструктором, что и сервер:
+// генерация идет через загрузчик определений, как в приложении
+func newTestReportService(t *testing.T, db *gorm.DB, fileStorage storage.Storage, logger logging.Logger) ReportService {
+	service, _, err := NewReportServiceFromConfig(config.Config{}, db, nil, fileStorage, NewFormatGenerators(logger),
+		NewGormDefinitionRepository(db, logger), newTestQueryValidator(t), newTestDataSources(t, db, nil),
+		nil, events.NewInProcessBus(logger), NewLocalization(nil), nil, logger)
+	require.NoError(t, err)
+	return service
+}
+
 func TestCreateReport(t *testing.T) {
 	db := setupTestDB(t)
 	mockStorage := new(MockStorage)
 	logger := setupTestLogger()
-	service := NewReportServiceFromDB(db, mockStorage, logger)
+	service := newTestReportService(t, db, mockStorage, logger)
 
 	report := &models.Report{
 		Title:       "Test Report",
@@ -115,17 +137,46 @@ func TestCreateReport(t *testing.T) {
 		UpdatedBy:   "test-user",
 	}
 
+	// Генерация запускается в фоне и может успеть сохранить файл
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
 	err := service.CreateReport(context.Background(), report)
 	assert.NoError(t, err)
 	assert.NotZero(t, report.ID)
-	assert.Equal(t, "pending", report.Status)
+	assert.Equal(t, models.StatusPending, report.Status)
+	assert.Equal(t, models.FormatXLSX, report.Format)
+}
+
+func TestCreateReportActorFromContext(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, mockStorage, logger)
+
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	// Автор из тела запроса не должен подменять аутентифицированного клиента
+	ctx := WithActor(context.Background(), "apikey:nightly")
+	report := &models.Report{Title: "Test Report", CreatedBy: "spoofed", UpdatedBy: "spoofed"}
+	assert.NoError(t, service.CreateReport(ctx, report))
+	assert.Equal(t, "apikey:nightly", report.CreatedBy)
+	assert.Equal(t, "apikey:nightly", report.UpdatedBy)
+
+	title := "Renamed"
+	err := service.UpdateReport(WithActor(context.Background(), "alice"), report.ID, ReportUpdateParams{Title: &title, UpdatedBy: "spoofed"})
+	assert.NoError(t, err)
+
+	var stored models.Report
+	assert.NoError(t, db.First(&stored, report.ID).Error)
+	assert.Equal(t, "apikey:nightly", stored.CreatedBy)
+	assert.Equal(t, "alice", stored.UpdatedBy)
 }
 
 func TestGetReport(t *testing.T) {
 	db := setupTestDB(t)
 	mockStorage := new(MockStorage)
 	logger := setupTestLogger()
-	service := NewReportServiceFromDB(db, mockStorage, logger)
+	service := newTestReportService(t, db, mockStorage, logger)
 
 	// Create a test report
 	report := &models.Report{
@@ -149,7 +200,7 @@ func TestListReports(t *testing.T) {
 	db := setupTestDB(t)
 	mockStorage := new(MockStorage)
 	logger := setupTestLogger()
-	service := NewReportServiceFromDB(db, mockStorage, logger)
+	service := newTestReportService(t, db, mockStorage, logger)
 
 	// Create test reports
 	reports := []models.Report{
@@ -181,11 +232,220 @@ func TestListReports(t *testing.T) {
 	assert.Len(t, result.Reports, 2)
 }
 
+func TestListReportsSearch(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, mockStorage, logger)
+
+	for _, report := range []models.Report{
+		{Title: "Monthly Sales", Description: "Revenue by region", Status: "completed"},
+		{Title: "Discount 100%", Description: "Promo results", Status: "completed"},
+		{Title: "Inventory", Description: "Stock_levels snapshot", Status: "pending"},
+	} {
+		report.CreatedBy = "test-user"
+		report.UpdatedBy = "test-user"
+		require.NoError(t, db.Create(&report).Error)
+	}
+
+	search := func(term string, mode SearchMode) []string {
+		result, err := service.ListReports(context.Background(), ListReportParams{Page: 1, PageSize: 10, Search: term, SearchMode: mode})
+		require.NoError(t, err)
+		titles := make([]string, 0, len(result.Reports))
+		for _, report := range result.Reports {
+			titles = append(titles, report.Title)
+		}
+		return titles
+	}
+
+	// Поиск без учета регистра по названию и описанию
+	assert.Equal(t, []string{"Monthly Sales"}, search("SALES", ""))
+	assert.Equal(t, []string{"Monthly Sales"}, search("by REGION", ""))
+
+	// Символы шаблона LIKE ищутся как обычные символы
+	assert.Equal(t, []string{"Discount 100%"}, search("100%", ""))
+	assert.Equal(t, []string{"Inventory"}, search("stock_", ""))
+	assert.Empty(t, search("%_", ""))
+
+	// Вне PostgreSQL полнотекстовый поиск сводится к поиску подстроки
+	assert.Equal(t, []string{"Inventory"}, search("inventory", SearchModeFullText))
+}
+
+func TestListReportsFilters(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, mockStorage, logger)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	generatedAt := now.Add(-time.Hour)
+	for _, report := range []models.Report{
+		{Title: "Alpha", Status: models.StatusCompleted, Format: models.FormatXLSX, CreatedBy: "alice", CreatedAt: now.Add(-48 * time.Hour), GeneratedAt: &generatedAt},
+		{Title: "Beta", Status: models.StatusPending, Format: models.FormatCSV, CreatedBy: "bob", CreatedAt: now.Add(-2 * time.Hour)},
+		{Title: "Gamma", Status: models.StatusCompleted, Format: models.FormatCSV, CreatedBy: "alice", CreatedAt: now},
+	} {
+		createdAt := report.CreatedAt
+		report.UpdatedBy = report.CreatedBy
+		require.NoError(t, db.Create(&report).Error)
+		// autoCreateTime перезаписывает created_at при создании
+		require.NoError(t, db.Model(&report).UpdateColumn("created_at", createdAt).Error)
+	}
+
+	list := func(params ListReportParams) []string {
+		params.Page, params.PageSize = 1, 10
+		result, err := service.ListReports(context.Background(), params)
+		require.NoError(t, err)
+		titles := make([]string, 0, len(result.Reports))
+		for _, report := range result.Reports {
+			titles = append(titles, report.Title)
+		}
+		return titles
+	}
+
+	completed := models.StatusCompleted
+	csv := models.FormatCSV
+	since := now.Add(-3 * time.Hour)
+	until := now.Add(-time.Hour)
+
+	assert.Equal(t, []string{"Gamma", "Alpha"}, list(ListReportParams{Status: &completed}))
+	assert.Equal(t, []string{"Gamma"}, list(ListReportParams{Status: &completed, Format: &csv}))
+	assert.Equal(t, []string{"Gamma", "Alpha"}, list(ListReportParams{CreatedBy: "alice"}))
+	assert.Equal(t, []string{"Beta"}, list(ListReportParams{CreatedAfter: &since, CreatedBefore: &until}))
+	assert.Equal(t, []string{"Alpha"}, list(ListReportParams{GeneratedAfter: &since}))
+	assert.Equal(t, []string{"Alpha", "Beta", "Gamma"}, list(ListReportParams{SortBy: "title"}))
+	assert.Equal(t, []string{"Gamma", "Beta", "Alpha"}, list(ListReportParams{SortBy: "title", SortDesc: true}))
+
+	_, err := service.ListReports(context.Background(), ListReportParams{SortBy: "title; DROP TABLE reports"})
+	assert.ErrorIs(t, err, ErrInvalidSortField)
+}
+
+func TestListReportsStablePagesForEqualCreatedAt(t *testing.T) {
+	db := setupTestDB(t)
+	service := newTestReportService(t, db, new(MockStorage), setupTestLogger())
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	for _, title := range []string{"First", "Second", "Third"} {
+		report := models.Report{Title: title, Status: models.StatusCompleted, CreatedBy: "alice", UpdatedBy: "alice"}
+		require.NoError(t, db.Create(&report).Error)
+		require.NoError(t, db.Model(&report).UpdateColumn("created_at", createdAt).Error)
+	}
+
+	// Отчеты с одинаковым временем создания идут от новых ID к старым и не повторяются на страницах
+	var titles []string
+	for page := 1; page <= 3; page++ {
+		result, err := service.ListReports(context.Background(), ListReportParams{Page: page, PageSize: 1})
+		require.NoError(t, err)
+		require.Len(t, result.Reports, 1)
+		titles = append(titles, result.Reports[0].Title)
+	}
+	assert.Equal(t, []string{"Third", "Second", "First"}, titles)
+}
+
+// testReplica реплика БД в тестах
+type testReplica struct {
+	db *gorm.DB
+}
+
+func (r testReplica) DB() *gorm.DB {
+	return r.db
+}
+
+func TestReadsGoToReplica(t *testing.T) {
+	primary := setupTestDB(t)
+	replica := setupTestDB(t)
+	logger := setupTestLogger()
+	service, _, err := NewReportServiceFromConfig(config.Config{}, primary, testReplica{db: replica}, new(MockStorage),
+		NewFormatGenerators(logger), NewGormDefinitionRepository(primary, logger), newTestQueryValidator(t),
+		newTestDataSources(t, primary, nil), nil, events.NewInProcessBus(logger), NewLocalization(nil), nil, logger)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	replicated := models.Report{Title: "Replicated", Status: models.StatusCompleted, CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, primary.Create(&replicated).Error)
+	require.NoError(t, replica.Create(&replicated).Error)
+	require.NoError(t, primary.Model(&replicated).UpdateColumn("title", "Primary").Error)
+
+	// Список и карточка отчета читаются с реплики
+	list, err := service.ListReports(ctx, ListReportParams{})
+	require.NoError(t, err)
+	require.Len(t, list.Reports, 1)
+	assert.Equal(t, "Replicated", list.Reports[0].Title)
+
+	report, err := service.GetReport(ctx, replicated.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Replicated", report.Title)
+
+	// Изменения записываются в основную БД
+	title := "Updated"
+	require.NoError(t, service.UpdateReport(ctx, replicated.ID, ReportUpdateParams{Title: &title, UpdatedBy: "alice"}))
+	var stored models.Report
+	require.NoError(t, primary.First(&stored, replicated.ID).Error)
+	assert.Equal(t, "Updated", stored.Title)
+	require.NoError(t, replica.First(&stored, replicated.ID).Error)
+	assert.Equal(t, "Replicated", stored.Title)
+
+	// Отчет, который еще не попал на реплику, читается из основной БД
+	lagging := models.Report{Title: "Lagging", Status: models.StatusPending, CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, primary.Create(&lagging).Error)
+	report, err = service.GetReport(ctx, lagging.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Lagging", report.Title)
+
+	_, err = service.GetReport(ctx, lagging.ID+1)
+	assert.ErrorIs(t, err, ErrReportNotFound)
+}
+
+func TestSyncProcessorTracksTasks(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	logger := setupTestLogger()
+	repository := NewGormReportRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger)
+	processor := NewSyncBackgroundProcessorWithExecutor(executor, logger).(*SyncBackgroundProcessor)
+	ctx := context.Background()
+
+	var tasks []Task
+	for i := 0; i < 2; i++ {
+		report := &models.Report{Title: "Report", Status: models.StatusPending, CreatedBy: "test-user", UpdatedBy: "test-user"}
+		require.NoError(t, db.Create(report).Error)
+		task := Task{ID: fmt.Sprintf("report_%d", report.ID), Type: TaskTypeReportGeneration, Data: report.ID, Timeout: time.Minute}
+		require.NoError(t, processor.SubmitTask(ctx, task))
+		tasks = append(tasks, task)
+	}
+	assert.Equal(t, TaskStatusPending, processor.GetTaskStatus(tasks[0].ID))
+	assert.Equal(t, TaskStatusUnknown, processor.GetTaskStatus("missing"))
+
+	// Задача, отмененная в очереди, не выполняется
+	require.NoError(t, processor.CancelTask(tasks[1].ID))
+	for range tasks {
+		processor.processTask(<-processor.tasks)
+	}
+
+	info, err := processor.GetTask(ctx, tasks[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCompleted, info.Status)
+	assert.Equal(t, 1, info.Attempts)
+	assert.NotNil(t, info.StartedAt)
+	assert.NotNil(t, info.FinishedAt)
+
+	info, err = processor.GetTask(ctx, tasks[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCanceled, info.Status)
+	assert.Nil(t, info.StartedAt)
+	assert.ErrorIs(t, processor.CancelTask(tasks[1].ID), ErrTaskFinished)
+
+	listed, err := processor.ListTasks(ctx, TaskFilter{Status: TaskStatusCompleted})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, tasks[0].ID, listed[0].ID)
+}
+
 func TestDeleteReport(t *testing.T) {
 	db := setupTestDB(t)
 	mockStorage := new(MockStorage)
 	logger := setupTestLogger()
-	service := NewReportServiceFromDB(db, mockStorage, logger)
+	service := newTestReportService(t, db, mockStorage, logger)
 
 	// Create a test report
 	report := &models.Report{
@@ -213,3 +473,151 @@ func TestDeleteReport(t *testing.T) {
 
 	mockStorage.AssertExpectations(t)
 }
+
+func TestDeleteReportRemovesLinks(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, mockStorage, logger)
+
+	report := &models.Report{Title: "Test Report", Status: models.StatusCompleted, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	assert.NoError(t, db.Create(report).Error)
+	link := &models.ReportLink{ReportID: report.ID, Prefix: "rsl_test", TokenHash: "hash", ExpiresAt: time.Now().Add(time.Hour), CreatedBy: "test-user"}
+	assert.NoError(t, db.Create(link).Error)
+
+	assert.NoError(t, service.DeleteReport(context.Background(), report.ID))
+
+	var count int64
+	db.Model(&models.ReportLink{}).Where("report_id = ?", report.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestSetReportPriority(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, new(MockStorage), logger)
+	ctx := context.Background()
+
+	pending := &models.Report{Title: "Pending", Status: models.StatusPending, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	completed := &models.Report{Title: "Completed", Status: models.StatusCompleted, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(pending).Error)
+	require.NoError(t, db.Create(completed).Error)
+
+	report, err := service.SetReportPriority(ctx, pending.ID, models.PriorityCritical, "admin")
+	require.NoError(t, err)
+	assert.Equal(t, models.PriorityCritical, report.Priority)
+
+	var stored models.Report
+	require.NoError(t, db.First(&stored, pending.ID).Error)
+	assert.Equal(t, models.PriorityCritical, stored.Priority)
+	assert.Equal(t, "admin", stored.UpdatedBy)
+
+	_, err = service.SetReportPriority(ctx, completed.ID, models.PriorityHigh, "admin")
+	assert.ErrorIs(t, err, ErrReportNotQueued)
+	_, err = service.SetReportPriority(ctx, pending.ID, "urgent", "admin")
+	assert.ErrorIs(t, err, ErrInvalidPriority)
+	_, err = service.SetReportPriority(ctx, 999, models.PriorityHigh, "admin")
+	assert.ErrorIs(t, err, ErrReportNotFound)
+}
+
+func TestReportRepositoryTransactionRollback(t *testing.T) {
+	db := setupTestDB(t)
+	repository := NewGormReportRepository(db, setupTestLogger())
+
+	report := &models.Report{Title: "Test Report", Status: models.StatusCompleted, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	assert.NoError(t, db.Create(report).Error)
+
+	failure := errors.New("сбой второго шага")
+	err := repository.Transaction(context.Background(), func(tx ReportRepository) error {
+		if err := tx.Delete(context.Background(), report.ID); err != nil {
+			return err
+		}
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	// Первый шаг откатывается вместе со вторым
+	_, err = repository.GetByID(context.Background(), report.ID)
+	assert.NoError(t, err)
+}
+
+func TestReportRepositoryUpdateKeepsCallerMap(t *testing.T) {
+	db := setupTestDB(t)
+	repository := NewGormReportRepository(db, setupTestLogger())
+
+	report := &models.Report{Title: "Test Report", CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, db.Create(report).Error)
+
+	updates := map[string]interface{}{"title": "Renamed"}
+	require.NoError(t, repository.Update(WithActor(context.Background(), "bob"), report.ID, updates))
+
+	// Автор изменения записывается в отчет, но не в карту вызывающего
+	assert.Equal(t, map[string]interface{}{"title": "Renamed"}, updates)
+	stored, err := repository.GetByID(context.Background(), report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", stored.Title)
+	assert.Equal(t, "bob", stored.UpdatedBy)
+}
+
+func TestGetReportFile(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, mockStorage, logger)
+
+	report := &models.Report{
+		Title:     "Sales",
+		Status:    models.StatusCompleted,
+		Format:    models.FormatCSV,
+		FileKey:   "reports/sales.csv",
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	assert.NoError(t, db.Create(report).Error)
+
+	mockStorage.On("GetSize", mock.Anything, report.FileKey).Return(int64(42), nil)
+	mockStorage.On("Get", mock.Anything, report.FileKey).Return(io.NopCloser(strings.NewReader("a;b")), nil)
+
+	file, err := service.GetReportFile(context.Background(), report.ID)
+	assert.NoError(t, err)
+	defer file.Reader.Close()
+
+	assert.Equal(t, "Sales.csv", file.Filename)
+	assert.Equal(t, "text/csv; charset=utf-8", file.ContentType)
+	assert.Equal(t, int64(42), file.Size)
+
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGetReportDownloadURL(t *testing.T) {
+	db := setupTestDB(t)
+	mockStorage := new(MockStorage)
+	logger := setupTestLogger()
+	service := newTestReportService(t, db, mockStorage, logger)
+
+	pending := &models.Report{Title: "Pending", Status: models.StatusPending, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	assert.NoError(t, db.Create(pending).Error)
+
+	_, err := service.GetReportDownloadURL(context.Background(), pending.ID, time.Minute)
+	assert.Error(t, err)
+
+	report := &models.Report{
+		Title:     "Sales",
+		Status:    models.StatusCompleted,
+		FileKey:   "reports/sales.xlsx",
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	assert.NoError(t, db.Create(report).Error)
+
+	mockStorage.On("GetPresignedURL", mock.Anything, report.FileKey, time.Minute).
+		Return("https://bucket.s3.amazonaws.com/reports/sales.xlsx?X-Amz-Signature=abc", nil)
+
+	downloadURL, err := service.GetReportDownloadURL(context.Background(), report.ID, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://bucket.s3.amazonaws.com/reports/sales.xlsx?X-Amz-Signature=abc", downloadURL.URL)
+	assert.Equal(t, "Sales.xlsx", downloadURL.Filename)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), downloadURL.ExpiresAt, 5*time.Second)
+
+	mockStorage.AssertExpectations(t)
+}
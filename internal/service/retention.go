@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Режимы очистки отчетов с истекшим сроком хранения
+	RetentionModeExpire = "expire"
+	RetentionModePurge  = "purge"
+
+	// Интервал очистки по умолчанию
+	defaultRetentionInterval = time.Hour
+
+	// Максимальное число отчетов, очищаемых за один проход
+	defaultRetentionBatchSize = 100
+
+	// retentionUser автор изменений, вносимых очисткой
+	retentionUser = "retention"
+
+	// Классы хранения отчетов в тегах файлов: общий срок, срок из параметров отчета и бессрочно
+	RetentionClassStandard  = "standard"
+	RetentionClassCustom    = "custom"
+	RetentionClassPermanent = "permanent"
+)
+
+// RetentionPolicy определяет срок хранения готовых отчетов
+type RetentionPolicy struct {
+	// TTL срок хранения по умолчанию, 0 - бессрочно
+	TTL time.Duration
+}
+
+// NewRetentionPolicy создает политику хранения из конфигурации
+func NewRetentionPolicy(cfg config.Retention) RetentionPolicy {
+	return RetentionPolicy{TTL: cfg.TTL}
+}
+
+// ExpiresAt возвращает время истечения срока хранения отчета, завершенного в completedAt.
+// Срок из параметров отчета имеет приоритет над общим. nil - отчет хранится бессрочно.
+func (p RetentionPolicy) ExpiresAt(report *models.Report, completedAt time.Time) *time.Time {
+	ttl := p.TTL
+	if reportTTL, ok, err := report.RetentionTTL(); err == nil && ok {
+		ttl = reportTTL
+	}
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	expiresAt := completedAt.Add(ttl)
+	return &expiresAt
+}
+
+// Class возвращает класс хранения отчета для тегов его файла
+func (p RetentionPolicy) Class(report *models.Report) string {
+	if reportTTL, ok, err := report.RetentionTTL(); err == nil && ok {
+		if reportTTL <= 0 {
+			return RetentionClassPermanent
+		}
+		return RetentionClassCustom
+	}
+	if p.TTL <= 0 {
+		return RetentionClassPermanent
+	}
+	return RetentionClassStandard
+}
+
+// RetentionJanitor периодически удаляет файлы отчетов с истекшим сроком хранения.
+// Запись отчета помечается статусом expired или удаляется в зависимости от режима.
+type RetentionJanitor struct {
+	repository  ReportRepository
+	fileStorage ReportFileStorage
+	publisher   events.Publisher
+	mode        string
+	interval    time.Duration
+	batchSize   int
+	logger      logging.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRetentionJanitor создает очистку отчетов с истекшим сроком хранения
+func NewRetentionJanitor(
+	cfg config.Retention,
+	repository ReportRepository,
+	fileStorage ReportFileStorage,
+	publisher events.Publisher,
+	logger logging.Logger,
+) *RetentionJanitor {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultRetentionBatchSize
+	}
+	mode := cfg.Mode
+	if mode == "" {
+		mode = RetentionModeExpire
+	}
+
+	return &RetentionJanitor{
+		repository:  repository,
+		fileStorage: fileStorage,
+		publisher:   publisher,
+		mode:        mode,
+		interval:    interval,
+		batchSize:   batchSize,
+		logger:      logger,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// NewRetentionJanitorFromConfig создает очистку отчетов с репозиторием и хранилищем из конфигурации
+func NewRetentionJanitorFromConfig(
+	cfg config.Config,
+	db *gorm.DB,
+	storage storage.Storage,
+	bus events.Bus,
+	logger logging.Logger,
+) *RetentionJanitor {
+	return NewRetentionJanitor(
+		cfg.Retention,
+		NewGormReportRepository(db, logger),
+		NewReportFileStorage(storage, logger),
+		bus,
+		logger,
+	)
+}
+
+// Start запускает цикл очистки в отдельной горутине
+func (j *RetentionJanitor) Start() {
+	j.logger.WithFields(logging.Fields{
+		"interval": j.interval,
+		"mode":     j.mode,
+	}).Info("Запуск очистки отчетов по сроку хранения")
+	go j.loop()
+}
+
+// Stop останавливает цикл очистки
+func (j *RetentionJanitor) Stop(ctx context.Context) error {
+	j.stopOnce.Do(func() { close(j.stop) })
+
+	select {
+	case <-j.done:
+		j.logger.Info("Очистка отчетов остановлена")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop основной цикл очистки
+func (j *RetentionJanitor) loop() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), j.interval)
+			j.Cleanup(ctx, time.Now().UTC())
+			cancel()
+		}
+	}
+}
+
+// Cleanup очищает отчеты, срок хранения которых истек к моменту now, и возвращает их число
+func (j *RetentionJanitor) Cleanup(ctx context.Context, now time.Time) int {
+	reports, err := j.repository.ListExpired(ctx, now, j.batchSize)
+	if err != nil {
+		j.logger.WithError(err).Error("Ошибка получения отчетов с истекшим сроком хранения")
+		return 0
+	}
+
+	cleaned := 0
+	for i := range reports {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := j.expire(ctx, &reports[i]); err != nil {
+			j.logger.WithError(err).WithField("report_id", reports[i].ID).
+				Error("Ошибка очистки отчета с истекшим сроком хранения")
+			continue
+		}
+		cleaned++
+	}
+
+	if cleaned > 0 {
+		j.logger.WithField("count", cleaned).Info("Отчеты с истекшим сроком хранения очищены")
+	}
+	return cleaned
+}
+
+// expire удаляет файл отчета и помечает или удаляет запись.
+// Если файл удалить не удалось, запись не меняется и очистка повторится в следующий проход.
+func (j *RetentionJanitor) expire(ctx context.Context, report *models.Report) error {
+	logger := j.logger.WithField("report_id", report.ID)
+
+	if report.HasFile() {
+		if err := j.fileStorage.Delete(ctx, report.FileKey); err != nil {
+			return fmt.Errorf("ошибка удаления файла %s: %w", report.FileKey, err)
+		}
+	}
+	if report.SnapshotKey != "" {
+		if err := j.fileStorage.Delete(ctx, report.SnapshotKey); err != nil {
+			return fmt.Errorf("ошибка удаления снимка данных %s: %w", report.SnapshotKey, err)
+		}
+	}
+
+	if j.mode == RetentionModePurge {
+		if err := j.repository.Delete(ctx, report.ID); err != nil {
+			return fmt.Errorf("ошибка удаления отчета: %w", err)
+		}
+		publishEvent(ctx, j.publisher, logger, events.NewEvent(events.ReportDeleted, report.ID, report.Status))
+		return nil
+	}
+
+	updates := map[string]interface{}{
+		"status":       models.StatusExpired,
+		"file_key":     "",
+		"checksum":     "",
+		"file_size":    0,
+		"snapshot_key": "",
+		"updated_by":   retentionUser,
+		"updated_at":   time.Now().UTC(),
+	}
+	if err := j.repository.Update(ctx, report.ID, updates); err != nil {
+		return fmt.Errorf("ошибка обновления статуса отчета: %w", err)
+	}
+	publishEvent(ctx, j.publisher, logger, events.NewEvent(events.ReportExpired, report.ID, models.StatusExpired))
+	return nil
+}
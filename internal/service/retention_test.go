@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func createCompletedReport(t *testing.T, db *gorm.DB, fileKey string, expiresAt *time.Time) *models.Report {
+	generatedAt := time.Now().UTC()
+	report := &models.Report{
+		Title:       "Report " + fileKey,
+		Status:      models.StatusCompleted,
+		FileKey:     fileKey,
+		GeneratedAt: &generatedAt,
+		ExpiresAt:   expiresAt,
+		CreatedBy:   "test-user",
+		UpdatedBy:   "test-user",
+	}
+	require.NoError(t, db.Create(report).Error)
+	return report
+}
+
+func TestRetentionPolicyExpiresAt(t *testing.T) {
+	completedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	policy := RetentionPolicy{TTL: 24 * time.Hour}
+
+	expiresAt := policy.ExpiresAt(&models.Report{}, completedAt)
+	require.NotNil(t, expiresAt)
+	assert.Equal(t, completedAt.Add(24*time.Hour), *expiresAt)
+
+	// Срок из параметров отчета имеет приоритет
+	report := &models.Report{Parameters: models.JSON{models.ParamRetentionTTL: "1h"}}
+	expiresAt = policy.ExpiresAt(report, completedAt)
+	require.NotNil(t, expiresAt)
+	assert.Equal(t, completedAt.Add(time.Hour), *expiresAt)
+
+	report.Parameters[models.ParamRetentionTTL] = "0"
+	assert.Nil(t, policy.ExpiresAt(report, completedAt))
+
+	assert.Nil(t, RetentionPolicy{}.ExpiresAt(&models.Report{}, completedAt))
+}
+
+func TestRetentionJanitorExpiresReports(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	bus := events.NewInProcessBus(logger)
+	mockStorage := new(MockStorage)
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Hour)
+
+	expired := createCompletedReport(t, db, "reports/1/expired.xlsx", &past)
+	active := createCompletedReport(t, db, "reports/2/active.xlsx", &future)
+	permanent := createCompletedReport(t, db, "reports/3/permanent.xlsx", nil)
+
+	received := make(chan events.Event, 10)
+	bus.Subscribe(func(ctx context.Context, event events.Event) { received <- event })
+
+	mockStorage.On("Delete", mock.Anything, "reports/1/expired.xlsx").Return(nil).Once()
+
+	janitor := NewRetentionJanitor(config.Retention{Mode: RetentionModeExpire},
+		NewGormReportRepository(db, logger), NewReportFileStorage(mockStorage, logger), bus, logger)
+	assert.Equal(t, 1, janitor.Cleanup(context.Background(), now))
+	assert.Equal(t, 0, janitor.Cleanup(context.Background(), now))
+	mockStorage.AssertExpectations(t)
+
+	var stored models.Report
+	require.NoError(t, db.First(&stored, expired.ID).Error)
+	assert.Equal(t, models.StatusExpired, stored.Status)
+	assert.Empty(t, stored.FileKey)
+
+	for _, report := range []*models.Report{active, permanent} {
+		var kept models.Report
+		require.NoError(t, db.First(&kept, report.ID).Error)
+		assert.Equal(t, models.StatusCompleted, kept.Status)
+	}
+
+	require.Len(t, received, 1)
+	event := <-received
+	assert.Equal(t, events.ReportExpired, event.Type)
+	assert.Equal(t, expired.ID, event.ReportID)
+}
+
+func TestRetentionJanitorPurgesReports(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	mockStorage := new(MockStorage)
+
+	past := time.Now().UTC().Add(-time.Minute)
+	failing := createCompletedReport(t, db, "reports/1/failing.xlsx", &past)
+	purged := createCompletedReport(t, db, "reports/2/purged.xlsx", &past)
+
+	mockStorage.On("Delete", mock.Anything, "reports/1/failing.xlsx").Return(errors.New("storage unavailable"))
+	mockStorage.On("Delete", mock.Anything, "reports/2/purged.xlsx").Return(nil)
+
+	janitor := NewRetentionJanitor(config.Retention{Mode: RetentionModePurge},
+		NewGormReportRepository(db, logger), NewReportFileStorage(mockStorage, logger), events.NopPublisher{}, logger)
+	assert.Equal(t, 1, janitor.Cleanup(context.Background(), time.Now().UTC()))
+
+	// Отчет, файл которого не удалось удалить, остается до следующего прохода
+	var stored models.Report
+	require.NoError(t, db.First(&stored, failing.ID).Error)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+
+	assert.ErrorIs(t, db.First(&models.Report{}, purged.ID).Error, gorm.ErrRecordNotFound)
+}
+
+func TestExecutorSetsExpiresAt(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	repository := NewGormReportRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger).
+		WithRetention(RetentionPolicy{TTL: 24 * time.Hour})
+
+	report := &models.Report{
+		Title:      "Report",
+		Format:     models.FormatCSV,
+		Parameters: models.JSON{models.ParamRetentionTTL: "2h"},
+		CreatedBy:  "test-user",
+		UpdatedBy:  "test-user",
+	}
+	require.NoError(t, repository.Create(context.Background(), report))
+
+	before := time.Now().UTC()
+	require.NoError(t, executor.generateReport(context.Background(), report.ID))
+
+	stored, err := repository.GetByID(context.Background(), report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusCompleted, stored.Status)
+	require.NotNil(t, stored.ExpiresAt)
+	assert.WithinDuration(t, before.Add(2*time.Hour), *stored.ExpiresAt, time.Minute)
+}
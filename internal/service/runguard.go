@@ -0,0 +1,150 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRunLimit у определения уже запущено наибольшее допустимое число отчетов
+	ErrRunLimit = newCategoryError(ErrConflict, "достигнуто ограничение одновременных запусков определения")
+	// ErrSchedulesPaused запуски расписаний определения приостановлены
+	ErrSchedulesPaused = newCategoryError(ErrConflict, "запуски расписаний определения приостановлены")
+)
+
+// ScheduleRunGuard проверяет запуск расписания и его отчеты перед созданием
+type ScheduleRunGuard interface {
+	// CheckPaused возвращает ErrSchedulesPaused, если запуски расписаний определения приостановлены.
+	// Проверяется до итерационного запроса, чтобы не обращаться к источнику данных
+	CheckPaused(ctx context.Context, schedule *models.Schedule) error
+	// Admit возвращает ранее созданный отчет, с которым объединяется запуск, или ErrRunLimit,
+	// если запуск пропускается. nil без ошибки - отчет создается
+	Admit(ctx context.Context, report *models.Report) (*models.Report, error)
+}
+
+// DefinitionRunGuard ограничивает запуски расписаний по настройкам определения отчета:
+// MaxConcurrentRuns и DedupeWindow
+type DefinitionRunGuard struct {
+	definitions DefinitionRepository
+	reports     ReportRepository
+	logger      logging.Logger
+}
+
+// NewDefinitionRunGuard создает проверку запусков расписаний по настройкам определений
+func NewDefinitionRunGuard(definitions DefinitionRepository, reports ReportRepository, logger logging.Logger) *DefinitionRunGuard {
+	return &DefinitionRunGuard{
+		definitions: definitions,
+		reports:     reports,
+		logger:      logger,
+	}
+}
+
+// CheckPaused проверяет, приостановлены ли запуски расписаний определения расписания
+func (g *DefinitionRunGuard) CheckPaused(ctx context.Context, schedule *models.Schedule) error {
+	if schedule.ReportType == "" {
+		return nil
+	}
+
+	definition, err := g.definitions.GetByName(ctx, schedule.ReportType)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logging.FromContext(ctx, g.logger).WithError(err).WithField("type", schedule.ReportType).
+				Warn("Ошибка получения определения для проверки запуска расписания")
+		}
+		return nil
+	}
+	if definition.SchedulesPaused {
+		return fmt.Errorf("%w: %s", ErrSchedulesPaused, definition.Name)
+	}
+	return nil
+}
+
+// Admit сначала ищет отчет определения с теми же форматом, названием и параметрами, созданный
+// в пределах DedupeWindow, затем считает отчеты определения в очереди и в генерации. Ошибки
+// чтения не мешают запуску: пропущенный отчет заметить сложнее, чем лишний
+func (g *DefinitionRunGuard) Admit(ctx context.Context, report *models.Report) (*models.Report, error) {
+	if report.Type == "" {
+		return nil, nil
+	}
+	logger := logging.FromContext(ctx, g.logger).WithField("type", report.Type)
+
+	definition, err := g.definitions.GetByName(ctx, report.Type)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.WithError(err).Warn("Ошибка получения определения для проверки запуска расписания")
+		}
+		return nil, nil
+	}
+
+	if window := definition.DedupeDuration(); window > 0 {
+		existing, err := g.findDuplicate(ctx, report, definition, time.Now().UTC().Add(-window))
+		if err != nil {
+			logger.WithError(err).Warn("Ошибка поиска отчета для объединения запусков")
+		} else if existing != nil {
+			return existing, nil
+		}
+	}
+
+	if definition.MaxConcurrentRuns > 0 {
+		active, err := g.reports.CountActiveByDefinition(ctx, definition.ID)
+		if err != nil {
+			logger.WithError(err).Warn("Ошибка подсчета запущенных отчетов определения")
+			return nil, nil
+		}
+		if active >= int64(definition.MaxConcurrentRuns) {
+			return nil, fmt.Errorf("%w: %s, %d из %d", ErrRunLimit, definition.Name, active, definition.MaxConcurrentRuns)
+		}
+	}
+
+	return nil, nil
+}
+
+// findDuplicate возвращает последний отчет определения, созданный не раньше since, с теми же
+// форматом, названием и параметрами, что и report
+func (g *DefinitionRunGuard) findDuplicate(ctx context.Context, report *models.Report, definition *models.ReportDefinition, since time.Time) (*models.Report, error) {
+	format := report.Format
+	if format == "" {
+		format = definition.Format
+	}
+	parameters, err := canonicalParameters(report.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	recent, err := g.reports.ListRecentByDefinition(ctx, definition.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recent {
+		candidate := &recent[i]
+		if candidate.Title != report.Title || candidate.Format != format {
+			continue
+		}
+		stored, err := canonicalParameters(candidate.Parameters)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(stored, parameters) {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+// canonicalParameters сериализует параметры для сравнения. Числа из строки итерационного
+// запроса и из БД имеют разные типы, но одинаковый JSON; ключи map сериализуются по порядку
+func canonicalParameters(parameters models.JSON) ([]byte, error) {
+	if len(parameters) == 0 {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]interface{}(parameters))
+}
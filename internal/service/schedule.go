@@ -0,0 +1,575 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// Интервал проверки расписаний по умолчанию
+	defaultSchedulerInterval = time.Minute
+
+	// Максимальное число расписаний, обрабатываемых за один проход
+	defaultSchedulerBatchSize = 100
+)
+
+// ErrScheduleNotFound расписание не найдено
+var ErrScheduleNotFound = newCategoryError(ErrNotFound, "расписание не найдено")
+
+// ScheduleService интерфейс для работы с расписаниями отчетов
+type ScheduleService interface {
+	CreateSchedule(ctx context.Context, schedule *models.Schedule) error
+	GetSchedule(ctx context.Context, id uint) (*models.Schedule, error)
+	ListSchedules(ctx context.Context, params ListScheduleParams) (*ScheduleList, error)
+	UpdateSchedule(ctx context.Context, id uint, params ScheduleUpdateParams) (*models.Schedule, error)
+	DeleteSchedule(ctx context.Context, id uint) error
+}
+
+// ScheduleRepository интерфейс для работы с расписаниями в базе данных
+type ScheduleRepository interface {
+	Create(ctx context.Context, schedule *models.Schedule) error
+	GetByID(ctx context.Context, id uint) (*models.Schedule, error)
+	List(ctx context.Context, params ListScheduleParams) ([]models.Schedule, int64, error)
+	ListDue(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error)
+	// Claim сдвигает время следующего запуска с due на next, если его еще не сдвинул другой
+	// экземпляр сервиса. Возвращает false, если запуск уже забран
+	Claim(ctx context.Context, id uint, due time.Time, next time.Time) (bool, error)
+	Update(ctx context.Context, id uint, updates map[string]interface{}) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// ListScheduleParams параметры для получения списка расписаний
+type ListScheduleParams struct {
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
+	Enabled  *bool `json:"enabled,omitempty"`
+}
+
+// ScheduleUpdateParams параметры для обновления расписания
+type ScheduleUpdateParams struct {
+	Name              *string              `json:"name,omitempty"`
+	CronExpr          *string              `json:"cron_expr,omitempty"`
+	Enabled           *bool                `json:"enabled,omitempty"`
+	ReportTitle       *string              `json:"report_title,omitempty"`
+	ReportDescription *string              `json:"report_description,omitempty"`
+	Format            *models.ReportFormat `json:"format,omitempty"`
+	ReportType        *string              `json:"report_type,omitempty"`
+	Parameters        *models.JSON         `json:"parameters,omitempty"`
+	UpdatedBy         string               `json:"updated_by"`
+}
+
+// ScheduleList результат получения списка расписаний с пагинацией
+type ScheduleList struct {
+	Schedules  []models.Schedule `json:"schedules"`
+	Total      int64             `json:"total"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	TotalPages int               `json:"total_pages"`
+}
+
+// ParseCronExpression разбирает cron выражение.
+// Поддерживается стандартный формат из пяти полей, дескрипторы (@daily, @every 1h)
+// и указание часового пояса через префикс CRON_TZ=.
+func ParseCronExpression(expr string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(strings.TrimSpace(expr))
+	if err != nil {
+		return nil, fmt.Errorf("неверное cron выражение %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// ScheduleServiceImpl реализация сервиса расписаний
+type ScheduleServiceImpl struct {
+	repository ScheduleRepository
+	logger     logging.Logger
+}
+
+// NewScheduleService создает новый сервис расписаний
+func NewScheduleService(repository ScheduleRepository, logger logging.Logger) ScheduleService {
+	return &ScheduleServiceImpl{
+		repository: repository,
+		logger:     logger,
+	}
+}
+
+// CreateSchedule создает новое расписание
+func (s *ScheduleServiceImpl) CreateSchedule(ctx context.Context, schedule *models.Schedule) error {
+	schedule.CreatedBy = actorOr(ctx, schedule.CreatedBy)
+	if actor := ActorFromContext(ctx); actor != "" {
+		schedule.UpdatedBy = actor
+	}
+
+	logger := logging.FromContext(ctx, s.logger).WithFields(logging.Fields{
+		"name":       schedule.Name,
+		"cron_expr":  schedule.CronExpr,
+		"created_by": schedule.CreatedBy,
+	})
+
+	if schedule.UpdatedBy == "" {
+		schedule.UpdatedBy = schedule.CreatedBy
+	}
+
+	if err := schedule.Validate(); err != nil {
+		return fmt.Errorf("ошибка валидации расписания: %w", err)
+	}
+
+	cronSchedule, err := ParseCronExpression(schedule.CronExpr)
+	if err != nil {
+		return fmt.Errorf("ошибка валидации расписания: %w", err)
+	}
+
+	schedule.NextRunAt = nil
+	if schedule.Enabled {
+		next := cronSchedule.Next(time.Now().UTC())
+		schedule.NextRunAt = &next
+	}
+
+	if err := s.repository.Create(ctx, schedule); err != nil {
+		logger.WithError(err).Error("Ошибка сохранения расписания в БД")
+		return fmt.Errorf("ошибка создания расписания: %w", err)
+	}
+
+	logger.WithField("schedule_id", schedule.ID).Info("Расписание создано")
+	return nil
+}
+
+// GetSchedule получает расписание по ID
+func (s *ScheduleServiceImpl) GetSchedule(ctx context.Context, id uint) (*models.Schedule, error) {
+	schedule, err := s.repository.GetByID(ctx, id)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %d", ErrScheduleNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка получения расписания: %w", err)
+	}
+	return schedule, nil
+}
+
+// ListSchedules получает список расписаний с пагинацией
+func (s *ScheduleServiceImpl) ListSchedules(ctx context.Context, params ListScheduleParams) (*ScheduleList, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 20
+	}
+	if params.PageSize > 100 {
+		params.PageSize = 100
+	}
+
+	schedules, total, err := s.repository.List(ctx, params)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).Error("Ошибка получения списка расписаний")
+		return nil, fmt.Errorf("ошибка получения списка расписаний: %w", err)
+	}
+
+	totalPages := int((total + int64(params.PageSize) - 1) / int64(params.PageSize))
+
+	return &ScheduleList{
+		Schedules:  schedules,
+		Total:      total,
+		Page:       params.Page,
+		PageSize:   params.PageSize,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// UpdateSchedule обновляет расписание и пересчитывает время следующего запуска
+func (s *ScheduleServiceImpl) UpdateSchedule(ctx context.Context, id uint, params ScheduleUpdateParams) (*models.Schedule, error) {
+	schedule, err := s.GetSchedule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	updates["updated_by"] = actorOr(ctx, params.UpdatedBy)
+	updates["updated_at"] = time.Now().UTC()
+
+	if params.Name != nil {
+		schedule.Name = *params.Name
+		updates["name"] = *params.Name
+	}
+	if params.ReportTitle != nil {
+		schedule.ReportTitle = *params.ReportTitle
+		updates["report_title"] = *params.ReportTitle
+	}
+	if params.ReportDescription != nil {
+		schedule.ReportDescription = *params.ReportDescription
+		updates["report_description"] = *params.ReportDescription
+	}
+	if params.Format != nil {
+		schedule.Format = *params.Format
+		updates["format"] = *params.Format
+	}
+	if params.ReportType != nil {
+		schedule.ReportType = *params.ReportType
+		updates["report_type"] = *params.ReportType
+	}
+	if params.Parameters != nil {
+		schedule.Parameters = *params.Parameters
+		updates["parameters"] = *params.Parameters
+	}
+
+	// Пересчитываем следующий запуск при изменении выражения или включении
+	reschedule := false
+	if params.CronExpr != nil {
+		schedule.CronExpr = *params.CronExpr
+		updates["cron_expr"] = *params.CronExpr
+		reschedule = true
+	}
+	if params.Enabled != nil {
+		schedule.Enabled = *params.Enabled
+		updates["enabled"] = *params.Enabled
+		reschedule = true
+	}
+
+	schedule.UpdatedBy = params.UpdatedBy
+	if err := schedule.Validate(); err != nil {
+		return nil, fmt.Errorf("ошибка валидации расписания: %w", err)
+	}
+
+	if reschedule {
+		cronSchedule, err := ParseCronExpression(schedule.CronExpr)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка валидации расписания: %w", err)
+		}
+
+		schedule.NextRunAt = nil
+		if schedule.Enabled {
+			next := cronSchedule.Next(time.Now().UTC())
+			schedule.NextRunAt = &next
+		}
+		updates["next_run_at"] = schedule.NextRunAt
+	}
+
+	if err := s.repository.Update(ctx, id, updates); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("schedule_id", id).Error("Ошибка обновления расписания")
+		return nil, fmt.Errorf("ошибка обновления расписания: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithField("schedule_id", id).Info("Расписание обновлено")
+	return schedule, nil
+}
+
+// DeleteSchedule удаляет расписание
+func (s *ScheduleServiceImpl) DeleteSchedule(ctx context.Context, id uint) error {
+	if _, err := s.GetSchedule(ctx, id); err != nil {
+		return err
+	}
+
+	if err := s.repository.Delete(ctx, id); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithField("schedule_id", id).Error("Ошибка удаления расписания")
+		return fmt.Errorf("ошибка удаления расписания: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithField("schedule_id", id).Info("Расписание удалено")
+	return nil
+}
+
+// Scheduler периодически запускает генерацию отчетов по расписаниям.
+// Новые отчеты создаются через ReportService и попадают в BackgroundProcessor.
+type Scheduler struct {
+	repository ScheduleRepository
+	reports    ReportService
+	fanOut     ScheduleFanOut
+	guard      ScheduleRunGuard
+	logger     logging.Logger
+	interval   time.Duration
+	batchSize  int
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler создает новый планировщик
+func NewScheduler(repository ScheduleRepository, reports ReportService, interval time.Duration, logger logging.Logger) *Scheduler {
+	if interval <= 0 {
+		interval = defaultSchedulerInterval
+	}
+
+	return &Scheduler{
+		repository: repository,
+		reports:    reports,
+		logger:     logger,
+		interval:   interval,
+		batchSize:  defaultSchedulerBatchSize,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// WithFanOut подключает раскладку запусков по итерационным запросам определений:
+// расписание создает по отчету на каждую строку запроса
+func (s *Scheduler) WithFanOut(fanOut ScheduleFanOut) *Scheduler {
+	s.fanOut = fanOut
+	return s
+}
+
+// WithRunGuard подключает проверку запусков по настройкам определений: запуск, совпадающий
+// с недавним отчетом, объединяется с ним, а запуск сверх ограничения пропускается
+func (s *Scheduler) WithRunGuard(guard ScheduleRunGuard) *Scheduler {
+	s.guard = guard
+	return s
+}
+
+// Start запускает цикл планировщика в отдельной горутине
+func (s *Scheduler) Start() {
+	s.logger.WithField("interval", s.interval).Info("Запуск планировщика отчетов")
+	go s.loop()
+}
+
+// Stop останавливает цикл планировщика
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.done:
+		s.logger.Info("Планировщик отчетов остановлен")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop основной цикл планировщика
+func (s *Scheduler) loop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), s.interval)
+			s.RunDue(ctx, time.Now().UTC())
+			cancel()
+		}
+	}
+}
+
+// RunDue запускает все расписания, время которых наступило, и возвращает число запусков
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) int {
+	schedules, err := s.repository.ListDue(ctx, now, s.batchSize)
+	if err != nil {
+		s.logger.WithError(err).Error("Ошибка получения расписаний для запуска")
+		return 0
+	}
+
+	started := 0
+	for i := range schedules {
+		if ctx.Err() != nil {
+			break
+		}
+		if s.runSchedule(ctx, &schedules[i], now) {
+			started++
+		}
+	}
+
+	return started
+}
+
+// runSchedule создает отчет по расписанию и сдвигает время следующего запуска
+func (s *Scheduler) runSchedule(ctx context.Context, schedule *models.Schedule, now time.Time) bool {
+	logger := s.logger.WithFields(logging.Fields{
+		"schedule_id": schedule.ID,
+		"name":        schedule.Name,
+	})
+
+	updates := map[string]interface{}{
+		"last_run_at": now,
+	}
+
+	cronSchedule, err := ParseCronExpression(schedule.CronExpr)
+	if err != nil {
+		// Некорректное выражение: отключаем расписание, чтобы не запускать его повторно
+		logger.WithError(err).Error("Некорректное cron выражение, расписание отключено")
+		updates["enabled"] = false
+		updates["next_run_at"] = nil
+		if err := s.repository.Update(ctx, schedule.ID, updates); err != nil {
+			logger.WithError(err).Error("Ошибка обновления расписания")
+		}
+		return false
+	}
+
+	// Запуск забирает один экземпляр сервиса: остальные, прочитавшие то же расписание, его пропускают
+	next := cronSchedule.Next(now)
+	if schedule.NextRunAt == nil {
+		return false
+	}
+	claimed, err := s.repository.Claim(ctx, schedule.ID, *schedule.NextRunAt, next)
+	if err != nil {
+		logger.WithError(err).Error("Ошибка захвата запуска расписания")
+		return false
+	}
+	if !claimed {
+		logger.Debug("Запуск расписания выполняет другой экземпляр сервиса")
+		return false
+	}
+
+	// Запуск приостановленного определения пропускается без отчета, расписание ждет следующего времени
+	if s.guard != nil {
+		if err := s.guard.CheckPaused(ctx, schedule); err != nil {
+			logger.WithError(err).WithField("next_run_at", next).Info("Запуск расписания пропущен")
+			return false
+		}
+	}
+
+	runs := []ScheduleRun{{Parameters: schedule.Parameters}}
+	if s.fanOut != nil {
+		if runs, err = s.fanOut.Expand(ctx, schedule); err != nil {
+			logger.WithError(err).Error("Ошибка итерационного запроса расписания")
+		}
+	}
+
+	// Ошибка одного отчета не отменяет остальные отчеты запуска
+	started := false
+	for _, run := range runs {
+		report, err := s.buildReport(schedule, run)
+		if err == nil && s.guard != nil {
+			var existing *models.Report
+			if existing, err = s.guard.Admit(ctx, report); existing != nil {
+				updates["last_report_id"] = existing.ID
+				logger.WithFields(logging.Fields{
+					"report_id": existing.ID,
+					"label":     run.Label,
+				}).Info("Запуск расписания объединен с недавним отчетом")
+				continue
+			}
+			if errors.Is(err, ErrRunLimit) {
+				logger.WithError(err).WithField("label", run.Label).Warn("Запуск расписания пропущен")
+				continue
+			}
+		}
+		if err == nil {
+			err = s.reports.CreateReport(ctx, report)
+		}
+		if err != nil {
+			logger.WithError(err).WithField("label", run.Label).Error("Ошибка запуска отчета по расписанию")
+			continue
+		}
+		updates["last_report_id"] = report.ID
+		started = true
+		logger.WithFields(logging.Fields{
+			"report_id":   report.ID,
+			"label":       run.Label,
+			"next_run_at": next,
+		}).Info("Отчет по расписанию запущен")
+	}
+	if len(runs) > 1 {
+		logger.WithField("reports", len(runs)).Info("Запуск расписания разложен по итерационному запросу")
+	}
+
+	if err := s.repository.Update(ctx, schedule.ID, updates); err != nil {
+		logger.WithError(err).Error("Ошибка обновления расписания")
+	}
+
+	return started
+}
+
+// buildReport создает отчет запуска расписания
+func (s *Scheduler) buildReport(schedule *models.Schedule, run ScheduleRun) (*models.Report, error) {
+	parameters := models.NewJSON()
+	for key, value := range run.Parameters {
+		parameters.Set(key, value)
+	}
+
+	return models.NewReportBuilder().
+		WithTitle(runTitle(schedule.ReportTitle, run)).
+		WithType(schedule.ReportType).
+		WithDescription(schedule.ReportDescription).
+		WithFormat(schedule.Format).
+		WithParameters(parameters).
+		WithCreatedBy(schedule.CreatedBy).
+		WithSchedule(schedule.ID).
+		Build()
+}
+
+// GormScheduleRepository реализация репозитория расписаний для GORM
+type GormScheduleRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormScheduleRepository создает новый GORM репозиторий расписаний
+func NewGormScheduleRepository(db *gorm.DB, logger logging.Logger) ScheduleRepository {
+	return &GormScheduleRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Create создает новое расписание в БД
+func (r *GormScheduleRepository) Create(ctx context.Context, schedule *models.Schedule) error {
+	return r.db.WithContext(ctx).Create(schedule).Error
+}
+
+// GetByID получает расписание по ID
+func (r *GormScheduleRepository) GetByID(ctx context.Context, id uint) (*models.Schedule, error) {
+	var schedule models.Schedule
+	err := r.db.WithContext(ctx).First(&schedule, id).Error
+	return &schedule, err
+}
+
+// List получает список расписаний с пагинацией
+func (r *GormScheduleRepository) List(ctx context.Context, params ListScheduleParams) ([]models.Schedule, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Schedule{})
+
+	if params.Enabled != nil {
+		query = query.Where("enabled = ?", *params.Enabled)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (params.Page - 1) * params.PageSize
+	var schedules []models.Schedule
+	err := query.Order("id").Offset(offset).Limit(params.PageSize).Find(&schedules).Error
+
+	return schedules, total, err
+}
+
+// ListDue возвращает включенные расписания, время запуска которых наступило
+func (r *GormScheduleRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error) {
+	var schedules []models.Schedule
+	err := r.db.WithContext(ctx).
+		Where("enabled = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).
+		Order("next_run_at").
+		Limit(limit).
+		Find(&schedules).Error
+	return schedules, err
+}
+
+// Claim сдвигает время следующего запуска условным UPDATE: из экземпляров, прочитавших
+// одно и то же время запуска, строку изменяет только первый
+func (r *GormScheduleRepository) Claim(ctx context.Context, id uint, due time.Time, next time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Schedule{}).
+		Where("id = ? AND enabled = ? AND next_run_at = ?", id, true, due).
+		Update("next_run_at", next)
+	return result.RowsAffected == 1, result.Error
+}
+
+// Update обновляет расписание
+func (r *GormScheduleRepository) Update(ctx context.Context, id uint, updates map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&models.Schedule{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Delete удаляет расписание
+func (r *GormScheduleRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Schedule{}, id).Error
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSchedule() *models.Schedule {
+	return &models.Schedule{
+		Name:        "Daily sales",
+		CronExpr:    "0 6 * * *",
+		Enabled:     true,
+		ReportTitle: "Sales",
+		Parameters:  models.JSON{"region": "north"},
+		CreatedBy:   "test-user",
+	}
+}
+
+func TestParseCronExpression(t *testing.T) {
+	_, err := ParseCronExpression("*/15 * * * *")
+	assert.NoError(t, err)
+
+	_, err = ParseCronExpression("@daily")
+	assert.NoError(t, err)
+
+	_, err = ParseCronExpression("not a cron")
+	assert.Error(t, err)
+}
+
+func TestCreateScheduleSetsNextRun(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Schedule{}))
+	service := NewScheduleService(NewGormScheduleRepository(db, setupTestLogger()), setupTestLogger())
+
+	schedule := newTestSchedule()
+	require.NoError(t, service.CreateSchedule(context.Background(), schedule))
+
+	assert.NotZero(t, schedule.ID)
+	assert.Equal(t, models.FormatXLSX, schedule.Format)
+	require.NotNil(t, schedule.NextRunAt)
+	assert.True(t, schedule.NextRunAt.After(time.Now().UTC()))
+
+	disabled := false
+	updated, err := service.UpdateSchedule(context.Background(), schedule.ID, ScheduleUpdateParams{
+		Enabled:   &disabled,
+		UpdatedBy: "test-user",
+	})
+	require.NoError(t, err)
+	assert.Nil(t, updated.NextRunAt)
+
+	invalid := newTestSchedule()
+	invalid.CronExpr = "every day"
+	assert.Error(t, service.CreateSchedule(context.Background(), invalid))
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Schedule{}))
+	logger := setupTestLogger()
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	repository := NewGormScheduleRepository(db, logger)
+	scheduler := NewScheduler(repository, newTestReportService(t, db, mockStorage, logger), time.Minute, logger)
+
+	schedule := newTestSchedule()
+	require.NoError(t, NewScheduleService(repository, logger).CreateSchedule(context.Background(), schedule))
+
+	// Расписание еще не наступило
+	assert.Equal(t, 0, scheduler.RunDue(context.Background(), time.Now().UTC()))
+
+	now := schedule.NextRunAt.Add(time.Second)
+	assert.Equal(t, 1, scheduler.RunDue(context.Background(), now))
+
+	stored, err := repository.GetByID(context.Background(), schedule.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.LastReportID)
+	require.NotNil(t, stored.NextRunAt)
+	assert.True(t, stored.NextRunAt.After(now))
+
+	var report models.Report
+	require.NoError(t, db.First(&report, *stored.LastReportID).Error)
+	assert.Equal(t, "Sales", report.Title)
+	require.NotNil(t, report.ScheduleID)
+	assert.Equal(t, schedule.ID, *report.ScheduleID)
+	assert.Equal(t, "north", report.Parameters["region"])
+
+	// Повторный запуск в то же время ничего не создает
+	assert.Equal(t, 0, scheduler.RunDue(context.Background(), now))
+}
+
+func TestSchedulerClaimsDueScheduleOnce(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Schedule{}))
+	logger := setupTestLogger()
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	repository := NewGormScheduleRepository(db, logger)
+	schedule := newTestSchedule()
+	require.NoError(t, NewScheduleService(repository, logger).CreateSchedule(context.Background(), schedule))
+
+	// Два экземпляра сервиса одновременно находят одно наступившее расписание
+	now := schedule.NextRunAt.Add(time.Second)
+	var started [2]int
+	var wg sync.WaitGroup
+	for i := range started {
+		scheduler := NewScheduler(repository, newTestReportService(t, db, mockStorage, logger), time.Minute, logger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started[i] = scheduler.RunDue(context.Background(), now)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, started[0]+started[1])
+	var reports int64
+	require.NoError(t, db.Model(&models.Report{}).Where("schedule_id = ?", schedule.ID).Count(&reports).Error)
+	assert.Equal(t, int64(1), reports)
+
+	// Запуск, уже забранный другим экземпляром, не захватывается повторно
+	claimed, err := repository.Claim(context.Background(), schedule.ID, *schedule.NextRunAt, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func TestSchedulerFansOutByIterator(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	require.NoError(t, db.AutoMigrate(&models.Schedule{}))
+	require.NoError(t, db.Exec("CREATE TABLE branches (code TEXT, city TEXT)").Error)
+	require.NoError(t, db.Exec("INSERT INTO branches VALUES ('msk', 'Moscow'), ('spb', 'Saint Petersburg'), ('kzn', 'Kazan')").Error)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := &models.ReportDefinition{
+		Name:      "branch-sales",
+		Queries:   models.Queries{{Name: "branch", SQL: "SELECT @code AS code, @city AS city"}},
+		Iterator:  &models.Iterator{SQL: "SELECT code, city FROM branches WHERE city <> @skip ORDER BY code"},
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	repository := NewGormScheduleRepository(db, logger)
+	fanOut := NewDefinitionFanOut(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), 2, logger)
+	scheduler := NewScheduler(repository, newTestReportService(t, db, mockStorage, logger), time.Minute, logger).
+		WithFanOut(fanOut)
+
+	schedule := newTestSchedule()
+	schedule.ReportType = definition.Name
+	schedule.Parameters = models.JSON{"skip": "Kazan", "city": "ignored"}
+	require.NoError(t, NewScheduleService(repository, logger).CreateSchedule(ctx, schedule))
+
+	now := schedule.NextRunAt.Add(time.Second)
+	assert.Equal(t, 1, scheduler.RunDue(ctx, now))
+
+	var reports []models.Report
+	require.NoError(t, db.Where("schedule_id = ?", schedule.ID).Order("id").Find(&reports).Error)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "Sales - msk", reports[0].Title)
+	assert.Equal(t, "Sales - spb", reports[1].Title)
+	assert.Equal(t, definition.Name, reports[1].Type)
+	// Значения строки заменяют одноименные параметры расписания
+	assert.Equal(t, "Saint Petersburg", reports[1].Parameters["city"])
+	assert.Equal(t, "Kazan", reports[1].Parameters["skip"])
+
+	stored, err := repository.GetByID(ctx, schedule.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.LastReportID)
+	assert.Equal(t, reports[1].ID, *stored.LastReportID)
+
+	// Строк больше допустимого: запуск не создает ни одного отчета
+	require.NoError(t, repository.Update(ctx, schedule.ID, map[string]interface{}{"parameters": models.JSON{"skip": "-"}}))
+	assert.Equal(t, 0, scheduler.RunDue(ctx, stored.NextRunAt.Add(time.Second)))
+	var count int64
+	require.NoError(t, db.Model(&models.Report{}).Where("schedule_id = ?", schedule.ID).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestDefinitionRunGuard(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := &models.ReportDefinition{
+		Name:              "warehouse",
+		Queries:           models.Queries{{Name: "main", SQL: "SELECT 1 AS n"}},
+		Format:            models.FormatXLSX,
+		MaxConcurrentRuns: 1,
+		DedupeWindow:      "1h",
+		CreatedBy:         "test-user",
+		UpdatedBy:         "test-user",
+	}
+	require.NoError(t, definitions.Create(ctx, definition))
+	guard := NewDefinitionRunGuard(definitions, NewGormReportRepository(db, logger), logger)
+
+	run := func(region int64) *models.Report {
+		return &models.Report{Title: "Sales", Type: definition.Name, Parameters: models.JSON{"region": region}}
+	}
+
+	existing, err := guard.Admit(ctx, run(1))
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	previous := &models.Report{
+		Title:        "Sales",
+		Type:         definition.Name,
+		DefinitionID: &definition.ID,
+		Format:       models.FormatXLSX,
+		Status:       models.StatusPending,
+		Parameters:   models.JSON{"region": 1},
+		CreatedBy:    "test-user",
+		UpdatedBy:    "test-user",
+	}
+	require.NoError(t, db.Create(previous).Error)
+
+	// Те же параметры в пределах окна объединяются с недавним отчетом
+	existing, err = guard.Admit(ctx, run(1))
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, previous.ID, existing.ID)
+
+	// Другие параметры упираются в ограничение одновременных запусков
+	_, err = guard.Admit(ctx, run(2))
+	assert.ErrorIs(t, err, ErrRunLimit)
+
+	require.NoError(t, db.Model(previous).Update("status", models.StatusCompleted).Error)
+	existing, err = guard.Admit(ctx, run(2))
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// Отчет, завершенный ошибкой, не объединяется с новыми запусками
+	require.NoError(t, db.Model(previous).Update("status", models.StatusFailed).Error)
+	existing, err = guard.Admit(ctx, run(1))
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+}
+
+func TestSchedulerCoalescesRunsWithinDedupeWindow(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	require.NoError(t, db.AutoMigrate(&models.Schedule{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := &models.ReportDefinition{
+		Name:         "warehouse",
+		Queries:      models.Queries{{Name: "main", SQL: "SELECT @region AS region"}},
+		DedupeWindow: "1h",
+		CreatedBy:    "test-user",
+		UpdatedBy:    "test-user",
+	}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	repository := NewGormScheduleRepository(db, logger)
+	scheduler := NewScheduler(repository, newTestReportService(t, db, mockStorage, logger), time.Minute, logger).
+		WithRunGuard(NewDefinitionRunGuard(definitions, NewGormReportRepository(db, logger), logger))
+
+	schedule := newTestSchedule()
+	schedule.ReportType = definition.Name
+	require.NoError(t, NewScheduleService(repository, logger).CreateSchedule(ctx, schedule))
+
+	assert.Equal(t, 1, scheduler.RunDue(ctx, schedule.NextRunAt.Add(time.Second)))
+	first, err := repository.GetByID(ctx, schedule.ID)
+	require.NoError(t, err)
+	require.NotNil(t, first.LastReportID)
+
+	// Следующий запуск в пределах окна не создает отчет и ссылается на предыдущий
+	assert.Equal(t, 0, scheduler.RunDue(ctx, first.NextRunAt.Add(time.Second)))
+	second, err := repository.GetByID(ctx, schedule.ID)
+	require.NoError(t, err)
+	require.NotNil(t, second.LastReportID)
+	assert.Equal(t, *first.LastReportID, *second.LastReportID)
+	assert.True(t, second.NextRunAt.After(*first.NextRunAt))
+
+	var count int64
+	require.NoError(t, db.Model(&models.Report{}).Where("schedule_id = ?", schedule.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestSchedulerSkipsPausedDefinition(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	require.NoError(t, db.AutoMigrate(&models.Schedule{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	definition := &models.ReportDefinition{
+		Name:      "warehouse",
+		Queries:   models.Queries{{Name: "main", SQL: "SELECT 1 AS n"}},
+		Iterator:  &models.Iterator{SQL: "SELECT 'north' AS region"},
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	require.NoError(t, definitions.Create(ctx, definition))
+	service := NewDefinitionService(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), new(MockStorage), logger)
+
+	mockStorage := new(MockStorage)
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	repository := NewGormScheduleRepository(db, logger)
+	scheduler := NewScheduler(repository, newTestReportService(t, db, mockStorage, logger), time.Minute, logger).
+		WithFanOut(NewDefinitionFanOut(definitions, newTestQueryValidator(t), newTestDataSources(t, db, nil), 0, logger)).
+		WithRunGuard(NewDefinitionRunGuard(definitions, NewGormReportRepository(db, logger), logger))
+
+	schedule := newTestSchedule()
+	schedule.ReportType = definition.Name
+	require.NoError(t, NewScheduleService(repository, logger).CreateSchedule(ctx, schedule))
+	other := newTestSchedule()
+	require.NoError(t, NewScheduleService(repository, logger).CreateSchedule(ctx, other))
+
+	paused, err := service.PauseSchedules(ctx, definition.ID, "admin")
+	require.NoError(t, err)
+	assert.True(t, paused.SchedulesPaused)
+	assert.Equal(t, "admin", paused.SchedulesPausedBy)
+	require.NotNil(t, paused.SchedulesPausedAt)
+
+	// Запуск приостановленного определения пропускается, расписания других отчетов запускаются
+	now := schedule.NextRunAt.Add(time.Second)
+	assert.Equal(t, 1, scheduler.RunDue(ctx, now))
+	skipped, err := repository.GetByID(ctx, schedule.ID)
+	require.NoError(t, err)
+	assert.Nil(t, skipped.LastRunAt)
+	assert.Nil(t, skipped.LastReportID)
+	require.NotNil(t, skipped.NextRunAt)
+	assert.True(t, skipped.NextRunAt.After(now))
+
+	resumed, err := service.ResumeSchedules(ctx, definition.ID, "admin")
+	require.NoError(t, err)
+	assert.False(t, resumed.SchedulesPaused)
+	stored, err := definitions.GetByID(ctx, definition.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.SchedulesPaused)
+	assert.Nil(t, stored.SchedulesPausedAt)
+
+	assert.Equal(t, 2, scheduler.RunDue(ctx, skipped.NextRunAt.Add(time.Second)))
+	var count int64
+	require.NoError(t, db.Model(&models.Report{}).Where("schedule_id = ?", schedule.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
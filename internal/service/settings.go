@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidUserSettings настройки пользователя не прошли проверку
+var ErrInvalidUserSettings = newCategoryError(ErrValidation, "некорректные настройки пользователя")
+
+// UserSettingsUpdateParams изменение настроек пользователя. Незаданные поля не меняются,
+// пустая строка сбрасывает формат, локаль или часовой пояс
+type UserSettingsUpdateParams struct {
+	DefaultFormat   *models.ReportFormat
+	Locale          *string
+	Timezone        *string
+	NotifyCompleted *bool
+	NotifyFailed    *bool
+	PageSize        *int
+}
+
+// UserSettingsService интерфейс для настроек пользователя по умолчанию
+type UserSettingsService interface {
+	GetSettings(ctx context.Context, subject string) (*models.UserSettings, error)
+	UpdateSettings(ctx context.Context, subject string, params UserSettingsUpdateParams) (*models.UserSettings, error)
+	// ResetSettings удаляет настройки пользователя, после чего действуют значения по умолчанию
+	ResetSettings(ctx context.Context, subject string) error
+}
+
+// UserSettingsRepository интерфейс для работы с настройками пользователей в базе данных
+type UserSettingsRepository interface {
+	Get(ctx context.Context, subject string) (*models.UserSettings, error)
+	Save(ctx context.Context, settings *models.UserSettings) error
+	Delete(ctx context.Context, subject string) error
+}
+
+// GormUserSettingsRepository реализация UserSettingsRepository с использованием GORM
+type GormUserSettingsRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormUserSettingsRepository создает новый репозиторий настроек пользователей
+func NewGormUserSettingsRepository(db *gorm.DB, logger logging.Logger) UserSettingsRepository {
+	return &GormUserSettingsRepository{db: db, logger: logger}
+}
+
+// Get возвращает настройки пользователя
+func (r *GormUserSettingsRepository) Get(ctx context.Context, subject string) (*models.UserSettings, error) {
+	var settings models.UserSettings
+	if err := r.db.WithContext(ctx).Where("subject = ?", subject).First(&settings).Error; err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Save создает или заменяет настройки пользователя
+func (r *GormUserSettingsRepository) Save(ctx context.Context, settings *models.UserSettings) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "subject"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"default_format", "locale", "timezone", "notify_completed", "notify_failed", "page_size", "updated_at",
+		}),
+	}).Create(settings).Error
+}
+
+// Delete удаляет настройки пользователя
+func (r *GormUserSettingsRepository) Delete(ctx context.Context, subject string) error {
+	return r.db.WithContext(ctx).Where("subject = ?", subject).Delete(&models.UserSettings{}).Error
+}
+
+// loadUserSettings возвращает настройки пользователя или значения по умолчанию, если
+// пользователь их не менял, хранилище не подключено или недоступно
+func loadUserSettings(ctx context.Context, repository UserSettingsRepository, subject string, logger logging.Logger) *models.UserSettings {
+	if repository == nil || subject == "" {
+		return models.DefaultUserSettings(subject)
+	}
+	settings, err := repository.Get(ctx, subject)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logging.FromContext(ctx, logger).WithError(err).Warn("Ошибка получения настроек пользователя")
+		}
+		return models.DefaultUserSettings(subject)
+	}
+	return settings
+}
+
+// applyUserSettings задает отчету локаль и часовой пояс из настроек автора, если они
+// не указаны в параметрах. Параметры копируются, чтобы не менять данные вызывающего
+func applyUserSettings(report *models.Report, settings *models.UserSettings) {
+	defaults := map[string]string{models.ParamLocale: settings.Locale, models.ParamTimezone: settings.Timezone}
+	for key, value := range defaults {
+		if value == "" || report.Parameters.Has(key) {
+			continue
+		}
+		parameters := make(models.JSON, len(report.Parameters)+1)
+		for k, v := range report.Parameters {
+			parameters[k] = v
+		}
+		parameters.Set(key, value)
+		report.Parameters = parameters
+	}
+}
+
+// UserSettingsServiceImpl реализация сервиса настроек пользователей
+type UserSettingsServiceImpl struct {
+	repository UserSettingsRepository
+	logger     logging.Logger
+}
+
+// NewUserSettingsService создает сервис настроек пользователей
+func NewUserSettingsService(repository UserSettingsRepository, logger logging.Logger) *UserSettingsServiceImpl {
+	return &UserSettingsServiceImpl{repository: repository, logger: logger}
+}
+
+// NewUserSettingsServiceFromDB создает сервис настроек пользователей с хранилищем в базе данных
+func NewUserSettingsServiceFromDB(db *gorm.DB, logger logging.Logger) UserSettingsService {
+	return NewUserSettingsService(NewGormUserSettingsRepository(db, logger), logger)
+}
+
+// GetSettings возвращает настройки пользователя. Пользователю, который их не менял,
+// возвращаются значения по умолчанию
+func (s *UserSettingsServiceImpl) GetSettings(ctx context.Context, subject string) (*models.UserSettings, error) {
+	if subject == "" {
+		return nil, fmt.Errorf("%w: не указан пользователь", ErrInvalidUserSettings)
+	}
+
+	settings, err := s.repository.Get(ctx, subject)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultUserSettings(subject), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения настроек пользователя: %w", err)
+	}
+	return settings, nil
+}
+
+// UpdateSettings меняет заданные настройки пользователя
+func (s *UserSettingsServiceImpl) UpdateSettings(ctx context.Context, subject string, params UserSettingsUpdateParams) (*models.UserSettings, error) {
+	settings, err := s.GetSettings(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.DefaultFormat != nil {
+		settings.DefaultFormat = *params.DefaultFormat
+	}
+	if params.Locale != nil {
+		settings.Locale = strings.TrimSpace(*params.Locale)
+	}
+	if params.Timezone != nil {
+		settings.Timezone = strings.TrimSpace(*params.Timezone)
+	}
+	if params.NotifyCompleted != nil {
+		settings.NotifyCompleted = *params.NotifyCompleted
+	}
+	if params.NotifyFailed != nil {
+		settings.NotifyFailed = *params.NotifyFailed
+	}
+	if params.PageSize != nil {
+		settings.PageSize = *params.PageSize
+	}
+	if errs := settings.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidUserSettings, strings.Join(errs, "; "))
+	}
+
+	if err := s.repository.Save(ctx, settings); err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).Error("Ошибка сохранения настроек пользователя")
+		return nil, fmt.Errorf("ошибка сохранения настроек пользователя: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).WithField("subject", subject).Info("Настройки пользователя изменены")
+	return settings, nil
+}
+
+// ResetSettings удаляет настройки пользователя
+func (s *UserSettingsServiceImpl) ResetSettings(ctx context.Context, subject string) error {
+	if subject == "" {
+		return fmt.Errorf("%w: не указан пользователь", ErrInvalidUserSettings)
+	}
+	if err := s.repository.Delete(ctx, subject); err != nil {
+		return fmt.Errorf("ошибка удаления настроек пользователя: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserSettingsValidate(t *testing.T) {
+	assert.Empty(t, models.DefaultUserSettings("alice").Validate())
+	assert.Empty(t, (&models.UserSettings{DefaultFormat: models.FormatCSV, Locale: "ar-EG", Timezone: "Europe/Moscow", PageSize: 50}).Validate())
+
+	invalid := &models.UserSettings{DefaultFormat: "rtf", Locale: "not a locale", Timezone: "Mars/Olympus", PageSize: 500}
+	assert.Len(t, invalid.Validate(), 4)
+	assert.Len(t, (&models.UserSettings{Timezone: "Local"}).Validate(), 1)
+
+	report := &models.Report{Parameters: models.JSON{models.ParamTimezone: "Asia/Tokyo"}}
+	local := report.LocalTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 9, local.Hour())
+	assert.Equal(t, 0, (&models.Report{}).LocalTime(local).Hour())
+}
+
+func TestUserSettingsService(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.UserSettings{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	service := NewUserSettingsServiceFromDB(db, logger)
+
+	settings, err := service.GetSettings(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultUserSettings("alice"), settings)
+
+	format, timezone, notify := models.FormatCSV, "Europe/Moscow", false
+	settings, err = service.UpdateSettings(ctx, "alice", UserSettingsUpdateParams{DefaultFormat: &format, Timezone: &timezone, NotifyFailed: &notify})
+	require.NoError(t, err)
+	assert.Equal(t, models.FormatCSV, settings.DefaultFormat)
+	assert.True(t, settings.NotifyCompleted)
+	assert.False(t, settings.NotifyFailed)
+
+	// Незаданные поля не меняются
+	pageSize := 50
+	settings, err = service.UpdateSettings(ctx, "alice", UserSettingsUpdateParams{PageSize: &pageSize})
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Moscow", settings.Timezone)
+	assert.Equal(t, 50, settings.PageSize)
+
+	invalid := "Mars/Olympus"
+	_, err = service.UpdateSettings(ctx, "alice", UserSettingsUpdateParams{Timezone: &invalid})
+	assert.ErrorIs(t, err, ErrValidation)
+	_, err = service.GetSettings(ctx, "")
+	assert.ErrorIs(t, err, ErrValidation)
+
+	require.NoError(t, service.ResetSettings(ctx, "alice"))
+	settings, err = service.GetSettings(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, settings.Timezone)
+}
+
+func TestCreateReportAppliesUserSettings(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.UserSettings{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	settings := NewGormUserSettingsRepository(db, logger)
+	require.NoError(t, settings.Save(ctx, &models.UserSettings{
+		Subject:       "alice",
+		DefaultFormat: models.FormatCSV,
+		Locale:        "de",
+		Timezone:      "Europe/Berlin",
+		PageSize:      1,
+	}))
+
+	repository := NewGormReportRepository(db, logger)
+	service := NewReportService(repository, NewFormatGenerators(logger),
+		NewReportFileStorage(new(MockStorage), logger), &stubProcessor{}, events.NewInProcessBus(logger), logger).
+		WithUserSettings(settings)
+
+	parameters := models.JSON{models.ParamLocale: "fr"}
+	report := &models.Report{Title: "Sales", Parameters: parameters, CreatedBy: "alice", UpdatedBy: "alice"}
+	require.NoError(t, service.CreateReport(ctx, report))
+	assert.Equal(t, models.FormatCSV, report.Format)
+	assert.Equal(t, "fr", report.Parameters[models.ParamLocale])
+	assert.Equal(t, "Europe/Berlin", report.Parameters[models.ParamTimezone])
+	// Параметры вызывающего не меняются
+	assert.False(t, parameters.Has(models.ParamTimezone))
+
+	// Явный формат важнее настроек, у других пользователей настроек нет
+	other := &models.Report{Title: "Stock", Format: models.FormatJSON, CreatedBy: "bob", UpdatedBy: "bob"}
+	require.NoError(t, service.CreateReport(ctx, other))
+	assert.Equal(t, models.FormatJSON, other.Format)
+	assert.False(t, other.Parameters.Has(models.ParamTimezone))
+
+	// Размер страницы по умолчанию берется из настроек пользователя запроса
+	list, err := service.ListReports(WithActor(ctx, "alice"), ListReportParams{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, list.PageSize)
+	list, err = service.ListReports(ctx, ListReportParams{})
+	require.NoError(t, err)
+	assert.Equal(t, 20, list.PageSize)
+}
+
+func TestInboxNotifierRespectsUserSettings(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.Notification{}, &models.UserSettings{}))
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	settings := NewGormUserSettingsRepository(db, logger)
+	require.NoError(t, settings.Save(ctx, &models.UserSettings{Subject: "alice", NotifyCompleted: false, NotifyFailed: true}))
+
+	notifications := NewGormNotificationRepository(db, logger)
+	notifier := NewInboxNotifier(config.Inbox{}, notifications, settings, logger)
+	require.NoError(t, notifier.Notify(ctx, &models.Report{ID: 1, Status: models.StatusCompleted, CreatedBy: "alice"}))
+	require.NoError(t, notifier.Notify(ctx, &models.Report{ID: 2, Status: models.StatusFailed, CreatedBy: "alice"}))
+
+	list, total, err := notifications.List(ctx, NotificationListParams{Recipient: "alice", Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	assert.Equal(t, uint(2), list[0].ReportID)
+}
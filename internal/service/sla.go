@@ -0,0 +1,424 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultSLAInterval период проверки сроков по умолчанию
+	defaultSLAInterval = time.Minute
+	// slaBatchSize максимальное число отчетов одного определения, проверяемых за проход
+	slaBatchSize = 100
+	// maxSLABreaches максимальное число нарушений в списке для мониторинга
+	maxSLABreaches = 500
+	// slackAlertTimeout ограничение на отправку оповещения в Slack
+	slackAlertTimeout = 10 * time.Second
+)
+
+// SLABreachAlert оповещение о нарушении сроков генерации отчета
+type SLABreachAlert struct {
+	Report     *models.Report
+	Definition *models.ReportDefinition
+	Breach     models.SLABreach
+	Limit      time.Duration
+	Elapsed    time.Duration
+}
+
+// Text возвращает описание нарушения для оповещения
+func (a SLABreachAlert) Text() string {
+	what := "ожидает в очереди"
+	if a.Breach == models.SLABreachDuration {
+		what = "генерируется"
+	}
+	return fmt.Sprintf("Нарушение SLA: отчет «%s» (#%d, определение %s) %s %s при сроке %s",
+		a.Report.Title, a.Report.ID, a.Definition.Name, what,
+		a.Elapsed.Truncate(time.Second), a.Limit)
+}
+
+// SLAAlerter отправляет оповещения о нарушениях SLA
+type SLAAlerter interface {
+	AlertSLABreach(ctx context.Context, alert SLABreachAlert) error
+}
+
+// EmailSLAAlerter отправляет оповещения о нарушениях по почте на адреса из конфигурации
+// и из SLA определения
+type EmailSLAAlerter struct {
+	sender     MailSender
+	from       mail.Address
+	recipients []string
+}
+
+// NewEmailSLAAlerter создает оповещение о нарушениях SLA по почте
+func NewEmailSLAAlerter(cfg config.SMTP, sender MailSender, recipients []string) *EmailSLAAlerter {
+	return &EmailSLAAlerter{
+		sender:     sender,
+		from:       mail.Address{Name: cfg.FromName, Address: cfg.From},
+		recipients: recipients,
+	}
+}
+
+// AlertSLABreach отправляет письмо о нарушении. Без получателей письмо не отправляется
+func (a *EmailSLAAlerter) AlertSLABreach(ctx context.Context, alert SLABreachAlert) error {
+	to := append([]string{}, a.recipients...)
+	if alert.Definition.SLA != nil {
+		to = append(to, alert.Definition.SLA.AlertEmails...)
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	message := &emailMessage{
+		from:    a.from.String(),
+		to:      to,
+		subject: fmt.Sprintf("Нарушение SLA отчета «%s»", alert.Report.Title),
+		body:    alert.Text() + "\r\n",
+	}
+	if err := a.sender.Send(ctx, a.from.Address, to, message.Write); err != nil {
+		return fmt.Errorf("ошибка отправки письма о нарушении SLA: %w", err)
+	}
+	return nil
+}
+
+// SlackSLAAlerter отправляет оповещения о нарушениях во входящий вебхук Slack
+type SlackSLAAlerter struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewSlackSLAAlerter создает оповещение о нарушениях SLA в Slack
+func NewSlackSLAAlerter(webhookURL string) *SlackSLAAlerter {
+	return &SlackSLAAlerter{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: slackAlertTimeout},
+	}
+}
+
+// AlertSLABreach отправляет сообщение о нарушении в Slack
+func (a *SlackSLAAlerter) AlertSLABreach(ctx context.Context, alert SLABreachAlert) error {
+	if err := postWebhook(ctx, a.client, a.webhookURL, map[string]string{"text": slackEscape(alert.Text())}); err != nil {
+		return fmt.Errorf("ошибка отправки оповещения в Slack: %w", err)
+	}
+	return nil
+}
+
+// SLAMonitor периодически проверяет сроки SLA определений: отчеты, которые ждут в очереди
+// дольше max_queue_wait или генерируются дольше max_duration, отмечаются нарушением.
+// О каждом нарушении публикуется событие report.sla_breached, увеличивается метрика
+// reports.sla.breaches и отправляются оповещения. Отметка условная, поэтому при нескольких
+// экземплярах сервиса о нарушении оповещают один раз
+type SLAMonitor struct {
+	definitions DefinitionRepository
+	reports     ReportRepository
+	publisher   events.Publisher
+	alerters    []SLAAlerter
+	interval    time.Duration
+	breaches    metric.Int64Counter
+	logger      logging.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewSLAMonitor создает проверку сроков SLA
+func NewSLAMonitor(
+	cfg config.SLA,
+	definitions DefinitionRepository,
+	reports ReportRepository,
+	publisher events.Publisher,
+	alerters []SLAAlerter,
+	logger logging.Logger,
+) *SLAMonitor {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultSLAInterval
+	}
+
+	var breaches metric.Int64Counter = noop.Int64Counter{}
+	counter, err := telemetry.Meter("service").Int64Counter("reports.sla.breaches",
+		metric.WithDescription("Нарушения сроков SLA генерации отчетов"))
+	if err != nil {
+		logger.WithError(err).Warn("Ошибка регистрации метрики нарушений SLA")
+	} else {
+		breaches = counter
+	}
+
+	return &SLAMonitor{
+		definitions: definitions,
+		reports:     reports,
+		publisher:   publisher,
+		alerters:    alerters,
+		interval:    interval,
+		breaches:    breaches,
+		logger:      logger,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// NewSLAMonitorFromConfig создает проверку сроков SLA с оповещениями из конфигурации:
+// по почте, если включена отправка писем, и в Slack, если задан вебхук
+func NewSLAMonitorFromConfig(cfg config.Config, db *gorm.DB, bus events.Bus, logger logging.Logger) *SLAMonitor {
+	var alerters []SLAAlerter
+	if cfg.SMTP.Enabled {
+		alerters = append(alerters, NewEmailSLAAlerter(cfg.SMTP, NewSMTPSender(cfg.SMTP), cfg.SLA.AlertRecipients))
+	}
+	if cfg.SLA.SlackWebhookURL != "" {
+		alerters = append(alerters, NewSlackSLAAlerter(cfg.SLA.SlackWebhookURL))
+	}
+
+	return NewSLAMonitor(cfg.SLA, NewGormDefinitionRepository(db, logger), NewGormReportRepository(db, logger), bus, alerters, logger)
+}
+
+// Start запускает проверку сроков: сразу и затем периодически
+func (m *SLAMonitor) Start() {
+	m.logger.WithFields(logging.Fields{
+		"interval": m.interval,
+		"alerters": len(m.alerters),
+	}).Info("Запуск контроля сроков SLA")
+	go m.loop()
+}
+
+// Stop останавливает проверку сроков
+func (m *SLAMonitor) Stop(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stop) })
+
+	select {
+	case <-m.done:
+		m.logger.Info("Контроль сроков SLA остановлен")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop основной цикл проверки
+func (m *SLAMonitor) loop() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), m.interval)
+		m.Check(ctx, time.Now().UTC())
+		cancel()
+
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check отмечает отчеты, нарушившие сроки SLA к моменту now, и возвращает число новых нарушений
+func (m *SLAMonitor) Check(ctx context.Context, now time.Time) int {
+	definitions, err := m.definitions.ListWithSLA(ctx)
+	if err != nil {
+		m.logger.WithError(err).Error("Ошибка получения определений со сроками SLA")
+		return 0
+	}
+
+	breached := 0
+	for i := range definitions {
+		definition := &definitions[i]
+		for _, breach := range []models.SLABreach{models.SLABreachQueueWait, models.SLABreachDuration} {
+			limit := definition.SLA.Limit(breach)
+			if limit <= 0 || ctx.Err() != nil {
+				continue
+			}
+			breached += m.check(ctx, definition, breach, limit, now)
+		}
+	}
+
+	if breached > 0 {
+		m.logger.WithField("count", breached).Warn("Обнаружены нарушения сроков SLA")
+	}
+	return breached
+}
+
+// check отмечает отчеты определения, нарушившие срок limit
+func (m *SLAMonitor) check(ctx context.Context, definition *models.ReportDefinition, breach models.SLABreach, limit time.Duration, now time.Time) int {
+	logger := m.logger.WithFields(logging.Fields{
+		"definition": definition.Name,
+		"breach":     breach,
+	})
+
+	reports, err := m.reports.ListSLACandidates(ctx, definition.ID, breach, now.Add(-limit), slaBatchSize)
+	if err != nil {
+		logger.WithError(err).Error("Ошибка получения отчетов для проверки сроков SLA")
+		return 0
+	}
+
+	breached := 0
+	for i := range reports {
+		report := &reports[i]
+		claimed, err := m.reports.MarkSLABreach(ctx, report.ID, breach, now)
+		if err != nil {
+			logger.WithError(err).WithField("report_id", report.ID).Error("Ошибка отметки нарушения SLA")
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		breached++
+
+		report.SLABreach = breach
+		report.SLABreachedAt = &now
+		m.notify(ctx, logger, SLABreachAlert{
+			Report:     report,
+			Definition: definition,
+			Breach:     breach,
+			Limit:      limit,
+			Elapsed:    slaElapsed(report, breach, now),
+		})
+	}
+	return breached
+}
+
+// notify публикует событие, учитывает нарушение в метрике и отправляет оповещения.
+// Ошибка одного оповещения не мешает остальным
+func (m *SLAMonitor) notify(ctx context.Context, logger logging.Logger, alert SLABreachAlert) {
+	logger = logger.WithFields(logging.Fields{
+		"report_id": alert.Report.ID,
+		"limit":     alert.Limit,
+		"elapsed":   alert.Elapsed,
+	})
+	logger.Warn("Отчет нарушил срок SLA")
+
+	event := events.NewEvent(events.ReportSLABreached, alert.Report.ID, alert.Report.Status).WithSLABreach(alert.Breach)
+	publishEvent(ctx, m.publisher, logger, event)
+
+	m.breaches.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("definition", alert.Definition.Name),
+		attribute.String("breach", string(alert.Breach)),
+	))
+
+	for _, alerter := range m.alerters {
+		if err := alerter.AlertSLABreach(ctx, alert); err != nil {
+			logger.WithError(err).Warn("Не удалось отправить оповещение о нарушении SLA")
+		}
+	}
+}
+
+// slaElapsed возвращает ожидание в очереди или длительность генерации отчета к моменту now.
+// Ожидание отчета, который уже генерируется, считается до начала генерации
+func slaElapsed(report *models.Report, breach models.SLABreach, now time.Time) time.Duration {
+	if breach == models.SLABreachDuration {
+		started := report.UpdatedAt
+		if report.StartedAt != nil {
+			started = *report.StartedAt
+		}
+		return now.Sub(started)
+	}
+	if report.Status != models.StatusPending && report.StartedAt != nil {
+		return report.StartedAt.Sub(report.CreatedAt)
+	}
+	return now.Sub(report.CreatedAt)
+}
+
+// SLABreachInfo текущее нарушение SLA: отчет в очереди или в генерации, нарушивший срок
+type SLABreachInfo struct {
+	ReportID       uint                `json:"report_id"`
+	Title          string              `json:"title"`
+	Definition     string              `json:"definition"`
+	Status         models.ReportStatus `json:"status"`
+	Breach         models.SLABreach    `json:"breach"`
+	LimitSeconds   float64             `json:"limit_seconds"`
+	ElapsedSeconds float64             `json:"elapsed_seconds"`
+	CreatedBy      string              `json:"created_by"`
+	CreatedAt      time.Time           `json:"created_at"`
+	StartedAt      *time.Time          `json:"started_at,omitempty"`
+	BreachedAt     time.Time           `json:"breached_at"`
+}
+
+// SLABreachList текущие нарушения SLA для мониторинга
+type SLABreachList struct {
+	Breaches   []SLABreachInfo `json:"breaches"`
+	Total      int             `json:"total"`
+	ComputedAt time.Time       `json:"computed_at"`
+}
+
+// SLAService интерфейс текущих нарушений сроков SLA
+type SLAService interface {
+	// ListBreaches возвращает отчеты в очереди и в генерации, нарушившие сроки SLA
+	ListBreaches(ctx context.Context) (*SLABreachList, error)
+}
+
+// SLAServiceImpl реализация SLAService
+type SLAServiceImpl struct {
+	definitions DefinitionRepository
+	reports     ReportRepository
+	now         func() time.Time
+}
+
+// NewSLAService создает сервис нарушений SLA
+func NewSLAService(definitions DefinitionRepository, reports ReportRepository) *SLAServiceImpl {
+	return &SLAServiceImpl{definitions: definitions, reports: reports, now: time.Now}
+}
+
+// NewSLAServiceFromDB создает сервис нарушений SLA с репозиториями в базе данных
+func NewSLAServiceFromDB(db *gorm.DB, logger logging.Logger) SLAService {
+	return NewSLAService(NewGormDefinitionRepository(db, logger), NewGormReportRepository(db, logger))
+}
+
+// ListBreaches возвращает текущие нарушения, от давних к новым. Срок берется из текущих
+// настроек определения: если SLA определения сняли, срок в списке 0
+func (s *SLAServiceImpl) ListBreaches(ctx context.Context) (*SLABreachList, error) {
+	reports, err := s.reports.ListSLABreaches(ctx, maxSLABreaches)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения нарушений SLA: %w", err)
+	}
+
+	definitions, err := s.definitions.ListWithSLA(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения определений со сроками SLA: %w", err)
+	}
+	slas := make(map[uint]*models.SLA, len(definitions))
+	for i := range definitions {
+		slas[definitions[i].ID] = definitions[i].SLA
+	}
+
+	now := s.now().UTC()
+	list := &SLABreachList{Breaches: make([]SLABreachInfo, 0, len(reports)), ComputedAt: now}
+	for i := range reports {
+		report := &reports[i]
+		info := SLABreachInfo{
+			ReportID:       report.ID,
+			Title:          report.Title,
+			Definition:     report.Type,
+			Status:         report.Status,
+			Breach:         report.SLABreach,
+			ElapsedSeconds: roundStat(slaElapsed(report, report.SLABreach, now).Seconds()),
+			CreatedBy:      report.CreatedBy,
+			CreatedAt:      report.CreatedAt,
+			StartedAt:      report.StartedAt,
+		}
+		if report.SLABreachedAt != nil {
+			info.BreachedAt = *report.SLABreachedAt
+		}
+		if report.DefinitionID != nil {
+			info.LimitSeconds = slas[*report.DefinitionID].Limit(report.SLABreach).Seconds()
+		}
+		list.Breaches = append(list.Breaches, info)
+	}
+	list.Total = len(list.Breaches)
+	return list, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSLAAlerter struct {
+	mu     sync.Mutex
+	alerts []SLABreachAlert
+}
+
+func (a *fakeSLAAlerter) AlertSLABreach(ctx context.Context, alert SLABreachAlert) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.alerts = append(a.alerts, alert)
+	return nil
+}
+
+func TestSLAValidate(t *testing.T) {
+	assert.Empty(t, (*models.SLA)(nil).Validate())
+	assert.Empty(t, (&models.SLA{MaxDuration: "30m", AlertEmails: []string{"ops@example.com"}}).Validate())
+	assert.Len(t, (&models.SLA{MaxQueueWait: "soon"}).Validate(), 1)
+	assert.Len(t, (&models.SLA{MaxDuration: "-1m"}).Validate(), 1)
+	assert.Len(t, (&models.SLA{AlertEmails: []string{"ops@example.com"}}).Validate(), 1)
+	assert.Len(t, (&models.SLA{MaxDuration: "1m", AlertEmails: []string{"ops"}}).Validate(), 1)
+
+	sla := &models.SLA{MaxDuration: "30m"}
+	assert.Equal(t, 30*time.Minute, sla.Limit(models.SLABreachDuration))
+	assert.Zero(t, sla.Limit(models.SLABreachQueueWait))
+}
+
+func TestSLAMonitorMarksBreachesOnce(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	definition := &models.ReportDefinition{
+		Name:      "warehouse",
+		Queries:   models.Queries{{Name: "main", SQL: "SELECT 1 AS n"}},
+		Format:    models.FormatXLSX,
+		SLA:       &models.SLA{MaxQueueWait: "10m", MaxDuration: "30m"},
+		CreatedBy: "test-user",
+		UpdatedBy: "test-user",
+	}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	newReport := func(title string, status models.ReportStatus, created time.Time, started *time.Time) *models.Report {
+		report := &models.Report{
+			Title:        title,
+			Type:         definition.Name,
+			DefinitionID: &definition.ID,
+			Status:       status,
+			StartedAt:    started,
+			CreatedBy:    "test-user",
+			UpdatedBy:    "test-user",
+		}
+		require.NoError(t, db.Create(report).Error)
+		require.NoError(t, db.Model(report).UpdateColumn("created_at", created).Error)
+		return report
+	}
+	waiting := newReport("Waiting", models.StatusPending, now.Add(-15*time.Minute), nil)
+	fresh := newReport("Fresh", models.StatusPending, now.Add(-time.Minute), nil)
+	longStarted := now.Add(-45 * time.Minute)
+	slow := newReport("Slow", models.StatusProcessing, now.Add(-time.Hour), &longStarted)
+	shortStarted := now.Add(-5 * time.Minute)
+	newReport("Running", models.StatusProcessing, now.Add(-time.Hour), &shortStarted)
+
+	bus := events.NewInProcessBus(logger)
+	var (
+		mu       sync.Mutex
+		breached []events.Event
+	)
+	bus.Subscribe(func(_ context.Context, event events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		breached = append(breached, event)
+	}, events.ReportSLABreached)
+
+	alerter := &fakeSLAAlerter{}
+	reports := NewGormReportRepository(db, logger)
+	monitor := NewSLAMonitor(config.SLA{}, definitions, reports, bus, []SLAAlerter{alerter}, logger)
+
+	assert.Equal(t, 2, monitor.Check(ctx, now))
+	require.Len(t, alerter.alerts, 2)
+	assert.Equal(t, waiting.ID, alerter.alerts[0].Report.ID)
+	assert.Equal(t, models.SLABreachQueueWait, alerter.alerts[0].Breach)
+	assert.Equal(t, 10*time.Minute, alerter.alerts[0].Limit)
+	assert.Equal(t, slow.ID, alerter.alerts[1].Report.ID)
+	assert.Equal(t, models.SLABreachDuration, alerter.alerts[1].Breach)
+	assert.InDelta(t, (45 * time.Minute).Seconds(), alerter.alerts[1].Elapsed.Seconds(), 1)
+
+	mu.Lock()
+	require.Len(t, breached, 2)
+	assert.Equal(t, models.SLABreachQueueWait, breached[0].SLABreach)
+	mu.Unlock()
+
+	// Повторная проверка не оповещает о тех же нарушениях
+	assert.Zero(t, monitor.Check(ctx, now.Add(time.Minute)))
+	assert.Len(t, alerter.alerts, 2)
+
+	// Отчет, дождавшийся очереди и зависший в генерации, нарушает и срок генерации
+	started := now.Add(-40 * time.Minute)
+	require.NoError(t, db.Model(waiting).Updates(map[string]interface{}{
+		"status":     models.StatusProcessing,
+		"started_at": started,
+	}).Error)
+	assert.Equal(t, 1, monitor.Check(ctx, now.Add(time.Minute)))
+	assert.Equal(t, models.SLABreachDuration, alerter.alerts[2].Breach)
+
+	stored, err := reports.GetByID(ctx, fresh.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored.SLABreachedAt)
+
+	sla := NewSLAService(definitions, reports)
+	sla.now = func() time.Time { return now.Add(time.Minute) }
+	list, err := sla.ListBreaches(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, list.Total)
+	assert.Equal(t, slow.ID, list.Breaches[0].ReportID)
+	assert.Equal(t, definition.Name, list.Breaches[0].Definition)
+	assert.Equal(t, (30 * time.Minute).Seconds(), list.Breaches[0].LimitSeconds)
+	assert.Equal(t, waiting.ID, list.Breaches[1].ReportID)
+	assert.Equal(t, models.SLABreachDuration, list.Breaches[1].Breach)
+
+	// Завершенный отчет больше не считается текущим нарушением
+	require.NoError(t, db.Model(slow).Update("status", models.StatusCompleted).Error)
+	list, err = sla.ListBreaches(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, list.Total)
+}
+
+func TestSlackSLAAlerter(t *testing.T) {
+	var payload map[string]string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer api.Close()
+
+	alert := SLABreachAlert{
+		Report:     &models.Report{ID: 7, Title: "Sales"},
+		Definition: &models.ReportDefinition{Name: "warehouse"},
+		Breach:     models.SLABreachQueueWait,
+		Limit:      10 * time.Minute,
+		Elapsed:    12 * time.Minute,
+	}
+	require.NoError(t, NewSlackSLAAlerter(api.URL).AlertSLABreach(context.Background(), alert))
+	assert.Contains(t, payload["text"], "«Sales» (#7, определение warehouse) ожидает в очереди 12m0s при сроке 10m0s")
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer failing.Close()
+	assert.Error(t, NewSlackSLAAlerter(failing.URL).AlertSLABreach(context.Background(), alert))
+}
+
+func TestEmailSLAAlerter(t *testing.T) {
+	sender := &fakeMailSender{}
+	alerter := NewEmailSLAAlerter(config.SMTP{From: "reports@example.com"}, sender, []string{"ops@example.com"})
+
+	alert := SLABreachAlert{
+		Report: &models.Report{ID: 7, Title: "Sales"},
+		Definition: &models.ReportDefinition{
+			Name: "warehouse",
+			SLA:  &models.SLA{MaxDuration: "30m", AlertEmails: []string{"owner@example.com"}},
+		},
+		Breach:  models.SLABreachDuration,
+		Limit:   30 * time.Minute,
+		Elapsed: 31 * time.Minute,
+	}
+	require.NoError(t, alerter.AlertSLABreach(context.Background(), alert))
+	assert.Equal(t, []string{"ops@example.com", "owner@example.com"}, sender.to)
+	assert.Contains(t, sender.message.String(), "warehouse")
+}
@@ -0,0 +1,436 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+)
+
+const (
+	// snapshotExtension расширение ключа снимка данных отчета
+	snapshotExtension = "snapshot.ndjson.gz"
+	// snapshotVersion версия формата снимка
+	snapshotVersion = 1
+)
+
+// ErrSnapshotNotFound у отчета нет снимка данных
+var ErrSnapshotNotFound = newCategoryError(ErrNotFound, "снимок данных отчета не найден")
+
+// SnapshotPolicy определяет сохранение снимка данных отчета рядом с файлом
+type SnapshotPolicy struct {
+	// Default сохранять снимок, если параметр отчета snapshot не задан
+	Default bool
+}
+
+// NewSnapshotPolicy создает политику снимков из конфигурации хранилища
+func NewSnapshotPolicy(cfg config.Storage) SnapshotPolicy {
+	return SnapshotPolicy{Default: cfg.Snapshots}
+}
+
+// For проверяет, сохраняется ли снимок данных отчета. Параметр отчета имеет приоритет над общим.
+// Снимок не шифруется, поэтому для отчетов с паролем не сохраняется
+func (p SnapshotPolicy) For(report *models.Report) bool {
+	if report.PasswordProtected {
+		return false
+	}
+	if enabled, ok, err := report.Snapshot(); err == nil && ok {
+		return enabled
+	}
+	return p.Default
+}
+
+// Снимок - NDJSON, сжатый gzip. Первая строка - состав наборов snapshotManifest,
+// за ней строки наборов по порядку, каждая строка - JSON массив значений колонок.
+// Число строк набора записано в составе, поэтому наборы читаются одним потоком.
+
+// snapshotManifest состав наборов снимка
+type snapshotManifest struct {
+	Version int `json:"version"`
+	// Locale и Headers локаль отчета и переводы заголовков колонок
+	Locale   string            `json:"locale,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Datasets []snapshotDataset `json:"datasets"`
+}
+
+// snapshotDataset набор снимка
+type snapshotDataset struct {
+	Name    string   `json:"name"`
+	Sheet   string   `json:"sheet,omitempty"`
+	Columns []string `json:"columns"`
+	// Times колонки со значениями времени: в снимке они хранятся строками RFC 3339
+	Times []string `json:"times,omitempty"`
+	Rows  int64    `json:"rows"`
+}
+
+// snapshotRecorder записывает строки наборов, прочитанные генератором, во временные файлы
+type snapshotRecorder struct {
+	locale   string
+	headers  map[string]string
+	datasets []*snapshotRows
+}
+
+// recordSnapshot подключает запись снимка к наборам данных отчета
+func recordSnapshot(data *ReportData) (*snapshotRecorder, error) {
+	recorder := &snapshotRecorder{locale: data.Locale, headers: data.Headers}
+	for i := range data.Datasets {
+		file, err := os.CreateTemp("", "report-snapshot-*.ndjson")
+		if err != nil {
+			recorder.Close()
+			return nil, fmt.Errorf("ошибка создания временного файла снимка: %w", err)
+		}
+		rows := &snapshotRows{
+			rows:    data.Datasets[i].Rows,
+			dataset: snapshotDataset{Name: data.Datasets[i].Name, Sheet: data.Datasets[i].Sheet},
+			file:    file,
+			writer:  bufio.NewWriter(file),
+			times:   make(map[int]bool),
+		}
+		data.Datasets[i].Rows = rows
+		recorder.datasets = append(recorder.datasets, rows)
+	}
+	return recorder, nil
+}
+
+// Reader дочитывает строки, которые генератор не прочитал, например из-за ограничения
+// числа строк листа, и возвращает снимок, сжатый gzip
+func (r *snapshotRecorder) Reader() (io.ReadCloser, error) {
+	manifest := snapshotManifest{Version: snapshotVersion, Locale: r.locale, Headers: r.headers, Datasets: []snapshotDataset{}}
+	for _, rows := range r.datasets {
+		if err := rows.finish(); err != nil {
+			return nil, err
+		}
+		manifest.Datasets = append(manifest.Datasets, rows.dataset)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		writer := gzip.NewWriter(pw)
+		err := r.write(writer, manifest)
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// write записывает состав наборов и строки наборов из временных файлов
+func (r *snapshotRecorder) write(w io.Writer, manifest snapshotManifest) error {
+	if err := json.NewEncoder(w).Encode(manifest); err != nil {
+		return fmt.Errorf("ошибка записи состава снимка: %w", err)
+	}
+	for _, rows := range r.datasets {
+		if _, err := rows.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("ошибка чтения снимка набора %s: %w", rows.dataset.Name, err)
+		}
+		if _, err := io.Copy(w, rows.file); err != nil {
+			return fmt.Errorf("ошибка записи снимка набора %s: %w", rows.dataset.Name, err)
+		}
+	}
+	return nil
+}
+
+// Close удаляет временные файлы снимка
+func (r *snapshotRecorder) Close() {
+	for _, rows := range r.datasets {
+		rows.file.Close()
+		os.Remove(rows.file.Name())
+	}
+}
+
+// snapshotRows итератор набора, записывающий прочитанные строки в снимок
+type snapshotRows struct {
+	rows    RowIterator
+	dataset snapshotDataset
+	file    *os.File
+	writer  *bufio.Writer
+	times   map[int]bool
+	done    bool
+	err     error
+}
+
+// Columns возвращает колонки набора
+func (r *snapshotRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+// Next возвращает следующую строку набора и записывает ее в снимок
+func (r *snapshotRows) Next() ([]interface{}, error) {
+	row, err := r.rows.Next()
+	switch {
+	case err == nil:
+		r.record(row)
+	case err == io.EOF:
+		r.done = true
+	}
+	return row, err
+}
+
+// record записывает строку в снимок. Ошибка записи не прерывает генерацию
+// и возвращается при получении снимка
+func (r *snapshotRows) record(row []interface{}) {
+	if r.err != nil {
+		return
+	}
+	values := make([]interface{}, len(row))
+	for i, value := range row {
+		if _, ok := value.(time.Time); ok {
+			r.times[i] = true
+		}
+		values[i] = jsonValue(value)
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		r.err = fmt.Errorf("ошибка кодирования строки набора %s: %w", r.dataset.Name, err)
+		return
+	}
+	r.writer.Write(encoded)
+	if err := r.writer.WriteByte('\n'); err != nil {
+		r.err = fmt.Errorf("ошибка записи снимка набора %s: %w", r.dataset.Name, err)
+		return
+	}
+	r.dataset.Rows++
+}
+
+// finish дочитывает набор и завершает его запись
+func (r *snapshotRows) finish() error {
+	for !r.done && r.err == nil {
+		if _, err := r.Next(); err != nil && err != io.EOF {
+			return fmt.Errorf("ошибка чтения набора %s: %w", r.dataset.Name, err)
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.writer.Flush(); err != nil {
+		return fmt.Errorf("ошибка записи снимка набора %s: %w", r.dataset.Name, err)
+	}
+
+	r.dataset.Columns = r.rows.Columns()
+	for i, column := range r.dataset.Columns {
+		if r.times[i] {
+			r.dataset.Times = append(r.dataset.Times, column)
+		}
+	}
+	return nil
+}
+
+// Close закрывает исходный набор
+func (r *snapshotRows) Close() error {
+	if closer, ok := r.rows.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// saveSnapshot сохраняет снимок данных отчета и возвращает его ключ
+func (e *ReportTaskExecutor) saveSnapshot(ctx context.Context, report *models.Report, recorder *snapshotRecorder) (string, error) {
+	reader, err := recorder.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	key := e.fileStorage.GenerateKey(report, snapshotExtension)
+	if err := e.fileStorage.Save(ctx, key, reader); err != nil {
+		return "", fmt.Errorf("ошибка сохранения снимка: %w", err)
+	}
+	return key, nil
+}
+
+// reuseSnapshot копирует снимок данных исходного отчета. Без снимка отчет остается пригодным,
+// поэтому ошибка копирования только записывается в лог
+func (e *ReportTaskExecutor) reuseSnapshot(ctx context.Context, report, source *models.Report, logger logging.Logger) string {
+	if source.SnapshotKey == "" {
+		return ""
+	}
+	key := e.fileStorage.GenerateKey(report, snapshotExtension)
+	if err := e.fileStorage.Copy(ctx, source.SnapshotKey, key); err != nil {
+		logger.WithError(err).Warn("Не удалось скопировать снимок данных готового отчета")
+		return ""
+	}
+	return key
+}
+
+// GetReportSnapshot возвращает данные готового отчета из его снимка. Наборы читаются
+// по порядку, данные должны быть закрыты вызывающей стороной.
+func (s *ReportServiceImpl) GetReportSnapshot(ctx context.Context, id uint) (*ReportData, error) {
+	report, _, err := s.completedReport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if report.SnapshotKey == "" {
+		return nil, fmt.Errorf("%w: %d", ErrSnapshotNotFound, id)
+	}
+
+	reader, err := s.fileStorage.Get(ctx, report.SnapshotKey)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithError(err).WithFields(logging.Fields{
+			"report_id":    id,
+			"snapshot_key": report.SnapshotKey,
+		}).Error("Ошибка получения снимка данных из хранилища")
+		return nil, fmt.Errorf("ошибка получения снимка данных: %w", err)
+	}
+	data, err := readSnapshot(reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return data, nil
+}
+
+// readSnapshot читает состав снимка и возвращает его наборы. Закрытие данных закрывает reader
+func readSnapshot(reader io.ReadCloser) (*ReportData, error) {
+	unpacked, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения снимка данных: %w", err)
+	}
+	decoder := json.NewDecoder(unpacked)
+	decoder.UseNumber()
+
+	var manifest snapshotManifest
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("ошибка чтения состава снимка данных: %w", err)
+	}
+	if manifest.Version != snapshotVersion {
+		return nil, fmt.Errorf("неподдерживаемая версия снимка данных: %d", manifest.Version)
+	}
+
+	source := &snapshotSource{reader: reader, gzip: unpacked, decoder: decoder, manifest: manifest}
+	if len(manifest.Datasets) > 0 {
+		source.remaining = manifest.Datasets[0].Rows
+	}
+	data := &ReportData{Locale: manifest.Locale, Headers: manifest.Headers}
+	for i, dataset := range manifest.Datasets {
+		times := make(map[int]bool)
+		for _, column := range dataset.Times {
+			for j, name := range dataset.Columns {
+				if name == column {
+					times[j] = true
+				}
+			}
+		}
+		data.Datasets = append(data.Datasets, Dataset{
+			Name:  dataset.Name,
+			Sheet: dataset.Sheet,
+			Rows:  &snapshotDatasetRows{source: source, index: i, times: times},
+		})
+	}
+	if len(data.Datasets) == 0 {
+		source.close()
+	}
+	return data, nil
+}
+
+// snapshotSource поток строк снимка, общий для его наборов
+type snapshotSource struct {
+	reader   io.ReadCloser
+	gzip     *gzip.Reader
+	decoder  *json.Decoder
+	manifest snapshotManifest
+
+	// current набор, строки которого читаются, remaining - сколько строк в нем осталось
+	current   int
+	remaining int64
+	closed    bool
+}
+
+// next возвращает следующую строку набора index. Непрочитанные строки предыдущих наборов пропускаются
+func (s *snapshotSource) next(index int) ([]interface{}, error) {
+	if s.closed {
+		return nil, io.EOF
+	}
+	if index < s.current {
+		return nil, fmt.Errorf("набор %s снимка уже прочитан: наборы снимка читаются по порядку", s.manifest.Datasets[index].Name)
+	}
+	for s.current < index {
+		for ; s.remaining > 0; s.remaining-- {
+			var skipped json.RawMessage
+			if err := s.decoder.Decode(&skipped); err != nil {
+				return nil, s.decodeError(err)
+			}
+		}
+		s.current++
+		s.remaining = s.manifest.Datasets[s.current].Rows
+	}
+	if s.remaining == 0 {
+		return nil, io.EOF
+	}
+
+	var row []interface{}
+	if err := s.decoder.Decode(&row); err != nil {
+		return nil, s.decodeError(err)
+	}
+	s.remaining--
+	return row, nil
+}
+
+// decodeError описывает ошибку чтения строки набора
+func (s *snapshotSource) decodeError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("ошибка чтения снимка набора %s: %w", s.manifest.Datasets[s.current].Name, err)
+}
+
+// close закрывает поток снимка
+func (s *snapshotSource) close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return errors.Join(s.gzip.Close(), s.reader.Close())
+}
+
+// snapshotDatasetRows итератор набора снимка
+type snapshotDatasetRows struct {
+	source *snapshotSource
+	index  int
+	times  map[int]bool
+}
+
+// Columns возвращает колонки набора
+func (r *snapshotDatasetRows) Columns() []string {
+	return r.source.manifest.Datasets[r.index].Columns
+}
+
+// Next возвращает следующую строку набора. Числа отдаются как int64 или float64,
+// значения колонок времени - как time.Time
+func (r *snapshotDatasetRows) Next() ([]interface{}, error) {
+	row, err := r.source.next(r.index)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range row {
+		switch v := value.(type) {
+		case json.Number:
+			if integer, err := v.Int64(); err == nil {
+				row[i] = integer
+			} else if float, err := v.Float64(); err == nil {
+				row[i] = float
+			}
+		case string:
+			if r.times[i] {
+				if parsed, err := time.Parse(time.RFC3339Nano, v); err == nil {
+					row[i] = parsed
+				}
+			}
+		}
+	}
+	return row, nil
+}
+
+// Close закрывает поток снимка
+func (r *snapshotDatasetRows) Close() error {
+	return r.source.close()
+}
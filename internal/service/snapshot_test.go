@@ -0,0 +1,77 @@
+package service
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotPolicy(t *testing.T) {
+	report := &models.Report{}
+	assert.False(t, SnapshotPolicy{}.For(report))
+	assert.True(t, SnapshotPolicy{Default: true}.For(report))
+
+	report.Parameters = models.JSON{models.ParamSnapshot: false}
+	assert.False(t, SnapshotPolicy{Default: true}.For(report))
+	report.Parameters = models.JSON{models.ParamSnapshot: true}
+	assert.True(t, SnapshotPolicy{}.For(report))
+
+	report.Parameters = models.JSON{models.ParamSnapshot: "yes"}
+	_, _, err := report.Snapshot()
+	assert.Error(t, err)
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	day := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	data := &ReportData{Locale: "ru", Headers: map[string]string{"amount": "Сумма"}, Datasets: []Dataset{
+		{Name: "sales", Sheet: "Sales", Rows: &sliceRows{
+			columns: []string{"region", "amount", "share", "day"},
+			rows: [][]interface{}{
+				{"north", int64(100), 0.25, day},
+				{"south", int64(300), 0.75, nil},
+				{"west", int64(5), 0.5, day},
+			},
+		}},
+		{Name: "totals", Rows: &sliceRows{
+			columns: []string{"total"},
+			rows:    [][]interface{}{{[]byte("405.00")}},
+		}},
+	}}
+
+	recorder, err := recordSnapshot(data)
+	require.NoError(t, err)
+	defer recorder.Close()
+
+	// Генератор прочитал только первую строку: остальные дочитываются при получении снимка
+	_, err = data.Datasets[0].Rows.Next()
+	require.NoError(t, err)
+
+	reader, err := recorder.Reader()
+	require.NoError(t, err)
+	snapshot, err := readSnapshot(reader)
+	require.NoError(t, err)
+	defer snapshot.Close()
+
+	assert.Equal(t, "Сумма", snapshot.Header("amount"))
+	assert.Equal(t, "ru", snapshot.Locale)
+	require.Len(t, snapshot.Datasets, 2)
+	assert.Equal(t, "sales", snapshot.Datasets[0].Name)
+	assert.Equal(t, "Sales", snapshot.Datasets[0].Sheet)
+	assert.Equal(t, []string{"region", "amount", "share", "day"}, snapshot.Datasets[0].Rows.Columns())
+
+	first, err := snapshot.Datasets[0].Rows.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"north", int64(100), 0.25, day}, first)
+
+	// Переход к следующему набору пропускает непрочитанные строки предыдущего
+	assert.Equal(t, [][]interface{}{{"405.00"}}, readAllRows(t, snapshot.Datasets[1].Rows))
+	_, err = snapshot.Datasets[0].Rows.Next()
+	assert.Error(t, err)
+	_, err = snapshot.Datasets[1].Rows.Next()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultStatsTopCreators число пользователей в рейтинге по умолчанию
+	DefaultStatsTopCreators = 10
+	// MaxStatsTopCreators максимальное число пользователей в рейтинге
+	MaxStatsTopCreators = 100
+
+	// statsDurationWindow за какой период считается длительность генерации
+	statsDurationWindow = 7 * 24 * time.Hour
+)
+
+// StatsWindows окна, за которые считается доля ошибок генерации
+var StatsWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{Name: "1h", Duration: time.Hour},
+	{Name: "24h", Duration: 24 * time.Hour},
+	{Name: "7d", Duration: 7 * 24 * time.Hour},
+}
+
+// ReportStats статистика отчетов для мониторинга. Удаленные отчеты не учитываются.
+type ReportStats struct {
+	Total       int64                         `json:"total"`
+	ByStatus    map[models.ReportStatus]int64 `json:"by_status"`
+	Duration    DurationStats                 `json:"duration"`
+	Failures    []FailureStats                `json:"failures"`
+	TopCreators []CreatorStats                `json:"top_creators"`
+	Storage     StorageStats                  `json:"storage"`
+	ComputedAt  time.Time                     `json:"computed_at"`
+}
+
+// DurationStats длительность от создания до готовности отчетов, завершенных
+// за последние 7 дней, в секундах. Включает ожидание в очереди.
+type DurationStats struct {
+	Count int64   `json:"count"`
+	Avg   float64 `json:"avg_seconds"`
+	P50   float64 `json:"p50_seconds"`
+	P95   float64 `json:"p95_seconds"`
+	P99   float64 `json:"p99_seconds"`
+}
+
+// FailureStats доля ошибок среди отчетов, завершенных или упавших за окно
+type FailureStats struct {
+	Window   string  `json:"window"`
+	Finished int64   `json:"finished"`
+	Failed   int64   `json:"failed"`
+	Rate     float64 `json:"rate"`
+}
+
+// CreatorStats число отчетов пользователя и размер его файлов
+type CreatorStats struct {
+	CreatedBy   string `json:"created_by"`
+	Reports     int64  `json:"reports"`
+	StoredBytes int64  `json:"stored_bytes"`
+}
+
+// StorageStats число и суммарный размер хранимых файлов отчетов
+type StorageStats struct {
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// PeriodSummary итоги отчетов за период
+type PeriodSummary struct {
+	Created   int64
+	Completed int64
+	Failed    int64
+	// StoredBytes размер файлов отчетов, готовых за период
+	StoredBytes int64
+}
+
+// ErrorCodeStats число отчетов, упавших по одной причине
+type ErrorCodeStats struct {
+	ErrorCode models.ReportErrorCode
+	Reports   int64
+}
+
+// DefinitionDuration длительность генерации отчета по определению
+type DefinitionDuration struct {
+	Definition string
+	Duration   time.Duration
+}
+
+// StatsService интерфейс статистики отчетов
+type StatsService interface {
+	// GetStats считает статистику, top - число пользователей в рейтинге
+	GetStats(ctx context.Context, top int) (*ReportStats, error)
+}
+
+// StatsRepository интерфейс запросов статистики к базе данных
+type StatsRepository interface {
+	CountByStatus(ctx context.Context) (map[models.ReportStatus]int64, error)
+	// Durations возвращает длительности генерации отчетов, готовых с since
+	Durations(ctx context.Context, since time.Time) ([]time.Duration, error)
+	// Failures считает готовые и упавшие с since отчеты
+	Failures(ctx context.Context, since time.Time) (finished, failed int64, err error)
+	TopCreators(ctx context.Context, limit int) ([]CreatorStats, error)
+	Storage(ctx context.Context) (StorageStats, error)
+	// Summary считает созданные, готовые и упавшие в [from, to) отчеты
+	Summary(ctx context.Context, from, to time.Time) (PeriodSummary, error)
+	// FailuresByCode считает упавшие в [from, to) отчеты по причине ошибки
+	FailuresByCode(ctx context.Context, from, to time.Time) ([]ErrorCodeStats, error)
+	// DefinitionDurations возвращает длительности генерации отчетов по определениям, готовых в [from, to)
+	DefinitionDurations(ctx context.Context, from, to time.Time) ([]DefinitionDuration, error)
+	// RecentFailures возвращает упавшие отчеты от упавших последними
+	RecentFailures(ctx context.Context, filter FailureFilter) ([]FailedReport, error)
+	// UserActivity возвращает активность пользователей с since, от создавших больше отчетов.
+	// Пустой user - все пользователи с отчетами за период или в очереди и в генерации
+	UserActivity(ctx context.Context, since time.Time, user string, limit int) ([]UserActivity, error)
+}
+
+// GormStatsRepository реализация StatsRepository с использованием GORM
+type GormStatsRepository struct {
+	db     *gorm.DB
+	logger logging.Logger
+}
+
+// NewGormStatsRepository создает новый репозиторий статистики
+func NewGormStatsRepository(db *gorm.DB, logger logging.Logger) StatsRepository {
+	return &GormStatsRepository{db: db, logger: logger}
+}
+
+// reports возвращает запрос к неудаленным отчетам
+func (r *GormStatsRepository) reports(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Model(&models.Report{})
+}
+
+// CountByStatus считает отчеты по статусам
+func (r *GormStatsRepository) CountByStatus(ctx context.Context) (map[models.ReportStatus]int64, error) {
+	var rows []struct {
+		Status models.ReportStatus
+		Count  int64
+	}
+	if err := r.reports(ctx).Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[models.ReportStatus]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// Durations возвращает длительности генерации. Перцентили считаются в сервисе,
+// потому что в SQLite нет percentile_cont.
+func (r *GormStatsRepository) Durations(ctx context.Context, since time.Time) ([]time.Duration, error) {
+	var rows []struct {
+		CreatedAt   time.Time
+		GeneratedAt time.Time
+	}
+	if err := r.reports(ctx).Select("created_at, generated_at").
+		Where("status = ? AND generated_at >= ?", models.StatusCompleted, since).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	durations := make([]time.Duration, 0, len(rows))
+	for _, row := range rows {
+		if d := row.GeneratedAt.Sub(row.CreatedAt); d >= 0 {
+			durations = append(durations, d)
+		}
+	}
+	return durations, nil
+}
+
+// Failures считает готовые и упавшие отчеты, измененные с since
+func (r *GormStatsRepository) Failures(ctx context.Context, since time.Time) (int64, int64, error) {
+	var row struct {
+		Finished int64
+		Failed   int64
+	}
+	err := r.reports(ctx).
+		Select("COUNT(*) AS finished, COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0) AS failed", models.StatusFailed).
+		Where("status IN ? AND updated_at >= ?", []models.ReportStatus{models.StatusCompleted, models.StatusFailed}, since).
+		Scan(&row).Error
+	return row.Finished, row.Failed, err
+}
+
+// TopCreators возвращает пользователей с наибольшим числом отчетов
+func (r *GormStatsRepository) TopCreators(ctx context.Context, limit int) ([]CreatorStats, error) {
+	var creators []CreatorStats
+	err := r.reports(ctx).
+		Select("created_by, COUNT(*) AS reports, COALESCE(SUM(file_size), 0) AS stored_bytes").
+		Group("created_by").Order("reports DESC, created_by").Limit(limit).
+		Scan(&creators).Error
+	return creators, err
+}
+
+// Storage считает хранимые файлы отчетов
+func (r *GormStatsRepository) Storage(ctx context.Context) (StorageStats, error) {
+	var stats StorageStats
+	err := r.reports(ctx).Select("COUNT(*) AS files, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("file_key <> ''").Scan(&stats).Error
+	return stats, err
+}
+
+// Summary считает итоги отчетов за период
+func (r *GormStatsRepository) Summary(ctx context.Context, from, to time.Time) (PeriodSummary, error) {
+	var summary PeriodSummary
+	if err := r.reports(ctx).Where("created_at >= ? AND created_at < ?", from, to).
+		Count(&summary.Created).Error; err != nil {
+		return summary, err
+	}
+
+	var completed struct {
+		Reports int64
+		Bytes   int64
+	}
+	if err := r.reports(ctx).Select("COUNT(*) AS reports, COALESCE(SUM(file_size), 0) AS bytes").
+		Where("status = ? AND generated_at >= ? AND generated_at < ?", models.StatusCompleted, from, to).
+		Scan(&completed).Error; err != nil {
+		return summary, err
+	}
+	summary.Completed, summary.StoredBytes = completed.Reports, completed.Bytes
+
+	err := r.reports(ctx).Where("status = ? AND updated_at >= ? AND updated_at < ?", models.StatusFailed, from, to).
+		Count(&summary.Failed).Error
+	return summary, err
+}
+
+// FailuresByCode считает упавшие отчеты по причине ошибки, начиная с самой частой
+func (r *GormStatsRepository) FailuresByCode(ctx context.Context, from, to time.Time) ([]ErrorCodeStats, error) {
+	var failures []ErrorCodeStats
+	err := r.reports(ctx).Select("error_code, COUNT(*) AS reports").
+		Where("status = ? AND updated_at >= ? AND updated_at < ?", models.StatusFailed, from, to).
+		Group("error_code").Order("reports DESC, error_code").
+		Scan(&failures).Error
+	return failures, err
+}
+
+// DefinitionDurations возвращает длительности генерации отчетов по определениям
+func (r *GormStatsRepository) DefinitionDurations(ctx context.Context, from, to time.Time) ([]DefinitionDuration, error) {
+	var rows []struct {
+		Name        string
+		CreatedAt   time.Time
+		GeneratedAt time.Time
+	}
+	if err := r.reports(ctx).
+		Select("report_definitions.name, reports.created_at, reports.generated_at").
+		Joins("JOIN report_definitions ON report_definitions.id = reports.definition_id").
+		Where("reports.status = ? AND reports.generated_at >= ? AND reports.generated_at < ?", models.StatusCompleted, from, to).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	durations := make([]DefinitionDuration, 0, len(rows))
+	for _, row := range rows {
+		if d := row.GeneratedAt.Sub(row.CreatedAt); d >= 0 {
+			durations = append(durations, DefinitionDuration{Definition: row.Name, Duration: d})
+		}
+	}
+	return durations, nil
+}
+
+// RecentFailures возвращает упавшие отчеты от упавших последними
+func (r *GormStatsRepository) RecentFailures(ctx context.Context, filter FailureFilter) ([]FailedReport, error) {
+	query := r.reports(ctx).
+		Select("id, title, type, created_by, error_code, error_message, updated_at").
+		Where("status = ?", models.StatusFailed)
+	if filter.Since != nil {
+		query = query.Where("updated_at >= ?", *filter.Since)
+	}
+	if filter.CreatedBy != "" {
+		query = query.Where("created_by = ?", filter.CreatedBy)
+	}
+
+	var failures []FailedReport
+	err := query.Order("updated_at DESC, id DESC").Limit(filter.Limit).Scan(&failures).Error
+	return failures, err
+}
+
+// UserActivity считает отчеты пользователей за период одним запросом с группировкой
+func (r *GormStatsRepository) UserActivity(ctx context.Context, since time.Time, user string, limit int) ([]UserActivity, error) {
+	active := []models.ReportStatus{models.StatusPending, models.StatusProcessing}
+	created := gorm.Expr("SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END)", since)
+	running := gorm.Expr("SUM(CASE WHEN status IN ? THEN 1 ELSE 0 END)", active)
+
+	query := r.reports(ctx).
+		Select("created_by, ? AS created, "+
+			"SUM(CASE WHEN status = ? AND generated_at >= ? THEN 1 ELSE 0 END) AS completed, "+
+			"SUM(CASE WHEN status = ? AND updated_at >= ? THEN 1 ELSE 0 END) AS failed, "+
+			"? AS active, COALESCE(SUM(file_size), 0) AS stored_bytes",
+			created, models.StatusCompleted, since, models.StatusFailed, since, running).
+		Group("created_by")
+	if user != "" {
+		query = query.Where("created_by = ?", user)
+	} else {
+		query = query.Having("? > 0 OR ? > 0", created, running)
+	}
+
+	var activity []UserActivity
+	err := query.Order("created DESC, created_by").Limit(limit).Scan(&activity).Error
+	return activity, err
+}
+
+// StatsServiceImpl реализация сервиса статистики
+type StatsServiceImpl struct {
+	repository StatsRepository
+	logger     logging.Logger
+	now        func() time.Time
+}
+
+// NewStatsService создает новый сервис статистики
+func NewStatsService(repository StatsRepository, logger logging.Logger) *StatsServiceImpl {
+	return &StatsServiceImpl{repository: repository, logger: logger, now: time.Now}
+}
+
+// NewStatsServiceFromDB создает сервис статистики по базе данных отчетов
+func NewStatsServiceFromDB(db *gorm.DB, logger logging.Logger) StatsService {
+	return NewStatsService(NewGormStatsRepository(db, logger), logger)
+}
+
+// GetStats считает статистику отчетов
+func (s *StatsServiceImpl) GetStats(ctx context.Context, top int) (*ReportStats, error) {
+	if top <= 0 {
+		top = DefaultStatsTopCreators
+	}
+	top = min(top, MaxStatsTopCreators)
+	now := s.now().UTC()
+
+	byStatus, err := s.repository.CountByStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета отчетов по статусам: %w", err)
+	}
+	stats := &ReportStats{ByStatus: byStatus, ComputedAt: now}
+	for _, count := range byStatus {
+		stats.Total += count
+	}
+
+	durations, err := s.repository.Durations(ctx, now.Add(-statsDurationWindow))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения длительности генерации: %w", err)
+	}
+	stats.Duration = newDurationStats(durations)
+
+	for _, window := range StatsWindows {
+		finished, failed, err := s.repository.Failures(ctx, now.Add(-window.Duration))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка подсчета ошибок генерации: %w", err)
+		}
+		failures := FailureStats{Window: window.Name, Finished: finished, Failed: failed}
+		if finished > 0 {
+			failures.Rate = roundStat(float64(failed) / float64(finished))
+		}
+		stats.Failures = append(stats.Failures, failures)
+	}
+
+	if stats.TopCreators, err = s.repository.TopCreators(ctx, top); err != nil {
+		return nil, fmt.Errorf("ошибка получения рейтинга пользователей: %w", err)
+	}
+	if stats.Storage, err = s.repository.Storage(ctx); err != nil {
+		return nil, fmt.Errorf("ошибка подсчета хранимых файлов: %w", err)
+	}
+
+	return stats, nil
+}
+
+// newDurationStats считает среднее и перцентили длительностей методом ближайшего ранга
+func newDurationStats(durations []time.Duration) DurationStats {
+	if len(durations) == 0 {
+		return DurationStats{}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+	}
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p*float64(len(durations)))) - 1
+		return roundStat(durations[max(rank, 0)].Seconds())
+	}
+
+	return DurationStats{
+		Count: int64(len(durations)),
+		Avg:   roundStat(sum.Seconds() / float64(len(durations))),
+		P50:   percentile(0.50),
+		P95:   percentile(0.95),
+		P99:   percentile(0.99),
+	}
+}
+
+// roundStat округляет значение статистики до тысячных
+func roundStat(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsService(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+
+	// Время создания задает хук модели, поэтому время готовности отсчитывается от него
+	create := func(user string, status models.ReportStatus, took time.Duration, size int64) {
+		report := &models.Report{Title: "Report", Status: status, CreatedBy: user, UpdatedBy: user, FileSize: size}
+		if size > 0 {
+			report.FileKey = "reports/file"
+		}
+		require.NoError(t, db.Create(report).Error)
+		if took > 0 {
+			require.NoError(t, db.Model(report).UpdateColumn("generated_at", report.CreatedAt.Add(took)).Error)
+		}
+	}
+	create("alice", models.StatusCompleted, 10*time.Second, 100)
+	create("alice", models.StatusCompleted, 20*time.Second, 200)
+	create("bob", models.StatusCompleted, 30*time.Second, 300)
+	create("alice", models.StatusFailed, 0, 0)
+	create("carol", models.StatusPending, 0, 0)
+
+	stats, err := NewStatsServiceFromDB(db, logger).GetStats(context.Background(), 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), stats.Total)
+	assert.Equal(t, int64(3), stats.ByStatus[models.StatusCompleted])
+	assert.Equal(t, int64(3), stats.Duration.Count)
+	assert.Equal(t, 20.0, stats.Duration.Avg)
+	assert.Equal(t, 20.0, stats.Duration.P50)
+	assert.Equal(t, 30.0, stats.Duration.P99)
+
+	require.Len(t, stats.Failures, len(StatsWindows))
+	assert.Equal(t, FailureStats{Window: "1h", Finished: 4, Failed: 1, Rate: 0.25}, stats.Failures[0])
+
+	require.Len(t, stats.TopCreators, 2)
+	assert.Equal(t, CreatorStats{CreatedBy: "alice", Reports: 3, StoredBytes: 300}, stats.TopCreators[0])
+	assert.Equal(t, StorageStats{Files: 3, Bytes: 600}, stats.Storage)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"report_srv/internal/events"
+	"report_srv/internal/logging"
+)
+
+// statusSubscriberBuffer размер буфера канала подписчика. При переполнении
+// события отбрасываются, чтобы медленный клиент не блокировал генерацию.
+const statusSubscriberBuffer = 16
+
+// subscribeReport подписывается на события одного отчета и передает их в канал.
+// Подписка снимается и канал закрывается при отмене контекста.
+func subscribeReport(ctx context.Context, subscriber events.Subscriber, reportID uint) <-chan events.Event {
+	ch := make(chan events.Event, statusSubscriberBuffer)
+
+	var (
+		mu     sync.Mutex
+		closed bool
+	)
+
+	unsubscribe := subscriber.Subscribe(func(_ context.Context, event events.Event) {
+		if event.ReportID != reportID {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	},
+		events.ReportStarted,
+		events.ReportCompleted,
+		events.ReportFailed,
+		events.ReportCanceled,
+		events.ReportDeleted,
+		events.ReportExpired,
+	)
+
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+
+		mu.Lock()
+		closed = true
+		close(ch)
+		mu.Unlock()
+	}()
+
+	return ch
+}
+
+// publishEvent публикует событие. Ошибка публикации не прерывает операцию
+func publishEvent(ctx context.Context, publisher events.Publisher, logger logging.Logger, event events.Event) {
+	if err := publisher.Publish(ctx, event); err != nil {
+		logger.WithError(err).WithField("event_type", event.Type).Warn("Ошибка публикации события отчета")
+	}
+}
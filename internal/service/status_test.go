@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProcessor процессор, который принимает задачи, но не выполняет их
+type stubProcessor struct{}
+
+func (p *stubProcessor) SubmitTask(ctx context.Context, task Task) error { return nil }
+func (p *stubProcessor) CancelTask(taskID string) error                  { return nil }
+func (p *stubProcessor) GetTaskStatus(taskID string) TaskStatus          { return TaskStatusUnknown }
+
+func TestSubscribeReport(t *testing.T) {
+	bus := events.NewInProcessBus(setupTestLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := subscribeReport(ctx, bus, 1)
+
+	require.NoError(t, bus.Publish(ctx, events.NewEvent(events.ReportCreated, 1, models.StatusPending)))
+	require.NoError(t, bus.Publish(ctx, events.NewEvent(events.ReportStarted, 2, models.StatusProcessing)))
+	require.NoError(t, bus.Publish(ctx, events.NewEvent(events.ReportStarted, 1, models.StatusProcessing)))
+
+	select {
+	case event := <-updates:
+		assert.Equal(t, events.ReportStarted, event.Type)
+		assert.Equal(t, uint(1), event.ReportID)
+	case <-time.After(time.Second):
+		t.Fatal("событие не получено")
+	}
+	assert.Empty(t, updates)
+
+	cancel()
+	_, ok := <-updates
+	assert.False(t, ok, "канал должен закрыться после отмены контекста")
+
+	// Публикация после отписки не блокируется и не паникует
+	require.NoError(t, bus.Publish(context.Background(), events.NewEvent(events.ReportCompleted, 1, models.StatusCompleted)))
+}
+
+func TestReportServicePublishesLifecycleEvents(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	bus := events.NewInProcessBus(logger)
+	mockStorage := new(MockStorage)
+
+	repository := NewGormReportRepository(db, logger)
+	generators := NewFormatGenerators(logger)
+	fileStorage := NewReportFileStorage(mockStorage, logger)
+	executor := NewReportTaskExecutor(repository, generators, fileStorage, logger).WithPublisher(bus)
+	service := NewReportService(repository, generators, fileStorage, &stubProcessor{}, bus, logger)
+
+	received := make(chan events.Event, 10)
+	bus.Subscribe(func(ctx context.Context, event events.Event) { received <- event })
+
+	report := &models.Report{Title: "Report", Format: models.FormatCSV, CreatedBy: "test-user", UpdatedBy: "test-user"}
+	require.NoError(t, service.CreateReport(context.Background(), report))
+
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	require.NoError(t, executor.generateReport(context.Background(), report.ID))
+
+	mockStorage.On("Delete", mock.Anything, mock.Anything).Return(nil)
+	require.NoError(t, service.DeleteReport(context.Background(), report.ID))
+
+	var types []events.EventType
+	for len(received) > 0 {
+		event := <-received
+		assert.Equal(t, report.ID, event.ReportID)
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []events.EventType{
+		events.ReportCreated,
+		events.ReportStarted,
+		events.ReportCompleted,
+		events.ReportDeleted,
+	}, types)
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTaskListLimit число задач в списке по умолчанию
+	defaultTaskListLimit = 100
+	// maxTaskListLimit максимальное число задач в списке
+	maxTaskListLimit = 1000
+	// syncFinishedTaskTTL время хранения завершенных задач в памяти синхронного процессора
+	syncFinishedTaskTTL = time.Hour
+)
+
+var (
+	// ErrTaskNotFound задача не найдена в процессоре
+	ErrTaskNotFound = newCategoryError(ErrNotFound, "задача не найдена")
+	// ErrTaskFinished задача уже завершена
+	ErrTaskFinished = newCategoryError(ErrConflict, "задача уже завершена")
+	// ErrTaskNotPending задача уже выполняется или завершена
+	ErrTaskNotPending = newCategoryError(ErrConflict, "задача не ожидает выполнения")
+)
+
+// IsFinished проверяет, является ли статус задачи окончательным
+func (s TaskStatus) IsFinished() bool {
+	switch s {
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// TaskInfo состояние задачи в процессоре
+type TaskInfo struct {
+	ID       string     `json:"id"`
+	Type     TaskType   `json:"type"`
+	ReportID uint       `json:"report_id,omitempty"`
+	Status   TaskStatus `json:"status"`
+	Priority Priority   `json:"priority"`
+	Attempts int        `json:"attempts"`
+	// Error ошибка последней попытки выполнения
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TaskFilter параметры списка задач
+type TaskFilter struct {
+	// Status статус задач, пустой - все задачи
+	Status TaskStatus
+	Limit  int
+}
+
+// limit возвращает число задач в списке с учетом ограничений
+func (f TaskFilter) limit() int {
+	if f.Limit <= 0 {
+		return defaultTaskListLimit
+	}
+	if f.Limit > maxTaskListLimit {
+		return maxTaskListLimit
+	}
+	return f.Limit
+}
+
+// TaskInspector предоставляет сведения о задачах процессора
+type TaskInspector interface {
+	GetTask(ctx context.Context, taskID string) (*TaskInfo, error)
+	ListTasks(ctx context.Context, filter TaskFilter) ([]TaskInfo, error)
+}
+
+// TaskManager фоновый процессор с просмотром задач
+type TaskManager interface {
+	BackgroundProcessor
+	TaskInspector
+}
+
+// newTaskInfo создает сведения о поставленной в очередь задаче
+func newTaskInfo(task Task, now time.Time) TaskInfo {
+	info := TaskInfo{
+		ID:        task.ID,
+		Type:      task.Type,
+		Status:    TaskStatusPending,
+		Priority:  task.Priority,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if reportID, ok := task.Data.(uint); ok && task.Type == TaskTypeReportGeneration {
+		info.ReportID = reportID
+	}
+	return info
+}
+
+// sortTasks упорядочивает задачи от новых к старым и применяет фильтр
+func sortTasks(tasks []TaskInfo, filter TaskFilter) []TaskInfo {
+	result := make([]TaskInfo, 0, len(tasks))
+	for _, task := range tasks {
+		if filter.Status == "" || task.Status == filter.Status {
+			result = append(result, task)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].ID > result[j].ID
+		}
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+
+	if limit := filter.limit(); len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// taskRegistry хранит состояние задач синхронного процессора в памяти.
+// Завершенные задачи удаляются через syncFinishedTaskTTL.
+type taskRegistry struct {
+	mu    sync.Mutex
+	tasks map[string]*TaskInfo
+}
+
+func newTaskRegistry() *taskRegistry {
+	return &taskRegistry{tasks: make(map[string]*TaskInfo)}
+}
+
+// submit регистрирует задачу в статусе pending
+func (r *taskRegistry) submit(task Task) {
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, info := range r.tasks {
+		if info.FinishedAt != nil && now.Sub(*info.FinishedAt) > syncFinishedTaskTTL {
+			delete(r.tasks, id)
+		}
+	}
+
+	info := newTaskInfo(task, now)
+	r.tasks[task.ID] = &info
+}
+
+// start переводит задачу в статус running. Возвращает false, если задача отменена до запуска.
+func (r *taskRegistry) start(taskID string) bool {
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, exists := r.tasks[taskID]
+	if !exists {
+		return true
+	}
+	if info.Status == TaskStatusCanceled {
+		return false
+	}
+
+	info.Status = TaskStatusRunning
+	info.Attempts++
+	info.StartedAt = &now
+	info.UpdatedAt = now
+	return true
+}
+
+// finish фиксирует окончательный статус задачи
+func (r *taskRegistry) finish(taskID string, status TaskStatus, cause error) {
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, exists := r.tasks[taskID]
+	if !exists {
+		return
+	}
+
+	info.Status = status
+	info.FinishedAt = &now
+	info.UpdatedAt = now
+	if cause != nil {
+		info.Error = cause.Error()
+	}
+}
+
+// retry возвращает задачу после ошибки в статус pending до повторного запуска
+func (r *taskRegistry) retry(taskID string, cause error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, exists := r.tasks[taskID]
+	if !exists {
+		return
+	}
+
+	info.Status = TaskStatusPending
+	info.UpdatedAt = time.Now().UTC()
+	if cause != nil {
+		info.Error = cause.Error()
+	}
+}
+
+// cancelPending отменяет задачу, ожидающую запуска. Возвращает false, если задача уже запущена.
+func (r *taskRegistry) cancelPending(taskID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, exists := r.tasks[taskID]
+	if !exists {
+		return false, ErrTaskNotFound
+	}
+	if info.Status.IsFinished() {
+		return false, ErrTaskFinished
+	}
+	if info.Status != TaskStatusPending {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	info.Status = TaskStatusCanceled
+	info.FinishedAt = &now
+	info.UpdatedAt = now
+	return true, nil
+}
+
+// get возвращает копию сведений о задаче
+func (r *taskRegistry) get(taskID string) (TaskInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, exists := r.tasks[taskID]
+	if !exists {
+		return TaskInfo{}, false
+	}
+	return *info, true
+}
+
+// count возвращает число задач в статусе status
+func (r *taskRegistry) count(status TaskStatus) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, info := range r.tasks {
+		if info.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// list возвращает копии сведений о задачах
+func (r *taskRegistry) list(filter TaskFilter) []TaskInfo {
+	r.mu.Lock()
+	tasks := make([]TaskInfo, 0, len(r.tasks))
+	for _, info := range r.tasks {
+		tasks = append(tasks, *info)
+	}
+	r.mu.Unlock()
+
+	return sortTasks(tasks, filter)
+}
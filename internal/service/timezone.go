@@ -0,0 +1,49 @@
+package service
+
+import (
+	"time"
+
+	"report_srv/internal/models"
+)
+
+// localTimeRows переводит значения даты и времени строк в часовой пояс отчета. Генераторы
+// выводят время так, как оно задано: CSV и JSON со смещением, Excel и HTML - по часам пояса
+type localTimeRows struct {
+	rows     RowIterator
+	location *time.Location
+}
+
+// withReportTimezone переводит даты строк в часовой пояс из параметра timezone.
+// Без параметра строки возвращаются как есть
+func withReportTimezone(rows RowIterator, parameters models.JSON) RowIterator {
+	report := models.Report{Parameters: parameters}
+	location, ok, err := report.Location()
+	if err != nil || !ok {
+		return rows
+	}
+	return &localTimeRows{rows: rows, location: location}
+}
+
+// Columns возвращает колонки исходного набора
+func (r *localTimeRows) Columns() []string {
+	return r.rows.Columns()
+}
+
+// Next возвращает следующую строку с датами в часовом поясе отчета
+func (r *localTimeRows) Next() ([]interface{}, error) {
+	row, err := r.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range row {
+		switch v := value.(type) {
+		case time.Time:
+			row[i] = v.In(r.location)
+		case *time.Time:
+			if v != nil {
+				row[i] = v.In(r.location)
+			}
+		}
+	}
+	return row, nil
+}
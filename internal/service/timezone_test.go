@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportTimezoneRendering(t *testing.T) {
+	createdAt := time.Date(2026, 3, 1, 22, 30, 0, 0, time.UTC)
+	report := &models.Report{
+		ID:         7,
+		Title:      "Sales",
+		Format:     models.FormatCSV,
+		CreatedAt:  createdAt,
+		Parameters: models.JSON{models.ParamTimezone: "Asia/Tokyo"},
+	}
+
+	rows := withReportTimezone(&sliceRows{
+		columns: []string{"sold_at", "shipped_at", "amount"},
+		rows:    [][]interface{}{{createdAt, &createdAt, 10}},
+	}, report.Parameters)
+	data := &ReportData{Datasets: []Dataset{{Name: "main", Rows: rows}}}
+
+	reader, filename, err := NewCSVReportGenerator(setupTestLogger()).Generate(context.Background(), report, data)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "2026-03-02T07:30:00+09:00,2026-03-02T07:30:00+09:00,10")
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	stamp := strings.TrimSuffix(strings.TrimPrefix(filename, "report_7_"), ".csv")
+	renderedAt, err := time.ParseInLocation("20060102_150405", stamp, tokyo)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), renderedAt, time.Minute)
+
+	// Без параметра timezone строки не оборачиваются
+	plain := &sliceRows{}
+	assert.Same(t, plain, withReportTimezone(plain, models.JSON{}))
+
+	// Сведения об отчете выводят дату создания в часовом поясе отчета
+	info := newReportInfoRows(report)
+	for {
+		row, err := info.Next()
+		require.NoError(t, err)
+		if row[0] == "Дата создания" {
+			assert.Equal(t, "2026-03-02 07:30:00", row[1])
+			break
+		}
+	}
+}
+
+func TestReportInLocation(t *testing.T) {
+	generatedAt := time.Date(2026, 3, 1, 22, 30, 0, 0, time.UTC)
+	completion := generatedAt.Add(time.Hour)
+	report := &models.Report{
+		CreatedAt:   generatedAt,
+		GeneratedAt: &generatedAt,
+		Queue:       &models.ReportQueue{Position: 1, EstimatedCompletionAt: &completion},
+	}
+
+	moscow, err := models.LoadTimezone("Europe/Moscow")
+	require.NoError(t, err)
+	local := *report
+	local.InLocation(moscow)
+
+	assert.Equal(t, 1, local.CreatedAt.Hour())
+	assert.Equal(t, 1, local.GeneratedAt.Hour())
+	assert.Equal(t, 2, local.Queue.EstimatedCompletionAt.Hour())
+	assert.True(t, local.GeneratedAt.Equal(generatedAt))
+
+	// Исходный отчет не меняется
+	assert.Equal(t, time.UTC, report.GeneratedAt.Location())
+	assert.Equal(t, time.UTC, report.Queue.EstimatedCompletionAt.Location())
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"report_srv/internal/events"
+	"report_srv/internal/models"
+	"report_srv/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingReportService декоратор ReportService, создающий спаны для операций сервиса
+type TracingReportService struct {
+	service ReportService
+	tracer  trace.Tracer
+}
+
+// NewTracingReportService оборачивает сервис отчетов трассировкой
+func NewTracingReportService(service ReportService) ReportService {
+	return &TracingReportService{
+		service: service,
+		tracer:  telemetry.Tracer("service"),
+	}
+}
+
+// start начинает спан операции сервиса
+func (s *TracingReportService) start(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "ReportService."+operation, trace.WithAttributes(attributes...))
+}
+
+// CreateReport трассирует создание отчета
+func (s *TracingReportService) CreateReport(ctx context.Context, report *models.Report) error {
+	ctx, span := s.start(ctx, "CreateReport", attribute.String("report.format", report.Format.String()))
+	defer span.End()
+
+	err := s.service.CreateReport(ctx, report)
+	span.SetAttributes(reportIDAttribute(report.ID))
+	telemetry.RecordError(span, err)
+	return err
+}
+
+// GetReport трассирует получение отчета
+func (s *TracingReportService) GetReport(ctx context.Context, id uint) (*models.Report, error) {
+	ctx, span := s.start(ctx, "GetReport", reportIDAttribute(id))
+	defer span.End()
+
+	report, err := s.service.GetReport(ctx, id)
+	telemetry.RecordError(span, err)
+	return report, err
+}
+
+// ListReports трассирует получение списка отчетов
+func (s *TracingReportService) ListReports(ctx context.Context, params ListReportParams) (*ReportList, error) {
+	ctx, span := s.start(ctx, "ListReports",
+		attribute.Int("page", params.Page),
+		attribute.Int("page_size", params.PageSize),
+		attribute.String("sort_by", params.SortBy),
+	)
+	defer span.End()
+
+	list, err := s.service.ListReports(ctx, params)
+	telemetry.RecordError(span, err)
+	return list, err
+}
+
+// UpdateReport трассирует обновление отчета
+func (s *TracingReportService) UpdateReport(ctx context.Context, id uint, updates ReportUpdateParams) error {
+	ctx, span := s.start(ctx, "UpdateReport", reportIDAttribute(id))
+	defer span.End()
+
+	err := s.service.UpdateReport(ctx, id, updates)
+	telemetry.RecordError(span, err)
+	return err
+}
+
+// DeleteReport трассирует удаление отчета
+func (s *TracingReportService) DeleteReport(ctx context.Context, id uint) error {
+	ctx, span := s.start(ctx, "DeleteReport", reportIDAttribute(id))
+	defer span.End()
+
+	err := s.service.DeleteReport(ctx, id)
+	telemetry.RecordError(span, err)
+	return err
+}
+
+// CancelReportGeneration трассирует отмену генерации
+func (s *TracingReportService) CancelReportGeneration(ctx context.Context, id uint) error {
+	ctx, span := s.start(ctx, "CancelReportGeneration", reportIDAttribute(id))
+	defer span.End()
+
+	err := s.service.CancelReportGeneration(ctx, id)
+	telemetry.RecordError(span, err)
+	return err
+}
+
+// GetReportFile трассирует получение файла отчета
+func (s *TracingReportService) GetReportFile(ctx context.Context, id uint) (*ReportFile, error) {
+	ctx, span := s.start(ctx, "GetReportFile", reportIDAttribute(id))
+	defer span.End()
+
+	file, err := s.service.GetReportFile(ctx, id)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("report.file_size", file.Size))
+	}
+	telemetry.RecordError(span, err)
+	return file, err
+}
+
+// GetReportFileRange трассирует получение части файла отчета
+func (s *TracingReportService) GetReportFileRange(ctx context.Context, id uint, offset, length int64) (*ReportFile, error) {
+	ctx, span := s.start(ctx, "GetReportFileRange", reportIDAttribute(id),
+		attribute.Int64("report.range_offset", offset), attribute.Int64("report.range_length", length))
+	defer span.End()
+
+	file, err := s.service.GetReportFileRange(ctx, id, offset, length)
+	telemetry.RecordError(span, err)
+	return file, err
+}
+
+// GetReportDownloadURL трассирует получение ссылки на файл отчета
+func (s *TracingReportService) GetReportDownloadURL(ctx context.Context, id uint, expiration time.Duration) (*ReportDownloadURL, error) {
+	ctx, span := s.start(ctx, "GetReportDownloadURL", reportIDAttribute(id))
+	defer span.End()
+
+	downloadURL, err := s.service.GetReportDownloadURL(ctx, id, expiration)
+	telemetry.RecordError(span, err)
+	return downloadURL, err
+}
+
+// GetReportArtifact трассирует получение файла из архива отчета
+func (s *TracingReportService) GetReportArtifact(ctx context.Context, id uint, format models.ReportFormat) (*ReportFile, error) {
+	ctx, span := s.start(ctx, "GetReportArtifact", reportIDAttribute(id), attribute.String("report.format", string(format)))
+	defer span.End()
+
+	file, err := s.service.GetReportArtifact(ctx, id, format)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("report.file_size", file.Size))
+	}
+	telemetry.RecordError(span, err)
+	return file, err
+}
+
+// GetReportSnapshot трассирует получение снимка данных отчета
+func (s *TracingReportService) GetReportSnapshot(ctx context.Context, id uint) (*ReportData, error) {
+	ctx, span := s.start(ctx, "GetReportSnapshot", reportIDAttribute(id))
+	defer span.End()
+
+	data, err := s.service.GetReportSnapshot(ctx, id)
+	telemetry.RecordError(span, err)
+	return data, err
+}
+
+// RenderReport трассирует перестроение отчета в другой формат
+func (s *TracingReportService) RenderReport(ctx context.Context, id uint, format models.ReportFormat) (*models.ReportRendition, error) {
+	ctx, span := s.start(ctx, "RenderReport", reportIDAttribute(id), attribute.String("report.format", string(format)))
+	defer span.End()
+
+	rendition, err := s.service.RenderReport(ctx, id, format)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("report.file_size", rendition.Size))
+	}
+	telemetry.RecordError(span, err)
+	return rendition, err
+}
+
+// SetReportPriority трассирует изменение приоритета отчета в очереди
+func (s *TracingReportService) SetReportPriority(ctx context.Context, id uint, priority models.ReportPriority, updatedBy string) (*models.Report, error) {
+	ctx, span := s.start(ctx, "SetReportPriority", reportIDAttribute(id), attribute.String("report.priority", string(priority)))
+	defer span.End()
+
+	report, err := s.service.SetReportPriority(ctx, id, priority, updatedBy)
+	telemetry.RecordError(span, err)
+	return report, err
+}
+
+// SubscribeStatus трассирует подписку на смены статуса. Спан покрывает
+// только оформление подписки, а не время ее жизни
+func (s *TracingReportService) SubscribeStatus(ctx context.Context, id uint) (<-chan events.Event, error) {
+	spanCtx, span := s.start(ctx, "SubscribeStatus", reportIDAttribute(id))
+	defer span.End()
+
+	events, err := s.service.SubscribeStatus(spanCtx, id)
+	telemetry.RecordError(span, err)
+	return events, err
+}
+
+// reportIDAttribute атрибут спана с ID отчета
+func reportIDAttribute(id uint) attribute.KeyValue {
+	return attribute.Int64("report.id", int64(id))
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/models"
+	"report_srv/internal/query"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// mappedRows итератор, применяющий преобразования колонок определения к строкам набора
+type mappedRows struct {
+	rows      RowIterator
+	dataset   string
+	mapping   *models.ColumnMapping
+	masking   columnMasking
+	formatter valueFormatter
+
+	prepared bool
+	// names имена колонок до переименования, по ним вычисляются выражения
+	names   []string
+	columns []string
+	steps   []columnStep
+	// masked способы маскирования колонок по правилам, пустая строка - колонка открыта
+	masked []string
+}
+
+// columnStep преобразование, привязанное к колонке строки
+type columnStep struct {
+	index      int
+	transform  models.ColumnTransform
+	expression *query.Expression
+}
+
+// newMappedRows оборачивает строки набора преобразованиями колонок и маскированием.
+// Без преобразований mapping равно nil
+func newMappedRows(rows RowIterator, dataset string, mapping *models.ColumnMapping, masking columnMasking) *mappedRows {
+	if mapping == nil {
+		mapping = &models.ColumnMapping{}
+	}
+	return &mappedRows{rows: rows, dataset: dataset, mapping: mapping, masking: masking, formatter: newValueFormatter(mapping.Locale)}
+}
+
+// prepare сопоставляет преобразования с колонками набора
+func (r *mappedRows) prepare() {
+	if r.prepared {
+		return
+	}
+	r.prepared = true
+	r.names, r.columns, r.steps = planColumns(r.mapping, r.dataset, r.rows.Columns())
+	r.masked = r.masking.methods(r.dataset, r.names, r.columns)
+}
+
+// planColumns сопоставляет преобразования с колонками набора dataset. Возвращает имена колонок
+// с вычисляемыми до переименования, заголовки после переименования и шаги преобразования строки
+func planColumns(mapping *models.ColumnMapping, dataset string, source []string) ([]string, []string, []columnStep) {
+	r := &columnPlan{names: append([]string(nil), source...)}
+	for _, transform := range mapping.Columns {
+		if !transform.AppliesTo(dataset) {
+			continue
+		}
+		step := columnStep{index: r.indexOf(transform.Column), transform: transform}
+
+		if transform.Expression != "" {
+			expression, err := query.ParseExpression(transform.Expression)
+			if err != nil {
+				// Выражение проверяется при сохранении определения
+				continue
+			}
+			// Вычисляемая колонка всех запросов добавляется только в наборы с ее исходными колонками
+			if transform.Query == "" && step.index < 0 && !r.hasColumns(expression.Columns()) {
+				continue
+			}
+			step.expression = expression
+			if step.index < 0 {
+				r.names = append(r.names, transform.Column)
+				step.index = len(r.names) - 1
+			}
+		}
+		if step.index >= 0 {
+			r.steps = append(r.steps, step)
+		}
+	}
+
+	columns := append([]string(nil), r.names...)
+	for _, step := range r.steps {
+		if step.transform.Rename != "" {
+			columns[step.index] = step.transform.Rename
+		}
+	}
+	return r.names, columns, r.steps
+}
+
+// columnPlan колонки набора и шаги преобразования при сопоставлении
+type columnPlan struct {
+	names []string
+	steps []columnStep
+}
+
+// indexOf возвращает индекс колонки, сначала с учетом регистра, затем без, или -1
+func (r *columnPlan) indexOf(column string) int {
+	for i, name := range r.names {
+		if name == column {
+			return i
+		}
+	}
+	for i, name := range r.names {
+		if strings.EqualFold(name, column) {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasColumns проверяет, что все колонки есть в наборе
+func (r *columnPlan) hasColumns(columns []string) bool {
+	for _, column := range columns {
+		if r.indexOf(column) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Columns возвращает колонки набора после переименования и добавления вычисляемых
+func (r *mappedRows) Columns() []string {
+	r.prepare()
+	return r.columns
+}
+
+// Next возвращает следующую преобразованную строку
+func (r *mappedRows) Next() ([]interface{}, error) {
+	r.prepare()
+	source, err := r.rows.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]interface{}, len(r.names))
+	copy(row, source)
+
+	// Выражения вычисляются по исходным значениям до форматирования
+	values := make(map[string]interface{}, len(r.names))
+	for i, name := range r.names {
+		values[name] = row[i]
+	}
+	for _, step := range r.steps {
+		if step.expression == nil {
+			continue
+		}
+		value, err := step.expression.Eval(values)
+		if err != nil {
+			return nil, withErrorCode(models.ErrorCodeQuery, fmt.Errorf("колонка %s запроса %s: %w", step.transform.Column, r.dataset, err))
+		}
+		row[step.index] = value
+		values[r.names[step.index]] = value
+	}
+
+	for _, step := range r.steps {
+		if step.transform.Format != "" {
+			row[step.index] = r.formatter.format(row[step.index], step.transform)
+		}
+		if step.transform.Mask {
+			row[step.index] = maskValue(row[step.index])
+		}
+	}
+	for i, method := range r.masked {
+		if method != "" {
+			row[i] = r.masking.apply(method, row[i])
+		}
+	}
+	return row, nil
+}
+
+// Close закрывает исходный итератор
+func (r *mappedRows) Close() error {
+	if closer, ok := r.rows.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// valueFormatter форматирует числа и даты по локали
+type valueFormatter struct {
+	// printer nil - числа без разделителей разрядов
+	printer    *message.Printer
+	dateLayout string
+}
+
+// dateLayouts форматы дат по языку локали
+var dateLayouts = map[string]string{
+	"ru": "02.01.2006", "de": "02.01.2006", "uk": "02.01.2006", "be": "02.01.2006", "kk": "02.01.2006",
+	"pl": "02.01.2006", "cs": "02.01.2006", "fi": "02.01.2006", "nb": "02.01.2006", "tr": "02.01.2006",
+	"en": "02/01/2006", "fr": "02/01/2006", "es": "02/01/2006", "it": "02/01/2006", "pt": "02/01/2006",
+	"ja": "2006/01/02", "zh": "2006/01/02", "ko": "2006/01/02",
+}
+
+// newValueFormatter создает форматирование для локали. Неизвестная локаль - формат по умолчанию
+func newValueFormatter(locale string) valueFormatter {
+	formatter := valueFormatter{dateLayout: time.DateOnly}
+	if locale == "" {
+		return formatter
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return formatter
+	}
+
+	formatter.printer = message.NewPrinter(tag)
+	base, _ := tag.Base()
+	if layout, ok := dateLayouts[base.String()]; ok {
+		formatter.dateLayout = layout
+	}
+	if region, _ := tag.Region(); base.String() == "en" && region.String() == "US" {
+		formatter.dateLayout = "01/02/2006"
+	}
+	return formatter
+}
+
+// format форматирует значение колонки. Значение, которое нельзя привести к формату, не меняется
+func (f valueFormatter) format(value interface{}, transform models.ColumnTransform) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	decimals := 2
+	if transform.Decimals != nil {
+		decimals = *transform.Decimals
+	}
+	switch transform.Format {
+	case models.ColumnFormatNumber, models.ColumnFormatInteger, models.ColumnFormatPercent:
+		number, ok := query.Number(value)
+		if !ok {
+			return value
+		}
+		switch transform.Format {
+		case models.ColumnFormatInteger:
+			return f.number(math.Round(number), 0)
+		case models.ColumnFormatPercent:
+			return f.number(number*100, decimals) + "%"
+		}
+		return f.number(number, decimals)
+	case models.ColumnFormatDate, models.ColumnFormatDateTime:
+		t, ok := timeValue(value)
+		if !ok {
+			return value
+		}
+		if transform.Format == models.ColumnFormatDateTime {
+			return t.Format(f.dateLayout + " 15:04:05")
+		}
+		return t.Format(f.dateLayout)
+	}
+	return value
+}
+
+// number форматирует число с заданным числом знаков после запятой
+func (f valueFormatter) number(number float64, decimals int) string {
+	if f.printer == nil {
+		return strconv.FormatFloat(number, 'f', decimals, 64)
+	}
+	return f.printer.Sprintf("%.*f", decimals, number)
+}
+
+// timeLayouts форматы дат, которые драйверы возвращают строкой
+var timeLayouts = []string{time.RFC3339Nano, time.DateTime, "2006-01-02 15:04:05.999999999-07:00", time.DateOnly}
+
+// timeValue приводит значение колонки к времени
+func timeValue(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// maskedSuffix число символов, которые маскирование оставляет открытыми
+const maskedSuffix = 4
+
+// maskValue заменяет значение звездочками, оставляя последние символы. Короткие значения
+// маскируются полностью
+func maskValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	runes := []rune(maskedText(value))
+	if len(runes) <= maskedSuffix {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-maskedSuffix) + string(runes[len(runes)-maskedSuffix:])
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"report_srv/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnMappingTransformsRows(t *testing.T) {
+	db, definitions := setupDefinitionTest(t)
+	logger := setupTestLogger()
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("CREATE TABLE orders (customer TEXT, card TEXT, amount REAL, price REAL, closed_at TEXT)").Error)
+	require.NoError(t, db.Exec("INSERT INTO orders VALUES ('Иванов', '4276123456781234', 1234.5, 2, '2024-12-31 10:30:00')").Error)
+
+	decimals := 1
+	definition := newTestDefinition()
+	definition.Queries = models.Queries{
+		{Name: "orders", SQL: "SELECT customer, card, amount, price, closed_at FROM orders"},
+		{Name: "customers", SQL: "SELECT customer FROM orders"},
+	}
+	definition.ParameterSchema = nil
+	definition.ColumnMapping = &models.ColumnMapping{
+		Locale: "ru",
+		Columns: []models.ColumnTransform{
+			{Column: "customer", Rename: "Клиент"},
+			{Query: "orders", Column: "card", Mask: true},
+			{Column: "total", Expression: "amount * price", Format: models.ColumnFormatNumber, Decimals: &decimals},
+			{Column: "amount", Format: models.ColumnFormatInteger},
+			{Column: "closed_at", Format: models.ColumnFormatDate},
+		},
+	}
+	require.NoError(t, definitions.Create(ctx, definition))
+
+	loader := NewDefinitionDataLoader(definitions, newTestQueryValidator(t, "orders"), newTestDataSources(t, db, nil),
+		NewReportFileStorage(new(MockStorage), logger), logger)
+	data, err := loader.Load(ctx, &models.Report{DefinitionID: &definition.ID})
+	require.NoError(t, err)
+	defer data.Close()
+
+	orders := data.Datasets[0].Rows
+	assert.Equal(t, []string{"Клиент", "card", "amount", "price", "closed_at", "total"}, orders.Columns())
+	row, err := orders.Next()
+	require.NoError(t, err)
+	// Вычисляемая колонка считается по числу до форматирования amount
+	assert.Equal(t, []interface{}{"Иванов", "************1234", "1\u00a0235", 2.0, "31.12.2024", "2\u00a0469,0"}, row)
+	_, err = orders.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// Вычисляемая колонка не добавляется в запрос без ее исходных колонок
+	customers := data.Datasets[1].Rows
+	assert.Equal(t, []string{"Клиент"}, customers.Columns())
+}
+
+func TestValueFormatterLocales(t *testing.T) {
+	closedAt := time.Date(2024, 12, 31, 10, 30, 0, 0, time.UTC)
+	number := models.ColumnTransform{Format: models.ColumnFormatNumber}
+	percent := models.ColumnTransform{Format: models.ColumnFormatPercent}
+	date := models.ColumnTransform{Format: models.ColumnFormatDateTime}
+
+	formatter := newValueFormatter("en-US")
+	assert.Equal(t, "1,234,567.89", formatter.format(1234567.891, number))
+	assert.Equal(t, "12/31/2024 10:30:00", formatter.format(closedAt, date))
+
+	formatter = newValueFormatter("de")
+	assert.Equal(t, "1.234.567,89", formatter.format("1234567.891", number))
+	assert.Equal(t, "12,50%", formatter.format(0.125, percent))
+
+	formatter = newValueFormatter("")
+	assert.Equal(t, "1234567.89", formatter.format(1234567.891, number))
+	assert.Equal(t, "2024-12-31 10:30:00", formatter.format(closedAt, date))
+	// Значение не приводится к формату и не меняется
+	assert.Equal(t, "n/a", formatter.format("n/a", number))
+
+	assert.Equal(t, "****", maskValue("1234"))
+	assert.Nil(t, maskValue(nil))
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultRestoreDays срок восстановления архивного файла по умолчанию
+	defaultRestoreDays = 7
+
+	// Максимальное число файлов, переводимых за один проход
+	defaultTransitionBatchSize = 100
+)
+
+// ErrReportRestoring файл отчета переведен в архивный класс хранения и восстанавливается
+var ErrReportRestoring = newCategoryError(ErrNotReady, "файл отчета восстанавливается из архива")
+
+// reportObjectTags возвращает теги файла отчета: отчет, автор и класс хранения
+func reportObjectTags(report *models.Report, retention RetentionPolicy) storage.ObjectTags {
+	return storage.ObjectTags{
+		"report_id":       strconv.FormatUint(uint64(report.ID), 10),
+		"tenant":          report.CreatedBy,
+		"retention_class": retention.Class(report),
+	}
+}
+
+// reportArchive восстанавливает файлы отчетов, переведенные в архивный класс хранения
+type reportArchive struct {
+	storage     storage.TieredStorage
+	restoreDays int
+}
+
+// newReportArchive возвращает доступ к архивным файлам, если хранилище поддерживает классы хранения
+func newReportArchive(cfg config.StorageTransition, fileStorage storage.Storage) *reportArchive {
+	tiered, ok := storage.AsTiered(fileStorage)
+	if !ok {
+		return nil
+	}
+	restoreDays := cfg.RestoreDays
+	if restoreDays <= 0 {
+		restoreDays = defaultRestoreDays
+	}
+	return &reportArchive{storage: tiered, restoreDays: restoreDays}
+}
+
+// ensureReadable проверяет, что файл отчета можно прочитать. Для архивного файла без
+// восстановленной копии запрашивает восстановление и возвращает ErrReportRestoring.
+func (a *reportArchive) ensureReadable(ctx context.Context, report *models.Report, logger logging.Logger) error {
+	if a == nil || !storage.StorageClass(report.StorageClass).RequiresRestore() {
+		return nil
+	}
+
+	state, err := a.storage.ArchiveState(ctx, report.FileKey)
+	if err != nil {
+		return fmt.Errorf("ошибка получения состояния архивного файла: %w", err)
+	}
+	if state.Readable() {
+		return nil
+	}
+
+	if !state.Restoring {
+		if err := a.storage.Restore(ctx, report.FileKey, a.restoreDays); err != nil {
+			return fmt.Errorf("ошибка запроса восстановления файла из архива: %w", err)
+		}
+		logger.WithFields(logging.Fields{
+			"file_key":      report.FileKey,
+			"storage_class": state.Class,
+			"restore_days":  a.restoreDays,
+		}).Info("Запрошено восстановление файла отчета из архива")
+	}
+	return fmt.Errorf("%w: %d", ErrReportRestoring, report.ID)
+}
+
+// TransitionJob периодически переводит файлы старых отчетов в более дешевый класс хранения
+type TransitionJob struct {
+	repository ReportRepository
+	storage    storage.TieredStorage
+	class      storage.StorageClass
+	after      time.Duration
+	interval   time.Duration
+	batchSize  int
+	logger     logging.Logger
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewTransitionJob создает перевод файлов отчетов в класс хранения из конфигурации
+func NewTransitionJob(
+	cfg config.StorageTransition,
+	repository ReportRepository,
+	tiered storage.TieredStorage,
+	logger logging.Logger,
+) *TransitionJob {
+	return &TransitionJob{
+		repository: repository,
+		storage:    tiered,
+		class:      storage.StorageClass(cfg.Class),
+		after:      cfg.After,
+		interval:   cfg.Interval,
+		batchSize:  defaultTransitionBatchSize,
+		logger:     logger,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// NewTransitionJobFromConfig создает перевод файлов, если он включен в конфигурации.
+// Для хранилища без классов хранения возвращается ошибка.
+func NewTransitionJobFromConfig(
+	cfg config.Config,
+	db *gorm.DB,
+	fileStorage storage.Storage,
+	logger logging.Logger,
+) (*TransitionJob, error) {
+	if !cfg.Storage.Transition.Enabled {
+		return nil, nil
+	}
+	tiered, ok := storage.AsTiered(fileStorage)
+	if !ok {
+		return nil, fmt.Errorf("хранилище %s не поддерживает классы хранения", cfg.Storage.Type)
+	}
+	return NewTransitionJob(cfg.Storage.Transition, NewGormReportRepository(db, logger), tiered, logger), nil
+}
+
+// Start запускает цикл перевода файлов в отдельной горутине
+func (j *TransitionJob) Start() {
+	j.logger.WithFields(logging.Fields{
+		"interval": j.interval,
+		"after":    j.after,
+		"class":    j.class,
+	}).Info("Запуск перевода файлов отчетов в другой класс хранения")
+	go j.loop()
+}
+
+// Stop останавливает цикл перевода файлов
+func (j *TransitionJob) Stop(ctx context.Context) error {
+	j.stopOnce.Do(func() { close(j.stop) })
+
+	select {
+	case <-j.done:
+		j.logger.Info("Перевод файлов отчетов остановлен")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop основной цикл перевода файлов
+func (j *TransitionJob) loop() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), j.interval)
+			j.Run(ctx, time.Now().UTC())
+			cancel()
+		}
+	}
+}
+
+// Run переводит файлы отчетов, сгенерированных раньше now минус возраст перевода,
+// и возвращает их число
+func (j *TransitionJob) Run(ctx context.Context, now time.Time) int {
+	reports, err := j.repository.ListForTransition(ctx, now.Add(-j.after), j.batchSize)
+	if err != nil {
+		j.logger.WithError(err).Error("Ошибка получения отчетов для перевода файлов")
+		return 0
+	}
+
+	moved := 0
+	for i := range reports {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := j.transition(ctx, &reports[i]); err != nil {
+			j.logger.WithError(err).WithField("report_id", reports[i].ID).
+				Error("Ошибка перевода файла отчета в другой класс хранения")
+			continue
+		}
+		moved++
+	}
+
+	if moved > 0 {
+		j.logger.WithFields(logging.Fields{
+			"count": moved,
+			"class": j.class,
+		}).Info("Файлы отчетов переведены в другой класс хранения")
+	}
+	return moved
+}
+
+// transition переводит файл отчета и сохраняет его класс хранения. Если класс не сохранился
+// в прошлый проход, файл уже в нужном классе: архивный файл нельзя скопировать повторно.
+func (j *TransitionJob) transition(ctx context.Context, report *models.Report) error {
+	state, err := j.storage.ArchiveState(ctx, report.FileKey)
+	if err != nil {
+		return fmt.Errorf("ошибка получения класса хранения файла %s: %w", report.FileKey, err)
+	}
+	if state.Class != j.class {
+		if err := j.storage.Transition(ctx, report.FileKey, j.class); err != nil {
+			return fmt.Errorf("ошибка перевода файла %s: %w", report.FileKey, err)
+		}
+	}
+	if err := j.repository.SetStorageClass(ctx, report.ID, string(j.class)); err != nil {
+		return fmt.Errorf("ошибка сохранения класса хранения отчета: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/models"
+	"report_srv/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockTieredStorage хранилище с классами хранения для тестов
+type MockTieredStorage struct {
+	MockStorage
+}
+
+func (m *MockTieredStorage) Transition(ctx context.Context, key string, class storage.StorageClass) error {
+	args := m.Called(ctx, key, class)
+	return args.Error(0)
+}
+
+func (m *MockTieredStorage) ArchiveState(ctx context.Context, key string) (*storage.ArchiveState, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(*storage.ArchiveState), args.Error(1)
+}
+
+func (m *MockTieredStorage) Restore(ctx context.Context, key string, days int) error {
+	args := m.Called(ctx, key, days)
+	return args.Error(0)
+}
+
+func TestRetentionPolicyClass(t *testing.T) {
+	policy := RetentionPolicy{TTL: 24 * time.Hour}
+	assert.Equal(t, RetentionClassStandard, policy.Class(&models.Report{}))
+	assert.Equal(t, RetentionClassCustom, policy.Class(&models.Report{Parameters: models.JSON{models.ParamRetentionTTL: "1h"}}))
+	assert.Equal(t, RetentionClassPermanent, policy.Class(&models.Report{Parameters: models.JSON{models.ParamRetentionTTL: "0"}}))
+	assert.Equal(t, RetentionClassPermanent, RetentionPolicy{}.Class(&models.Report{}))
+}
+
+func TestExecutorTagsReportFile(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	mockStorage := new(MockStorage)
+
+	var tags storage.ObjectTags
+	mockStorage.On("Save", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		tags = storage.ObjectTagsFromContext(args.Get(0).(context.Context))
+	})
+
+	repository := NewGormReportRepository(db, logger)
+	executor := NewReportTaskExecutor(repository, NewFormatGenerators(logger), NewReportFileStorage(mockStorage, logger), logger).
+		WithRetention(RetentionPolicy{TTL: 24 * time.Hour})
+
+	report := &models.Report{Title: "Report", Format: models.FormatCSV, CreatedBy: "analyst", UpdatedBy: "analyst"}
+	require.NoError(t, repository.Create(context.Background(), report))
+	require.NoError(t, executor.generateReport(context.Background(), report.ID))
+
+	assert.Equal(t, storage.ObjectTags{
+		"report_id":       "1",
+		"tenant":          "analyst",
+		"retention_class": RetentionClassStandard,
+	}, tags)
+}
+
+func TestTransitionJobMovesOldReports(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	tiered := new(MockTieredStorage)
+
+	old := createCompletedReport(t, db, "reports/1/old.csv", nil)
+	recent := createCompletedReport(t, db, "reports/2/recent.csv", nil)
+	moved := createCompletedReport(t, db, "reports/3/moved.csv", nil)
+	generatedAt := time.Now().UTC().Add(-48 * time.Hour)
+	require.NoError(t, db.Model(&models.Report{}).Where("id IN ?", []uint{old.ID, moved.ID}).
+		Update("generated_at", generatedAt).Error)
+
+	// Файл, класс которого не сохранился в прошлый проход, повторно не копируется
+	tiered.On("ArchiveState", mock.Anything, old.FileKey).
+		Return(&storage.ArchiveState{Class: storage.StorageClassStandard}, nil)
+	tiered.On("ArchiveState", mock.Anything, moved.FileKey).
+		Return(&storage.ArchiveState{Class: storage.StorageClassGlacier}, nil)
+	tiered.On("Transition", mock.Anything, old.FileKey, storage.StorageClassGlacier).Return(nil).Once()
+
+	job := NewTransitionJob(config.StorageTransition{After: 24 * time.Hour, Class: "GLACIER", Interval: time.Hour},
+		NewGormReportRepository(db, logger), tiered, logger)
+	assert.Equal(t, 2, job.Run(context.Background(), time.Now().UTC()))
+	assert.Equal(t, 0, job.Run(context.Background(), time.Now().UTC()))
+	tiered.AssertExpectations(t)
+
+	for id, class := range map[uint]string{old.ID: "GLACIER", moved.ID: "GLACIER", recent.ID: ""} {
+		var stored models.Report
+		require.NoError(t, db.First(&stored, id).Error)
+		assert.Equal(t, class, stored.StorageClass)
+	}
+}
+
+func TestGetReportFileRestoresArchivedFile(t *testing.T) {
+	db := setupTestDB(t)
+	logger := setupTestLogger()
+	tiered := new(MockTieredStorage)
+	service := newTestReportService(t, db, tiered, logger)
+
+	report := createCompletedReport(t, db, "reports/1/archived.csv", nil)
+	require.NoError(t, db.Model(report).Update("storage_class", "GLACIER").Error)
+
+	// Первый запрос запускает восстановление, повторный ждет его завершения
+	tiered.On("ArchiveState", mock.Anything, report.FileKey).
+		Return(&storage.ArchiveState{Class: storage.StorageClassGlacier}, nil).Once()
+	tiered.On("Restore", mock.Anything, report.FileKey, defaultRestoreDays).Return(nil).Once()
+	_, err := service.GetReportFile(context.Background(), report.ID)
+	assert.ErrorIs(t, err, ErrReportRestoring)
+	assert.ErrorIs(t, err, ErrNotReady)
+
+	tiered.On("ArchiveState", mock.Anything, report.FileKey).
+		Return(&storage.ArchiveState{Class: storage.StorageClassGlacier, Restoring: true}, nil).Once()
+	_, err = service.GetReportDownloadURL(context.Background(), report.ID, time.Minute)
+	assert.ErrorIs(t, err, ErrReportRestoring)
+
+	// Восстановленную копию можно получить по временной ссылке
+	restoredUntil := time.Now().Add(24 * time.Hour)
+	tiered.On("ArchiveState", mock.Anything, report.FileKey).
+		Return(&storage.ArchiveState{Class: storage.StorageClassGlacier, RestoredUntil: &restoredUntil}, nil).Once()
+	tiered.On("GetPresignedURL", mock.Anything, report.FileKey, time.Minute).Return("https://bucket/archived.csv", nil)
+	downloadURL, err := service.GetReportDownloadURL(context.Background(), report.ID, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "https://bucket/archived.csv", downloadURL.URL)
+
+	tiered.AssertExpectations(t)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"report_srv/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// CheckReachable проверяет доступность хранилища из конфигурации без записи файлов:
+// bucket S3 запросом HeadBucket, каталог локального хранилища - по файловой системе
+func CheckReachable(ctx context.Context, cfg config.Config) error {
+	builder := NewStorageBuilder(cfg, nil)
+	switch cfg.Storage.Type {
+	case StorageTypeS3:
+		storage, err := NewS3Storage(builder.buildS3Config(), nil)
+		if err != nil {
+			return err
+		}
+		if _, err := storage.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(storage.bucket)}); err != nil {
+			return fmt.Errorf("bucket %s недоступен: %w", storage.bucket, err)
+		}
+		return nil
+	case StorageTypeLocal:
+		return checkLocalPath(cfg.Storage.BasePath)
+	default:
+		return fmt.Errorf("неподдерживаемый тип хранилища: %s", cfg.Storage.Type)
+	}
+}
+
+// checkLocalPath проверяет, что каталог хранилища существует или может быть создан:
+// ближайший существующий родительский путь должен быть каталогом
+func checkLocalPath(path string) error {
+	for current := filepath.Clean(path); ; current = filepath.Dir(current) {
+		info, err := os.Stat(current)
+		if errors.Is(err, fs.ErrNotExist) && filepath.Dir(current) != current {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("каталог хранилища %s недоступен: %w", path, err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("путь %s не является каталогом", current)
+		}
+		return nil
+	}
+}
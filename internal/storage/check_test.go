@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"report_srv/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReachableLocal(t *testing.T) {
+	dir := t.TempDir()
+	check := func(path string) error {
+		return CheckReachable(context.Background(), config.Config{Storage: config.Storage{Type: StorageTypeLocal, BasePath: path}})
+	}
+
+	assert.NoError(t, check(dir))
+	// Отсутствующий каталог будет создан при запуске
+	assert.NoError(t, check(filepath.Join(dir, "reports", "files")))
+
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, os.WriteFile(file, []byte("x"), 0o644))
+	assert.Error(t, check(file))
+	assert.Error(t, check(filepath.Join(file, "reports")))
+}
@@ -0,0 +1,489 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmsTypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+const (
+	// Типы шифрования файлов хранилища
+	EncryptionTypeNone = "none"
+	EncryptionTypeAES  = "aes"
+	EncryptionTypeKMS  = "kms"
+
+	// encryptionKeySize размер ключей AES-256
+	encryptionKeySize = 32
+
+	// encryptionChunkSize размер открытого текста в одном зашифрованном блоке файла
+	encryptionChunkSize = 64 * 1024
+)
+
+// encryptionMagic признак зашифрованного файла в начале заголовка
+var encryptionMagic = []byte("RSENC1")
+
+var (
+	// ErrEncryptedFileCorrupted зашифрованный файл поврежден или зашифрован другим ключом
+	ErrEncryptedFileCorrupted = errors.New("зашифрованный файл поврежден или зашифрован другим ключом")
+	// ErrEncryptedPresignedURL прямые ссылки хранилища отдают файлы в зашифрованном виде
+	ErrEncryptedPresignedURL = errors.New("прямые ссылки на зашифрованные файлы не поддерживаются")
+)
+
+// KeyProvider выдает ключи данных для конвертного шифрования: каждый файл шифруется
+// своим ключом данных, который хранится в заголовке файла зашифрованным мастер-ключом
+type KeyProvider interface {
+	// GenerateDataKey возвращает новый ключ данных и его зашифрованную копию
+	GenerateDataKey(ctx context.Context) (plaintext, encrypted []byte, err error)
+	// DecryptDataKey расшифровывает ключ данных из заголовка файла
+	DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error)
+}
+
+// AESKeyProvider шифрует ключи данных локальным мастер-ключом AES-256-GCM
+type AESKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// NewAESKeyProvider создает провайдер ключей с мастер-ключом длиной 32 байта
+func NewAESKeyProvider(key []byte) (*AESKeyProvider, error) {
+	if len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("ключ шифрования должен быть длиной %d байта, получено %d", encryptionKeySize, len(key))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &AESKeyProvider{aead: aead}, nil
+}
+
+// GenerateDataKey создает случайный ключ данных и шифрует его мастер-ключом
+func (p *AESKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	key := make([]byte, encryptionKeySize)
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, fmt.Errorf("ошибка генерации ключа данных: %w", err)
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("ошибка генерации ключа данных: %w", err)
+	}
+	return key, p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// DecryptDataKey расшифровывает ключ данных мастер-ключом
+func (p *AESKeyProvider) DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error) {
+	size := p.aead.NonceSize()
+	if len(encrypted) < size {
+		return nil, ErrEncryptedFileCorrupted
+	}
+	key, err := p.aead.Open(nil, encrypted[:size], encrypted[size:], nil)
+	if err != nil {
+		return nil, ErrEncryptedFileCorrupted
+	}
+	return key, nil
+}
+
+// kmsAPI методы AWS KMS, которые использует KMSKeyProvider
+type kmsAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMSKeyProvider получает ключи данных от AWS KMS. Мастер-ключ не покидает KMS,
+// для расшифровки файла ключ данных расшифровывается запросом к KMS.
+type KMSKeyProvider struct {
+	client kmsAPI
+	keyID  string
+}
+
+// NewKMSKeyProvider создает провайдер ключей AWS KMS. Регион и учетные данные
+// берутся из настроек S3, а если они не заданы - из окружения AWS. Запросы
+// к KMS повторяются по настройкам повторов хранилища.
+func NewKMSKeyProvider(ctx context.Context, cfg config.Storage) (*KMSKeyProvider, error) {
+	options := []func(*awsConfig.LoadOptions) error{
+		awsConfig.WithRegion(cfg.S3.Region),
+		awsConfig.WithRetryer(func() aws.Retryer { return newAWSRetryer(NewRetryPolicy(cfg.Retry)) }),
+	}
+	if cfg.S3.AccessKey != "" && cfg.S3.SecretKey != "" {
+		options = append(options, awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.S3.AccessKey, cfg.S3.SecretKey, ""),
+		))
+	}
+
+	awsCfg, err := awsConfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки AWS конфигурации: %w", err)
+	}
+
+	return &KMSKeyProvider{client: kms.NewFromConfig(awsCfg), keyID: cfg.Encryption.KMSKeyID}, nil
+}
+
+// GenerateDataKey запрашивает у KMS новый ключ данных AES-256
+func (p *KMSKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	result, err := p.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(p.keyID),
+		KeySpec: kmsTypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка получения ключа данных KMS: %w", err)
+	}
+	return result.Plaintext, result.CiphertextBlob, nil
+}
+
+// DecryptDataKey расшифровывает ключ данных в KMS
+func (p *KMSKeyProvider) DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error) {
+	result, err := p.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          aws.String(p.keyID),
+		CiphertextBlob: encrypted,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расшифровки ключа данных KMS: %w", err)
+	}
+	return result.Plaintext, nil
+}
+
+// NewKeyProviderFromConfig создает провайдер ключей по настройкам шифрования.
+// Для типа none возвращается nil.
+func NewKeyProviderFromConfig(ctx context.Context, cfg config.Storage) (KeyProvider, error) {
+	switch cfg.Encryption.Type {
+	case "", EncryptionTypeNone:
+		return nil, nil
+	case EncryptionTypeAES:
+		key, err := base64.StdEncoding.DecodeString(cfg.Encryption.Key)
+		if err != nil {
+			return nil, fmt.Errorf("ключ шифрования должен быть в base64: %w", err)
+		}
+		return NewAESKeyProvider(key)
+	case EncryptionTypeKMS:
+		return NewKMSKeyProvider(ctx, cfg)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип шифрования: %s", cfg.Encryption.Type)
+	}
+}
+
+// EncryptionMiddleware шифрует файлы при сохранении и расшифровывает при получении.
+// Файл шифруется AES-256-GCM блоками по 64 КБ, поэтому не загружается в память целиком.
+// Файлы без заголовка шифрования, сохраненные до его включения, отдаются как есть.
+// Прямые ссылки хранилища отдали бы зашифрованный файл, поэтому вместо них выдаются
+// подписанные ссылки сервиса, если задан signer.
+type EncryptionMiddleware struct {
+	storage Storage
+	keys    KeyProvider
+	signer  *URLSigner
+	logger  logging.Logger
+}
+
+// NewEncryptionMiddleware создает encryption middleware
+func NewEncryptionMiddleware(storage Storage, keys KeyProvider, signer *URLSigner, logger logging.Logger) Storage {
+	return &EncryptionMiddleware{
+		storage: storage,
+		keys:    keys,
+		signer:  signer,
+		logger:  logger,
+	}
+}
+
+// Save шифрует и сохраняет файл
+func (m *EncryptionMiddleware) Save(ctx context.Context, key string, reader io.Reader) error {
+	plaintextKey, encryptedKey, err := m.keys.GenerateDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	if len(encryptedKey) > 0xFFFF {
+		return fmt.Errorf("зашифрованный ключ данных слишком длинный: %d байт", len(encryptedKey))
+	}
+	aead, err := newAEAD(plaintextKey)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 0, len(encryptionMagic)+2+len(encryptedKey))
+	header = append(header, encryptionMagic...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(encryptedKey)))
+	header = append(header, encryptedKey...)
+
+	encrypted := &encryptingReader{source: bufio.NewReaderSize(reader, encryptionChunkSize), aead: aead}
+	return m.storage.Save(ctx, key, io.MultiReader(bytes.NewReader(header), encrypted))
+}
+
+// Get получает и расшифровывает файл
+func (m *EncryptionMiddleware) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := m.storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	source := bufio.NewReaderSize(file, encryptionChunkSize+aes.BlockSize)
+	encryptedKey, encrypted, err := readEncryptionHeader(source)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !encrypted {
+		logging.FromContext(ctx, m.logger).WithField("key", key).Debug("Файл сохранен без шифрования")
+		return readCloser{Reader: source, Closer: file}, nil
+	}
+
+	plaintextKey, err := m.keys.DecryptDataKey(ctx, encryptedKey)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	aead, err := newAEAD(plaintextKey)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return readCloser{Reader: &decryptingReader{source: source, aead: aead}, Closer: file}, nil
+}
+
+// GetRange получает часть расшифрованного файла. Зашифрованный файл расшифровывается
+// с начала, а содержимое до offset пропускается: передается только запрошенная часть.
+func (m *EncryptionMiddleware) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := m.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("ошибка пропуска начала файла: %w", err)
+	}
+	return limitReadCloser(reader, length), nil
+}
+
+// GetMetadata возвращает метаданные файла с размером расшифрованного содержимого
+func (m *EncryptionMiddleware) GetMetadata(ctx context.Context, key string) (*FileMetadata, error) {
+	metadata, err := m.storage.GetMetadata(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.Size, err = m.plaintextSize(ctx, key, metadata.Size); err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+// GetSize возвращает размер расшифрованного файла
+func (m *EncryptionMiddleware) GetSize(ctx context.Context, key string) (int64, error) {
+	size, err := m.storage.GetSize(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return m.plaintextSize(ctx, key, size)
+}
+
+// GetPresignedURL возвращает подписанную ссылку сервиса, который отдает файл расшифрованным
+func (m *EncryptionMiddleware) GetPresignedURL(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	if m.signer == nil {
+		return "", ErrEncryptedPresignedURL
+	}
+	return m.signer.Sign(key, expiration), nil
+}
+
+// GetURL возвращает ссылку хранилища на зашифрованный файл
+func (m *EncryptionMiddleware) GetURL(ctx context.Context, key string) (string, error) {
+	return m.storage.GetURL(ctx, key)
+}
+
+// Зашифрованные файлы копируются и перемещаются без расшифровки:
+// ключ данных хранится в заголовке файла
+func (m *EncryptionMiddleware) Delete(ctx context.Context, key string) error {
+	return m.storage.Delete(ctx, key)
+}
+
+func (m *EncryptionMiddleware) Exists(ctx context.Context, key string) (bool, error) {
+	return m.storage.Exists(ctx, key)
+}
+
+func (m *EncryptionMiddleware) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	return m.storage.List(ctx, prefix)
+}
+
+func (m *EncryptionMiddleware) Copy(ctx context.Context, srcKey, dstKey string) error {
+	return m.storage.Copy(ctx, srcKey, dstKey)
+}
+
+func (m *EncryptionMiddleware) Move(ctx context.Context, srcKey, dstKey string) error {
+	return m.storage.Move(ctx, srcKey, dstKey)
+}
+
+// Unwrap возвращает хранилище под middleware
+func (m *EncryptionMiddleware) Unwrap() Storage {
+	return m.storage
+}
+
+func (m *EncryptionMiddleware) JoinPath(elem ...string) string {
+	return m.storage.JoinPath(elem...)
+}
+
+func (m *EncryptionMiddleware) ValidateKey(key string) error {
+	return m.storage.ValidateKey(key)
+}
+
+// plaintextSize вычисляет размер расшифрованного файла по размеру в хранилище и заголовку файла
+func (m *EncryptionMiddleware) plaintextSize(ctx context.Context, key string, size int64) (int64, error) {
+	file, err := m.storage.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	source := bufio.NewReader(file)
+	encryptedKey, encrypted, err := readEncryptionHeader(source)
+	if err != nil || !encrypted {
+		return size, err
+	}
+
+	// Каждый блок, включая последний, дополнен тегом аутентификации
+	size -= int64(len(encryptionMagic) + 2 + len(encryptedKey))
+	chunk := int64(encryptionChunkSize + aes.BlockSize)
+	chunks := (size + chunk - 1) / chunk
+	return size - chunks*aes.BlockSize, nil
+}
+
+// readEncryptionHeader читает заголовок зашифрованного файла. Для файла без заголовка
+// возвращается encrypted == false, прочитанные байты остаются в source.
+func readEncryptionHeader(source *bufio.Reader) (encryptedKey []byte, encrypted bool, err error) {
+	magic, err := source.Peek(len(encryptionMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+	if !bytes.Equal(magic, encryptionMagic) {
+		return nil, false, nil
+	}
+
+	header := make([]byte, len(encryptionMagic)+2)
+	if _, err := io.ReadFull(source, header); err != nil {
+		return nil, false, ErrEncryptedFileCorrupted
+	}
+	encryptedKey = make([]byte, binary.BigEndian.Uint16(header[len(encryptionMagic):]))
+	if _, err := io.ReadFull(source, encryptedKey); err != nil {
+		return nil, false, ErrEncryptedFileCorrupted
+	}
+	return encryptedKey, true, nil
+}
+
+// newAEAD создает шифр AES-256-GCM
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания шифра: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce возвращает nonce блока файла: номер блока и признак последнего блока.
+// Признак не дает незаметно обрезать файл по границе блока.
+func chunkNonce(size int, counter uint64, last bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if last {
+		nonce[size-1] = 1
+	}
+	return nonce
+}
+
+// encryptingReader шифрует поток блоками по encryptionChunkSize байт
+type encryptingReader struct {
+	source  *bufio.Reader
+	aead    cipher.AEAD
+	counter uint64
+	pending []byte
+	done    bool
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		chunk := make([]byte, encryptionChunkSize)
+		n, err := io.ReadFull(r.source, chunk)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		// Последний блок определяется по концу потока, пустой файл - один пустой блок
+		last := err != nil
+		if !last {
+			if _, peekErr := r.source.Peek(1); errors.Is(peekErr, io.EOF) {
+				last = true
+			} else if peekErr != nil {
+				return 0, peekErr
+			}
+		}
+
+		r.pending = r.aead.Seal(nil, chunkNonce(r.aead.NonceSize(), r.counter, last), chunk[:n], nil)
+		r.counter++
+		r.done = last
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// decryptingReader расшифровывает поток, записанный encryptingReader
+type decryptingReader struct {
+	source  *bufio.Reader
+	aead    cipher.AEAD
+	counter uint64
+	pending []byte
+	done    bool
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		chunk := make([]byte, encryptionChunkSize+r.aead.Overhead())
+		n, err := io.ReadFull(r.source, chunk)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			if _, peekErr := r.source.Peek(1); errors.Is(peekErr, io.EOF) {
+				last = true
+			} else if peekErr != nil {
+				return 0, peekErr
+			}
+		}
+
+		plaintext, openErr := r.aead.Open(nil, chunkNonce(r.aead.NonceSize(), r.counter, last), chunk[:n], nil)
+		if openErr != nil {
+			return 0, ErrEncryptedFileCorrupted
+		}
+		r.pending = plaintext
+		r.counter++
+		r.done = last
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// readCloser объединяет reader содержимого с закрытием файла хранилища
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEncryptedStorage(t *testing.T) (Storage, Storage, string) {
+	logger := logging.Nop()
+
+	basePath := t.TempDir()
+	local, err := NewLocalStorage(LocalConfig{BasePath: basePath, Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+
+	keys, err := NewAESKeyProvider(bytes.Repeat([]byte{7}, encryptionKeySize))
+	require.NoError(t, err)
+
+	signer := NewURLSigner([]byte("secret"), "http://localhost:8080/api/v1/files")
+	return NewEncryptionMiddleware(local, keys, signer, logger), local, basePath
+}
+
+func TestEncryptionMiddlewareRoundTrip(t *testing.T) {
+	encrypted, local, basePath := newTestEncryptedStorage(t)
+	ctx := context.Background()
+
+	// Пустой файл, неполный блок и файл ровно из двух блоков
+	for _, size := range []int{0, 100, 2 * encryptionChunkSize} {
+		content := make([]byte, size)
+		_, err := rand.Read(content)
+		require.NoError(t, err)
+
+		key := "reports/data.csv"
+		require.NoError(t, encrypted.Save(ctx, key, bytes.NewReader(content)))
+
+		raw, err := os.ReadFile(filepath.Join(basePath, key))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(raw, encryptionMagic))
+		if size > 0 {
+			assert.False(t, bytes.Contains(raw, content[:min(size, 64)]))
+		}
+
+		reader, err := encrypted.Get(ctx, key)
+		require.NoError(t, err)
+		decrypted, err := io.ReadAll(reader)
+		require.NoError(t, reader.Close())
+		require.NoError(t, err)
+		assert.Equal(t, content, decrypted)
+
+		plainSize, err := encrypted.GetSize(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), plainSize)
+		storedSize, err := local.GetSize(ctx, key)
+		require.NoError(t, err)
+		assert.Greater(t, storedSize, plainSize)
+	}
+
+	// Ссылка на зашифрованный файл выдается сервисом
+	link, err := encrypted.GetPresignedURL(ctx, "reports/data.csv", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(link, "http://localhost:8080/api/v1/files/reports/data.csv?"))
+}
+
+func TestEncryptionMiddlewareDetectsTampering(t *testing.T) {
+	encrypted, _, basePath := newTestEncryptedStorage(t)
+	ctx := context.Background()
+
+	require.NoError(t, encrypted.Save(ctx, "report.csv", strings.NewReader("a;b\n1;2\n")))
+	path := filepath.Join(basePath, "report.csv")
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Измененный байт содержимого
+	tampered := bytes.Clone(raw)
+	tampered[len(tampered)-1] ^= 1
+	require.NoError(t, os.WriteFile(path, tampered, 0o644))
+	reader, err := encrypted.Get(ctx, "report.csv")
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	reader.Close()
+	assert.ErrorIs(t, err, ErrEncryptedFileCorrupted)
+
+	// Файл, зашифрованный другим мастер-ключом
+	other, err := NewAESKeyProvider(bytes.Repeat([]byte{8}, encryptionKeySize))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, raw, 0o644))
+	_, err = NewEncryptionMiddleware(encrypted.(*EncryptionMiddleware).storage, other, nil, logging.Nop()).Get(ctx, "report.csv")
+	assert.ErrorIs(t, err, ErrEncryptedFileCorrupted)
+}
+
+func TestEncryptionMiddlewareReadsPlainFiles(t *testing.T) {
+	encrypted, local, _ := newTestEncryptedStorage(t)
+	ctx := context.Background()
+
+	// Файл, сохраненный до включения шифрования
+	require.NoError(t, local.Save(ctx, "old.csv", strings.NewReader("a;b\n")))
+
+	reader, err := encrypted.Get(ctx, "old.csv")
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "a;b\n", string(content))
+
+	size, err := encrypted.GetSize(ctx, "old.csv")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+}
+
+func TestGetRange(t *testing.T) {
+	encrypted, local, _ := newTestEncryptedStorage(t)
+	ctx := context.Background()
+
+	content := make([]byte, 2*encryptionChunkSize+100)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, local.Save(ctx, "reports/plain.csv", bytes.NewReader(content)))
+	require.NoError(t, encrypted.Save(ctx, "reports/encrypted.csv", bytes.NewReader(content)))
+
+	// Часть внутри файла, через границу блоков шифрования и до конца файла
+	offset := int64(encryptionChunkSize - 10)
+	for _, key := range []string{"reports/plain.csv", "reports/encrypted.csv"} {
+		source := local
+		if key == "reports/encrypted.csv" {
+			source = encrypted
+		}
+
+		reader, err := source.GetRange(ctx, key, offset, 20)
+		require.NoError(t, err)
+		part, err := io.ReadAll(reader)
+		require.NoError(t, reader.Close())
+		require.NoError(t, err)
+		assert.Equal(t, content[offset:offset+20], part, key)
+
+		reader, err = source.GetRange(ctx, key, offset, -1)
+		require.NoError(t, err)
+		part, err = io.ReadAll(reader)
+		require.NoError(t, reader.Close())
+		require.NoError(t, err)
+		assert.Equal(t, content[offset:], part, key)
+	}
+}
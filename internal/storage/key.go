@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxKeyLength максимальная длина ключа файла в байтах, как у S3
+	MaxKeyLength = 1024
+	// MaxKeySegmentLength максимальная длина части ключа, полученной из произвольной строки
+	MaxKeySegmentLength = 64
+)
+
+// ErrInvalidKey ключ файла не прошел проверку
+var ErrInvalidKey = errors.New("недопустимый ключ файла")
+
+// ValidateObjectKey проверяет ключ файла: относительный путь из непустых частей через "/"
+// без "." и "..", управляющих символов и не длиннее MaxKeyLength. Такой ключ не выходит
+// за каталог локального хранилища и одинаково понимается S3.
+func ValidateObjectKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: ключ не может быть пустым", ErrInvalidKey)
+	}
+	if len(key) > MaxKeyLength {
+		return fmt.Errorf("%w: ключ слишком длинный: %d байт (максимум %d)", ErrInvalidKey, len(key), MaxKeyLength)
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("%w: ключ не в кодировке UTF-8", ErrInvalidKey)
+	}
+	if strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: ключ содержит управляющие символы", ErrInvalidKey)
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "":
+			return fmt.Errorf("%w: ключ %q содержит пустую часть пути", ErrInvalidKey, key)
+		case ".", "..":
+			return fmt.Errorf("%w: ключ %q не может содержать '%s'", ErrInvalidKey, key, segment)
+		}
+	}
+	return nil
+}
+
+// validateKeyPrefix проверяет префикс ключей для List: пустой префикс допустим,
+// как и префикс каталога с "/" на конце
+func validateKeyPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	return ValidateObjectKey(strings.TrimSuffix(prefix, "/"))
+}
+
+// cyrillicToLatin транслитерация строчных букв русского алфавита
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// KeySegment приводит произвольную строку, например название отчета, к части ключа файла:
+// строчная латиница и цифры через дефис, кириллица транслитерируется, остальные символы
+// заменяются дефисом. Результат не длиннее MaxKeySegmentLength и может быть пустым.
+func KeySegment(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		var part string
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			part = string(r)
+		default:
+			part = cyrillicToLatin[r]
+			if _, ok := cyrillicToLatin[r]; ok && part == "" {
+				continue
+			}
+		}
+
+		if part == "" {
+			dash = b.Len() > 0
+			continue
+		}
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		b.WriteString(part)
+		if b.Len() >= MaxKeySegmentLength {
+			break
+		}
+	}
+
+	segment := b.String()
+	if len(segment) > MaxKeySegmentLength {
+		segment = segment[:MaxKeySegmentLength]
+	}
+	return strings.TrimRight(segment, "-")
+}
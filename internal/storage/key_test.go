@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateObjectKey(t *testing.T) {
+	for _, key := range []string{"reports/1/sales_20250101120000.csv", "reports/2/Отчет продаж.xlsx", "a..b/c"} {
+		assert.NoError(t, ValidateObjectKey(key), key)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "reports/../../etc/passwd", "reports/./a.csv", "reports//a.csv",
+		"reports/a.csv/", "..", "reports/a\x00.csv", strings.Repeat("a", MaxKeyLength+1)} {
+		assert.ErrorIs(t, ValidateObjectKey(key), ErrInvalidKey, key)
+	}
+}
+
+func TestKeySegment(t *testing.T) {
+	assert.Equal(t, "otchet-prodazh-za-2025", KeySegment("Отчет продаж за 2025"))
+	assert.Equal(t, "etc-passwd", KeySegment("../../etc/passwd"))
+	assert.Equal(t, "q1-sales-report", KeySegment("  Q1 Sales / Report!  "))
+	assert.Equal(t, "", KeySegment("日本語"))
+
+	long := KeySegment(strings.Repeat("отчет ", 30))
+	assert.LessOrEqual(t, len(long), MaxKeySegmentLength)
+	assert.False(t, strings.HasSuffix(long, "-"))
+}
+
+func TestLocalStorageRejectsTraversal(t *testing.T) {
+	logger := logging.Nop()
+
+	root := t.TempDir()
+	basePath := filepath.Join(root, "files")
+	local, err := NewLocalStorage(LocalConfig{BasePath: basePath, Permissions: 0o755, CreateDirs: true}, logger)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0o644))
+
+	ctx := context.Background()
+	_, err = local.Get(ctx, "../secret.txt")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.ErrorIs(t, local.Save(ctx, "reports/../../secret.txt", strings.NewReader("x")), ErrInvalidKey)
+	assert.ErrorIs(t, local.Delete(ctx, "../secret.txt"), ErrInvalidKey)
+	assert.ErrorIs(t, local.Copy(ctx, "../secret.txt", "copy.txt"), ErrInvalidKey)
+
+	content, err := os.ReadFile(filepath.Join(root, "secret.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(content))
+
+	// Список файлов не выходит за базовый каталог
+	require.NoError(t, local.Save(ctx, "reports/1/a.csv", strings.NewReader("a")))
+	files, err := local.List(ctx, "")
+	require.NoError(t, err)
+	for _, file := range files {
+		assert.NotContains(t, file.Key, "..")
+		assert.NotEqual(t, "secret.txt", file.Key)
+	}
+	files, err = local.List(ctx, "reports/1/")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "reports/1/a.csv", files[0].Key)
+}
+
+func TestLocalStorageStopsOnCancel(t *testing.T) {
+	local, err := NewLocalStorage(LocalConfig{BasePath: t.TempDir(), Permissions: 0o755, CreateDirs: true}, logging.Nop())
+	require.NoError(t, err)
+
+	// Генерация отменяется, пока файл еще пишется
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := io.MultiReader(strings.NewReader("region;amount\n"), readerFunc(func(p []byte) (int, error) {
+		cancel()
+		return copy(p, "north;10\n"), nil
+	}), strings.NewReader(strings.Repeat("south;20\n", 1000)))
+
+	err = local.Save(ctx, "reports/1/a.csv", reader)
+	assert.ErrorIs(t, err, context.Canceled)
+	exists, err := local.Exists(context.Background(), "reports/1/a.csv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// Чтение файла прекращается после отмены контекста
+	require.NoError(t, local.Save(context.Background(), "reports/1/a.csv", strings.NewReader("region;amount\n")))
+	file, err := local.Get(ctx, "reports/1/a.csv")
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = io.ReadAll(file)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// readerFunc адаптирует функцию к io.Reader
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
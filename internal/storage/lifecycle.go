@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// StorageClass класс хранения объекта S3
+type StorageClass string
+
+const (
+	StorageClassStandard           StorageClass = "STANDARD"
+	StorageClassStandardIA         StorageClass = "STANDARD_IA"
+	StorageClassOneZoneIA          StorageClass = "ONEZONE_IA"
+	StorageClassGlacierIR          StorageClass = "GLACIER_IR"
+	StorageClassGlacier            StorageClass = "GLACIER"
+	StorageClassDeepArchive        StorageClass = "DEEP_ARCHIVE"
+	StorageClassIntelligentTiering StorageClass = "INTELLIGENT_TIERING"
+)
+
+// TransitionClasses классы, в которые можно перевести файлы отчетов
+var TransitionClasses = []StorageClass{
+	StorageClassStandardIA,
+	StorageClassOneZoneIA,
+	StorageClassIntelligentTiering,
+	StorageClassGlacierIR,
+	StorageClassGlacier,
+	StorageClassDeepArchive,
+}
+
+// RequiresRestore сообщает, нужно ли восстанавливать объект этого класса перед чтением
+func (c StorageClass) RequiresRestore() bool {
+	return c == StorageClassGlacier || c == StorageClassDeepArchive
+}
+
+// ArchiveState состояние файла в классе хранения
+type ArchiveState struct {
+	Class StorageClass
+	// Restoring восстановление из архива запрошено и еще не завершено
+	Restoring bool
+	// RestoredUntil время, до которого доступна восстановленная копия
+	RestoredUntil *time.Time
+}
+
+// Readable сообщает, можно ли прочитать файл сейчас
+func (s ArchiveState) Readable() bool {
+	return !s.Class.RequiresRestore() || (!s.Restoring && s.RestoredUntil != nil)
+}
+
+// TieredStorage хранилище с классами хранения: файлы можно перевести в более дешевый
+// класс, а из архивного класса перед чтением восстановить временную копию
+type TieredStorage interface {
+	// Transition переводит файл в класс хранения class
+	Transition(ctx context.Context, key string, class StorageClass) error
+	// ArchiveState возвращает класс хранения файла и состояние его восстановления
+	ArchiveState(ctx context.Context, key string) (*ArchiveState, error)
+	// Restore запрашивает восстановление архивного файла на days дней.
+	// Повторный запрос во время восстановления не ошибка.
+	Restore(ctx context.Context, key string, days int) error
+}
+
+// AsTiered находит под middleware хранилище с классами хранения
+func AsTiered(storage Storage) (TieredStorage, bool) {
+	for storage != nil {
+		if tiered, ok := storage.(TieredStorage); ok {
+			return tiered, true
+		}
+		wrapper, ok := storage.(interface{ Unwrap() Storage })
+		if !ok {
+			return nil, false
+		}
+		storage = wrapper.Unwrap()
+	}
+	return nil, false
+}
+
+// ObjectTags теги сохраняемого объекта
+type ObjectTags map[string]string
+
+// objectTagsContextKey ключ тегов объекта в контексте
+type objectTagsContextKey struct{}
+
+// WithObjectTags добавляет в контекст теги, которые хранилище присвоит сохраняемому
+// объекту вместе с тегами из настроек. Хранилища без тегов их игнорируют.
+func WithObjectTags(ctx context.Context, tags ObjectTags) context.Context {
+	return context.WithValue(ctx, objectTagsContextKey{}, tags)
+}
+
+// ObjectTagsFromContext возвращает теги объекта из контекста
+func ObjectTagsFromContext(ctx context.Context) ObjectTags {
+	tags, _ := ctx.Value(objectTagsContextKey{}).(ObjectTags)
+	return tags
+}
+
+// mergeTagging объединяет теги из настроек в формате запроса с тегами из контекста.
+// Теги контекста имеют приоритет, значения приводятся к допустимым в S3 символам.
+func mergeTagging(static string, tags ObjectTags) string {
+	if len(tags) == 0 {
+		return static
+	}
+
+	values, err := url.ParseQuery(static)
+	if err != nil {
+		values = url.Values{}
+	}
+	for key, value := range tags {
+		values.Set(tagValue(key, maxTagKeyLength), tagValue(value, maxTagValueLength))
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(key) + "=" + url.QueryEscape(values.Get(key)))
+	}
+	return b.String()
+}
+
+const (
+	// Ограничения длины тегов S3
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// tagValue заменяет символы, недопустимые в тегах S3, на "_" и обрезает значение до limit символов
+func tagValue(value string, limit int) string {
+	runes := []rune(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" +-=._:/@", r) {
+			return r
+		}
+		return '_'
+	}, value))
+	if len(runes) > limit {
+		runes = runes[:limit]
+	}
+	return string(runes)
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeTagging(t *testing.T) {
+	assert.Equal(t, "team=reports", mergeTagging("team=reports", nil))
+
+	tagging := mergeTagging("team=reports&tenant=static", ObjectTags{
+		"report_id": "42",
+		"tenant":    "Иван Петров",
+		"note":      "a&b=c;d",
+	})
+	assert.Equal(t, "note=a_b%3Dc_d&report_id=42&team=reports&tenant=%D0%98%D0%B2%D0%B0%D0%BD+%D0%9F%D0%B5%D1%82%D1%80%D0%BE%D0%B2", tagging)
+}
+
+func TestParseRestoreHeader(t *testing.T) {
+	state := parseRestoreHeader(`ongoing-request="true"`)
+	assert.True(t, state.Restoring)
+	assert.Nil(t, state.RestoredUntil)
+
+	state = parseRestoreHeader(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)
+	assert.False(t, state.Restoring)
+	require.NotNil(t, state.RestoredUntil)
+	assert.Equal(t, time.Date(2012, 12, 21, 0, 0, 0, 0, time.UTC), state.RestoredUntil.UTC())
+
+	state.Class = StorageClassGlacier
+	assert.True(t, state.Readable())
+	assert.False(t, ArchiveState{Class: StorageClassDeepArchive}.Readable())
+	assert.True(t, ArchiveState{Class: StorageClassStandardIA}.Readable())
+}
+
+func TestAsTieredUnwrapsMiddleware(t *testing.T) {
+	logger := logging.Nop()
+
+	s3Storage := &S3Storage{}
+	wrapped := NewValidationMiddleware(NewLoggingMiddleware(s3Storage, logger), logger)
+	tiered, ok := AsTiered(wrapped)
+	require.True(t, ok)
+	assert.Same(t, s3Storage, tiered)
+
+	_, ok = AsTiered(&LocalStorage{})
+	assert.False(t, ok)
+}
@@ -2,21 +2,35 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"report_srv/internal/breaker"
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/telemetry"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // LoggingMiddleware добавляет логирование к операциям хранилища
 type LoggingMiddleware struct {
 	storage Storage
-	logger  *logrus.Logger
+	logger  logging.Logger
 }
 
 // NewLoggingMiddleware создает новый logging middleware
-func NewLoggingMiddleware(storage Storage, logger *logrus.Logger) Storage {
+func NewLoggingMiddleware(storage Storage, logger logging.Logger) Storage {
 	return &LoggingMiddleware{
 		storage: storage,
 		logger:  logger,
@@ -26,7 +40,7 @@ func NewLoggingMiddleware(storage Storage, logger *logrus.Logger) Storage {
 // Save логирует операцию сохранения
 func (m *LoggingMiddleware) Save(ctx context.Context, key string, reader io.Reader) error {
 	start := time.Now()
-	logger := m.logger.WithFields(logrus.Fields{
+	logger := logging.FromContext(ctx, m.logger).WithFields(logging.Fields{
 		"operation": "save",
 		"key":       key,
 	})
@@ -48,7 +62,7 @@ func (m *LoggingMiddleware) Save(ctx context.Context, key string, reader io.Read
 // Get логирует операцию получения
 func (m *LoggingMiddleware) Get(ctx context.Context, key string) (io.ReadCloser, error) {
 	start := time.Now()
-	logger := m.logger.WithFields(logrus.Fields{
+	logger := logging.FromContext(ctx, m.logger).WithFields(logging.Fields{
 		"operation": "get",
 		"key":       key,
 	})
@@ -67,10 +81,34 @@ func (m *LoggingMiddleware) Get(ctx context.Context, key string) (io.ReadCloser,
 	return reader, err
 }
 
+// GetRange логирует операцию получения части файла
+func (m *LoggingMiddleware) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	start := time.Now()
+	logger := logging.FromContext(ctx, m.logger).WithFields(logging.Fields{
+		"operation": "get_range",
+		"key":       key,
+		"offset":    offset,
+		"length":    length,
+	})
+
+	logger.Debug("Начало получения части файла")
+
+	reader, err := m.storage.GetRange(ctx, key, offset, length)
+
+	duration := time.Since(start)
+	if err != nil {
+		logger.WithError(err).WithField("duration", duration).Error("Ошибка получения части файла")
+	} else {
+		logger.WithField("duration", duration).Info("Часть файла получена успешно")
+	}
+
+	return reader, err
+}
+
 // Delete логирует операцию удаления
 func (m *LoggingMiddleware) Delete(ctx context.Context, key string) error {
 	start := time.Now()
-	logger := m.logger.WithFields(logrus.Fields{
+	logger := logging.FromContext(ctx, m.logger).WithFields(logging.Fields{
 		"operation": "delete",
 		"key":       key,
 	})
@@ -122,6 +160,11 @@ func (m *LoggingMiddleware) Move(ctx context.Context, srcKey, dstKey string) err
 	return m.storage.Move(ctx, srcKey, dstKey)
 }
 
+// Unwrap возвращает хранилище под middleware
+func (m *LoggingMiddleware) Unwrap() Storage {
+	return m.storage
+}
+
 func (m *LoggingMiddleware) JoinPath(elem ...string) string {
 	return m.storage.JoinPath(elem...)
 }
@@ -130,27 +173,115 @@ func (m *LoggingMiddleware) ValidateKey(key string) error {
 	return m.storage.ValidateKey(key)
 }
 
-// RetryMiddleware добавляет retry логику к операциям хранилища
+// RetryPolicy настройки повторов операций хранилища
+type RetryPolicy struct {
+	// MaxRetries число повторов после первой попытки
+	MaxRetries int
+	// Delay задержка перед первым повтором, дальше она удваивается
+	Delay time.Duration
+	// MaxDelay ограничение задержки между повторами
+	MaxDelay time.Duration
+}
+
+// NewRetryPolicy создает политику повторов из конфигурации хранилища
+func NewRetryPolicy(cfg config.StorageRetry) RetryPolicy {
+	return RetryPolicy{MaxRetries: cfg.MaxRetries, Delay: cfg.Delay, MaxDelay: cfg.MaxDelay}
+}
+
+// BackoffDelay возвращает задержку перед повтором attempt (с 1): экспоненциальную,
+// ограниченную MaxDelay, со случайным разбросом в ее половину, чтобы экземпляры
+// сервиса не повторяли запросы одновременно. Подходит как retry.BackoffDelayer AWS SDK.
+func (p RetryPolicy) BackoffDelay(attempt int, _ error) (time.Duration, error) {
+	if p.Delay <= 0 {
+		return 0, nil
+	}
+
+	delay := p.MaxDelay
+	if shift := max(attempt-1, 0); shift < 32 {
+		if d := p.Delay << shift; d > 0 && d < p.MaxDelay {
+			delay = d
+		}
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1), nil
+}
+
+// IsRetryable сообщает, временная ли ошибка операции хранилища: сетевые ошибки,
+// ответы 5xx и ограничение частоты запросов повторяются, отсутствие файла,
+// отказ в доступе, ошибки 4xx и отмена контекста - нет
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrExist) ||
+		errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrInvalid) {
+		return false
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		_, throttled := retry.DefaultThrottleErrorCodes[code]
+		_, transient := retry.DefaultRetryableErrorCodes[code]
+		if throttled || transient {
+			return true
+		}
+	}
+
+	var responseErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &responseErr) {
+		status := responseErr.HTTPStatusCode()
+		return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+	}
+	if apiErr != nil {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EINTR)
+}
+
+// RetryMiddleware повторяет операции хранилища после временных ошибок
 type RetryMiddleware struct {
-	storage    Storage
-	maxRetries int
-	retryDelay time.Duration
-	logger     *logrus.Logger
+	storage Storage
+	policy  RetryPolicy
+	logger  logging.Logger
 }
 
 // NewRetryMiddleware создает новый retry middleware
-func NewRetryMiddleware(storage Storage, maxRetries int, retryDelay time.Duration, logger *logrus.Logger) Storage {
+func NewRetryMiddleware(storage Storage, policy RetryPolicy, logger logging.Logger) Storage {
 	return &RetryMiddleware{
-		storage:    storage,
-		maxRetries: maxRetries,
-		retryDelay: retryDelay,
-		logger:     logger,
+		storage: storage,
+		policy:  policy,
+		logger:  logger,
 	}
 }
 
-// Save выполняет операцию сохранения с retry
+// Save выполняет операцию сохранения с retry. Повторить можно только содержимое,
+// которое читается заново, поэтому остальные потоки сохраняются одной попыткой.
 func (m *RetryMiddleware) Save(ctx context.Context, key string, reader io.Reader) error {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return m.storage.Save(ctx, key, reader)
+	}
+
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return m.storage.Save(ctx, key, reader)
+	}
+	attempt := 0
 	return m.retryOperation(ctx, "save", func() error {
+		if attempt++; attempt > 1 {
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return fmt.Errorf("ошибка возврата к началу содержимого файла: %w", err)
+			}
+		}
 		return m.storage.Save(ctx, key, reader)
 	})
 }
@@ -166,6 +297,17 @@ func (m *RetryMiddleware) Get(ctx context.Context, key string) (io.ReadCloser, e
 	return result, err
 }
 
+// GetRange выполняет операцию получения части файла с retry
+func (m *RetryMiddleware) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	var result io.ReadCloser
+	err := m.retryOperation(ctx, "get_range", func() error {
+		var err error
+		result, err = m.storage.GetRange(ctx, key, offset, length)
+		return err
+	})
+	return result, err
+}
+
 // Delete выполняет операцию удаления с retry
 func (m *RetryMiddleware) Delete(ctx context.Context, key string) error {
 	return m.retryOperation(ctx, "delete", func() error {
@@ -173,44 +315,30 @@ func (m *RetryMiddleware) Delete(ctx context.Context, key string) error {
 	})
 }
 
-// retryOperation выполняет операцию с retry логикой
+// retryOperation выполняет операцию, повторяя ее после временных ошибок
 func (m *RetryMiddleware) retryOperation(ctx context.Context, operation string, fn func() error) error {
-	var lastErr error
-
-	for attempt := 0; attempt <= m.maxRetries; attempt++ {
-		lastErr = fn()
-		if lastErr == nil {
-			return nil
-		}
-
-		// Проверяем, стоит ли повторять операцию
-		if !m.shouldRetry(lastErr) {
-			break
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > m.policy.MaxRetries || !IsRetryable(err) {
+			return err
 		}
 
-		if attempt < m.maxRetries {
-			m.logger.WithFields(logrus.Fields{
-				"operation":   operation,
-				"attempt":     attempt + 1,
-				"max_retries": m.maxRetries,
-			}).WithError(lastErr).Warn("Повтор операции после ошибки")
-
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case <-time.After(m.retryDelay):
-				// Продолжаем
-			}
+		delay, _ := m.policy.BackoffDelay(attempt, err)
+		logging.FromContext(ctx, m.logger).WithFields(logging.Fields{
+			"operation":   operation,
+			"attempt":     attempt,
+			"max_retries": m.policy.MaxRetries,
+			"delay":       delay,
+		}).WithError(err).Warn("Повтор операции после ошибки")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
 		}
 	}
-
-	return lastErr
-}
-
-// shouldRetry определяет, стоит ли повторять операцию
-func (m *RetryMiddleware) shouldRetry(err error) bool {
-	// Здесь можно добавить логику для определения, какие ошибки стоит повторять
-	return true
 }
 
 func (m *RetryMiddleware) Exists(ctx context.Context, key string) (bool, error) {
@@ -245,6 +373,11 @@ func (m *RetryMiddleware) Move(ctx context.Context, srcKey, dstKey string) error
 	return m.storage.Move(ctx, srcKey, dstKey)
 }
 
+// Unwrap возвращает хранилище под middleware
+func (m *RetryMiddleware) Unwrap() Storage {
+	return m.storage
+}
+
 func (m *RetryMiddleware) JoinPath(elem ...string) string {
 	return m.storage.JoinPath(elem...)
 }
@@ -256,11 +389,11 @@ func (m *RetryMiddleware) ValidateKey(key string) error {
 // ValidationMiddleware добавляет валидацию к операциям хранилища
 type ValidationMiddleware struct {
 	storage Storage
-	logger  *logrus.Logger
+	logger  logging.Logger
 }
 
 // NewValidationMiddleware создает новый validation middleware
-func NewValidationMiddleware(storage Storage, logger *logrus.Logger) Storage {
+func NewValidationMiddleware(storage Storage, logger logging.Logger) Storage {
 	return &ValidationMiddleware{
 		storage: storage,
 		logger:  logger,
@@ -283,6 +416,17 @@ func (m *ValidationMiddleware) Get(ctx context.Context, key string) (io.ReadClos
 	return m.storage.Get(ctx, key)
 }
 
+// GetRange выполняет валидацию перед получением части файла
+func (m *ValidationMiddleware) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := m.validateKey(key); err != nil {
+		return nil, err
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("смещение не может быть отрицательным: %d", offset)
+	}
+	return m.storage.GetRange(ctx, key, offset, length)
+}
+
 // Delete выполняет валидацию перед удалением
 func (m *ValidationMiddleware) Delete(ctx context.Context, key string) error {
 	if err := m.validateKey(key); err != nil {
@@ -291,12 +435,9 @@ func (m *ValidationMiddleware) Delete(ctx context.Context, key string) error {
 	return m.storage.Delete(ctx, key)
 }
 
-// validateKey проверяет корректность ключа
+// validateKey проверяет ключ по правилам хранилища
 func (m *ValidationMiddleware) validateKey(key string) error {
-	if key == "" {
-		return fmt.Errorf("ключ файла не может быть пустым")
-	}
-	return nil
+	return m.storage.ValidateKey(key)
 }
 
 func (m *ValidationMiddleware) Exists(ctx context.Context, key string) (bool, error) {
@@ -335,6 +476,9 @@ func (m *ValidationMiddleware) GetPresignedURL(ctx context.Context, key string,
 }
 
 func (m *ValidationMiddleware) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	if err := validateKeyPrefix(prefix); err != nil {
+		return nil, err
+	}
 	return m.storage.List(ctx, prefix)
 }
 
@@ -358,6 +502,11 @@ func (m *ValidationMiddleware) Move(ctx context.Context, srcKey, dstKey string)
 	return m.storage.Move(ctx, srcKey, dstKey)
 }
 
+// Unwrap возвращает хранилище под middleware
+func (m *ValidationMiddleware) Unwrap() Storage {
+	return m.storage
+}
+
 func (m *ValidationMiddleware) JoinPath(elem ...string) string {
 	return m.storage.JoinPath(elem...)
 }
@@ -365,3 +514,248 @@ func (m *ValidationMiddleware) JoinPath(elem ...string) string {
 func (m *ValidationMiddleware) ValidateKey(key string) error {
 	return m.storage.ValidateKey(key)
 }
+
+// CircuitBreakerMiddleware пропускает операции хранилища через выключатель: после серии
+// временных ошибок операции сразу завершаются ошибкой breaker.ErrOpen, пока хранилище
+// не ответит на пробную операцию
+type CircuitBreakerMiddleware struct {
+	storage Storage
+	breaker *breaker.Breaker
+}
+
+// NewCircuitBreakerMiddleware создает circuit breaker middleware. Ошибкой недоступности
+// считаются только временные ошибки (IsRetryable).
+func NewCircuitBreakerMiddleware(storage Storage, cfg config.CircuitBreaker, logger logging.Logger) Storage {
+	return &CircuitBreakerMiddleware{
+		storage: storage,
+		breaker: breaker.New("storage", cfg, IsRetryable, logger),
+	}
+}
+
+func (m *CircuitBreakerMiddleware) Save(ctx context.Context, key string, reader io.Reader) error {
+	return m.breaker.Do(func() error {
+		return m.storage.Save(ctx, key, reader)
+	})
+}
+
+func (m *CircuitBreakerMiddleware) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := m.breaker.Do(func() error {
+		var err error
+		reader, err = m.storage.Get(ctx, key)
+		return err
+	})
+	return reader, err
+}
+
+func (m *CircuitBreakerMiddleware) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := m.breaker.Do(func() error {
+		var err error
+		reader, err = m.storage.GetRange(ctx, key, offset, length)
+		return err
+	})
+	return reader, err
+}
+
+func (m *CircuitBreakerMiddleware) Delete(ctx context.Context, key string) error {
+	return m.breaker.Do(func() error {
+		return m.storage.Delete(ctx, key)
+	})
+}
+
+func (m *CircuitBreakerMiddleware) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := m.breaker.Do(func() error {
+		var err error
+		exists, err = m.storage.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+func (m *CircuitBreakerMiddleware) GetMetadata(ctx context.Context, key string) (*FileMetadata, error) {
+	var metadata *FileMetadata
+	err := m.breaker.Do(func() error {
+		var err error
+		metadata, err = m.storage.GetMetadata(ctx, key)
+		return err
+	})
+	return metadata, err
+}
+
+func (m *CircuitBreakerMiddleware) GetSize(ctx context.Context, key string) (int64, error) {
+	var size int64
+	err := m.breaker.Do(func() error {
+		var err error
+		size, err = m.storage.GetSize(ctx, key)
+		return err
+	})
+	return size, err
+}
+
+func (m *CircuitBreakerMiddleware) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	err := m.breaker.Do(func() error {
+		var err error
+		files, err = m.storage.List(ctx, prefix)
+		return err
+	})
+	return files, err
+}
+
+func (m *CircuitBreakerMiddleware) Copy(ctx context.Context, srcKey, dstKey string) error {
+	return m.breaker.Do(func() error {
+		return m.storage.Copy(ctx, srcKey, dstKey)
+	})
+}
+
+func (m *CircuitBreakerMiddleware) Move(ctx context.Context, srcKey, dstKey string) error {
+	return m.breaker.Do(func() error {
+		return m.storage.Move(ctx, srcKey, dstKey)
+	})
+}
+
+// Ссылки на файлы строятся без обращения к хранилищу и не проходят через выключатель
+func (m *CircuitBreakerMiddleware) GetURL(ctx context.Context, key string) (string, error) {
+	return m.storage.GetURL(ctx, key)
+}
+
+func (m *CircuitBreakerMiddleware) GetPresignedURL(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return m.storage.GetPresignedURL(ctx, key, expiration)
+}
+
+// Unwrap возвращает хранилище под middleware
+func (m *CircuitBreakerMiddleware) Unwrap() Storage {
+	return m.storage
+}
+
+func (m *CircuitBreakerMiddleware) JoinPath(elem ...string) string {
+	return m.storage.JoinPath(elem...)
+}
+
+func (m *CircuitBreakerMiddleware) ValidateKey(key string) error {
+	return m.storage.ValidateKey(key)
+}
+
+// TracingMiddleware создает спаны OpenTelemetry для операций хранилища
+type TracingMiddleware struct {
+	storage Storage
+	tracer  trace.Tracer
+}
+
+// NewTracingMiddleware создает новый tracing middleware
+func NewTracingMiddleware(storage Storage) Storage {
+	return &TracingMiddleware{
+		storage: storage,
+		tracer:  telemetry.Tracer("storage"),
+	}
+}
+
+// traceOperation выполняет операцию внутри спана
+func (m *TracingMiddleware) traceOperation(ctx context.Context, operation, key string, fn func(ctx context.Context) error) error {
+	ctx, span := m.tracer.Start(ctx, "storage."+operation, trace.WithAttributes(
+		attribute.String("storage.operation", operation),
+		attribute.String("storage.key", key),
+	))
+	defer span.End()
+
+	err := fn(ctx)
+	telemetry.RecordError(span, err)
+	return err
+}
+
+// Save трассирует операцию сохранения
+func (m *TracingMiddleware) Save(ctx context.Context, key string, reader io.Reader) error {
+	return m.traceOperation(ctx, "save", key, func(ctx context.Context) error {
+		return m.storage.Save(ctx, key, reader)
+	})
+}
+
+// Get трассирует операцию получения
+func (m *TracingMiddleware) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := m.traceOperation(ctx, "get", key, func(ctx context.Context) error {
+		var err error
+		reader, err = m.storage.Get(ctx, key)
+		return err
+	})
+	return reader, err
+}
+
+// GetRange трассирует операцию получения части файла
+func (m *TracingMiddleware) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := m.traceOperation(ctx, "get_range", key, func(ctx context.Context) error {
+		var err error
+		reader, err = m.storage.GetRange(ctx, key, offset, length)
+		return err
+	})
+	return reader, err
+}
+
+// Delete трассирует операцию удаления
+func (m *TracingMiddleware) Delete(ctx context.Context, key string) error {
+	return m.traceOperation(ctx, "delete", key, func(ctx context.Context) error {
+		return m.storage.Delete(ctx, key)
+	})
+}
+
+// Exists трассирует проверку существования файла
+func (m *TracingMiddleware) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := m.traceOperation(ctx, "exists", key, func(ctx context.Context) error {
+		var err error
+		exists, err = m.storage.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+// Copy трассирует копирование файла
+func (m *TracingMiddleware) Copy(ctx context.Context, srcKey, dstKey string) error {
+	return m.traceOperation(ctx, "copy", srcKey, func(ctx context.Context) error {
+		return m.storage.Copy(ctx, srcKey, dstKey)
+	})
+}
+
+// Move трассирует перемещение файла
+func (m *TracingMiddleware) Move(ctx context.Context, srcKey, dstKey string) error {
+	return m.traceOperation(ctx, "move", srcKey, func(ctx context.Context) error {
+		return m.storage.Move(ctx, srcKey, dstKey)
+	})
+}
+
+// Остальные методы просто делегируют вызовы
+func (m *TracingMiddleware) GetMetadata(ctx context.Context, key string) (*FileMetadata, error) {
+	return m.storage.GetMetadata(ctx, key)
+}
+
+func (m *TracingMiddleware) GetSize(ctx context.Context, key string) (int64, error) {
+	return m.storage.GetSize(ctx, key)
+}
+
+func (m *TracingMiddleware) GetURL(ctx context.Context, key string) (string, error) {
+	return m.storage.GetURL(ctx, key)
+}
+
+func (m *TracingMiddleware) GetPresignedURL(ctx context.Context, key string, expiration time.Duration) (string, error) {
+	return m.storage.GetPresignedURL(ctx, key, expiration)
+}
+
+func (m *TracingMiddleware) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	return m.storage.List(ctx, prefix)
+}
+
+// Unwrap возвращает хранилище под middleware
+func (m *TracingMiddleware) Unwrap() Storage {
+	return m.storage
+}
+
+func (m *TracingMiddleware) JoinPath(elem ...string) string {
+	return m.storage.JoinPath(elem...)
+}
+
+func (m *TracingMiddleware) ValidateKey(key string) error {
+	return m.storage.ValidateKey(key)
+}
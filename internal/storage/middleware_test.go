@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"report_srv/internal/breaker"
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStorage возвращает заданные ошибки на первые вызовы Save и Get
+type flakyStorage struct {
+	Storage
+	errs  []error
+	calls int
+	saved []string
+}
+
+func (s *flakyStorage) next() error {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return s.errs[s.calls-1]
+	}
+	return nil
+}
+
+func (s *flakyStorage) Save(ctx context.Context, key string, reader io.Reader) error {
+	data, _ := io.ReadAll(reader)
+	s.saved = append(s.saved, string(data))
+	return s.next()
+}
+
+func (s *flakyStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := s.next(); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader("content")), nil
+}
+
+func newTestRetryStorage(errs ...error) (*flakyStorage, Storage) {
+	logger := logging.Nop()
+
+	flaky := &flakyStorage{errs: errs}
+	policy := RetryPolicy{MaxRetries: 2, Delay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	return flaky, NewRetryMiddleware(flaky, policy, logger)
+}
+
+func awsResponseError(status int, code string) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      &smithy.GenericAPIError{Code: code},
+	}}
+}
+
+func TestIsRetryable(t *testing.T) {
+	retryable := []error{
+		awsResponseError(http.StatusServiceUnavailable, "SlowDown"),
+		awsResponseError(http.StatusInternalServerError, "InternalError"),
+		awsResponseError(http.StatusTooManyRequests, "TooManyRequests"),
+		awsResponseError(http.StatusBadRequest, "Throttling"),
+		fmt.Errorf("ошибка сохранения: %w", syscall.ECONNRESET),
+		&os.PathError{Op: "write", Path: "report.csv", Err: syscall.EAGAIN},
+		io.ErrUnexpectedEOF,
+	}
+	for _, err := range retryable {
+		assert.True(t, IsRetryable(err), err.Error())
+	}
+
+	permanent := []error{
+		nil,
+		awsResponseError(http.StatusNotFound, "NoSuchKey"),
+		awsResponseError(http.StatusForbidden, "AccessDenied"),
+		&smithy.GenericAPIError{Code: "InvalidArgument"},
+		fmt.Errorf("файл не найден: %w", os.ErrNotExist),
+		context.Canceled,
+		errors.New("ключ файла не может быть пустым"),
+	}
+	for _, err := range permanent {
+		assert.False(t, IsRetryable(err), fmt.Sprint(err))
+	}
+}
+
+func TestRetryPolicyBackoffDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, Delay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second, 100: time.Second} {
+		for i := 0; i < 20; i++ {
+			delay, err := policy.BackoffDelay(attempt, nil)
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, delay, limit/2)
+			assert.LessOrEqual(t, delay, limit)
+		}
+	}
+}
+
+func TestRetryMiddlewareRetriesTransientErrors(t *testing.T) {
+	ctx := context.Background()
+
+	flaky, storage := newTestRetryStorage(syscall.ECONNRESET, awsResponseError(http.StatusServiceUnavailable, "SlowDown"))
+	reader, err := storage.Get(ctx, "report.csv")
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, 3, flaky.calls)
+
+	// Ошибки после всех повторов возвращаются вызывающему
+	flaky, storage = newTestRetryStorage(syscall.ECONNRESET, syscall.ECONNRESET, syscall.ECONNRESET)
+	_, err = storage.Get(ctx, "report.csv")
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 3, flaky.calls)
+
+	// Постоянные ошибки не повторяются
+	flaky, storage = newTestRetryStorage(awsResponseError(http.StatusNotFound, "NoSuchKey"))
+	_, err = storage.Get(ctx, "report.csv")
+	assert.Error(t, err)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestRetryMiddlewareSaveRewindsContent(t *testing.T) {
+	ctx := context.Background()
+
+	flaky, storage := newTestRetryStorage(syscall.ECONNRESET)
+	require.NoError(t, storage.Save(ctx, "report.csv", bytes.NewReader([]byte("a,b\n1,2\n"))))
+	assert.Equal(t, []string{"a,b\n1,2\n", "a,b\n1,2\n"}, flaky.saved)
+
+	// Поток, который нельзя прочитать заново, сохраняется одной попыткой
+	flaky, storage = newTestRetryStorage(syscall.ECONNRESET)
+	err := storage.Save(ctx, "report.csv", io.MultiReader(strings.NewReader("a,b\n")))
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestCircuitBreakerMiddlewareOpensAfterTransientErrors(t *testing.T) {
+	ctx := context.Background()
+	flaky := &flakyStorage{errs: []error{
+		awsResponseError(http.StatusNotFound, "NoSuchKey"),
+		syscall.ECONNREFUSED,
+		syscall.ECONNREFUSED,
+	}}
+	storage := NewCircuitBreakerMiddleware(flaky, config.CircuitBreaker{
+		Enabled:          true,
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+	}, logging.Nop())
+
+	// Отсутствие файла не говорит о недоступности хранилища
+	for range 3 {
+		_, err := storage.Get(ctx, "report.csv")
+		assert.Error(t, err)
+	}
+
+	// После порога операции отклоняются без обращения к хранилищу
+	_, err := storage.Get(ctx, "report.csv")
+	var openErr *breaker.OpenError
+	require.ErrorAs(t, err, &openErr)
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Equal(t, "storage", openErr.Name)
+	assert.Equal(t, 3, flaky.calls)
+
+	// Пробная операция после open_timeout замыкает выключатель
+	time.Sleep(25 * time.Millisecond)
+	reader, err := storage.Get(ctx, "report.csv")
+	require.NoError(t, err)
+	reader.Close()
+	_, err = storage.Get(ctx, "report.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, flaky.calls)
+}
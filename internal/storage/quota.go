@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"report_srv/internal/logging"
+	"report_srv/internal/telemetry"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// QuotaPolicyEvict при превышении квоты удаляются давно не использованные файлы
+	QuotaPolicyEvict = "evict"
+	// QuotaPolicyReject при превышении квоты сохранение файла отклоняется
+	QuotaPolicyReject = "reject"
+)
+
+// QuotaExceededError файл не помещается в квоту диска локального хранилища
+type QuotaExceededError struct {
+	Key   string
+	Used  int64
+	Limit int64
+}
+
+// Error возвращает описание ошибки
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("превышена квота диска хранилища: файл %s не помещается, занято %d из %d байт", e.Key, e.Used, e.Limit)
+}
+
+// quotaFile файл, учтенный в квоте
+type quotaFile struct {
+	key  string
+	size int64
+}
+
+// diskQuota учитывает место, занятое файлами локального хранилища. Место резервируется
+// по мере записи, поэтому квота соблюдается и для потоков неизвестного размера.
+// Файлы упорядочены по последнему использованию: в начале списка самые свежие.
+type diskQuota struct {
+	basePath string
+	limit    int64
+	policy   string
+	logger   logging.Logger
+
+	mu    sync.Mutex
+	used  int64
+	lru   *list.List
+	files map[string]*list.Element
+}
+
+// newDiskQuota создает квоту и учитывает файлы, уже лежащие в basePath.
+// Порядок использования восстанавливается по времени изменения файлов.
+func newDiskQuota(basePath string, limit int64, policy string, logger logging.Logger) (*diskQuota, error) {
+	if policy == "" {
+		policy = QuotaPolicyEvict
+	}
+	if policy != QuotaPolicyEvict && policy != QuotaPolicyReject {
+		return nil, fmt.Errorf("политика квоты должна быть '%s' или '%s', получено: %s", QuotaPolicyEvict, QuotaPolicyReject, policy)
+	}
+
+	type existing struct {
+		quotaFile
+		modTime time.Time
+	}
+	var found []existing
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(basePath, path)
+		if err != nil {
+			return err
+		}
+		found = append(found, existing{quotaFile{key: filepath.ToSlash(key), size: info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подсчета занятого места: %w", err)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.After(found[j].modTime) })
+
+	q := &diskQuota{
+		basePath: basePath,
+		limit:    limit,
+		policy:   policy,
+		logger:   logger,
+		lru:      list.New(),
+		files:    make(map[string]*list.Element, len(found)),
+	}
+	for _, file := range found {
+		q.files[file.key] = q.lru.PushBack(&quotaFile{key: file.key, size: file.size})
+		q.used += file.size
+	}
+
+	if err := q.registerMetrics(); err != nil {
+		logger.WithError(err).Warn("Не удалось зарегистрировать метрики квоты хранилища")
+	}
+	logger.WithFields(logging.Fields{
+		"used":   q.used,
+		"limit":  limit,
+		"files":  len(found),
+		"policy": policy,
+	}).Info("Квота диска хранилища включена")
+	return q, nil
+}
+
+// registerMetrics регистрирует метрики занятого места и квоты
+func (q *diskQuota) registerMetrics() error {
+	meter := telemetry.Meter("storage")
+	usage, err := meter.Int64ObservableGauge("storage.local.usage",
+		metric.WithUnit("By"), metric.WithDescription("Место, занятое файлами локального хранилища"))
+	if err != nil {
+		return err
+	}
+	limit, err := meter.Int64ObservableGauge("storage.local.limit",
+		metric.WithUnit("By"), metric.WithDescription("Квота диска локального хранилища"))
+	if err != nil {
+		return err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(usage, q.Used())
+		o.ObserveInt64(limit, q.limit)
+		return nil
+	}, usage, limit)
+	return err
+}
+
+// Used возвращает занятое место в байтах
+func (q *diskQuota) Used() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.used
+}
+
+// reader возвращает поток, резервирующий место под прочитанные из reader байты
+func (q *diskQuota) reader(key string, reader io.Reader) *quotaReader {
+	return &quotaReader{reader: reader, quota: q, key: key}
+}
+
+// reserve резервирует size байт под записываемый файл key. При политике evict
+// освобождает место, удаляя давно не использованные файлы.
+func (q *diskQuota) reserve(key string, size int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.used+size > q.limit && q.policy == QuotaPolicyEvict {
+		q.evict(q.used + size - q.limit)
+	}
+	if q.used+size > q.limit {
+		return &QuotaExceededError{Key: key, Used: q.used, Limit: q.limit}
+	}
+	q.used += size
+	return nil
+}
+
+// release возвращает место, зарезервированное под несохраненный файл
+func (q *diskQuota) release(size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.used -= size
+}
+
+// commit учитывает сохраненный файл как только что использованный
+func (q *diskQuota) commit(key string, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.files[key] = q.lru.PushFront(&quotaFile{key: key, size: size})
+}
+
+// touch отмечает файл как только что использованный
+func (q *diskQuota) touch(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if element, ok := q.files[key]; ok {
+		q.lru.MoveToFront(element)
+	}
+}
+
+// forget перестает учитывать удаленный или перезаписываемый файл
+func (q *diskQuota) forget(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.remove(key)
+}
+
+// rename учитывает перемещение файла под новый ключ
+func (q *diskQuota) rename(srcKey, dstKey string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	element, ok := q.files[srcKey]
+	if !ok {
+		return
+	}
+	q.remove(dstKey)
+	delete(q.files, srcKey)
+	file := element.Value.(*quotaFile)
+	file.key = dstKey
+	q.files[dstKey] = element
+	q.lru.MoveToFront(element)
+}
+
+// remove убирает файл из учета. Вызывается под блокировкой.
+func (q *diskQuota) remove(key string) {
+	element, ok := q.files[key]
+	if !ok {
+		return
+	}
+	q.used -= element.Value.(*quotaFile).size
+	q.lru.Remove(element)
+	delete(q.files, key)
+}
+
+// evict удаляет давно не использованные файлы, пока не освободится need байт.
+// Вызывается под блокировкой.
+func (q *diskQuota) evict(need int64) {
+	var freed int64
+	for freed < need {
+		element := q.lru.Back()
+		if element == nil {
+			return
+		}
+		file := element.Value.(*quotaFile)
+		if err := os.Remove(filepath.Join(q.basePath, file.key)); err != nil && !os.IsNotExist(err) {
+			q.logger.WithError(err).WithField("key", file.key).Error("Ошибка удаления файла при освобождении квоты")
+			return
+		}
+		q.remove(file.key)
+		freed += file.size
+
+		q.logger.WithFields(logging.Fields{
+			"key":  file.key,
+			"size": file.size,
+		}).Warn("Файл удален из хранилища для освобождения квоты диска")
+	}
+}
+
+// quotaReader резервирует место в квоте по мере чтения записываемого файла
+type quotaReader struct {
+	reader  io.Reader
+	quota   *diskQuota
+	key     string
+	written int64
+}
+
+// Read читает данные и резервирует под них место
+func (r *quotaReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if quotaErr := r.quota.reserve(r.key, int64(n)); quotaErr != nil {
+			return 0, quotaErr
+		}
+		r.written += int64(n)
+	}
+	return n, err
+}
+
+// finish учитывает сохраненный файл или освобождает место при ошибке записи
+func (r *quotaReader) finish(err error) {
+	if err != nil {
+		r.quota.release(r.written)
+		return
+	}
+	r.quota.commit(r.key, r.written)
+}
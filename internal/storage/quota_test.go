@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"report_srv/internal/logging"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQuotaStorage(t *testing.T, basePath string, maxBytes int64, policy string) *LocalStorage {
+	logger := logging.Nop()
+
+	local, err := NewLocalStorage(LocalConfig{BasePath: basePath, Permissions: 0o755, CreateDirs: true,
+		MaxBytes: maxBytes, QuotaPolicy: policy}, logger)
+	require.NoError(t, err)
+	return local
+}
+
+func TestLocalStorageQuotaEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	local := newTestQuotaStorage(t, basePath, 10, QuotaPolicyEvict)
+
+	require.NoError(t, local.Save(ctx, "reports/a.csv", strings.NewReader("aaaa")))
+	require.NoError(t, local.Save(ctx, "reports/b.csv", strings.NewReader("bbbb")))
+
+	// Скачивание делает a.csv свежее b.csv, поэтому удаляется b.csv
+	reader, err := local.Get(ctx, "reports/a.csv")
+	require.NoError(t, err)
+	reader.Close()
+
+	require.NoError(t, local.Save(ctx, "reports/c.csv", strings.NewReader("cccc")))
+	assert.Equal(t, int64(8), local.quota.Used())
+
+	for key, exists := range map[string]bool{"reports/a.csv": true, "reports/b.csv": false, "reports/c.csv": true} {
+		found, err := local.Exists(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, exists, found, key)
+	}
+
+	// Файл больше квоты не сохраняется даже после удаления остальных
+	err = local.Save(ctx, "reports/big.csv", strings.NewReader(strings.Repeat("x", 11)))
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, int64(10), quotaErr.Limit)
+	_, statErr := os.Stat(filepath.Join(basePath, "reports/big.csv"))
+	assert.True(t, os.IsNotExist(statErr))
+	assert.Equal(t, int64(0), local.quota.Used())
+}
+
+func TestLocalStorageQuotaRejects(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(basePath, "old.csv"), []byte("123456"), 0o644))
+
+	// Файлы, сохраненные до запуска, учитываются в квоте
+	local := newTestQuotaStorage(t, basePath, 10, QuotaPolicyReject)
+	assert.Equal(t, int64(6), local.quota.Used())
+
+	err := local.Save(ctx, "new.csv", strings.NewReader("12345"))
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, "new.csv", quotaErr.Key)
+
+	exists, err := local.Exists(ctx, "old.csv")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = local.Exists(ctx, "new.csv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// Перезапись и удаление освобождают место
+	require.NoError(t, local.Save(ctx, "old.csv", strings.NewReader("12")))
+	require.NoError(t, local.Save(ctx, "new.csv", strings.NewReader("12345")))
+	assert.Equal(t, int64(7), local.quota.Used())
+	require.NoError(t, local.Delete(ctx, "new.csv"))
+	assert.Equal(t, int64(2), local.quota.Used())
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
@@ -13,13 +16,16 @@ import (
 	"time"
 
 	"report_srv/internal/config"
+	"report_srv/internal/logging"
+	"report_srv/internal/telemetry"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/sirupsen/logrus"
+	"github.com/aws/smithy-go"
 )
 
 const (
@@ -33,8 +39,9 @@ const (
 	DefaultOperationTimeout = 30 * time.Second
 
 	// Настройки retry
-	DefaultMaxRetries = 3
-	DefaultRetryDelay = time.Second
+	DefaultMaxRetries    = 3
+	DefaultRetryDelay    = 200 * time.Millisecond
+	DefaultMaxRetryDelay = 5 * time.Second
 )
 
 // Storage интерфейс для работы с файловыми хранилищами
@@ -42,6 +49,8 @@ type Storage interface {
 	// Основные операции
 	Save(ctx context.Context, key string, reader io.Reader) error
 	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange получает length байт файла начиная с offset, length < 0 - до конца файла
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
 	Exists(ctx context.Context, key string) (bool, error)
 
@@ -86,6 +95,7 @@ type StorageConfig struct {
 	Type            string        `json:"type"`
 	MaxRetries      int           `json:"max_retries"`
 	RetryDelay      time.Duration `json:"retry_delay"`
+	MaxRetryDelay   time.Duration `json:"max_retry_delay"`
 	UploadTimeout   time.Duration `json:"upload_timeout"`
 	DownloadTimeout time.Duration `json:"download_timeout"`
 	EnableMetrics   bool          `json:"enable_metrics"`
@@ -103,6 +113,12 @@ type S3Config struct {
 	ForcePathStyle    bool          `json:"force_path_style"`
 	DisableSSL        bool          `json:"disable_ssl"`
 	PresignExpiration time.Duration `json:"presign_expiration"`
+	// ServerSideEncryption шифрование объектов на стороне S3: пусто, none, s3 или kms
+	ServerSideEncryption string `json:"server_side_encryption,omitempty"`
+	// SSEKMSKeyID ARN ключа KMS для SSE-KMS
+	SSEKMSKeyID string `json:"sse_kms_key_id,omitempty"`
+	// Tagging теги объектов в формате запроса key=value&key2=value2
+	Tagging string `json:"tagging,omitempty"`
 }
 
 // LocalConfig конфигурация локального хранилища
@@ -111,6 +127,12 @@ type LocalConfig struct {
 	BasePath    string      `json:"base_path"`
 	Permissions os.FileMode `json:"permissions"`
 	CreateDirs  bool        `json:"create_dirs"`
+	// Signer подписывает ссылки на файлы; без него возвращается file:// URL
+	Signer *URLSigner `json:"-"`
+	// MaxBytes квота диска: максимальный суммарный размер файлов, 0 - без ограничения
+	MaxBytes int64 `json:"max_bytes,omitempty"`
+	// QuotaPolicy поведение при превышении квоты: evict или reject
+	QuotaPolicy string `json:"quota_policy,omitempty"`
 }
 
 // StorageFactory фабрика для создания хранилищ
@@ -122,17 +144,24 @@ type StorageFactory interface {
 // StorageBuilder строитель для конфигурации хранилища
 type StorageBuilder struct {
 	config config.Config
-	logger *logrus.Logger
+	signer *URLSigner
+	logger logging.Logger
 }
 
 // NewStorageBuilder создает новый строитель хранилища
-func NewStorageBuilder(cfg config.Config, logger *logrus.Logger) *StorageBuilder {
+func NewStorageBuilder(cfg config.Config, logger logging.Logger) *StorageBuilder {
 	return &StorageBuilder{
 		config: cfg,
 		logger: logger,
 	}
 }
 
+// WithURLSigner устанавливает подписчик ссылок для локального хранилища
+func (b *StorageBuilder) WithURLSigner(signer *URLSigner) *StorageBuilder {
+	b.signer = signer
+	return b
+}
+
 // Build создает хранилище на основе конфигурации
 func (b *StorageBuilder) Build() (Storage, error) {
 	factory := NewDefaultStorageFactory(b.logger)
@@ -144,7 +173,8 @@ func (b *StorageBuilder) Build() (Storage, error) {
 		if err != nil {
 			return nil, fmt.Errorf("ошибка создания S3 хранилища: %w", err)
 		}
-		return b.wrapWithMiddleware(storage), nil
+		// Повторы S3 выполняет AWS SDK, поэтому RetryMiddleware не нужен
+		return b.wrap(storage, false)
 
 	case StorageTypeLocal:
 		localConfig := b.buildLocalConfig()
@@ -152,20 +182,35 @@ func (b *StorageBuilder) Build() (Storage, error) {
 		if err != nil {
 			return nil, fmt.Errorf("ошибка создания локального хранилища: %w", err)
 		}
-		return b.wrapWithMiddleware(storage), nil
+		return b.wrap(storage, true)
 
 	default:
 		return nil, fmt.Errorf("неподдерживаемый тип хранилища: %s", b.config.Storage.Type)
 	}
 }
 
+// wrap оборачивает хранилище шифрованием, если оно включено, и middleware.
+// Шифрование внутреннее, чтобы повторы и трассировка видели расшифрованное содержимое.
+// retry добавляет повторы для хранилищ без собственного механизма повторов.
+func (b *StorageBuilder) wrap(storage Storage, retry bool) (Storage, error) {
+	keys, err := NewKeyProviderFromConfig(context.Background(), b.config.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка настройки шифрования хранилища: %w", err)
+	}
+	if keys != nil {
+		storage = NewEncryptionMiddleware(storage, keys, b.signer, b.logger)
+	}
+	return b.wrapWithMiddleware(storage, retry), nil
+}
+
 // buildS3Config создает конфигурацию S3
 func (b *StorageBuilder) buildS3Config() S3Config {
 	return S3Config{
 		StorageConfig: StorageConfig{
 			Type:            StorageTypeS3,
-			MaxRetries:      DefaultMaxRetries,
-			RetryDelay:      DefaultRetryDelay,
+			MaxRetries:      b.config.Storage.Retry.MaxRetries,
+			RetryDelay:      b.config.Storage.Retry.Delay,
+			MaxRetryDelay:   b.config.Storage.Retry.MaxDelay,
 			UploadTimeout:   DefaultUploadTimeout,
 			DownloadTimeout: DefaultDownloadTimeout,
 			EnableMetrics:   true,
@@ -178,6 +223,10 @@ func (b *StorageBuilder) buildS3Config() S3Config {
 		SecretKey:         b.config.Storage.S3.SecretKey,
 		ForcePathStyle:    true,
 		PresignExpiration: 1 * time.Hour,
+
+		ServerSideEncryption: b.config.Storage.S3.SSE,
+		SSEKMSKeyID:          b.config.Storage.S3.SSEKMSKeyID,
+		Tagging:              b.config.Storage.S3.Tags,
 	}
 }
 
@@ -186,8 +235,9 @@ func (b *StorageBuilder) buildLocalConfig() LocalConfig {
 	return LocalConfig{
 		StorageConfig: StorageConfig{
 			Type:            StorageTypeLocal,
-			MaxRetries:      DefaultMaxRetries,
-			RetryDelay:      DefaultRetryDelay,
+			MaxRetries:      b.config.Storage.Retry.MaxRetries,
+			RetryDelay:      b.config.Storage.Retry.Delay,
+			MaxRetryDelay:   b.config.Storage.Retry.MaxDelay,
 			UploadTimeout:   DefaultUploadTimeout,
 			DownloadTimeout: DefaultDownloadTimeout,
 			EnableMetrics:   true,
@@ -196,32 +246,45 @@ func (b *StorageBuilder) buildLocalConfig() LocalConfig {
 		BasePath:    b.config.Storage.BasePath,
 		Permissions: 0755,
 		CreateDirs:  true,
+		Signer:      b.signer,
+		MaxBytes:    b.config.Storage.Quota.MaxBytes,
+		QuotaPolicy: b.config.Storage.Quota.Policy,
 	}
 }
 
 // wrapWithMiddleware оборачивает хранилище в middleware
-func (b *StorageBuilder) wrapWithMiddleware(storage Storage) Storage {
+func (b *StorageBuilder) wrapWithMiddleware(storage Storage, retry bool) Storage {
 	// Добавляем логирование
 	if b.logger != nil {
 		storage = NewLoggingMiddleware(storage, b.logger)
 	}
 
 	// Добавляем retry логику
-	storage = NewRetryMiddleware(storage, DefaultMaxRetries, DefaultRetryDelay, b.logger)
+	if retry && b.config.Storage.Retry.MaxRetries > 0 {
+		storage = NewRetryMiddleware(storage, NewRetryPolicy(b.config.Storage.Retry), b.logger)
+	}
+
+	// Выключатель снаружи повторов: его ошибкой считается операция, не удавшаяся после всех повторов
+	if b.config.Storage.CircuitBreaker.Enabled {
+		storage = NewCircuitBreakerMiddleware(storage, b.config.Storage.CircuitBreaker, b.logger)
+	}
 
 	// Добавляем валидацию
 	storage = NewValidationMiddleware(storage, b.logger)
 
+	// Трассировка снаружи, чтобы спан охватывал все повторы
+	storage = NewTracingMiddleware(storage)
+
 	return storage
 }
 
 // DefaultStorageFactory реализация фабрики хранилищ
 type DefaultStorageFactory struct {
-	logger *logrus.Logger
+	logger logging.Logger
 }
 
 // NewDefaultStorageFactory создает новую фабрику хранилищ
-func NewDefaultStorageFactory(logger *logrus.Logger) StorageFactory {
+func NewDefaultStorageFactory(logger logging.Logger) StorageFactory {
 	return &DefaultStorageFactory{logger: logger}
 }
 
@@ -247,11 +310,14 @@ type S3Storage struct {
 	client            *s3.Client
 	bucket            string
 	presignExpiration time.Duration
-	logger            *logrus.Logger
+	sse               types.ServerSideEncryption
+	sseKMSKeyID       string
+	tagging           string
+	logger            logging.Logger
 }
 
 // NewS3Storage создает новое S3 хранилище
-func NewS3Storage(cfg S3Config, logger *logrus.Logger) (*S3Storage, error) {
+func NewS3Storage(cfg S3Config, logger logging.Logger) (*S3Storage, error) {
 	if err := validateS3Config(cfg); err != nil {
 		return nil, fmt.Errorf("неверная конфигурация S3: %w", err)
 	}
@@ -263,6 +329,9 @@ func NewS3Storage(cfg S3Config, logger *logrus.Logger) (*S3Storage, error) {
 			cfg.SecretKey,
 			"",
 		)),
+		awsConfig.WithRetryer(func() aws.Retryer {
+			return newAWSRetryer(RetryPolicy{MaxRetries: cfg.MaxRetries, Delay: cfg.RetryDelay, MaxDelay: cfg.MaxRetryDelay})
+		}),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка загрузки AWS конфигурации: %w", err)
@@ -279,6 +348,9 @@ func NewS3Storage(cfg S3Config, logger *logrus.Logger) (*S3Storage, error) {
 		awsCfg.EndpointResolverWithOptions = customResolver
 	}
 
+	// Спаны для каждого вызова S3 API
+	awsCfg.APIOptions = append(awsCfg.APIOptions, telemetry.AWSMiddleware)
+
 	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
 		o.UsePathStyle = cfg.ForcePathStyle
 	})
@@ -287,17 +359,51 @@ func NewS3Storage(cfg S3Config, logger *logrus.Logger) (*S3Storage, error) {
 		client:            client,
 		bucket:            cfg.Bucket,
 		presignExpiration: cfg.PresignExpiration,
+		sse:               serverSideEncryption(cfg.ServerSideEncryption),
+		sseKMSKeyID:       cfg.SSEKMSKeyID,
+		tagging:           cfg.Tagging,
 		logger:            logger,
 	}, nil
 }
 
-// Save сохраняет файл в S3
-func (s *S3Storage) Save(ctx context.Context, key string, reader io.Reader) error {
-	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-		Body:   reader,
+// newAWSRetryer создает стандартный механизм повторов AWS SDK с настройками хранилища.
+// SDK сам отличает временные ошибки (сеть, 5xx, ограничение частоты) от остальных,
+// а задержку между попытками считает политика повторов хранилища.
+func newAWSRetryer(policy RetryPolicy) aws.Retryer {
+	if policy.MaxRetries <= 0 {
+		return aws.NopRetryer{}
+	}
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = policy.MaxRetries + 1
+		o.MaxBackoff = policy.MaxDelay
+		o.Backoff = policy
 	})
+}
+
+// Save сохраняет файл в S3. Тип и кодировка содержимого сохраняются в метаданных объекта,
+// чтобы файл по pre-signed URL отдавался с правильными заголовками.
+func (s *S3Storage) Save(ctx context.Context, key string, reader io.Reader) error {
+	contentType, contentEncoding := ContentHeaders(key)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        reader,
+		ContentType: aws.String(contentType),
+	}
+	if contentEncoding != "" {
+		input.ContentEncoding = aws.String(contentEncoding)
+	}
+	if s.sse != "" {
+		input.ServerSideEncryption = s.sse
+	}
+	if s.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.sseKMSKeyID)
+	}
+	if tagging := mergeTagging(s.tagging, ObjectTagsFromContext(ctx)); tagging != "" {
+		input.Tagging = aws.String(tagging)
+	}
+
+	_, err := s.client.PutObject(ctx, input)
 	if err != nil {
 		return fmt.Errorf("ошибка сохранения файла в S3: %w", err)
 	}
@@ -316,6 +422,19 @@ func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error)
 	return result.Body, nil
 }
 
+// GetRange получает часть файла из S3 запросом с заголовком Range
+func (s *S3Storage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(httpRange(offset, length)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения части файла из S3: %w", err)
+	}
+	return result.Body, nil
+}
+
 // Delete удаляет файл из S3
 func (s *S3Storage) Delete(ctx context.Context, key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -425,14 +544,27 @@ func (s *S3Storage) List(ctx context.Context, prefix string) ([]FileInfo, error)
 	return files, nil
 }
 
-// Copy копирует файл
+// Copy копирует файл. Шифрование и теги копии задаются настройками хранилища
+// и контекстом, а не берутся из исходного объекта.
 func (s *S3Storage) Copy(ctx context.Context, srcKey, dstKey string) error {
 	copySource := fmt.Sprintf("%s/%s", s.bucket, srcKey)
-	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+	input := &s3.CopyObjectInput{
 		Bucket:     aws.String(s.bucket),
 		Key:        aws.String(dstKey),
 		CopySource: aws.String(copySource),
-	})
+	}
+	if s.sse != "" {
+		input.ServerSideEncryption = s.sse
+	}
+	if s.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.sseKMSKeyID)
+	}
+	if tagging := mergeTagging(s.tagging, ObjectTagsFromContext(ctx)); tagging != "" {
+		input.Tagging = aws.String(tagging)
+		input.TaggingDirective = types.TaggingDirectiveReplace
+	}
+
+	_, err := s.client.CopyObject(ctx, input)
 	if err != nil {
 		return fmt.Errorf("ошибка копирования файла: %w", err)
 	}
@@ -447,6 +579,86 @@ func (s *S3Storage) Move(ctx context.Context, srcKey, dstKey string) error {
 	return s.Delete(ctx, srcKey)
 }
 
+// Transition переводит файл в класс хранения копированием объекта в себя.
+// Метаданные и теги объекта сохраняются.
+func (s *S3Storage) Transition(ctx context.Context, key string, class StorageClass) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(fmt.Sprintf("%s/%s", s.bucket, key)),
+		StorageClass:      types.StorageClass(class),
+		MetadataDirective: types.MetadataDirectiveCopy,
+		TaggingDirective:  types.TaggingDirectiveCopy,
+	}
+	if s.sse != "" {
+		input.ServerSideEncryption = s.sse
+	}
+	if s.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.sseKMSKeyID)
+	}
+
+	if _, err := s.client.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("ошибка перевода файла в класс хранения %s: %w", class, err)
+	}
+	return nil
+}
+
+// ArchiveState возвращает класс хранения файла и состояние восстановления из заголовка x-amz-restore
+func (s *S3Storage) ArchiveState(ctx context.Context, key string) (*ArchiveState, error) {
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения класса хранения файла: %w", err)
+	}
+
+	state := parseRestoreHeader(aws.ToString(result.Restore))
+	state.Class = StorageClass(result.StorageClass)
+	if state.Class == "" {
+		state.Class = StorageClassStandard
+	}
+	return state, nil
+}
+
+// Restore запрашивает временную копию архивного файла
+func (s *S3Storage) Restore(ctx context.Context, key string, days int) error {
+	_, err := s.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &types.RestoreRequest{
+			Days:                 aws.Int32(int32(days)),
+			GlacierJobParameters: &types.GlacierJobParameters{Tier: types.TierStandard},
+		},
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "RestoreAlreadyInProgress" {
+			return nil
+		}
+		return fmt.Errorf("ошибка запроса восстановления файла из архива: %w", err)
+	}
+	return nil
+}
+
+// parseRestoreHeader разбирает заголовок x-amz-restore вида
+// ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+func parseRestoreHeader(header string) *ArchiveState {
+	state := &ArchiveState{}
+	if header == "" {
+		return state
+	}
+
+	state.Restoring = strings.Contains(header, `ongoing-request="true"`)
+	if _, rest, found := strings.Cut(header, `expiry-date="`); found {
+		value, _, _ := strings.Cut(rest, `"`)
+		if expiry, err := time.Parse(http.TimeFormat, value); err == nil {
+			state.RestoredUntil = &expiry
+		}
+	}
+	return state
+}
+
 // JoinPath объединяет элементы пути
 func (s *S3Storage) JoinPath(elem ...string) string {
 	return path.Join(elem...)
@@ -454,13 +666,7 @@ func (s *S3Storage) JoinPath(elem ...string) string {
 
 // ValidateKey валидирует ключ файла
 func (s *S3Storage) ValidateKey(key string) error {
-	if key == "" {
-		return fmt.Errorf("ключ файла не может быть пустым")
-	}
-	if len(key) > 1024 {
-		return fmt.Errorf("ключ файла слишком длинный: %d символов (максимум 1024)", len(key))
-	}
-	return nil
+	return ValidateObjectKey(key)
 }
 
 // LocalStorage реализация локального файлового хранилища
@@ -468,11 +674,14 @@ type LocalStorage struct {
 	basePath    string
 	permissions os.FileMode
 	createDirs  bool
-	logger      *logrus.Logger
+	signer      *URLSigner
+	// quota квота диска, nil - без ограничения
+	quota  *diskQuota
+	logger logging.Logger
 }
 
 // NewLocalStorage создает новое локальное хранилище
-func NewLocalStorage(cfg LocalConfig, logger *logrus.Logger) (*LocalStorage, error) {
+func NewLocalStorage(cfg LocalConfig, logger logging.Logger) (*LocalStorage, error) {
 	if err := validateLocalConfig(cfg); err != nil {
 		return nil, fmt.Errorf("неверная конфигурация локального хранилища: %w", err)
 	}
@@ -484,17 +693,30 @@ func NewLocalStorage(cfg LocalConfig, logger *logrus.Logger) (*LocalStorage, err
 		}
 	}
 
+	var quota *diskQuota
+	if cfg.MaxBytes > 0 {
+		var err error
+		if quota, err = newDiskQuota(cfg.BasePath, cfg.MaxBytes, cfg.QuotaPolicy, logger); err != nil {
+			return nil, fmt.Errorf("ошибка настройки квоты диска: %w", err)
+		}
+	}
+
 	return &LocalStorage{
 		basePath:    cfg.BasePath,
 		permissions: cfg.Permissions,
 		createDirs:  cfg.CreateDirs,
+		signer:      cfg.Signer,
+		quota:       quota,
 		logger:      logger,
 	}, nil
 }
 
 // Save сохраняет файл локально
 func (l *LocalStorage) Save(ctx context.Context, key string, reader io.Reader) error {
-	fullPath := l.getFullPath(key)
+	fullPath, err := l.getFullPath(key)
+	if err != nil {
+		return err
+	}
 
 	// Создаем директорию если нужно
 	if l.createDirs {
@@ -510,17 +732,81 @@ func (l *LocalStorage) Save(ctx context.Context, key string, reader io.Reader) e
 	}
 	defer file.Close()
 
+	// Запись отмененной генерации прерывается, не дочитывая потоковый файл
+	reader = &contextReader{ctx: ctx, reader: reader}
+	if l.quota != nil {
+		return l.writeWithQuota(key, file, reader)
+	}
+
 	_, err = io.Copy(file, reader)
 	if err != nil {
+		os.Remove(fullPath)
 		return fmt.Errorf("ошибка записи файла: %w", err)
 	}
 
 	return nil
 }
 
+// contextReader прекращает чтение после отмены контекста
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// writeWithQuota записывает файл, резервируя под него место в квоте.
+// Файл, который не поместился или записался с ошибкой, удаляется.
+func (l *LocalStorage) writeWithQuota(key string, file *os.File, reader io.Reader) error {
+	// Прежнее содержимое файла уже обрезано при открытии
+	l.quota.forget(key)
+
+	counted := l.quota.reader(key, reader)
+	_, err := io.Copy(file, counted)
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	counted.finish(err)
+
+	if err != nil {
+		return fmt.Errorf("ошибка записи файла: %w", err)
+	}
+	return nil
+}
+
 // Get получает файл локально
 func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
-	fullPath := l.getFullPath(key)
+	file, err := l.open(key)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{Reader: &contextReader{ctx: ctx, reader: file}, Closer: file}, nil
+}
+
+// GetRange получает часть локального файла
+func (l *LocalStorage) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	file, err := l.open(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ошибка позиционирования в файле: %w", err)
+	}
+	return limitReadCloser(readCloser{Reader: &contextReader{ctx: ctx, reader: file}, Closer: file}, length), nil
+}
+
+// open открывает локальный файл для чтения и отмечает обращение к нему в квоте
+func (l *LocalStorage) open(key string) (*os.File, error) {
+	fullPath, err := l.getFullPath(key)
+	if err != nil {
+		return nil, err
+	}
 	file, err := os.Open(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -528,24 +814,34 @@ func (l *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, erro
 		}
 		return nil, fmt.Errorf("ошибка открытия файла: %w", err)
 	}
+	if l.quota != nil {
+		l.quota.touch(key)
+	}
 	return file, nil
 }
 
 // Delete удаляет файл локально
 func (l *LocalStorage) Delete(ctx context.Context, key string) error {
-	fullPath := l.getFullPath(key)
-	err := os.Remove(fullPath)
-	if err != nil && !os.IsNotExist(err) {
+	fullPath, err := l.getFullPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("ошибка удаления файла: %w", err)
 	}
+	if l.quota != nil {
+		l.quota.forget(key)
+	}
 	return nil
 }
 
 // Exists проверяет существование файла
 func (l *LocalStorage) Exists(ctx context.Context, key string) (bool, error) {
-	fullPath := l.getFullPath(key)
-	_, err := os.Stat(fullPath)
+	fullPath, err := l.getFullPath(key)
 	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(fullPath); err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
 		}
@@ -556,17 +852,21 @@ func (l *LocalStorage) Exists(ctx context.Context, key string) (bool, error) {
 
 // GetMetadata получает метаданные файла
 func (l *LocalStorage) GetMetadata(ctx context.Context, key string) (*FileMetadata, error) {
-	fullPath := l.getFullPath(key)
+	fullPath, err := l.getFullPath(key)
+	if err != nil {
+		return nil, err
+	}
 	info, err := os.Stat(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения информации о файле: %w", err)
 	}
 
+	contentType, _ := ContentHeaders(key)
 	return &FileMetadata{
 		Key:          key,
 		Size:         info.Size(),
 		LastModified: info.ModTime(),
-		ContentType:  "application/octet-stream", // базовый тип для локальных файлов
+		ContentType:  contentType,
 	}, nil
 }
 
@@ -581,34 +881,45 @@ func (l *LocalStorage) GetSize(ctx context.Context, key string) (int64, error) {
 
 // GetURL возвращает файловый URL
 func (l *LocalStorage) GetURL(ctx context.Context, key string) (string, error) {
-	fullPath := l.getFullPath(key)
+	fullPath, err := l.getFullPath(key)
+	if err != nil {
+		return "", err
+	}
 	return "file://" + fullPath, nil
 }
 
-// GetPresignedURL для локального хранилища возвращает обычный URL
+// GetPresignedURL возвращает подписанную ссылку на файл, отдаваемый сервисом.
+// Без подписчика возвращается обычный файловый URL.
 func (l *LocalStorage) GetPresignedURL(ctx context.Context, key string, expiration time.Duration) (string, error) {
-	return l.GetURL(ctx, key)
+	if l.signer == nil {
+		return l.GetURL(ctx, key)
+	}
+	return l.signer.Sign(key, expiration), nil
 }
 
 // List возвращает список файлов
 func (l *LocalStorage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
-	prefixPath := l.getFullPath(prefix)
-	baseDir := filepath.Dir(prefixPath)
+	if err := validateKeyPrefix(prefix); err != nil {
+		return nil, err
+	}
+	// Обходится каталог, в котором лежат ключи с префиксом
+	baseDir := filepath.Join(l.basePath, filepath.FromSlash(path.Dir(prefix)))
 
 	var files []FileInfo
-	err := filepath.WalkDir(baseDir, func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(baseDir, func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
 		// Получаем относительный путь
-		relPath, err := filepath.Rel(l.basePath, path)
+		relPath, err := filepath.Rel(l.basePath, filePath)
 		if err != nil {
 			return err
 		}
+		relPath = filepath.ToSlash(relPath)
 
-		// Проверяем префикс
-		if !strings.HasPrefix(relPath, prefix) {
+		// Проверяем префикс, сам базовый каталог в список не входит
+		if relPath == "." || !strings.HasPrefix(relPath, prefix) {
 			return nil
 		}
 
@@ -632,8 +943,14 @@ func (l *LocalStorage) List(ctx context.Context, prefix string) ([]FileInfo, err
 
 // Copy копирует файл
 func (l *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
-	srcPath := l.getFullPath(srcKey)
-	dstPath := l.getFullPath(dstKey)
+	srcPath, err := l.getFullPath(srcKey)
+	if err != nil {
+		return err
+	}
+	dstPath, err := l.getFullPath(dstKey)
+	if err != nil {
+		return err
+	}
 
 	// Создаем директорию назначения если нужно
 	if l.createDirs {
@@ -655,6 +972,10 @@ func (l *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
 	}
 	defer dst.Close()
 
+	if l.quota != nil {
+		return l.writeWithQuota(dstKey, dst, src)
+	}
+
 	_, err = io.Copy(dst, src)
 	if err != nil {
 		return fmt.Errorf("ошибка копирования файла: %w", err)
@@ -665,8 +986,14 @@ func (l *LocalStorage) Copy(ctx context.Context, srcKey, dstKey string) error {
 
 // Move перемещает файл
 func (l *LocalStorage) Move(ctx context.Context, srcKey, dstKey string) error {
-	srcPath := l.getFullPath(srcKey)
-	dstPath := l.getFullPath(dstKey)
+	srcPath, err := l.getFullPath(srcKey)
+	if err != nil {
+		return err
+	}
+	dstPath, err := l.getFullPath(dstKey)
+	if err != nil {
+		return err
+	}
 
 	// Создаем директорию назначения если нужно
 	if l.createDirs {
@@ -676,10 +1003,12 @@ func (l *LocalStorage) Move(ctx context.Context, srcKey, dstKey string) error {
 		}
 	}
 
-	err := os.Rename(srcPath, dstPath)
-	if err != nil {
+	if err := os.Rename(srcPath, dstPath); err != nil {
 		return fmt.Errorf("ошибка перемещения файла: %w", err)
 	}
+	if l.quota != nil {
+		l.quota.rename(srcKey, dstKey)
+	}
 
 	return nil
 }
@@ -691,23 +1020,70 @@ func (l *LocalStorage) JoinPath(elem ...string) string {
 
 // ValidateKey валидирует ключ файла
 func (l *LocalStorage) ValidateKey(key string) error {
-	if key == "" {
-		return fmt.Errorf("ключ файла не может быть пустым")
+	return ValidateObjectKey(key)
+}
+
+// getFullPath проверяет ключ и возвращает полный путь к файлу. Путь дополнительно
+// сверяется с базовым каталогом, чтобы ключ не мог указать на файл вне хранилища.
+func (l *LocalStorage) getFullPath(key string) (string, error) {
+	if err := ValidateObjectKey(key); err != nil {
+		return "", err
 	}
-	if strings.Contains(key, "..") {
-		return fmt.Errorf("ключ файла не может содержать '..'")
+
+	fullPath := filepath.Join(l.basePath, filepath.FromSlash(key))
+	relPath, err := filepath.Rel(l.basePath, fullPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: ключ %q указывает за пределы хранилища", ErrInvalidKey, key)
 	}
-	return nil
+	return fullPath, nil
 }
 
-// getFullPath возвращает полный путь к файлу
-func (l *LocalStorage) getFullPath(key string) string {
-	return filepath.Join(l.basePath, key)
+// ContentHeaders возвращает Content-Type и Content-Encoding файла по расширению ключа.
+// Файл .gz отдается с типом исходного файла и Content-Encoding: gzip.
+func ContentHeaders(key string) (contentType, contentEncoding string) {
+	if strings.HasSuffix(key, ".gz") {
+		key, contentEncoding = strings.TrimSuffix(key, ".gz"), "gzip"
+	}
+
+	contentType = mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return contentType, contentEncoding
 }
 
 // Функции валидации
 
 // validateS3Config валидирует конфигурацию S3
+// httpRange возвращает значение заголовка Range для length байт начиная с offset
+func httpRange(offset, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+// limitReadCloser ограничивает чтение из reader length байтами, length < 0 - без ограничения
+func limitReadCloser(reader io.ReadCloser, length int64) io.ReadCloser {
+	if length < 0 {
+		return reader
+	}
+	return readCloser{Reader: io.LimitReader(reader, length), Closer: reader}
+}
+
+// serverSideEncryption возвращает заголовок шифрования S3 по настройке sse,
+// пустой заголовок - шифрование по политике bucket
+func serverSideEncryption(sse string) types.ServerSideEncryption {
+	switch sse {
+	case "s3":
+		return types.ServerSideEncryptionAes256
+	case "kms":
+		return types.ServerSideEncryptionAwsKms
+	default:
+		return ""
+	}
+}
+
 func validateS3Config(cfg S3Config) error {
 	if cfg.Region == "" {
 		return fmt.Errorf("регион S3 не может быть пустым")
@@ -721,6 +1097,17 @@ func validateS3Config(cfg S3Config) error {
 	if cfg.SecretKey == "" {
 		return fmt.Errorf("secret key не может быть пустым")
 	}
+	switch cfg.ServerSideEncryption {
+	case "", "none", "s3", "kms":
+	default:
+		return fmt.Errorf("неподдерживаемое шифрование S3: %s", cfg.ServerSideEncryption)
+	}
+	if cfg.SSEKMSKeyID != "" && cfg.ServerSideEncryption != "kms" {
+		return fmt.Errorf("ключ KMS задается только для шифрования kms")
+	}
+	if _, err := url.ParseQuery(cfg.Tagging); err != nil {
+		return fmt.Errorf("неверный формат тегов объектов: %w", err)
+	}
 	if cfg.PresignExpiration <= 0 {
 		return fmt.Errorf("время истечения presigned URL должно быть положительным")
 	}
@@ -735,11 +1122,14 @@ func validateLocalConfig(cfg LocalConfig) error {
 	if !filepath.IsAbs(cfg.BasePath) {
 		return fmt.Errorf("базовый путь должен быть абсолютным")
 	}
+	if cfg.MaxBytes < 0 {
+		return fmt.Errorf("квота диска не может быть отрицательной")
+	}
 	return nil
 }
 
 // NewStorageFromConfig создает хранилище из конфигурации (обратная совместимость)
-func NewStorageFromConfig(cfg config.Config, logger *logrus.Logger) (Storage, error) {
-	builder := NewStorageBuilder(cfg, logger)
+func NewStorageFromConfig(cfg config.Config, signer *URLSigner, logger logging.Logger) (Storage, error) {
+	builder := NewStorageBuilder(cfg, logger).WithURLSigner(signer)
 	return builder.Build()
 }
@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3ServerSideEncryptionConfig(t *testing.T) {
+	assert.Equal(t, types.ServerSideEncryptionAes256, serverSideEncryption("s3"))
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, serverSideEncryption("kms"))
+	assert.Empty(t, serverSideEncryption("none"))
+
+	cfg := S3Config{Region: "us-east-1", Bucket: "reports", AccessKey: "key", SecretKey: "secret", PresignExpiration: time.Hour,
+		ServerSideEncryption: "kms", SSEKMSKeyID: "arn:aws:kms:us-east-1:111122223333:key/reports", Tagging: "team=reports&pii=true"}
+	assert.NoError(t, validateS3Config(cfg))
+
+	cfg.ServerSideEncryption = "s3"
+	assert.ErrorContains(t, validateS3Config(cfg), "ключ KMS")
+
+	cfg.ServerSideEncryption, cfg.SSEKMSKeyID = "aws:kms", ""
+	assert.ErrorContains(t, validateS3Config(cfg), "aws:kms")
+
+	cfg.ServerSideEncryption, cfg.Tagging = "", "pii=%zz"
+	assert.ErrorContains(t, validateS3Config(cfg), "тегов")
+}
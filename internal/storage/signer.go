@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+)
+
+const (
+	// Параметры подписанной ссылки
+	SignedURLExpiresParam   = "expires"
+	SignedURLSignatureParam = "signature"
+
+	// signingKeySize размер случайного ключа подписи
+	signingKeySize = 32
+)
+
+var (
+	// ErrInvalidSignature подпись ссылки не совпадает
+	ErrInvalidSignature = errors.New("неверная подпись ссылки")
+	// ErrSignedURLExpired срок действия ссылки истек
+	ErrSignedURLExpired = errors.New("срок действия ссылки истек")
+)
+
+// URLSigner подписывает ссылки на файлы хранилища с помощью HMAC-SHA256.
+// Используется для локального хранилища, у которого нет своих pre-signed URL.
+type URLSigner struct {
+	secret  []byte
+	baseURL string
+	now     func() time.Time
+}
+
+// NewURLSigner создает подписчик ссылок с базовым URL, по которому отдаются файлы
+func NewURLSigner(secret []byte, baseURL string) *URLSigner {
+	return &URLSigner{
+		secret:  secret,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		now:     time.Now,
+	}
+}
+
+// NewURLSignerFromConfig создает подписчик ссылок из конфигурации.
+// Если ключ не задан, генерируется случайный, и ссылки перестают
+// действовать после перезапуска сервиса.
+func NewURLSignerFromConfig(cfg config.Config, logger logging.Logger) (*URLSigner, error) {
+	secret := []byte(cfg.Storage.SigningKey)
+	if len(secret) == 0 {
+		secret = make([]byte, signingKeySize)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("ошибка генерации ключа подписи: %w", err)
+		}
+		logger.Warn("Ключ подписи ссылок не задан, используется случайный ключ")
+	}
+
+	return NewURLSigner(secret, cfg.Storage.PublicURL), nil
+}
+
+// Sign возвращает ссылку на файл, действительную в течение expiration
+func (s *URLSigner) Sign(key string, expiration time.Duration) string {
+	expires := strconv.FormatInt(s.now().Add(expiration).Unix(), 10)
+
+	query := url.Values{}
+	query.Set(SignedURLExpiresParam, expires)
+	query.Set(SignedURLSignatureParam, s.signature(key, expires))
+
+	return s.baseURL + "/" + escapeKey(key) + "?" + query.Encode()
+}
+
+// Verify проверяет подпись и срок действия ссылки
+func (s *URLSigner) Verify(key, expires, signature string) error {
+	expected := s.signature(key, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	deadline, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if s.now().Unix() > deadline {
+		return ErrSignedURLExpired
+	}
+
+	return nil
+}
+
+// signature вычисляет подпись ключа файла и времени истечения
+func (s *URLSigner) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte{0})
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// escapeKey экранирует сегменты ключа, сохраняя разделители пути
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
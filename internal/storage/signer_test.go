@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLSignerSignVerify(t *testing.T) {
+	signer := NewURLSigner([]byte("secret"), "http://localhost:8080/api/v1/files/")
+	now := time.Unix(1700000000, 0)
+	signer.now = func() time.Time { return now }
+
+	key := "reports/1/Отчет продаж.csv"
+	signed, err := url.Parse(signer.Sign(key, time.Minute))
+	require.NoError(t, err)
+
+	assert.Equal(t, "/api/v1/files/"+key, signed.Path)
+	assert.False(t, strings.Contains(signed.RawQuery, " "))
+
+	expires := signed.Query().Get(SignedURLExpiresParam)
+	signature := signed.Query().Get(SignedURLSignatureParam)
+
+	assert.NoError(t, signer.Verify(key, expires, signature))
+	assert.ErrorIs(t, signer.Verify("reports/2/other.csv", expires, signature), ErrInvalidSignature)
+	assert.ErrorIs(t, signer.Verify(key, "1800000000", signature), ErrInvalidSignature)
+
+	now = now.Add(2 * time.Minute)
+	assert.ErrorIs(t, signer.Verify(key, expires, signature), ErrSignedURLExpired)
+}
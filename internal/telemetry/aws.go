@@ -0,0 +1,47 @@
+package telemetry
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AWSMiddleware добавляет в стек AWS SDK создание спана на каждый вызов API.
+// Подключается через aws.Config.APIOptions.
+func AWSMiddleware(stack *middleware.Stack) error {
+	tracer := Tracer("aws")
+
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("TelemetrySpan", func(
+		ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+	) (middleware.InitializeOutput, middleware.Metadata, error) {
+		service := awsmiddleware.GetServiceID(ctx)
+		operation := awsmiddleware.GetOperationName(ctx)
+
+		ctx, span := tracer.Start(ctx, service+"."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCService(service),
+				semconv.RPCMethod(operation),
+				semconv.CloudRegion(awsmiddleware.GetRegion(ctx)),
+			),
+		)
+		defer span.End()
+
+		out, metadata, err := next.HandleInitialize(ctx, in)
+
+		if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+			span.SetAttributes(semconv.AWSRequestID(requestID))
+		}
+		if response, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
+		}
+		RecordError(span, err)
+
+		return out, metadata, err
+	}), middleware.After)
+}
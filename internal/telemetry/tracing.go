@@ -0,0 +1,124 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"report_srv/internal/config"
+	"report_srv/internal/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationPrefix префикс имен трассировщиков сервиса
+const instrumentationPrefix = "report_srv/"
+
+// Provider управляет жизненным циклом провайдера трассировки
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	logger   logging.Logger
+}
+
+// NewProvider настраивает глобальный провайдер трассировки и экспорт в OTLP.
+// При выключенной трассировке используется no-op провайдер, но пропагация
+// контекста сохраняется, чтобы не разрывать трассы вышестоящих сервисов.
+func NewProvider(cfg config.Config, logger logging.Logger) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !cfg.Tracing.Enabled {
+		logger.Info("Трассировка отключена")
+		return &Provider{logger: logger}, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Tracing.Endpoint)}
+	if cfg.Tracing.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания OTLP экспортера: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.Tracing.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания ресурса трассировки: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	logger.WithFields(logging.Fields{
+		"endpoint":     cfg.Tracing.Endpoint,
+		"service_name": cfg.Tracing.ServiceName,
+	}).Info("Трассировка OpenTelemetry включена")
+
+	return &Provider{provider: provider, logger: logger}, nil
+}
+
+// Shutdown отправляет накопленные спаны и останавливает провайдер
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.provider == nil {
+		return nil
+	}
+	if err := p.provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("ошибка остановки провайдера трассировки: %w", err)
+	}
+	return nil
+}
+
+// Tracer возвращает трассировщик компонента сервиса
+func Tracer(component string) trace.Tracer {
+	return otel.Tracer(instrumentationPrefix + component)
+}
+
+// Meter возвращает измеритель метрик компонента сервиса. Метрики экспортируются
+// провайдером метрик OpenTelemetry, если он зарегистрирован глобально.
+func Meter(component string) metric.Meter {
+	return otel.Meter(instrumentationPrefix + component)
+}
+
+// RecordError отмечает спан как завершившийся ошибкой
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Inject сохраняет контекст трассировки в carrier для передачи между процессами
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract восстанавливает контекст трассировки из carrier
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
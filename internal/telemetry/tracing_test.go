@@ -0,0 +1,75 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestTracing(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestInjectExtract(t *testing.T) {
+	setupTestTracing(t)
+
+	assert.Nil(t, Inject(context.Background()))
+
+	ctx, span := Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+
+	carrier := Inject(ctx)
+	require.Contains(t, carrier, "traceparent")
+
+	restored := Extract(context.Background(), carrier)
+	_, child := Tracer("test").Start(restored, "child")
+	defer child.End()
+
+	assert.Equal(t, span.SpanContext().TraceID(), child.SpanContext().TraceID())
+}
+
+type testRecord struct {
+	ID   uint
+	Name string
+}
+
+func TestGormPluginCreatesChildSpans(t *testing.T) {
+	recorder := setupTestTracing(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(NewGormPlugin()))
+	require.NoError(t, db.AutoMigrate(&testRecord{}))
+
+	ctx, parent := Tracer("test").Start(context.Background(), "request")
+	require.NoError(t, db.WithContext(ctx).Create(&testRecord{Name: "a"}).Error)
+
+	var records []testRecord
+	require.NoError(t, db.WithContext(ctx).Find(&records).Error)
+	parent.End()
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == parent.SpanContext().SpanID() {
+			names = append(names, span.Name())
+		}
+	}
+
+	assert.Equal(t, []string{"gorm.create", "gorm.query"}, names)
+}
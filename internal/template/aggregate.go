@@ -0,0 +1,104 @@
+package template
+
+import (
+	"reflect"
+	"strings"
+)
+
+// AggregateFunctions функции итогов по колонке. Итоги считаются по числовым значениям,
+// как соответствующие функции Excel.
+var AggregateFunctions = map[string]string{
+	"sum":     "SUM",
+	"average": "AVERAGE",
+	"count":   "COUNT",
+	"min":     "MIN",
+	"max":     "MAX",
+}
+
+// Aggregate итог колонки. Значение считается по записанным данным и сохраняется
+// в ячейке вместе с формулой, чтобы итог был виден и без пересчета книги.
+type Aggregate struct {
+	function string
+	count    int
+	sum      float64
+	min      float64
+	max      float64
+}
+
+// NewAggregate создает итог с функцией function, пустая функция - sum
+func NewAggregate(function string) *Aggregate {
+	if function == "" {
+		function = "sum"
+	}
+	return &Aggregate{function: function}
+}
+
+// Add учитывает значение колонки, нечисловые значения пропускаются
+func (a *Aggregate) Add(value interface{}) {
+	number, ok := numericValue(value)
+	if !ok {
+		return
+	}
+	if a.count == 0 || number < a.min {
+		a.min = number
+	}
+	if a.count == 0 || number > a.max {
+		a.max = number
+	}
+	a.count++
+	a.sum += number
+}
+
+// Value возвращает значение итога. Для average, min и max без чисел возвращается nil.
+func (a *Aggregate) Value() interface{} {
+	switch a.function {
+	case "count":
+		return a.count
+	case "sum":
+		return a.sum
+	}
+	if a.count == 0 {
+		return nil
+	}
+	switch a.function {
+	case "average":
+		return a.sum / float64(a.count)
+	case "min":
+		return a.min
+	default:
+		return a.max
+	}
+}
+
+// Formula возвращает формулу итога по диапазонам ячеек, например SUM(B2:B10,'Лист 2'!B2:B5)
+func (a *Aggregate) Formula(ranges []string) string {
+	function, ok := AggregateFunctions[a.function]
+	if !ok {
+		function = "SUM"
+	}
+	return function + "(" + strings.Join(ranges, ",") + ")"
+}
+
+// RangeRef возвращает ссылку на диапазон ячеек листа sheet для формулы
+func RangeRef(sheet, cells string) string {
+	return "'" + strings.ReplaceAll(sheet, "'", "''") + "'!" + cells
+}
+
+// numericValue возвращает число, если значение числового типа
+func numericValue(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Pointer:
+		if v.IsNil() {
+			return 0, false
+		}
+		return numericValue(v.Elem().Interface())
+	}
+	return 0, false
+}
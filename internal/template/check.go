@@ -0,0 +1,176 @@
+package template
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Problem плейсхолдер шаблона, который не будет заполнен данными отчета
+type Problem struct {
+	// Location часть DOCX документа (word/document.xml) или ячейка XLSX шаблона (Лист1!B3)
+	Location    string `json:"location"`
+	Placeholder string `json:"placeholder,omitempty"`
+	Message     string `json:"message"`
+}
+
+// DatasetShape имя и колонки набора записей
+type DatasetShape struct {
+	Name string
+	// Columns колонки набора, nil - колонки неизвестны и не проверяются
+	Columns []string
+}
+
+// DataShape поля и наборы записей, которыми будет заполнен шаблон
+type DataShape struct {
+	// Fields имена полей, nil - поля не проверяются
+	Fields []string
+	// Datasets наборы в порядке запросов, первый - основной набор ({{.column}})
+	Datasets []DatasetShape
+}
+
+// data возвращает пустые данные с наборами формы для разбора плейсхолдеров
+func (s DataShape) data() Data {
+	data := Data{Datasets: make(map[string][]Record, len(s.Datasets))}
+	for _, dataset := range s.Datasets {
+		data.Datasets[dataset.Name] = nil
+	}
+	return data
+}
+
+// check возвращает описание проблемы плейсхолдера key или пустую строку
+func (s DataShape) check(data Data, key string) string {
+	ref, ok := data.parseRecordRef(key)
+	if !ok {
+		if s.Fields == nil || slices.Contains(s.Fields, key) {
+			return ""
+		}
+		return fmt.Sprintf("неизвестное поле или параметр %s", key)
+	}
+
+	if len(s.Datasets) == 0 {
+		return "в определении нет запросов"
+	}
+	dataset := s.Datasets[0]
+	for _, candidate := range s.Datasets {
+		if candidate.Name == ref.dataset {
+			dataset = candidate
+		}
+	}
+	if dataset.Columns == nil || containsFold(dataset.Columns, ref.column) {
+		return ""
+	}
+	return fmt.Sprintf("колонки %s нет в результате запроса %s", ref.column, dataset.Name)
+}
+
+// CheckDOCX проверяет, что плейсхолдеры DOCX шаблона ссылаются на поля и колонки наборов shape,
+// а плейсхолдеры записей находятся в строках таблиц
+func CheckDOCX(tmpl []byte, shape DataShape) ([]Problem, error) {
+	reader, err := zip.NewReader(bytes.NewReader(tmpl), int64(len(tmpl)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия DOCX шаблона: %w", err)
+	}
+
+	data := shape.data()
+	var problems []Problem
+	for _, file := range reader.File {
+		if !docxContentPattern.MatchString(file.Name) {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения %s: %w", file.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения %s: %w", file.Name, err)
+		}
+
+		doc := string(content)
+		rows := findElements(doc, "w:tr")
+		for _, paragraph := range findElements(doc, "w:p") {
+			inRow := false
+			for _, row := range rows {
+				if paragraph.start >= row.start && paragraph.end <= row.end {
+					inRow = true
+					break
+				}
+			}
+
+			for _, match := range placeholderPattern.FindAllStringSubmatch(joinText(doc[paragraph.start:paragraph.end]), -1) {
+				key := match[1]
+				message := shape.check(data, key)
+				if _, record := data.parseRecordRef(key); message == "" && record && !inRow {
+					message = "плейсхолдер записи вне строки таблицы не заполняется"
+				}
+				if message != "" {
+					problems = append(problems, Problem{Location: file.Name, Placeholder: match[0], Message: message})
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+// CheckXLSX проверяет блоки {{range}} ... {{end}} на листах XLSX шаблона и то, что плейсхолдеры
+// и итоги ссылаются на поля и колонки наборов shape
+func CheckXLSX(tmpl []byte, shape DataShape) ([]Problem, error) {
+	f, err := excelize.OpenReader(bytes.NewReader(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия XLSX шаблона: %w", err)
+	}
+	defer f.Close()
+
+	data := shape.data()
+	var problems []Problem
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, fmt.Errorf("лист %s: %w", sheet, err)
+		}
+		if _, err := findRowBlocks(rows, data); err != nil {
+			problems = append(problems, Problem{Location: sheet, Message: err.Error()})
+		}
+
+		for i, cells := range rows {
+			for j, text := range cells {
+				if !strings.Contains(text, "{{") {
+					continue
+				}
+				trimmed := strings.TrimSpace(text)
+				if xlsxRangePattern.MatchString(trimmed) || xlsxEndPattern.MatchString(trimmed) {
+					continue
+				}
+
+				keys := placeholderPattern.FindAllStringSubmatch(text, -1)
+				if match := xlsxAggregatePattern.FindStringSubmatch(trimmed); match != nil {
+					keys = [][]string{{match[0], match[2]}}
+				}
+				cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+				for _, key := range keys {
+					if message := shape.check(data, key[1]); message != "" {
+						problems = append(problems, Problem{Location: sheet + "!" + cell, Placeholder: key[0], Message: message})
+					}
+				}
+			}
+		}
+	}
+	return problems, nil
+}
+
+// containsFold проверяет наличие имени без учета регистра: PostgreSQL приводит
+// имена колонок без кавычек к нижнему регистру
+func containsFold(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testShape() DataShape {
+	return DataShape{
+		Fields: []string{"title", "date"},
+		Datasets: []DatasetShape{
+			{Name: "totals", Columns: []string{"name", "Amount"}},
+			{Name: "plan"},
+		},
+	}
+}
+
+func TestCheckDOCX(t *testing.T) {
+	document := `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		`<w:p><w:r><w:t>{{title}} {{period}} {{.name}}</w:t></w:r></w:p>` +
+		`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>{{.na</w:t></w:r><w:r><w:t>me}} {{.amount}} {{totals.total}} {{plan.any}}</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+		`</w:body></w:document>`
+
+	problems, err := CheckDOCX(buildTestDOCX(t, document), testShape())
+	require.NoError(t, err)
+	require.Len(t, problems, 3)
+	assert.Equal(t, Problem{Location: "word/document.xml", Placeholder: "{{period}}", Message: "неизвестное поле или параметр period"}, problems[0])
+	assert.Equal(t, "{{.name}}", problems[1].Placeholder)
+	assert.Contains(t, problems[1].Message, "вне строки таблицы")
+	assert.Equal(t, "колонки total нет в результате запроса totals", problems[2].Message)
+
+	// Без известных полей проверяются только колонки
+	problems, err = CheckDOCX(buildTestDOCX(t, document), DataShape{Datasets: testShape().Datasets})
+	require.NoError(t, err)
+	assert.Len(t, problems, 2)
+
+	_, err = CheckDOCX([]byte("not a zip"), testShape())
+	assert.Error(t, err)
+}
+
+func TestCheckXLSX(t *testing.T) {
+	template := buildTestXLSX(t, map[string]string{
+		"A1": "{{title}}",
+		"A2": "{{range plan}}",
+		"A3": "{{plan.region}}",
+		"A4": "{{end}}",
+		"B5": "{{.name}} {{.price}}",
+		"B6": "{{sum totals.amount}}",
+		"B7": "{{max totals.missing}}",
+	})
+
+	problems, err := CheckXLSX(template, testShape())
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	assert.Equal(t, Problem{Location: "Sheet1!B5", Placeholder: "{{.price}}", Message: "колонки price нет в результате запроса totals"}, problems[0])
+	assert.Equal(t, "Sheet1!B7", problems[1].Location)
+	assert.Equal(t, "{{max totals.missing}}", problems[1].Placeholder)
+
+	problems, err = CheckXLSX(buildTestXLSX(t, map[string]string{"A1": "{{range missing}}", "A2": "{{end}}"}), testShape())
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Equal(t, "Sheet1", problems[0].Location)
+	assert.Contains(t, problems[0].Message, "неизвестный набор данных missing")
+}
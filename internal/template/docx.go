@@ -0,0 +1,403 @@
+package template
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"report_srv/internal/logging"
+)
+
+// docxContentPattern части DOCX архива, содержащие текст документа
+var docxContentPattern = regexp.MustCompile(`^word/(document|header\d*|footer\d*|footnotes|endnotes)\.xml$`)
+
+// xmlTextEscaper экранирует текст для вставки в XML
+var xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// DOCXFiller заполняет DOCX шаблоны данными
+type DOCXFiller struct {
+	limits Limits
+	logger logging.Logger
+}
+
+// NewDOCXFiller создает новый заполнитель DOCX шаблонов без ограничений
+func NewDOCXFiller(logger logging.Logger) TemplateFiller {
+	return NewDOCXFillerWithLimits(Limits{}, logger)
+}
+
+// NewDOCXFillerWithLimits создает заполнитель DOCX шаблонов с ограничениями
+func NewDOCXFillerWithLimits(limits Limits, logger logging.Logger) TemplateFiller {
+	return &DOCXFiller{limits: limits, logger: logger}
+}
+
+// Fill подставляет данные в плейсхолдеры абзацев и таблиц DOCX шаблона
+func (f *DOCXFiller) Fill(ctx context.Context, tmpl []byte, data Data) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(tmpl), int64(len(tmpl)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия DOCX шаблона: %w", err)
+	}
+	budget, err := f.limits.newBudget(tmpl, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&limitedWriter{w: &buffer, max: f.limits.MaxMemory})
+
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if !docxContentPattern.MatchString(file.Name) {
+			if err := writer.Copy(file); err != nil {
+				return nil, fmt.Errorf("ошибка копирования %s: %w", file.Name, err)
+			}
+			continue
+		}
+
+		if err := f.fillPart(writer, file, data, budget); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("ошибка записи DOCX файла: %w", err)
+	}
+
+	f.logger.WithField("records", len(data.Records)).Debug("DOCX шаблон заполнен")
+	return buffer.Bytes(), nil
+}
+
+// fillPart заполняет одну XML часть документа
+func (f *DOCXFiller) fillPart(writer *zip.Writer, file *zip.File, data Data, budget *fillBudget) error {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", file.Name, err)
+	}
+	content, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %w", file.Name, err)
+	}
+
+	doc, err := expandTableRows(string(content), data, budget)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file.Name, err)
+	}
+	doc = replaceInParagraphs(doc, data.fieldResolver())
+	if err := budget.grow(len(doc) - len(content)); err != nil {
+		return fmt.Errorf("%s: %w", file.Name, err)
+	}
+
+	header := file.FileHeader
+	w, err := writer.CreateHeader(&header)
+	if err != nil {
+		return fmt.Errorf("ошибка записи %s: %w", file.Name, err)
+	}
+	if _, err := io.WriteString(w, doc); err != nil {
+		return fmt.Errorf("ошибка записи %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+// GetMimeType возвращает MIME тип DOCX документа
+func (f *DOCXFiller) GetMimeType() string {
+	return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+}
+
+// GetFileExtension возвращает расширение DOCX документа
+func (f *DOCXFiller) GetFileExtension() string {
+	return "docx"
+}
+
+// expandTableRows повторяет строки таблиц с плейсхолдерами записей для каждой записи
+func expandTableRows(doc string, data Data, budget *fillBudget) (string, error) {
+	spans := findElements(doc, "w:tr")
+	if len(spans) == 0 {
+		return doc, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(doc[last:span.start])
+		last = span.end
+
+		row := doc[span.start:span.end]
+		ref, ok := data.findRecordRef(joinText(row))
+		if !ok {
+			nested, err := expandNestedRows(row, data, budget)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(nested)
+			continue
+		}
+
+		// Строки учитываются до раскрытия, чтобы не собирать в памяти документ сверх ограничения
+		records := data.records(ref.dataset)
+		if err := budget.add(len(records), len(findElements(row, "w:tc"))); err != nil {
+			return "", err
+		}
+		for _, record := range records {
+			b.WriteString(replaceInParagraphs(row, data.recordResolver(ref.dataset, record)))
+		}
+	}
+	b.WriteString(doc[last:])
+
+	return b.String(), nil
+}
+
+// expandNestedRows обрабатывает вложенные таблицы внутри строки
+func expandNestedRows(row string, data Data, budget *fillBudget) (string, error) {
+	openEnd := strings.IndexByte(row, '>') + 1
+	closeStart := strings.LastIndex(row, "</w:tr>")
+	if openEnd <= 0 || closeStart < openEnd {
+		return row, nil
+	}
+	nested, err := expandTableRows(row[openEnd:closeStart], data, budget)
+	if err != nil {
+		return "", err
+	}
+	return row[:openEnd] + nested + row[closeStart:], nil
+}
+
+// replaceInParagraphs заменяет плейсхолдеры во всех абзацах
+func replaceInParagraphs(doc string, resolve func(key string) (string, bool)) string {
+	spans := findElements(doc, "w:p")
+	if len(spans) == 0 {
+		return doc
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, span := range spans {
+		b.WriteString(doc[last:span.start])
+		b.WriteString(replaceInParagraph(doc[span.start:span.end], resolve))
+		last = span.end
+	}
+	b.WriteString(doc[last:])
+
+	return b.String()
+}
+
+// replaceInParagraph заменяет плейсхолдеры в абзаце.
+// Word часто разбивает текст плейсхолдера на несколько run'ов,
+// поэтому замена выполняется по склеенному тексту абзаца.
+func replaceInParagraph(p string, resolve func(key string) (string, bool)) string {
+	nodes := findTextNodes(p)
+	if len(nodes) == 0 {
+		return p
+	}
+
+	texts := make([]string, len(nodes))
+	offsets := make([]int, len(nodes))
+	var joined strings.Builder
+	for i, node := range nodes {
+		texts[i] = node.text
+		offsets[i] = joined.Len()
+		joined.WriteString(node.text)
+	}
+
+	full := joined.String()
+	if !strings.Contains(full, "{{") {
+		return p
+	}
+
+	// Идем с конца, чтобы смещения предыдущих совпадений оставались верными
+	matches := placeholderPattern.FindAllStringSubmatchIndex(full, -1)
+	changed := false
+	for m := len(matches) - 1; m >= 0; m-- {
+		start, end := matches[m][0], matches[m][1]
+		value, ok := resolve(full[matches[m][2]:matches[m][3]])
+		if !ok {
+			continue
+		}
+
+		first := nodeAt(nodes, offsets, start)
+		lastNode := nodeAt(nodes, offsets, end-1)
+		localStart := start - offsets[first]
+		localEnd := end - offsets[lastNode]
+
+		if first == lastNode {
+			texts[first] = texts[first][:localStart] + value + texts[first][localEnd:]
+		} else {
+			texts[first] = texts[first][:localStart] + value
+			for k := first + 1; k < lastNode; k++ {
+				texts[k] = ""
+			}
+			texts[lastNode] = texts[lastNode][localEnd:]
+		}
+		changed = true
+	}
+
+	if !changed {
+		return p
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, node := range nodes {
+		b.WriteString(p[last:node.openStart])
+		b.WriteString(preserveSpace(p[node.openStart:node.contentStart]))
+		b.WriteString(xmlTextEscaper.Replace(texts[i]))
+		last = node.contentEnd
+	}
+	b.WriteString(p[last:])
+
+	return b.String()
+}
+
+// preserveSpace добавляет xml:space="preserve" к открывающему тегу w:t
+func preserveSpace(openTag string) string {
+	if strings.Contains(openTag, "xml:space") {
+		return openTag
+	}
+	return strings.TrimSuffix(openTag, ">") + ` xml:space="preserve">`
+}
+
+// nodeAt возвращает индекс текстового узла, содержащего позицию склеенного текста
+func nodeAt(nodes []textNode, offsets []int, pos int) int {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if offsets[i] <= pos && pos < offsets[i]+len(nodes[i].text) {
+			return i
+		}
+	}
+	return 0
+}
+
+// joinText возвращает склеенный текст всех узлов w:t фрагмента
+func joinText(fragment string) string {
+	var b strings.Builder
+	for _, node := range findTextNodes(fragment) {
+		b.WriteString(node.text)
+	}
+	return b.String()
+}
+
+// textNode текстовый узел w:t
+type textNode struct {
+	openStart    int
+	contentStart int
+	contentEnd   int
+	text         string
+}
+
+// findTextNodes находит все текстовые узлы w:t во фрагменте
+func findTextNodes(fragment string) []textNode {
+	var nodes []textNode
+	pos := 0
+	for {
+		start := indexTag(fragment, "<w:t", pos)
+		if start < 0 {
+			return nodes
+		}
+		openEnd := strings.IndexByte(fragment[start:], '>')
+		if openEnd < 0 {
+			return nodes
+		}
+		openEnd += start
+
+		// Пустой самозакрывающийся узел
+		if fragment[openEnd-1] == '/' {
+			pos = openEnd + 1
+			continue
+		}
+
+		closeStart := strings.Index(fragment[openEnd:], "</w:t>")
+		if closeStart < 0 {
+			return nodes
+		}
+		closeStart += openEnd
+
+		nodes = append(nodes, textNode{
+			openStart:    start,
+			contentStart: openEnd + 1,
+			contentEnd:   closeStart,
+			text:         html.UnescapeString(fragment[openEnd+1 : closeStart]),
+		})
+		pos = closeStart + len("</w:t>")
+	}
+}
+
+// elementSpan границы XML элемента
+type elementSpan struct {
+	start int
+	end   int
+}
+
+// findElements возвращает границы элементов верхнего уровня с указанным тегом
+func findElements(doc, tag string) []elementSpan {
+	open := "<" + tag
+	closeTag := "</" + tag + ">"
+
+	var spans []elementSpan
+	pos := 0
+	for {
+		start := indexTag(doc, open, pos)
+		if start < 0 {
+			return spans
+		}
+		tagEnd := strings.IndexByte(doc[start:], '>')
+		if tagEnd < 0 {
+			return spans
+		}
+		tagEnd += start
+
+		if doc[tagEnd-1] == '/' {
+			spans = append(spans, elementSpan{start: start, end: tagEnd + 1})
+			pos = tagEnd + 1
+			continue
+		}
+
+		depth := 1
+		cur := tagEnd + 1
+		for depth > 0 {
+			nextClose := strings.Index(doc[cur:], closeTag)
+			if nextClose < 0 {
+				// Некорректный XML: оставляем остаток без изменений
+				return spans
+			}
+			nextClose += cur
+
+			nextOpen := indexTag(doc, open, cur)
+			if nextOpen >= 0 && nextOpen < nextClose {
+				openEnd := strings.IndexByte(doc[nextOpen:], '>') + nextOpen
+				if doc[openEnd-1] != '/' {
+					depth++
+				}
+				cur = openEnd + 1
+				continue
+			}
+
+			depth--
+			cur = nextClose + len(closeTag)
+		}
+
+		spans = append(spans, elementSpan{start: start, end: cur})
+		pos = cur
+	}
+}
+
+// indexTag ищет открывающий тег, исключая теги с тем же префиксом (w:t и w:tbl)
+func indexTag(doc, open string, from int) int {
+	for from < len(doc) {
+		i := strings.Index(doc[from:], open)
+		if i < 0 {
+			return -1
+		}
+		i += from
+		next := i + len(open)
+		if next < len(doc) && (doc[next] == '>' || doc[next] == ' ' || doc[next] == '/') {
+			return i
+		}
+		from = next
+	}
+	return -1
+}
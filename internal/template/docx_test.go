@@ -0,0 +1,140 @@
+package template
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"report_srv/internal/logging"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDocumentXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+	`<w:p><w:r><w:t>Отчет: {{ti</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>tle}}</w:t></w:r><w:r><w:t xml:space="preserve"> от {{date}}</w:t></w:r></w:p>` +
+	`<w:tbl>` +
+	`<w:tr><w:tc><w:p><w:r><w:t>Имя</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Сумма</w:t></w:r></w:p></w:tc></w:tr>` +
+	`<w:tr><w:tc><w:p><w:r><w:t>{{.name}}</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>{{.</w:t></w:r><w:r><w:t>amount}}</w:t></w:r></w:p></w:tc></w:tr>` +
+	`</w:tbl>` +
+	`<w:p><w:r><w:t>{{unknown}}</w:t></w:r></w:p>` +
+	`</w:body></w:document>`
+
+func buildTestDOCX(t *testing.T, document string) []byte {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+
+	files := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0"?><Types/>`,
+		"word/document.xml":   document,
+	}
+	for _, name := range []string{"[Content_Types].xml", "word/document.xml"} {
+		w, err := writer.Create(name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, files[name])
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	return buffer.Bytes()
+}
+
+func readDocumentXML(t *testing.T, docx []byte) string {
+	reader, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	require.NoError(t, err)
+
+	for _, file := range reader.File {
+		if file.Name == "word/document.xml" {
+			rc, err := file.Open()
+			require.NoError(t, err)
+			defer rc.Close()
+			content, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			return string(content)
+		}
+	}
+	t.Fatal("word/document.xml не найден")
+	return ""
+}
+
+func TestDOCXFillerFill(t *testing.T) {
+	filler := NewDOCXFiller(logging.NewLogrus(logrus.New()))
+
+	data := Data{
+		Fields: map[string]interface{}{
+			"title": "Продажи <Q1>",
+			"date":  "2024-01-31",
+		},
+		Records: []Record{
+			{"name": "Иванов", "amount": 100.5},
+			{"name": "Петров", "amount": 200},
+		},
+	}
+
+	result, err := filler.Fill(context.Background(), buildTestDOCX(t, testDocumentXML), data)
+	require.NoError(t, err)
+
+	doc := readDocumentXML(t, result)
+	text := joinText(doc)
+
+	assert.Contains(t, text, "Отчет: Продажи <Q1> от 2024-01-31")
+	assert.Contains(t, doc, "Продажи &lt;Q1&gt;")
+	assert.Contains(t, text, "Иванов100.5")
+	assert.Contains(t, text, "Петров200")
+	assert.Equal(t, 3, strings.Count(doc, "<w:tr>"))
+	assert.Contains(t, text, "{{unknown}}")
+}
+
+func TestDOCXFillerRemovesRowWithoutRecords(t *testing.T) {
+	filler := NewDOCXFiller(logging.NewLogrus(logrus.New()))
+
+	result, err := filler.Fill(context.Background(), buildTestDOCX(t, testDocumentXML), Data{})
+	require.NoError(t, err)
+
+	doc := readDocumentXML(t, result)
+	assert.Equal(t, 1, strings.Count(doc, "<w:tr>"))
+	assert.NotContains(t, doc, "amount")
+}
+
+func TestDOCXFillerInvalidTemplate(t *testing.T) {
+	filler := NewDOCXFiller(logging.NewLogrus(logrus.New()))
+
+	_, err := filler.Fill(context.Background(), []byte("not a zip"), Data{})
+	assert.Error(t, err)
+}
+
+func TestDOCXFillerLimits(t *testing.T) {
+	tmpl := buildTestDOCX(t, testDocumentXML)
+	data := Data{Records: []Record{{"name": "Анна"}, {"name": "Иван"}, {"name": "Олег"}}}
+
+	tests := []struct {
+		name   string
+		limits Limits
+		limit  string
+	}{
+		{"размер шаблона", Limits{MaxSize: 16}, "размер шаблона"},
+		{"распакованный шаблон", Limits{MaxMemory: 64}, "распакованный размер шаблона"},
+		{"строки", Limits{MaxRows: 2}, "число строк заполненного шаблона"},
+		{"ячейки", Limits{MaxCells: 5}, "число ячеек заполненного шаблона"},
+		{"заполненный документ", Limits{MaxMemory: int64(len(testDocumentXML)) + 200}, "объем заполненного шаблона"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filler := NewDOCXFillerWithLimits(tt.limits, logging.NewLogrus(logrus.New()))
+			_, err := filler.Fill(context.Background(), tmpl, data)
+			require.ErrorIs(t, err, ErrLimitExceeded)
+			var limitErr *LimitError
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, tt.limit, limitErr.Limit)
+		})
+	}
+
+	filler := NewDOCXFillerWithLimits(Limits{MaxRows: 3, MaxCells: 6}, logging.NewLogrus(logrus.New()))
+	_, err := filler.Fill(context.Background(), tmpl, data)
+	assert.NoError(t, err)
+}
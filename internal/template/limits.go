@@ -0,0 +1,111 @@
+package template
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrLimitExceeded шаблон или заполненный по нему файл превышает ограничение
+var ErrLimitExceeded = errors.New("превышено ограничение шаблона")
+
+// LimitError превышение ограничения шаблона
+type LimitError struct {
+	// Limit название ограничения
+	Limit string
+	Value int64
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %d, допустимо не более %d", e.Limit, e.Value, e.Max)
+}
+
+// Unwrap позволяет проверить ошибку через errors.Is(err, ErrLimitExceeded)
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Limits ограничения открытия и заполнения шаблонов. Нулевое значение - без ограничения.
+type Limits struct {
+	// MaxSize наибольший размер файла шаблона в байтах
+	MaxSize int64
+	// MaxSheets наибольшее число листов XLSX шаблона
+	MaxSheets int
+	// MaxRows наибольшее число строк, которые добавляет заполнение шаблона
+	MaxRows int64
+	// MaxCells наибольшее число ячеек в добавленных строках
+	MaxCells int64
+	// MaxMemory наибольший объем распакованных частей шаблона и заполненного файла в байтах
+	MaxMemory int64
+}
+
+// CheckSize проверяет размер файла шаблона
+func (l Limits) CheckSize(size int64) error {
+	return checkLimit("размер шаблона", size, l.MaxSize)
+}
+
+// newBudget проверяет размер шаблона и распакованный размер его частей до чтения,
+// чтобы сжатый архив не занял всю память, и возвращает учет его заполнения
+func (l Limits) newBudget(tmpl []byte, reader *zip.Reader) (*fillBudget, error) {
+	if err := l.CheckSize(int64(len(tmpl))); err != nil {
+		return nil, err
+	}
+	var size uint64
+	for _, file := range reader.File {
+		size += file.UncompressedSize64
+	}
+	unpacked := int64(min(size, uint64(1<<63-1)))
+	if err := checkLimit("распакованный размер шаблона", unpacked, l.MaxMemory); err != nil {
+		return nil, err
+	}
+	return &fillBudget{limits: l, memory: unpacked}, nil
+}
+
+// checkLimit возвращает LimitError, если value больше max
+func checkLimit(limit string, value, max int64) error {
+	if max > 0 && value > max {
+		return &LimitError{Limit: limit, Value: value, Max: max}
+	}
+	return nil
+}
+
+// fillBudget учитывает строки, ячейки и объем, добавленные заполнением одного шаблона
+type fillBudget struct {
+	limits Limits
+	rows   int64
+	cells  int64
+	memory int64
+}
+
+// add учитывает rows строк шириной width ячеек
+func (b *fillBudget) add(rows, width int) error {
+	b.rows += int64(rows)
+	b.cells += int64(rows) * int64(max(width, 1))
+	if err := checkLimit("число строк заполненного шаблона", b.rows, b.limits.MaxRows); err != nil {
+		return err
+	}
+	return checkLimit("число ячеек заполненного шаблона", b.cells, b.limits.MaxCells)
+}
+
+// grow учитывает увеличение распакованного документа на size байт
+func (b *fillBudget) grow(size int) error {
+	b.memory += int64(size)
+	return checkLimit("объем заполненного шаблона", b.memory, b.limits.MaxMemory)
+}
+
+// limitedWriter прерывает запись заполненного файла, превысившего max байт
+type limitedWriter struct {
+	w       io.Writer
+	max     int64
+	written int64
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	if err := checkLimit("размер заполненного файла", w.written, w.max); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
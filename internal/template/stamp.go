@@ -0,0 +1,449 @@
+package template
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	// docxWatermarkHeader часть с водяным знаком для разделов документа без верхнего колонтитула
+	docxWatermarkHeader = "word/headerWatermark.xml"
+	// docxWatermarkRelID идентификатор связи документа с частью водяного знака
+	docxWatermarkRelID = "rIdWatermark"
+
+	relsNamespace   = "http://schemas.openxmlformats.org/package/2006/relationships"
+	wordNamespace   = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	officeRelPrefix = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+var (
+	// docxHeaderPattern части верхних колонтитулов документа
+	docxHeaderPattern = regexp.MustCompile(`^word/header\d+\.xml$`)
+
+	// docxDefaultHeaderPattern ссылка раздела на колонтитул обычных страниц
+	docxDefaultHeaderPattern = regexp.MustCompile(`<w:headerReference\s[^>]*w:type="default"`)
+
+	// xlsxHeaderEscaper экранирует управляющий символ колонтитула Excel
+	xlsxHeaderEscaper = strings.NewReplacer("&", "&&")
+)
+
+// Stamp свойства документа и текст водяного знака, которые проставляются в готовый файл
+type Stamp struct {
+	Title          string
+	Author         string
+	Company        string
+	Classification string
+	// Watermark текст водяного знака с выполненными подстановками. Пустой - водяной знак не ставится
+	Watermark string
+}
+
+// IsEmpty проверяет, есть ли что проставлять в файл. Название само по себе не проставляется
+func (s Stamp) IsEmpty() bool {
+	return s.Author == "" && s.Company == "" && s.Classification == "" && s.Watermark == ""
+}
+
+// StampWorkbook записывает свойства в книгу Excel и выводит водяной знак в верхнем колонтитуле
+// каждого листа. Колонтитул виден в режиме разметки страницы и при печати. Для листов
+// потоковой записи вызывается до Flush
+func StampWorkbook(f *excelize.File, stamp Stamp) error {
+	if stamp.IsEmpty() {
+		return nil
+	}
+
+	// excelize записывает все поля свойств, поэтому незаданные поля берутся из текущих свойств
+	props, err := f.GetDocProps()
+	if err != nil {
+		return fmt.Errorf("ошибка чтения свойств документа: %w", err)
+	}
+	for _, property := range []struct {
+		target *string
+		value  string
+	}{
+		{&props.Title, stamp.Title},
+		{&props.Creator, stamp.Author},
+		{&props.Category, stamp.Classification},
+	} {
+		if property.value != "" {
+			*property.target = property.value
+		}
+	}
+	if err := f.SetDocProps(props); err != nil {
+		return fmt.Errorf("ошибка записи свойств документа: %w", err)
+	}
+	if stamp.Company != "" {
+		app, err := f.GetAppProps()
+		if err != nil {
+			return fmt.Errorf("ошибка чтения свойств документа: %w", err)
+		}
+		app.Company = stamp.Company
+		if err := f.SetAppProps(app); err != nil {
+			return fmt.Errorf("ошибка записи свойств документа: %w", err)
+		}
+	}
+
+	if stamp.Watermark == "" {
+		return nil
+	}
+	header := `&C&"-,Bold"&16&KA6A6A6` + xlsxHeaderEscaper.Replace(stamp.Watermark)
+	for _, sheet := range f.GetSheetList() {
+		if err := f.SetHeaderFooter(sheet, &excelize.HeaderFooterOptions{OddHeader: header}); err != nil {
+			return fmt.Errorf("ошибка записи водяного знака на лист %s: %w", sheet, err)
+		}
+	}
+	return nil
+}
+
+// StampXLSX проставляет свойства документа и водяной знак в готовый XLSX файл
+func StampXLSX(content []byte, stamp Stamp) ([]byte, error) {
+	if stamp.IsEmpty() {
+		return content, nil
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия XLSX файла: %w", err)
+	}
+	defer f.Close()
+
+	if err := StampWorkbook(f, stamp); err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := f.Write(&buffer); err != nil {
+		return nil, fmt.Errorf("ошибка записи XLSX файла: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// StampDOCX проставляет свойства документа и водяной знак в готовый DOCX файл. Водяной знак
+// добавляется во все верхние колонтитулы, а разделам без колонтитула обычных страниц
+// назначается колонтитул с одним водяным знаком
+func StampDOCX(content []byte, stamp Stamp) ([]byte, error) {
+	if stamp.IsEmpty() {
+		return content, nil
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия DOCX файла: %w", err)
+	}
+	pkg := newDOCXPackage(reader)
+
+	if err := pkg.stampProperties(stamp); err != nil {
+		return nil, err
+	}
+	if stamp.Watermark != "" {
+		if err := pkg.stampWatermark(stamp.Watermark); err != nil {
+			return nil, err
+		}
+	}
+	return pkg.write()
+}
+
+// docxPackage части DOCX архива с изменениями
+type docxPackage struct {
+	files   []*zip.File
+	index   map[string]*zip.File
+	changed map[string]string
+	added   []string
+}
+
+func newDOCXPackage(reader *zip.Reader) *docxPackage {
+	pkg := &docxPackage{
+		files:   reader.File,
+		index:   make(map[string]*zip.File, len(reader.File)),
+		changed: make(map[string]string),
+	}
+	for _, file := range reader.File {
+		pkg.index[file.Name] = file
+	}
+	return pkg
+}
+
+// part возвращает содержимое части с учетом изменений
+func (p *docxPackage) part(name string) (string, bool, error) {
+	if content, ok := p.changed[name]; ok {
+		return content, true, nil
+	}
+	file, ok := p.index[name]
+	if !ok {
+		return "", false, nil
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return "", false, fmt.Errorf("ошибка чтения %s: %w", name, err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return "", false, fmt.Errorf("ошибка чтения %s: %w", name, err)
+	}
+	return string(content), true, nil
+}
+
+// set заменяет содержимое части или добавляет новую часть
+func (p *docxPackage) set(name, content string) {
+	if _, ok := p.changed[name]; !ok {
+		if _, ok := p.index[name]; !ok {
+			p.added = append(p.added, name)
+		}
+	}
+	p.changed[name] = content
+}
+
+// addPart добавляет новую часть со связью и типом содержимого
+func (p *docxPackage) addPart(name, content, contentType, rels, relID, relType, target string) error {
+	p.set(name, content)
+	if err := p.addRelationship(rels, relID, relType, target); err != nil {
+		return err
+	}
+
+	types, _, err := p.part("[Content_Types].xml")
+	if err != nil {
+		return err
+	}
+	override := fmt.Sprintf(`<Override PartName="/%s" ContentType="%s"/>`, name, contentType)
+	p.set("[Content_Types].xml", appendChild(types, "Types", override))
+	return nil
+}
+
+// addRelationship добавляет связь в файл связей, создавая его при отсутствии
+func (p *docxPackage) addRelationship(rels, id, relType, target string) error {
+	content, ok, err := p.part(rels)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		content = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<Relationships xmlns="` + relsNamespace + `"></Relationships>`
+	}
+	relationship := fmt.Sprintf(`<Relationship Id="%s" Type="%s" Target="%s"/>`, id, relType, target)
+	p.set(rels, appendChild(content, "Relationships", relationship))
+	return nil
+}
+
+// stampProperties записывает автора, название и гриф в docProps/core.xml и организацию в docProps/app.xml
+func (p *docxPackage) stampProperties(stamp Stamp) error {
+	core, ok, err := p.part("docProps/core.xml")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		core = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" ` +
+			`xmlns:dc="http://purl.org/dc/elements/1.1/"></cp:coreProperties>`
+	}
+	for _, property := range []struct{ tag, value string }{
+		{"dc:title", stamp.Title},
+		{"dc:creator", stamp.Author},
+		{"cp:category", stamp.Classification},
+	} {
+		if property.value != "" {
+			core = setElement(core, "cp:coreProperties", property.tag, property.value)
+		}
+	}
+	if ok {
+		p.set("docProps/core.xml", core)
+	} else if err := p.addPart("docProps/core.xml", core,
+		"application/vnd.openxmlformats-package.core-properties+xml",
+		"_rels/.rels", "rIdCoreProperties",
+		"http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties",
+		"docProps/core.xml"); err != nil {
+		return err
+	}
+
+	if stamp.Company == "" {
+		return nil
+	}
+	app, ok, err := p.part("docProps/app.xml")
+	if err != nil {
+		return err
+	}
+	if ok {
+		p.set("docProps/app.xml", setElement(app, "Properties", "Company", stamp.Company))
+		return nil
+	}
+	app = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<Properties xmlns="http://schemas.openxmlformats.org/officeDocument/2006/extended-properties"></Properties>`
+	return p.addPart("docProps/app.xml", setElement(app, "Properties", "Company", stamp.Company),
+		"application/vnd.openxmlformats-officedocument.extended-properties+xml",
+		"_rels/.rels", "rIdExtendedProperties", officeRelPrefix+"/extended-properties",
+		"docProps/app.xml")
+}
+
+// stampWatermark добавляет водяной знак в колонтитулы документа
+func (p *docxPackage) stampWatermark(text string) error {
+	shapes := 0
+	for _, file := range p.files {
+		if !docxHeaderPattern.MatchString(file.Name) {
+			continue
+		}
+		header, _, err := p.part(file.Name)
+		if err != nil {
+			return err
+		}
+		shapes++
+		p.set(file.Name, insertWatermark(header, text, shapes))
+	}
+
+	document, ok, err := p.part("word/document.xml")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("в DOCX файле нет word/document.xml")
+	}
+
+	reference := `<w:headerReference w:type="default" r:id="` + docxWatermarkRelID + `"/>`
+	referenced := false
+	var builder strings.Builder
+	last := 0
+	for _, span := range findElements(document, "w:sectPr") {
+		section := document[span.start:span.end]
+		if docxDefaultHeaderPattern.MatchString(section) {
+			continue
+		}
+		builder.WriteString(document[last:span.start])
+		builder.WriteString(prependChild(section, "w:sectPr", reference))
+		last = span.end
+		referenced = true
+	}
+	builder.WriteString(document[last:])
+	document = builder.String()
+
+	// Документ без свойств раздела состоит из одного раздела по умолчанию
+	if !strings.Contains(document, "<w:sectPr") {
+		document = appendChild(document, "w:body", "<w:sectPr>"+reference+"</w:sectPr>")
+		referenced = true
+	}
+	if !referenced {
+		return nil
+	}
+
+	p.set("word/document.xml", addNamespace(document, "w:document", "r", officeRelPrefix))
+	shapes++
+	header := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<w:hdr xmlns:w="` + wordNamespace + `"></w:hdr>`
+	return p.addPart(docxWatermarkHeader, insertWatermark(header, text, shapes),
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.header+xml",
+		"word/_rels/document.xml.rels", docxWatermarkRelID, officeRelPrefix+"/header",
+		strings.TrimPrefix(docxWatermarkHeader, "word/"))
+}
+
+// write собирает архив: измененные части записываются заново, остальные копируются без распаковки
+func (p *docxPackage) write() ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+
+	writePart := func(name string) error {
+		w, err := writer.Create(name)
+		if err != nil {
+			return fmt.Errorf("ошибка записи %s: %w", name, err)
+		}
+		if _, err := io.WriteString(w, p.changed[name]); err != nil {
+			return fmt.Errorf("ошибка записи %s: %w", name, err)
+		}
+		return nil
+	}
+
+	for _, file := range p.files {
+		if _, ok := p.changed[file.Name]; ok {
+			if err := writePart(file.Name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := writer.Copy(file); err != nil {
+			return nil, fmt.Errorf("ошибка копирования %s: %w", file.Name, err)
+		}
+	}
+
+	added := append([]string(nil), p.added...)
+	sort.Strings(added)
+	for _, name := range added {
+		if err := writePart(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("ошибка записи DOCX файла: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// insertWatermark добавляет в начало колонтитула абзац с повернутой надписью VML
+func insertWatermark(header, text string, shape int) string {
+	header = addNamespace(header, "w:hdr", "v", "urn:schemas-microsoft-com:vml")
+	header = addNamespace(header, "w:hdr", "o", "urn:schemas-microsoft-com:office:office")
+	paragraph := `<w:p><w:pPr><w:pStyle w:val="Header"/></w:pPr><w:r><w:pict>` +
+		`<v:shapetype id="_x0000_t136" coordsize="21600,21600" o:spt="136" adj="10800" path="m@7,l@8,m@5,21600l@6,21600e">` +
+		`<v:formulas><v:f eqn="sum #0 0 10800"/><v:f eqn="prod #0 2 1"/><v:f eqn="sum 21600 0 @1"/>` +
+		`<v:f eqn="sum 0 0 @2"/><v:f eqn="sum 21600 0 @3"/><v:f eqn="if @0 @3 0"/><v:f eqn="if @0 21600 @1"/>` +
+		`<v:f eqn="if @0 0 @2"/><v:f eqn="if @0 @4 21600"/><v:f eqn="mid @5 @6"/><v:f eqn="mid @8 @5"/>` +
+		`<v:f eqn="mid @7 @8"/><v:f eqn="mid @6 @7"/><v:f eqn="sum @6 0 @5"/></v:formulas>` +
+		`<v:path textpathok="t" o:connecttype="custom" o:connectlocs="@9,0;@10,10800;@11,21600;@12,10800" o:connectangles="270,180,90,0"/>` +
+		`<v:textpath on="t" fitshape="t"/><o:lock v:ext="edit" text="t" shapetype="t"/></v:shapetype>` +
+		fmt.Sprintf(`<v:shape id="PowerPlusWaterMarkObject%d" o:spid="_x0000_s%d" type="#_x0000_t136" `, shape, 2048+shape) +
+		`style="position:absolute;margin-left:0;margin-top:0;width:468pt;height:117pt;rotation:315;z-index:-251657216;` +
+		`mso-position-horizontal:center;mso-position-horizontal-relative:margin;mso-position-vertical:center;mso-position-vertical-relative:margin" ` +
+		`o:allowincell="f" fillcolor="silver" stroked="f"><v:fill opacity=".5"/>` +
+		`<v:textpath style="font-family:&quot;Calibri&quot;;font-size:1pt" string="` + html.EscapeString(text) + `"/>` +
+		`</v:shape></w:pict></w:r></w:p>`
+	return prependChild(header, "w:hdr", paragraph)
+}
+
+// setElement заменяет текст дочернего элемента или добавляет элемент в конец корня
+func setElement(doc, root, tag, value string) string {
+	element := "<" + tag + ">" + xmlTextEscaper.Replace(value) + "</" + tag + ">"
+	spans := findElements(doc, tag)
+	if len(spans) == 0 {
+		return appendChild(doc, root, element)
+	}
+	return doc[:spans[0].start] + element + doc[spans[0].end:]
+}
+
+// prependChild вставляет фрагмент сразу после открывающего тега элемента
+func prependChild(doc, tag, fragment string) string {
+	start := indexTag(doc, "<"+tag, 0)
+	if start < 0 {
+		return doc
+	}
+	end := strings.IndexByte(doc[start:], '>') + start
+	if doc[end-1] == '/' {
+		return doc[:end-1] + ">" + fragment + "</" + tag + ">" + doc[end+1:]
+	}
+	return doc[:end+1] + fragment + doc[end+1:]
+}
+
+// appendChild вставляет фрагмент перед закрывающим тегом элемента
+func appendChild(doc, tag, fragment string) string {
+	if end := strings.LastIndex(doc, "</"+tag+">"); end >= 0 {
+		return doc[:end] + fragment + doc[end:]
+	}
+	return prependChild(doc, tag, fragment)
+}
+
+// addNamespace объявляет пространство имен в открывающем теге элемента, если оно не объявлено
+func addNamespace(doc, tag, prefix, uri string) string {
+	start := indexTag(doc, "<"+tag, 0)
+	if start < 0 {
+		return doc
+	}
+	end := strings.IndexByte(doc[start:], '>') + start
+	if strings.Contains(doc[start:end], "xmlns:"+prefix+"=") {
+		return doc
+	}
+	insert := start + len("<"+tag)
+	return doc[:insert] + ` xmlns:` + prefix + `="` + uri + `"` + doc[insert:]
+}
@@ -0,0 +1,160 @@
+package template
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func readDOCXParts(t *testing.T, docx []byte) map[string]string {
+	reader, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	require.NoError(t, err)
+
+	parts := make(map[string]string, len(reader.File))
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		parts[file.Name] = string(content)
+	}
+	return parts
+}
+
+func TestStampXLSX(t *testing.T) {
+	content := buildTestXLSX(t, map[string]string{"A1": "Имя"})
+
+	stamp := Stamp{
+		Title:          "Продажи",
+		Author:         "Отдел отчетности",
+		Company:        "ACME",
+		Classification: "CONFIDENTIAL",
+		Watermark:      "CONFIDENTIAL – R&D для ivanov",
+	}
+	stamped, err := StampXLSX(content, stamp)
+	require.NoError(t, err)
+
+	f := openFilledXLSX(t, stamped)
+	props, err := f.GetDocProps()
+	require.NoError(t, err)
+	assert.Equal(t, "Продажи", props.Title)
+	assert.Equal(t, "Отдел отчетности", props.Creator)
+	assert.Equal(t, "CONFIDENTIAL", props.Category)
+	// Незаданные свойства сохраняются
+	assert.NotEmpty(t, props.Created)
+
+	app, err := f.GetAppProps()
+	require.NoError(t, err)
+	assert.Equal(t, "ACME", app.Company)
+	assert.Equal(t, "Go Excelize", app.Application)
+
+	header, err := f.GetHeaderFooter("Sheet1")
+	require.NoError(t, err)
+	assert.Contains(t, header.OddHeader, "&C")
+	assert.Contains(t, header.OddHeader, "CONFIDENTIAL – R&&D для ivanov")
+
+	value, err := f.GetCellValue("Sheet1", "A1")
+	require.NoError(t, err)
+	assert.Equal(t, "Имя", value)
+
+	// Без свойств файл не меняется
+	unchanged, err := StampXLSX(content, Stamp{Title: "Продажи"})
+	require.NoError(t, err)
+	assert.Equal(t, content, unchanged)
+}
+
+func TestStampWorkbookStreamWriter(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	writer, err := f.NewStreamWriter("Sheet1")
+	require.NoError(t, err)
+	require.NoError(t, writer.SetRow("A1", []interface{}{"Имя"}))
+	require.NoError(t, StampWorkbook(f, Stamp{Watermark: "DRAFT"}))
+	require.NoError(t, writer.Flush())
+
+	var buffer bytes.Buffer
+	require.NoError(t, f.Write(&buffer))
+
+	stamped := openFilledXLSX(t, buffer.Bytes())
+	header, err := stamped.GetHeaderFooter("Sheet1")
+	require.NoError(t, err)
+	assert.Contains(t, header.OddHeader, "DRAFT")
+}
+
+func TestStampDOCXWithoutHeaders(t *testing.T) {
+	content := buildTestDOCX(t, testDocumentXML)
+
+	stamped, err := StampDOCX(content, Stamp{
+		Title:          "Продажи",
+		Author:         "Отдел <отчетности>",
+		Company:        "ACME",
+		Classification: "CONFIDENTIAL",
+		Watermark:      `CONFIDENTIAL – "ivanov"`,
+	})
+	require.NoError(t, err)
+
+	parts := readDOCXParts(t, stamped)
+	assert.Contains(t, parts["docProps/core.xml"], "<dc:creator>Отдел &lt;отчетности&gt;</dc:creator>")
+	assert.Contains(t, parts["docProps/core.xml"], "<dc:title>Продажи</dc:title>")
+	assert.Contains(t, parts["docProps/core.xml"], "<cp:category>CONFIDENTIAL</cp:category>")
+	assert.Contains(t, parts["docProps/app.xml"], "<Company>ACME</Company>")
+	assert.Contains(t, parts["_rels/.rels"], `Target="docProps/core.xml"`)
+	assert.Contains(t, parts["_rels/.rels"], `Target="docProps/app.xml"`)
+
+	// Разделу по умолчанию назначается колонтитул с водяным знаком
+	document := parts["word/document.xml"]
+	assert.Contains(t, document, `<w:sectPr><w:headerReference w:type="default" r:id="rIdWatermark"/></w:sectPr></w:body>`)
+	assert.Contains(t, document, `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`)
+	assert.Contains(t, document, "{{unknown}}")
+	assert.Contains(t, parts["word/_rels/document.xml.rels"], `Id="rIdWatermark"`)
+	assert.Contains(t, parts["word/headerWatermark.xml"], `string="CONFIDENTIAL – &#34;ivanov&#34;"`)
+	assert.Contains(t, parts["word/headerWatermark.xml"], `xmlns:v="urn:schemas-microsoft-com:vml"`)
+	assert.Contains(t, parts["[Content_Types].xml"], `<Override PartName="/word/headerWatermark.xml"`)
+	assert.Contains(t, parts["[Content_Types].xml"], `<Override PartName="/docProps/core.xml"`)
+}
+
+func TestStampDOCXExistingHeaders(t *testing.T) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"></Types>`},
+		{"docProps/core.xml", `<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:creator>Word</dc:creator><dc:title/></cp:coreProperties>`},
+		{"word/document.xml", `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>` +
+			`<w:p><w:pPr><w:sectPr><w:headerReference w:type="default" r:id="rId1"/></w:sectPr></w:pPr></w:p>` +
+			`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/></w:sectPr></w:body></w:document>`},
+		{"word/header1.xml", `<w:hdr xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:p><w:r><w:t>Шапка</w:t></w:r></w:p></w:hdr>`},
+	} {
+		w, err := writer.Create(part.name)
+		require.NoError(t, err)
+		_, err = io.WriteString(w, part.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	stamped, err := StampDOCX(buffer.Bytes(), Stamp{Title: "Продажи", Author: "ACME", Watermark: "DRAFT"})
+	require.NoError(t, err)
+
+	parts := readDOCXParts(t, stamped)
+	assert.Contains(t, parts["docProps/core.xml"], "<dc:creator>ACME</dc:creator><dc:title>Продажи</dc:title>")
+	assert.NotContains(t, parts["docProps/core.xml"], "Word")
+	assert.NotContains(t, parts, "docProps/app.xml")
+
+	// Водяной знак добавляется в существующий колонтитул перед его содержимым
+	header := parts["word/header1.xml"]
+	assert.Contains(t, header, `string="DRAFT"`)
+	assert.Contains(t, header, `xmlns:o="urn:schemas-microsoft-com:office:office"`)
+	assert.Less(t, bytes.Index([]byte(header), []byte("PowerPlusWaterMarkObject")), bytes.Index([]byte(header), []byte("Шапка")))
+
+	// Только раздел без колонтитула получает колонтитул с водяным знаком
+	document := parts["word/document.xml"]
+	assert.Contains(t, document, `<w:sectPr><w:headerReference w:type="default" r:id="rId1"/></w:sectPr>`)
+	assert.Contains(t, document, `<w:sectPr><w:headerReference w:type="default" r:id="rIdWatermark"/><w:pgSz`)
+	assert.Contains(t, parts, "word/headerWatermark.xml")
+}
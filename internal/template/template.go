@@ -0,0 +1,149 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dateTimeLayout формат вывода дат в шаблонах
+	dateTimeLayout = "2006-01-02 15:04:05"
+)
+
+// placeholderPattern регулярное выражение для поиска плейсхолдеров.
+// Синтаксис плейсхолдеров в шаблонах:
+//
+//	{{name}}            значение из Data.Fields
+//	{{.column}}         колонка текущей записи основного набора (Data.Records)
+//	{{dataset.column}}  колонка текущей записи именованного набора (Data.Datasets)
+//
+// Строки таблиц, содержащие плейсхолдеры записей, повторяются для каждой записи набора.
+// В XLSX шаблонах несколько строк повторяются блоком между строками с ячейками
+// {{range}} (основной набор) или {{range dataset}} и {{end}}.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// Record одна строка результата запроса
+type Record map[string]interface{}
+
+// Data данные для заполнения шаблона
+type Data struct {
+	Fields   map[string]interface{} `json:"fields,omitempty"`
+	Records  []Record               `json:"records,omitempty"`
+	Datasets map[string][]Record    `json:"datasets,omitempty"`
+}
+
+// TemplateFiller интерфейс для заполнения шаблонов данными
+type TemplateFiller interface {
+	Fill(ctx context.Context, tmpl []byte, data Data) ([]byte, error)
+	GetMimeType() string
+	GetFileExtension() string
+}
+
+// recordRef ссылка плейсхолдера на колонку записи
+type recordRef struct {
+	dataset string // пустая строка для основного набора
+	column  string
+}
+
+// parseRecordRef определяет, ссылается ли ключ на колонку записи
+func (d Data) parseRecordRef(key string) (recordRef, bool) {
+	if strings.HasPrefix(key, ".") {
+		return recordRef{column: strings.TrimPrefix(key, ".")}, true
+	}
+
+	if name, column, found := strings.Cut(key, "."); found {
+		if _, exists := d.Datasets[name]; exists {
+			return recordRef{dataset: name, column: column}, true
+		}
+	}
+
+	return recordRef{}, false
+}
+
+// records возвращает записи набора по имени
+func (d Data) records(dataset string) []Record {
+	if dataset == "" {
+		return d.Records
+	}
+	return d.Datasets[dataset]
+}
+
+// fieldResolver возвращает функцию разрешения плейсхолдеров из Fields
+func (d Data) fieldResolver() func(key string) (string, bool) {
+	return formatted(d.fieldValues())
+}
+
+// recordResolver возвращает функцию разрешения плейсхолдеров записи с откатом на Fields
+func (d Data) recordResolver(dataset string, record Record) func(key string) (string, bool) {
+	return formatted(d.recordValues(dataset, record))
+}
+
+// fieldValues возвращает функцию разрешения плейсхолдеров из Fields в исходные значения
+func (d Data) fieldValues() func(key string) (interface{}, bool) {
+	return func(key string) (interface{}, bool) {
+		value, exists := d.Fields[key]
+		return value, exists
+	}
+}
+
+// recordValues возвращает функцию разрешения плейсхолдеров записи в исходные значения с откатом на Fields
+func (d Data) recordValues(dataset string, record Record) func(key string) (interface{}, bool) {
+	fields := d.fieldValues()
+	return func(key string) (interface{}, bool) {
+		if ref, ok := d.parseRecordRef(key); ok {
+			if ref.dataset != dataset {
+				return nil, false
+			}
+			return record[ref.column], true
+		}
+		return fields(key)
+	}
+}
+
+// formatted преобразует значения, найденные resolve, в строки
+func formatted(resolve func(key string) (interface{}, bool)) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := resolve(key)
+		if !ok {
+			return "", false
+		}
+		return FormatValue(value), true
+	}
+}
+
+// findRecordRef ищет в тексте первый плейсхолдер, ссылающийся на запись
+func (d Data) findRecordRef(text string) (recordRef, bool) {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if ref, ok := d.parseRecordRef(match[1]); ok {
+			return ref, true
+		}
+	}
+	return recordRef{}, false
+}
+
+// FormatValue преобразует значение в строку для вставки в документ
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(dateTimeLayout)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.Format(dateTimeLayout)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
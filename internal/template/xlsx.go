@@ -0,0 +1,637 @@
+package template
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"report_srv/internal/logging"
+
+	"github.com/xuri/excelize/v2"
+)
+
+var (
+	// xlsxRangePattern ячейка начала блока строк: {{range}} или {{range dataset}}
+	xlsxRangePattern = regexp.MustCompile(`^\{\{\s*range(?:\s+([^{}\s]+))?\s*\}\}$`)
+
+	// xlsxEndPattern ячейка конца блока строк
+	xlsxEndPattern = regexp.MustCompile(`^\{\{\s*end\s*\}\}$`)
+
+	// xlsxAggregatePattern ячейка итога по колонке блока: {{sum .amount}} или {{average sales.amount}}
+	xlsxAggregatePattern = regexp.MustCompile(`^\{\{\s*(sum|average|count|min|max)\s+([^{}\s]+)\s*\}\}$`)
+
+	// xlsxCellRefPattern ссылка на ячейку в формуле: B4, $B4, B$4 или $B$4
+	xlsxCellRefPattern = regexp.MustCompile(`^(\$?[A-Za-z]{1,3})(\$?)([0-9]+)`)
+)
+
+// XLSXFiller заполняет XLSX шаблоны данными. Заголовки, итоги и оформление вокруг
+// повторяемых строк сохраняются: строки ниже блока сдвигаются на число записей.
+// Ячейка вне блоков с итогом {{sum .amount}} (также average, count, min, max) получает
+// формулу по заполненным строкам колонки, в которой блок выводит {{.amount}}.
+type XLSXFiller struct {
+	limits Limits
+	logger logging.Logger
+}
+
+// NewXLSXFiller создает новый заполнитель XLSX шаблонов без ограничений
+func NewXLSXFiller(logger logging.Logger) TemplateFiller {
+	return NewXLSXFillerWithLimits(Limits{}, logger)
+}
+
+// NewXLSXFillerWithLimits создает заполнитель XLSX шаблонов с ограничениями
+func NewXLSXFillerWithLimits(limits Limits, logger logging.Logger) TemplateFiller {
+	return &XLSXFiller{limits: limits, logger: logger}
+}
+
+// Fill подставляет данные в ячейки всех листов XLSX шаблона
+func (x *XLSXFiller) Fill(ctx context.Context, tmpl []byte, data Data) ([]byte, error) {
+	// Размеры частей проверяются по оглавлению архива до того, как excelize распакует их в память
+	archive, err := zip.NewReader(bytes.NewReader(tmpl), int64(len(tmpl)))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия XLSX шаблона: %w", err)
+	}
+	budget, err := x.limits.newBudget(tmpl, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия XLSX шаблона: %w", err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if err := checkLimit("число листов шаблона", int64(len(sheets)), int64(x.limits.MaxSheets)); err != nil {
+		return nil, err
+	}
+	for _, sheet := range sheets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := fillSheet(f, sheet, data, budget); err != nil {
+			return nil, fmt.Errorf("лист %s: %w", sheet, err)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := f.Write(&limitedWriter{w: &buffer, max: x.limits.MaxMemory}); err != nil {
+		return nil, fmt.Errorf("ошибка записи XLSX файла: %w", err)
+	}
+
+	x.logger.WithField("records", len(data.Records)).Debug("XLSX шаблон заполнен")
+	return buffer.Bytes(), nil
+}
+
+// GetMimeType возвращает MIME тип XLSX документа
+func (x *XLSXFiller) GetMimeType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+// GetFileExtension возвращает расширение XLSX документа
+func (x *XLSXFiller) GetFileExtension() string {
+	return "xlsx"
+}
+
+// rowBlock строки шаблона с first по last, повторяемые для каждой записи набора.
+// У блока {{range}} ... {{end}} строки маркеров до и после блока удаляются.
+type rowBlock struct {
+	first   int
+	last    int
+	marked  bool
+	dataset string
+}
+
+// shift возвращает сдвиг строк ниже блока после его раскрытия для count записей
+func (b rowBlock) shift(count int) int {
+	shift := (count - 1) * (b.last - b.first + 1)
+	if b.marked {
+		shift -= 2
+	}
+	return shift
+}
+
+// end возвращает последнюю строку блока вместе со строкой {{end}}
+func (b rowBlock) end() int {
+	if b.marked {
+		return b.last + 1
+	}
+	return b.last
+}
+
+// aggregateCell ячейка шаблона с итогом по колонке блока
+type aggregateCell struct {
+	column   int
+	row      int
+	function string
+	ref      recordRef
+}
+
+// fillSheet раскрывает блоки строк листа и подставляет Fields в остальные ячейки
+func fillSheet(f *excelize.File, sheet string, data Data, budget *fillBudget) error {
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return err
+	}
+
+	blocks, err := findRowBlocks(rows, data)
+	if err != nil {
+		return err
+	}
+
+	// Строки блоков учитываются до раскрытия: вставка строк в excelize держит лист в памяти
+	for _, block := range blocks {
+		width := 0
+		for row := block.first; row <= block.last; row++ {
+			width = max(width, len(rows[row-1]))
+		}
+		if err := budget.add(len(data.records(block.dataset))*(block.last-block.first+1), width); err != nil {
+			return err
+		}
+	}
+
+	// Ячейки блоков заполняются при раскрытии, до него номера строк совпадают с rows
+	inBlock := make(map[int]bool)
+	for _, block := range blocks {
+		from, to := block.first, block.last
+		if block.marked {
+			from, to = from-1, to+1
+		}
+		for row := from; row <= to; row++ {
+			inBlock[row] = true
+		}
+	}
+	fields := data.fieldValues()
+	var aggregates []aggregateCell
+	for i, cells := range rows {
+		if inBlock[i+1] {
+			continue
+		}
+		for j, text := range cells {
+			if !strings.Contains(text, "{{") {
+				continue
+			}
+			// Итоги записываются после раскрытия блоков, когда известны их строки
+			if match := xlsxAggregatePattern.FindStringSubmatch(strings.TrimSpace(text)); match != nil {
+				if ref, ok := data.parseRecordRef(match[2]); ok {
+					aggregates = append(aggregates, aggregateCell{column: j + 1, row: i + 1, function: match[1], ref: ref})
+					continue
+				}
+			}
+			cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			if err := setTemplateCell(f, sheet, cell, text, fields); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Блоки раскрываются снизу вверх, чтобы строки верхних блоков не сдвигались
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if err := expandBlock(f, sheet, blocks[i], rows, data); err != nil {
+			return fmt.Errorf("строки %d-%d: %w", blocks[i].first, blocks[i].last, err)
+		}
+	}
+
+	for _, aggregate := range aggregates {
+		if err := setAggregateCell(f, sheet, aggregate, blocks, rows, data); err != nil {
+			return fmt.Errorf("итог %s %s: %w", aggregate.function, aggregate.ref.column, err)
+		}
+	}
+	return nil
+}
+
+// setAggregateCell записывает формулу итога по строкам колонки во всех блоках набора.
+// Диапазон колонки включает все строки записей блока, поэтому итог многострочного блока
+// учитывает и другие числа в этой колонке.
+func setAggregateCell(f *excelize.File, sheet string, aggregate aggregateCell, blocks []rowBlock, cells [][]string, data Data) error {
+	records := data.records(aggregate.ref.dataset)
+	total := NewAggregate(aggregate.function)
+	for _, record := range records {
+		total.Add(record[aggregate.ref.column])
+	}
+
+	// Строки блоков и ячейки сдвигаются раскрытием блоков выше них
+	var ranges []string
+	row, shift := aggregate.row, 0
+	for _, block := range blocks {
+		count := len(data.records(block.dataset))
+		if block.end() < aggregate.row {
+			row += block.shift(count)
+		}
+		if column := blockColumn(block, cells, data, aggregate.ref); column > 0 && count > 0 {
+			first := block.first + shift
+			if block.marked {
+				first--
+			}
+			from, _ := excelize.CoordinatesToCellName(column, first)
+			to, _ := excelize.CoordinatesToCellName(column, first+count*(block.last-block.first+1)-1)
+			ranges = append(ranges, from+":"+to)
+		}
+		shift += block.shift(count)
+	}
+
+	cell, _ := excelize.CoordinatesToCellName(aggregate.column, row)
+	value := total.Value()
+	if value == nil {
+		value = ""
+	}
+	if err := f.SetCellValue(sheet, cell, value); err != nil {
+		return err
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	return f.SetCellFormula(sheet, cell, total.Formula(ranges))
+}
+
+// blockColumn возвращает колонку, в которой блок выводит колонку записи ref, или 0
+func blockColumn(block rowBlock, cells [][]string, data Data, ref recordRef) int {
+	if block.dataset != ref.dataset {
+		return 0
+	}
+	for row := block.first; row <= block.last && row <= len(cells); row++ {
+		for j, text := range cells[row-1] {
+			for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+				if found, ok := data.parseRecordRef(match[1]); ok && found == ref {
+					return j + 1
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// findRowBlocks находит блоки {{range}} ... {{end}} и отдельные строки с плейсхолдерами записей
+func findRowBlocks(rows [][]string, data Data) ([]rowBlock, error) {
+	var blocks []rowBlock
+	for i := 0; i < len(rows); i++ {
+		if dataset, ok := rangeMarker(rows[i]); ok {
+			if _, exists := data.Datasets[dataset]; dataset != "" && !exists {
+				return nil, fmt.Errorf("строка %d: неизвестный набор данных %s", i+1, dataset)
+			}
+
+			end := i + 1
+			for ; end < len(rows) && !hasEndMarker(rows[end]); end++ {
+				if _, nested := rangeMarker(rows[end]); nested {
+					return nil, fmt.Errorf("строка %d: вложенные блоки {{range}} не поддерживаются", end+1)
+				}
+			}
+			if end == len(rows) {
+				return nil, fmt.Errorf("строка %d: нет строки {{end}} для {{range}}", i+1)
+			}
+
+			blocks = append(blocks, rowBlock{first: i + 2, last: end, marked: true, dataset: dataset})
+			i = end
+			continue
+		}
+
+		if hasEndMarker(rows[i]) {
+			return nil, fmt.Errorf("строка %d: {{end}} без {{range}}", i+1)
+		}
+		if ref, ok := data.findRecordRef(strings.Join(rows[i], " ")); ok {
+			blocks = append(blocks, rowBlock{first: i + 1, last: i + 1, dataset: ref.dataset})
+		}
+	}
+	return blocks, nil
+}
+
+// rangeMarker возвращает набор данных, если в строке есть ячейка {{range}}
+func rangeMarker(cells []string) (string, bool) {
+	for _, text := range cells {
+		if match := xlsxRangePattern.FindStringSubmatch(strings.TrimSpace(text)); match != nil {
+			return match[1], true
+		}
+	}
+	return "", false
+}
+
+// hasEndMarker проверяет, есть ли в строке ячейка {{end}}
+func hasEndMarker(cells []string) bool {
+	for _, text := range cells {
+		if xlsxEndPattern.MatchString(strings.TrimSpace(text)) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandBlock повторяет строки блока для каждой записи набора.
+// Первая запись заполняет строки шаблона, для остальных вставляются копии строк со стилями,
+// высотой и объединениями ячеек. Блок без записей удаляется.
+func expandBlock(f *excelize.File, sheet string, block rowBlock, cells [][]string, data Data) error {
+	records := data.records(block.dataset)
+	height := block.last - block.first + 1
+
+	if height > 0 && len(records) > 0 {
+		rows, err := readTemplateRows(f, sheet, block, cells)
+		if err != nil {
+			return err
+		}
+		if len(records) > 1 {
+			if err := f.InsertRows(sheet, block.last+1, (len(records)-1)*height); err != nil {
+				return err
+			}
+		}
+		for i, record := range records {
+			values := data.recordValues(block.dataset, record)
+			for _, row := range rows {
+				if err := row.write(f, sheet, i*height, values); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if block.marked {
+		if err := f.RemoveRow(sheet, block.first+max(len(records), 1)*height); err != nil {
+			return err
+		}
+	}
+	if len(records) == 0 {
+		for row := block.last; row >= block.first; row-- {
+			if err := f.RemoveRow(sheet, row); err != nil {
+				return err
+			}
+		}
+	}
+	if block.marked {
+		return f.RemoveRow(sheet, block.first-1)
+	}
+	return nil
+}
+
+// templateRow строка шаблона внутри блока
+type templateRow struct {
+	row    int
+	cells  []templateCell
+	height float64
+	// merges объединения ячеек в пределах строки: номера первой и последней колонки
+	merges [][2]int
+}
+
+// templateCell ячейка строки шаблона
+type templateCell struct {
+	column  int
+	style   int
+	formula string
+	// text исходный текст ячейки с плейсхолдерами
+	text  string
+	value interface{}
+}
+
+// readTemplateRows читает ячейки, высоту и объединения строк блока
+func readTemplateRows(f *excelize.File, sheet string, block rowBlock, cells [][]string) ([]templateRow, error) {
+	// Размеры листа учитывают пустые ячейки с оформлением, но не всегда заполнены
+	width, err := sheetWidth(f, sheet)
+	if err != nil {
+		return nil, err
+	}
+	for row := block.first; row <= block.last && row <= len(cells); row++ {
+		width = max(width, len(cells[row-1]))
+	}
+	props, err := f.GetSheetProps(sheet)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := f.GetMergeCells(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]templateRow, 0, block.last-block.first+1)
+	for number := block.first; number <= block.last; number++ {
+		row := templateRow{row: number}
+		if height, err := f.GetRowHeight(sheet, number); err == nil && (props.DefaultRowHeight == nil || height != *props.DefaultRowHeight) {
+			row.height = height
+		}
+
+		for column := 1; column <= width; column++ {
+			cell, err := readTemplateCell(f, sheet, column, number)
+			if err != nil {
+				return nil, err
+			}
+			if cell.style != 0 || cell.formula != "" || cell.text != "" || cell.value != nil {
+				row.cells = append(row.cells, cell)
+			}
+		}
+
+		for _, merge := range merged {
+			startColumn, startRow, _ := excelize.CellNameToCoordinates(merge.GetStartAxis())
+			endColumn, endRow, _ := excelize.CellNameToCoordinates(merge.GetEndAxis())
+			if startRow == number && endRow == number {
+				row.merges = append(row.merges, [2]int{startColumn, endColumn})
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readTemplateCell читает стиль, формулу и значение ячейки шаблона
+func readTemplateCell(f *excelize.File, sheet string, column, row int) (templateCell, error) {
+	name, _ := excelize.CoordinatesToCellName(column, row)
+	cell := templateCell{column: column}
+
+	var err error
+	if cell.style, err = f.GetCellStyle(sheet, name); err != nil {
+		return cell, err
+	}
+	if cell.formula, err = f.GetCellFormula(sheet, name); err != nil || cell.formula != "" {
+		return cell, err
+	}
+
+	text, err := f.GetCellValue(sheet, name, excelize.Options{RawCellValue: true})
+	if err != nil || text == "" {
+		return cell, err
+	}
+	if strings.Contains(text, "{{") {
+		cell.text = text
+		return cell, nil
+	}
+
+	// Копии строк получают значения исходного типа
+	cellType, err := f.GetCellType(sheet, name)
+	if err != nil {
+		return cell, err
+	}
+	cell.value = text
+	switch cellType {
+	case excelize.CellTypeNumber, excelize.CellTypeUnset:
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			cell.value = number
+		}
+	case excelize.CellTypeBool:
+		cell.value = text == "1"
+	}
+	return cell, nil
+}
+
+// write заполняет строку шаблона, сдвинутую на offset строк.
+// Строки копий получают стили, формулы и значения строки шаблона.
+func (t templateRow) write(f *excelize.File, sheet string, offset int, values func(key string) (interface{}, bool)) error {
+	number := t.row + offset
+	copied := offset > 0
+
+	for _, cell := range t.cells {
+		name, _ := excelize.CoordinatesToCellName(cell.column, number)
+		if copied && cell.style != 0 {
+			if err := f.SetCellStyle(sheet, name, name, cell.style); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		switch {
+		case cell.text != "":
+			err = setTemplateCell(f, sheet, name, cell.text, values)
+		case !copied:
+			// Остальные ячейки строки шаблона уже на месте
+		case cell.formula != "":
+			err = f.SetCellFormula(sheet, name, shiftFormulaRows(cell.formula, offset))
+		case cell.value != nil:
+			err = f.SetCellValue(sheet, name, cell.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !copied {
+		return nil
+	}
+	if t.height > 0 {
+		if err := f.SetRowHeight(sheet, number, t.height); err != nil {
+			return err
+		}
+	}
+	for _, merge := range t.merges {
+		first, _ := excelize.CoordinatesToCellName(merge[0], number)
+		last, _ := excelize.CoordinatesToCellName(merge[1], number)
+		if err := f.MergeCell(sheet, first, last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTemplateCell подставляет значения в плейсхолдеры ячейки. Ячейка из одного
+// плейсхолдера получает значение исходного типа, чтобы числа и даты оставались числами.
+// Неизвестные плейсхолдеры остаются в ячейке без изменений.
+func setTemplateCell(f *excelize.File, sheet, cell, text string, resolve func(key string) (interface{}, bool)) error {
+	trimmed := strings.TrimSpace(text)
+	if match := placeholderPattern.FindStringSubmatch(trimmed); match != nil && match[0] == trimmed {
+		if value, ok := resolve(match[1]); ok {
+			return f.SetCellValue(sheet, cell, cellValue(value))
+		}
+	}
+
+	format := formatted(resolve)
+	replaced := placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := format(placeholderPattern.FindStringSubmatch(placeholder)[1]); ok {
+			return value
+		}
+		return placeholder
+	})
+	return f.SetCellValue(sheet, cell, replaced)
+}
+
+// cellValue приводит значение записи к типу, который excelize записывает в ячейку
+func cellValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return *v
+	default:
+		return value
+	}
+}
+
+// sheetWidth возвращает номер последней колонки листа по его размерам
+func sheetWidth(f *excelize.File, sheet string) (int, error) {
+	dimension, err := f.GetSheetDimension(sheet)
+	if err != nil || dimension == "" {
+		return 0, err
+	}
+	if _, last, found := strings.Cut(dimension, ":"); found {
+		dimension = last
+	}
+	column, _, err := excelize.CellNameToCoordinates(dimension)
+	if err != nil {
+		return 0, fmt.Errorf("неверные размеры листа %q: %w", dimension, err)
+	}
+	return column, nil
+}
+
+// shiftFormulaRows сдвигает относительные ссылки на строки в формуле на offset строк,
+// как Excel при копировании строки. Строковые литералы и имена листов не меняются.
+func shiftFormulaRows(formula string, offset int) string {
+	if offset == 0 {
+		return formula
+	}
+
+	var result strings.Builder
+	for i := 0; i < len(formula); {
+		char := formula[i]
+		switch {
+		case char == '"' || char == '\'':
+			// Литерал до закрывающей кавычки, удвоенная кавычка экранирует себя
+			end := i + 1
+			for end < len(formula) {
+				if formula[end] == char {
+					if end+1 < len(formula) && formula[end+1] == char {
+						end += 2
+						continue
+					}
+					break
+				}
+				end++
+			}
+			end = min(end+1, len(formula))
+			result.WriteString(formula[i:end])
+			i = end
+
+		case isFormulaNameChar(char) && (i == 0 || !isFormulaNameChar(formula[i-1])):
+			end := i
+			for end < len(formula) && isFormulaNameChar(formula[end]) {
+				end++
+			}
+			result.WriteString(shiftCellRef(formula[i:end], offset, end < len(formula) && formula[end] == '('))
+			i = end
+
+		default:
+			result.WriteByte(char)
+			i++
+		}
+	}
+	return result.String()
+}
+
+// shiftCellRef сдвигает строку ссылки на ячейку. Имена функций и другие слова не меняются.
+func shiftCellRef(word string, offset int, function bool) string {
+	match := xlsxCellRefPattern.FindStringSubmatch(word)
+	if function || match == nil || len(match[0]) != len(word) || match[2] == "$" {
+		return word
+	}
+	row, err := strconv.Atoi(match[3])
+	if err != nil || row+offset < 1 || row+offset > excelize.TotalRows {
+		return word
+	}
+	return match[1] + strconv.Itoa(row+offset)
+}
+
+// isFormulaNameChar проверяет, может ли символ входить в ссылку или имя в формуле
+func isFormulaNameChar(char byte) bool {
+	return char == '$' || char == '_' || char == '.' ||
+		('A' <= char && char <= 'Z') || ('a' <= char && char <= 'z') || ('0' <= char && char <= '9')
+}
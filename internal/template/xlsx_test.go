@@ -0,0 +1,249 @@
+package template
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"report_srv/internal/logging"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func buildTestXLSX(t *testing.T, cells map[string]string) []byte {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for cell, value := range cells {
+		require.NoError(t, f.SetCellValue("Sheet1", cell, value))
+	}
+
+	var buffer bytes.Buffer
+	require.NoError(t, f.Write(&buffer))
+	return buffer.Bytes()
+}
+
+func openFilledXLSX(t *testing.T, content []byte) *excelize.File {
+	f, err := excelize.OpenReader(bytes.NewReader(content))
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestXLSXFillerRangeBlock(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for cell, value := range map[string]string{
+		"A1": "Отчет: {{title}}",
+		"A2": "Регион", "B2": "Сумма",
+		"A3": "{{range sales}}",
+		"A4": "{{sales.region}}", "B4": "{{sales.amount}}",
+		"A5": "комментарий: {{sales.note}}",
+		"A6": "{{end}}",
+		"A7": "Итого", "B7": "{{total}}",
+	} {
+		require.NoError(t, f.SetCellValue("Sheet1", cell, value))
+	}
+	format := "#,##0.00"
+	style, err := f.NewStyle(&excelize.Style{CustomNumFmt: &format})
+	require.NoError(t, err)
+	require.NoError(t, f.SetCellStyle("Sheet1", "B4", "B4", style))
+	require.NoError(t, f.MergeCell("Sheet1", "A5", "B5"))
+
+	var buffer bytes.Buffer
+	require.NoError(t, f.Write(&buffer))
+
+	filler := NewXLSXFiller(logging.NewLogrus(logrus.New()))
+	content, err := filler.Fill(context.Background(), buffer.Bytes(), Data{
+		Fields: map[string]interface{}{"title": "Продажи", "total": 300},
+		Datasets: map[string][]Record{"sales": {
+			{"region": "north", "amount": 100.5, "note": "a"},
+			{"region": "south", "amount": 199.5, "note": "b"},
+		}},
+	})
+	require.NoError(t, err)
+
+	filled := openFilledXLSX(t, content)
+	rows, err := filled.GetRows("Sheet1", excelize.Options{RawCellValue: true})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"Отчет: Продажи"},
+		{"Регион", "Сумма"},
+		{"north", "100.5"},
+		{"комментарий: a"},
+		{"south", "199.5"},
+		{"комментарий: b"},
+		{"Итого", "300"},
+	}, rows)
+
+	// Копии строк получают оформление строк шаблона
+	copied, err := filled.GetCellStyle("Sheet1", "B5")
+	require.NoError(t, err)
+	assert.Equal(t, style, copied)
+
+	merged, err := filled.GetMergeCells("Sheet1")
+	require.NoError(t, err)
+	var ranges []string
+	for _, merge := range merged {
+		ranges = append(ranges, merge.GetStartAxis()+":"+merge.GetEndAxis())
+	}
+	assert.ElementsMatch(t, []string{"A4:B4", "A6:B6"}, ranges)
+
+	// Значения из одного плейсхолдера остаются числами и выводятся в формате ячейки
+	value, err := filled.GetCellValue("Sheet1", "B3")
+	require.NoError(t, err)
+	assert.Equal(t, "100.50", value)
+}
+
+func TestXLSXFillerRecordRows(t *testing.T) {
+	template := buildTestXLSX(t, map[string]string{
+		"A1": "Имя",
+		"A2": "{{.name}}", "B2": "{{unknown}}",
+		"A3": "{{range}}",
+		"A4": "{{.name}}",
+		"A5": "{{end}}",
+		"A6": "Конец",
+	})
+
+	filler := NewXLSXFiller(logging.NewLogrus(logrus.New()))
+
+	content, err := filler.Fill(context.Background(), template, Data{Records: []Record{{"name": "a"}, {"name": "b"}}})
+	require.NoError(t, err)
+	rows, err := openFilledXLSX(t, content).GetRows("Sheet1")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"Имя"},
+		{"a", "{{unknown}}"},
+		{"b", "{{unknown}}"},
+		{"a"},
+		{"b"},
+		{"Конец"},
+	}, rows)
+
+	// Строки без записей удаляются вместе с маркерами блока
+	content, err = filler.Fill(context.Background(), template, Data{})
+	require.NoError(t, err)
+	rows, err = openFilledXLSX(t, content).GetRows("Sheet1")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"Имя"}, {"Конец"}}, rows)
+}
+
+func TestXLSXFillerInvalidBlocks(t *testing.T) {
+	filler := NewXLSXFiller(logging.NewLogrus(logrus.New()))
+
+	for name, cells := range map[string]map[string]string{
+		"без end":           {"A1": "{{range}}", "A2": "{{.name}}"},
+		"end без range":     {"A1": "{{end}}"},
+		"неизвестный набор": {"A1": "{{range missing}}", "A2": "{{end}}"},
+		"вложенный блок":    {"A1": "{{range}}", "A2": "{{range}}", "A3": "{{end}}"},
+	} {
+		template := buildTestXLSX(t, cells)
+		_, err := filler.Fill(context.Background(), template, Data{})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestXLSXFillerAggregates(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	for cell, value := range map[string]string{
+		"A1": "{{.name}}",
+		"A2": "{{range sales}}",
+		"A3": "{{sales.region}}", "B3": "{{sales.amount}}",
+		"A4": "{{end}}",
+		"A5": "Итого", "B5": "{{sum sales.amount}}", "C5": "{{average sales.amount}}", "D5": "{{sum total}}",
+	} {
+		require.NoError(t, f.SetCellValue("Sheet1", cell, value))
+	}
+	require.NoError(t, f.SetCellFormula("Sheet1", "C3", "B3*2"))
+
+	var buffer bytes.Buffer
+	require.NoError(t, f.Write(&buffer))
+
+	filler := NewXLSXFiller(logging.NewLogrus(logrus.New()))
+	content, err := filler.Fill(context.Background(), buffer.Bytes(), Data{
+		Records: []Record{{"name": "a"}, {"name": "b"}},
+		Datasets: map[string][]Record{"sales": {
+			{"region": "north", "amount": 10},
+			{"region": "south", "amount": 20},
+			{"region": "east", "amount": 30.5},
+		}},
+	})
+	require.NoError(t, err)
+	filled := openFilledXLSX(t, content)
+
+	// Формулы итогов ссылаются на строки блока после раскрытия всех блоков листа
+	for cell, expected := range map[string]string{
+		"B6": "SUM(B3:B5)",
+		"C6": "AVERAGE(B3:B5)",
+		"C4": "B4*2",
+		"C5": "B5*2",
+	} {
+		formula, err := filled.GetCellFormula("Sheet1", cell)
+		require.NoError(t, err)
+		assert.Equal(t, expected, formula, cell)
+	}
+
+	// Итоги посчитаны заранее и видны без пересчета книги
+	value, err := filled.GetCellValue("Sheet1", "B6")
+	require.NoError(t, err)
+	assert.Equal(t, "60.5", value)
+
+	// Итог по полю, а не по колонке записи, не раскрывается
+	value, err = filled.GetCellValue("Sheet1", "D6")
+	require.NoError(t, err)
+	assert.Equal(t, "{{sum total}}", value)
+
+	// Итог пустого набора не содержит формулы
+	content, err = filler.Fill(context.Background(), buffer.Bytes(), Data{Datasets: map[string][]Record{"sales": nil}})
+	require.NoError(t, err)
+	filled = openFilledXLSX(t, content)
+	rows, err := filled.GetRows("Sheet1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Итого", "0"}, rows[0][:2])
+	formula, err := filled.GetCellFormula("Sheet1", "B1")
+	require.NoError(t, err)
+	assert.Empty(t, formula)
+}
+
+func TestShiftFormulaRows(t *testing.T) {
+	for formula, expected := range map[string]string{
+		"B3*2":                                   "B5*2",
+		"SUM($B$3:B3)+B$1":                       "SUM($B$3:B5)+B$1",
+		`IF(A3="B3",LOG10(B3),'Sheet 1'!C3)`:     `IF(A5="B3",LOG10(B5),'Sheet 1'!C5)`,
+		`CONCAT("it's ""A1""",'O''Brien'!A1,x1)`: `CONCAT("it's ""A1""",'O''Brien'!A3,x3)`,
+	} {
+		assert.Equal(t, expected, shiftFormulaRows(formula, 2), formula)
+	}
+}
+
+func TestXLSXFillerLimits(t *testing.T) {
+	tmpl := buildTestXLSX(t, map[string]string{"A1": "{{.name}}", "B1": "{{.amount}}"})
+	data := Data{Records: []Record{{"name": "Анна"}, {"name": "Иван"}, {"name": "Олег"}}}
+
+	_, err := NewXLSXFillerWithLimits(Limits{MaxRows: 2}, logging.NewLogrus(logrus.New())).Fill(context.Background(), tmpl, data)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = NewXLSXFillerWithLimits(Limits{MaxCells: 5}, logging.NewLogrus(logrus.New())).Fill(context.Background(), tmpl, data)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = NewXLSXFillerWithLimits(Limits{MaxMemory: 1024}, logging.NewLogrus(logrus.New())).Fill(context.Background(), tmpl, data)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+
+	f := excelize.NewFile()
+	_, err = f.NewSheet("Sheet2")
+	require.NoError(t, err)
+	var buffer bytes.Buffer
+	require.NoError(t, f.Write(&buffer))
+	require.NoError(t, f.Close())
+	_, err = NewXLSXFillerWithLimits(Limits{MaxSheets: 1}, logging.NewLogrus(logrus.New())).Fill(context.Background(), buffer.Bytes(), data)
+	var limitErr *LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, "число листов шаблона", limitErr.Limit)
+
+	_, err = NewXLSXFillerWithLimits(Limits{MaxRows: 3, MaxCells: 6, MaxSheets: 1}, logging.NewLogrus(logrus.New())).Fill(context.Background(), tmpl, data)
+	assert.NoError(t, err)
+}